@@ -2,18 +2,29 @@ package api
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"net"
 	"net/http"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 
 	"dxlib/v3/configurations"
 	"dxlib/v3/core"
 	"dxlib/v3/log"
+	"dxlib/v3/metrics"
+	"dxlib/v3/tracing"
 	"dxlib/v3/utils"
 	utilsHttp "dxlib/v3/utils/http"
 	"dxlib/v3/utils/json"
@@ -22,6 +33,10 @@ import (
 const (
 	DXAPIDefaultWriteTimeoutSec = 300
 	DXAPIDefaultReadTimeoutSec  = 300
+	DXAPIDefaultShutdownTimeout = 30 * time.Second
+	DXAPIDefaultIdleTimeoutSec  = 120
+	DXAPIDefaultMaxHeaderBytes  = 8 * 1024
+	DXAPIDefaultMaxBodyBytes    = 4 * 1024 * 1024
 )
 
 type DXAPI struct {
@@ -29,12 +44,59 @@ type DXAPI struct {
 	Address         string
 	WriteTimeoutSec int
 	ReadTimeoutSec  int
-	EndPoints       []DXAPIEndPoint
-	RuntimeIsActive bool
-	HTTPServer      *fiber.App
-	Log             log.DXLog
-	Context         context.Context
-	Cancel          context.CancelFunc
+	IdleTimeoutSec  int
+	MaxHeaderBytes  int
+	MaxBodyBytes    int
+	// IsStreamRequestBody streams the bodies over MaxBodyBytes from the connection instead of rejecting them with 413, for
+	// ReadMultipartStream, the end points reading Body still get the whole body in memory
+	IsStreamRequestBody bool
+	// ClientDisconnectCheckIntervalMs is how often a request checks its client is still connected, its context, and so its
+	// queries, are cancelled once the client is gone. Not above 0 disables it
+	ClientDisconnectCheckIntervalMs int
+	// MaxInFlightRequests is the number of requests served at once, the next ones are shed with 503 and
+	// LoadSheddingRetryAfterSec, see loadSheddingMiddleware. Not above 0 disables it
+	MaxInFlightRequests       int
+	LoadSheddingRetryAfterSec int
+	inFlightRequests          atomic.Int64
+	inFlightSlots             chan struct{}
+	// shedRequests are the requests shed since the last warning, at lastShedWarningAt in unix nanoseconds
+	shedRequests      atomic.Int64
+	lastShedWarningAt atomic.Int64
+	// Listener is the socket the API is served on at Address, handed over to the new process on a graceful restart
+	Listener net.Listener
+	// Listens are the sockets the API is also served on, with the same routes and middlewares, like the unix socket of a
+	// sidecar, Listeners are all the running ones. On a graceful restart the TCP ones are handed over, see ListenerFiles,
+	// and the unix sockets are listened again by the new process
+	Listens         []DXAPIListenSpec
+	Listeners       []net.Listener
+	activeListeners atomic.Int32
+	// listenerSpecs are the specs of Listeners, the one of Address first
+	listenerSpecs []DXAPIListenSpec
+	CORS          *DXAPICORSConfiguration
+	Auth          *DXAPIAuthConfiguration
+	Idempotency   *DXAPIIdempotencyConfiguration
+	Tenant        *DXAPITenantConfiguration
+	// TLS serves the API over HTTPS on all its listeners, with the certificate swapped in by ReloadCertificate
+	TLS         *DXAPITLSConfiguration
+	certificate atomic.Pointer[tls.Certificate]
+	// Middlewares run in order before the end point handlers of every route
+	Middlewares []fiber.Handler
+	EndPoints   []DXAPIEndPoint
+	WSRoutes    []dxAPIWSRoute
+	// WSSendBufferSize is the number of messages queued for a WebSocket client before it is dropped as too slow
+	WSSendBufferSize int
+	RuntimeIsActive  bool
+	HTTPServer       *fiber.App
+	Log              log.DXLog
+	Context          context.Context
+	Cancel           context.CancelFunc
+	// wsContext is done at the shutdown of the API, closing its WebSocket connections
+	wsContext context.Context
+	wsCancel  context.CancelFunc
+
+	// connections are the open connections, closed by StartShutdown when they outlast Manager.ShutdownTimeout
+	connections      map[net.Conn]struct{}
+	connectionsMutex sync.Mutex
 }
 
 var SpecFormat = "MarkDown"
@@ -59,6 +121,23 @@ type DXAPIManager struct {
 	APIs              map[string]*DXAPI
 	ErrorGroup        *errgroup.Group
 	ErrorGroupContext context.Context
+	// ShutdownTimeout is how long the in-flight requests are waited for once the listeners are closed
+	ShutdownTimeout time.Duration
+	// IsDebug registers the /debug routes, guarded by DebugKey
+	IsDebug  bool
+	DebugKey string
+	// JSONCodec encodes the responses and decodes the request bodies, nil is set from the api configuration at StartAll
+	JSONCodec DXAPIJSONCodec
+	// AddressOverrides are the addresses of the APIs by name id that replace the address of their configuration
+	AddressOverrides map[string]string
+	// MaintenanceRedisNameId, when set, shares the maintenance of the APIs through the Redis key MaintenanceRedisKey
+	MaintenanceRedisNameId        string
+	MaintenanceRedisKey           string
+	MaintenanceRefreshIntervalSec int
+	MaintenanceRetryAfterSec      int
+	maintenanceMutex              sync.RWMutex
+	maintenance                   DXAPIMaintenance
+	maintenanceLastSeen           string
 }
 
 func (am *DXAPIManager) NewAPI(nameId string) (*DXAPI, error) {
@@ -77,6 +156,9 @@ func (am *DXAPIManager) NewAPI(nameId string) (*DXAPI, error) {
 func (am *DXAPIManager) StartAll(errorGroup *errgroup.Group, errorGroupContext context.Context) error {
 	am.ErrorGroup = errorGroup
 	am.ErrorGroupContext = errorGroupContext
+	am.applyMaintenanceConfiguration()
+	am.applyJSONConfiguration()
+	am.registerInFlightRequestsMetric()
 
 	am.ErrorGroup.Go(func() (err error) {
 		<-am.ErrorGroupContext.Done()
@@ -97,6 +179,7 @@ func (am *DXAPIManager) StartAll(errorGroup *errgroup.Group, errorGroupContext c
 			return err
 		}
 	}
+	am.startMaintenanceWatch()
 	return nil
 }
 
@@ -106,26 +189,96 @@ func (am *DXAPIManager) StopAll() (err error) {
 	return err
 }
 
+// ApplyConfigurations reads the configuration api.<NameId>, an unusable one is fatal.
 func (a *DXAPI) ApplyConfigurations() (err error) {
-	configuration, ok := configurations.Manager.Configurations["api"]
+	return a.applyConfigurations(log.Log.FatalAndCreateErrorf)
+}
+
+// CheckConfiguration applies the configuration of the API and loads its certificate like StartAndWait, without starting
+// it, an unusable configuration is an error instead of fatal. For a preflight.
+func (a *DXAPI) CheckConfiguration() (err error) {
+	err = a.applyConfigurations(log.Log.ErrorAndCreateErrorf)
+	if err != nil {
+		return err
+	}
+	if a.TLS != nil {
+		_, err = LoadCertificate(a.TLS.CertFile, a.TLS.KeyFile)
+		if err != nil {
+			err = log.Log.ErrorAndCreateErrorf("Cannot load the certificate %s (%v)", a.TLS.CertFile, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// applyConfigurations reads the configuration api.<NameId>, the unusable parts are reported by unusable.
+func (a *DXAPI) applyConfigurations(unusable func(text string, v ...any) error) (err error) {
+	configuration, ok := configurations.Manager.Get("api")
 	if !ok {
-		err := log.Log.FatalAndCreateErrorf("Can not find configuration 'api' needed to configure the API")
+		err := unusable("Can not find configuration 'api' needed to configure the API")
 		return err
 	}
 	c := *configuration.Data
 	c1, ok := c[a.NameId].(utils.JSON)
 	if !ok {
-		err := log.Log.FatalAndCreateErrorf("Can not find configuration 'api.%s' needed to configure the API", a.NameId)
+		err := unusable("Can not find configuration 'api.%s' needed to configure the API", a.NameId)
 		return err
 	}
 
 	a.Address, ok = c1[`address`].(string)
+	address, isOverridden := Manager.AddressOverrides[a.NameId]
+	if isOverridden {
+		a.Address, ok = address, true
+	}
+	a.Listens = nil
+	if c1[`listen`] != nil {
+		listens, err := json.GetStrings(c1, `listen`)
+		if err != nil {
+			err = unusable("Configuration 'api.%s/listen' must be a list of string (%v)", a.NameId, err)
+			return err
+		}
+		for _, v := range listens {
+			spec, err := ParseListenSpec(v)
+			if err != nil {
+				err = unusable("Configuration 'api.%s/listen' is unusable (%v)", a.NameId, err)
+				return err
+			}
+			a.Listens = append(a.Listens, spec)
+		}
+		// an API served on the listen entries only has no address
+		ok = ok || len(a.Listens) > 0
+	}
 	if !ok {
-		err := log.Log.FatalAndCreateErrorf("Can not find configuration 'api.%s/address' needed to configure the API", a.NameId)
+		err := unusable("Can not find configuration 'api.%s/address' needed to configure the API", a.NameId)
 		return err
 	}
 	a.WriteTimeoutSec = json.GetNumberWithDefault(c1, `writetimeout-sec`, DXAPIDefaultWriteTimeoutSec)
 	a.ReadTimeoutSec = json.GetNumberWithDefault(c1, `readtimeout-sec`, DXAPIDefaultReadTimeoutSec)
+	a.IdleTimeoutSec = json.GetNumberWithDefault(c1, `idletimeout-sec`, DXAPIDefaultIdleTimeoutSec)
+	a.MaxHeaderBytes = json.GetNumberWithDefault(c1, `max-header-bytes`, DXAPIDefaultMaxHeaderBytes)
+	a.MaxBodyBytes = json.GetNumberWithDefault(c1, `max-body-bytes`, DXAPIDefaultMaxBodyBytes)
+	a.WSSendBufferSize = json.GetNumberWithDefault(c1, `ws-send-buffer-size`, DXAPIDefaultWSSendBufferSize)
+	a.IsStreamRequestBody, _ = c1[`stream-request-body`].(bool)
+	a.ClientDisconnectCheckIntervalMs = json.GetNumberWithDefault(c1, `client-disconnect-check-interval-ms`, DXAPIDefaultClientDisconnectCheckIntervalMs)
+	a.MaxInFlightRequests = json.GetNumberWithDefault(c1, `max-in-flight-requests`, 0)
+	a.LoadSheddingRetryAfterSec = json.GetNumberWithDefault(c1, `load-shedding-retry-after-sec`, DXAPIDefaultLoadSheddingRetryAfterSec)
+	err = a.applyCORSConfiguration(c1)
+	if err != nil {
+		return err
+	}
+	err = a.applyAuthConfiguration(c1)
+	if err != nil {
+		return err
+	}
+	err = a.applyIdempotencyConfiguration(c1)
+	if err != nil {
+		return err
+	}
+	err = a.applyTenantConfiguration(c1)
+	if err != nil {
+		return err
+	}
+	err = a.applyTLSConfiguration(c1, unusable)
 	return err
 }
 
@@ -162,129 +315,222 @@ func (a *DXAPI) NewEndPoint(title, description, uri, method string, endPointType
 	return &ae
 }
 
+type fiberHeaderCarrier struct {
+	c *fiber.Ctx
+}
+
+func (fhc fiberHeaderCarrier) Get(key string) string {
+	return fhc.c.Get(key)
+}
+
+func (fhc fiberHeaderCarrier) Set(key string, value string) {
+	fhc.c.Request().Header.Set(key, value)
+}
+
+func (fhc fiberHeaderCarrier) Keys() []string {
+	keys := []string{}
+	fhc.c.Request().Header.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
+
+// endPointHandler builds the fiber handler of an end point, the response of a WS end point is only written on error, otherwise the connection is upgraded.
+func (a *DXAPI) endPointHandler(p DXAPIEndPoint) fiber.Handler {
+	isWS := p.EndPointType == EndPointTypeWS
+	return func(c *fiber.Ctx) error {
+		var err error
+		var aepr *DXAPIEndPointRequest
+		startTime := time.Now()
+		defer func() {
+			if err != nil {
+				if errors.Is(context.Cause(aepr.Context), ErrClientDisconnected) {
+					aepr.ResponseStatusCode = DXAPIStatusClientClosedRequest
+				}
+				if aepr.ResponseStatusCode == http.StatusOK {
+					aepr.ResponseStatusCode = http.StatusInternalServerError
+				}
+				aepr.Log.Errorf("Error at %s (%s) ", aepr.Id, err)
+				if aepr.ResponseBodyAsBytes == nil {
+					message := err.Error()
+					if aepr.ResponseStatusCode >= http.StatusInternalServerError {
+						message = `Internal error`
+					}
+					_ = aepr.WriteError(aepr.ResponseStatusCode, errorCodeOfStatus(aepr.ResponseStatusCode), message, nil)
+				}
+
+			} else {
+				if isWS {
+					return
+				}
+				if aepr.ResponseStatusCode < 300 {
+					x := &aepr.FiberContext.Response().Header
+					y := x.ContentType()
+					if y == nil {
+						x.Set(`Content-Type`, `application/octet; charset=utf-8`)
+					}
+				}
+			}
+			aepr.FiberContext.Response().SetStatusCode(aepr.ResponseStatusCode)
+			// the body of a stream, like WriteSSE or WriteCSV, is written after the handler returns, without a length
+			isBodyStream := err == nil && aepr.FiberContext.Response().IsBodyStream()
+			if !isBodyStream {
+				contentLengthBytes := len(aepr.ResponseBodyAsBytes)
+				contentLengthBytesAsString := strconv.FormatInt(int64(contentLengthBytes), 10)
+				aepr.FiberContext.Response().Header.Set(`Content-Length`, contentLengthBytesAsString)
+			}
+			if aepr.ResponseBodyAsBytes != nil && !isBodyStream {
+				errWrite := aepr.FiberContext.Send(aepr.ResponseBodyAsBytes)
+				if errWrite != nil {
+					aepr.Log.Errorf("DXAPIEndPoint/DXAPIEndPoint/aepr.FiiberContext.Send (%v), reply-data: %v", errWrite, aepr.FiberContext.Response().Body())
+					aepr.ResponseErrorAsString = errWrite.Error()
+				}
+			}
+			if !isWS {
+				metrics.Manager.ObserveAPIRequest(a.NameId, p.Method, p.Uri, aepr.ResponseStatusCode, time.Since(startTime).Seconds())
+			}
+		}()
+		requestContext := tracing.Extract(contextWithTx(contextWithTenantId(contextWithClaims(a.Context, c), c), c), fiberHeaderCarrier{c: c})
+		var cancels []context.CancelFunc
+		// the deadline of a Timeout middleware of the route
+		if deadline, ok := c.UserContext().Deadline(); ok {
+			var cancel context.CancelFunc
+			requestContext, cancel = context.WithDeadline(requestContext, deadline)
+			cancels = append(cancels, cancel)
+		}
+		if !isWS {
+			var cancel context.CancelFunc
+			requestContext, cancel = a.withClientDisconnect(requestContext, c)
+			cancels = append(cancels, cancel)
+		}
+		cancelRequest := func() {
+			for i := len(cancels) - 1; i >= 0; i-- {
+				cancels[i]()
+			}
+		}
+		defer func() {
+			// a stream written after the handler returns, like WriteSSE of aepr, took the cancel to run once it ends
+			if aepr == nil || aepr.cancelContext != nil {
+				cancelRequest()
+			}
+		}()
+		requestContext, span := otel.Tracer(a.Log.Prefix).Start(requestContext, "RequestHandler|"+p.Uri,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPRequestMethodKey.String(p.Method), semconv.HTTPRoute(p.Uri)))
+		defer func() {
+			span.SetAttributes(semconv.HTTPResponseStatusCode(aepr.ResponseStatusCode))
+			if aepr.ResponseStatusCode >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, aepr.ResponseErrorAsString)
+			}
+			span.End()
+		}()
+
+		aepr = p.NewEndPointRequest(requestContext, c)
+		aepr.cancelContext = cancelRequest
+		defer func() {
+			aepr.Log.Infof("%d %s %s", aepr.ResponseStatusCode, aepr.ResponseErrorAsString, aepr.FiberContext.OriginalURL())
+		}()
+
+		err = aepr.PreProcessRequest()
+		if err != nil {
+			aepr.Log.Errorf("Error at PreProcessRequest (%s) ", err)
+			aepr.ResponseStatusCode = 422
+			return nil
+		}
+
+		if p.OnExecute != nil {
+			err = p.OnExecute(aepr)
+			if err != nil {
+				aepr.Log.Errorf("Error at OnExecute (%s) ", err)
+				if aepr.ResponseStatusCode == 200 {
+					aepr.ResponseStatusCode = 500
+				}
+				return nil
+			}
+		}
+		if isWS {
+			c.Locals(`aepr`, aepr)
+			return c.Next()
+		}
+		return nil
+	}
+}
+
 func (a *DXAPI) StartAndWait(errorGroup *errgroup.Group) error {
 	if !a.RuntimeIsActive {
 		err := a.ApplyConfigurations()
 		if err != nil {
 			return err
 		}
+		// fasthttp has no separate header timeout, the read timeout covers the header and the body. A body over
+		// MaxBodyBytes is rejected with 413 and a header over MaxHeaderBytes with 431 before any handler runs.
 		a.HTTPServer = fiber.New(fiber.Config{
-			ReadTimeout:  time.Duration(a.ReadTimeoutSec) * time.Second,
-			WriteTimeout: time.Duration(a.WriteTimeoutSec) * time.Second,
+			ReadTimeout:    time.Duration(a.ReadTimeoutSec) * time.Second,
+			WriteTimeout:   time.Duration(a.WriteTimeoutSec) * time.Second,
+			IdleTimeout:    time.Duration(a.IdleTimeoutSec) * time.Second,
+			ReadBufferSize: a.MaxHeaderBytes,
+			BodyLimit:      a.MaxBodyBytes,
+			// the multipart bodies are parsed by ReadMultipartStream as they are read, not by fasthttp beforehand
+			StreamRequestBody:            a.IsStreamRequestBody,
+			DisablePreParseMultipartForm: a.IsStreamRequestBody,
 		})
-		var aepr *DXAPIEndPointRequest
+		a.HTTPServer.Server().ConnState = a.trackConnection
+		a.HTTPServer.Use(RecoverMiddleware())
+		if a.CORS != nil {
+			corsMiddleware, err := NewCORSMiddleware(*a.CORS)
+			if err != nil {
+				return err
+			}
+			a.HTTPServer.Use(corsMiddleware)
+		}
+		a.HTTPServer.Use(a.maintenanceMiddleware())
+		if a.MaxInFlightRequests > 0 {
+			a.HTTPServer.Use(a.loadSheddingMiddleware())
+		}
+		for _, m := range a.Middlewares {
+			a.HTTPServer.Use(m)
+		}
+		if metrics.Manager.IsEnabled && (metrics.Manager.Address == "") {
+			a.HTTPServer.Get(metrics.Manager.Path, adaptor.HTTPHandler(metrics.Manager.Handler()))
+		}
+		a.registerHealthRoute()
+		a.registerReadyRoute()
+		a.registerInfoRoute()
+		a.registerDebugRoutes()
+		// registered after the metrics and the debug routes, so they do not need a token
+		if a.Auth != nil {
+			authMiddleware, err := NewJWTAuthMiddleware(*a.Auth)
+			if err != nil {
+				return err
+			}
+			a.HTTPServer.Use(authMiddleware)
+		}
+		// after the auth, the tenant can be a claim of the token
+		if a.Tenant != nil {
+			a.HTTPServer.Use(NewTenantMiddleware(*a.Tenant))
+		}
+		// after the auth, its keys are scoped by the sub of the token
+		if a.Idempotency != nil {
+			idempotencyMiddleware, err := NewIdempotencyMiddleware(*a.Idempotency)
+			if err != nil {
+				return err
+			}
+			a.HTTPServer.Use(idempotencyMiddleware)
+		}
+		a.wsContext, a.wsCancel = context.WithCancel(a.Context)
+		a.registerWSRoutes()
 		for _, v := range a.EndPoints {
 			p := v
-			if p.EndPointType == EndPointTypeHTTP {
-				a.HTTPServer.Add(p.Method, p.Uri, func(c *fiber.Ctx) error {
-					var err error
-					defer func() {
-						if err != nil {
-							if aepr.ResponseStatusCode == http.StatusOK {
-								aepr.ResponseStatusCode = http.StatusInternalServerError
-							}
-							aepr.Log.Errorf("Error at %s (%s) ", aepr.Id, err)
-
-						} else {
-							if aepr.ResponseStatusCode < 300 {
-								x := aepr.FiberContext.Response().Header
-								y := x.ContentType()
-								if y == nil {
-									x.Set(`Content-Type`, `application/octet; charset=utf-8`)
-								}
-							}
-						}
-						contentLengthBytes := len(aepr.ResponseBodyAsBytes)
-						contentLengthBytesAsString := strconv.FormatInt(int64(contentLengthBytes), 10)
-						aepr.FiberContext.Response().Header.Set(`Content-Length`, contentLengthBytesAsString)
-						aepr.FiberContext.Response().SetStatusCode(aepr.ResponseStatusCode)
-
-						if aepr.ResponseBodyAsBytes != nil {
-							errWrite := aepr.FiberContext.Send(aepr.ResponseBodyAsBytes)
-							if errWrite != nil {
-								aepr.Log.Errorf("DXAPIEndPoint/DXAPIEndPoint/aepr.FiiberContext.Send (%v), reply-data: %v", errWrite, aepr.FiberContext.Response().Body())
-								aepr.ResponseErrorAsString = errWrite.Error()
-							}
-						}
-					}()
-					requestContext, span := otel.Tracer(a.Log.Prefix).Start(a.Context, "RequestHandler|"+p.Uri)
-					defer span.End()
-
-					aepr = p.NewEndPointRequest(requestContext, c)
-					defer func() {
-						aepr.Log.Infof("%d %s %s", aepr.ResponseStatusCode, aepr.ResponseErrorAsString, aepr.FiberContext.OriginalURL())
-					}()
-
-					err = aepr.PreProcessRequest()
-					if err != nil {
-						aepr.Log.Errorf("Error at PreProcessRequest (%s) ", err)
-						aepr.ResponseStatusCode = 422
-						return nil
-					}
-
-					if p.OnExecute != nil {
-						err = p.OnExecute(aepr)
-						if err != nil {
-							aepr.Log.Errorf("Error at OnExecute (%s) ", err)
-							if aepr.ResponseStatusCode == 200 {
-								aepr.ResponseStatusCode = 500
-							}
-							return nil
-						}
-					}
-					return nil
-				})
-			}
-			if p.EndPointType == EndPointTypeWS {
-				a.HTTPServer.Add(p.Method, p.Uri, func(c *fiber.Ctx) error {
-					var err error
-					defer func() {
-						if err != nil {
-							if aepr.ResponseStatusCode == http.StatusOK {
-								aepr.ResponseStatusCode = http.StatusInternalServerError
-							}
-							aepr.Log.Errorf("Error at %s (%s) ", aepr.Id, err)
-							contentLengthBytes := len(aepr.ResponseBodyAsBytes)
-							contentLengthBytesAsString := strconv.FormatInt(int64(contentLengthBytes), 10)
-							aepr.FiberContext.Response().Header.Set(`Content-Length`, contentLengthBytesAsString)
-							aepr.FiberContext.Response().SetStatusCode(aepr.ResponseStatusCode)
-
-							if aepr.ResponseBodyAsBytes != nil {
-								errWrite := aepr.FiberContext.Send(aepr.ResponseBodyAsBytes)
-								if errWrite != nil {
-									aepr.Log.Errorf("DXAPIEndPoint/DXAPIEndPoint/aepr.FiiberContext.Send (%v), reply-data: %v", errWrite, aepr.FiberContext.Response().Body())
-									aepr.ResponseErrorAsString = errWrite.Error()
-								}
-							}
-						}
-					}()
-					requestContext, span := otel.Tracer(a.Log.Prefix).Start(a.Context, "RequestHandler|"+p.Uri)
-					defer span.End()
-
-					aepr = p.NewEndPointRequest(requestContext, c)
-					defer func() {
-						aepr.Log.Infof("%d %s %s", aepr.ResponseStatusCode, aepr.ResponseErrorAsString, aepr.FiberContext.OriginalURL())
-					}()
-
-					err = aepr.PreProcessRequest()
-					if err != nil {
-						aepr.Log.Errorf("Error at PreProcessRequest (%s) ", err)
-						aepr.ResponseStatusCode = 422
-						return nil
+			handlers := append(append([]fiber.Handler{}, p.Middlewares...), a.endPointHandler(p))
+			switch p.EndPointType {
+			case EndPointTypeHTTP:
+				a.HTTPServer.Add(p.Method, p.Uri, handlers...)
+			case EndPointTypeWS:
+				a.HTTPServer.Add(p.Method, p.Uri, append(handlers, websocket.New(func(c *websocket.Conn) {
+					aepr, ok := c.Locals(`aepr`).(*DXAPIEndPointRequest)
+					if !ok {
+						return
 					}
-
-					if p.OnExecute != nil {
-						err = p.OnExecute(aepr)
-						if err != nil {
-							aepr.Log.Errorf("Error at OnExecute (%s) ", err)
-							if aepr.ResponseStatusCode == 200 {
-								aepr.ResponseStatusCode = 500
-							}
-							return nil
-						}
-					}
-					return c.Next()
-				}, websocket.New(func(c *websocket.Conn) {
 					if p.OnWSLoop != nil {
 						aepr.WSConnection = c
 						err := p.OnWSLoop(aepr)
@@ -293,9 +539,8 @@ func (a *DXAPI) StartAndWait(errorGroup *errgroup.Group) error {
 						}
 					}
 
-				}))
+				}))...)
 			}
-
 		}
 
 		/*a.RuntimeServer = &http.Server{
@@ -308,23 +553,92 @@ func (a *DXAPI) StartAndWait(errorGroup *errgroup.Group) error {
 			},
 		}*/
 	}
-	errorGroup.Go(func() error {
-		a.RuntimeIsActive = true
-		log.Log.Infof("Listening at %s... start", a.Address)
-		//err := a.RuntimeServer.ListenAndServe()
-		err := a.HTTPServer.Listen(a.Address)
-		a.RuntimeIsActive = false
-		log.Log.Infof("Listening at %s... stopped (%v)", a.Address, err)
-		return err
-	})
+	if a.TLS != nil {
+		cert, err := LoadCertificate(a.TLS.CertFile, a.TLS.KeyFile)
+		if err != nil {
+			log.Log.Errorf("Cannot load the certificate %s (%v)", a.TLS.CertFile, err)
+			return err
+		}
+		a.certificate.Store(cert)
+	}
+	a.Listener = nil
+	a.Listeners = nil
+	a.listenerSpecs = a.Listens
+	if a.Address != `` {
+		a.listenerSpecs = append([]DXAPIListenSpec{{Address: a.Address}}, a.Listens...)
+	}
+	for _, v := range a.listenerSpecs {
+		listener, err := a.listenSpec(v)
+		if err != nil {
+			log.Log.Errorf("Cannot listen at %s (%v)", v, err)
+			for _, x := range a.Listeners {
+				_ = x.Close()
+			}
+			a.Listener = nil
+			a.Listeners = nil
+			return err
+		}
+		a.Listeners = append(a.Listeners, listener)
+	}
+	if a.Address != `` {
+		a.Listener = a.Listeners[0]
+	}
+	a.RuntimeIsActive = true
+	a.activeListeners.Store(int32(len(a.Listeners)))
+	// the routes are built before any listener is served, the first one is served by fiber, running its startup
+	// message and OnListen hooks once, the others by its server
+	_ = a.HTTPServer.Handler()
+	for i, v := range a.Listeners {
+		listener := v
+		spec := a.listenerSpecs[i]
+		if a.TLS != nil {
+			// the raw listener stays in Listeners, it is the one handed over on a graceful restart
+			listener = a.tlsListener(v)
+		}
+		serve := a.HTTPServer.Server().Serve
+		if i == 0 {
+			serve = a.HTTPServer.Listener
+		}
+		errorGroup.Go(func() error {
+			log.Log.Infof("Listening at %s... start", spec)
+			err := serve(listener)
+			if a.activeListeners.Add(-1) == 0 {
+				a.RuntimeIsActive = false
+			}
+			log.Log.Infof("Listening at %s... stopped (%v)", spec, err)
+			return err
+		})
+	}
+	a.watchCertificateFiles()
 
 	return nil
 }
 
+// StartShutdown refuses new connections and waits for the in-flight requests up to Manager.ShutdownTimeout, the
+// connections still open after it are closed, failing the requests they are in.
 func (a *DXAPI) StartShutdown() (err error) {
 	if a.RuntimeIsActive {
 		log.Log.Infof("Shutdown api %s start...", a.NameId)
-		err = a.HTTPServer.ShutdownWithContext(core.RootContext)
+		if a.wsCancel != nil {
+			a.wsCancel()
+		}
+		shutdownTimeout := Manager.ShutdownTimeout
+		if shutdownTimeout <= 0 {
+			shutdownTimeout = DXAPIDefaultShutdownTimeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		err = a.HTTPServer.ShutdownWithContext(ctx)
+		// the listeners not served yet are not closed by the server, closing a unix socket removes its file
+		for _, v := range a.Listeners {
+			_ = v.Close()
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			n := a.closeConnections()
+			log.Log.Warnf("Shutdown api %s deadline %v elapsed, force closed %d connection(s)", a.NameId, shutdownTimeout, n)
+			return nil
+		}
+		log.Log.Infof("Shutdown api %s done (%v)", a.NameId, err)
 		return err
 	}
 	return nil
@@ -335,8 +649,9 @@ var Manager DXAPIManager
 func init() {
 	ctx, cancel := context.WithCancel(core.RootContext)
 	Manager = DXAPIManager{
-		Context: ctx,
-		Cancel:  cancel,
-		APIs:    map[string]*DXAPI{},
+		Context:         ctx,
+		Cancel:          cancel,
+		APIs:            map[string]*DXAPI{},
+		ShutdownTimeout: DXAPIDefaultShutdownTimeout,
 	}
 }
@@ -2,10 +2,12 @@ package api
 
 import (
 	"context"
+	"dxlib/v3/databases"
 	"dxlib/v3/log"
 	utilsHttp "dxlib/v3/utils/http"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/trace"
 	"net/http"
 	"sort"
 )
@@ -17,6 +19,10 @@ const (
 	EndPointTypeWS
 )
 
+// DXAPIRequestIdHeader gives the id of a request, taken from the client or the proxy when given, sent back in the
+// response and logged with the queries of the request.
+const DXAPIRequestIdHeader = `X-Request-Id`
+
 type DXAPIEndPointParameter struct {
 	Owner       *DXAPIEndPoint
 	Parent      *DXAPIEndPointParameter
@@ -69,6 +75,8 @@ type DXAPIEndPoint struct {
 	OnExecute             DXAPIEndPointExecuteFunc
 	OnWSLoop              DXAPIEndPointExecuteFunc
 	ResponsePossibilities map[string]*DxAPIEndPointResponsePossibility
+	// Middlewares run in order after the ones of the API and before OnExecute, see UseOnEndPoint
+	Middlewares []fiber.Handler
 }
 
 func (aep *DXAPIEndPoint) PrintSpec() (s string) {
@@ -136,7 +144,17 @@ func (aep *DXAPIEndPoint) NewEndPointRequest(context context.Context, c *fiber.C
 		ResponseErrorAsString: "",
 		ResponseBodyAsBytes:   nil,
 	}
-	er.Id = fmt.Sprintf("%p", er)
-	er.Log = log.NewLog(&aep.Owner.Log, context, aep.Title+" | "+er.Id)
+	er.Id = c.Get(DXAPIRequestIdHeader)
+	if er.Id == `` {
+		er.Id = fmt.Sprintf("%p", er)
+	}
+	c.Set(DXAPIRequestIdHeader, er.Id)
+	traceId := ``
+	if spanContext := trace.SpanContextFromContext(context); spanContext.HasTraceID() {
+		traceId = spanContext.TraceID().String()
+	}
+	er.Context = log.ContextWithCorrelation(context, er.Id, traceId)
+	er.Context = databases.ContextWithRoute(er.Context, aep.Uri)
+	er.Log = log.NewLog(&aep.Owner.Log, er.Context, aep.Title+" | "+er.Id)
 	return er
 }
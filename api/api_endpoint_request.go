@@ -50,6 +50,8 @@ type DXAPIEndPointRequest struct {
 	ResponseBodyAsBytes   []byte
 	ErrorMessage          []string
 	CurrentUser           DXAPIUser
+	// cancelContext ends Context, when the handler returns unless a stream takes it, see takeContextCancel
+	cancelContext context.CancelFunc
 }
 
 func (aeprpv *DXAPIEndPointRequestParameterValue) NewChild(aepp DXAPIEndPointParameter) *DXAPIEndPointRequestParameterValue {
@@ -201,7 +203,7 @@ func (aepr *DXAPIEndPointRequest) ResponseSetFromJSON(v utils.JSON) (err error)
 	if v == nil {
 		return nil
 	}
-	vAsBytes, err := json.Marshal(v)
+	vAsBytes, err := jsonCodec().Marshal(v)
 	if err != nil {
 		return err
 	}
@@ -468,6 +470,8 @@ func (aepr *DXAPIEndPointRequest) PreProcessRequest() (err error) {
 			err = aepr.preProcessRequestAsRaw()
 		case utilsHttp.ContentTypeApplicationJSON:
 			err = aepr.preProcessRequestAsApplicationJSON()
+		case utilsHttp.ContentTypeMultiPartFormData:
+			// the body is left unread for ReadMultipartStream
 		default:
 			err = aepr.Log.WarnAndCreateErrorf(`Request content-type is not supported yet (%v)`, aepr.EndPoint.RequestContentType)
 			aepr.ResponseStatusCode = http.StatusUnprocessableEntity
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+
+	"dxlib/v3/configurations"
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+	utilsHttp "dxlib/v3/utils/http"
+)
+
+// startTestAPI serves the API nameId on a free port of 127.0.0.1 with the configuration c, the end points are added
+// by define. The API is shut down at the end of the test.
+func startTestAPI(t *testing.T, nameId string, c utils.JSON, define func(a *DXAPI)) (a *DXAPI, baseURL string) {
+	t.Helper()
+	data := utils.JSON{}
+	configuration, ok := configurations.Manager.Get(`api`)
+	if ok && configuration.Data != nil {
+		for k, v := range *configuration.Data {
+			data[k] = v
+		}
+	}
+	if c == nil {
+		c = utils.JSON{}
+	}
+	if _, ok := c[`address`]; !ok {
+		c[`address`] = `127.0.0.1:0`
+	}
+	data[nameId] = c
+	configurations.Manager.NewConfiguration(`api`, ``, `json`, false, false, data, nil)
+	a, err := Manager.NewAPI(nameId)
+	require.NoError(t, err)
+	if define != nil {
+		define(a)
+	}
+	g, _ := errgroup.WithContext(context.Background())
+	require.NoError(t, a.StartAndWait(g))
+	t.Cleanup(func() {
+		_ = a.StartShutdown()
+		delete(Manager.APIs, nameId)
+	})
+	return a, `http://` + a.Listener.Addr().String()
+}
+
+// newTestEndPoint adds the GET end point uri run by onExecute.
+func newTestEndPoint(a *DXAPI, uri string, onExecute DXAPIEndPointExecuteFunc) {
+	a.NewEndPoint(uri, ``, uri, http.MethodGet, EndPointTypeHTTP, utilsHttp.ContentTypeNone, nil, onExecute, nil, nil)
+}
+
+// testLogBuffer is a buffer the log sinks write to while the test reads it.
+type testLogBuffer struct {
+	mutex sync.Mutex
+	b     bytes.Buffer
+}
+
+func (b *testLogBuffer) Write(p []byte) (n int, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *testLogBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.b.String()
+}
+
+// captureTestLog gives the warnings and errors logged until the end of the test.
+func captureTestLog(t *testing.T) *testLogBuffer {
+	t.Helper()
+	b := &testLogBuffer{}
+	log.SetSinks(log.NewSink(`test`, log.DXLogFormatText, log.DXLogLevelWarn, b))
+	t.Cleanup(func() {
+		log.SetSinks()
+	})
+	return b
+}
@@ -0,0 +1,322 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/sync/singleflight"
+
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+	utilsJSON "dxlib/v3/utils/json"
+)
+
+const (
+	DXAPIAuthDefaultJWKSRefreshIntervalSec = 300
+	DXAPIAuthJWKSMinRefreshInterval        = 10 * time.Second
+	DXAPIAuthJWKSFetchTimeout              = 10 * time.Second
+)
+
+type claimsContextKey struct{}
+
+const claimsLocalsKey = `api_claims`
+
+type DXAPIAuthConfiguration struct {
+	// SigningKey is the HMAC secret
+	SigningKey string
+	// PublicKey is a PEM encoded RSA or ECDSA public key
+	PublicKey              string
+	JWKSURL                string
+	JWKSRefreshIntervalSec int
+	Issuer                 string
+	Audience               string
+	// ExcludePaths are the request paths, or path prefixes ending with "*", served without a token
+	ExcludePaths []string
+}
+
+// AuthConfigurationFromJSON reads the "auth" block of an api configuration, exactly one of signing_key, public_key or
+// jwks_url must be set.
+func AuthConfigurationFromJSON(c utils.JSON) (r *DXAPIAuthConfiguration, err error) {
+	r = &DXAPIAuthConfiguration{}
+	r.SigningKey, _ = c[`signing_key`].(string)
+	r.PublicKey, _ = c[`public_key`].(string)
+	r.JWKSURL, _ = c[`jwks_url`].(string)
+	r.JWKSRefreshIntervalSec = utilsJSON.GetNumberWithDefault(c, `jwks_refresh_interval_sec`, DXAPIAuthDefaultJWKSRefreshIntervalSec)
+	r.Issuer, _ = c[`issuer`].(string)
+	r.Audience, _ = c[`audience`].(string)
+	r.ExcludePaths, _ = utilsJSON.GetStrings(c, `exclude_paths`)
+	return r, nil
+}
+
+// ClaimsFromContext returns the claims of the verified token of the request, ctx is DXAPIEndPointRequest.Context.
+func ClaimsFromContext(ctx context.Context) (claims utils.JSON, ok bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	claims, ok = ctx.Value(claimsContextKey{}).(utils.JSON)
+	return claims, ok
+}
+
+func contextWithClaims(ctx context.Context, c *fiber.Ctx) context.Context {
+	claims, ok := c.Locals(claimsLocalsKey).(utils.JSON)
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+type jwtKeyFunc func(token *jwt.Token) (key any, err error)
+
+// NewJWTAuthMiddleware verifies the Bearer token of every request not in ExcludePaths, the signature, exp, nbf and, when
+// configured, iss and aud are checked. A request failing the verification is answered with 401 and a JSON error body.
+func NewJWTAuthMiddleware(c DXAPIAuthConfiguration) (h fiber.Handler, err error) {
+	var keyFunc jwtKeyFunc
+	var validMethods []string
+	switch {
+	case c.SigningKey != `` && c.PublicKey == `` && c.JWKSURL == ``:
+		key := []byte(c.SigningKey)
+		keyFunc = func(token *jwt.Token) (any, error) {
+			return key, nil
+		}
+		validMethods = []string{`HS256`, `HS384`, `HS512`}
+	case c.PublicKey != `` && c.SigningKey == `` && c.JWKSURL == ``:
+		var key crypto.PublicKey
+		key, err = jwt.ParseRSAPublicKeyFromPEM([]byte(c.PublicKey))
+		if err == nil {
+			validMethods = []string{`RS256`, `RS384`, `RS512`, `PS256`, `PS384`, `PS512`}
+		} else {
+			key, err = jwt.ParseECPublicKeyFromPEM([]byte(c.PublicKey))
+			if err != nil {
+				err = log.Log.ErrorAndCreateErrorf("Auth public_key is not a PEM encoded RSA or ECDSA public key (%v)", err)
+				return nil, err
+			}
+			validMethods = []string{`ES256`, `ES384`, `ES512`}
+		}
+		keyFunc = func(token *jwt.Token) (any, error) {
+			return key, nil
+		}
+	case c.JWKSURL != `` && c.SigningKey == `` && c.PublicKey == ``:
+		refreshInterval := time.Duration(c.JWKSRefreshIntervalSec) * time.Second
+		if refreshInterval <= 0 {
+			refreshInterval = DXAPIAuthDefaultJWKSRefreshIntervalSec * time.Second
+		}
+		keyFunc = newJWKS(c.JWKSURL, refreshInterval).keyFunc
+		validMethods = []string{`RS256`, `RS384`, `RS512`, `PS256`, `PS384`, `PS512`, `ES256`, `ES384`, `ES512`}
+	default:
+		err = log.Log.ErrorAndCreateErrorf("Auth needs exactly one of signing_key, public_key or jwks_url")
+		return nil, err
+	}
+	parser := jwt.NewParser(jwt.WithValidMethods(validMethods))
+
+	h = func(ctx *fiber.Ctx) error {
+		if isPathMatched(ctx.Path(), c.ExcludePaths) {
+			return ctx.Next()
+		}
+		authorization := ctx.Get(fiber.HeaderAuthorization)
+		tokenAsString, ok := strings.CutPrefix(authorization, `Bearer `)
+		if !ok || tokenAsString == `` {
+			return responseUnauthorized(ctx, `MISSING_TOKEN`)
+		}
+		claims := jwt.MapClaims{}
+		_, err := parser.ParseWithClaims(tokenAsString, &claims, jwt.Keyfunc(keyFunc))
+		if err != nil {
+			log.Log.Warnf("Invalid token at %s (%v)", ctx.Path(), err)
+			if validationError, ok := err.(*jwt.ValidationError); ok && (validationError.Errors&jwt.ValidationErrorExpired != 0) {
+				return responseUnauthorized(ctx, `TOKEN_EXPIRED`)
+			}
+			return responseUnauthorized(ctx, `INVALID_TOKEN`)
+		}
+		if c.Issuer != `` && !claims.VerifyIssuer(c.Issuer, true) {
+			return responseUnauthorized(ctx, `INVALID_ISSUER`)
+		}
+		if c.Audience != `` && !claims.VerifyAudience(c.Audience, true) {
+			return responseUnauthorized(ctx, `INVALID_AUDIENCE`)
+		}
+		ctx.Locals(claimsLocalsKey, utils.JSON(claims))
+		return ctx.Next()
+	}
+	return h, nil
+}
+
+func isPathMatched(path string, paths []string) bool {
+	for _, p := range paths {
+		prefix, isPrefix := strings.CutSuffix(p, `*`)
+		if (isPrefix && strings.HasPrefix(path, prefix)) || path == p {
+			return true
+		}
+	}
+	return false
+}
+
+func responseUnauthorized(ctx *fiber.Ctx, reasonCode string) error {
+	ctx.Set(fiber.HeaderWWWAuthenticate, `Bearer`)
+	return WriteError(ctx, http.StatusUnauthorized, reasonCode, `Unauthorized`, nil)
+}
+
+// jwks caches the keys of a JWKS URL by kid, they are fetched again once older than refreshInterval or when a token
+// has an unknown kid, but not more often than DXAPIAuthJWKSMinRefreshInterval. The fetch is outside of any lock: the
+// tokens of a known kid are checked with the cached keys meanwhile, those of an unknown kid wait for the one fetch
+// shared by all of them.
+type jwks struct {
+	url             string
+	refreshInterval time.Duration
+	current         atomic.Pointer[jwksKeys]
+	refreshGroup    singleflight.Group
+}
+
+// jwksKeys are the keys of one fetch, replaced as a whole by the next one.
+type jwksKeys struct {
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+func newJWKS(url string, refreshInterval time.Duration) *jwks {
+	k := &jwks{
+		url:             url,
+		refreshInterval: refreshInterval,
+	}
+	k.current.Store(&jwksKeys{keys: map[string]crypto.PublicKey{}})
+	return k
+}
+
+func (k *jwks) keyFunc(token *jwt.Token) (key any, err error) {
+	kid, _ := token.Header[`kid`].(string)
+	current := k.current.Load()
+	key, ok := current.keys[kid]
+	age := time.Since(current.fetchedAt)
+	switch {
+	case ok && age > k.refreshInterval:
+		// the stale key is used while the keys are fetched again
+		k.refreshGroup.DoChan(`refresh`, k.refresh)
+	case !ok && age > DXAPIAuthJWKSMinRefreshInterval:
+		_, err, _ = k.refreshGroup.Do(`refresh`, k.refresh)
+		if err != nil {
+			log.Log.Warnf("Cannot refresh JWKS %s (%v)", k.url, err)
+		} else {
+			key, ok = k.current.Load().keys[kid]
+		}
+	}
+	if !ok {
+		err = log.Log.WarnAndCreateErrorf("Key %s is not in JWKS %s", kid, k.url)
+		return nil, err
+	}
+	return key, nil
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// refresh fetches the keys and swaps them in, the keys of an unsupported type are skipped. It is run by refreshGroup,
+// one at a time.
+func (k *jwks) refresh() (r any, err error) {
+	client := http.Client{Timeout: DXAPIAuthJWKSFetchTimeout}
+	response, err := client.Get(k.url)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	if response.StatusCode != http.StatusOK {
+		err = log.Log.WarnAndCreateErrorf("JWKS %s responded %d", k.url, response.StatusCode)
+		return nil, err
+	}
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	err = json.NewDecoder(response.Body).Decode(&set)
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, v := range set.Keys {
+		if v.Use != `` && v.Use != `sig` {
+			continue
+		}
+		key, err := v.publicKey()
+		if err != nil {
+			log.Log.Warnf("Skipping key %s of JWKS %s (%v)", v.Kid, k.url, err)
+			continue
+		}
+		keys[v.Kid] = key
+	}
+	k.current.Store(&jwksKeys{keys: keys, fetchedAt: time.Now()})
+	return nil, nil
+}
+
+func (v jwk) publicKey() (key crypto.PublicKey, err error) {
+	switch v.Kty {
+	case `RSA`:
+		n, err := decodeJWKBigInt(v.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeJWKBigInt(v.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case `EC`:
+		var curve elliptic.Curve
+		switch v.Crv {
+		case `P-256`:
+			curve = elliptic.P256()
+		case `P-384`:
+			curve = elliptic.P384()
+		case `P-521`:
+			curve = elliptic.P521()
+		default:
+			err = log.Log.WarnAndCreateErrorf("Unsupported curve %s", v.Crv)
+			return nil, err
+		}
+		x, err := decodeJWKBigInt(v.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeJWKBigInt(v.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		err = log.Log.WarnAndCreateErrorf("Unsupported key type %s", v.Kty)
+		return nil, err
+	}
+}
+
+func decodeJWKBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (a *DXAPI) applyAuthConfiguration(c1 utils.JSON) (err error) {
+	c, ok := c1[`auth`].(utils.JSON)
+	if !ok {
+		return nil
+	}
+	a.Auth, err = AuthConfigurationFromJSON(c)
+	return err
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/utils"
+)
+
+func TestJWKSServesCachedKeysWhileFetching(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	set := map[string]any{`keys`: []jwk{{
+		Kid: `k1`,
+		Kty: `RSA`,
+		N:   base64.RawURLEncoding.EncodeToString(privateKey.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(privateKey.E)).Bytes()),
+	}}}
+	isSlow := atomic.Bool{}
+	release := make(chan struct{})
+	fetches := atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if isSlow.Load() {
+			<-release
+		}
+		_ = json.NewEncoder(w).Encode(set)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	k := newJWKS(server.URL, time.Hour)
+	token := &jwt.Token{Header: map[string]any{`kid`: `k1`}}
+	key, err := k.keyFunc(token)
+	require.NoError(t, err)
+	assert.Equal(t, privateKey.N, key.(*rsa.PublicKey).N)
+
+	// the keys are stale and the identity provider hangs, the validations go on with the cached key
+	isSlow.Store(true)
+	k.current.Store(&jwksKeys{keys: k.current.Load().keys, fetchedAt: time.Now().Add(-2 * time.Hour)})
+	for i := 0; i < 10; i++ {
+		startTime := time.Now()
+		key, err = k.keyFunc(token)
+		require.NoError(t, err)
+		assert.NotNil(t, key)
+		assert.Less(t, time.Since(startTime), 100*time.Millisecond)
+	}
+	assert.Eventually(t, func() bool { return fetches.Load() == 2 }, time.Second, 10*time.Millisecond,
+		"one background fetch for all the validations")
+}
+
+// testPublicKeyPEM is the PEM encoding of key.
+func testPublicKeyPEM(t *testing.T, key crypto.PublicKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: `PUBLIC KEY`, Bytes: der}))
+}
+
+// getTestWithToken sends GET url with the Bearer token, giving the status and the body of the response.
+func getTestWithToken(t *testing.T, url string, token string) (statusCode int, body string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	if token != `` {
+		req.Header.Set(`Authorization`, `Bearer `+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(b)
+}
+
+func TestJWTAuthMiddleware(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	for _, tt := range []struct {
+		name          string
+		configuration utils.JSON
+		method        jwt.SigningMethod
+		signingKey    any
+	}{
+		{`hmac`, utils.JSON{`signing_key`: `secret`}, jwt.SigningMethodHS256, []byte(`secret`)},
+		{`rsa`, utils.JSON{`public_key`: testPublicKeyPEM(t, &rsaKey.PublicKey)}, jwt.SigningMethodRS256, rsaKey},
+		{`ecdsa`, utils.JSON{`public_key`: testPublicKeyPEM(t, &ecdsaKey.PublicKey)}, jwt.SigningMethodES256, ecdsaKey},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.configuration[`issuer`] = `https://issuer.example.com`
+			tt.configuration[`audience`] = `api`
+			_, baseURL := startTestAPI(t, `test_auth_`+tt.name, utils.JSON{`auth`: tt.configuration}, func(a *DXAPI) {
+				newTestEndPoint(a, `/me`, func(aepr *DXAPIEndPointRequest) (err error) {
+					claims, ok := ClaimsFromContext(aepr.Context)
+					assert.True(t, ok)
+					sub, _ := claims[`sub`].(string)
+					aepr.ResponseStatusCode = http.StatusOK
+					aepr.ResponseBodyAsBytes = []byte(sub)
+					return nil
+				})
+			})
+			sign := func(claims jwt.MapClaims) string {
+				token, err := jwt.NewWithClaims(tt.method, claims).SignedString(tt.signingKey)
+				require.NoError(t, err)
+				return token
+			}
+			claims := func(issuer string, audience string, expiresAt time.Time) jwt.MapClaims {
+				return jwt.MapClaims{`sub`: `user-1`, `iss`: issuer, `aud`: audience, `exp`: expiresAt.Unix()}
+			}
+
+			statusCode, body := getTestWithToken(t, baseURL+`/me`, sign(claims(`https://issuer.example.com`, `api`, time.Now().Add(time.Hour))))
+			assert.Equal(t, http.StatusOK, statusCode)
+			assert.Equal(t, `user-1`, body)
+
+			for _, v := range []struct {
+				token      string
+				reasonCode string
+			}{
+				{sign(claims(`https://issuer.example.com`, `api`, time.Now().Add(-time.Minute))), `TOKEN_EXPIRED`},
+				{sign(claims(`https://other.example.com`, `api`, time.Now().Add(time.Hour))), `INVALID_ISSUER`},
+				{sign(claims(`https://issuer.example.com`, `other`, time.Now().Add(time.Hour))), `INVALID_AUDIENCE`},
+				{sign(claims(`https://issuer.example.com`, `api`, time.Now().Add(time.Hour))) + `x`, `INVALID_TOKEN`},
+				{``, `MISSING_TOKEN`},
+			} {
+				statusCode, body = getTestWithToken(t, baseURL+`/me`, v.token)
+				assert.Equal(t, http.StatusUnauthorized, statusCode, v.reasonCode)
+				assert.JSONEq(t, `{"error":{"code":"`+v.reasonCode+`","message":"Unauthorized"}}`, body)
+			}
+		})
+	}
+}
+
+func TestJWTAuthMiddlewareRejectsAnotherAlgorithm(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	publicKeyPEM := testPublicKeyPEM(t, &rsaKey.PublicKey)
+	_, baseURL := startTestAPI(t, `test_auth_algorithm`, utils.JSON{`auth`: utils.JSON{`public_key`: publicKeyPEM}}, func(a *DXAPI) {
+		newTestWhoEndPoint(a, `auth`)
+	})
+	// the public key used as an HMAC secret
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{`sub`: `user-1`}).SignedString([]byte(publicKeyPEM))
+	require.NoError(t, err)
+	statusCode, body := getTestWithToken(t, baseURL+`/who`, token)
+	assert.Equal(t, http.StatusUnauthorized, statusCode)
+	assert.Contains(t, body, `INVALID_TOKEN`)
+}
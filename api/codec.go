@@ -0,0 +1,152 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"dxlib/v3/configurations"
+	"dxlib/v3/utils"
+)
+
+// maxSafeInteger is the largest integer a JavaScript number holds exactly, 2^53 - 1.
+const maxSafeInteger = `9007199254740991`
+
+// DXAPIJSONCodec encodes the responses and decodes the request bodies of WriteJSON, WriteError and DecodeAndValidate.
+// NewDXAPIJSONCodec gives the one of encoding/json, another encoder, like jsoniter or segmentio, can be set as
+// Manager.JSONCodec behind the same interface.
+type DXAPIJSONCodec interface {
+	Marshal(v any) ([]byte, error)
+	NewDecoder(r io.Reader) DXAPIJSONDecoder
+}
+
+type DXAPIJSONDecoder interface {
+	Decode(v any) error
+	DisallowUnknownFields()
+}
+
+// DXAPIJSONOptions are the options of NewDXAPIJSONCodec, their zero values are the defaults of encoding/json.
+// IsNumberUsed decodes the numbers into an any as json.Number and IsLargeIntAsString writes the integers beyond
+// ±(2^53 - 1), which a JavaScript number cannot hold exactly, as strings.
+type DXAPIJSONOptions struct {
+	IsHTMLEscapeDisabled bool
+	IsNumberUsed         bool
+	IsLargeIntAsString   bool
+}
+
+type dxAPIJSONCodec struct {
+	options DXAPIJSONOptions
+}
+
+func NewDXAPIJSONCodec(o DXAPIJSONOptions) DXAPIJSONCodec {
+	return dxAPIJSONCodec{options: o}
+}
+
+func (c dxAPIJSONCodec) Marshal(v any) (b []byte, err error) {
+	buffer := &bytes.Buffer{}
+	e := json.NewEncoder(buffer)
+	e.SetEscapeHTML(!c.options.IsHTMLEscapeDisabled)
+	err = e.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	b = bytes.TrimSuffix(buffer.Bytes(), []byte("\n"))
+	if c.options.IsLargeIntAsString {
+		b = quoteLargeIntegers(b)
+	}
+	return b, nil
+}
+
+func (c dxAPIJSONCodec) NewDecoder(r io.Reader) DXAPIJSONDecoder {
+	d := json.NewDecoder(r)
+	if c.options.IsNumberUsed {
+		d.UseNumber()
+	}
+	return d
+}
+
+// quoteLargeIntegers quotes the integers of the JSON text b beyond maxSafeInteger, the numbers in the strings and the
+// fractional numbers are left as they are.
+func quoteLargeIntegers(b []byte) []byte {
+	r := make([]byte, 0, len(b))
+	isInString := false
+	for i := 0; i < len(b); i++ {
+		ch := b[i]
+		if isInString {
+			r = append(r, ch)
+			if ch == '\\' && i+1 < len(b) {
+				i++
+				r = append(r, b[i])
+			} else if ch == '"' {
+				isInString = false
+			}
+			continue
+		}
+		if ch == '"' {
+			isInString = true
+			r = append(r, ch)
+			continue
+		}
+		if ch != '-' && (ch < '0' || ch > '9') {
+			r = append(r, ch)
+			continue
+		}
+		j := i
+		for j < len(b) && bytes.IndexByte([]byte(`+-.0123456789eE`), b[j]) >= 0 {
+			j++
+		}
+		number := b[i:j]
+		if isLargeInteger(number) {
+			r = append(r, '"')
+			r = append(r, number...)
+			r = append(r, '"')
+		} else {
+			r = append(r, number...)
+		}
+		i = j - 1
+	}
+	return r
+}
+
+func isLargeInteger(number []byte) bool {
+	digits := bytes.TrimPrefix(number, []byte(`-`))
+	if len(digits) == 0 || bytes.IndexAny(digits, `.eE+-`) >= 0 {
+		return false
+	}
+	if len(digits) != len(maxSafeInteger) {
+		return len(digits) > len(maxSafeInteger)
+	}
+	return string(digits) > maxSafeInteger
+}
+
+// jsonCodec is Manager.JSONCodec, or else the encoding/json defaults.
+func jsonCodec() DXAPIJSONCodec {
+	if Manager.JSONCodec == nil {
+		return NewDXAPIJSONCodec(DXAPIJSONOptions{})
+	}
+	return Manager.JSONCodec
+}
+
+// applyJSONConfiguration sets Manager.JSONCodec from json of the api configuration, like
+//
+//	{"json": {"is_html_escape_disabled": true, "is_number_used": true, "is_large_int_as_string": true}}
+//
+// unless the app has set its own codec.
+func (am *DXAPIManager) applyJSONConfiguration() {
+	if am.JSONCodec != nil {
+		return
+	}
+	configuration, ok := configurations.Manager.Get("api")
+	if !ok {
+		return
+	}
+	c, ok := (*configuration.Data)[`json`].(utils.JSON)
+	if !ok {
+		return
+	}
+	o := DXAPIJSONOptions{}
+	o.IsHTMLEscapeDisabled, _ = c[`is_html_escape_disabled`].(bool)
+	o.IsNumberUsed, _ = c[`is_number_used`].(bool)
+	o.IsLargeIntAsString, _ = c[`is_large_int_as_string`].(bool)
+	am.JSONCodec = NewDXAPIJSONCodec(o)
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/utils"
+)
+
+// setTestJSONCodec makes Manager.JSONCodec the codec of o for the test.
+func setTestJSONCodec(t *testing.T, o DXAPIJSONOptions) {
+	codec := Manager.JSONCodec
+	t.Cleanup(func() {
+		Manager.JSONCodec = codec
+	})
+	Manager.JSONCodec = NewDXAPIJSONCodec(o)
+}
+
+func TestInt64RoundTripsThroughTheCodec(t *testing.T) {
+	setTestJSONCodec(t, DXAPIJSONOptions{IsNumberUsed: true})
+	body := []byte(`{"id":9223372036854775807,"min":-9223372036854775808}`)
+
+	var typed struct {
+		Id  int64 `json:"id"`
+		Min int64 `json:"min"`
+	}
+	require.NoError(t, DecodeAndValidate(body, &typed, true))
+	assert.Equal(t, int64(math.MaxInt64), typed.Id)
+	assert.Equal(t, int64(math.MinInt64), typed.Min)
+	b, err := jsonCodec().Marshal(typed)
+	require.NoError(t, err)
+	assert.Equal(t, string(body), string(b))
+
+	untyped := utils.JSON{}
+	require.NoError(t, DecodeAndValidate(body, &untyped, false))
+	assert.Equal(t, json.Number(`9223372036854775807`), untyped[`id`])
+	b, err = jsonCodec().Marshal(untyped)
+	require.NoError(t, err)
+	assert.Equal(t, string(body), string(b))
+}
+
+func TestQuoteLargeIntegers(t *testing.T) {
+	for s, expected := range map[string]string{
+		`{"id":9007199254740991}`:                                `{"id":9007199254740991}`,
+		`{"id":9007199254740992}`:                                `{"id":"9007199254740992"}`,
+		`[-9007199254740992,-9007199254740991]`:                  `["-9007199254740992",-9007199254740991]`,
+		`{"f":12345678901234567890.5,"e":1e300}`:                 `{"f":12345678901234567890.5,"e":1e300}`,
+		`{"s":"12345678901234567890","q":"a\"9007199254740992"}`: `{"s":"12345678901234567890","q":"a\"9007199254740992"}`,
+	} {
+		assert.Equal(t, expected, string(quoteLargeIntegers([]byte(s))), s)
+	}
+}
+
+func TestWriteJSONQuotesLargeIntegers(t *testing.T) {
+	setTestJSONCodec(t, DXAPIJSONOptions{IsLargeIntAsString: true, IsHTMLEscapeDisabled: true})
+	_, baseURL := startTestAPI(t, `test_codec`, nil, func(a *DXAPI) {
+		newTestEndPoint(a, `/ids`, func(aepr *DXAPIEndPointRequest) (err error) {
+			return aepr.WriteJSON(http.StatusOK, utils.JSON{`id`: int64(math.MaxInt64), `small`: 1, `name`: `<a>`})
+		})
+	})
+	response, err := http.Get(baseURL + `/ids`)
+	require.NoError(t, err)
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	b, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `{"data":{"id":"9223372036854775807","name":"<a>","small":1}}`, string(b))
+}
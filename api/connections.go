@@ -0,0 +1,54 @@
+package api
+
+import (
+	"crypto/tls"
+	"net"
+
+	"github.com/valyala/fasthttp"
+)
+
+// trackConnection keeps the open connections of the API by fasthttp.Server.ConnState, for closeConnections. A hijacked
+// connection, like a WebSocket, is not tracked anymore, it is closed by the cancel of wsContext.
+func (a *DXAPI) trackConnection(c net.Conn, state fasthttp.ConnState) {
+	a.connectionsMutex.Lock()
+	defer a.connectionsMutex.Unlock()
+	switch state {
+	case fasthttp.StateNew:
+		if a.connections == nil {
+			a.connections = map[net.Conn]struct{}{}
+		}
+		a.connections[c] = struct{}{}
+	case fasthttp.StateClosed, fasthttp.StateHijacked:
+		delete(a.connections, c)
+	}
+}
+
+// closeConnections closes the connections still open, idle or in a request, n is the number closed. A socket is shut
+// down rather than closed, fasthttp panics setting the deadline of a closed one, its client sees it closed at once and
+// its fd is released once the handler of its request returns.
+func (a *DXAPI) closeConnections() (n int) {
+	a.connectionsMutex.Lock()
+	defer a.connectionsMutex.Unlock()
+	for c := range a.connections {
+		shutdownConnection(c)
+		delete(a.connections, c)
+		n++
+	}
+	return n
+}
+
+func shutdownConnection(c net.Conn) {
+	if tlsConn, ok := c.(*tls.Conn); ok {
+		c = tlsConn.NetConn()
+	}
+	s, ok := c.(interface {
+		CloseRead() error
+		CloseWrite() error
+	})
+	if !ok {
+		_ = c.Close()
+		return
+	}
+	_ = s.CloseRead()
+	_ = s.CloseWrite()
+}
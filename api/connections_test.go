@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartShutdownClosesHungRequest(t *testing.T) {
+	shutdownTimeout := Manager.ShutdownTimeout
+	Manager.ShutdownTimeout = 200 * time.Millisecond
+	t.Cleanup(func() {
+		Manager.ShutdownTimeout = shutdownTimeout
+	})
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	a, baseURL := startTestAPI(t, `test_hung`, nil, func(a *DXAPI) {
+		newTestEndPoint(a, `/hang`, func(aepr *DXAPIEndPointRequest) (err error) {
+			close(started)
+			// hung, it ignores the context of the request
+			<-release
+			return nil
+		})
+	})
+	errRequest := make(chan error, 1)
+	go func() {
+		response, err := http.Get(baseURL + `/hang`)
+		if err == nil {
+			_ = response.Body.Close()
+		}
+		errRequest <- err
+	}()
+	<-started
+	startTime := time.Now()
+	require.NoError(t, a.StartShutdown())
+	assert.Less(t, time.Since(startTime), 2*time.Second)
+	select {
+	case err := <-errRequest:
+		assert.Error(t, err, "the connection of the hung request is closed")
+	case <-time.After(2 * time.Second):
+		t.Fatal("the hung request is still open after the shutdown")
+	}
+}
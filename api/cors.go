@@ -0,0 +1,77 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+	"dxlib/v3/utils/json"
+)
+
+type DXAPICORSConfiguration struct {
+	AllowOrigins     []string
+	AllowMethods     []string
+	AllowHeaders     []string
+	ExposeHeaders    []string
+	AllowCredentials bool
+	MaxAgeSec        int
+}
+
+// CORSConfigurationFromJSON reads the "cors" block of an api configuration, an origin is either exact, "*" or
+// has a subdomain wildcard like "https://*.example.com".
+func CORSConfigurationFromJSON(c utils.JSON) (r *DXAPICORSConfiguration, err error) {
+	r = &DXAPICORSConfiguration{}
+	r.AllowOrigins, err = json.GetStrings(c, `allow_origins`)
+	if err != nil {
+		err = log.Log.ErrorAndCreateErrorf("Configuration 'cors.allow_origins' must be a list of string (%v)", err)
+		return nil, err
+	}
+	r.AllowMethods, _ = json.GetStrings(c, `allow_methods`)
+	r.AllowHeaders, _ = json.GetStrings(c, `allow_headers`)
+	r.ExposeHeaders, _ = json.GetStrings(c, `expose_headers`)
+	r.AllowCredentials, _ = c[`allow_credentials`].(bool)
+	r.MaxAgeSec = json.GetNumberWithDefault(c, `max_age_sec`, 0)
+	return r, nil
+}
+
+// NewCORSMiddleware answers the preflight requests with 204 and sets Access-Control-Allow-Origin only to an origin
+// matching AllowOrigins.
+func NewCORSMiddleware(c DXAPICORSConfiguration) (h fiber.Handler, err error) {
+	allowOrigins := strings.Join(c.AllowOrigins, `,`)
+	if allowOrigins == `` {
+		err = log.Log.ErrorAndCreateErrorf("CORS needs at least one allowed origin")
+		return nil, err
+	}
+	if c.AllowCredentials && utils.IfStringInSlice(`*`, c.AllowOrigins) {
+		err = log.Log.ErrorAndCreateErrorf("CORS can not allow credentials for the wildcard origin *")
+		return nil, err
+	}
+	defer func() {
+		r := recover()
+		if r != nil {
+			err = log.Log.ErrorAndCreateErrorf("Invalid CORS configuration (%v)", r)
+			h = nil
+		}
+	}()
+	h = cors.New(cors.Config{
+		AllowOrigins:     allowOrigins,
+		AllowMethods:     strings.Join(c.AllowMethods, `,`),
+		AllowHeaders:     strings.Join(c.AllowHeaders, `,`),
+		ExposeHeaders:    strings.Join(c.ExposeHeaders, `,`),
+		AllowCredentials: c.AllowCredentials,
+		MaxAge:           c.MaxAgeSec,
+	})
+	return h, nil
+}
+
+func (a *DXAPI) applyCORSConfiguration(c1 utils.JSON) (err error) {
+	c, ok := c1[`cors`].(utils.JSON)
+	if !ok {
+		return nil
+	}
+	a.CORS, err = CORSConfigurationFromJSON(c)
+	return err
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/utils"
+)
+
+// doTestCORS sends a request of method to url from origin with header, giving the response.
+func doTestCORS(t *testing.T, method string, url string, origin string, header http.Header) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	require.NoError(t, err)
+	req.Header.Set(`Origin`, origin)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	return resp
+}
+
+func startTestCORSAPI(t *testing.T) (baseURL string) {
+	t.Helper()
+	_, baseURL = startTestAPI(t, `test_cors`, utils.JSON{`cors`: utils.JSON{
+		`allow_origins`:     []any{`https://app.example.com`, `https://*.example.org`},
+		`allow_methods`:     []any{`GET`, `POST`},
+		`allow_headers`:     []any{`Authorization`, `Content-Type`},
+		`expose_headers`:    []any{`X-Request-Id`},
+		`allow_credentials`: true,
+		`max_age_sec`:       float64(600),
+	}}, func(a *DXAPI) {
+		newTestWhoEndPoint(a, `cors`)
+	})
+	return baseURL
+}
+
+func TestCORSPreflight(t *testing.T) {
+	baseURL := startTestCORSAPI(t)
+	for _, origin := range []string{`https://app.example.com`, `https://eu.example.org`} {
+		resp := doTestCORS(t, http.MethodOptions, baseURL+`/who`, origin, http.Header{
+			`Access-Control-Request-Method`:  {`POST`},
+			`Access-Control-Request-Headers`: {`Authorization`},
+		})
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		assert.Equal(t, origin, resp.Header.Get(`Access-Control-Allow-Origin`))
+		assert.Equal(t, `GET,POST`, resp.Header.Get(`Access-Control-Allow-Methods`))
+		assert.Equal(t, `Authorization,Content-Type`, resp.Header.Get(`Access-Control-Allow-Headers`))
+		assert.Equal(t, `true`, resp.Header.Get(`Access-Control-Allow-Credentials`))
+		assert.Equal(t, `600`, resp.Header.Get(`Access-Control-Max-Age`))
+	}
+
+	resp := doTestCORS(t, http.MethodGet, baseURL+`/who`, `https://app.example.com`, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `https://app.example.com`, resp.Header.Get(`Access-Control-Allow-Origin`))
+	assert.Equal(t, `X-Request-Id`, resp.Header.Get(`Access-Control-Expose-Headers`))
+}
+
+func TestCORSDisallowedOrigin(t *testing.T) {
+	baseURL := startTestCORSAPI(t)
+	for _, origin := range []string{`https://evil.example.net`, `https://app.example.com.evil.net`, `https://example.org`} {
+		resp := doTestCORS(t, http.MethodOptions, baseURL+`/who`, origin, http.Header{`Access-Control-Request-Method`: {`POST`}})
+		assert.Empty(t, resp.Header.Get(`Access-Control-Allow-Origin`), origin)
+		assert.Empty(t, resp.Header.Get(`Access-Control-Allow-Credentials`), origin)
+
+		resp = doTestCORS(t, http.MethodGet, baseURL+`/who`, origin, nil)
+		assert.Empty(t, resp.Header.Get(`Access-Control-Allow-Origin`), origin)
+	}
+}
+
+func TestCORSConfigurationIsChecked(t *testing.T) {
+	_, err := NewCORSMiddleware(DXAPICORSConfiguration{})
+	assert.ErrorContains(t, err, `at least one allowed origin`)
+	_, err = NewCORSMiddleware(DXAPICORSConfiguration{AllowOrigins: []string{`*`}, AllowCredentials: true})
+	assert.ErrorContains(t, err, `wildcard origin`)
+	_, err = CORSConfigurationFromJSON(utils.JSON{`allow_origins`: `https://app.example.com`})
+	assert.Error(t, err)
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"dxlib/v3/log"
+)
+
+// DXAPICSVExportFunc writes the file to w, like a DXDatabase.ExportCSV, it must return when ctx is done.
+type DXAPICSVExportFunc func(ctx context.Context, w *bufio.Writer) (err error)
+
+// WriteCSV streams the download fileName, text/csv or, for a .tsv, text/tab-separated-values. It returns at once, export
+// runs after the handler returns, so an error of export can only end the response early and is logged.
+func WriteCSV(c *fiber.Ctx, ctx context.Context, fileName string, export DXAPICSVExportFunc) {
+	writeCSV(c, ctx, fileName, export, func() {})
+}
+
+// writeCSV is WriteCSV running done once the download ends.
+func writeCSV(c *fiber.Ctx, ctx context.Context, fileName string, export DXAPICSVExportFunc, done func()) {
+	contentType := `text/csv; charset=utf-8`
+	if filepath.Ext(fileName) == `.tsv` {
+		contentType = `text/tab-separated-values; charset=utf-8`
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType(`attachment`, map[string]string{`filename`: fileName}))
+	c.Set(fiber.HeaderCacheControl, `no-cache`)
+	c.Set(`X-Accel-Buffering`, `no`)
+	c.Status(http.StatusOK)
+	// the strings of the request are only valid in the handler
+	path := strings.Clone(c.Path())
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer done()
+		err := export(ctx, w)
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			log.Log.Warnf("Export %s of %s ended early (%v)", fileName, path, err)
+		}
+	})
+}
+
+// WriteCSV makes the response of the end point the download fileName, see WriteCSV. aepr.Context stays alive until the
+// download ends, it is cancelled when the client disconnects, so the export can be given it as ctx.
+func (aepr *DXAPIEndPointRequest) WriteCSV(ctx context.Context, fileName string, export DXAPICSVExportFunc) {
+	aepr.ResponseStatusCode = http.StatusOK
+	aepr.ResponseBodyAsBytes = nil
+	writeCSV(aepr.FiberContext, ctx, fileName, export, aepr.takeContextCancel())
+}
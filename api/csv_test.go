@@ -0,0 +1,41 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteCSVDownloadsTheExport(t *testing.T) {
+	_, baseURL := startTestAPI(t, `test_csv`, nil, func(a *DXAPI) {
+		newTestEndPoint(a, `/export`, func(aepr *DXAPIEndPointRequest) (err error) {
+			aepr.WriteCSV(context.Background(), `users.csv`, func(ctx context.Context, w *bufio.Writer) (err error) {
+				_, err = w.WriteString("id,name\n")
+				for i := 1; i <= 1000 && err == nil; i++ {
+					_, err = w.WriteString(strconv.Itoa(i) + ",user" + strconv.Itoa(i) + "\n")
+				}
+				return err
+			})
+			return nil
+		})
+	})
+	response, err := http.Get(baseURL + `/export`)
+	require.NoError(t, err)
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, `text/csv; charset=utf-8`, response.Header.Get(`Content-Type`))
+	assert.Equal(t, `attachment; filename=users.csv`, response.Header.Get(`Content-Disposition`))
+	b, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	body := string(b)
+	assert.Contains(t, body, "id,name\n1,user1\n")
+	assert.Contains(t, body, "1000,user1000\n")
+}
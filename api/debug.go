@@ -0,0 +1,100 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"html"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/pprof"
+
+	"dxlib/v3/configurations"
+	"dxlib/v3/databases"
+	"dxlib/v3/databases/protected/db"
+)
+
+const (
+	DXAPIDebugPath           = `/debug`
+	DXAPIDebugKeyHeader      = `X-Debug-Key`
+	DXAPIDebugKeyQueryString = `debug_key`
+)
+
+// debugKeyMiddleware answers 404 like an unknown route unless the request carries the debug key, an empty debug key
+// never matches.
+func debugKeyMiddleware(debugKey string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get(DXAPIDebugKeyHeader)
+		if key == `` {
+			key = c.Query(DXAPIDebugKeyQueryString)
+		}
+		if debugKey == `` || subtle.ConstantTimeCompare([]byte(key), []byte(debugKey)) != 1 {
+			return fiber.NewError(fiber.StatusNotFound, `Cannot `+c.Method()+` `+html.EscapeString(c.Path()))
+		}
+		return c.Next()
+	}
+}
+
+// registerDebugRoutes adds /debug/config with the redacted configurations, /debug/pool with the database pool stats,
+// /debug/slow-queries and /debug/explain, /debug/held-connections, /debug/maintenance to read and set the maintenance and
+// /debug/pprof/*, they are only registered when the API manager IsDebug.
+func (a *DXAPI) registerDebugRoutes() {
+	if !Manager.IsDebug {
+		return
+	}
+	g := a.HTTPServer.Group(DXAPIDebugPath, debugKeyMiddleware(Manager.DebugKey))
+	g.Get(`/config`, func(c *fiber.Ctx) error {
+		return WriteJSON(c, http.StatusOK, configurations.Manager.AsRedactedJSON())
+	})
+	g.Get(`/pool`, func(c *fiber.Ctx) error {
+		return WriteJSON(c, http.StatusOK, databases.Manager.Stats())
+	})
+	g.Get(`/slow-queries`, func(c *fiber.Ctx) error {
+		return WriteJSON(c, http.StatusOK, db.SlowQueries())
+	})
+	g.Get(`/explain`, explainDebugHandler)
+	g.Get(`/held-connections`, heldConnectionsDebugHandler)
+	a.registerMaintenanceDebugRoute(g)
+	g.Use(pprof.New())
+}
+
+// explainDebugHandler gives the plan of the slow query id, as /debug/slow-queries lists them, on the database named by
+// database. analyze=true executes it, see db.Explain.
+func explainDebugHandler(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Query(`id`), 10, 64)
+	if err != nil {
+		return WriteError(c, http.StatusBadRequest, DXAPIErrorCodeValidationFailed, `Query id must be a slow query id`, nil)
+	}
+	_, ok := db.SlowQuery(id)
+	if !ok {
+		return WriteError(c, http.StatusNotFound, errorCodeOfStatus(http.StatusNotFound), `Slow query is not kept anymore`, nil)
+	}
+	d, ok := databases.Manager.Databases[c.Query(`database`)]
+	if !ok || d.Connection == nil {
+		return WriteError(c, http.StatusBadRequest, DXAPIErrorCodeValidationFailed, `Query database must be a connected database`, nil)
+	}
+	plan, err := db.ExplainSlowQuery(c.UserContext(), d.Connection, id, c.QueryBool(`analyze`))
+	if errors.Is(err, db.ErrExplainAnalyzeNotAllowed) {
+		return WriteError(c, http.StatusForbidden, errorCodeOfStatus(http.StatusForbidden), `Analyze is only allowed in debug`, nil)
+	}
+	if err != nil {
+		return WriteError(c, http.StatusUnprocessableEntity, DXAPIErrorCodeValidationFailed, err.Error(), nil)
+	}
+	return WriteJSON(c, http.StatusOK, map[string]string{`plan`: plan})
+}
+
+// heldConnectionsDebugHandler lists the connections and transactions held longer than older_than, like 10s, or else
+// db.HeldConnectionThreshold, with where they were taken.
+func heldConnectionsDebugHandler(c *fiber.Ctx) error {
+	olderThan := db.HeldConnectionThreshold
+	if c.Query(`older_than`) != `` {
+		d, err := time.ParseDuration(c.Query(`older_than`))
+		if err != nil || d < 0 {
+			return WriteError(c, http.StatusBadRequest, DXAPIErrorCodeValidationFailed, `Query older_than must be a duration, like 10s`, nil)
+		}
+		olderThan = d
+	}
+	return WriteJSON(c, http.StatusOK, db.HeldConnections(olderThan))
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/configurations"
+	"dxlib/v3/databases/protected/db"
+	"dxlib/v3/utils"
+)
+
+// getTestDebug sends GET path with the debug key, when given.
+func getTestDebug(t *testing.T, baseURL string, path string, debugKey string) (statusCode int, body string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, baseURL+DXAPIDebugPath+path, nil)
+	require.NoError(t, err)
+	if debugKey != `` {
+		req.Header.Set(DXAPIDebugKeyHeader, debugKey)
+	}
+	response, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	b, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	return response.StatusCode, string(b)
+}
+
+// setTestDebugKey turns the debug routes on with debugKey, restored at the end of the test.
+func setTestDebugKey(t *testing.T, debugKey string) {
+	t.Helper()
+	isDebug, oldDebugKey := Manager.IsDebug, Manager.DebugKey
+	Manager.IsDebug, Manager.DebugKey = true, debugKey
+	t.Cleanup(func() {
+		Manager.IsDebug, Manager.DebugKey = isDebug, oldDebugKey
+	})
+}
+
+func TestDebugConfigHidesTheDSNPasswords(t *testing.T) {
+	setTestDebugKey(t, `key`)
+	configurations.Manager.NewConfiguration(`test_database`, ``, `json`, false, false, utils.JSON{
+		`url`:      `postgres://app:s3cr3t@db/app`,
+		`mysql`:    `app:s3cr3t@tcp(db)/app`,
+		`password`: `s3cr3t`,
+	}, nil)
+	t.Cleanup(func() {
+		configurations.Manager.NewConfiguration(`test_database`, ``, `json`, false, false, nil, nil)
+	})
+	_, baseURL := startTestAPI(t, `test-debug`, nil, nil)
+
+	statusCode, body := getTestDebug(t, baseURL, `/config`, `key`)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Contains(t, body, `postgres://app:***@db/app`)
+	assert.Contains(t, body, `app:***@tcp(db)/app`)
+	assert.NotContains(t, body, `s3cr3t`)
+
+	statusCode, _ = getTestDebug(t, baseURL, `/config`, ``)
+	assert.Equal(t, http.StatusNotFound, statusCode)
+}
+
+func TestDebugExplainOfASlowQuery(t *testing.T) {
+	setTestDebugKey(t, `key`)
+	d := newTestTransactionDatabase(t, `test-explain`)
+	db.SetSlowQueryThreshold(d.Connection, time.Nanosecond)
+	t.Cleanup(func() {
+		db.RemoveSlowQueryThreshold(d.Connection)
+	})
+	_, err := db.NamedQueryRows(d.Connection, `SELECT name FROM t WHERE name = :name`, utils.JSON{`name`: `alice`})
+	require.NoError(t, err)
+	id := db.SlowQueries()[0].Id
+	_, baseURL := startTestAPI(t, `test-debug-explain`, nil, nil)
+
+	statusCode, body := getTestDebug(t, baseURL, fmt.Sprintf(`/explain?id=%d&database=test-explain`, id), `key`)
+	require.Equal(t, http.StatusOK, statusCode, body)
+	var response struct {
+		Data map[string]string `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &response))
+	assert.Contains(t, response.Data[`plan`], `SCAN t`)
+
+	// analyze executes the statement, it needs the debug of the database package
+	statusCode, _ = getTestDebug(t, baseURL, fmt.Sprintf(`/explain?id=%d&database=test-explain&analyze=true`, id), `key`)
+	assert.Equal(t, http.StatusForbidden, statusCode)
+	statusCode, _ = getTestDebug(t, baseURL, `/explain?id=abc&database=test-explain`, `key`)
+	assert.Equal(t, http.StatusBadRequest, statusCode)
+	statusCode, _ = getTestDebug(t, baseURL, fmt.Sprintf(`/explain?id=%d&database=test-explain`, id+1000), `key`)
+	assert.Equal(t, http.StatusNotFound, statusCode)
+	statusCode, _ = getTestDebug(t, baseURL, fmt.Sprintf(`/explain?id=%d&database=unknown`, id), `key`)
+	assert.Equal(t, http.StatusBadRequest, statusCode)
+	statusCode, _ = getTestDebug(t, baseURL, fmt.Sprintf(`/explain?id=%d&database=test-explain`, id), ``)
+	assert.Equal(t, http.StatusNotFound, statusCode)
+}
+
+func TestDebugHeldConnections(t *testing.T) {
+	setTestDebugKey(t, `key`)
+	isDebug := db.IsDebug
+	db.IsDebug = true
+	t.Cleanup(func() {
+		db.IsDebug = isDebug
+	})
+	d := newTestTransactionDatabase(t, `test-held`)
+	tx, err := d.Connection.Beginx()
+	require.NoError(t, err)
+	untrack := db.TrackTx(tx, d.Connection)
+	t.Cleanup(func() {
+		untrack()
+		_ = tx.Rollback()
+	})
+	_, baseURL := startTestAPI(t, `test-debug-held`, nil, nil)
+
+	statusCode, body := getTestDebug(t, baseURL, `/held-connections?older_than=0s`, `key`)
+	require.Equal(t, http.StatusOK, statusCode, body)
+	var response struct {
+		Data []db.DXHeldConnection `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &response))
+	require.Len(t, response.Data, 1)
+	assert.Equal(t, `tx`, response.Data[0].Kind)
+	assert.Contains(t, response.Data[0].Stack, `TestDebugHeldConnections`)
+
+	statusCode, body = getTestDebug(t, baseURL, `/held-connections?older_than=1h`, `key`)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.JSONEq(t, `{"data":[]}`, body)
+	statusCode, _ = getTestDebug(t, baseURL, `/held-connections?older_than=soon`, `key`)
+	assert.Equal(t, http.StatusBadRequest, statusCode)
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	DXAPIDefaultClientDisconnectCheckIntervalMs = 500
+	// DXAPIStatusClientClosedRequest is the status of a request whose client went away before the response, as nginx logs it
+	DXAPIStatusClientClosedRequest = 499
+)
+
+// ErrClientDisconnected is the cause of the context of a request whose client closed its connection.
+var ErrClientDisconnected = errors.New("ClientDisconnected")
+
+// withClientDisconnect gives ctx also cancelled once the client of c closes its connection, so the queries run with it
+// are cancelled on the database too. The connection is peeked at every ClientDisconnectCheckIntervalMs, it sees a
+// closed or reset socket, not a client gone without closing it.
+func (a *DXAPI) withClientDisconnect(ctx context.Context, c *fiber.Ctx) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	conn := c.Context().Conn()
+	if a.ClientDisconnectCheckIntervalMs <= 0 || conn == nil {
+		return ctx, func() { cancel(nil) }
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(a.ClientDisconnectCheckIntervalMs) * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if isPeerClosed(conn) {
+					cancel(ErrClientDisconnected)
+					return
+				}
+			}
+		}
+	}()
+	return ctx, func() { cancel(nil) }
+}
+
+// takeContextCancel gives the cancel of the context of aepr to a stream, written after the handler returns, to run once
+// it ends, so the stream can still use the context and a client disconnecting meanwhile still cancels it.
+func (aepr *DXAPIEndPointRequest) takeContextCancel() context.CancelFunc {
+	cancel := aepr.cancelContext
+	aepr.cancelContext = nil
+	if cancel == nil {
+		return func() {}
+	}
+	return cancel
+}
@@ -0,0 +1,111 @@
+//go:build !windows
+
+package api
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/utils"
+)
+
+// requestAndClose sends a GET of uri to the API at baseURL, waits for isStarted and closes the connection.
+func requestAndClose(t *testing.T, baseURL string, uri string, isStarted <-chan struct{}) {
+	t.Helper()
+	conn, err := net.Dial(`tcp`, strings.TrimPrefix(baseURL, `http://`))
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("GET " + uri + " HTTP/1.1\r\nHost: test\r\n\r\n"))
+	require.NoError(t, err)
+	select {
+	case <-isStarted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the request did not start")
+	}
+	require.NoError(t, conn.Close())
+}
+
+// waitForCause gives the cause sent to causes, or fails after 5s.
+func waitForCause(t *testing.T, causes <-chan error) error {
+	t.Helper()
+	select {
+	case cause := <-causes:
+		return cause
+	case <-time.After(5 * time.Second):
+		t.Fatal("the context was not cancelled")
+		return nil
+	}
+}
+
+func TestClientDisconnectCancelsTheRequestContext(t *testing.T) {
+	isStarted := make(chan struct{})
+	causes := make(chan error, 1)
+	_, baseURL := startTestAPI(t, `test_disconnect`, utils.JSON{`client-disconnect-check-interval-ms`: float64(20)}, func(a *DXAPI) {
+		newTestEndPoint(a, `/wait`, func(aepr *DXAPIEndPointRequest) (err error) {
+			close(isStarted)
+			select {
+			case <-aepr.Context.Done():
+				causes <- context.Cause(aepr.Context)
+			case <-time.After(10 * time.Second):
+				causes <- nil
+			}
+			return nil
+		})
+	})
+	requestAndClose(t, baseURL, `/wait`, isStarted)
+	assert.ErrorIs(t, waitForCause(t, causes), ErrClientDisconnected)
+}
+
+func TestStreamOfTheEndPointKeepsItsContextAfterTheHandlerReturns(t *testing.T) {
+	isReturned := make(chan struct{})
+	_, baseURL := startTestAPI(t, `test_disconnect_sse`, utils.JSON{`client-disconnect-check-interval-ms`: float64(20)}, func(a *DXAPI) {
+		newTestEndPoint(a, `/events`, func(aepr *DXAPIEndPointRequest) (err error) {
+			events := make(chan SSEEvent)
+			aepr.WriteSSE(aepr.Context, events)
+			go func() {
+				<-isReturned
+				events <- SSEEvent{Data: `first`}
+				events <- SSEEvent{Data: `second`}
+				close(events)
+			}()
+			return nil
+		})
+	})
+	response, err := http.Get(baseURL + `/events`)
+	require.NoError(t, err)
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	// the headers are only sent once the handler returned
+	close(isReturned)
+	assert.Equal(t, []string{`first`, `second`}, readSSEData(t, bufio.NewReader(response.Body), 2))
+}
+
+func TestClientDisconnectCancelsTheContextOfAStream(t *testing.T) {
+	isStarted := make(chan struct{})
+	causes := make(chan error, 1)
+	_, baseURL := startTestAPI(t, `test_disconnect_csv`, utils.JSON{`client-disconnect-check-interval-ms`: float64(20)}, func(a *DXAPI) {
+		newTestEndPoint(a, `/export`, func(aepr *DXAPIEndPointRequest) (err error) {
+			aepr.WriteCSV(aepr.Context, `users.csv`, func(ctx context.Context, w *bufio.Writer) (err error) {
+				close(isStarted)
+				select {
+				case <-ctx.Done():
+					causes <- context.Cause(ctx)
+				case <-time.After(10 * time.Second):
+					causes <- nil
+				}
+				return ctx.Err()
+			})
+			return nil
+		})
+	})
+	requestAndClose(t, baseURL, `/export`, isStarted)
+	assert.ErrorIs(t, waitForCause(t, causes), ErrClientDisconnected)
+}
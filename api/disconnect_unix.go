@@ -0,0 +1,37 @@
+//go:build !windows
+
+package api
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// isPeerClosed peeks at a byte of conn without taking it from the request, the end of the stream or an error other than
+// no data yet is the client closing.
+func isPeerClosed(conn net.Conn) bool {
+	if tlsConn, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		conn = tlsConn.NetConn()
+	}
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return false
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return false
+	}
+	isClosed := false
+	b := make([]byte, 1)
+	err = rc.Read(func(fd uintptr) bool {
+		n, _, err := syscall.Recvfrom(int(fd), b, syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+		if err != nil {
+			isClosed = !errors.Is(err, syscall.EAGAIN) && !errors.Is(err, syscall.EWOULDBLOCK) && !errors.Is(err, syscall.EINTR)
+		} else {
+			isClosed = n == 0
+		}
+		return true
+	})
+	return err == nil && isClosed
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package api
+
+import "net"
+
+// isPeerClosed is always false, the connection of a request cannot be peeked at on windows
+func isPeerClosed(_ net.Conn) bool {
+	return false
+}
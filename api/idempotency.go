@@ -0,0 +1,221 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	goRedis "github.com/go-redis/redis/v8"
+	"github.com/gofiber/fiber/v2"
+
+	"dxlib/v3/log"
+	"dxlib/v3/redis"
+	"dxlib/v3/utils"
+	utilsJSON "dxlib/v3/utils/json"
+)
+
+const (
+	DXAPIIdempotencyDefaultHeader         = `Idempotency-Key`
+	DXAPIIdempotencyDefaultTTLSec         = 24 * 60 * 60
+	DXAPIIdempotencyDefaultLockTTLSec     = 30
+	DXAPIIdempotencyDefaultWaitTimeoutSec = 10
+	DXAPIIdempotencyPollInterval          = 50 * time.Millisecond
+	DXAPIIdempotencyReplayedHeader        = `Idempotent-Replayed`
+
+	DXAPIErrorCodeIdempotencyKeyInProgress = `IDEMPOTENCY_KEY_IN_PROGRESS`
+	DXAPIErrorCodeIdempotencyKeyReused     = `IDEMPOTENCY_KEY_REUSED`
+)
+
+type DXAPIIdempotencyConfiguration struct {
+	RedisNameId string
+	// Paths are the request paths, or path prefixes ending with "*", whose requests with the header are idempotent
+	Paths   []string
+	Methods []string
+	Header  string
+	TTLSec  int
+	// LockTTLSec bounds how long a crashed instance keeps the duplicates of its request waiting, the lock is renewed
+	// while the request runs
+	LockTTLSec     int
+	WaitTimeoutSec int
+	KeyPrefix      string
+}
+
+type dxAPIIdempotentResponse struct {
+	Fingerprint string `json:"fingerprint"`
+	StatusCode  int    `json:"status_code"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+}
+
+// IdempotencyConfigurationFromJSON reads the "idempotency" block of an api configuration, redis and paths are mandatory.
+func IdempotencyConfigurationFromJSON(c utils.JSON) (r *DXAPIIdempotencyConfiguration, err error) {
+	r = &DXAPIIdempotencyConfiguration{}
+	r.RedisNameId, _ = c[`redis`].(string)
+	if r.RedisNameId == `` {
+		err = log.Log.ErrorAndCreateErrorf("Configuration 'idempotency.redis' is mandatory")
+		return nil, err
+	}
+	r.Paths, err = utilsJSON.GetStrings(c, `paths`)
+	if err != nil {
+		err = log.Log.ErrorAndCreateErrorf("Configuration 'idempotency.paths' must be a list of string (%v)", err)
+		return nil, err
+	}
+	r.Methods, _ = utilsJSON.GetStrings(c, `methods`)
+	if len(r.Methods) == 0 {
+		r.Methods = []string{fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete}
+	}
+	r.Header, _ = c[`header`].(string)
+	if r.Header == `` {
+		r.Header = DXAPIIdempotencyDefaultHeader
+	}
+	r.TTLSec = utilsJSON.GetNumberWithDefault(c, `ttl_sec`, DXAPIIdempotencyDefaultTTLSec)
+	r.LockTTLSec = utilsJSON.GetNumberWithDefault(c, `lock_ttl_sec`, DXAPIIdempotencyDefaultLockTTLSec)
+	if r.LockTTLSec < 1 {
+		err = log.Log.ErrorAndCreateErrorf("Configuration 'idempotency.lock_ttl_sec' must be at least 1")
+		return nil, err
+	}
+	r.WaitTimeoutSec = utilsJSON.GetNumberWithDefault(c, `wait_timeout_sec`, DXAPIIdempotencyDefaultWaitTimeoutSec)
+	return r, nil
+}
+
+// NewIdempotencyMiddleware keeps the first response to a key of the Idempotency-Key header for TTLSec and answers the
+// replays of the key with it, marked by the Idempotent-Replayed header. The duplicates arriving while the first request
+// runs wait for its response, up to WaitTimeoutSec, then get 409. A replay with another body gets 422.
+//
+// The key is scoped by the method, the path and the sub of the token. The 5xx responses are not kept so the client can
+// retry them. When Redis fails the requests are processed as without the header.
+func NewIdempotencyMiddleware(c DXAPIIdempotencyConfiguration) (h fiber.Handler, err error) {
+	if len(c.Paths) == 0 {
+		err = log.Log.ErrorAndCreateErrorf("Idempotency needs at least one path")
+		return nil, err
+	}
+	if c.LockTTLSec < 1 {
+		err = log.Log.ErrorAndCreateErrorf("Idempotency needs a LockTTLSec of at least 1")
+		return nil, err
+	}
+	ttl := time.Duration(c.TTLSec) * time.Second
+	lockTTL := time.Duration(c.LockTTLSec) * time.Second
+	waitTimeout := time.Duration(c.WaitTimeoutSec) * time.Second
+
+	h = func(ctx *fiber.Ctx) error {
+		idempotencyKey := ctx.Get(c.Header)
+		if idempotencyKey == `` || !utils.IfStringInSlice(ctx.Method(), c.Methods) || !isPathMatched(ctx.Path(), c.Paths) {
+			return ctx.Next()
+		}
+		r, ok := redis.Manager.Redises[c.RedisNameId]
+		if !ok || !r.IsAvailable() {
+			log.Log.Warnf("Redis %s of idempotency is not connected, processing %s without it", c.RedisNameId, ctx.Path())
+			return ctx.Next()
+		}
+		subject := ``
+		if claims, ok := ctx.Locals(claimsLocalsKey).(utils.JSON); ok {
+			subject, _ = claims[`sub`].(string)
+		}
+		key := `dxidempotency:` + c.KeyPrefix + `:` + ctx.Method() + ` ` + ctx.Path() + `:` + subject + `:` + idempotencyKey
+		fingerprint := sha256.Sum256(append([]byte(ctx.Method()+` `+ctx.Path()+"\n"), ctx.Body()...))
+		fingerprintAsString := hex.EncodeToString(fingerprint[:])
+
+		deadline := time.Now().Add(waitTimeout)
+		var lock *redis.DXRedisLock
+		for {
+			stored, err := getIdempotentResponse(ctx, r, key)
+			if err != nil {
+				log.Log.Warnf("Cannot read idempotent response %s of Redis %s, processing without it (%v)", key, r.NameId, err)
+				return ctx.Next()
+			}
+			if stored != nil {
+				return replayIdempotentResponse(ctx, stored, fingerprintAsString)
+			}
+			var isAcquired bool
+			lock, isAcquired, err = r.AcquireLock(ctx.UserContext(), key+`:lock`, lockTTL)
+			if err != nil {
+				log.Log.Warnf("Cannot lock idempotency key %s of Redis %s, processing without it (%v)", key, r.NameId, err)
+				return ctx.Next()
+			}
+			if isAcquired {
+				break
+			}
+			if time.Now().After(deadline) {
+				return WriteError(ctx, http.StatusConflict, DXAPIErrorCodeIdempotencyKeyInProgress,
+					`A request with the same idempotency key is in progress`, nil)
+			}
+			select {
+			case <-ctx.Context().Done():
+				return fiber.ErrServiceUnavailable
+			case <-time.After(DXAPIIdempotencyPollInterval):
+			}
+		}
+		lock.AutoRenew(ctx.UserContext())
+		defer func() {
+			_ = lock.Release()
+		}()
+		// the first request may have finished between the read and the lock
+		stored, err := getIdempotentResponse(ctx, r, key)
+		if err == nil && stored != nil {
+			return replayIdempotentResponse(ctx, stored, fingerprintAsString)
+		}
+
+		err = ctx.Next()
+		if err != nil || ctx.Response().StatusCode() >= http.StatusInternalServerError {
+			return err
+		}
+		responseAsBytes, errStore := json.Marshal(dxAPIIdempotentResponse{
+			Fingerprint: fingerprintAsString,
+			StatusCode:  ctx.Response().StatusCode(),
+			ContentType: string(ctx.Response().Header.ContentType()),
+			Body:        ctx.Response().Body(),
+		})
+		if errStore == nil {
+			errStore = r.Connection.Set(ctx.UserContext(), key, responseAsBytes, ttl).Err()
+		}
+		if errStore != nil {
+			log.Log.Warnf("Cannot keep idempotent response %s in Redis %s (%v)", key, r.NameId, errStore)
+		}
+		return nil
+	}
+	return h, nil
+}
+
+func getIdempotentResponse(ctx *fiber.Ctx, r *redis.DXRedis, key string) (stored *dxAPIIdempotentResponse, err error) {
+	storedAsBytes, err := r.Connection.Get(ctx.UserContext(), key).Bytes()
+	if errors.Is(err, goRedis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	stored = &dxAPIIdempotentResponse{}
+	err = json.Unmarshal(storedAsBytes, stored)
+	if err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+func replayIdempotentResponse(ctx *fiber.Ctx, stored *dxAPIIdempotentResponse, fingerprint string) error {
+	if stored.Fingerprint != fingerprint {
+		return WriteError(ctx, http.StatusUnprocessableEntity, DXAPIErrorCodeIdempotencyKeyReused,
+			`The idempotency key was used by another request`, nil)
+	}
+	ctx.Set(DXAPIIdempotencyReplayedHeader, `true`)
+	if stored.ContentType != `` {
+		ctx.Set(fiber.HeaderContentType, stored.ContentType)
+	}
+	return ctx.Status(stored.StatusCode).Send(stored.Body)
+}
+
+func (a *DXAPI) applyIdempotencyConfiguration(c1 utils.JSON) (err error) {
+	c, ok := c1[`idempotency`].(utils.JSON)
+	if !ok {
+		return nil
+	}
+	a.Idempotency, err = IdempotencyConfigurationFromJSON(c)
+	if err != nil {
+		return err
+	}
+	a.Idempotency.KeyPrefix = a.NameId
+	return nil
+}
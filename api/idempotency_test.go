@@ -0,0 +1,135 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/redis"
+	"dxlib/v3/utils"
+)
+
+func TestIdempotencyConfigurationRejectsALockTTLUnderASecond(t *testing.T) {
+	c, err := IdempotencyConfigurationFromJSON(utils.JSON{`redis`: `cache`, `paths`: []any{`/orders`}})
+	require.NoError(t, err)
+	assert.Equal(t, DXAPIIdempotencyDefaultLockTTLSec, c.LockTTLSec)
+
+	_, err = IdempotencyConfigurationFromJSON(utils.JSON{`redis`: `cache`, `paths`: []any{`/orders`}, `lock_ttl_sec`: float64(0)})
+	assert.ErrorContains(t, err, `lock_ttl_sec`)
+	_, err = NewIdempotencyMiddleware(DXAPIIdempotencyConfiguration{RedisNameId: `cache`, Paths: []string{`/orders`}})
+	assert.ErrorContains(t, err, `LockTTLSec`)
+}
+
+// newTestIdempotentApp gives an app whose POST /orders is idempotent in the Redis redisNameId, answering 201 with the
+// number of the order it created, counted in created. Every order waits for release when not nil.
+func newTestIdempotentApp(t *testing.T, redisNameId string, created *atomic.Int32, release chan struct{}) *fiber.App {
+	t.Helper()
+	h, err := NewIdempotencyMiddleware(DXAPIIdempotencyConfiguration{RedisNameId: redisNameId, Paths: []string{`/orders`},
+		Methods: []string{fiber.MethodPost}, Header: DXAPIIdempotencyDefaultHeader, TTLSec: 60, LockTTLSec: 5,
+		WaitTimeoutSec: 10, KeyPrefix: `test`})
+	require.NoError(t, err)
+	app := fiber.New()
+	app.Use(h)
+	app.Post(`/orders`, func(c *fiber.Ctx) error {
+		if release != nil {
+			<-release
+		}
+		return c.Status(http.StatusCreated).SendString(`order ` + strconv.Itoa(int(created.Add(1))))
+	})
+	return app
+}
+
+// newTestIdempotencyRedis gives the Redis nameId of redis.Manager connected to a miniredis.
+func newTestIdempotencyRedis(t *testing.T, nameId string) {
+	t.Helper()
+	m := miniredis.RunT(t)
+	r := redis.Manager.NewRedis(nameId, false, false)
+	r.Address = m.Addr()
+	r.IsConfigured = true
+	require.NoError(t, r.Connect())
+	t.Cleanup(func() {
+		_ = r.Disconnect()
+		delete(redis.Manager.Redises, nameId)
+	})
+}
+
+// postTestOrder posts body to /orders with the idempotency key, giving the response and its body.
+func postTestOrder(t *testing.T, app *fiber.App, key string, body string) (resp *http.Response, responseBody string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, `/orders`, strings.NewReader(body))
+	req.Header.Set(DXAPIIdempotencyDefaultHeader, key)
+	resp, err := app.Test(req, -1)
+	require.NoError(t, err)
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(b)
+}
+
+func TestIdempotentReplayGivesTheFirstResponse(t *testing.T) {
+	newTestIdempotencyRedis(t, `test_idempotency`)
+	created := &atomic.Int32{}
+	app := newTestIdempotentApp(t, `test_idempotency`, created, nil)
+
+	resp, body := postTestOrder(t, app, `key-1`, `{"amount":10}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, `order 1`, body)
+	assert.Empty(t, resp.Header.Get(DXAPIIdempotencyReplayedHeader))
+
+	resp, body = postTestOrder(t, app, `key-1`, `{"amount":10}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, `order 1`, body)
+	assert.Equal(t, `true`, resp.Header.Get(DXAPIIdempotencyReplayedHeader))
+	assert.Equal(t, int32(1), created.Load())
+
+	resp, _ = postTestOrder(t, app, `key-1`, `{"amount":99}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	resp, body = postTestOrder(t, app, `key-2`, `{"amount":10}`)
+	assert.Equal(t, `order 2`, body)
+	assert.Equal(t, int32(2), created.Load())
+}
+
+func TestConcurrentDuplicatesRunOnce(t *testing.T) {
+	newTestIdempotencyRedis(t, `test_idempotency`)
+	created := &atomic.Int32{}
+	release := make(chan struct{})
+	app := newTestIdempotentApp(t, `test_idempotency`, created, release)
+
+	bodies := make([]string, 5)
+	wg := sync.WaitGroup{}
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, bodies[i] = postTestOrder(t, app, `key-1`, `{"amount":10}`)
+		}(i)
+	}
+	// let the duplicates reach the lock before the first request ends
+	time.Sleep(200 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), created.Load())
+	for _, body := range bodies {
+		assert.Equal(t, `order 1`, body)
+	}
+}
+
+func TestIdempotencyFailsOpenWithoutRedis(t *testing.T) {
+	created := &atomic.Int32{}
+	app := newTestIdempotentApp(t, `not_connected`, created, nil)
+
+	_, body := postTestOrder(t, app, `key-1`, `{"amount":10}`)
+	assert.Equal(t, `order 1`, body)
+	_, body = postTestOrder(t, app, `key-1`, `{"amount":10}`)
+	assert.Equal(t, `order 2`, body)
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	v3 "dxlib/v3"
+	"dxlib/v3/health"
+	"dxlib/v3/redis"
+	"dxlib/v3/utils"
+)
+
+const (
+	DXAPIInfoPath   = `/info`
+	DXAPIHealthPath = `/healthz`
+	DXAPIReadyPath  = `/readyz`
+)
+
+func appInfo() utils.JSON {
+	return utils.JSON{
+		`nameid`:       v3.AppNameId,
+		`title`:        v3.AppTitle,
+		`version`:      v3.AppVersion,
+		`description`:  v3.AppDescription,
+		`build_commit`: v3.BuildCommit,
+		`build_date`:   v3.BuildDate,
+		`start_time`:   v3.StartTime.UTC().Format(time.RFC3339),
+		`uptime_sec`:   int64(time.Since(v3.StartTime).Seconds()),
+		`go_version`:   runtime.Version(),
+	}
+}
+
+// registerInfoRoute adds the unauthenticated GET /info with the app and build information, unless an end point of the
+// API already uses that uri.
+func (a *DXAPI) registerInfoRoute() {
+	for _, v := range a.EndPoints {
+		if v.Uri == DXAPIInfoPath {
+			return
+		}
+	}
+	a.HTTPServer.Get(DXAPIInfoPath, func(c *fiber.Ctx) error {
+		return WriteJSON(c, http.StatusOK, appInfo())
+	})
+}
+
+// registerHealthRoute adds the unauthenticated GET /healthz answering 200 while the process serves requests, unless an
+// end point of the API already uses that uri.
+func (a *DXAPI) registerHealthRoute() {
+	for _, v := range a.EndPoints {
+		if v.Uri == DXAPIHealthPath {
+			return
+		}
+	}
+	a.HTTPServer.Get(DXAPIHealthPath, func(c *fiber.Ctx) error {
+		return WriteJSON(c, http.StatusOK, utils.JSON{`status`: `ok`})
+	})
+}
+
+// registerReadyRoute adds the unauthenticated GET /readyz running the checks of health.Manager, 200 when they all pass
+// and 503 otherwise, with the result of every check, unless an end point of the API already uses that uri. The Redises
+// running degraded are listed in degraded, they do not make the app unready.
+func (a *DXAPI) registerReadyRoute() {
+	for _, v := range a.EndPoints {
+		if v.Uri == DXAPIReadyPath {
+			return
+		}
+	}
+	a.HTTPServer.Get(DXAPIReadyPath, func(c *fiber.Ctx) error {
+		isReady, results := health.Manager.Check(c.UserContext())
+		r := utils.JSON{`status`: health.DXHealthStatusOk, `checks`: results}
+		degraded := redis.Manager.DegradedRedises()
+		if len(degraded) > 0 {
+			sort.Strings(degraded)
+			r[`degraded`] = degraded
+		}
+		if !isReady {
+			r[`status`] = health.DXHealthStatusFail
+			return WriteJSON(c, http.StatusServiceUnavailable, r)
+		}
+		return WriteJSON(c, http.StatusOK, r)
+	})
+}
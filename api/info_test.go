@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/health"
+	"dxlib/v3/redis"
+)
+
+type testReadyBody struct {
+	Data struct {
+		Status   string                                `json:"status"`
+		Checks   map[string]health.DXHealthCheckResult `json:"checks"`
+		Degraded []string                              `json:"degraded"`
+	} `json:"data"`
+}
+
+func getTestReady(t *testing.T, baseURL string) (statusCode int, body testReadyBody) {
+	t.Helper()
+	response, err := http.Get(baseURL + DXAPIReadyPath)
+	require.NoError(t, err)
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&body))
+	return response.StatusCode, body
+}
+
+func TestReadyReportsARegisteredFailingCheck(t *testing.T) {
+	health.Register(`test-license`, func(ctx context.Context) error {
+		return errors.New(`license expired`)
+	})
+	t.Cleanup(func() {
+		health.Manager.Unregister(`test-license`)
+	})
+	_, baseURL := startTestAPI(t, `test-ready-failing`, nil, nil)
+
+	statusCode, body := getTestReady(t, baseURL)
+	assert.Equal(t, http.StatusServiceUnavailable, statusCode)
+	assert.Equal(t, health.DXHealthStatusFail, body.Data.Status)
+	assert.Equal(t, health.DXHealthStatusFail, body.Data.Checks[`test-license`].Status)
+	assert.Equal(t, `license expired`, body.Data.Checks[`test-license`].Error)
+}
+
+func TestReadyIsServedDuringMaintenance(t *testing.T) {
+	Manager.SetMaintenance(true, ``)
+	t.Cleanup(func() {
+		Manager.SetMaintenance(false, ``)
+	})
+	_, baseURL := startTestAPI(t, `test-ready-maintenance`, nil, nil)
+
+	statusCode, body := getTestReady(t, baseURL)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, health.DXHealthStatusOk, body.Data.Status)
+}
+
+func TestReadyListsDegradedRedises(t *testing.T) {
+	r := redis.Manager.NewRedis(`test-ready-degraded`, true, false)
+	r.IsRequired = false
+	t.Cleanup(func() {
+		delete(redis.Manager.Redises, r.NameId)
+	})
+	_, baseURL := startTestAPI(t, `test-ready`, nil, nil)
+
+	statusCode, body := getTestReady(t, baseURL)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, health.DXHealthStatusOk, body.Data.Status)
+	assert.Equal(t, []string{`test-ready-degraded`}, body.Data.Degraded)
+}
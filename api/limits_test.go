@@ -0,0 +1,49 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/utils"
+	utilsHttp "dxlib/v3/utils/http"
+)
+
+// postTest sends POST url with body, giving the status of the response.
+func postTest(t *testing.T, url string, body []byte, header http.Header) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	require.NoError(t, err)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestBodyOverMaxBodyBytesIsRejected(t *testing.T) {
+	a, baseURL := startTestAPI(t, `test_limits`, utils.JSON{
+		`max-body-bytes`:   float64(1024),
+		`max-header-bytes`: float64(4096),
+		`readtimeout-sec`:  float64(7),
+	}, func(a *DXAPI) {
+		a.NewEndPoint(`/echo`, ``, `/echo`, http.MethodPost, EndPointTypeHTTP, utilsHttp.ContentTypeRaw, nil,
+			func(aepr *DXAPIEndPointRequest) (err error) {
+				aepr.ResponseStatusCode = http.StatusOK
+				return nil
+			}, nil, nil)
+	})
+	assert.Equal(t, 7*time.Second, a.HTTPServer.Config().ReadTimeout)
+
+	assert.Equal(t, http.StatusOK, postTest(t, baseURL+`/echo`, bytes.Repeat([]byte(`a`), 1024), nil))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, postTest(t, baseURL+`/echo`, bytes.Repeat([]byte(`a`), 1025), nil))
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, postTest(t, baseURL+`/echo`, nil,
+		http.Header{`X-Large`: {strings.Repeat(`a`, 8192)}}))
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DXAPIInheritedListenersEnv names the listeners a restarting process passes on, as key:fd pairs separated by commas,
+// the key being the name id of the API and the spec of the listener, see listenerKey, like
+// api=127.0.0.1:8080:3,api=127.0.0.1:8081:4,admin=127.0.0.1:9090:5.
+const DXAPIInheritedListenersEnv = `DXLIB_INHERITED_LISTENERS`
+
+// inheritedListenerFds are the fds of DXAPIInheritedListenersEnv by key, in the order given for the listeners of the same
+// spec. It is read and unset once so the processes started by this one do not inherit it.
+var inheritedListenerFds = func() (r map[string][]uintptr) {
+	s := os.Getenv(DXAPIInheritedListenersEnv)
+	_ = os.Unsetenv(DXAPIInheritedListenersEnv)
+	return parseInheritedListenerFds(s)
+}()
+
+func parseInheritedListenerFds(s string) (r map[string][]uintptr) {
+	r = map[string][]uintptr{}
+	for _, v := range strings.Split(s, `,`) {
+		// the spec has colons too, the fd is after the last one
+		i := strings.LastIndex(v, `:`)
+		if i < 0 {
+			continue
+		}
+		n, err := strconv.ParseUint(v[i+1:], 10, 64)
+		if err == nil {
+			r[v[:i]] = append(r[v[:i]], uintptr(n))
+		}
+	}
+	return r
+}
+
+// listenerKey is the key of the listener of the API nameId on spec, the same in the new process of a restart as long as
+// the listener is in its configuration.
+func listenerKey(nameId string, spec DXAPIListenSpec) string {
+	return nameId + `=` + spec.String()
+}
+
+// DXAPIListenSpec is a socket an API is served on besides its Address, read from a "listen" entry like
+// "unix:/run/app.sock", "tcp:127.0.0.1:8081" or "127.0.0.1:8081". An empty Network is the one of the fiber app.
+type DXAPIListenSpec struct {
+	Network string
+	Address string
+}
+
+func ParseListenSpec(s string) (r DXAPIListenSpec, err error) {
+	network, address, ok := strings.Cut(s, `:`)
+	switch {
+	case ok && network == `unix`:
+		r = DXAPIListenSpec{Network: `unix`, Address: address}
+	case ok && network == `tcp`:
+		r = DXAPIListenSpec{Address: address}
+	default:
+		r = DXAPIListenSpec{Address: s}
+	}
+	if r.Address == `` {
+		return r, fmt.Errorf("ListenSpecWithoutAddress:%s", s)
+	}
+	return r, nil
+}
+
+func (s DXAPIListenSpec) String() string {
+	if s.Network == `` {
+		return s.Address
+	}
+	return s.Network + `:` + s.Address
+}
+
+// listenSpec listens on s, or takes its listener passed on by the process restarting into this one, see inherit. The
+// file of a unix socket left by a process that did not exit cleanly is removed first.
+func (a *DXAPI) listenSpec(s DXAPIListenSpec) (l net.Listener, err error) {
+	network := s.Network
+	if network == `` {
+		network = a.HTTPServer.Config().Network
+	}
+	if network != `unix` {
+		l, ok := a.inherit(s)
+		if ok {
+			return l, nil
+		}
+		return net.Listen(network, s.Address)
+	}
+	fi, err := os.Stat(s.Address)
+	if err == nil && fi.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(s.Address)
+	}
+	ul, err := net.ListenUnix(network, &net.UnixAddr{Name: s.Address, Net: network})
+	if err != nil {
+		return nil, err
+	}
+	ul.SetUnlinkOnClose(false)
+	fi, err = os.Stat(s.Address)
+	if err != nil {
+		_ = ul.Close()
+		return nil, err
+	}
+	return &dxAPIUnixListener{UnixListener: ul, path: s.Address, file: fi}, nil
+}
+
+// dxAPIUnixListener removes its socket file once closed, unless it is no longer its own, like the one of the new
+// process of a graceful restart listening on the same path.
+type dxAPIUnixListener struct {
+	*net.UnixListener
+	path string
+	file os.FileInfo
+}
+
+func (l *dxAPIUnixListener) Close() error {
+	err := l.UnixListener.Close()
+	fi, errStat := os.Stat(l.path)
+	if errStat == nil && os.SameFile(fi, l.file) {
+		_ = os.Remove(l.path)
+	}
+	return err
+}
+
+// inherit gives the listener of s passed on by the process restarting into this one, ok is false when there is none or
+// it cannot be used.
+func (a *DXAPI) inherit(s DXAPIListenSpec) (l net.Listener, ok bool) {
+	key := listenerKey(a.NameId, s)
+	fds := inheritedListenerFds[key]
+	if len(fds) == 0 {
+		return nil, false
+	}
+	inheritedListenerFds[key] = fds[1:]
+	f := os.NewFile(fds[0], key)
+	l, err := net.FileListener(f)
+	_ = f.Close()
+	if err != nil {
+		a.Log.Warnf("Cannot use the inherited listener of %s, listening again (%v)", s, err)
+		return nil, false
+	}
+	a.Log.Infof("Listening at %s on the inherited listener", s)
+	return l, true
+}
+
+// ListenerFiles gives a copy of every TCP listener of the running APIs, for a new process to serve them without refusing
+// a connection, keys are their listenerKey. The unix sockets are listened again by the new process. It fails where a
+// listener cannot be copied.
+func (am *DXAPIManager) ListenerFiles() (keys []string, files []*os.File, err error) {
+	nameIds := make([]string, 0, len(am.APIs))
+	for k := range am.APIs {
+		nameIds = append(nameIds, k)
+	}
+	sort.Strings(nameIds)
+	for _, k := range nameIds {
+		a := am.APIs[k]
+		for i, v := range a.Listeners {
+			tl, ok := v.(*net.TCPListener)
+			if !ok {
+				continue
+			}
+			f, err := tl.File()
+			if err != nil {
+				for _, x := range files {
+					_ = x.Close()
+				}
+				return nil, nil, fmt.Errorf("ListenerCannotBeCopied:%s:%w", listenerKey(k, a.listenerSpecs[i]), err)
+			}
+			keys = append(keys, listenerKey(k, a.listenerSpecs[i]))
+			files = append(files, f)
+		}
+	}
+	return keys, files, nil
+}
+
+// InheritedListenersEnv is the DXAPIInheritedListenersEnv of a process started with the files of ListenerFiles as its
+// extra files, which are given the fds from 3 in order.
+func InheritedListenersEnv(keys []string) string {
+	s := make([]string, len(keys))
+	for i, v := range keys {
+		s[i] = v + `:` + strconv.Itoa(3+i)
+	}
+	return DXAPIInheritedListenersEnv + `=` + strings.Join(s, `,`)
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/utils"
+)
+
+const testHandoverChildEnv = `DXLIB_TEST_HANDOVER_CHILD`
+
+// newTestWhoEndPoint adds GET /who answering who.
+func newTestWhoEndPoint(a *DXAPI, who string) {
+	newTestEndPoint(a, `/who`, func(aepr *DXAPIEndPointRequest) (err error) {
+		aepr.ResponseStatusCode = http.StatusOK
+		aepr.ResponseBodyAsBytes = []byte(who)
+		return nil
+	})
+}
+
+// TestListenerHandoverChild is the new process of TestListenerHandoverRefusesNoConnection, it serves the listeners it
+// inherits until its stdin is closed.
+func TestListenerHandoverChild(t *testing.T) {
+	if os.Getenv(testHandoverChildEnv) == `` {
+		t.Skip(`run by TestListenerHandoverRefusesNoConnection`)
+	}
+	_, _ = startTestAPI(t, `test_handover`, testHandoverConfiguration(), func(a *DXAPI) {
+		newTestWhoEndPoint(a, `child`)
+	})
+	_, _ = os.Stdout.WriteString("ready\n")
+	_, _ = io.Copy(io.Discard, os.Stdin)
+}
+
+func TestListenerHandoverRefusesNoConnection(t *testing.T) {
+	a, _ := startTestAPI(t, `test_handover`, testHandoverConfiguration(), func(a *DXAPI) {
+		newTestWhoEndPoint(a, `parent`)
+	})
+	require.Len(t, a.Listeners, 2)
+	keys, files, err := Manager.ListenerFiles()
+	require.NoError(t, err)
+	assert.Equal(t, []string{`test_handover=127.0.0.1:0`, `test_handover=127.0.0.1:0`}, keys)
+	cmd := exec.Command(os.Args[0], `-test.run=^TestListenerHandoverChild$`)
+	cmd.Env = append(os.Environ(), InheritedListenersEnv(keys), testHandoverChildEnv+`=1`)
+	cmd.ExtraFiles = files
+	stdin, err := cmd.StdinPipe()
+	require.NoError(t, err)
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+	for _, f := range files {
+		_ = f.Close()
+	}
+	t.Cleanup(func() {
+		_ = stdin.Close()
+		_ = cmd.Wait()
+	})
+	lines := bufio.NewScanner(stdout)
+	isReady := false
+	for !isReady && lines.Scan() {
+		isReady = lines.Text() == `ready`
+	}
+	require.True(t, isReady, `the child process did not serve`)
+	go func() {
+		_, _ = io.Copy(io.Discard, stdout)
+	}()
+
+	// a new connection per request, like the clients arriving during the restart
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}, Timeout: 5 * time.Second}
+	stop := make(chan struct{})
+	mutex := sync.Mutex{}
+	answers := map[string]int{}
+	var errs []error
+	wg := sync.WaitGroup{}
+	for _, v := range a.Listeners {
+		baseURL := `http://` + v.Addr().String()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				response, err := client.Get(baseURL + `/who`)
+				mutex.Lock()
+				if err != nil {
+					errs = append(errs, err)
+				} else {
+					b, _ := io.ReadAll(response.Body)
+					_ = response.Body.Close()
+					answers[baseURL+` `+string(b)]++
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, a.StartShutdown())
+	time.Sleep(300 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+
+	assert.Empty(t, errs)
+	for _, v := range a.Listeners {
+		assert.Greater(t, answers[`http://`+v.Addr().String()+` child`], 0, v.Addr().String())
+	}
+}
+
+// testHandoverConfiguration serves the API of the handover test on a second TCP listener.
+func testHandoverConfiguration() utils.JSON {
+	return utils.JSON{`listen`: []any{`tcp:127.0.0.1:0`}}
+}
+
+func TestParseInheritedListenerFds(t *testing.T) {
+	assert.Equal(t, map[string][]uintptr{
+		`api=127.0.0.1:8080`: {3, 5},
+		`api=[::1]:8081`:     {4},
+		`admin=0.0.0.0:9090`: {6},
+	}, parseInheritedListenerFds(`api=127.0.0.1:8080:3,api=[::1]:8081:4,api=127.0.0.1:8080:5,admin=0.0.0.0:9090:6,broken,x:y`))
+	assert.Empty(t, parseInheritedListenerFds(``))
+}
+
+func TestServeOnTheListenEntries(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), `api.sock`)
+	a, baseURL := startTestAPI(t, `test_listen`, utils.JSON{`listen`: []any{`127.0.0.1:0`, `unix:` + socket}}, func(a *DXAPI) {
+		newTestWhoEndPoint(a, `listen`)
+	})
+	require.Len(t, a.Listeners, 3)
+	keys, files, err := Manager.ListenerFiles()
+	require.NoError(t, err)
+	for _, f := range files {
+		_ = f.Close()
+	}
+	// the unix socket is listened again by the new process, not handed over
+	assert.Equal(t, []string{`test_listen=127.0.0.1:0`, `test_listen=127.0.0.1:0`}, keys)
+
+	unixClient := &http.Client{Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, `unix`, socket)
+	}}}
+	for _, v := range []struct {
+		client *http.Client
+		url    string
+	}{
+		{http.DefaultClient, baseURL},
+		{http.DefaultClient, `http://` + a.Listeners[1].Addr().String()},
+		{unixClient, `http://unix`},
+	} {
+		response, err := v.client.Get(v.url + `/who`)
+		require.NoError(t, err, v.url)
+		b, _ := io.ReadAll(response.Body)
+		_ = response.Body.Close()
+		assert.Equal(t, `listen`, string(b), v.url)
+	}
+
+	require.NoError(t, a.StartShutdown())
+	_, err = os.Stat(socket)
+	assert.True(t, os.IsNotExist(err), `the socket file is removed`)
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+
+	"dxlib/v3/metrics"
+)
+
+const (
+	DXAPIDefaultLoadSheddingRetryAfterSec = 1
+	// DXAPILoadSheddingWarningInterval is how often the shed requests are logged, as a count, while overloaded
+	DXAPILoadSheddingWarningInterval = 10 * time.Second
+
+	DXAPIErrorCodeOverloaded = `OVERLOADED`
+)
+
+// InFlightRequests is the number of requests the API is serving, the health, info, metrics and debug routes and the
+// streams excepted.
+func (a *DXAPI) InFlightRequests() int64 {
+	return a.inFlightRequests.Load()
+}
+
+// isStreamRequest is true for a WebSocket upgrade and a Server-Sent Events request, their connection outlives the
+// handler, so they are not counted as in flight.
+func isStreamRequest(c *fiber.Ctx) bool {
+	return websocket.IsWebSocketUpgrade(c) || strings.Contains(c.Get(fiber.HeaderAccept), `text/event-stream`)
+}
+
+// warnShed logs the requests shed, at most once every DXAPILoadSheddingWarningInterval so an overload does not flood the
+// log, with the count of those shed since the last warning.
+func (a *DXAPI) warnShed(c *fiber.Ctx) {
+	a.shedRequests.Add(1)
+	now := time.Now().UnixNano()
+	last := a.lastShedWarningAt.Load()
+	if now-last < int64(DXAPILoadSheddingWarningInterval) || !a.lastShedWarningAt.CompareAndSwap(last, now) {
+		return
+	}
+	a.Log.Warnf("%d requests shed, the last %s %s, %d requests in flight", a.shedRequests.Swap(0), c.Method(), c.Path(),
+		a.inFlightRequests.Load())
+}
+
+// loadSheddingMiddleware answers 503 with Retry-After at once to a request coming while MaxInFlightRequests are
+// served, instead of queueing it until it times out. The health, info, metrics and debug routes and the streams, see
+// isStreamRequest, are never shed.
+func (a *DXAPI) loadSheddingMiddleware() fiber.Handler {
+	a.inFlightSlots = make(chan struct{}, a.MaxInFlightRequests)
+	return func(c *fiber.Ctx) error {
+		path := c.Path()
+		if path == DXAPIHealthPath || path == DXAPIReadyPath || path == DXAPIInfoPath ||
+			(metrics.Manager.IsEnabled && path == metrics.Manager.Path) || isPathMatched(path, []string{DXAPIDebugPath + `/*`}) ||
+			isStreamRequest(c) {
+			return c.Next()
+		}
+		select {
+		case a.inFlightSlots <- struct{}{}:
+		default:
+			a.warnShed(c)
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(a.LoadSheddingRetryAfterSec))
+			return WriteError(c, http.StatusServiceUnavailable, DXAPIErrorCodeOverloaded, `The service is overloaded`, nil)
+		}
+		a.inFlightRequests.Add(1)
+		defer func() {
+			a.inFlightRequests.Add(-1)
+			<-a.inFlightSlots
+		}()
+		return c.Next()
+	}
+}
+
+// registerInFlightRequestsMetric exposes the sum of the InFlightRequests of the APIs.
+func (am *DXAPIManager) registerInFlightRequestsMetric() {
+	if !metrics.Manager.IsEnabled {
+		return
+	}
+	metrics.Manager.RegisterGaugeFunc("dxlib_api_in_flight_requests", "Number of requests being served by the APIs.", func() float64 {
+		n := int64(0)
+		for _, a := range am.APIs {
+			n += a.InFlightRequests()
+		}
+		return float64(n)
+	})
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+)
+
+// getTestStatus gives the status and the Retry-After of a GET of url with header.
+func getTestStatus(t *testing.T, url string, header map[string]string) (status int, retryAfter string) {
+	t.Helper()
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	for k, v := range header {
+		request.Header.Set(k, v)
+	}
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	_ = response.Body.Close()
+	return response.StatusCode, response.Header.Get(`Retry-After`)
+}
+
+func TestLoadSheddingShedsAllButTheStreams(t *testing.T) {
+	release := make(chan struct{})
+	a, baseURL := startTestAPI(t, `test_load_shedding`, utils.JSON{`max-in-flight-requests`: float64(1), `load-shedding-retry-after-sec`: float64(3)}, func(a *DXAPI) {
+		newTestEndPoint(a, `/slow`, func(aepr *DXAPIEndPointRequest) (err error) {
+			<-release
+			return nil
+		})
+		newTestEndPoint(a, `/fast`, func(aepr *DXAPIEndPointRequest) (err error) {
+			return nil
+		})
+	})
+	done := make(chan int)
+	go func() {
+		response, err := http.Get(baseURL + `/slow`)
+		if err != nil {
+			done <- 0
+			return
+		}
+		_ = response.Body.Close()
+		done <- response.StatusCode
+	}()
+	require.Eventually(t, func() bool {
+		return a.InFlightRequests() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	status, retryAfter := getTestStatus(t, baseURL+`/fast`, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, `3`, retryAfter)
+	status, _ = getTestStatus(t, baseURL+`/fast`, map[string]string{`Accept`: `text/event-stream`})
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = getTestStatus(t, baseURL+`/fast`, map[string]string{`Connection`: `Upgrade`, `Upgrade`: `websocket`})
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = getTestStatus(t, baseURL+DXAPIHealthPath, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-done)
+	status, _ = getTestStatus(t, baseURL+`/fast`, nil)
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestLoadSheddingWarnsOnceAnInterval(t *testing.T) {
+	b := &bytes.Buffer{}
+	log.SetSinks(log.NewSink(`test`, log.DXLogFormatText, log.DXLogLevelWarn, b))
+	defer log.SetSinks()
+	release := make(chan struct{})
+	a, baseURL := startTestAPI(t, `test_load_shedding_warning`, utils.JSON{`max-in-flight-requests`: float64(1)}, func(a *DXAPI) {
+		newTestEndPoint(a, `/slow`, func(aepr *DXAPIEndPointRequest) (err error) {
+			<-release
+			return nil
+		})
+	})
+	defer close(release)
+	go func() {
+		response, err := http.Get(baseURL + `/slow`)
+		if err == nil {
+			_ = response.Body.Close()
+		}
+	}()
+	require.Eventually(t, func() bool {
+		return a.InFlightRequests() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		status, _ := getTestStatus(t, baseURL+`/slow`, nil)
+		assert.Equal(t, http.StatusServiceUnavailable, status)
+	}
+	assert.Equal(t, 1, strings.Count(b.String(), `requests shed`), b.String())
+	assert.Contains(t, b.String(), `1 requests shed, the last GET /slow`)
+	assert.Equal(t, int64(4), a.shedRequests.Load())
+
+	// the next warning, an interval later, counts the requests shed meanwhile
+	a.lastShedWarningAt.Store(time.Now().Add(-DXAPILoadSheddingWarningInterval).UnixNano())
+	status, _ := getTestStatus(t, baseURL+`/slow`, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, 2, strings.Count(b.String(), `requests shed`), b.String())
+	assert.Contains(t, b.String(), `5 requests shed, the last GET /slow`)
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	goRedis "github.com/go-redis/redis/v8"
+	"github.com/gofiber/fiber/v2"
+
+	"dxlib/v3/configurations"
+	"dxlib/v3/log"
+	"dxlib/v3/metrics"
+	"dxlib/v3/redis"
+	"dxlib/v3/utils"
+	utilsJSON "dxlib/v3/utils/json"
+)
+
+const (
+	DXAPIMaintenanceDefaultRedisKey           = `dxapi:maintenance`
+	DXAPIMaintenanceDefaultRetryAfterSec      = 60
+	DXAPIMaintenanceDefaultRefreshIntervalSec = 5
+	DXAPIMaintenanceDefaultMessage            = `The service is under maintenance`
+
+	DXAPIErrorCodeMaintenance = `MAINTENANCE`
+)
+
+// DXAPIMaintenance is the maintenance state of every API of the manager, also the JSON kept in the Redis key.
+type DXAPIMaintenance struct {
+	IsOn    bool   `json:"is_on"`
+	Message string `json:"message"`
+}
+
+// SetMaintenance turns the maintenance of this instance on or off, see SetMaintenanceClusterWide for all of them.
+func (am *DXAPIManager) SetMaintenance(on bool, message string) {
+	if on && message == `` {
+		message = DXAPIMaintenanceDefaultMessage
+	}
+	am.maintenanceMutex.Lock()
+	am.maintenance = DXAPIMaintenance{IsOn: on, Message: message}
+	am.maintenanceMutex.Unlock()
+	log.Log.Warnf("API maintenance is %v (%s)", on, message)
+}
+
+func (am *DXAPIManager) Maintenance() DXAPIMaintenance {
+	am.maintenanceMutex.RLock()
+	defer am.maintenanceMutex.RUnlock()
+	return am.maintenance
+}
+
+func (am *DXAPIManager) maintenanceRedis() (r *redis.DXRedis, err error) {
+	r, ok := redis.Manager.Redises[am.MaintenanceRedisNameId]
+	if !ok || !r.IsAvailable() {
+		err = log.Log.ErrorAndCreateErrorf("Redis %s of the API maintenance not found or not connected", am.MaintenanceRedisNameId)
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetMaintenanceClusterWide writes the maintenance in the Redis key read by every instance, then applies it here.
+func (am *DXAPIManager) SetMaintenanceClusterWide(ctx context.Context, on bool, message string) (err error) {
+	if am.MaintenanceRedisNameId == `` {
+		err = log.Log.ErrorAndCreateErrorf("API maintenance has no redis configured")
+		return err
+	}
+	r, err := am.maintenanceRedis()
+	if err != nil {
+		return err
+	}
+	if on && message == `` {
+		message = DXAPIMaintenanceDefaultMessage
+	}
+	valueAsBytes, err := json.Marshal(DXAPIMaintenance{IsOn: on, Message: message})
+	if err != nil {
+		return err
+	}
+	err = r.Connection.Set(ctx, am.MaintenanceRedisKey, valueAsBytes, 0).Err()
+	if err != nil {
+		return err
+	}
+	am.maintenanceMutex.Lock()
+	am.maintenanceLastSeen = string(valueAsBytes)
+	am.maintenanceMutex.Unlock()
+	am.SetMaintenance(on, message)
+	return nil
+}
+
+// refreshMaintenance applies the Redis key when it changed since the last read, so a SetMaintenance of this instance
+// stays until the key is written again. A missing key is the maintenance off.
+func (am *DXAPIManager) refreshMaintenance(ctx context.Context) (err error) {
+	r, err := am.maintenanceRedis()
+	if err != nil {
+		return err
+	}
+	valueAsString, err := r.Connection.Get(ctx, am.MaintenanceRedisKey).Result()
+	if errors.Is(err, goRedis.Nil) {
+		valueAsString, err = ``, nil
+	}
+	if err != nil {
+		return err
+	}
+	am.maintenanceMutex.Lock()
+	isChanged := valueAsString != am.maintenanceLastSeen
+	am.maintenanceLastSeen = valueAsString
+	am.maintenanceMutex.Unlock()
+	if !isChanged {
+		return nil
+	}
+	m := DXAPIMaintenance{}
+	if valueAsString != `` {
+		err = json.Unmarshal([]byte(valueAsString), &m)
+		if err != nil {
+			return err
+		}
+	}
+	am.SetMaintenance(m.IsOn, m.Message)
+	return nil
+}
+
+// applyMaintenanceConfiguration reads the "maintenance" block of the api configuration, so no API can be named
+// maintenance.
+func (am *DXAPIManager) applyMaintenanceConfiguration() {
+	am.MaintenanceRetryAfterSec = DXAPIMaintenanceDefaultRetryAfterSec
+	configuration, ok := configurations.Manager.Get("api")
+	if !ok {
+		return
+	}
+	c, ok := (*configuration.Data)[`maintenance`].(utils.JSON)
+	if !ok {
+		return
+	}
+	am.MaintenanceRedisNameId, _ = c[`redis`].(string)
+	am.MaintenanceRedisKey, _ = c[`redis_key`].(string)
+	if am.MaintenanceRedisKey == `` {
+		am.MaintenanceRedisKey = DXAPIMaintenanceDefaultRedisKey
+	}
+	am.MaintenanceRefreshIntervalSec = utilsJSON.GetNumberWithDefault(c, `refresh_interval_sec`, DXAPIMaintenanceDefaultRefreshIntervalSec)
+	am.MaintenanceRetryAfterSec = utilsJSON.GetNumberWithDefault(c, `retry_after_sec`, DXAPIMaintenanceDefaultRetryAfterSec)
+	isOn, _ := c[`is_on`].(bool)
+	if isOn {
+		message, _ := c[`message`].(string)
+		am.SetMaintenance(true, message)
+	}
+}
+
+// startMaintenanceWatch reads the Redis key of the maintenance every MaintenanceRefreshIntervalSec until the manager
+// context is done, a failed read keeps the current state.
+func (am *DXAPIManager) startMaintenanceWatch() {
+	if am.MaintenanceRedisNameId == `` {
+		return
+	}
+	interval := time.Duration(am.MaintenanceRefreshIntervalSec) * time.Second
+	if interval <= 0 {
+		interval = DXAPIMaintenanceDefaultRefreshIntervalSec * time.Second
+	}
+	am.ErrorGroup.Go(func() error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			err := am.refreshMaintenance(am.ErrorGroupContext)
+			if err != nil {
+				log.Log.Warnf("Cannot read the API maintenance from Redis %s key %s (%v)", am.MaintenanceRedisNameId, am.MaintenanceRedisKey, err)
+			}
+			select {
+			case <-am.ErrorGroupContext.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// maintenanceMiddleware answers 503 with Retry-After to every request while the maintenance is on, except the health,
+// readiness, info, metrics and debug routes, so the probes see the checks and the maintenance can be turned off through
+// /debug/maintenance.
+func (a *DXAPI) maintenanceMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		m := Manager.Maintenance()
+		if !m.IsOn {
+			return c.Next()
+		}
+		path := c.Path()
+		if path == DXAPIHealthPath || path == DXAPIReadyPath || path == DXAPIInfoPath || (metrics.Manager.IsEnabled && path == metrics.Manager.Path) ||
+			isPathMatched(path, []string{DXAPIDebugPath + `/*`}) {
+			return c.Next()
+		}
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(Manager.MaintenanceRetryAfterSec))
+		return WriteError(c, http.StatusServiceUnavailable, DXAPIErrorCodeMaintenance, m.Message, nil)
+	}
+}
+
+func (a *DXAPI) registerMaintenanceDebugRoute(g fiber.Router) {
+	g.Get(`/maintenance`, func(c *fiber.Ctx) error {
+		return WriteJSON(c, http.StatusOK, Manager.Maintenance())
+	})
+	g.Post(`/maintenance`, func(c *fiber.Ctx) error {
+		m := DXAPIMaintenance{}
+		err := json.Unmarshal(c.Body(), &m)
+		if err != nil {
+			return WriteError(c, http.StatusBadRequest, DXAPIErrorCodeValidationFailed, `Body must be {"is_on": bool, "message": string}`, nil)
+		}
+		if Manager.MaintenanceRedisNameId == `` {
+			Manager.SetMaintenance(m.IsOn, m.Message)
+		} else {
+			err = Manager.SetMaintenanceClusterWide(c.UserContext(), m.IsOn, m.Message)
+			if err != nil {
+				return WriteError(c, http.StatusInternalServerError, DXAPIErrorCodeInternal, `Cannot set the maintenance`, nil)
+			}
+		}
+		return WriteJSON(c, http.StatusOK, Manager.Maintenance())
+	})
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/redis"
+)
+
+// setTestMaintenanceRetryAfter sets the Retry-After of the maintenance, the maintenance is off again at the end of the
+// test.
+func setTestMaintenanceRetryAfter(t *testing.T, retryAfterSec int) {
+	t.Helper()
+	previous := Manager.MaintenanceRetryAfterSec
+	Manager.MaintenanceRetryAfterSec = retryAfterSec
+	t.Cleanup(func() {
+		Manager.MaintenanceRetryAfterSec = previous
+		Manager.SetMaintenance(false, ``)
+	})
+}
+
+func getTestPath(t *testing.T, baseURL string, path string) (response *http.Response, body string) {
+	t.Helper()
+	response, err := http.Get(baseURL + path)
+	require.NoError(t, err)
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	b, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	return response, string(b)
+}
+
+func TestMaintenanceAnswers503ExceptTheHealth(t *testing.T) {
+	setTestMaintenanceRetryAfter(t, 30)
+	_, baseURL := startTestAPI(t, `test-maintenance`, nil, func(a *DXAPI) {
+		newTestWhoEndPoint(a, `served`)
+	})
+
+	response, body := getTestPath(t, baseURL, `/who`)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, `served`, body)
+
+	Manager.SetMaintenance(true, `Upgrading the database`)
+	response, body = getTestPath(t, baseURL, `/who`)
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+	assert.Equal(t, `30`, response.Header.Get(`Retry-After`))
+	assert.Contains(t, body, DXAPIErrorCodeMaintenance)
+	assert.Contains(t, body, `Upgrading the database`)
+	response, _ = getTestPath(t, baseURL, DXAPIHealthPath)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	Manager.SetMaintenance(false, ``)
+	response, _ = getTestPath(t, baseURL, `/who`)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+}
+
+func TestMaintenanceIsTurnedOffThroughTheDebugRoute(t *testing.T) {
+	setTestMaintenanceRetryAfter(t, 30)
+	isDebug, debugKey := Manager.IsDebug, Manager.DebugKey
+	Manager.IsDebug, Manager.DebugKey = true, `key`
+	t.Cleanup(func() {
+		Manager.IsDebug, Manager.DebugKey = isDebug, debugKey
+	})
+	_, baseURL := startTestAPI(t, `test-maintenance-debug`, nil, func(a *DXAPI) {
+		newTestWhoEndPoint(a, `served`)
+	})
+	Manager.SetMaintenance(true, ``)
+
+	statusCode, body := getTestDebug(t, baseURL, `/maintenance`, `key`)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Contains(t, body, DXAPIMaintenanceDefaultMessage)
+
+	req, err := http.NewRequest(http.MethodPost, baseURL+DXAPIDebugPath+`/maintenance`, strings.NewReader(`{"is_on": false}`))
+	require.NoError(t, err)
+	req.Header.Set(DXAPIDebugKeyHeader, `key`)
+	response, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_ = response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.False(t, Manager.Maintenance().IsOn)
+	response, _ = getTestPath(t, baseURL, `/who`)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+}
+
+func TestMaintenanceIsReadFromRedis(t *testing.T) {
+	setTestMaintenanceRetryAfter(t, 30)
+	m := miniredis.RunT(t)
+	r := redis.Manager.NewRedis(`test-maintenance`, false, false)
+	r.Address = m.Addr()
+	r.IsConfigured = true
+	require.NoError(t, r.Connect())
+	redisNameId, redisKey := Manager.MaintenanceRedisNameId, Manager.MaintenanceRedisKey
+	Manager.MaintenanceRedisNameId, Manager.MaintenanceRedisKey = r.NameId, DXAPIMaintenanceDefaultRedisKey
+	t.Cleanup(func() {
+		Manager.MaintenanceRedisNameId, Manager.MaintenanceRedisKey = redisNameId, redisKey
+		Manager.maintenanceLastSeen = ``
+		_ = r.Disconnect()
+		delete(redis.Manager.Redises, r.NameId)
+	})
+
+	require.NoError(t, Manager.SetMaintenanceClusterWide(context.Background(), true, `Cluster maintenance`))
+	assert.True(t, Manager.Maintenance().IsOn)
+	stored, err := m.Get(DXAPIMaintenanceDefaultRedisKey)
+	require.NoError(t, err)
+	var v DXAPIMaintenance
+	require.NoError(t, json.Unmarshal([]byte(stored), &v))
+	assert.Equal(t, DXAPIMaintenance{IsOn: true, Message: `Cluster maintenance`}, v)
+
+	// another instance turning it off
+	m.Del(DXAPIMaintenanceDefaultRedisKey)
+	require.NoError(t, Manager.refreshMaintenance(context.Background()))
+	assert.False(t, Manager.Maintenance().IsOn)
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"dxlib/v3/core"
+	"dxlib/v3/log"
+	"dxlib/v3/metrics"
+)
+
+// The responses written by WriteJSON and WriteError use the envelopes
+//
+//	{"data": <payload>}
+//	{"error": {"code": <code>, "message": <message>, "details": <details>}}
+//
+// code is a stable upper snake case identifier to branch on, like "UNAUTHORIZED" or "VALIDATION_FAILED", message is
+// for humans and details, omitted when nil, carries the machine readable specifics like the invalid parameters.
+
+const (
+	DXAPIErrorCodeInternal         = `INTERNAL_ERROR`
+	DXAPIErrorCodeValidationFailed = `VALIDATION_FAILED`
+	DXAPIErrorCodeUnauthorized     = `UNAUTHORIZED`
+)
+
+type DXAPIErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+}
+
+type dxAPIErrorEnvelope struct {
+	Error DXAPIErrorBody `json:"error"`
+}
+
+type dxAPIDataEnvelope struct {
+	Data any `json:"data"`
+}
+
+func errorEnvelopeAsBytes(code string, message string, details any) (b []byte, err error) {
+	return jsonCodec().Marshal(dxAPIErrorEnvelope{Error: DXAPIErrorBody{Code: code, Message: message, Details: details}})
+}
+
+// errorCodeOfStatus is the code of the error envelope written when an end point fails without a response body.
+func errorCodeOfStatus(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return DXAPIErrorCodeUnauthorized
+	case http.StatusUnprocessableEntity:
+		return DXAPIErrorCodeValidationFailed
+	}
+	if status >= http.StatusInternalServerError {
+		return DXAPIErrorCodeInternal
+	}
+	return strings.ToUpper(strings.ReplaceAll(http.StatusText(status), ` `, `_`))
+}
+
+// WriteJSON writes payload in the data envelope, for the fiber handlers outside of an end point, like the middlewares.
+func WriteJSON(c *fiber.Ctx, status int, payload any) (err error) {
+	b, err := jsonCodec().Marshal(dxAPIDataEnvelope{Data: payload})
+	if err != nil {
+		log.Log.Errorf("Cannot marshal the response of %s (%v)", c.Path(), err)
+		return WriteError(c, http.StatusInternalServerError, DXAPIErrorCodeInternal, `Internal error`, nil)
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+	return c.Status(status).Send(b)
+}
+
+// WriteError writes the error envelope, a status of 500 and above is also logged.
+func WriteError(c *fiber.Ctx, status int, code string, message string, details any) (err error) {
+	if status >= http.StatusInternalServerError {
+		log.Log.Errorf("%d %s at %s: %s", status, code, c.Path(), message)
+	}
+	b, err := errorEnvelopeAsBytes(code, message, details)
+	if err != nil {
+		log.Log.Errorf("Cannot marshal the error details of %s (%v)", c.Path(), err)
+		b, _ = errorEnvelopeAsBytes(code, message, nil)
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+	return c.Status(status).Send(b)
+}
+
+// WriteJSON sets the response of the end point to payload in the data envelope.
+func (aepr *DXAPIEndPointRequest) WriteJSON(status int, payload any) (err error) {
+	b, err := jsonCodec().Marshal(dxAPIDataEnvelope{Data: payload})
+	if err != nil {
+		aepr.Log.Errorf("Cannot marshal the response (%v)", err)
+		return aepr.WriteError(http.StatusInternalServerError, DXAPIErrorCodeInternal, `Internal error`, nil)
+	}
+	aepr.FiberContext.Response().Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+	aepr.ResponseStatusCode = status
+	aepr.ResponseBodyAsBytes = b
+	return nil
+}
+
+// WriteError sets the response of the end point to the error envelope, a status of 500 and above is also logged.
+func (aepr *DXAPIEndPointRequest) WriteError(status int, code string, message string, details any) (err error) {
+	if status >= http.StatusInternalServerError {
+		aepr.Log.Errorf("%d %s: %s", status, code, message)
+	}
+	b, err := errorEnvelopeAsBytes(code, message, details)
+	if err != nil {
+		aepr.Log.Errorf("Cannot marshal the error details (%v)", err)
+		b, _ = errorEnvelopeAsBytes(code, message, nil)
+	}
+	aepr.FiberContext.Response().Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+	aepr.ResponseStatusCode = status
+	aepr.ResponseErrorAsString = message
+	aepr.ResponseBodyAsBytes = b
+	return nil
+}
+
+// RecoverMiddleware turns a panic of the next handlers into a 500 error envelope and logs the stack trace, with
+// core.PanicPolicyCrash it panics again once logged.
+func RecoverMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) (err error) {
+		defer func() {
+			r := recover()
+			if r != nil {
+				log.Log.Errorf("Panic at %s %s (%v)\n%s", c.Method(), c.Path(), r, debug.Stack())
+				metrics.Manager.ObservePanic(`api`)
+				if core.IsPanicCrash() {
+					panic(r)
+				}
+				c.Response().ResetBody()
+				err = WriteError(c, http.StatusInternalServerError, DXAPIErrorCodeInternal, `Internal error`, nil)
+			}
+		}()
+		return c.Next()
+	}
+}
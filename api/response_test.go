@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/core"
+	"dxlib/v3/metrics"
+)
+
+// setTestPanicPolicy sets core.PanicPolicy to p and enables the metrics until the end of the test.
+func setTestPanicPolicy(t *testing.T, p core.DXPanicPolicy) {
+	t.Helper()
+	panicPolicy, isEnabled := core.PanicPolicy, metrics.Manager.IsEnabled
+	core.PanicPolicy, metrics.Manager.IsEnabled = p, true
+	t.Cleanup(func() {
+		core.PanicPolicy, metrics.Manager.IsEnabled = panicPolicy, isEnabled
+	})
+}
+
+// testPanicTotal gives the dxlib_panic_total of scope.
+func testPanicTotal(t *testing.T, scope string) (total float64) {
+	t.Helper()
+	families, err := metrics.Manager.Registry.Gather()
+	require.NoError(t, err)
+	for _, f := range families {
+		if f.GetName() != `dxlib_panic_total` {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == `scope` && l.GetValue() == scope {
+					total += m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return total
+}
+
+// newTestPanickingApp serves a handler panicking with boom behind RecoverMiddleware, a panic going past it is kept in
+// repanicked instead of crashing the test.
+func newTestPanickingApp(repanicked *any) *fiber.App {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) (err error) {
+		defer func() {
+			*repanicked = recover()
+			if *repanicked != nil {
+				err = c.SendStatus(http.StatusTeapot)
+			}
+		}()
+		return c.Next()
+	})
+	app.Use(RecoverMiddleware())
+	app.Get(`/panic`, func(c *fiber.Ctx) error {
+		_ = c.SendString(`partial`)
+		panic(`boom`)
+	})
+	return app
+}
+
+func TestPanicPolicyOfTheHTTPScope(t *testing.T) {
+	b := captureTestLog(t)
+	var repanicked any
+	app := newTestPanickingApp(&repanicked)
+
+	setTestPanicPolicy(t, core.PanicPolicyRecover)
+	total := testPanicTotal(t, `api`)
+	response, err := app.Test(httptest.NewRequest(http.MethodGet, `/panic`, nil), -1)
+	require.NoError(t, err)
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, response.StatusCode)
+	var envelope dxAPIErrorEnvelope
+	require.NoError(t, json.Unmarshal(body, &envelope))
+	assert.Equal(t, DXAPIErrorCodeInternal, envelope.Error.Code)
+	assert.NotContains(t, string(body), `partial`)
+	assert.Nil(t, repanicked)
+	assert.Equal(t, total+1, testPanicTotal(t, `api`))
+
+	core.PanicPolicy = core.PanicPolicyCrash
+	response, err = app.Test(httptest.NewRequest(http.MethodGet, `/panic`, nil), -1)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTeapot, response.StatusCode)
+	assert.Equal(t, `boom`, repanicked)
+	assert.Equal(t, total+2, testPanicTotal(t, `api`))
+	// both are logged with their stack before
+	assert.Equal(t, 2, strings.Count(b.String(), `Panic at GET /panic (boom)`))
+	assert.Equal(t, 2, strings.Count(b.String(), `[running]`))
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startTestSlowAPI serves GET /slow answering a body of 1 MB after delay, isStarted is closed once a request runs.
+func startTestSlowAPI(t *testing.T, delay time.Duration) (a *DXAPI, baseURL string, isStarted chan struct{}) {
+	t.Helper()
+	isStarted = make(chan struct{})
+	a, baseURL = startTestAPI(t, `test_shutdown`, nil, func(a *DXAPI) {
+		newTestEndPoint(a, `/slow`, func(aepr *DXAPIEndPointRequest) (err error) {
+			close(isStarted)
+			time.Sleep(delay)
+			aepr.ResponseStatusCode = http.StatusOK
+			aepr.ResponseBodyAsBytes = bytes.Repeat([]byte(`a`), 1<<20)
+			return nil
+		})
+	})
+	return a, baseURL, isStarted
+}
+
+type testResponse struct {
+	statusCode int
+	body       []byte
+	err        error
+}
+
+// getTestAsync sends GET url, its response is given on the channel.
+func getTestAsync(url string) <-chan testResponse {
+	responses := make(chan testResponse, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			responses <- testResponse{err: err}
+			return
+		}
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		body, err := io.ReadAll(resp.Body)
+		responses <- testResponse{statusCode: resp.StatusCode, body: body, err: err}
+	}()
+	return responses
+}
+
+func TestShutdownDrainsTheRequestsInFlight(t *testing.T) {
+	a, baseURL, isStarted := startTestSlowAPI(t, 500*time.Millisecond)
+	responses := getTestAsync(baseURL + `/slow`)
+	<-isStarted
+
+	require.NoError(t, a.StartShutdown())
+	r := <-responses
+	require.NoError(t, r.err)
+	assert.Equal(t, http.StatusOK, r.statusCode)
+	assert.Equal(t, 1<<20, len(r.body))
+
+	// no new connection once stopped
+	_, err := http.Get(baseURL + `/slow`)
+	assert.Error(t, err)
+}
+
+func TestShutdownForceClosesAfterTheDeadline(t *testing.T) {
+	b := captureTestLog(t)
+	shutdownTimeout := Manager.ShutdownTimeout
+	Manager.ShutdownTimeout = 100 * time.Millisecond
+	t.Cleanup(func() {
+		Manager.ShutdownTimeout = shutdownTimeout
+	})
+	a, baseURL, isStarted := startTestSlowAPI(t, 2*time.Second)
+	responses := getTestAsync(baseURL + `/slow`)
+	<-isStarted
+
+	start := time.Now()
+	require.NoError(t, a.StartShutdown())
+	assert.Less(t, time.Since(start), time.Second)
+	r := <-responses
+	assert.Error(t, r.err)
+	assert.True(t, strings.Contains(b.String(), `force closed 1 connection(s)`), b.String())
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const DXAPISSEKeepAliveInterval = 15 * time.Second
+
+// SSEEvent is written as the id, event and data fields of a Server-Sent Event, Id and Event are omitted when empty and
+// every line of Data is its own data field.
+type SSEEvent struct {
+	Id    string
+	Event string
+	Data  string
+}
+
+// LastEventID is the id of the last event received by a reconnecting client, to resume the stream after it.
+func LastEventID(c *fiber.Ctx) string {
+	return c.Get(`Last-Event-ID`)
+}
+
+func sseFieldValue(s string) string {
+	return strings.NewReplacer("\r", ``, "\n", ``).Replace(s)
+}
+
+func writeSSEEvent(w *bufio.Writer, e SSEEvent) (err error) {
+	s := strings.Builder{}
+	if e.Id != `` {
+		s.WriteString(`id: ` + sseFieldValue(e.Id) + "\n")
+	}
+	if e.Event != `` {
+		s.WriteString(`event: ` + sseFieldValue(e.Event) + "\n")
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(e.Data, "\r\n", "\n"), "\n") {
+		s.WriteString(`data: ` + line + "\n")
+	}
+	s.WriteString("\n")
+	_, err = w.WriteString(s.String())
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// WriteSSE streams events to the client as text/event-stream, flushing every event and a keepalive comment every
+// DXAPISSEKeepAliveInterval. It returns at once, the stream is written after the handler returns and ends when events is
+// closed, ctx is done or the client disconnects (the failed flush). The write timeout of the API also bounds the stream.
+func WriteSSE(c *fiber.Ctx, ctx context.Context, events <-chan SSEEvent) {
+	writeSSE(c, ctx, events, func() {})
+}
+
+// writeSSE is WriteSSE running done once the stream ends.
+func writeSSE(c *fiber.Ctx, ctx context.Context, events <-chan SSEEvent, done func()) {
+	c.Set(fiber.HeaderContentType, `text/event-stream`)
+	c.Set(fiber.HeaderCacheControl, `no-cache`)
+	c.Set(fiber.HeaderConnection, `keep-alive`)
+	c.Set(`X-Accel-Buffering`, `no`)
+	c.Status(http.StatusOK)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer done()
+		// the headers only go out with the first flushed bytes
+		_, err := w.WriteString(": connected\n\n")
+		if err != nil || w.Flush() != nil {
+			return
+		}
+		ticker := time.NewTicker(DXAPISSEKeepAliveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e, ok := <-events:
+				if !ok {
+					return
+				}
+				if writeSSEEvent(w, e) != nil {
+					return
+				}
+			case <-ticker.C:
+				_, err := w.WriteString(": keepalive\n\n")
+				if err != nil || w.Flush() != nil {
+					return
+				}
+			}
+		}
+	})
+}
+
+// WriteSSE makes the response of the end point the stream of events, see WriteSSE. aepr.Context stays alive until the
+// stream ends, it is cancelled when the client disconnects, so it can be given as ctx.
+func (aepr *DXAPIEndPointRequest) WriteSSE(ctx context.Context, events <-chan SSEEvent) {
+	aepr.ResponseStatusCode = http.StatusOK
+	aepr.ResponseBodyAsBytes = nil
+	writeSSE(aepr.FiberContext, ctx, events, aepr.takeContextCancel())
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readSSEData gives the data fields of the first n events of body.
+func readSSEData(t *testing.T, body *bufio.Reader, n int) (data []string) {
+	t.Helper()
+	for len(data) < n {
+		line, err := body.ReadString('\n')
+		require.NoError(t, err, "events read %v", data)
+		if strings.HasPrefix(line, `data: `) {
+			data = append(data, strings.TrimSuffix(strings.TrimPrefix(line, `data: `), "\n"))
+		}
+	}
+	return data
+}
+
+func TestWriteSSEStreamsEventsOverHTTP(t *testing.T) {
+	_, baseURL := startTestAPI(t, `test_sse`, nil, func(a *DXAPI) {
+		newTestEndPoint(a, `/events`, func(aepr *DXAPIEndPointRequest) (err error) {
+			events := make(chan SSEEvent, 2)
+			events <- SSEEvent{Id: `1`, Event: `tick`, Data: `first`}
+			events <- SSEEvent{Id: `2`, Event: `tick`, Data: `second`}
+			close(events)
+			aepr.WriteSSE(context.Background(), events)
+			return nil
+		})
+	})
+	response, err := http.Get(baseURL + `/events`)
+	require.NoError(t, err)
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, `text/event-stream`, response.Header.Get(`Content-Type`))
+	assert.Equal(t, []string{`first`, `second`}, readSSEData(t, bufio.NewReader(response.Body), 2))
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+
+	"dxlib/v3/databases"
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+	utilsJSON "dxlib/v3/utils/json"
+)
+
+const (
+	DXAPITenantDefaultHeader = `X-Tenant-Id`
+
+	DXAPIErrorCodeTenantRequired = `TENANT_REQUIRED`
+)
+
+const tenantIdLocalsKey = `api_tenant_id`
+
+type DXAPITenantConfiguration struct {
+	Header string
+	// Claim is the claim of the token holding the tenant id, when set the header is not read, a client can not pick
+	// another tenant than the one of its token
+	Claim       string
+	IsMandatory bool
+	// ExcludePaths are the request paths, or path prefixes ending with "*", served without a tenant
+	ExcludePaths []string
+}
+
+// TenantConfigurationFromJSON reads the "tenant" block of an api configuration.
+func TenantConfigurationFromJSON(c utils.JSON) (r *DXAPITenantConfiguration, err error) {
+	r = &DXAPITenantConfiguration{}
+	r.Header, _ = c[`header`].(string)
+	if r.Header == `` {
+		r.Header = DXAPITenantDefaultHeader
+	}
+	r.Claim, _ = c[`claim`].(string)
+	r.IsMandatory, _ = c[`is_mandatory`].(bool)
+	r.ExcludePaths, _ = utilsJSON.GetStrings(c, `exclude_paths`)
+	return r, nil
+}
+
+// NewTenantMiddleware puts the tenant id of the request in its context for databases.Manager.WriteDBForTenant,
+// ReadDBForTenant and TxForTenant. With IsMandatory a request without one is answered with 400.
+func NewTenantMiddleware(c DXAPITenantConfiguration) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if isPathMatched(ctx.Path(), c.ExcludePaths) {
+			return ctx.Next()
+		}
+		tenantId := ``
+		if c.Claim != `` {
+			claims, _ := ctx.Locals(claimsLocalsKey).(utils.JSON)
+			if v, ok := claims[c.Claim]; ok && v != nil {
+				tenantId = fmt.Sprint(v)
+			}
+		} else {
+			tenantId = ctx.Get(c.Header)
+		}
+		if tenantId == `` {
+			if c.IsMandatory {
+				return WriteError(ctx, http.StatusBadRequest, DXAPIErrorCodeTenantRequired, `The tenant of the request is required`, nil)
+			}
+			return ctx.Next()
+		}
+		ctx.Locals(tenantIdLocalsKey, tenantId)
+		ctx.SetUserContext(databases.ContextWithTenantId(ctx.UserContext(), tenantId))
+		return ctx.Next()
+	}
+}
+
+func contextWithTenantId(ctx context.Context, c *fiber.Ctx) context.Context {
+	tenantId, ok := c.Locals(tenantIdLocalsKey).(string)
+	if !ok {
+		return ctx
+	}
+	return databases.ContextWithTenantId(ctx, tenantId)
+}
+
+func (a *DXAPI) applyTenantConfiguration(c1 utils.JSON) (err error) {
+	c, ok := c1[`tenant`].(utils.JSON)
+	if !ok {
+		return nil
+	}
+	a.Tenant, err = TenantConfigurationFromJSON(c)
+	if err != nil {
+		return err
+	}
+	if a.Tenant.Claim != `` && a.Auth == nil {
+		err = log.Log.ErrorAndCreateErrorf("Configuration 'api.%s/tenant/claim' needs the auth", a.NameId)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"dxlib/v3/log"
+)
+
+const DXAPIErrorCodeTimeout = `TIMEOUT`
+
+// Timeout gives the next handlers a context done after d, also the Context of the end point request, so the queries
+// and the calls made with it are aborted at the deadline. A request still running past d is answered with 504 once
+// the handler returns, its response is dropped. The handler runs on the fiber goroutine, it is not abandoned, so it
+// must return when its context is done. Nested timeouts keep the shortest deadline.
+func Timeout(d time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(c.UserContext(), d)
+		defer cancel()
+		c.SetUserContext(ctx)
+		err := c.Next()
+		// the handler context has the same deadline on its own timer, it may be done before ctx is
+		deadline, _ := ctx.Deadline()
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) && time.Now().Before(deadline) {
+			return err
+		}
+		log.Log.Warnf("Request %s %s exceeded its timeout of %v (%v)", c.Method(), c.Path(), d, err)
+		c.Response().ResetBody()
+		return WriteError(c, http.StatusGatewayTimeout, DXAPIErrorCodeTimeout, `The request timed out`, nil)
+	}
+}
+
+// UseOnEndPoint adds middlewares run before the handler of the end point of uri only, like Timeout, it must be called
+// before StartAll. It fails when the API has no end point of uri.
+func (a *DXAPI) UseOnEndPoint(uri string, middlewares ...fiber.Handler) (err error) {
+	for i := range a.EndPoints {
+		if a.EndPoints[i].Uri == uri {
+			a.EndPoints[i].Middlewares = append(a.EndPoints[i].Middlewares, middlewares...)
+			return nil
+		}
+	}
+	return fmt.Errorf("EndPointNotFound:%s", uri)
+}
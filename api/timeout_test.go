@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeoutAnswers504AndCancelsTheHandler(t *testing.T) {
+	handlerErrs := make(chan error, 1)
+	_, baseURL := startTestAPI(t, `test_timeout`, nil, func(a *DXAPI) {
+		newTestEndPoint(a, `/slow`, func(aepr *DXAPIEndPointRequest) (err error) {
+			select {
+			case <-aepr.Context.Done():
+				handlerErrs <- aepr.Context.Err()
+			case <-time.After(5 * time.Second):
+				handlerErrs <- nil
+			}
+			return aepr.WriteJSON(http.StatusOK, `too late`)
+		})
+		newTestEndPoint(a, `/fast`, func(aepr *DXAPIEndPointRequest) (err error) {
+			return aepr.WriteJSON(http.StatusOK, `in time`)
+		})
+		require.NoError(t, a.UseOnEndPoint(`/slow`, Timeout(50*time.Millisecond)))
+		require.NoError(t, a.UseOnEndPoint(`/fast`, Timeout(time.Second)))
+	})
+
+	startTime := time.Now()
+	response, err := http.Get(baseURL + `/slow`)
+	require.NoError(t, err)
+	body, err := io.ReadAll(response.Body)
+	_ = response.Body.Close()
+	require.NoError(t, err)
+	assert.Less(t, time.Since(startTime), 5*time.Second)
+	assert.Equal(t, http.StatusGatewayTimeout, response.StatusCode)
+	var envelope dxAPIErrorEnvelope
+	require.NoError(t, json.Unmarshal(body, &envelope))
+	assert.Equal(t, DXAPIErrorCodeTimeout, envelope.Error.Code)
+	assert.NotContains(t, string(body), `too late`)
+	assert.ErrorIs(t, <-handlerErrs, context.DeadlineExceeded)
+
+	// the budget is of the route
+	response, err = http.Get(baseURL + `/fast`)
+	require.NoError(t, err)
+	_ = response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+}
+
+func TestUseOnEndPointOfAnUnknownUri(t *testing.T) {
+	a := &DXAPI{}
+	newTestEndPoint(a, `/known`, nil)
+
+	assert.NoError(t, a.UseOnEndPoint(`/known`, Timeout(time.Second)))
+	assert.EqualError(t, a.UseOnEndPoint(`/unknown`, Timeout(time.Second)), `EndPointNotFound:/unknown`)
+	assert.Len(t, a.EndPoints[0].Middlewares, 1)
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"dxlib/v3/utils"
+	"dxlib/v3/utils/json"
+)
+
+type DXAPITLSConfiguration struct {
+	CertFile string
+	KeyFile  string
+	// ReloadCheckIntervalSec is how often the files are checked for a new certificate, like the ones of a secret
+	// rotated by cert-manager, a reload also happens on ReloadCertificate. Not above 0 disables it
+	ReloadCheckIntervalSec int
+}
+
+// TLSConfigurationFromJSON reads the "tls" block of an api configuration.
+func TLSConfigurationFromJSON(c utils.JSON) (r *DXAPITLSConfiguration, err error) {
+	r = &DXAPITLSConfiguration{
+		ReloadCheckIntervalSec: json.GetNumberWithDefault(c, `reload_check_interval_sec`, 0),
+	}
+	r.CertFile, _ = c[`cert_file`].(string)
+	r.KeyFile, _ = c[`key_file`].(string)
+	if r.CertFile == `` || r.KeyFile == `` {
+		return nil, errors.New("TLSConfigurationWithoutCertFileOrKeyFile")
+	}
+	return r, nil
+}
+
+func (a *DXAPI) applyTLSConfiguration(c1 utils.JSON, unusable func(text string, v ...any) error) (err error) {
+	c, ok := c1[`tls`].(utils.JSON)
+	if !ok {
+		a.TLS = nil
+		return nil
+	}
+	a.TLS, err = TLSConfigurationFromJSON(c)
+	if err != nil {
+		err = unusable("Configuration 'api.%s/tls' is unusable (%v)", a.NameId, err)
+		return err
+	}
+	return nil
+}
+
+// LoadCertificate reads the certificate of certFile and its key of keyFile, failing when they do not match or the
+// certificate is not valid now.
+func LoadCertificate(certFile string, keyFile string) (cert *tls.Certificate, err error) {
+	c, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if c.Leaf == nil {
+		c.Leaf, err = x509.ParseCertificate(c.Certificate[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	if now.Before(c.Leaf.NotBefore) || now.After(c.Leaf.NotAfter) {
+		return nil, fmt.Errorf("CertificateNotValidNow:%s:%s:%s", certFile, c.Leaf.NotBefore.Format(time.RFC3339), c.Leaf.NotAfter.Format(time.RFC3339))
+	}
+	return &c, nil
+}
+
+// ReloadCertificate reads the certificate of TLS again and serves it on the new connections, the open ones keep the
+// one of their handshake. An unusable certificate is not swapped in, the current one is kept.
+func (a *DXAPI) ReloadCertificate() (err error) {
+	if a.TLS == nil {
+		return nil
+	}
+	cert, err := LoadCertificate(a.TLS.CertFile, a.TLS.KeyFile)
+	if err != nil {
+		a.Log.Errorf("Cannot reload the certificate %s, keeping the current one (%v)", a.TLS.CertFile, err)
+		return err
+	}
+	a.certificate.Store(cert)
+	a.Log.Infof("Certificate %s reloaded, valid until %s", a.TLS.CertFile, cert.Leaf.NotAfter.Format(time.RFC3339))
+	return nil
+}
+
+// Certificate is the certificate served on the new connections, nil when the API is not served over TLS.
+func (a *DXAPI) Certificate() *tls.Certificate {
+	return a.certificate.Load()
+}
+
+// tlsListener serves l over TLS with the current certificate of the API at each handshake.
+func (a *DXAPI) tlsListener(l net.Listener) net.Listener {
+	return tls.NewListener(l, &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return a.certificate.Load(), nil
+		},
+	})
+}
+
+// watchCertificateFiles reloads the certificate when its files change, every ReloadCheckIntervalSec until the API
+// context is done.
+func (a *DXAPI) watchCertificateFiles() {
+	if a.TLS == nil || a.TLS.ReloadCheckIntervalSec <= 0 {
+		return
+	}
+	modTimes := func() (r [2]time.Time) {
+		for i, v := range []string{a.TLS.CertFile, a.TLS.KeyFile} {
+			fi, err := os.Stat(v)
+			if err == nil {
+				r[i] = fi.ModTime()
+			}
+		}
+		return r
+	}
+	last := modTimes()
+	go func() {
+		ticker := time.NewTicker(time.Duration(a.TLS.ReloadCheckIntervalSec) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-a.Context.Done():
+				return
+			case <-ticker.C:
+			}
+			current := modTimes()
+			if current == last {
+				continue
+			}
+			// a failed reload, like of a key not written yet, is tried again at the next change
+			last = current
+			_ = a.ReloadCertificate()
+		}
+	}()
+}
+
+// ReloadCertificate reloads the certificate of every API served over TLS, see DXAPI.ReloadCertificate.
+func (am *DXAPIManager) ReloadCertificate() (err error) {
+	var errs []error
+	for _, v := range am.APIs {
+		if v.TLS == nil {
+			continue
+		}
+		errs = append(errs, v.ReloadCertificate())
+	}
+	return errors.Join(errs...)
+}
+
+// IsTLS tells an API is served over TLS.
+func (am *DXAPIManager) IsTLS() bool {
+	for _, v := range am.APIs {
+		if v.TLS != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/utils"
+)
+
+// writeTestCertificate writes a self-signed certificate of commonName valid from notBefore to notAfter and its key to
+// certFile and keyFile.
+func writeTestCertificate(t *testing.T, certFile string, keyFile string, commonName string, notBefore time.Time, notAfter time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{`localhost`},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: `CERTIFICATE`, Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: `EC PRIVATE KEY`, Bytes: keyDer}), 0o600))
+}
+
+// startTestTLSAPI starts an API served over TLS with a certificate of commonName, reloaded every reloadCheckIntervalSec.
+func startTestTLSAPI(t *testing.T, commonName string, reloadCheckIntervalSec float64) (a *DXAPI, certFile string, keyFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, `tls.crt`), filepath.Join(dir, `tls.key`)
+	writeTestCertificate(t, certFile, keyFile, commonName, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	a, _ = startTestAPI(t, `test_tls`, utils.JSON{`tls`: utils.JSON{
+		`cert_file`:                 certFile,
+		`key_file`:                  keyFile,
+		`reload_check_interval_sec`: reloadCheckIntervalSec,
+	}}, func(a *DXAPI) {
+		newTestWhoEndPoint(a, `tls`)
+	})
+	return a, certFile, keyFile
+}
+
+// dialTestTLS makes a handshake with a, giving the connection and the common name of the certificate it was served.
+func dialTestTLS(t *testing.T, a *DXAPI) (conn *tls.Conn, commonName string) {
+	t.Helper()
+	conn, err := tls.Dial(`tcp`, a.Listener.Addr().String(), &tls.Config{InsecureSkipVerify: true, ServerName: `localhost`})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return conn, conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+// getTestWho sends GET /who on conn, a connection kept alive.
+func getTestWho(t *testing.T, conn *tls.Conn, r *bufio.Reader) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, `https://localhost/who`, nil)
+	require.NoError(t, err)
+	require.NoError(t, req.Write(conn))
+	resp, err := http.ReadResponse(r, req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestReloadCertificateServesTheNewHandshakes(t *testing.T) {
+	a, certFile, keyFile := startTestTLSAPI(t, `first`, 0)
+	open, commonName := dialTestTLS(t, a)
+	assert.Equal(t, `first`, commonName)
+	openReader := bufio.NewReader(open)
+	getTestWho(t, open, openReader)
+
+	writeTestCertificate(t, certFile, keyFile, `second`, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	require.NoError(t, Manager.ReloadCertificate())
+	assert.Equal(t, `second`, a.Certificate().Leaf.Subject.CommonName)
+
+	_, commonName = dialTestTLS(t, a)
+	assert.Equal(t, `second`, commonName)
+	// the open connection keeps the certificate of its handshake and is still served
+	assert.Equal(t, `first`, open.ConnectionState().PeerCertificates[0].Subject.CommonName)
+	getTestWho(t, open, openReader)
+}
+
+func TestReloadCertificateKeepsTheCurrentOneWhenUnusable(t *testing.T) {
+	a, certFile, keyFile := startTestTLSAPI(t, `first`, 0)
+
+	writeTestCertificate(t, certFile, keyFile, `expired`, time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour))
+	err := a.ReloadCertificate()
+	assert.ErrorContains(t, err, `CertificateNotValidNow`)
+	_, commonName := dialTestTLS(t, a)
+	assert.Equal(t, `first`, commonName)
+
+	// a key of another certificate
+	otherDir := t.TempDir()
+	writeTestCertificate(t, certFile, filepath.Join(otherDir, `tls.key`), `second`, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	writeTestCertificate(t, filepath.Join(otherDir, `tls.crt`), keyFile, `third`, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	assert.Error(t, a.ReloadCertificate())
+	_, commonName = dialTestTLS(t, a)
+	assert.Equal(t, `first`, commonName)
+}
+
+func TestCertificateFilesAreWatched(t *testing.T) {
+	a, certFile, keyFile := startTestTLSAPI(t, `first`, float64(1))
+
+	writeTestCertificate(t, certFile, keyFile, `second`, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	require.Eventually(t, func() bool {
+		return a.Certificate().Leaf.Subject.CommonName == `second`
+	}, 5*time.Second, 50*time.Millisecond)
+	_, commonName := dialTestTLS(t, a)
+	assert.Equal(t, `second`, commonName)
+}
+
+func TestTLSConfigurationFromJSON(t *testing.T) {
+	c, err := TLSConfigurationFromJSON(utils.JSON{`cert_file`: `a.crt`, `key_file`: `a.key`, `reload_check_interval_sec`: float64(30)})
+	require.NoError(t, err)
+	assert.Equal(t, &DXAPITLSConfiguration{CertFile: `a.crt`, KeyFile: `a.key`, ReloadCheckIntervalSec: 30}, c)
+	_, err = TLSConfigurationFromJSON(utils.JSON{`cert_file`: `a.crt`})
+	assert.Error(t, err)
+}
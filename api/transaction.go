@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+
+	"dxlib/v3/databases"
+	"dxlib/v3/log"
+)
+
+const txLocalsKey = `api_tx`
+
+// Transaction runs the next handlers in one transaction of the database databaseNameId, found by
+// databases.TxFromContext in the Context of the end point request. It is committed when the response status is 2xx and
+// rolled back otherwise, or on an error or a panic of the handlers, the panic going on to RecoverMiddleware. A commit
+// failing turns the response into a 500. It is opt-in, added to a route by UseOnEndPoint.
+func Transaction(databaseNameId string, isolationLevel sql.IsolationLevel) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		d, ok := databases.Manager.Databases[databaseNameId]
+		if !ok {
+			log.Log.Errorf("Database %s of the transaction of %s %s not found", databaseNameId, c.Method(), c.Path())
+			return WriteError(c, http.StatusInternalServerError, DXAPIErrorCodeInternal, `Internal error`, nil)
+		}
+		l := log.NewLog(&log.Log, c.UserContext(), c.Method()+" "+c.Path())
+		var panicValue any
+		var errNext error
+		isRolledBack := false
+		isHandled := false
+		errTx := d.Tx(&l, isolationLevel, func(l *log.DXLog, dtx *databases.DXDatabaseTx) (err error) {
+			defer func() {
+				c.Locals(txLocalsKey, nil)
+				if r := recover(); r != nil {
+					panicValue = r
+					err = fmt.Errorf("TxPanic:%v", r)
+				}
+				isRolledBack = err != nil
+			}()
+			isHandled = true
+			c.Locals(txLocalsKey, dtx)
+			c.SetUserContext(databases.ContextWithTx(c.UserContext(), dtx))
+			errNext = c.Next()
+			if errNext != nil {
+				return errNext
+			}
+			status := c.Response().StatusCode()
+			if status < http.StatusOK || status >= http.StatusMultipleChoices {
+				return fmt.Errorf("TxRolledBackOnStatus:%d", status)
+			}
+			return nil
+		})
+		switch {
+		case panicValue != nil:
+			panic(panicValue)
+		case errTx == nil:
+			return nil
+		case !isHandled:
+			return WriteError(c, http.StatusServiceUnavailable, DXAPIErrorCodeInternal, `The database is unavailable`, nil)
+		case isRolledBack:
+			return errNext
+		default:
+			c.Response().ResetBody()
+			return WriteError(c, http.StatusInternalServerError, DXAPIErrorCodeInternal, `Internal error`, nil)
+		}
+	}
+}
+
+func contextWithTx(ctx context.Context, c *fiber.Ctx) context.Context {
+	dtx, ok := c.Locals(txLocalsKey).(*databases.DXDatabaseTx)
+	if !ok || dtx == nil {
+		return ctx
+	}
+	return databases.ContextWithTx(ctx, dtx)
+}
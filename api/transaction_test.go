@@ -0,0 +1,114 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/databases"
+
+	_ "modernc.org/sqlite"
+)
+
+// newTestTransactionDatabase gives the sqlite database nameId of databases.Manager with the table t (name).
+func newTestTransactionDatabase(t *testing.T, nameId string) *databases.DXDatabase {
+	t.Helper()
+	connection, err := sqlx.Open(`sqlite`, filepath.Join(t.TempDir(), nameId+`.db`))
+	require.NoError(t, err)
+	_, err = connection.Exec(`CREATE TABLE t (name TEXT NOT NULL)`)
+	require.NoError(t, err)
+	d := databases.Manager.NewDatabase(nameId, false, false)
+	d.Connection = connection
+	d.Connected = true
+	t.Cleanup(func() {
+		_ = connection.Close()
+		delete(databases.Manager.Databases, nameId)
+	})
+	return d
+}
+
+// insertInTx inserts name in the transaction of the request.
+func insertInTx(aepr *DXAPIEndPointRequest, name string) (err error) {
+	dtx, ok := databases.TxFromContext(aepr.Context)
+	if !ok {
+		return errors.New(`NoTx`)
+	}
+	_, err = dtx.Tx.Exec(`INSERT INTO t (name) VALUES (?)`, name)
+	return err
+}
+
+func TestTransactionCommitsOnlyA2xx(t *testing.T) {
+	d := newTestTransactionDatabase(t, `test-transaction`)
+	_, baseURL := startTestAPI(t, `test_transaction`, nil, func(a *DXAPI) {
+		routes := map[string]DXAPIEndPointExecuteFunc{
+			`/ok`: func(aepr *DXAPIEndPointRequest) (err error) {
+				err = insertInTx(aepr, `ok`)
+				if err != nil {
+					return err
+				}
+				return aepr.WriteJSON(http.StatusCreated, nil)
+			},
+			`/failed`: func(aepr *DXAPIEndPointRequest) (err error) {
+				err = insertInTx(aepr, `failed`)
+				if err != nil {
+					return err
+				}
+				return errors.New(`Failed`)
+			},
+			`/rejected`: func(aepr *DXAPIEndPointRequest) (err error) {
+				err = insertInTx(aepr, `rejected`)
+				if err != nil {
+					return err
+				}
+				return aepr.WriteError(http.StatusConflict, errorCodeOfStatus(http.StatusConflict), `Conflict`, nil)
+			},
+			`/panicked`: func(aepr *DXAPIEndPointRequest) (err error) {
+				err = insertInTx(aepr, `panicked`)
+				if err != nil {
+					return err
+				}
+				panic(`panicked`)
+			},
+		}
+		for uri, onExecute := range routes {
+			newTestEndPoint(a, uri, onExecute)
+			require.NoError(t, a.UseOnEndPoint(uri, Transaction(d.NameId, sql.LevelDefault)))
+		}
+	})
+	for uri, status := range map[string]int{
+		`/ok`:       http.StatusCreated,
+		`/failed`:   http.StatusInternalServerError,
+		`/rejected`: http.StatusConflict,
+		`/panicked`: http.StatusInternalServerError,
+	} {
+		response, err := http.Get(baseURL + uri)
+		require.NoError(t, err)
+		_ = response.Body.Close()
+		assert.Equal(t, status, response.StatusCode, uri)
+	}
+	var names []string
+	require.NoError(t, d.Connection.Select(&names, `SELECT name FROM t`))
+	assert.Equal(t, []string{`ok`}, names)
+}
+
+func TestTransactionFailsWithoutItsDatabase(t *testing.T) {
+	isRun := false
+	_, baseURL := startTestAPI(t, `test_transaction_absent`, nil, func(a *DXAPI) {
+		newTestEndPoint(a, `/ok`, func(aepr *DXAPIEndPointRequest) (err error) {
+			isRun = true
+			return nil
+		})
+		require.NoError(t, a.UseOnEndPoint(`/ok`, Transaction(`test-transaction-absent`, sql.LevelDefault)))
+	})
+	response, err := http.Get(baseURL + `/ok`)
+	require.NoError(t, err)
+	_ = response.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, response.StatusCode)
+	assert.False(t, isRun)
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const DXAPIDefaultUploadMaxBytes = 100 * 1024 * 1024
+
+// DXAPIUploadDrainMaxBytes is how much of the rest of a refused streamed body is discarded before the connection is
+// closed, so a client still sending it reads the answer instead of a reset, like net/http does.
+const DXAPIUploadDrainMaxBytes = 256 * 1024
+
+var (
+	ErrUploadTooLarge              = errors.New("UploadTooLarge")
+	ErrUploadContentTypeNotAllowed = errors.New("UploadContentTypeNotAllowed")
+	ErrUploadMalformed             = errors.New("UploadMalformed")
+)
+
+// DXAPIUploadConfiguration limits an upload, MaxBytes is the whole multipart body. AllowedContentTypes, like "image/png"
+// or "image/*", is checked against the content type of the file parts, empty allows every type.
+type DXAPIUploadConfiguration struct {
+	MaxBytes            int64
+	AllowedContentTypes []string
+}
+
+type DXAPIUploadPart struct {
+	FieldName   string
+	FileName    string
+	ContentType string
+}
+
+// DXAPIUploadSink consumes the content of a part as it is received, it must read r before returning.
+type DXAPIUploadSink func(part DXAPIUploadPart, r io.Reader) (err error)
+
+type uploadLimitReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *uploadLimitReader) Read(p []byte) (n int, err error) {
+	if l.remaining < 0 {
+		return 0, ErrUploadTooLarge
+	}
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err = l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, ErrUploadTooLarge
+	}
+	return n, err
+}
+
+func isUploadContentTypeAllowed(contentType string, allowedContentTypes []string) bool {
+	if len(allowedContentTypes) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, v := range allowedContentTypes {
+		v = strings.ToLower(v)
+		if v == mediaType {
+			return true
+		}
+		if strings.HasSuffix(v, `/*`) && strings.HasPrefix(mediaType, strings.TrimSuffix(v, `*`)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadMultipartStream hands every part of the multipart request to sink while it is read, without buffering the files.
+// The body is only streamed from the connection when the API IsStreamRequestBody, otherwise fasthttp has already read it,
+// up to max-body-bytes.
+func ReadMultipartStream(c *fiber.Ctx, configuration DXAPIUploadConfiguration, sink DXAPIUploadSink) (err error) {
+	maxBytes := configuration.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DXAPIDefaultUploadMaxBytes
+	}
+	if int64(c.Request().Header.ContentLength()) > maxBytes {
+		return ErrUploadTooLarge
+	}
+	boundary := string(c.Request().Header.MultipartFormBoundary())
+	if boundary == `` {
+		return fmt.Errorf("%w: not a multipart/form-data request", ErrUploadMalformed)
+	}
+	var body io.Reader = c.Context().RequestBodyStream()
+	if body == nil {
+		body = bytes.NewReader(c.Body())
+	} else {
+		stream := body
+		defer func() {
+			if err != nil {
+				_, _ = io.CopyN(io.Discard, stream, DXAPIUploadDrainMaxBytes)
+			}
+		}()
+	}
+	mr := multipart.NewReader(&uploadLimitReader{r: body, remaining: maxBytes}, boundary)
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if errors.Is(err, ErrUploadTooLarge) {
+				return ErrUploadTooLarge
+			}
+			return fmt.Errorf("%w: %v", ErrUploadMalformed, err)
+		}
+		part := DXAPIUploadPart{
+			FieldName:   p.FormName(),
+			FileName:    p.FileName(),
+			ContentType: p.Header.Get(fiber.HeaderContentType),
+		}
+		if part.FileName != `` && !isUploadContentTypeAllowed(part.ContentType, configuration.AllowedContentTypes) {
+			_ = p.Close()
+			return fmt.Errorf("%w: %s", ErrUploadContentTypeNotAllowed, part.ContentType)
+		}
+		err = sink(part, p)
+		_ = p.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+type DXAPIUploadTempFile struct {
+	Part DXAPIUploadPart
+	Path string
+	Size int64
+}
+
+// ReadMultipartStreamToTempFiles writes every file part into its own temporary file of dir (os.TempDir when empty), the
+// plain form fields are given back as values. On error the temporary files already written are removed.
+func ReadMultipartStreamToTempFiles(c *fiber.Ctx, configuration DXAPIUploadConfiguration, dir string) (files []DXAPIUploadTempFile, values map[string]string, err error) {
+	values = map[string]string{}
+	err = ReadMultipartStream(c, configuration, func(part DXAPIUploadPart, r io.Reader) (err error) {
+		if part.FileName == `` {
+			b, err := io.ReadAll(io.LimitReader(r, DXAPIDefaultMaxBodyBytes))
+			if err != nil {
+				return err
+			}
+			values[part.FieldName] = string(b)
+			return nil
+		}
+		f, err := os.CreateTemp(dir, `upload-*`)
+		if err != nil {
+			return err
+		}
+		size, err := io.Copy(f, r)
+		errClose := f.Close()
+		if err == nil {
+			err = errClose
+		}
+		if err != nil {
+			_ = os.Remove(f.Name())
+			return err
+		}
+		files = append(files, DXAPIUploadTempFile{Part: part, Path: f.Name(), Size: size})
+		return nil
+	})
+	if err != nil {
+		RemoveUploadTempFiles(files)
+		return nil, nil, err
+	}
+	return files, values, nil
+}
+
+func RemoveUploadTempFiles(files []DXAPIUploadTempFile) {
+	for _, v := range files {
+		_ = os.Remove(v.Path)
+	}
+}
+
+// UploadErrorStatus is 413, 415 or 400 for the errors of the upload itself, 500 for the errors of the sink.
+func UploadErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrUploadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrUploadContentTypeNotAllowed):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, ErrUploadMalformed):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// ReadMultipartStream is ReadMultipartStream for the end point, an error also sets the error response with its status.
+func (aepr *DXAPIEndPointRequest) ReadMultipartStream(configuration DXAPIUploadConfiguration, sink DXAPIUploadSink) (err error) {
+	err = ReadMultipartStream(aepr.FiberContext, configuration, sink)
+	if err != nil {
+		status := UploadErrorStatus(err)
+		message := err.Error()
+		if status >= http.StatusInternalServerError {
+			message = `Internal error`
+			aepr.Log.Errorf("Upload failed (%v)", err)
+		}
+		_ = aepr.WriteError(status, errorCodeOfStatus(status), message, nil)
+		return err
+	}
+	return nil
+}
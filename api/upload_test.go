@@ -0,0 +1,215 @@
+package api
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/utils"
+	utilsHttp "dxlib/v3/utils/http"
+)
+
+type testUploadFile struct {
+	fieldName   string
+	fileName    string
+	contentType string
+	data        []byte
+}
+
+// writeTestMultipart writes the fields and the files as a multipart body to w, closing w once done.
+func writeTestMultipart(w io.WriteCloser, mw *multipart.Writer, fields map[string]string, files []testUploadFile) {
+	defer func() {
+		_ = w.Close()
+	}()
+	for k, v := range fields {
+		_ = mw.WriteField(k, v)
+	}
+	for _, v := range files {
+		h := textproto.MIMEHeader{}
+		h.Set(`Content-Disposition`, `form-data; name="`+v.fieldName+`"; filename="`+v.fileName+`"`)
+		h.Set(`Content-Type`, v.contentType)
+		part, err := mw.CreatePart(h)
+		if err != nil {
+			return
+		}
+		_, _ = part.Write(v.data)
+	}
+	_ = mw.Close()
+}
+
+// postTestMultipart posts the fields and the files to url. A chunked body has no Content-Length, the limit is then
+// found while streaming. The body is sent once the server continues, one refused by its Content-Length is not written
+// to a connection the server closes.
+func postTestMultipart(t *testing.T, url string, fields map[string]string, files []testUploadFile, isChunked bool) int {
+	t.Helper()
+	var body io.Reader
+	var contentType string
+	if isChunked {
+		r, w := io.Pipe()
+		mw := multipart.NewWriter(w)
+		contentType = mw.FormDataContentType()
+		go writeTestMultipart(w, mw, fields, files)
+		body = struct{ io.Reader }{r}
+	} else {
+		b := &bytes.Buffer{}
+		mw := multipart.NewWriter(b)
+		contentType = mw.FormDataContentType()
+		writeTestMultipart(nopWriteCloser{b}, mw, fields, files)
+		body = b
+	}
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	require.NoError(t, err)
+	req.Header.Set(`Content-Type`, contentType)
+	req.Header.Set(`Expect`, `100-continue`)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	return resp.StatusCode
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+type testUploadResult struct {
+	part DXAPIUploadPart
+	size int64
+	sum  [sha256.Size]byte
+}
+
+// startTestUploadAPI serves POST /upload streaming the parts of at most maxBytes, giving what each part read.
+func startTestUploadAPI(t *testing.T, maxBytes int64, allowedContentTypes []string) (baseURL string, results chan testUploadResult) {
+	t.Helper()
+	results = make(chan testUploadResult, 16)
+	_, baseURL = startTestAPI(t, `test-upload`, utils.JSON{
+		`max-body-bytes`:      float64(64 * 1024),
+		`stream-request-body`: true,
+	}, func(a *DXAPI) {
+		a.NewEndPoint(`/upload`, ``, `/upload`, http.MethodPost, EndPointTypeHTTP, utilsHttp.ContentTypeMultiPartFormData, nil,
+			func(aepr *DXAPIEndPointRequest) (err error) {
+				err = aepr.ReadMultipartStream(DXAPIUploadConfiguration{MaxBytes: maxBytes, AllowedContentTypes: allowedContentTypes},
+					func(part DXAPIUploadPart, r io.Reader) (err error) {
+						h := sha256.New()
+						size, err := io.Copy(h, r)
+						if err != nil {
+							return err
+						}
+						result := testUploadResult{part: part, size: size}
+						copy(result.sum[:], h.Sum(nil))
+						results <- result
+						return nil
+					})
+				if err != nil {
+					return err
+				}
+				aepr.ResponseStatusCode = http.StatusOK
+				return nil
+			}, nil, nil)
+	})
+	return baseURL, results
+}
+
+func TestUploadMultiMegabyteIsStreamed(t *testing.T) {
+	baseURL, results := startTestUploadAPI(t, 16*1024*1024, []string{`application/octet-stream`})
+	data := make([]byte, 8*1024*1024)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+
+	for _, isChunked := range []bool{false, true} {
+		statusCode := postTestMultipart(t, baseURL+`/upload`, map[string]string{`title`: `report`},
+			[]testUploadFile{{`file`, `report.bin`, `application/octet-stream`, data}}, isChunked)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		title := <-results
+		assert.Equal(t, DXAPIUploadPart{FieldName: `title`}, title.part)
+		assert.Equal(t, int64(len(`report`)), title.size)
+		file := <-results
+		assert.Equal(t, DXAPIUploadPart{FieldName: `file`, FileName: `report.bin`, ContentType: `application/octet-stream`}, file.part)
+		assert.Equal(t, int64(len(data)), file.size)
+		assert.Equal(t, sha256.Sum256(data), file.sum)
+	}
+}
+
+func TestUploadOverMaxBytesIs413(t *testing.T) {
+	baseURL, _ := startTestUploadAPI(t, 1024*1024, nil)
+
+	// refused by its Content-Length, the body is never sent
+	statusCode := postTestMultipart(t, baseURL+`/upload`, nil,
+		[]testUploadFile{{`file`, `big.txt`, `text/plain`, bytes.Repeat([]byte(`a`), 2*1024*1024)}}, false)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, statusCode)
+	// refused while streaming, the rest of it is drained for the answer to be read
+	statusCode = postTestMultipart(t, baseURL+`/upload`, nil,
+		[]testUploadFile{{`file`, `big.txt`, `text/plain`, bytes.Repeat([]byte(`a`), 1024*1024+DXAPIUploadDrainMaxBytes/2)}}, true)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, statusCode)
+}
+
+func TestUploadOfADisallowedContentTypeIs415(t *testing.T) {
+	baseURL, results := startTestUploadAPI(t, 1024*1024, []string{`text/*`, `application/pdf`})
+
+	statusCode := postTestMultipart(t, baseURL+`/upload`, nil, []testUploadFile{
+		{`notes`, `notes.txt`, `text/plain; charset=utf-8`, []byte(`notes`)},
+		{`image`, `image.png`, `image/png`, []byte(`png`)},
+	}, false)
+	assert.Equal(t, http.StatusUnsupportedMediaType, statusCode)
+	// the allowed part before it was streamed
+	assert.Equal(t, `notes.txt`, (<-results).part.FileName)
+	assert.Empty(t, results)
+}
+
+func TestUploadToTempFilesIsCleanedUpOnError(t *testing.T) {
+	dir := t.TempDir()
+	files := make(chan []DXAPIUploadTempFile, 1)
+	_, baseURL := startTestAPI(t, `test-upload-temp`, utils.JSON{`stream-request-body`: true}, func(a *DXAPI) {
+		a.NewEndPoint(`/upload`, ``, `/upload`, http.MethodPost, EndPointTypeHTTP, utilsHttp.ContentTypeMultiPartFormData, nil,
+			func(aepr *DXAPIEndPointRequest) (err error) {
+				f, values, err := ReadMultipartStreamToTempFiles(aepr.FiberContext, DXAPIUploadConfiguration{
+					AllowedContentTypes: []string{`text/plain`},
+				}, dir)
+				if err != nil {
+					return aepr.WriteError(UploadErrorStatus(err), errorCodeOfStatus(UploadErrorStatus(err)), err.Error(), nil)
+				}
+				assert.Equal(t, map[string]string{`title`: `report`}, values)
+				files <- f
+				aepr.ResponseStatusCode = http.StatusOK
+				return nil
+			}, nil, nil)
+	})
+
+	statusCode := postTestMultipart(t, baseURL+`/upload`, map[string]string{`title`: `report`}, []testUploadFile{
+		{`first`, `first.txt`, `text/plain`, []byte(`first`)},
+		{`second`, `second.txt`, `text/plain`, []byte(`second`)},
+	}, false)
+	require.Equal(t, http.StatusOK, statusCode)
+	written := <-files
+	require.Len(t, written, 2)
+	for _, v := range written {
+		b, err := os.ReadFile(v.Path)
+		require.NoError(t, err)
+		assert.Equal(t, v.Size, int64(len(b)))
+	}
+	RemoveUploadTempFiles(written)
+
+	// the first file was written before the second is refused
+	statusCode = postTestMultipart(t, baseURL+`/upload`, nil, []testUploadFile{
+		{`first`, `first.txt`, `text/plain`, []byte(`first`)},
+		{`second`, `second.exe`, `application/octet-stream`, []byte(`second`)},
+	}, false)
+	assert.Equal(t, http.StatusUnsupportedMediaType, statusCode)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
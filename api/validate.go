@@ -0,0 +1,277 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const DXAPIErrorCodeBadRequest = `BAD_REQUEST`
+
+var errRequestBodyHasDataAfterJSON = errors.New("RequestBodyHasDataAfterJSON")
+
+// DXAPIFieldError is a field of the request that failed the rule of its validate tag, Field is the JSON path of it, like
+// items[0].name.
+type DXAPIFieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// DXAPIValidationError lists every field of the request that failed, it is the details of the error envelope.
+type DXAPIValidationError struct {
+	Fields []DXAPIFieldError `json:"fields"`
+}
+
+func (e *DXAPIValidationError) Error() string {
+	s := make([]string, len(e.Fields))
+	for i, v := range e.Fields {
+		s[i] = v.Field + `: ` + v.Message
+	}
+	return `ValidationFailed:` + strings.Join(s, `; `)
+}
+
+func (e *DXAPIValidationError) add(field string, rule string, param string, message string) {
+	e.Fields = append(e.Fields, DXAPIFieldError{Field: field, Rule: rule, Param: param, Message: message})
+}
+
+// Validate checks the fields of the struct v against their validate tags, like `validate:"required,min=1,max=64"`.
+// The rules are required, min, max and len, on the length of a string, slice or map or on the value of a number, email
+// and oneof, its values separated by spaces. Nested structs, and the structs of the slices, are checked too. A failed
+// field gives a *DXAPIValidationError, a tag with an unknown rule any other error.
+func Validate(v any) (err error) {
+	e := &DXAPIValidationError{}
+	err = validateValue(reflect.ValueOf(v), ``, e)
+	if err != nil {
+		return err
+	}
+	if len(e.Fields) > 0 {
+		return e
+	}
+	return nil
+}
+
+func validateValue(v reflect.Value, path string, e *DXAPIValidationError) (err error) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name := jsonFieldName(f)
+			if name == `-` {
+				continue
+			}
+			fieldPath := name
+			if path != `` {
+				fieldPath = path + `.` + name
+			}
+			fv := v.Field(i)
+			tag, ok := f.Tag.Lookup(`validate`)
+			if ok {
+				isValid, err := validateField(fv, fieldPath, tag, e)
+				if err != nil {
+					return fmt.Errorf("ValidateTag:%s.%s:%w", t.Name(), f.Name, err)
+				}
+				if !isValid {
+					continue
+				}
+			}
+			err = validateValue(fv, fieldPath, e)
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			err = validateValue(v.Index(i), path+`[`+strconv.Itoa(i)+`]`, e)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func jsonFieldName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get(`json`), `,`)
+	if name == `` {
+		return f.Name
+	}
+	return name
+}
+
+// validateField checks the rules of tag on v, a field failing one is only reported once, for its first failed rule.
+func validateField(v reflect.Value, path string, tag string, e *DXAPIValidationError) (isValid bool, err error) {
+	isNil := (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface || v.Kind() == reflect.Slice ||
+		v.Kind() == reflect.Map) && v.IsNil()
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			break
+		}
+		v = v.Elem()
+	}
+	for _, rule := range strings.Split(tag, `,`) {
+		rule, param, _ := strings.Cut(strings.TrimSpace(rule), `=`)
+		switch rule {
+		case ``:
+		case `required`:
+			if isNil || v.IsZero() {
+				e.add(path, rule, ``, `is required`)
+				return false, nil
+			}
+		case `min`, `max`, `len`:
+			if isNil {
+				continue
+			}
+			limit, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				return false, fmt.Errorf("InvalidRuleParam:%s=%s", rule, param)
+			}
+			size, isLength, err := measure(v)
+			if err != nil {
+				return false, err
+			}
+			message := ``
+			switch {
+			case rule == `min` && size < limit:
+				message = `must be at least ` + param
+			case rule == `max` && size > limit:
+				message = `must be at most ` + param
+			case rule == `len` && size != limit:
+				message = `must be exactly ` + param
+			}
+			if message != `` {
+				if isLength {
+					message = message + ` long`
+				}
+				e.add(path, rule, param, message)
+				return false, nil
+			}
+		case `email`:
+			if isNil || v.Kind() != reflect.String {
+				continue
+			}
+			s := v.String()
+			a, err := mail.ParseAddress(s)
+			if s != `` && (err != nil || a.Address != s) {
+				e.add(path, rule, ``, `must be an email address`)
+				return false, nil
+			}
+		case `oneof`:
+			if isNil {
+				continue
+			}
+			s := fmt.Sprint(v.Interface())
+			isOneOf := false
+			for _, x := range strings.Fields(param) {
+				if x == s {
+					isOneOf = true
+					break
+				}
+			}
+			if !isOneOf {
+				e.add(path, rule, param, `must be one of `+strings.Join(strings.Fields(param), `, `))
+				return false, nil
+			}
+		default:
+			return false, fmt.Errorf("UnknownRule:%s", rule)
+		}
+	}
+	return true, nil
+}
+
+// measure gives the length of a string, in characters, slice or map, or the value of a number.
+func measure(v reflect.Value) (size float64, isLength bool, err error) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true, nil
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), false, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), false, nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false, nil
+	default:
+		return 0, false, fmt.Errorf("RuleNotSupportedForKind:%s", v.Kind())
+	}
+}
+
+// DecodeAndValidate decodes the JSON body into dst and then runs Validate on it. With isDisallowUnknownFields a field
+// not in dst fails like a field breaking a rule, a value of the wrong type always does.
+func DecodeAndValidate(body []byte, dst any, isDisallowUnknownFields bool) (err error) {
+	d := jsonCodec().NewDecoder(bytes.NewReader(body))
+	if isDisallowUnknownFields {
+		d.DisallowUnknownFields()
+	}
+	err = d.Decode(dst)
+	if err != nil {
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &typeErr):
+			e := &DXAPIValidationError{}
+			e.add(typeErr.Field, `type`, typeErr.Type.String(), `must be of type `+typeErr.Type.String())
+			return e
+		case strings.HasPrefix(err.Error(), `json: unknown field `):
+			e := &DXAPIValidationError{}
+			e.add(strings.Trim(strings.TrimPrefix(err.Error(), `json: unknown field `), `"`), `unknown`, ``, `is not a field of the request`)
+			return e
+		}
+		return err
+	}
+	rest := json.RawMessage{}
+	err = d.Decode(&rest)
+	if err != io.EOF {
+		return errRequestBodyHasDataAfterJSON
+	}
+	return Validate(dst)
+}
+
+// DecodeAndValidate decodes the body of the request into dst, see DecodeAndValidate. On an error it sets the response to
+// the error envelope: 413 for a body over MaxBodyBytes, 400 for a body that is not JSON and 400 VALIDATION_FAILED, the
+// failed fields as details, for a field that is not valid. The end point just returns the error.
+func (aepr *DXAPIEndPointRequest) DecodeAndValidate(dst any, isDisallowUnknownFields bool) (err error) {
+	body := aepr.FiberContext.Body()
+	maxBodyBytes := aepr.EndPoint.Owner.MaxBodyBytes
+	if maxBodyBytes > 0 && len(body) > maxBodyBytes {
+		err = fmt.Errorf("RequestBodyTooLarge:%d", len(body))
+		_ = aepr.WriteError(http.StatusRequestEntityTooLarge, errorCodeOfStatus(http.StatusRequestEntityTooLarge), `Request body is too large`, nil)
+		return err
+	}
+	err = DecodeAndValidate(body, dst, isDisallowUnknownFields)
+	if err == nil {
+		return nil
+	}
+	var validationErr *DXAPIValidationError
+	if errors.As(err, &validationErr) {
+		_ = aepr.WriteError(http.StatusBadRequest, DXAPIErrorCodeValidationFailed, `Validation failed`, validationErr)
+		return err
+	}
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, errRequestBodyHasDataAfterJSON) {
+		_ = aepr.WriteError(http.StatusBadRequest, DXAPIErrorCodeBadRequest, `Request body is not valid JSON`, nil)
+		return err
+	}
+	aepr.ResponseStatusCode = http.StatusInternalServerError
+	return err
+}
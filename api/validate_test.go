@@ -0,0 +1,117 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/utils"
+	utilsHttp "dxlib/v3/utils/http"
+)
+
+type testOrderItem struct {
+	Sku      string `json:"sku" validate:"required"`
+	Quantity int    `json:"quantity" validate:"min=1,max=100"`
+}
+
+type testOrder struct {
+	Email    string          `json:"email" validate:"required,email"`
+	Name     string          `json:"name" validate:"required,max=8"`
+	Currency string          `json:"currency" validate:"oneof=IDR USD"`
+	Items    []testOrderItem `json:"items" validate:"min=1"`
+	Note     *string         `json:"note"`
+}
+
+// fieldsOfTestValidation gives the fields of err and their rule, as field:rule.
+func fieldsOfTestValidation(t *testing.T, err error) (fields []string) {
+	t.Helper()
+	var validationErr *DXAPIValidationError
+	require.ErrorAs(t, err, &validationErr)
+	for _, v := range validationErr.Fields {
+		fields = append(fields, v.Field+`:`+v.Rule)
+	}
+	return fields
+}
+
+func TestDecodeAndValidateListsEveryFailedField(t *testing.T) {
+	var order testOrder
+	err := DecodeAndValidate([]byte(`{"email":"not an email","currency":"EUR","items":[{"quantity":0},{"sku":"a","quantity":1}]}`), &order, false)
+	assert.Equal(t, []string{`email:email`, `name:required`, `currency:oneof`, `items[0].sku:required`, `items[0].quantity:min`},
+		fieldsOfTestValidation(t, err))
+
+	order = testOrder{}
+	err = DecodeAndValidate([]byte(`{"email":"a@b.c","name":"alice","currency":"IDR","items":[{"sku":"a","quantity":1}]}`), &order, false)
+	require.NoError(t, err)
+	assert.Equal(t, `alice`, order.Name)
+}
+
+func TestDecodeAndValidateOfAnUnknownField(t *testing.T) {
+	body := []byte(`{"email":"a@b.c","name":"alice","currency":"IDR","items":[{"sku":"a","quantity":1}],"discount":10}`)
+	var order testOrder
+	assert.Equal(t, []string{`discount:unknown`}, fieldsOfTestValidation(t, DecodeAndValidate(body, &order, true)))
+	// allowed, the field is ignored
+	assert.NoError(t, DecodeAndValidate(body, &order, false))
+
+	assert.Equal(t, []string{`items:type`}, fieldsOfTestValidation(t, DecodeAndValidate([]byte(`{"items":"a"}`), &order, false)))
+	assert.ErrorIs(t, DecodeAndValidate([]byte(`{"name":"a"} {}`), &order, false), errRequestBodyHasDataAfterJSON)
+}
+
+func TestValidateOfAnUnknownRule(t *testing.T) {
+	v := struct {
+		Name string `json:"name" validate:"uuid"`
+	}{}
+	err := Validate(&v)
+	require.Error(t, err)
+	var validationErr *DXAPIValidationError
+	assert.False(t, errors.As(err, &validationErr))
+}
+
+func TestDecodeAndValidateOfAnEndPoint(t *testing.T) {
+	_, baseURL := startTestAPI(t, `test_validate`, utils.JSON{`max-body-bytes`: float64(1024)}, func(a *DXAPI) {
+		a.NewEndPoint(`/orders`, ``, `/orders`, http.MethodPost, EndPointTypeHTTP, utilsHttp.ContentTypeApplicationJSON, nil,
+			func(aepr *DXAPIEndPointRequest) (err error) {
+				var order testOrder
+				err = aepr.DecodeAndValidate(&order, true)
+				if err != nil {
+					return err
+				}
+				return aepr.WriteJSON(http.StatusCreated, order.Name)
+			}, nil, nil)
+	})
+	post := func(body string) (status int, envelope dxAPIErrorEnvelope) {
+		response, err := http.Post(baseURL+`/orders`, `application/json`, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		defer func() {
+			_ = response.Body.Close()
+		}()
+		b, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+		if response.StatusCode >= http.StatusBadRequest {
+			require.NoError(t, json.Unmarshal(b, &envelope), string(b))
+		}
+		return response.StatusCode, envelope
+	}
+
+	status, envelope := post(`{"email":"a@b.c","currency":"IDR","items":[{"sku":"a","quantity":1}]}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, DXAPIErrorCodeValidationFailed, envelope.Error.Code)
+	assert.Equal(t, map[string]any{`fields`: []any{map[string]any{`field`: `name`, `rule`: `required`, `message`: `is required`}}},
+		envelope.Error.Details)
+
+	status, envelope = post(`{"email":"a@b.c","name":"alice","currency":"IDR","items":[{"sku":"a","quantity":1}],"discount":10}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, DXAPIErrorCodeValidationFailed, envelope.Error.Code)
+
+	// a body not JSON is refused before the handler decodes it
+	status, _ = post(`{"email":`)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+
+	status, _ = post(`{"email":"a@b.c","name":"alice","currency":"IDR","items":[{"sku":"a","quantity":1}]}`)
+	assert.Equal(t, http.StatusCreated, status)
+}
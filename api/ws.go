@@ -0,0 +1,257 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+
+	"dxlib/v3/log"
+)
+
+const (
+	DXAPIDefaultWSSendBufferSize = 256
+	DXAPIWSPingInterval          = 30 * time.Second
+	DXAPIWSPongWait              = 60 * time.Second
+	DXAPIWSWriteWait             = 10 * time.Second
+)
+
+var (
+	ErrWSClosed     = errors.New("WSClosed")
+	ErrWSSlowClient = errors.New("WSSlowClient")
+)
+
+type DXAPIWSHandler func(conn *WSConn) (err error)
+
+type dxAPIWSRoute struct {
+	path    string
+	handler DXAPIWSHandler
+}
+
+type wsMessage struct {
+	messageType int
+	data        []byte
+}
+
+// WSConn is a WebSocket connection of HandleWS. Its read and write pumps own the underlying connection, the handler reads
+// with Read and writes with Send, which never blocks: a client whose send buffer is full is dropped. Context is done once
+// the connection is closed, by either side, by a failed ping or by the shutdown of the API.
+type WSConn struct {
+	Conn     *websocket.Conn
+	Context  context.Context
+	cancel   context.CancelFunc
+	send     chan wsMessage
+	received chan wsMessage
+	readErr  error
+}
+
+func newWSConn(ctx context.Context, c *websocket.Conn, sendBufferSize int) *WSConn {
+	ctx, cancel := context.WithCancel(ctx)
+	return &WSConn{
+		Conn:     c,
+		Context:  ctx,
+		cancel:   cancel,
+		send:     make(chan wsMessage, sendBufferSize),
+		received: make(chan wsMessage),
+	}
+}
+
+// Read waits for the next message of the client, it gives ErrWSClosed, or the read error, once the connection is closed.
+func (c *WSConn) Read() (messageType int, data []byte, err error) {
+	select {
+	case m, ok := <-c.received:
+		if !ok {
+			if c.readErr != nil {
+				return 0, nil, c.readErr
+			}
+			return 0, nil, ErrWSClosed
+		}
+		return m.messageType, m.data, nil
+	case <-c.Context.Done():
+		return 0, nil, ErrWSClosed
+	}
+}
+
+// Send queues data for the write pump, the connection is closed with ErrWSSlowClient when the send buffer is full.
+func (c *WSConn) Send(messageType int, data []byte) (err error) {
+	if c.Context.Err() != nil {
+		return ErrWSClosed
+	}
+	select {
+	case c.send <- wsMessage{messageType: messageType, data: data}:
+		return nil
+	default:
+		log.Log.Warnf("WebSocket client %s is too slow, %d message(s) pending, dropping it", c.Conn.RemoteAddr(), len(c.send))
+		c.Close()
+		return ErrWSSlowClient
+	}
+}
+
+func (c *WSConn) SendText(s string) (err error) {
+	return c.Send(websocket.TextMessage, []byte(s))
+}
+
+func (c *WSConn) SendJSON(v any) (err error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.Send(websocket.TextMessage, b)
+}
+
+func (c *WSConn) Close() {
+	c.cancel()
+}
+
+func (c *WSConn) readPump() {
+	defer close(c.received)
+	defer c.cancel()
+	_ = c.Conn.SetReadDeadline(time.Now().Add(DXAPIWSPongWait))
+	c.Conn.SetPongHandler(func(string) error {
+		return c.Conn.SetReadDeadline(time.Now().Add(DXAPIWSPongWait))
+	})
+	for {
+		messageType, data, err := c.Conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				c.readErr = err
+			}
+			return
+		}
+		select {
+		case c.received <- wsMessage{messageType: messageType, data: data}:
+		case <-c.Context.Done():
+			return
+		}
+	}
+}
+
+// writePump closes the underlying connection when it stops, which also stops readPump.
+func (c *WSConn) writePump() {
+	ticker := time.NewTicker(DXAPIWSPingInterval)
+	defer ticker.Stop()
+	defer func() {
+		_ = c.Conn.Close()
+	}()
+	defer c.cancel()
+	for {
+		select {
+		case m := <-c.send:
+			_ = c.Conn.SetWriteDeadline(time.Now().Add(DXAPIWSWriteWait))
+			err := c.Conn.WriteMessage(m.messageType, m.data)
+			if err != nil {
+				return
+			}
+		case <-ticker.C:
+			err := c.Conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(DXAPIWSWriteWait))
+			if err != nil {
+				return
+			}
+		case <-c.Context.Done():
+			_ = c.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ``), time.Now().Add(DXAPIWSWriteWait))
+			return
+		}
+	}
+}
+
+// HandleWS serves handler at path for the WebSocket upgrade requests, the others get 426. The connection is closed when
+// handler returns.
+func (a *DXAPI) HandleWS(path string, handler DXAPIWSHandler) {
+	a.WSRoutes = append(a.WSRoutes, dxAPIWSRoute{path: path, handler: handler})
+}
+
+// HandleWS adds the WebSocket route to every API of the manager.
+func (am *DXAPIManager) HandleWS(path string, handler DXAPIWSHandler) {
+	for _, v := range am.APIs {
+		v.HandleWS(path, handler)
+	}
+}
+
+func (a *DXAPI) registerWSRoutes() {
+	for _, v := range a.WSRoutes {
+		route := v
+		a.HTTPServer.Get(route.path, websocket.New(func(c *websocket.Conn) {
+			a.serveWS(c, route)
+		}))
+	}
+}
+
+// serveWS waits for both pumps before returning, the websocket.Conn is recycled once it returns.
+func (a *DXAPI) serveWS(c *websocket.Conn, route dxAPIWSRoute) {
+	conn := newWSConn(a.wsContext, c, a.WSSendBufferSize)
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		conn.writePump()
+	}()
+	go func() {
+		defer wg.Done()
+		conn.readPump()
+	}()
+	err := route.handler(conn)
+	if err != nil && !errors.Is(err, ErrWSClosed) {
+		log.Log.Warnf("WebSocket %s of %s closed with error (%v)", route.path, c.RemoteAddr(), err)
+	}
+	conn.Close()
+	wg.Wait()
+}
+
+// WSHub fans the messages out to its connections, a connection leaves the hub once closed.
+type WSHub struct {
+	mutex sync.RWMutex
+	conns map[*WSConn]struct{}
+}
+
+func NewWSHub() *WSHub {
+	return &WSHub{conns: map[*WSConn]struct{}{}}
+}
+
+func (h *WSHub) Add(conn *WSConn) {
+	h.mutex.Lock()
+	h.conns[conn] = struct{}{}
+	h.mutex.Unlock()
+	context.AfterFunc(conn.Context, func() {
+		h.Remove(conn)
+	})
+}
+
+func (h *WSHub) Remove(conn *WSConn) {
+	h.mutex.Lock()
+	delete(h.conns, conn)
+	h.mutex.Unlock()
+}
+
+func (h *WSHub) Count() int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.conns)
+}
+
+// Broadcast sends data to every connection of the hub, the slow clients are dropped, sent is the number of connections
+// that queued data.
+func (h *WSHub) Broadcast(messageType int, data []byte) (sent int) {
+	h.mutex.RLock()
+	conns := make([]*WSConn, 0, len(h.conns))
+	for c := range h.conns {
+		conns = append(conns, c)
+	}
+	h.mutex.RUnlock()
+	for _, c := range conns {
+		if c.Send(messageType, data) == nil {
+			sent++
+		}
+	}
+	return sent
+}
+
+func (h *WSHub) BroadcastJSON(v any) (sent int, err error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return 0, err
+	}
+	return h.Broadcast(websocket.TextMessage, b), nil
+}
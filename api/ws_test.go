@@ -0,0 +1,123 @@
+package api
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	fastwebsocket "github.com/fasthttp/websocket"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/utils"
+)
+
+// dialTestWS opens a WebSocket client to path of baseURL, closed at the end of the test.
+func dialTestWS(t *testing.T, baseURL string, path string) *fastwebsocket.Conn {
+	t.Helper()
+	client, _, err := fastwebsocket.DefaultDialer.Dial(`ws`+strings.TrimPrefix(baseURL, `http`)+path, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return client
+}
+
+// readTestWS gives the next text message of client.
+func readTestWS(t *testing.T, client *fastwebsocket.Conn) string {
+	t.Helper()
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(5*time.Second)))
+	messageType, data, err := client.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, fastwebsocket.TextMessage, messageType)
+	return string(data)
+}
+
+func TestWSEchoAndBroadcast(t *testing.T) {
+	hub := NewWSHub()
+	_, baseURL := startTestAPI(t, `test-ws`, nil, func(a *DXAPI) {
+		a.HandleWS(`/echo`, func(conn *WSConn) (err error) {
+			for {
+				messageType, data, err := conn.Read()
+				if err != nil {
+					return err
+				}
+				err = conn.Send(messageType, data)
+				if err != nil {
+					return err
+				}
+			}
+		})
+		a.HandleWS(`/events`, func(conn *WSConn) (err error) {
+			hub.Add(conn)
+			<-conn.Context.Done()
+			return nil
+		})
+	})
+
+	client := dialTestWS(t, baseURL, `/echo`)
+	require.NoError(t, client.WriteMessage(fastwebsocket.TextMessage, []byte(`hello`)))
+	assert.Equal(t, `hello`, readTestWS(t, client))
+
+	first, second := dialTestWS(t, baseURL, `/events`), dialTestWS(t, baseURL, `/events`)
+	require.Eventually(t, func() bool {
+		return hub.Count() == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	sent, err := hub.BroadcastJSON(utils.JSON{`event`: `update`})
+	require.NoError(t, err)
+	assert.Equal(t, 2, sent)
+	assert.Equal(t, `{"event":"update"}`, readTestWS(t, first))
+	assert.Equal(t, `{"event":"update"}`, readTestWS(t, second))
+
+	// a client leaving the hub once gone
+	require.NoError(t, first.WriteControl(fastwebsocket.CloseMessage, fastwebsocket.FormatCloseMessage(fastwebsocket.CloseNormalClosure, ``), time.Now().Add(time.Second)))
+	require.Eventually(t, func() bool {
+		return hub.Count() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestWSSlowClientIsDropped(t *testing.T) {
+	results := make(chan error, 2)
+	_, baseURL := startTestAPI(t, `test-ws-slow`, nil, func(a *DXAPI) {
+		a.HandleWS(`/slow`, func(conn *WSConn) (err error) {
+			// a connection of a buffer of one whose pump is not running, as a client not reading
+			slow := newWSConn(conn.Context, conn.Conn, 1)
+			results <- slow.SendText(`first`)
+			results <- slow.SendText(`second`)
+			assert.Error(t, slow.Context.Err())
+			assert.ErrorIs(t, slow.SendText(`third`), ErrWSClosed)
+			return nil
+		})
+	})
+
+	dialTestWS(t, baseURL, `/slow`)
+	assert.NoError(t, <-results)
+	assert.ErrorIs(t, <-results, ErrWSSlowClient)
+}
+
+func TestWSClosedAtShutdown(t *testing.T) {
+	handlerErrs := make(chan error, 1)
+	a, baseURL := startTestAPI(t, `test-ws-shutdown`, nil, func(a *DXAPI) {
+		a.HandleWS(`/wait`, func(conn *WSConn) (err error) {
+			_, _, err = conn.Read()
+			handlerErrs <- err
+			return err
+		})
+	})
+	client := dialTestWS(t, baseURL, `/wait`)
+
+	require.NoError(t, a.StartShutdown())
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, _, err := client.ReadMessage()
+	var closeErr *fastwebsocket.CloseError
+	require.True(t, errors.As(err, &closeErr), `%v`, err)
+	assert.Equal(t, websocket.CloseGoingAway, closeErr.Code)
+	select {
+	case err = <-handlerErrs:
+		assert.ErrorIs(t, err, ErrWSClosed)
+	case <-time.After(5 * time.Second):
+		t.Fatal(`the handler was not ended by the shutdown`)
+	}
+}
@@ -2,41 +2,83 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"sync"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 
 	v3 "dxlib/v3"
 	"dxlib/v3/api"
+	"dxlib/v3/breaker"
 	"dxlib/v3/configurations"
 	"dxlib/v3/core"
 	"dxlib/v3/databases"
+	"dxlib/v3/databases/protected/db"
+	"dxlib/v3/flags"
+	"dxlib/v3/grpc"
+	"dxlib/v3/health"
+	"dxlib/v3/httpclient"
 	"dxlib/v3/log"
+	"dxlib/v3/mail"
+	"dxlib/v3/metrics"
+	"dxlib/v3/objectstorage"
+	"dxlib/v3/outbox"
 	"dxlib/v3/redis"
 	"dxlib/v3/tables"
 	"dxlib/v3/tasks"
+	"dxlib/v3/tracing"
 )
 
-type DXAppArgCommandFunc func(s *DXApp, ac *DXAppArgCommand, T any) (err error)
+const (
+	DXAppWaitForDependenciesDefaultTimeoutSec = 60
+	DXAppWaitForDependenciesInitialBackoff    = 500 * time.Millisecond
+	DXAppWaitForDependenciesMaxBackoff        = 5 * time.Second
+)
+
+type DXAppArgCommandFunc func(cc *DXAppCommandContext) (err error)
 
 type DXAppArgCommand struct {
 	name     string
 	command  string
 	callback *DXAppArgCommandFunc
+	// isWithoutDependencies calls the command without connecting the configuration, redis and storage first
+	isWithoutDependencies bool
 }
 
 type DXAppArgOptionFunc func(s *DXApp, ac *DXAppArgOption, T any) (err error)
 
+// DXAppArgOptionType is the type ParseArgs checks the value of an option against, a string by default.
+type DXAppArgOptionType int
+
+const (
+	DXAppArgOptionTypeString DXAppArgOptionType = iota
+	DXAppArgOptionTypeInt
+	DXAppArgOptionTypeBool
+	DXAppArgOptionTypeDuration
+)
+
 type DXAppArgOption struct {
-	name     string
-	option   string
-	callback *DXAppArgOptionFunc
+	name      string
+	option    string
+	callback  *DXAppArgOptionFunc
+	valueType DXAppArgOptionType
+	isSet     bool
+	rawValue  string
+	value     any
 }
 
 type DXAppArgs struct {
-	Commands map[string]*DXAppArgCommand
-	Options  map[string]*DXAppArgOption
+	Commands     map[string]*DXAppArgCommand
+	Options      map[string]*DXAppArgOption
+	OptionValues map[string]string
+	// OptionTypedValues are the values of OptionValues parsed as the type of their option, like an int or a
+	// time.Duration
+	OptionTypedValues map[string]any
+	Positionals       []string
 }
 
 type DXAppCallbackFunc func() (err error)
@@ -54,140 +96,569 @@ type DXApp struct {
 
 	IsRedisExist          bool
 	IsStorageExist        bool
+	IsObjectStorageExist  bool
+	IsMailExist           bool
+	IsFeaturesExist       bool
+	IsHTTPClientExist     bool
 	IsAPIExist            bool
+	IsGRPCExist           bool
+	IsOutboxExist         bool
 	IsTaskExist           bool
 	DebugKey              string
 	IsDebug               bool
+	EnableMetrics         bool
 	OnDefine              DXAppEvent
 	OnDefineConfiguration DXAppEvent
 	OnDefineAPI           DXAppEvent
 	OnExecute             DXAppEvent
 	OnStartStorageReady   DXAppEvent
 	OnStopping            DXAppEvent
+	OnStarting            DXAppEvent
+	OnReady               DXAppEvent
+
+	// IsWaitForDependencies makes start() retry the storage and redis until reachable instead of failing at once
+	IsWaitForDependencies         bool
+	WaitForDependenciesTimeoutSec int
+	// PreflightTimeoutSec bounds each connection attempt and health check of Preflight, 0 is DXAppPreflightDefaultTimeoutSec
+	PreflightTimeoutSec int
+	// PanicPolicy is core.PanicPolicy for the request, task and job scopes, empty keeps core.PanicPolicyRecover
+	PanicPolicy core.DXPanicPolicy
+	// IsSensitiveValuesUnmasked logs the values of the query args, the sensitive ones too, to debug in development only
+	IsSensitiveValuesUnmasked bool
+	// ShutdownTimeoutSec bounds the draining of the in-flight API requests at stop, 0 keeps the API default
+	ShutdownTimeoutSec int
+	// Settings are read from the environment at init, see DXAppSettings
+	Settings    DXAppSettings
+	settingsErr error
+	// ShutdownSubsystemOrder and ShutdownConstraints change the order Stop stops the subsystems in, see ShutdownOrder
+	ShutdownSubsystemOrder []string
+	ShutdownConstraints    []DXAppShutdownConstraint
+	// IsGracefulRestart restarts the app on SIGUSR2 without refusing a connection, see GracefulRestart
+	IsGracefulRestart bool
+	// RestartReadyTimeoutSec is how long GracefulRestart waits for the new process to serve, 0 is
+	// DXAppDefaultRestartReadyTimeout
+	RestartReadyTimeoutSec int
+	// Stdout and Stderr are given to the commands, nil is os.Stdout and os.Stderr
+	Stdout io.Writer
+	Stderr io.Writer
+
+	stopOnce  sync.Once
+	stopErr   error
+	lifecycle dxAppLifecycle
+	// started are the subsystems a start has started so far, in order, for unwindStart
+	started []string
 }
 
+// Run runs the app, or the command of the arguments then exits with its exit code when it is not 0.
 func (a *DXApp) Run() error {
+	exitCode, err := a.run()
+	if exitCode != 0 {
+		os.Exit(exitCode)
+	}
+	return err
+}
+
+// run is Run giving the exit code of the command instead of exiting with it.
+func (a *DXApp) run() (exitCode int, err error) {
 	if a.OnDefine != nil {
-		err := a.OnDefine()
+		err = a.OnDefine()
 		if err != nil {
 			log.Log.Error(err.Error())
-			return err
+			return 0, err
 		}
 	}
 	if a.OnDefineConfiguration != nil {
-		err := a.OnDefineConfiguration()
+		err = a.OnDefineConfiguration()
 		if err != nil {
 			log.Log.Error(err.Error())
-			return err
+			return 0, err
 		}
 	}
 	if a.OnDefineAPI != nil {
-		err := a.OnDefineAPI()
+		err = a.OnDefineAPI()
 		if err != nil {
 			log.Log.Error(err.Error())
-			return err
+			return 0, err
 		}
 	}
 
-	err := a.execute()
+	command, err := a.ParseArgs(os.Args[1:])
 	if err != nil {
 		log.Log.Error(err.Error())
+		return 0, err
+	}
+	if command != nil {
+		exitCode, err = a.executeCommand(command)
+		if err != nil {
+			log.Log.Error(err.Error())
+		}
+		return exitCode, err
+	}
+
+	err = a.execute()
+	if err != nil {
+		log.Log.Error(err.Error())
+		return 0, err
+	}
+	return 0, nil
+}
+
+// start runs the hooks in this order: OnStarting, (configuration, redis, storage, metrics, tracing, features, outbox)
+// OnStartStorageReady,
+// (api, grpc, tasks) OnReady. OnExecute is called by execute() after start() returns. An error from OnReady stops the app,
+// any other error stops the subsystems already started, see unwindStart.
+func (a *DXApp) start() (err error) {
+	defer func() {
+		if err != nil {
+			a.unwindStart(err)
+		}
+	}()
+	v3.AppTitle = a.Title
+	v3.AppVersion = a.Version
+	v3.AppDescription = a.Description
+	if a.PanicPolicy != `` {
+		core.PanicPolicy = a.PanicPolicy
+	}
+	db.IsMaskingSensitiveValues = !a.IsSensitiveValuesUnmasked
+	err = a.applySettings()
+	if err != nil {
+		return err
+	}
+	_, err = a.ShutdownOrder()
+	if err != nil {
+		return err
+	}
+	a.emit(DXAppLifecycleEventStarting, ``, nil)
+	if a.OnStarting != nil {
+		err = a.OnStarting()
+		if err != nil {
+			return err
+		}
+	}
+	err = a.startDependencies()
+	if err != nil {
+		return err
+	}
+	a.IsAPIExist, err = loadSubsystem("api", nil)
+	if err != nil {
+		return err
+	}
+	if a.IsAPIExist {
+		if a.shutdownTimeout() > 0 {
+			api.Manager.ShutdownTimeout = a.shutdownTimeout()
+		}
+		api.Manager.IsDebug = a.IsDebug
+		api.Manager.DebugKey = a.DebugKey
+		api.Manager.AddressOverrides = a.Settings.APIAddresses
+		a.markStarted(`api`)
+		err = api.Manager.StartAll(a.RuntimeErrorGroup, a.RuntimeErrorGroupContext)
+		if err != nil {
+			return err
+		}
+		a.emit(DXAppLifecycleEventSubsystemStarted, `api`, nil)
+	}
+	a.IsGRPCExist, err = loadSubsystem("grpc", nil)
+	if err != nil {
 		return err
 	}
+	if a.IsGRPCExist {
+		if a.shutdownTimeout() > 0 {
+			grpc.Manager.ShutdownTimeout = a.shutdownTimeout()
+		}
+		a.markStarted(`grpc`)
+		err = grpc.Manager.StartAll(a.RuntimeErrorGroup, a.RuntimeErrorGroupContext)
+		if err != nil {
+			return err
+		}
+		a.emit(DXAppLifecycleEventSubsystemStarted, `grpc`, nil)
+	}
+	a.IsTaskExist, err = loadSubsystem("tasks", nil)
+	if err != nil {
+		return err
+	}
+
+	if a.IsTaskExist {
+		a.markStarted(`tasks`)
+		err = tasks.Manager.StartAll(a.RuntimeErrorGroup, a.RuntimeErrorGroupContext)
+		if err != nil {
+			return err
+		}
+		a.emit(DXAppLifecycleEventSubsystemStarted, `tasks`, nil)
+	}
+	if a.OnReady != nil {
+		err = a.OnReady()
+		if err != nil {
+			log.Log.Errorf("OnReady error, stopping (%v)", err)
+			errStop := a.Stop()
+			if errStop != nil {
+				log.Log.Errorf("Error in Stopping: (%v)", errStop)
+			}
+			return err
+		}
+	}
+	a.emit(DXAppLifecycleEventReady, ``, nil)
 	return nil
 }
 
-func (a *DXApp) start() (err error) {
+// loadSubsystem gives whether the subsystem of the configuration nameId is there and enabled, then loads it by load
+// when not nil. An absent or disabled one is skipped, one without data or failing load is a
+// configurations.ErrConfigInvalid naming nameId.
+func loadSubsystem(nameId string, load func(nameId string) (err error)) (isExist bool, err error) {
+	if !configurations.Manager.IsEnabled(nameId) {
+		return false, nil
+	}
+	_, err = configurations.Manager.Lookup(nameId)
+	if err == nil && load != nil {
+		err = load(nameId)
+	}
+	if err != nil {
+		err = configurations.InvalidError(nameId, err)
+		log.Log.Errorf("Configuration %s is unusable (%v)", nameId, err)
+		return false, err
+	}
+	return true, nil
+}
+
+// connectDependencies loads the configuration, sets the log sinks and connects redis, object storage, mail, the http
+// clients and storage with its tables. It starts none of the background services, the commands run on it alone, see
+// startDependencies.
+func (a *DXApp) connectDependencies() (err error) {
 	log.Log.Info(fmt.Sprintf("%v %v %v", a.Title, a.Version, a.Description))
+	db.IsDebug = a.IsDebug
 	err = configurations.Manager.Load()
 	if err != nil {
 		return err
 	}
-	_, a.IsRedisExist = configurations.Manager.Configurations["redis"]
-	if a.IsRedisExist {
-		err = redis.Manager.LoadFromConfiguration("redis")
+	_, err = loadSubsystem("log", func(nameId string) (err error) {
+		configuration, _ := configurations.Manager.Get(nameId)
+		return log.ApplyConfiguration(*configuration.Data)
+	})
+	if err != nil {
+		return err
+	}
+	err = tracing.Manager.ApplyConfigurations()
+	if err != nil {
+		return err
+	}
+	redisConfigurationNameIds := redis.EnabledConfigurationNameIds()
+	a.IsRedisExist = len(redisConfigurationNameIds) > 0
+	for _, v := range redisConfigurationNameIds {
+		_, err = loadSubsystem(v, redis.Manager.LoadFromConfiguration)
 		if err != nil {
 			return err
 		}
 	}
-	_, a.IsStorageExist = configurations.Manager.Configurations["storage"]
-	if a.IsStorageExist {
-		err = databases.Manager.LoadFromConfiguration("storage")
+	a.IsStorageExist, err = loadSubsystem("storage", databases.Manager.LoadFromConfiguration)
+	if err != nil {
+		return err
+	}
+	a.IsOutboxExist, err = loadSubsystem("outbox", outbox.Manager.LoadFromConfiguration)
+	if err != nil {
+		return err
+	}
+	a.IsObjectStorageExist, err = loadSubsystem("objectstorage", func(nameId string) (err error) {
+		a.markStarted(`objectstorage`)
+		return objectstorage.Manager.LoadFromConfiguration(nameId)
+	})
+	if err != nil {
+		return err
+	}
+	a.IsMailExist, err = loadSubsystem("mail", func(nameId string) (err error) {
+		a.markStarted(`mail`)
+		return mail.Manager.LoadFromConfiguration(nameId)
+	})
+	if err != nil {
+		return err
+	}
+	a.IsFeaturesExist, err = loadSubsystem("features", flags.Manager.LoadFromConfiguration)
+	if err != nil {
+		return err
+	}
+	a.IsHTTPClientExist, err = loadSubsystem("httpclient", httpclient.Manager.LoadFromConfiguration)
+	if err != nil {
+		return err
+	}
+	if a.IsWaitForDependencies {
+		err = a.WaitForDependencies()
 		if err != nil {
 			return err
 		}
 	}
-	_, a.IsAPIExist = configurations.Manager.Configurations["api"]
-
 	if a.IsRedisExist {
-		err = redis.Manager.ConnectAllAtStart()
+		redis.Manager.SetErrorGroup(a.RuntimeErrorGroup, a.RuntimeErrorGroupContext)
+		a.markStarted(`redis`)
+		err = redis.Manager.ConnectAllAtStart(a.RuntimeErrorGroupContext)
 		if err != nil {
 			return err
 		}
+		// a Redis that is not required degrades instead, it does not make the app unready
+		for _, v := range redis.Manager.Redises {
+			if v.IsConnectAtStart && v.IsRequired {
+				health.Register("redis:"+v.NameId, v.HealthCheck)
+			}
+		}
+		a.emit(DXAppLifecycleEventSubsystemStarted, `redis`, nil)
 	}
 	if a.IsStorageExist {
-		err = databases.Manager.ConnectAllAtStart(`storage`)
+		a.markStarted(`storage`)
+		err = databases.Manager.ConnectAllAtStart(a.RuntimeErrorGroupContext, `storage`)
 		if err != nil {
 			return err
 		}
+		for _, v := range databases.Manager.Databases {
+			if v.IsConnectAtStart {
+				health.Register("storage:"+v.NameId, v.HealthCheck)
+			}
+		}
 		err := tables.Manager.ConnectAll()
 		if err != nil {
 			return err
 		}
-		if a.OnStartStorageReady != nil {
-			err = a.OnStartStorageReady()
+		err = tables.Manager.VerifyModels()
+		if err != nil {
+			return err
+		}
+		a.emit(DXAppLifecycleEventSubsystemStarted, `storage`, nil)
+		if a.IsOutboxExist {
+			err = outbox.Manager.CreateTableIfNotExist()
 			if err != nil {
 				return err
 			}
-
 		}
 	}
-	if a.IsAPIExist {
-		err = api.Manager.StartAll(a.RuntimeErrorGroup, a.RuntimeErrorGroupContext)
+	return nil
+}
+
+// startDependencies is connectDependencies then the background services of the dependencies, the metrics listener,
+// tracing, the refresh of the feature flags and the outbox relay, up to OnStartStorageReady.
+func (a *DXApp) startDependencies() (err error) {
+	err = a.connectDependencies()
+	if err != nil {
+		return err
+	}
+	if a.EnableMetrics {
+		metrics.Manager.IsEnabled = true
+		err = metrics.Manager.RegisterDBStats(func() map[string]metrics.DXMetricsDBStats {
+			r := map[string]metrics.DXMetricsDBStats{}
+			for k, v := range databases.Manager.AllStats() {
+				r[k] = metrics.DXMetricsDBStats{Role: databases.Manager.Databases[k].Role, Stats: v}
+			}
+			return r
+		})
+		if err != nil {
+			return err
+		}
+		err = metrics.Manager.RegisterRedisStats(func() map[string]metrics.DXMetricsRedisStats {
+			r := map[string]metrics.DXMetricsRedisStats{}
+			for k, v := range redis.Manager.PoolStats() {
+				r[k] = metrics.DXMetricsRedisStats{Hits: v.Hits, Misses: v.Misses, Timeouts: v.Timeouts, TotalConns: v.TotalConns,
+					IdleConns: v.IdleConns, StaleConns: v.StaleConns}
+			}
+			return r
+		})
+		if err != nil {
+			return err
+		}
+		err = metrics.Manager.RegisterCircuitBreakerStats(func() map[string]metrics.DXMetricsCircuitBreakerStats {
+			r := map[string]metrics.DXMetricsCircuitBreakerStats{}
+			for k, v := range breaker.Manager.AllStats() {
+				r[k] = metrics.DXMetricsCircuitBreakerStats{State: int(v.State), Rejections: v.Rejections}
+			}
+			return r
+		})
+		if err != nil {
+			return err
+		}
+		err = metrics.Manager.StartAll(a.RuntimeErrorGroup, a.RuntimeErrorGroupContext)
 		if err != nil {
 			return err
 		}
 	}
-	_, a.IsTaskExist = configurations.Manager.Configurations["tasks"]
-
-	if a.IsTaskExist {
-		err = tasks.Manager.StartAll(a.RuntimeErrorGroup, a.RuntimeErrorGroupContext)
+	a.markStarted(`tracing`)
+	err = tracing.Manager.Start(a.RuntimeErrorGroupContext)
+	if err != nil {
+		return err
+	}
+	if a.IsFeaturesExist {
+		err = flags.Manager.StartAll(a.RuntimeErrorGroup, a.RuntimeErrorGroupContext)
 		if err != nil {
 			return err
 		}
+		a.emit(DXAppLifecycleEventSubsystemStarted, `features`, nil)
+	}
+	if a.IsStorageExist {
+		if a.IsOutboxExist {
+			err = outbox.Manager.StartAll(a.RuntimeErrorGroup, a.RuntimeErrorGroupContext)
+			if err != nil {
+				return err
+			}
+			a.emit(DXAppLifecycleEventSubsystemStarted, `outbox`, nil)
+		}
+		if a.OnStartStorageReady != nil {
+			err = a.OnStartStorageReady()
+			if err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
-func (a *DXApp) Stop() (err error) {
-	log.Log.Info("Stopping")
-	if a.OnStopping != nil {
-		a.OnStopping()
-	}
-	if a.IsTaskExist {
-		err = tasks.Manager.StopAll()
-		if err != nil {
+func (a *DXApp) waitForDependency(name string, deadline time.Time, check func(ctx context.Context) error) (err error) {
+	backoff := DXAppWaitForDependenciesInitialBackoff
+	for attempt := 1; ; attempt++ {
+		log.Log.Infof("waiting for %s... (attempt %d)", name, attempt)
+		ctx, cancel := context.WithDeadline(a.RuntimeErrorGroupContext, deadline)
+		err = check(ctx)
+		cancel()
+		if err == nil {
+			log.Log.Infof("waiting for %s... done", name)
+			return nil
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			err = log.Log.ErrorAndCreateErrorf("Dependency %s is still not reachable, giving up (%v)", name, err)
 			return err
 		}
+		select {
+		case <-a.RuntimeErrorGroupContext.Done():
+			return a.RuntimeErrorGroupContext.Err()
+		case <-time.After(backoff):
+		}
+		backoff = backoff * 2
+		if backoff > DXAppWaitForDependenciesMaxBackoff {
+			backoff = DXAppWaitForDependenciesMaxBackoff
+		}
 	}
-	if a.IsAPIExist {
-		err = api.Manager.StopAll()
-		if err != nil {
-			return err
+}
+
+// WaitForDependencies blocks until every storage and required redis that is connected at start is reachable, bounded by WaitForDependenciesTimeoutSec.
+func (a *DXApp) WaitForDependencies() (err error) {
+	timeoutSec := a.WaitForDependenciesTimeoutSec
+	if timeoutSec <= 0 {
+		timeoutSec = DXAppWaitForDependenciesDefaultTimeoutSec
+	}
+	deadline := time.Now().Add(time.Duration(timeoutSec) * time.Second)
+	if a.IsStorageExist {
+		for _, v := range databases.Manager.Databases {
+			if !v.IsConnectAtStart {
+				continue
+			}
+			d := v
+			err = a.waitForDependency("storage "+d.NameId, deadline, d.CheckReachable)
+			if err != nil {
+				return err
+			}
 		}
 	}
 	if a.IsRedisExist {
-		err = redis.Manager.DisconnectAll()
+		for _, v := range redis.Manager.Redises {
+			// a Redis that is not required is reconnected in the background instead
+			if !v.IsConnectAtStart || !v.IsRequired {
+				continue
+			}
+			r := v
+			err = a.waitForDependency("redis "+r.NameId, deadline, r.CheckReachable)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Stop runs the teardown once, the signal handler and execute() may both call it, the later calls wait for it and get the
+// same result.
+func (a *DXApp) Stop() (err error) {
+	a.stopOnce.Do(func() {
+		a.stopErr = a.stop()
+	})
+	return a.stopErr
+}
+
+// subsystemStops are the teardowns of the subsystems by name, for stop and unwindStart.
+func (a *DXApp) subsystemStops() map[string]func() error {
+	return map[string]func() error{
+		`tasks`:         tasks.Manager.StopAll,
+		`api`:           api.Manager.StopAll,
+		`grpc`:          grpc.Manager.StopAll,
+		`redis`:         redis.Manager.DisconnectAll,
+		`storage`:       databases.Manager.DisconnectAll,
+		`objectstorage`: objectstorage.Manager.CloseAll,
+		`mail`:          mail.Manager.CloseAll,
+		`tracing`: func() error {
+			return tracing.Manager.Stop(context.Background())
+		},
+	}
+}
+
+// markStarted is called before a subsystem starts, a start failing half way may have opened part of it.
+func (a *DXApp) markStarted(subsystem string) {
+	a.started = append(a.started, subsystem)
+}
+
+// unwindStart stops the subsystems a failed start already started, in the reverse order, so a failed boot leaves no
+// connection open. The runtime is cancelled first for the servers and the workers to end.
+func (a *DXApp) unwindStart(cause error) {
+	if len(a.started) == 0 {
+		return
+	}
+	log.Log.Warnf("Start failed, stopping the subsystems started %v (%v)", a.started, cause)
+	core.RootContextCancel()
+	stops := a.subsystemStops()
+	for i := len(a.started) - 1; i >= 0; i-- {
+		v := a.started[i]
+		err := stops[v]()
 		if err != nil {
-			return err
+			log.Log.Errorf("Stopping %s after the failed start error (%v)", v, err)
 		}
+		a.emit(DXAppLifecycleEventSubsystemStopped, v, err)
 	}
-	if a.IsStorageExist {
-		err = databases.Manager.DisconnectAll()
+	a.started = nil
+}
+
+// stop runs every teardown step even when an earlier one fails, the errors of all of them are joined.
+func (a *DXApp) stop() (err error) {
+	a.started = nil
+	log.Log.Info("Stopping")
+	a.emit(DXAppLifecycleEventStopping, ``, nil)
+	errs := []error{}
+	step := func(name string, fn func() error) (err error) {
+		err = fn()
 		if err != nil {
-			return err
+			log.Log.Errorf("Stopping %s error (%v)", name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+		return err
+	}
+	if a.OnStopping != nil {
+		step("OnStopping", a.OnStopping)
+	}
+	order, err := a.ShutdownOrder()
+	if err != nil {
+		log.Log.Errorf("Stopping in the default order, the shutdown order is invalid (%v)", err)
+		order = DXAppDefaultShutdownOrder
+	}
+	isExist := map[string]bool{
+		`tasks`:         a.IsTaskExist,
+		`api`:           a.IsAPIExist,
+		`grpc`:          a.IsGRPCExist,
+		`redis`:         a.IsRedisExist,
+		`storage`:       a.IsStorageExist,
+		`objectstorage`: a.IsObjectStorageExist,
+		`mail`:          a.IsMailExist,
+		`tracing`:       true,
+	}
+	stops := a.subsystemStops()
+	for _, v := range order {
+		if isExist[v] {
+			a.emit(DXAppLifecycleEventSubsystemStopped, v, step(v, stops[v]))
 		}
 	}
+	err = errors.Join(errs...)
+	a.emit(DXAppLifecycleEventStopped, ``, err)
+	if err != nil {
+		return err
+	}
 	log.Log.Info("Stopped")
 	return nil
 }
@@ -197,8 +668,16 @@ func (a *DXApp) execute() (err error) {
 	a.RuntimeErrorGroup, a.RuntimeErrorGroupContext = errgroup.WithContext(core.RootContext)
 	err = a.start()
 	if err != nil {
+		a.emit(DXAppLifecycleEventStartFailed, ``, err)
 		return err
 	}
+	notifyRestartReady()
+	if a.IsLoop && a.IsGracefulRestart {
+		a.watchRestartSignal(a.RuntimeErrorGroupContext)
+	}
+	if a.IsLoop && api.Manager.IsTLS() {
+		a.watchReloadCertificateSignal(a.RuntimeErrorGroupContext)
+	}
 	if a.IsLoop {
 		defer func() {
 			err2 := a.Stop()
@@ -229,6 +708,26 @@ func (a *DXApp) execute() (err error) {
 	return nil
 }
 
+// Context is the context of the running app, done when any of its subsystems fails or the app is stopped, it is
+// core.RootContext before execute starts.
+func (a *DXApp) Context() context.Context {
+	if a.RuntimeErrorGroupContext == nil {
+		return core.RootContext
+	}
+	return a.RuntimeErrorGroupContext
+}
+
+// Go runs fn in the runtime error group like the built in subsystems, an error of fn stops the app and is returned by
+// Run. fn must return once Context() is done.
+func (a *DXApp) Go(fn func() error) (err error) {
+	if a.RuntimeErrorGroup == nil {
+		err = log.Log.ErrorAndCreateErrorf("Cannot run goroutine, the app is not started")
+		return err
+	}
+	a.RuntimeErrorGroup.Go(fn)
+	return nil
+}
+
 var App DXApp
 
 func Set(nameId, title, description string, isLoop bool, debugKey string) {
@@ -238,7 +737,7 @@ func Set(nameId, title, description string, isLoop bool, debugKey string) {
 	App.Description = description
 	App.IsLoop = isLoop
 	App.DebugKey = debugKey
-	App.IsDebug = os.Getenv("DEBUG_KEY") == debugKey
+	App.IsDebug = App.Settings.DebugKey == debugKey
 	log.Log.Prefix = nameId
 }
 
@@ -248,9 +747,17 @@ func GetNameId() string {
 func init() {
 	App = DXApp{
 		Args: DXAppArgs{
-			Commands: map[string]*DXAppArgCommand{},
-			Options:  map[string]*DXAppArgOption{},
+			Commands:          map[string]*DXAppArgCommand{},
+			Options:           map[string]*DXAppArgOption{},
+			OptionTypedValues: map[string]any{},
+			OptionValues:      map[string]string{},
+			Positionals:       []string{},
 		},
 		IsDebug: false,
 	}
+	App.settingsErr = BindSettings(&App.Settings)
+	App.AddCommand(`task`, `task run <name>: execute a single task once and exit`, commandTask)
+	App.AddCommand(`seed`, `seed <database> <dir> [truncate]: insert the fixtures of dir, only with APP_ENV=development`, commandSeed)
+	App.AddCommand(`migrate`, `migrate up <database> <dir> | migrate down <database> <steps>: apply the pending migrations of dir, or revert the last steps`, commandMigrate)
+	App.AddCommand(`preflight`, `preflight [json]: check the configuration and every dependency can be reached, exit 1 when any cannot`, commandPreflight).isWithoutDependencies = true
 }
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/configurations"
+	"dxlib/v3/core"
+	"dxlib/v3/databases"
+	"dxlib/v3/health"
+	"dxlib/v3/redis"
+	"dxlib/v3/utils"
+)
+
+func TestLoadSubsystemSkipsADisabledConfiguration(t *testing.T) {
+	setTestConfiguration(t, `storage`, utils.JSON{`enabled`: false, `main`: utils.JSON{`database_type`: `postgres`}})
+	isExist, err := loadSubsystem(`storage`, func(nameId string) error {
+		t.Errorf(`loaded the disabled %s`, nameId)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.False(t, isExist)
+
+	setTestConfiguration(t, `storage`, utils.JSON{`enabled`: true})
+	loaded := 0
+	isExist, err = loadSubsystem(`storage`, func(nameId string) error {
+		loaded++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.True(t, isExist)
+	assert.Equal(t, 1, loaded)
+
+	isExist, err = loadSubsystem(`storage`, func(nameId string) error {
+		return errors.New(`unusable`)
+	})
+	assert.ErrorIs(t, err, configurations.ErrConfigInvalid)
+	assert.False(t, isExist)
+
+	isExist, err = loadSubsystem(`not_configured`, nil)
+	require.NoError(t, err)
+	assert.False(t, isExist)
+}
+
+func TestLoadSubsystemOfAMalformedConfiguration(t *testing.T) {
+	// a database that is not a block fails before any is added to the manager
+	setTestConfiguration(t, `storage`, utils.JSON{`main`: `postgres://localhost`})
+	isExist, err := loadSubsystem(`storage`, databases.Manager.LoadFromConfiguration)
+	assert.ErrorIs(t, err, configurations.ErrConfigInvalid)
+	assert.ErrorContains(t, err, `ConfigInvalid:storage`)
+	assert.ErrorContains(t, err, `Cannot read main as JSON`)
+	assert.False(t, isExist)
+
+	configurations.Manager.Set(&configurations.DXConfiguration{NameId: `storage`})
+	isExist, err = loadSubsystem(`storage`, func(nameId string) error {
+		t.Errorf(`loaded %s without data`, nameId)
+		return nil
+	})
+	assert.EqualError(t, err, `ConfigInvalid:storage (NoData)`)
+	assert.False(t, isExist)
+}
+
+// setTestArgs sets the command line arguments of Run to args, restored at the end of the test.
+func setTestArgs(t *testing.T, args ...string) {
+	t.Helper()
+	osArgs := os.Args
+	os.Args = append([]string{`app`}, args...)
+	t.Cleanup(func() {
+		os.Args = osArgs
+	})
+}
+
+func TestErrorOfAGoroutineIsReturnedByRun(t *testing.T) {
+	setTestArgs(t)
+	errWorker := errors.New(`worker failed`)
+	a := newTestApp(t)
+	a.IsLoop = true
+	a.OnExecute = func() error {
+		assert.Same(t, a.RuntimeErrorGroupContext, a.Context())
+		return a.Go(func() error {
+			return errWorker
+		})
+	}
+
+	assert.ErrorIs(t, a.Run(), errWorker)
+	assert.Error(t, a.Context().Err())
+}
+
+func TestGoBeforeTheAppIsStarted(t *testing.T) {
+	a := newTestApp(t)
+	assert.Same(t, core.RootContext, a.Context())
+	assert.Error(t, a.Go(func() error {
+		return nil
+	}))
+}
+
+func TestAppBootsDegradedWithoutANonRequiredRedis(t *testing.T) {
+	address := closedAddress(t)
+	setTestConfiguration(t, `redis`, utils.JSON{`cache`: utils.JSON{`address`: address, `database_index`: float64(0),
+		`is_connect_at_start`: true, `required`: false}})
+	t.Cleanup(func() {
+		delete(redis.Manager.Redises, `cache`)
+		health.Manager.Unregister(`redis:cache`)
+	})
+	a := newTestApp(t)
+	t.Cleanup(func() {
+		assert.NoError(t, a.Stop())
+	})
+	isExecuted := false
+	a.OnExecute = func() error {
+		isExecuted = true
+		assert.Equal(t, []string{`cache`}, redis.Manager.DegradedRedises())
+		_, err := redis.Manager.Redises[`cache`].Get(`key`)
+		assert.Error(t, err)
+
+		// Redis is back, the background reconnect takes it out of the degraded ones
+		m := miniredis.NewMiniRedis()
+		require.NoError(t, m.StartAddr(address))
+		t.Cleanup(m.Close)
+		require.Eventually(t, func() bool {
+			return len(redis.Manager.DegradedRedises()) == 0
+		}, 10*time.Second, 50*time.Millisecond)
+		return nil
+	}
+
+	require.NoError(t, a.execute())
+	assert.True(t, isExecuted)
+}
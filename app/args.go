@@ -0,0 +1,322 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"dxlib/v3/core"
+	"dxlib/v3/databases"
+	"dxlib/v3/log"
+	"dxlib/v3/tasks"
+)
+
+// DXAppCommandContext is given to a command callback. A non zero ExitCode set by the command ends the process with it
+// once the app is stopped, an error without ExitCode is returned by Run.
+type DXAppCommandContext struct {
+	App         *DXApp
+	Command     *DXAppArgCommand
+	Context     context.Context
+	Positionals []string
+	Options     map[string]string
+	Stdout      io.Writer
+	Stderr      io.Writer
+	ExitCode    int
+}
+
+func (cc *DXAppCommandContext) Printf(format string, args ...any) {
+	_, _ = fmt.Fprintf(cc.Stdout, format, args...)
+}
+
+// PrintJSON writes v indented to Stdout, for the commands whose output is read by other programs.
+func (cc *DXAppCommandContext) PrintJSON(v any) (err error) {
+	e := json.NewEncoder(cc.Stdout)
+	e.SetIndent(``, `  `)
+	return e.Encode(v)
+}
+
+func (a *DXApp) AddCommand(command string, name string, callback DXAppArgCommandFunc) *DXAppArgCommand {
+	c := DXAppArgCommand{
+		name:     name,
+		command:  command,
+		callback: &callback,
+	}
+	a.Args.Commands[command] = &c
+	return &c
+}
+
+func (a *DXApp) AddOption(option string, name string, callback DXAppArgOptionFunc) *DXAppArgOption {
+	o := DXAppArgOption{
+		name:     name,
+		option:   option,
+		callback: &callback,
+	}
+	a.Args.Options[option] = &o
+	return &o
+}
+
+// WithType makes ParseArgs fail when the value of the option is not of valueType, the callbacks then get the value
+// parsed, like an int for DXAppArgOptionTypeInt.
+func (o *DXAppArgOption) WithType(valueType DXAppArgOptionType) *DXAppArgOption {
+	o.valueType = valueType
+	return o
+}
+
+func (t DXAppArgOptionType) String() string {
+	switch t {
+	case DXAppArgOptionTypeInt:
+		return `integer`
+	case DXAppArgOptionTypeBool:
+		return `boolean`
+	case DXAppArgOptionTypeDuration:
+		return `duration`
+	default:
+		return `string`
+	}
+}
+
+func parseOptionValue(valueType DXAppArgOptionType, s string) (v any, err error) {
+	switch valueType {
+	case DXAppArgOptionTypeInt:
+		return strconv.Atoi(s)
+	case DXAppArgOptionTypeBool:
+		return strconv.ParseBool(s)
+	case DXAppArgOptionTypeDuration:
+		return time.ParseDuration(s)
+	default:
+		return s, nil
+	}
+}
+
+// typedValue gives the value of the option as valueType, parsing it again when the option is of another type.
+func (o *DXAppArgOption) typedValue(valueType DXAppArgOptionType) (v any, err error) {
+	if !o.isSet {
+		return nil, fmt.Errorf("OptionNotSet:%s", o.option)
+	}
+	if valueType == o.valueType {
+		return o.value, nil
+	}
+	v, err = parseOptionValue(valueType, o.rawValue)
+	if err != nil {
+		return nil, fmt.Errorf("OptionNotOfType:%s:expected %s:%s", o.option, valueType, o.rawValue)
+	}
+	return v, nil
+}
+
+// IsSet is true once ParseArgs has read the option.
+func (o *DXAppArgOption) IsSet() bool {
+	return o.isSet
+}
+
+func (o *DXAppArgOption) AsString() (v string, err error) {
+	if !o.isSet {
+		return ``, fmt.Errorf("OptionNotSet:%s", o.option)
+	}
+	return o.rawValue, nil
+}
+
+func (o *DXAppArgOption) AsInt() (v int, err error) {
+	x, err := o.typedValue(DXAppArgOptionTypeInt)
+	if err != nil {
+		return 0, err
+	}
+	return x.(int), nil
+}
+
+func (o *DXAppArgOption) AsBool() (v bool, err error) {
+	x, err := o.typedValue(DXAppArgOptionTypeBool)
+	if err != nil {
+		return false, err
+	}
+	return x.(bool), nil
+}
+
+func (o *DXAppArgOption) AsDuration() (v time.Duration, err error) {
+	x, err := o.typedValue(DXAppArgOptionTypeDuration)
+	if err != nil {
+		return 0, err
+	}
+	return x.(time.Duration), nil
+}
+
+// ParseArgs reads `--option=value`, `--option value` (a flag alone or followed by another option is "true") and the
+// positionals. When the first positional is a registered command it is returned with the rest of the positionals in
+// Args.Positionals, otherwise command is nil and the app runs as usual. Unknown options are ignored, the value of an
+// option not of the type of the option is an error. A boolean option only takes the next arg when it is a boolean.
+func (a *DXApp) ParseArgs(args []string) (command *DXAppArgCommand, err error) {
+	positionals := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == `--` {
+			positionals = append(positionals, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, `-`) || arg == `-` {
+			positionals = append(positionals, arg)
+			continue
+		}
+		key := strings.TrimLeft(arg, `-`)
+		value := `true`
+		hasValue := false
+		if k, v, ok := strings.Cut(key, `=`); ok {
+			key = k
+			value = v
+			hasValue = true
+		}
+		o, ok := a.Args.Options[key]
+		if !ok {
+			log.Log.Warnf("Unknown option %s is ignored", arg)
+			continue
+		}
+		if !hasValue && (i+1 < len(args)) && !strings.HasPrefix(args[i+1], `-`) {
+			_, errBool := strconv.ParseBool(args[i+1])
+			if o.valueType != DXAppArgOptionTypeBool || errBool == nil {
+				i++
+				value = args[i]
+			}
+		}
+		typedValue, err := parseOptionValue(o.valueType, value)
+		if err != nil {
+			err = log.Log.ErrorAndCreateErrorf("Option --%s expected %s but got %q", key, o.valueType, value)
+			return nil, err
+		}
+		o.isSet = true
+		o.rawValue = value
+		o.value = typedValue
+		a.Args.OptionValues[key] = value
+		a.Args.OptionTypedValues[key] = typedValue
+		if o.callback != nil && *o.callback != nil {
+			err = (*o.callback)(a, o, typedValue)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(positionals) > 0 {
+		c, ok := a.Args.Commands[positionals[0]]
+		if ok {
+			a.Args.Positionals = positionals[1:]
+			return c, nil
+		}
+	}
+	a.Args.Positionals = positionals
+	return nil, nil
+}
+
+func (a *DXApp) newCommandContext(command *DXAppArgCommand) *DXAppCommandContext {
+	cc := &DXAppCommandContext{
+		App:         a,
+		Command:     command,
+		Context:     a.RuntimeErrorGroupContext,
+		Positionals: a.Args.Positionals,
+		Options:     a.Args.OptionValues,
+		Stdout:      a.Stdout,
+		Stderr:      a.Stderr,
+	}
+	if cc.Stdout == nil {
+		cc.Stdout = os.Stdout
+	}
+	if cc.Stderr == nil {
+		cc.Stderr = os.Stderr
+	}
+	return cc
+}
+
+// executeCommand connects the configuration, redis and storage like start() does, see connectDependencies, but starts
+// none of their background services, nor the api, the tasks or the loop, then calls the command and stops. A command
+// isWithoutDependencies is called at once, it connects what it needs itself. exitCode is the ExitCode set by the
+// command.
+func (a *DXApp) executeCommand(command *DXAppArgCommand) (exitCode int, err error) {
+	defer core.RootContextCancel()
+	a.RuntimeErrorGroup, a.RuntimeErrorGroupContext = errgroup.WithContext(core.RootContext)
+	log.Log.Infof("Executing command %s %v", command.command, a.Args.Positionals)
+	if command.callback == nil || *command.callback == nil {
+		return 0, nil
+	}
+	if command.isWithoutDependencies {
+		cc := a.newCommandContext(command)
+		err = (*command.callback)(cc)
+		return cc.ExitCode, err
+	}
+	err = a.connectDependencies()
+	if err != nil {
+		a.unwindStart(err)
+		return 0, err
+	}
+	defer func() {
+		errStop := a.Stop()
+		if errStop != nil {
+			log.Log.Errorf("Error in Stopping: (%v)", errStop)
+		}
+	}()
+	cc := a.newCommandContext(command)
+	err = (*command.callback)(cc)
+	return cc.ExitCode, err
+}
+
+func commandTask(cc *DXAppCommandContext) (err error) {
+	if len(cc.Positionals) != 2 || cc.Positionals[0] != `run` {
+		err = log.Log.ErrorAndCreateErrorf("Usage: %s", cc.Command.name)
+		return err
+	}
+	return tasks.Manager.RunOnce(cc.Context, cc.Positionals[1])
+}
+
+func commandSeed(cc *DXAppCommandContext) (err error) {
+	n := len(cc.Positionals)
+	if n < 2 || n > 3 || (n == 3 && cc.Positionals[2] != `truncate`) {
+		err = log.Log.ErrorAndCreateErrorf("Usage: %s", cc.Command.name)
+		return err
+	}
+	d, ok := databases.Manager.Databases[cc.Positionals[0]]
+	if !ok {
+		err = log.Log.ErrorAndCreateErrorf("Database %s not found", cc.Positionals[0])
+		return err
+	}
+	l := log.NewLog(&log.Log, cc.Context, `seed`)
+	rowsAffected, err := d.Seed(&l, cc.Positionals[1], databases.DXDatabaseSeedOptions{IsTruncated: n == 3})
+	if err != nil {
+		return err
+	}
+	cc.Printf("Seeded %d rows into database %s\n", rowsAffected, d.NameId)
+	return nil
+}
+
+func commandMigrate(cc *DXAppCommandContext) (err error) {
+	if len(cc.Positionals) != 3 || (cc.Positionals[0] != `up` && cc.Positionals[0] != `down`) {
+		err = log.Log.ErrorAndCreateErrorf("Usage: %s", cc.Command.name)
+		return err
+	}
+	d, ok := databases.Manager.Databases[cc.Positionals[1]]
+	if !ok {
+		err = log.Log.ErrorAndCreateErrorf("Database %s not found", cc.Positionals[1])
+		return err
+	}
+	l := log.NewLog(&log.Log, cc.Context, `migrate`)
+	if cc.Positionals[0] == `up` {
+		applied, err := d.Migrate(&l, cc.Positionals[2])
+		if err != nil {
+			return err
+		}
+		cc.Printf("Applied %d migrations to database %s\n", applied, d.NameId)
+		return nil
+	}
+	steps, err := strconv.Atoi(cc.Positionals[2])
+	if err != nil {
+		err = log.Log.ErrorAndCreateErrorf("Invalid steps %s", cc.Positionals[2])
+		return err
+	}
+	rolledBack, err := d.Rollback(&l, steps)
+	if err != nil {
+		return err
+	}
+	cc.Printf("Rolled back %d migrations of database %s\n", rolledBack, d.NameId)
+	return nil
+}
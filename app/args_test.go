@@ -0,0 +1,184 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+
+	"dxlib/v3/core"
+	"dxlib/v3/databases"
+	"dxlib/v3/health"
+	"dxlib/v3/metrics"
+	"dxlib/v3/redis"
+	"dxlib/v3/tracing"
+	"dxlib/v3/utils"
+)
+
+// newTestApp gives an app without any command, its runs cancelling a root context of the test only.
+func newTestApp(t *testing.T) *DXApp {
+	t.Helper()
+	rootContext, rootContextCancel := core.RootContext, core.RootContextCancel
+	core.RootContext, core.RootContextCancel = context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		core.RootContextCancel()
+		core.RootContext, core.RootContextCancel = rootContext, rootContextCancel
+	})
+	return &DXApp{Args: DXAppArgs{
+		Commands:          map[string]*DXAppArgCommand{},
+		Options:           map[string]*DXAppArgOption{},
+		OptionTypedValues: map[string]any{},
+		OptionValues:      map[string]string{},
+		Positionals:       []string{},
+	}}
+}
+
+func TestExecuteCommandWithoutCallback(t *testing.T) {
+	a := newTestApp(t)
+	exitCode, err := a.executeCommand(a.AddCommand(`noop`, `noop`, nil))
+	require.NoError(t, err)
+	assert.Equal(t, 0, exitCode)
+
+	c := a.AddCommand(`noop_without_dependencies`, `noop`, nil)
+	c.isWithoutDependencies = true
+	exitCode, err = a.executeCommand(c)
+	require.NoError(t, err)
+	assert.Equal(t, 0, exitCode)
+}
+
+func TestExecuteCommandConnectsWithoutTheBackgroundServices(t *testing.T) {
+	m := miniredis.RunT(t)
+	setTestConfiguration(t, `redis`, utils.JSON{`cache`: utils.JSON{`address`: m.Addr(), `database_index`: float64(0),
+		`is_connect_at_start`: true}})
+	t.Cleanup(func() {
+		delete(redis.Manager.Redises, `cache`)
+		health.Manager.Unregister(`redis:cache`)
+	})
+	a := newTestApp(t)
+	a.EnableMetrics = true
+
+	isCalled := false
+	exitCode, err := a.executeCommand(a.AddCommand(`check`, `check`, func(cc *DXAppCommandContext) error {
+		isCalled = true
+		assert.True(t, redis.Manager.Redises[`cache`].Connected)
+		assert.False(t, metrics.Manager.IsEnabled)
+		assert.Nil(t, tracing.Manager.TracerProvider)
+		cc.ExitCode = 3
+		return nil
+	}))
+	require.NoError(t, err)
+	assert.True(t, isCalled)
+	assert.Equal(t, 3, exitCode)
+	assert.False(t, redis.Manager.Redises[`cache`].Connected)
+}
+
+func TestRunGivesTheExitCodeOfTheCommand(t *testing.T) {
+	setTestArgs(t, `version`, `json`)
+	a := newTestApp(t)
+	b := &bytes.Buffer{}
+	a.Stdout = b
+	a.AddCommand(`version`, `version [json]`, func(cc *DXAppCommandContext) error {
+		assert.Same(t, a, cc.App)
+		assert.Equal(t, []string{`json`}, cc.Positionals)
+		cc.ExitCode = 2
+		return cc.PrintJSON(utils.JSON{`version`: `1.2.3`})
+	})
+
+	exitCode, err := a.run()
+	require.NoError(t, err)
+	assert.Equal(t, 2, exitCode)
+	assert.JSONEq(t, `{"version":"1.2.3"}`, b.String())
+}
+
+func TestParseArgsOfABadInteger(t *testing.T) {
+	a := newTestApp(t)
+	isCalled := false
+	a.AddOption(`workers`, `workers`, func(a *DXApp, o *DXAppArgOption, v any) error {
+		isCalled = true
+		return nil
+	}).WithType(DXAppArgOptionTypeInt)
+
+	_, err := a.ParseArgs([]string{`--workers`, `abc`})
+	assert.ErrorContains(t, err, `expected integer`)
+	assert.False(t, isCalled)
+	assert.False(t, a.Args.Options[`workers`].IsSet())
+	_, err = a.Args.Options[`workers`].AsInt()
+	assert.ErrorContains(t, err, `OptionNotSet:workers`)
+}
+
+func TestParseArgsOfADuration(t *testing.T) {
+	a := newTestApp(t)
+	var values []any
+	a.AddOption(`timeout`, `timeout`, func(a *DXApp, o *DXAppArgOption, v any) error {
+		values = append(values, v)
+		return nil
+	}).WithType(DXAppArgOptionTypeDuration)
+	a.AddOption(`workers`, `workers`, nil)
+
+	command, err := a.ParseArgs([]string{`--timeout=1m30s`, `--workers`, `4`, `rest`})
+	require.NoError(t, err)
+	assert.Nil(t, command)
+	assert.Equal(t, []any{90 * time.Second}, values)
+	assert.Equal(t, 90*time.Second, a.Args.OptionTypedValues[`timeout`])
+	assert.Equal(t, `1m30s`, a.Args.OptionValues[`timeout`])
+	assert.Equal(t, []string{`rest`}, a.Args.Positionals)
+
+	d, err := a.Args.Options[`timeout`].AsDuration()
+	require.NoError(t, err)
+	assert.Equal(t, 90*time.Second, d)
+	_, err = a.Args.Options[`timeout`].AsInt()
+	assert.ErrorContains(t, err, `OptionNotOfType:timeout:expected integer`)
+	// an option without a type is a string, read as another type on demand
+	n, err := a.Args.Options[`workers`].AsInt()
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+}
+
+func TestSeedCommandUsage(t *testing.T) {
+	for _, positionals := range [][]string{{`storage`}, {`storage`, `fixtures`, `drop`}} {
+		_, _, err := runTestSeed(positionals...)
+		assert.ErrorContains(t, err, `Usage: seed`)
+	}
+	_, _, err := runTestSeed(`absent`, `fixtures`)
+	assert.ErrorContains(t, err, `Database absent not found`)
+}
+
+func TestSeedCommand(t *testing.T) {
+	t.Setenv(databases.DXDatabaseSeedEnvironmentVariable, databases.DXDatabaseSeedEnvironment)
+	connection, err := sqlx.Open(`sqlite`, filepath.Join(t.TempDir(), `seed.db`))
+	require.NoError(t, err)
+	_, err = connection.Exec(`CREATE TABLE orgs (id INTEGER PRIMARY KEY, name TEXT NOT NULL)`)
+	require.NoError(t, err)
+	d := databases.Manager.NewDatabase(`test_seed`, false, false)
+	d.Connection = connection
+	d.Connected = true
+	t.Cleanup(func() {
+		_ = connection.Close()
+		delete(databases.Manager.Databases, `test_seed`)
+	})
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, `orgs.json`), []byte(`[{"id": 1, "name": "acme"}, {"id": 2, "name": "globex"}]`), 0o600))
+
+	for i := 0; i < 2; i++ {
+		_, output, err := runTestSeed(`test_seed`, dir, `truncate`)
+		require.NoError(t, err)
+		assert.Equal(t, "Seeded 2 rows into database test_seed\n", output)
+	}
+}
+
+// runTestSeed runs the seed command with positionals, giving its output.
+func runTestSeed(positionals ...string) (cc *DXAppCommandContext, output string, err error) {
+	b := &bytes.Buffer{}
+	cc = &DXAppCommandContext{App: &DXApp{}, Command: &DXAppArgCommand{name: `seed <database> <dir> [truncate]`},
+		Context: context.Background(), Positionals: positionals, Stdout: b, Stderr: b}
+	err = commandSeed(cc)
+	return cc, b.String(), err
+}
@@ -0,0 +1,85 @@
+package app
+
+import (
+	"sync"
+	"time"
+
+	"dxlib/v3/log"
+)
+
+type DXAppLifecycleEventType string
+
+const (
+	DXAppLifecycleEventStarting         DXAppLifecycleEventType = `starting`
+	DXAppLifecycleEventSubsystemStarted DXAppLifecycleEventType = `subsystem_started`
+	DXAppLifecycleEventReady            DXAppLifecycleEventType = `ready`
+	DXAppLifecycleEventStartFailed      DXAppLifecycleEventType = `start_failed`
+	DXAppLifecycleEventStopping         DXAppLifecycleEventType = `stopping`
+	DXAppLifecycleEventSubsystemStopped DXAppLifecycleEventType = `subsystem_stopped`
+	DXAppLifecycleEventStopped          DXAppLifecycleEventType = `stopped`
+)
+
+// DXAppLifecycleSubscriberBufferSize is the number of events queued for a subscriber, the next ones are dropped until it
+// catches up.
+const DXAppLifecycleSubscriberBufferSize = 64
+
+// DXAppLifecycleEvent is a transition of the app, Subsystem is the name of the subsystem of a subsystem event, like
+// redis or api, and Error the error of a failed start or stop.
+type DXAppLifecycleEvent struct {
+	Type      DXAppLifecycleEventType
+	Subsystem string
+	Error     error
+	Time      time.Time
+}
+
+type DXAppLifecycleSubscriberFunc func(e DXAppLifecycleEvent)
+
+type dxAppLifecycle struct {
+	mutex       sync.Mutex
+	subscribers map[int]chan DXAppLifecycleEvent
+	nextId      int
+}
+
+// Subscribe calls fn with every lifecycle event, in order, from a goroutine of its own so a slow fn cannot stall the
+// app. unsubscribe stops the calls once the queued events are delivered.
+func (a *DXApp) Subscribe(fn DXAppLifecycleSubscriberFunc) (unsubscribe func()) {
+	events := make(chan DXAppLifecycleEvent, DXAppLifecycleSubscriberBufferSize)
+	l := &a.lifecycle
+	l.mutex.Lock()
+	if l.subscribers == nil {
+		l.subscribers = map[int]chan DXAppLifecycleEvent{}
+	}
+	id := l.nextId
+	l.nextId++
+	l.subscribers[id] = events
+	l.mutex.Unlock()
+	go func() {
+		for e := range events {
+			fn(e)
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mutex.Lock()
+			defer l.mutex.Unlock()
+			delete(l.subscribers, id)
+			close(events)
+		})
+	}
+}
+
+// emit queues the event for every subscriber without waiting, it is dropped for the subscribers whose queue is full.
+func (a *DXApp) emit(eventType DXAppLifecycleEventType, subsystem string, err error) {
+	e := DXAppLifecycleEvent{Type: eventType, Subsystem: subsystem, Error: err, Time: time.Now()}
+	l := &a.lifecycle
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, events := range l.subscribers {
+		select {
+		case events <- e:
+		default:
+			log.Log.Warnf("Lifecycle event %s %s dropped, a subscriber is too slow", eventType, subsystem)
+		}
+	}
+}
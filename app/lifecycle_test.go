@@ -0,0 +1,85 @@
+package app
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/health"
+	"dxlib/v3/redis"
+	"dxlib/v3/utils"
+)
+
+func TestLifecycleEventsOfAStartAndStop(t *testing.T) {
+	m := miniredis.RunT(t)
+	setTestConfiguration(t, `redis`, utils.JSON{`cache`: utils.JSON{`address`: m.Addr(), `database_index`: float64(0),
+		`is_connect_at_start`: true}})
+	t.Cleanup(func() {
+		delete(redis.Manager.Redises, `cache`)
+		health.Manager.Unregister(`redis:cache`)
+	})
+	setTestConfiguration(t, `api`, utils.JSON{`lifecycle`: utils.JSON{`address`: `127.0.0.1:0`}})
+	newTestPreflightAPI(t, `lifecycle`)
+	a := newTestApp(t)
+	l := recordTestLifecycle(t, a)
+
+	require.NoError(t, a.execute())
+	assert.Equal(t, []string{`starting`, `subsystem_started:redis`, `subsystem_started:api`, `ready`},
+		l.waitFor(t, DXAppLifecycleEventReady))
+	require.NoError(t, a.Stop())
+	assert.Equal(t, []string{`starting`, `subsystem_started:redis`, `subsystem_started:api`, `ready`, `stopping`,
+		`subsystem_stopped:api`, `subsystem_stopped:redis`, `subsystem_stopped:tracing`, `stopped`},
+		l.waitFor(t, DXAppLifecycleEventStopped))
+}
+
+func TestLifecycleSlowSubscriberDoesNotStallTheApp(t *testing.T) {
+	a := newTestApp(t)
+	release := make(chan struct{})
+	t.Cleanup(func() {
+		close(release)
+	})
+	t.Cleanup(a.Subscribe(func(e DXAppLifecycleEvent) {
+		<-release
+	}))
+	l := recordTestLifecycle(t, a)
+
+	startTime := time.Now()
+	for i := 0; i < 2*DXAppLifecycleSubscriberBufferSize; i++ {
+		a.emit(DXAppLifecycleEventSubsystemStarted, `redis`, nil)
+	}
+	a.emit(DXAppLifecycleEventReady, ``, nil)
+	assert.Less(t, time.Since(startTime), time.Second)
+	// the other subscriber is not held back by the slow one, it drops the events it has no room for
+	events := l.waitFor(t, DXAppLifecycleEventSubsystemStarted)
+	assert.Equal(t, `subsystem_started:redis`, events[0])
+}
+
+func TestFailedAPIStartDisconnectsWhatWasStarted(t *testing.T) {
+	m := miniredis.RunT(t)
+	setTestConfiguration(t, `redis`, utils.JSON{`cache`: utils.JSON{`address`: m.Addr(), `database_index`: float64(0),
+		`is_connect_at_start`: true}})
+	t.Cleanup(func() {
+		delete(redis.Manager.Redises, `cache`)
+		health.Manager.Unregister(`redis:cache`)
+	})
+	inUse, err := net.Listen(`tcp`, `127.0.0.1:0`)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = inUse.Close()
+	})
+	setTestConfiguration(t, `api`, utils.JSON{`in_use`: utils.JSON{`address`: inUse.Addr().String()}})
+	newTestPreflightAPI(t, `in_use`)
+	a := newTestApp(t)
+	l := recordTestLifecycle(t, a)
+
+	assert.Error(t, a.execute())
+	assert.False(t, redis.Manager.Redises[`cache`].Connected)
+	assert.Empty(t, a.started)
+	// the API is unwound first, then the subsystems started before it in the reverse order
+	assert.Equal(t, []string{`starting`, `subsystem_started:redis`, `subsystem_stopped:api`, `subsystem_stopped:tracing`,
+		`subsystem_stopped:redis`, `start_failed`}, l.waitFor(t, DXAppLifecycleEventStartFailed))
+}
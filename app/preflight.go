@@ -0,0 +1,203 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"dxlib/v3/api"
+	"dxlib/v3/configurations"
+	"dxlib/v3/databases"
+	"dxlib/v3/flags"
+	"dxlib/v3/health"
+	"dxlib/v3/httpclient"
+	"dxlib/v3/log"
+	"dxlib/v3/mail"
+	"dxlib/v3/objectstorage"
+	"dxlib/v3/outbox"
+	"dxlib/v3/redis"
+)
+
+const (
+	DXAppPreflightDefaultTimeoutSec = 5
+	// DXAppPreflightObjectStorageProbeKey is the key an object storage is asked whether it exists, to reach it
+	DXAppPreflightObjectStorageProbeKey = `.preflight`
+)
+
+// ErrPreflightFailed is the error of a Preflight with any of its checks failed.
+var ErrPreflightFailed = errors.New("PreflightFailed")
+
+// DXAppPreflightReport is the result of every check of Preflight by name, like configuration:storage, storage:main,
+// redis:redis or health:<the name it is registered with>.
+type DXAppPreflightReport struct {
+	IsPassed bool                                  `json:"is_passed"`
+	Results  map[string]health.DXHealthCheckResult `json:"results"`
+}
+
+// Names are the names of the checks sorted, failed ones first.
+func (r DXAppPreflightReport) Names() (names []string) {
+	for k := range r.Results {
+		names = append(names, k)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		isFailedI := r.Results[names[i]].Status != health.DXHealthStatusOk
+		isFailedJ := r.Results[names[j]].Status != health.DXHealthStatusOk
+		if isFailedI != isFailedJ {
+			return isFailedI
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+func (r DXAppPreflightReport) FailedNames() (names []string) {
+	for _, v := range r.Names() {
+		if r.Results[v].Status != health.DXHealthStatusOk {
+			names = append(names, v)
+		}
+	}
+	return names
+}
+
+// preflightTimeout is PreflightTimeoutSec, the bound of each connection attempt and health check of Preflight.
+func (a *DXApp) preflightTimeout() time.Duration {
+	if a.PreflightTimeoutSec > 0 {
+		return time.Duration(a.PreflightTimeoutSec) * time.Second
+	}
+	return time.Duration(DXAppPreflightDefaultTimeoutSec) * time.Second
+}
+
+// Preflight checks the app could start without starting it: it loads and validates the settings and the configuration
+// of every subsystem, applies the configuration of every API defined with its certificate, as api:<name id>, attempts a
+// throwaway connection to every database, Redis and object storage configured, and runs the registered health checks,
+// each bounded by PreflightTimeoutSec. The api, grpc, tasks and the loop are not started. Every check runs even when an
+// earlier one fails, err is an ErrPreflightFailed naming the failed ones.
+func (a *DXApp) Preflight(ctx context.Context) (report DXAppPreflightReport, err error) {
+	report.Results = map[string]health.DXHealthCheckResult{}
+	record := func(name string, err error) {
+		if err != nil {
+			report.Results[name] = health.DXHealthCheckResult{Status: health.DXHealthStatusFail, Error: err.Error()}
+			return
+		}
+		report.Results[name] = health.DXHealthCheckResult{Status: health.DXHealthStatusOk}
+	}
+	defer func() {
+		report.IsPassed = len(report.FailedNames()) == 0
+		if !report.IsPassed {
+			err = fmt.Errorf("%w:%s", ErrPreflightFailed, strings.Join(report.FailedNames(), `,`))
+		}
+	}()
+
+	record(`settings`, a.applySettings())
+	_, errOrder := a.ShutdownOrder()
+	record(`shutdown_order`, errOrder)
+	errLoad := configurations.Manager.Load()
+	record(`configuration`, errLoad)
+	if errLoad != nil {
+		return report, nil
+	}
+	nameIds := append([]string{`log`}, redis.EnabledConfigurationNameIds()...)
+	nameIds = append(nameIds, `storage`, `outbox`, `objectstorage`, `mail`, `features`, `httpclient`, `api`, `grpc`, `tasks`)
+	loads := map[string]func(nameId string) (err error){
+		`log`: func(nameId string) (err error) {
+			configuration, _ := configurations.Manager.Get(nameId)
+			return log.ApplyConfiguration(*configuration.Data)
+		},
+		`storage`:       databases.Manager.LoadFromConfiguration,
+		`outbox`:        outbox.Manager.LoadFromConfiguration,
+		`objectstorage`: objectstorage.Manager.LoadFromConfiguration,
+		`mail`:          mail.Manager.LoadFromConfiguration,
+		`features`:      flags.Manager.LoadFromConfiguration,
+		`httpclient`:    httpclient.Manager.LoadFromConfiguration,
+	}
+	isExist := map[string]bool{}
+	for _, v := range nameIds {
+		load, ok := loads[v]
+		if !ok && strings.HasPrefix(v, `redis`) {
+			load = redis.Manager.LoadFromConfiguration
+		}
+		var errSubsystem error
+		isExist[v], errSubsystem = loadSubsystem(v, load)
+		if isExist[v] || errSubsystem != nil {
+			record(`configuration:`+v, errSubsystem)
+		}
+	}
+	if isExist[`api`] {
+		api.Manager.AddressOverrides = a.Settings.APIAddresses
+		for _, v := range api.Manager.APIs {
+			record(`api:`+v.NameId, v.CheckConfiguration())
+		}
+	}
+	defer func() {
+		if isExist[`objectstorage`] {
+			_ = objectstorage.Manager.CloseAll()
+		}
+		if isExist[`mail`] {
+			_ = mail.Manager.CloseAll()
+		}
+	}()
+
+	// the connections are checked by their own health manager, the one of the app has the checks registered by the
+	// app only, the subsystems register theirs once connected
+	dependencies := health.DXHealthManager{CheckTimeout: a.preflightTimeout()}
+	for _, v := range databases.Manager.Databases {
+		dependencies.Register(`storage:`+v.NameId, v.CheckReachable)
+	}
+	for _, v := range redis.Manager.Redises {
+		dependencies.Register(`redis:`+v.NameId, v.CheckReachable)
+	}
+	for _, v := range objectstorage.Manager.ObjectStorages {
+		o := v
+		dependencies.Register(`objectstorage:`+o.NameId, func(ctx context.Context) (err error) {
+			_, err = o.Backend.Exists(ctx, DXAppPreflightObjectStorageProbeKey)
+			return err
+		})
+	}
+	_, results := dependencies.Check(ctx)
+	for k, v := range results {
+		report.Results[k] = v
+	}
+	healthCtx, cancel := context.WithTimeout(ctx, a.preflightTimeout())
+	defer cancel()
+	_, results = health.Manager.Check(healthCtx)
+	for k, v := range results {
+		report.Results[`health:`+k] = v
+	}
+	return report, nil
+}
+
+// commandPreflight prints the report of Preflight, one check a line, and exits with 1 when any check failed.
+func commandPreflight(cc *DXAppCommandContext) (err error) {
+	if len(cc.Positionals) > 1 || (len(cc.Positionals) == 1 && cc.Positionals[0] != `json`) {
+		err = log.Log.ErrorAndCreateErrorf("Usage: %s", cc.Command.name)
+		return err
+	}
+	report, err := cc.App.Preflight(cc.Context)
+	if err != nil {
+		cc.ExitCode = 1
+	}
+	if len(cc.Positionals) == 1 {
+		errPrint := cc.PrintJSON(report)
+		if errPrint != nil {
+			return errPrint
+		}
+		return err
+	}
+	for _, v := range report.Names() {
+		r := report.Results[v]
+		if r.Status == health.DXHealthStatusOk {
+			cc.Printf("PASS %s (%dms)\n", v, r.DurationMs)
+		} else {
+			cc.Printf("FAIL %s (%dms): %s\n", v, r.DurationMs, r.Error)
+		}
+	}
+	if report.IsPassed {
+		cc.Printf("Preflight passed, %d checks\n", len(report.Results))
+	} else {
+		cc.Printf("Preflight failed, %d of %d checks\n", len(report.FailedNames()), len(report.Results))
+	}
+	return err
+}
@@ -0,0 +1,116 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/api"
+	"dxlib/v3/configurations"
+	"dxlib/v3/health"
+	"dxlib/v3/redis"
+	"dxlib/v3/utils"
+)
+
+// closedAddress is an address of this host nothing listens on.
+func closedAddress(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen(`tcp`, `127.0.0.1:0`)
+	require.NoError(t, err)
+	address := ln.Addr().String()
+	require.NoError(t, ln.Close())
+	return address
+}
+
+// setTestConfiguration sets the configuration nameId to data, disabled at the end of the test.
+func setTestConfiguration(t *testing.T, nameId string, data utils.JSON) {
+	t.Helper()
+	configurations.Manager.NewConfiguration(nameId, ``, `json`, false, false, data, nil)
+	t.Cleanup(func() {
+		configurations.Manager.NewConfiguration(nameId, ``, `json`, false, false, utils.JSON{`enabled`: false}, nil)
+	})
+}
+
+// newTestPreflightAPI defines the API nameId, removed at the end of the test.
+func newTestPreflightAPI(t *testing.T, nameId string) {
+	t.Helper()
+	_, err := api.Manager.NewAPI(nameId)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		delete(api.Manager.APIs, nameId)
+	})
+}
+
+// runTestPreflight runs the preflight command of a with positionals, giving its output.
+func runTestPreflight(a *DXApp, positionals ...string) (cc *DXAppCommandContext, output string, err error) {
+	b := &bytes.Buffer{}
+	cc = &DXAppCommandContext{App: a, Command: &DXAppArgCommand{name: `preflight`}, Context: context.Background(),
+		Positionals: positionals, Stdout: b, Stderr: b}
+	err = commandPreflight(cc)
+	return cc, b.String(), err
+}
+
+func TestPreflightFailsOnAnUnreachableDependency(t *testing.T) {
+	setTestConfiguration(t, `redis`, utils.JSON{`cache`: utils.JSON{`address`: closedAddress(t), `database_index`: float64(0)}})
+	t.Cleanup(func() {
+		delete(redis.Manager.Redises, `cache`)
+	})
+	a := &DXApp{PreflightTimeoutSec: 2}
+
+	cc, output, err := runTestPreflight(a)
+	assert.ErrorIs(t, err, ErrPreflightFailed)
+	assert.ErrorContains(t, err, `redis:cache`)
+	assert.Equal(t, 1, cc.ExitCode)
+	assert.Contains(t, output, "FAIL redis:cache")
+	assert.Contains(t, output, "PASS configuration:redis")
+	assert.Contains(t, output, "Preflight failed, 1 of")
+
+	cc, output, err = runTestPreflight(a, `json`)
+	assert.ErrorIs(t, err, ErrPreflightFailed)
+	assert.Equal(t, 1, cc.ExitCode)
+	var report DXAppPreflightReport
+	require.NoError(t, json.Unmarshal([]byte(output), &report))
+	assert.False(t, report.IsPassed)
+	assert.Equal(t, health.DXHealthStatusFail, report.Results[`redis:cache`].Status)
+	assert.NotEmpty(t, report.Results[`redis:cache`].Error)
+}
+
+func TestPreflightChecksTheAPIConfigurations(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), `missing`)
+	setTestConfiguration(t, `api`, utils.JSON{
+		`valid`:        utils.JSON{`address`: `127.0.0.1:0`},
+		`missing_cert`: utils.JSON{`address`: `127.0.0.1:0`, `tls`: utils.JSON{`cert_file`: missing + `.crt`, `key_file`: missing + `.key`}},
+		`bad_listen`:   utils.JSON{`listen`: []any{`unix:`}},
+	})
+	for _, v := range []string{`valid`, `missing_cert`, `bad_listen`, `not_configured`} {
+		newTestPreflightAPI(t, v)
+	}
+	a := &DXApp{}
+
+	report, err := a.Preflight(context.Background())
+	assert.ErrorIs(t, err, ErrPreflightFailed)
+	assert.Equal(t, health.DXHealthStatusOk, report.Results[`configuration:api`].Status)
+	assert.Equal(t, health.DXHealthStatusOk, report.Results[`api:valid`].Status)
+	assert.Equal(t, []string{`api:bad_listen`, `api:missing_cert`, `api:not_configured`}, report.FailedNames())
+	assert.Contains(t, report.Results[`api:missing_cert`].Error, missing+`.crt`)
+	assert.Contains(t, report.Results[`api:bad_listen`].Error, `ListenSpecWithoutAddress`)
+	assert.Contains(t, report.Results[`api:not_configured`].Error, `api.not_configured`)
+}
+
+func TestPreflightPasses(t *testing.T) {
+	setTestConfiguration(t, `api`, utils.JSON{`valid`: utils.JSON{`address`: `127.0.0.1:0`}})
+	newTestPreflightAPI(t, `valid`)
+	a := &DXApp{}
+
+	cc, output, err := runTestPreflight(a)
+	require.NoError(t, err)
+	assert.Equal(t, 0, cc.ExitCode)
+	assert.Contains(t, output, "PASS api:valid")
+	assert.Contains(t, output, "Preflight passed")
+}
@@ -0,0 +1,162 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"dxlib/v3/api"
+	"dxlib/v3/core"
+	"dxlib/v3/log"
+)
+
+const (
+	// DXAppRestartReadyFdEnv is the fd the new process of a graceful restart writes to once it serves
+	DXAppRestartReadyFdEnv          = `DXLIB_RESTART_READY_FD`
+	DXAppDefaultRestartReadyTimeout = 60 * time.Second
+)
+
+// watchRestartSignal restarts the app gracefully on every restart signal until ctx is done, a failed restart keeps
+// this process serving.
+func (a *DXApp) watchRestartSignal(ctx context.Context) {
+	if len(restartSignals) == 0 {
+		log.Log.Warn("Graceful restart is not supported on this platform")
+		return
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, restartSignals...)
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ch:
+				err := a.GracefulRestart()
+				if err == nil {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// watchReloadCertificateSignal reloads the certificates of the APIs served over TLS on every reload signal until ctx is
+// done, the new connections are served with them and the open ones are kept.
+func (a *DXApp) watchReloadCertificateSignal(ctx context.Context) {
+	if len(reloadCertificateSignals) == 0 {
+		return
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, reloadCertificateSignals...)
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ch:
+				log.Log.Info("Reloading the API certificates")
+				_ = api.Manager.ReloadCertificate()
+			}
+		}
+	}()
+}
+
+// GracefulRestart starts the executable again with the API listeners handed over and, once the new process is ready
+// within RestartReadyTimeoutSec, stops this one, Stop draining its in-flight requests. No connection is refused meanwhile, the new connections wait
+// in the listen queue shared by both. Where the listeners cannot be handed over this process is only stopped, for its
+// supervisor to start it again.
+func (a *DXApp) GracefulRestart() (err error) {
+	keys, files, err := api.Manager.ListenerFiles()
+	if err != nil {
+		log.Log.Warnf("Graceful restart is not possible, stopping for a normal restart (%v)", err)
+		core.RootContextCancel()
+		return nil
+	}
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	executable, err := os.Executable()
+	if err != nil {
+		log.Log.Errorf("Cannot find the executable to restart (%v)", err)
+		return err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		log.Log.Errorf("Cannot create the pipe of the restart (%v)", err)
+		return err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), api.InheritedListenersEnv(keys), DXAppRestartReadyFdEnv+`=`+strconv.Itoa(3+len(files)))
+	cmd.ExtraFiles = append(files, w)
+	log.Log.Info("Graceful restart... start")
+	err = cmd.Start()
+	_ = w.Close()
+	if err != nil {
+		log.Log.Errorf("Cannot start the new process of the restart (%v)", err)
+		return err
+	}
+	ready := make(chan error, 1)
+	go func() {
+		// EOF when the new process exits, or closes the fd, without writing to it
+		_, err := r.Read(make([]byte, 1))
+		ready <- err
+	}()
+	select {
+	case err = <-ready:
+	case <-time.After(a.restartReadyTimeout()):
+		err = errors.New("RestartNotReadyInTime")
+	}
+	if err != nil {
+		log.Log.Errorf("Graceful restart... failed, the new process %d is not ready, this one keeps serving (%v)", cmd.Process.Pid, err)
+		_ = cmd.Process.Kill()
+		go func() {
+			_ = cmd.Wait()
+		}()
+		return err
+	}
+	log.Log.Infof("Graceful restart... done, the new process %d serves, stopping this one", cmd.Process.Pid)
+	_ = cmd.Process.Release()
+	core.RootContextCancel()
+	return nil
+}
+
+func (a *DXApp) restartReadyTimeout() time.Duration {
+	if a.RestartReadyTimeoutSec > 0 {
+		return time.Duration(a.RestartReadyTimeoutSec) * time.Second
+	}
+	return DXAppDefaultRestartReadyTimeout
+}
+
+// notifyRestartReady tells the process restarting into this one that it serves, when there is one.
+func notifyRestartReady() {
+	s := os.Getenv(DXAppRestartReadyFdEnv)
+	_ = os.Unsetenv(DXAppRestartReadyFdEnv)
+	if s == `` {
+		return
+	}
+	fd, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		log.Log.Warnf("Invalid %s %s", DXAppRestartReadyFdEnv, s)
+		return
+	}
+	f := os.NewFile(uintptr(fd), `restart-ready`)
+	_, err = f.Write([]byte{1})
+	_ = f.Close()
+	if err != nil {
+		log.Log.Warnf("Cannot tell the restarting process this one serves (%v)", err)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+
+package app
+
+import (
+	"os"
+	"syscall"
+)
+
+var restartSignals = []os.Signal{syscall.SIGUSR2}
+
+var reloadCertificateSignals = []os.Signal{syscall.SIGHUP}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package app
+
+import "os"
+
+// restartSignals is empty, windows has no SIGUSR2 and cannot hand a listener over to a new process
+var restartSignals []os.Signal
+
+// reloadCertificateSignals is empty, windows has no SIGHUP, the certificate files are watched instead
+var reloadCertificateSignals []os.Signal
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"dxlib/v3/core"
+	"dxlib/v3/databases/protected/db"
+	"dxlib/v3/log"
+	"dxlib/v3/tables"
+	dxlib_os "dxlib/v3/utils/os"
+)
+
+// DXAppSettings are the settings of the app given by the environment, bound at init by BindEnv into App.Settings. A
+// setting that is not set leaves the app as its code and configuration make it.
+type DXAppSettings struct {
+	// DebugKey is compared by Set with the debug key of the app to make it IsDebug
+	DebugKey string `env:"DEBUG_KEY"`
+	// LogLevel drops the log lines less severe, one of panic, fatal, error, warn, info, debug and trace
+	LogLevel string `env:"LOG_LEVEL"`
+	// ShutdownTimeout is used when ShutdownTimeoutSec is not set, like 30s
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT"`
+	// HeldConnectionThreshold is how long a connection may be held before /debug/held-connections lists it, like 1m
+	HeldConnectionThreshold time.Duration `env:"HELD_CONNECTION_THRESHOLD"`
+	// APIAddresses replace the addresses of the APIs of the configuration, like main=:8080,admin=127.0.0.1:8081
+	APIAddresses map[string]string `env:"API_ADDRESSES"`
+	// PanicPolicy replaces the PanicPolicy of the app, recover or crash
+	PanicPolicy string `env:"PANIC_POLICY"`
+	// NamingStrategy replaces the NamingStrategy of the tables, passthrough, snake or camel
+	NamingStrategy string `env:"NAMING_STRATEGY"`
+}
+
+// BindSettings reads s from the environment and validates it, every setting that is not valid is in the error.
+func BindSettings(s *DXAppSettings) (err error) {
+	errs := []error{dxlib_os.BindEnv(s)}
+	if s.LogLevel != `` {
+		_, errLevel := log.ParseLevel(s.LogLevel)
+		if errLevel != nil {
+			errs = append(errs, fmt.Errorf("EnvInvalid:LOG_LEVEL:%w", errLevel))
+		}
+	}
+	if s.ShutdownTimeout < 0 {
+		errs = append(errs, fmt.Errorf("EnvInvalid:SHUTDOWN_TIMEOUT:NegativeDuration:%v", s.ShutdownTimeout))
+	}
+	if s.HeldConnectionThreshold < 0 {
+		errs = append(errs, fmt.Errorf("EnvInvalid:HELD_CONNECTION_THRESHOLD:NegativeDuration:%v", s.HeldConnectionThreshold))
+	}
+	if s.PanicPolicy != `` {
+		_, errPolicy := core.ParsePanicPolicy(s.PanicPolicy)
+		if errPolicy != nil {
+			errs = append(errs, fmt.Errorf("EnvInvalid:PANIC_POLICY:%w", errPolicy))
+		}
+	}
+	if s.NamingStrategy != `` {
+		_, errStrategy := db.ParseNamingStrategy(s.NamingStrategy)
+		if errStrategy != nil {
+			errs = append(errs, fmt.Errorf("EnvInvalid:NAMING_STRATEGY:%w", errStrategy))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// applySettings applies Settings, start fails when they were not valid at init.
+func (a *DXApp) applySettings() (err error) {
+	if a.settingsErr != nil {
+		err = log.Log.ErrorAndCreateErrorf("The environment settings are not valid (%v)", a.settingsErr)
+		return err
+	}
+	if a.Settings.LogLevel != `` {
+		level, _ := log.ParseLevel(a.Settings.LogLevel)
+		log.SetLevel(level)
+	}
+	if a.Settings.HeldConnectionThreshold > 0 {
+		db.HeldConnectionThreshold = a.Settings.HeldConnectionThreshold
+	}
+	if a.Settings.PanicPolicy != `` {
+		core.PanicPolicy, _ = core.ParsePanicPolicy(a.Settings.PanicPolicy)
+	}
+	if a.Settings.NamingStrategy != `` {
+		tables.Manager.NamingStrategy, _ = db.ParseNamingStrategy(a.Settings.NamingStrategy)
+	}
+	return nil
+}
+
+// shutdownTimeout is ShutdownTimeoutSec, or else the ShutdownTimeout of Settings, 0 keeps the defaults of the servers.
+func (a *DXApp) shutdownTimeout() time.Duration {
+	if a.ShutdownTimeoutSec > 0 {
+		return time.Duration(a.ShutdownTimeoutSec) * time.Second
+	}
+	return a.Settings.ShutdownTimeout
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/core"
+	"dxlib/v3/databases/protected/db"
+	"dxlib/v3/tables"
+)
+
+func TestBindSettingsRejectsInvalidPolicies(t *testing.T) {
+	t.Setenv(`PANIC_POLICY`, `ignore`)
+	t.Setenv(`NAMING_STRATEGY`, `kebab`)
+	s := DXAppSettings{}
+	err := BindSettings(&s)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `EnvInvalid:PANIC_POLICY`)
+	assert.Contains(t, err.Error(), `EnvInvalid:NAMING_STRATEGY`)
+}
+
+func TestApplySettingsSetsPolicies(t *testing.T) {
+	t.Setenv(`PANIC_POLICY`, `Crash`)
+	t.Setenv(`NAMING_STRATEGY`, `snake`)
+	t.Cleanup(func() {
+		core.PanicPolicy = core.PanicPolicyRecover
+		tables.Manager.NamingStrategy = db.NamingStrategyPassthrough
+	})
+	a := DXApp{}
+	a.settingsErr = BindSettings(&a.Settings)
+	require.NoError(t, a.applySettings())
+	assert.Equal(t, core.PanicPolicyCrash, core.PanicPolicy)
+	assert.Equal(t, db.NamingStrategySnake, tables.Manager.NamingStrategy)
+}
+
+func TestBindSettingsOfABadDuration(t *testing.T) {
+	t.Setenv(`SHUTDOWN_TIMEOUT`, `30`)
+	t.Setenv(`HELD_CONNECTION_THRESHOLD`, `-1m`)
+	t.Setenv(`LOG_LEVEL`, `verbose`)
+	a := DXApp{}
+	a.settingsErr = BindSettings(&a.Settings)
+	require.Error(t, a.settingsErr)
+	assert.Contains(t, a.settingsErr.Error(), `EnvInvalid:SHUTDOWN_TIMEOUT`)
+	assert.Contains(t, a.settingsErr.Error(), `EnvInvalid:HELD_CONNECTION_THRESHOLD:NegativeDuration`)
+	assert.Contains(t, a.settingsErr.Error(), `EnvInvalid:LOG_LEVEL`)
+	assert.Error(t, a.applySettings())
+}
@@ -0,0 +1,68 @@
+package app
+
+import (
+	"fmt"
+	"slices"
+)
+
+var DXAppDefaultShutdownOrder = []string{`tasks`, `api`, `grpc`, `redis`, `storage`, `objectstorage`, `mail`, `tracing`}
+
+// DXAppShutdownConstraint makes First stop before Then, whatever their places in ShutdownOrder.
+type DXAppShutdownConstraint struct {
+	First string
+	Then  string
+}
+
+// ShutdownOrder gives the order Stop stops the subsystems in, after OnStopping. It is ShutdownOrder, the subsystems it
+// does not name appended in the default order, then moved as little as possible to satisfy ShutdownConstraints.
+func (a *DXApp) ShutdownOrder() (r []string, err error) {
+	position := map[string]int{}
+	for _, v := range a.ShutdownSubsystemOrder {
+		if !slices.Contains(DXAppDefaultShutdownOrder, v) {
+			return nil, fmt.Errorf("ShutdownOrderUnknownSubsystem:%s", v)
+		}
+		if _, ok := position[v]; ok {
+			return nil, fmt.Errorf("ShutdownOrderRepeatedSubsystem:%s", v)
+		}
+		position[v] = len(r)
+		r = append(r, v)
+	}
+	for _, v := range DXAppDefaultShutdownOrder {
+		if _, ok := position[v]; !ok {
+			position[v] = len(r)
+			r = append(r, v)
+		}
+	}
+	before := map[string][]string{}
+	waiting := map[string]int{}
+	for _, c := range a.ShutdownConstraints {
+		for _, v := range []string{c.First, c.Then} {
+			if _, ok := position[v]; !ok {
+				return nil, fmt.Errorf("ShutdownConstraintUnknownSubsystem:%s", v)
+			}
+		}
+		before[c.First] = append(before[c.First], c.Then)
+		waiting[c.Then]++
+	}
+	// Kahn's algorithm, taking among the subsystems not waiting for another the one first in r
+	sorted := make([]string, 0, len(r))
+	isDone := map[string]bool{}
+	for len(sorted) < len(r) {
+		next := ``
+		for _, v := range r {
+			if !isDone[v] && waiting[v] == 0 {
+				next = v
+				break
+			}
+		}
+		if next == `` {
+			return nil, fmt.Errorf("ShutdownConstraintsCycle:%v", a.ShutdownConstraints)
+		}
+		isDone[next] = true
+		sorted = append(sorted, next)
+		for _, v := range before[next] {
+			waiting[v]--
+		}
+	}
+	return sorted, nil
+}
@@ -0,0 +1,98 @@
+package app
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testLifecycle records the lifecycle events of an app.
+type testLifecycle struct {
+	mutex  sync.Mutex
+	events []DXAppLifecycleEvent
+}
+
+// recordTestLifecycle subscribes to the events of a until the end of the test.
+func recordTestLifecycle(t *testing.T, a *DXApp) *testLifecycle {
+	t.Helper()
+	l := &testLifecycle{}
+	t.Cleanup(a.Subscribe(func(e DXAppLifecycleEvent) {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		l.events = append(l.events, e)
+	}))
+	return l
+}
+
+// waitFor gives the events once the one of eventType is delivered, as `type` or `type:subsystem`.
+func (l *testLifecycle) waitFor(t *testing.T, eventType DXAppLifecycleEventType) (r []string) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		r = nil
+		for _, e := range l.events {
+			v := string(e.Type)
+			if e.Subsystem != `` {
+				v += `:` + e.Subsystem
+			}
+			r = append(r, v)
+			if e.Type == eventType {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, time.Millisecond)
+	return r
+}
+
+func TestShutdownOrder(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		order       []string
+		constraints []DXAppShutdownConstraint
+		r           []string
+		err         string
+	}{
+		{`default`, nil, nil, DXAppDefaultShutdownOrder, ``},
+		{`custom`, []string{`storage`, `api`}, nil,
+			[]string{`storage`, `api`, `tasks`, `grpc`, `redis`, `objectstorage`, `mail`, `tracing`}, ``},
+		{`constrained`, []string{`storage`, `api`}, []DXAppShutdownConstraint{{First: `api`, Then: `storage`}},
+			[]string{`api`, `storage`, `tasks`, `grpc`, `redis`, `objectstorage`, `mail`, `tracing`}, ``},
+		{`constrained default`, nil, []DXAppShutdownConstraint{{First: `redis`, Then: `tasks`}},
+			[]string{`api`, `grpc`, `redis`, `tasks`, `storage`, `objectstorage`, `mail`, `tracing`}, ``},
+		{`unknown`, []string{`queue`}, nil, nil, `ShutdownOrderUnknownSubsystem:queue`},
+		{`repeated`, []string{`api`, `api`}, nil, nil, `ShutdownOrderRepeatedSubsystem:api`},
+		{`unknown in a constraint`, nil, []DXAppShutdownConstraint{{First: `api`, Then: `queue`}}, nil,
+			`ShutdownConstraintUnknownSubsystem:queue`},
+		{`cycle`, nil, []DXAppShutdownConstraint{{First: `api`, Then: `redis`}, {First: `redis`, Then: `api`}}, nil,
+			`ShutdownConstraintsCycle`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &DXApp{ShutdownSubsystemOrder: tt.order, ShutdownConstraints: tt.constraints}
+			r, err := a.ShutdownOrder()
+			if tt.err != `` {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.r, r)
+		})
+	}
+}
+
+func TestStopFollowsTheShutdownOrder(t *testing.T) {
+	a := newTestStoppingApp(t, &testMailTransport{})
+	a.IsRedisExist = true
+	a.IsStorageExist = true
+	a.ShutdownSubsystemOrder = []string{`mail`, `storage`}
+	a.ShutdownConstraints = []DXAppShutdownConstraint{{First: `redis`, Then: `storage`}}
+	l := recordTestLifecycle(t, a)
+
+	require.NoError(t, a.Stop())
+	assert.Equal(t, []string{`stopping`, `subsystem_stopped:mail`, `subsystem_stopped:redis`,
+		`subsystem_stopped:storage`, `subsystem_stopped:tracing`, `stopped`}, l.waitFor(t, DXAppLifecycleEventStopped))
+}
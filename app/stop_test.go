@@ -0,0 +1,87 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"dxlib/v3/mail"
+)
+
+// testMailTransport is a mail transport counting its closes, each giving err.
+type testMailTransport struct {
+	closes atomic.Int32
+	err    error
+}
+
+func (tr *testMailTransport) Send(context.Context, mail.DXMailMessage) error {
+	return nil
+}
+
+func (tr *testMailTransport) Close() error {
+	tr.closes.Add(1)
+	return tr.err
+}
+
+// newTestStoppingApp gives an app with a mailer of tr, removed at the end of the test.
+func newTestStoppingApp(t *testing.T, tr *testMailTransport) *DXApp {
+	t.Helper()
+	mail.Manager.Mailers[`test_stop`] = &mail.DXMailer{Owner: &mail.Manager, NameId: `test_stop`, Transport: tr}
+	t.Cleanup(func() {
+		delete(mail.Manager.Mailers, `test_stop`)
+	})
+	a := newTestApp(t)
+	a.IsMailExist = true
+	return a
+}
+
+func TestStopJoinsTheErrorsOfEveryTeardownStep(t *testing.T) {
+	errOnStopping, errClose := errors.New(`on stopping failed`), errors.New(`close failed`)
+	tr := &testMailTransport{err: errClose}
+	a := newTestStoppingApp(t, tr)
+	a.OnStopping = func() error {
+		return errOnStopping
+	}
+
+	err := a.Stop()
+	assert.ErrorIs(t, err, errOnStopping)
+	assert.ErrorIs(t, err, errClose)
+	assert.ErrorContains(t, err, `OnStopping: on stopping failed`)
+	assert.ErrorContains(t, err, `mail: close failed`)
+	// the failing OnStopping did not skip the mail teardown
+	assert.Equal(t, int32(1), tr.closes.Load())
+}
+
+func TestStopRunsOnceForConcurrentCallers(t *testing.T) {
+	errClose := errors.New(`close failed`)
+	tr := &testMailTransport{err: errClose}
+	a := newTestStoppingApp(t, tr)
+	onStoppings := atomic.Int32{}
+	a.OnStopping = func() error {
+		onStoppings.Add(1)
+		return nil
+	}
+
+	errs := make([]error, 2)
+	wg := sync.WaitGroup{}
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = a.Stop()
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), onStoppings.Load())
+	assert.Equal(t, int32(1), tr.closes.Load())
+	for _, err := range errs {
+		assert.ErrorIs(t, err, errClose)
+	}
+	assert.Same(t, errs[0], errs[1])
+	assert.ErrorIs(t, a.Stop(), errClose)
+	assert.Equal(t, int32(1), tr.closes.Load())
+}
@@ -0,0 +1,251 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"dxlib/v3/utils"
+	"dxlib/v3/utils/json"
+)
+
+const (
+	DXCircuitBreakerDefaultFailureThreshold   = 5
+	DXCircuitBreakerDefaultOpenDuration       = 30 * time.Second
+	DXCircuitBreakerDefaultHalfOpenProbeCount = 1
+)
+
+type DXCircuitBreakerState int
+
+const (
+	DXCircuitBreakerStateClosed DXCircuitBreakerState = iota
+	DXCircuitBreakerStateOpen
+	DXCircuitBreakerStateHalfOpen
+)
+
+func (s DXCircuitBreakerState) String() string {
+	switch s {
+	case DXCircuitBreakerStateClosed:
+		return `closed`
+	case DXCircuitBreakerStateOpen:
+		return `open`
+	case DXCircuitBreakerStateHalfOpen:
+		return `half_open`
+	default:
+		return `unknown`
+	}
+}
+
+// ErrCircuitBreakerOpen is returned at once, without calling, while the breaker is open.
+var ErrCircuitBreakerOpen = errors.New("CircuitBreakerOpen")
+
+// DXCircuitBreaker opens after FailureThreshold failures in a row and then fails the calls at once for OpenDuration. It
+// is half-open after, letting HalfOpenProbeCount calls through: all of them succeeding closes it, one failing opens it again.
+type DXCircuitBreaker struct {
+	NameId             string
+	FailureThreshold   int
+	OpenDuration       time.Duration
+	HalfOpenProbeCount int
+	// IsFailure tells which errors count as failures of the dependency, by default every error but a cancelled context
+	IsFailure func(err error) bool
+	// OnStateChange is called, with the breaker locked, on every transition
+	OnStateChange func(b *DXCircuitBreaker, from DXCircuitBreakerState, to DXCircuitBreakerState)
+
+	mutex    sync.Mutex
+	state    DXCircuitBreakerState
+	failures int
+	openedAt time.Time
+	// probes are the calls let through since half-open, succeeded the ones of them that succeeded
+	probes    int
+	succeeded int
+	// generation changes on every transition, the result of a call started before is ignored
+	generation uint64
+	rejections uint64
+}
+
+// DXCircuitBreakerStats are the state of a breaker and the total of the calls it failed at once.
+type DXCircuitBreakerStats struct {
+	State      DXCircuitBreakerState
+	Rejections uint64
+}
+
+type DXCircuitBreakerManager struct {
+	Breakers map[string]*DXCircuitBreaker
+	mutex    sync.RWMutex
+}
+
+func IsFailureDefault(err error) bool {
+	return err != nil && !errors.Is(err, context.Canceled)
+}
+
+// NewCircuitBreaker adds, or replaces, the breaker nameId, a value not above 0 takes the default.
+func (bm *DXCircuitBreakerManager) NewCircuitBreaker(nameId string, failureThreshold int, openDuration time.Duration,
+	halfOpenProbeCount int) *DXCircuitBreaker {
+	if failureThreshold <= 0 {
+		failureThreshold = DXCircuitBreakerDefaultFailureThreshold
+	}
+	if openDuration <= 0 {
+		openDuration = DXCircuitBreakerDefaultOpenDuration
+	}
+	if halfOpenProbeCount <= 0 {
+		halfOpenProbeCount = DXCircuitBreakerDefaultHalfOpenProbeCount
+	}
+	b := &DXCircuitBreaker{
+		NameId:             nameId,
+		FailureThreshold:   failureThreshold,
+		OpenDuration:       openDuration,
+		HalfOpenProbeCount: halfOpenProbeCount,
+		IsFailure:          IsFailureDefault,
+	}
+	bm.mutex.Lock()
+	defer bm.mutex.Unlock()
+	bm.Breakers[nameId] = b
+	return b
+}
+
+// NewCircuitBreakerFromConfiguration reads failure_threshold, open_duration_sec and half_open_probe_count of c.
+func (bm *DXCircuitBreakerManager) NewCircuitBreakerFromConfiguration(nameId string, c utils.JSON) *DXCircuitBreaker {
+	return bm.NewCircuitBreaker(nameId,
+		json.GetNumberWithDefault(c, `failure_threshold`, DXCircuitBreakerDefaultFailureThreshold),
+		time.Duration(json.GetNumberWithDefault(c, `open_duration_sec`, int(DXCircuitBreakerDefaultOpenDuration/time.Second)))*time.Second,
+		json.GetNumberWithDefault(c, `half_open_probe_count`, DXCircuitBreakerDefaultHalfOpenProbeCount))
+}
+
+func (bm *DXCircuitBreakerManager) Names() (r []string) {
+	bm.mutex.RLock()
+	defer bm.mutex.RUnlock()
+	for k := range bm.Breakers {
+		r = append(r, k)
+	}
+	sort.Strings(r)
+	return r
+}
+
+func (bm *DXCircuitBreakerManager) AllStats() (r map[string]DXCircuitBreakerStats) {
+	bm.mutex.RLock()
+	defer bm.mutex.RUnlock()
+	r = map[string]DXCircuitBreakerStats{}
+	for k, v := range bm.Breakers {
+		r[k] = v.Stats()
+	}
+	return r
+}
+
+func (b *DXCircuitBreaker) setState(state DXCircuitBreakerState, now time.Time) {
+	from := b.state
+	b.state = state
+	b.failures = 0
+	b.probes = 0
+	b.succeeded = 0
+	b.generation++
+	if state == DXCircuitBreakerStateOpen {
+		b.openedAt = now
+	}
+	if b.OnStateChange != nil && from != state {
+		b.OnStateChange(b, from, state)
+	}
+}
+
+// currentState moves an open breaker whose OpenDuration is over to half-open.
+func (b *DXCircuitBreaker) currentState(now time.Time) DXCircuitBreakerState {
+	if b.state == DXCircuitBreakerStateOpen && now.Sub(b.openedAt) >= b.OpenDuration {
+		b.setState(DXCircuitBreakerStateHalfOpen, now)
+	}
+	return b.state
+}
+
+func (b *DXCircuitBreaker) State() DXCircuitBreakerState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.currentState(time.Now())
+}
+
+func (b *DXCircuitBreaker) Stats() DXCircuitBreakerStats {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return DXCircuitBreakerStats{State: b.currentState(time.Now()), Rejections: b.rejections}
+}
+
+// Reset closes the breaker, whatever its state.
+func (b *DXCircuitBreaker) Reset() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.setState(DXCircuitBreakerStateClosed, time.Now())
+}
+
+func (b *DXCircuitBreaker) before() (generation uint64, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch b.currentState(time.Now()) {
+	case DXCircuitBreakerStateOpen:
+		b.rejections++
+		return 0, ErrCircuitBreakerOpen
+	case DXCircuitBreakerStateHalfOpen:
+		if b.probes >= b.HalfOpenProbeCount {
+			b.rejections++
+			return 0, ErrCircuitBreakerOpen
+		}
+		b.probes++
+	}
+	return b.generation, nil
+}
+
+func (b *DXCircuitBreaker) after(generation uint64, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if generation != b.generation {
+		return
+	}
+	isFailure := b.IsFailure
+	if isFailure == nil {
+		isFailure = IsFailureDefault
+	}
+	now := time.Now()
+	if isFailure(err) {
+		b.failures++
+		if b.state == DXCircuitBreakerStateHalfOpen || b.failures >= b.FailureThreshold {
+			b.setState(DXCircuitBreakerStateOpen, now)
+		}
+		return
+	}
+	if b.state == DXCircuitBreakerStateHalfOpen {
+		// a cancelled probe tells nothing of the dependency, it lets another call through
+		if errors.Is(err, context.Canceled) {
+			b.probes--
+			return
+		}
+		b.succeeded++
+		if b.succeeded >= b.HalfOpenProbeCount {
+			b.setState(DXCircuitBreakerStateClosed, now)
+		}
+		return
+	}
+	b.failures = 0
+}
+
+// Call runs fn unless the breaker is open, then it gives ErrCircuitBreakerOpen at once. The error of fn is returned as is.
+func (b *DXCircuitBreaker) Call(fn func() error) (err error) {
+	generation, err := b.before()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		r := recover()
+		if r != nil {
+			b.after(generation, errors.New("CircuitBreakerCallPanicked"))
+			panic(r)
+		}
+		b.after(generation, err)
+	}()
+	return fn()
+}
+
+var Manager DXCircuitBreakerManager
+
+func init() {
+	Manager = DXCircuitBreakerManager{
+		Breakers: map[string]*DXCircuitBreaker{},
+	}
+}
@@ -0,0 +1,169 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/utils"
+)
+
+var errTestDependency = errors.New(`dependency failed`)
+
+// newTestCircuitBreaker gives a breaker of its own manager, recording its transitions.
+func newTestCircuitBreaker(failureThreshold int, openDuration time.Duration, halfOpenProbeCount int) (b *DXCircuitBreaker, transitions *[]string) {
+	bm := &DXCircuitBreakerManager{Breakers: map[string]*DXCircuitBreaker{}}
+	b = bm.NewCircuitBreaker(`test`, failureThreshold, openDuration, halfOpenProbeCount)
+	transitions = &[]string{}
+	b.OnStateChange = func(b *DXCircuitBreaker, from DXCircuitBreakerState, to DXCircuitBreakerState) {
+		*transitions = append(*transitions, from.String()+`>`+to.String())
+	}
+	return b, transitions
+}
+
+func failing() error {
+	return errTestDependency
+}
+
+func succeeding() error {
+	return nil
+}
+
+func TestCircuitBreakerOpensAfterTheFailuresInARow(t *testing.T) {
+	b, transitions := newTestCircuitBreaker(3, time.Hour, 1)
+
+	// a success resets the count
+	for _, fn := range []func() error{failing, failing, succeeding, failing, failing} {
+		_ = b.Call(fn)
+	}
+	assert.Equal(t, DXCircuitBreakerStateClosed, b.State())
+	assert.ErrorIs(t, b.Call(failing), errTestDependency)
+	assert.Equal(t, DXCircuitBreakerStateOpen, b.State())
+
+	calls := 0
+	err := b.Call(func() error {
+		calls++
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrCircuitBreakerOpen)
+	assert.Zero(t, calls)
+	assert.Equal(t, DXCircuitBreakerStats{State: DXCircuitBreakerStateOpen, Rejections: 1}, b.Stats())
+	assert.Equal(t, []string{`closed>open`}, *transitions)
+}
+
+func TestCircuitBreakerHalfOpenProbes(t *testing.T) {
+	b, transitions := newTestCircuitBreaker(1, 20*time.Millisecond, 2)
+	_ = b.Call(failing)
+	require.Eventually(t, func() bool {
+		return b.State() == DXCircuitBreakerStateHalfOpen
+	}, time.Second, time.Millisecond)
+
+	// two probes are let through at once, a third call is rejected while they run
+	release := make(chan struct{})
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- b.Call(func() error {
+				<-release
+				return nil
+			})
+		}()
+	}
+	require.Eventually(t, func() bool {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		return b.probes == 2
+	}, time.Second, time.Millisecond)
+	assert.ErrorIs(t, b.Call(succeeding), ErrCircuitBreakerOpen)
+	close(release)
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, <-errs)
+	}
+	assert.Equal(t, DXCircuitBreakerStateClosed, b.State())
+	assert.Equal(t, []string{`closed>open`, `open>half_open`, `half_open>closed`}, *transitions)
+}
+
+func TestCircuitBreakerFailedProbeOpensAgain(t *testing.T) {
+	b, transitions := newTestCircuitBreaker(1, 20*time.Millisecond, 2)
+	_ = b.Call(failing)
+	require.Eventually(t, func() bool {
+		return b.State() == DXCircuitBreakerStateHalfOpen
+	}, time.Second, time.Millisecond)
+
+	// a cancelled probe tells nothing, it lets another through
+	assert.ErrorIs(t, b.Call(func() error {
+		return context.Canceled
+	}), context.Canceled)
+	assert.Equal(t, DXCircuitBreakerStateHalfOpen, b.State())
+	assert.NoError(t, b.Call(succeeding))
+	assert.ErrorIs(t, b.Call(failing), errTestDependency)
+	assert.Equal(t, DXCircuitBreakerStateOpen, b.State())
+	assert.Equal(t, []string{`closed>open`, `open>half_open`, `half_open>open`}, *transitions)
+
+	b.Reset()
+	assert.Equal(t, DXCircuitBreakerStateClosed, b.State())
+}
+
+func TestCircuitBreakerCountsWhatIsAFailure(t *testing.T) {
+	b, _ := newTestCircuitBreaker(1, time.Hour, 1)
+	errNotFound := errors.New(`not found`)
+	b.IsFailure = func(err error) bool {
+		return IsFailureDefault(err) && !errors.Is(err, errNotFound)
+	}
+
+	assert.ErrorIs(t, b.Call(func() error {
+		return errNotFound
+	}), errNotFound)
+	assert.ErrorIs(t, b.Call(func() error {
+		return context.Canceled
+	}), context.Canceled)
+	assert.Equal(t, DXCircuitBreakerStateClosed, b.State())
+
+	assert.PanicsWithValue(t, `boom`, func() {
+		_ = b.Call(func() error {
+			panic(`boom`)
+		})
+	})
+	assert.Equal(t, DXCircuitBreakerStateOpen, b.State())
+}
+
+func TestCircuitBreakerIgnoresACallOfAnEarlierState(t *testing.T) {
+	b, _ := newTestCircuitBreaker(1, time.Hour, 1)
+	started, release, done := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = b.Call(func() error {
+			close(started)
+			<-release
+			return errTestDependency
+		})
+	}()
+	<-started
+	// reset while the call runs, its failure is of the state before
+	b.Reset()
+	close(release)
+	<-done
+	assert.Equal(t, DXCircuitBreakerStateClosed, b.State())
+}
+
+func TestCircuitBreakerFromConfiguration(t *testing.T) {
+	bm := &DXCircuitBreakerManager{Breakers: map[string]*DXCircuitBreaker{}}
+	b := bm.NewCircuitBreakerFromConfiguration(`redis/cache`, utils.JSON{`failure_threshold`: float64(2), `open_duration_sec`: float64(5)})
+	assert.Equal(t, 2, b.FailureThreshold)
+	assert.Equal(t, 5*time.Second, b.OpenDuration)
+	assert.Equal(t, DXCircuitBreakerDefaultHalfOpenProbeCount, b.HalfOpenProbeCount)
+	bm.NewCircuitBreaker(`database/main`, 0, 0, 0)
+
+	assert.Equal(t, []string{`database/main`, `redis/cache`}, bm.Names())
+	_ = b.Call(failing)
+	_ = b.Call(failing)
+	_ = b.Call(failing)
+	assert.Equal(t, map[string]DXCircuitBreakerStats{
+		`database/main`: {State: DXCircuitBreakerStateClosed},
+		`redis/cache`:   {State: DXCircuitBreakerStateOpen, Rejections: 1},
+	}, bm.AllStats())
+}
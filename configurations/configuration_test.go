@@ -0,0 +1,194 @@
+package configurations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/utils"
+)
+
+func TestLoadFromFileMergesOverTheDefaults(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), `test.yaml`)
+	c := newTestManager().NewConfiguration(`test`, filename, `yaml`, false, true, utils.JSON{`a`: 1, `nested`: utils.JSON{`x`: 1}}, nil)
+	require.NoError(t, os.WriteFile(filename, []byte("b: 2\nnested:\n  y: 2\n"), 0o600))
+	require.NoError(t, c.LoadFromFile())
+	assert.Equal(t, utils.JSON{`a`: 1, `b`: 2, `nested`: utils.JSON{`x`: 1, `y`: 2}}, *c.data())
+
+	require.NoError(t, os.WriteFile(filename, []byte("c: 3\n"), 0o600))
+	require.NoError(t, c.LoadFromFile())
+	assert.Equal(t, utils.JSON{`a`: 1, `c`: 3, `nested`: utils.JSON{`x`: 1}}, *c.data())
+}
+
+func TestReloadKeepsTheDataOfTheReaders(t *testing.T) {
+	cm := newTestManager()
+	s := &testSource{content: `{"b":2}`}
+	newTestSourceConfiguration(cm, s)
+	require.NoError(t, cm.Load())
+	c, ok := cm.Get(`test`)
+	require.True(t, ok)
+	snapshot := cm.Snapshot()
+
+	s.set(`{"b":3}`, nil)
+	require.NoError(t, cm.Load())
+	assert.Equal(t, float64(2), (*c.Data)[`b`])
+	snapshotted, _ := snapshot.Get(`test`)
+	assert.Equal(t, float64(2), (*snapshotted.Data)[`b`])
+	c, _ = cm.Get(`test`)
+	assert.Equal(t, float64(3), (*c.Data)[`b`])
+}
+
+// TestGetSetAndReloadConcurrently is for -race, the readers walk the data while it is reloaded from a source, a file
+// and its secrets, and other configurations are added.
+func TestGetSetAndReloadConcurrently(t *testing.T) {
+	t.Setenv(`DXLIB_TEST_CONFIGURATION_PASSWORD`, `p`)
+	cm := newTestManager()
+	s := &testSource{content: `{"b":2,"password":"secret://env/DXLIB_TEST_CONFIGURATION_PASSWORD","nested":{"y":[1,2]}}`}
+	c := newTestSourceConfiguration(cm, s)
+	filename := filepath.Join(t.TempDir(), `file.json`)
+	require.NoError(t, os.WriteFile(filename, []byte(`{"b":2,"nested":{"y":[1,2]}}`), 0o600))
+	f := cm.NewConfiguration(`file`, filename, `json`, false, true, utils.JSON{`a`: 1}, nil)
+
+	var walk func(v any)
+	walk = func(v any) {
+		switch x := v.(type) {
+		case utils.JSON:
+			for _, y := range x {
+				walk(y)
+			}
+		case []any:
+			for _, y := range x {
+				walk(y)
+			}
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; ctx.Err() == nil; j++ {
+				for _, nameId := range cm.NameIds() {
+					x, ok := cm.Get(nameId)
+					if ok && x.Data != nil {
+						walk(*x.Data)
+					}
+				}
+				snapshot := cm.Snapshot()
+				for _, nameId := range snapshot.NameIds() {
+					x, _ := snapshot.Get(nameId)
+					walk(*x.Data)
+				}
+				walk(cm.AsRedactedJSON())
+				cm.NewConfiguration(fmt.Sprintf("added_%d_%d", i, j%10), ``, `json`, false, false, utils.JSON{`j`: j}, nil)
+			}
+		}(i)
+	}
+	for i := 0; i < 100; i++ {
+		s.set(fmt.Sprintf(`{"b":%d,"password":"secret://env/DXLIB_TEST_CONFIGURATION_PASSWORD","nested":{"y":[%d]}}`, i, i), nil)
+		require.NoError(t, c.LoadFromSource(context.Background()))
+		require.NoError(t, c.ResolveSecrets())
+		require.NoError(t, f.LoadFromFile())
+	}
+	cancel()
+	wg.Wait()
+	x, _ := cm.Get(`test`)
+	assert.Equal(t, utils.JSON{`a`: 1, `b`: float64(99), `password`: `p`, `nested`: utils.JSON{`x`: 1, `y`: []any{float64(99)}}}, *x.Data)
+}
+
+func TestIsEnabled(t *testing.T) {
+	cm := newTestManager()
+	cm.NewConfiguration(`present`, ``, `json`, false, false, utils.JSON{`a`: utils.JSON{}}, nil)
+	cm.NewConfiguration(`enabled`, ``, `json`, false, false, utils.JSON{`enabled`: true}, nil)
+	cm.NewConfiguration(`disabled`, ``, `json`, false, false, utils.JSON{`enabled`: false, `a`: utils.JSON{}}, nil)
+	cm.NewConfiguration(`not_bool`, ``, `json`, false, false, utils.JSON{`enabled`: `false`}, nil)
+
+	assert.True(t, cm.IsEnabled(`present`))
+	assert.True(t, cm.IsEnabled(`enabled`))
+	assert.False(t, cm.IsEnabled(`disabled`))
+	// only a bool disables, like the other flags of the configurations
+	assert.True(t, cm.IsEnabled(`not_bool`))
+	assert.False(t, cm.IsEnabled(`absent`))
+}
+
+func TestRedactDSN(t *testing.T) {
+	for _, tt := range []struct {
+		dsn      string
+		redacted string
+	}{
+		{`postgres://app:s3cr3t@db:5432/app?sslmode=disable`, `postgres://app:***@db:5432/app?sslmode=disable`},
+		{`postgres://app:s3%40cr%3At@db:5432/app`, `postgres://app:***@db:5432/app`},
+		{`dial postgres://app:s3cr3t@db/app: connection refused`, `dial postgres://app:***@db/app: connection refused`},
+		{`app:s3cr3t@tcp(db:3306)/app?parseTime=true`, `app:***@tcp(db:3306)/app?parseTime=true`},
+		{`app:s3@cr3t@tcp(db:3306)/app`, `app:***@tcp(db:3306)/app`},
+		{`sqlserver://app:s3cr3t@db:1433?database=app`, `sqlserver://app:***@db:1433?database=app`},
+		{`host=db user=app password=s3cr3t dbname=app`, `host=db user=app password=*** dbname=app`},
+		{`server=db;user id=app;Password='s3cr3t';database=app`, `server=db;user id=app;Password=***;database=app`},
+		{`oracle://db:1521/app?user=app&pwd=s3cr3t`, `oracle://db:1521/app?user=app&pwd=***`},
+	} {
+		t.Run(tt.dsn, func(t *testing.T) {
+			r := RedactDSN(tt.dsn)
+			assert.Equal(t, tt.redacted, r)
+			assert.NotContains(t, r, `s3`)
+		})
+	}
+	assert.Equal(t, `postgres://db/app`, RedactDSN(`postgres://db/app`))
+}
+
+func TestAsRedactedJSONHidesTheDSNPasswords(t *testing.T) {
+	cm := newTestManager()
+	cm.NewConfiguration(`database`, ``, `json`, false, false, utils.JSON{
+		`app`: utils.JSON{
+			`url`:      `postgres://app:s3cr3t@db/app`,
+			`replicas`: []any{`app:s3cr3t@tcp(replica)/app`},
+			`password`: `s3cr3t`,
+		},
+	}, nil)
+
+	r := cm.AsRedactedJSON()
+	assert.NotContains(t, fmt.Sprint(r), `s3cr3t`)
+	app := r[`database`].(utils.JSON)[`app`].(utils.JSON)
+	assert.Equal(t, `postgres://app:***@db/app`, app[`url`])
+	assert.Equal(t, []any{`app:***@tcp(replica)/app`}, app[`replicas`])
+	assert.Equal(t, `********`, app[`password`])
+}
+
+func TestLookupOfAnAbsentAndAMalformedConfiguration(t *testing.T) {
+	cm := newTestManager()
+	cm.NewConfiguration(`present`, ``, `json`, false, false, utils.JSON{`a`: 1}, nil)
+	cm.Set(&DXConfiguration{NameId: `without_data`})
+
+	c, err := cm.Lookup(`present`)
+	require.NoError(t, err)
+	assert.Equal(t, utils.JSON{`a`: 1}, *c.Data)
+
+	_, err = cm.Lookup(`absent`)
+	assert.ErrorIs(t, err, ErrConfigNotFound)
+	assert.NotErrorIs(t, err, ErrConfigInvalid)
+	assert.EqualError(t, err, `ConfigNotFound:absent`)
+
+	_, err = cm.Lookup(`without_data`)
+	assert.ErrorIs(t, err, ErrConfigInvalid)
+	assert.NotErrorIs(t, err, ErrConfigNotFound)
+	assert.EqualError(t, err, `ConfigInvalid:without_data (NoData)`)
+}
+
+func TestInvalidError(t *testing.T) {
+	errCause := errors.New(`BadPort`)
+	err := InvalidError(`storage`, errCause)
+	assert.ErrorIs(t, err, ErrConfigInvalid)
+	assert.ErrorIs(t, err, errCause)
+	assert.EqualError(t, err, `ConfigInvalid:storage (BadPort)`)
+
+	// wrapped again by the subsystem above, it still names the configuration it is about
+	assert.Equal(t, err, InvalidError(`app`, err))
+	assert.NoError(t, InvalidError(`storage`, nil))
+}
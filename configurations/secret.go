@@ -0,0 +1,154 @@
+package configurations
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+)
+
+// DXSecretScheme starts the configuration values resolved by a secret provider, as secret://provider/key.
+const DXSecretScheme = `secret://`
+
+// DXSecretProvider gives the secret of a key, like a Vault or a Secrets Manager client. Resolve may be slow, the
+// resolved secrets are cached by the manager.
+type DXSecretProvider interface {
+	Resolve(ref string) (value string, err error)
+}
+
+// DXSecretProviderEnv resolves a key as the environment variable Prefix+key, it is registered as "env".
+type DXSecretProviderEnv struct {
+	Prefix string
+}
+
+func (p DXSecretProviderEnv) Resolve(ref string) (value string, err error) {
+	value, ok := os.LookupEnv(p.Prefix + ref)
+	if !ok {
+		return ``, fmt.Errorf("SecretEnvNotFound:%s", p.Prefix+ref)
+	}
+	return value, nil
+}
+
+type dxSecretCacheEntry struct {
+	value      string
+	resolvedAt time.Time
+}
+
+func (cm *DXConfigurationManager) RegisterSecretProvider(nameId string, p DXSecretProvider) {
+	cm.secretMutex.Lock()
+	defer cm.secretMutex.Unlock()
+	cm.SecretProviders[nameId] = p
+}
+
+func IsSecretReference(s string) bool {
+	return strings.HasPrefix(s, DXSecretScheme)
+}
+
+// ResolveSecret gives the secret of a secret://provider/key reference. A resolved secret is kept for the process
+// lifetime, or for SecretCacheTTL when it is set.
+func (cm *DXConfigurationManager) ResolveSecret(reference string) (value string, err error) {
+	providerNameId, key, ok := strings.Cut(strings.TrimPrefix(reference, DXSecretScheme), `/`)
+	if !IsSecretReference(reference) || !ok || providerNameId == `` || key == `` {
+		return ``, fmt.Errorf("SecretReferenceInvalid:%s", reference)
+	}
+	cm.secretMutex.Lock()
+	defer cm.secretMutex.Unlock()
+	entry, ok := cm.secretCache[reference]
+	if ok && (cm.SecretCacheTTL <= 0 || time.Since(entry.resolvedAt) < cm.SecretCacheTTL) {
+		return entry.value, nil
+	}
+	p, ok := cm.SecretProviders[providerNameId]
+	if !ok {
+		return ``, fmt.Errorf("SecretProviderNotFound:%s", providerNameId)
+	}
+	value, err = p.Resolve(key)
+	if err != nil {
+		return ``, err
+	}
+	cm.secretCache[reference] = dxSecretCacheEntry{value: value, resolvedAt: time.Now()}
+	return value, nil
+}
+
+// ResolveSecrets replaces the secret references of the configuration by their secrets. Their keys are added to
+// SensitiveDataKey so the secrets are never logged, a list holding one is hidden as a whole.
+func (c *DXConfiguration) ResolveSecrets() (err error) {
+	data := c.data()
+	if data == nil {
+		return nil
+	}
+	v := copyData(*data)
+	err = c.resolveSecretsInJSON(``, ``, v)
+	if err != nil {
+		return err
+	}
+	c.setData(v)
+	return nil
+}
+
+// resolveSecretsInJSON hides the key of a secret, or listPath for the JSON found in a list.
+func (c *DXConfiguration) resolveSecretsInJSON(path string, listPath string, v utils.JSON) (err error) {
+	for k, x := range v {
+		keyPath := k
+		if path != `` {
+			keyPath = path + `.` + k
+		}
+		hiddenPath := keyPath
+		if listPath != `` {
+			hiddenPath = listPath
+		}
+		switch y := x.(type) {
+		case utils.JSON:
+			err = c.resolveSecretsInJSON(keyPath, listPath, y)
+		case []any:
+			err = c.resolveSecretsInList(hiddenPath, y)
+		case string:
+			if !IsSecretReference(y) {
+				continue
+			}
+			v[k], err = c.resolveSecret(hiddenPath, y)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *DXConfiguration) resolveSecretsInList(path string, v []any) (err error) {
+	for i, x := range v {
+		switch y := x.(type) {
+		case utils.JSON:
+			err = c.resolveSecretsInJSON(fmt.Sprintf("%s.%d", path, i), path, y)
+		case []any:
+			err = c.resolveSecretsInList(path, y)
+		case string:
+			if !IsSecretReference(y) {
+				continue
+			}
+			v[i], err = c.resolveSecret(path, y)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *DXConfiguration) resolveSecret(path string, reference string) (value string, err error) {
+	value, err = c.Owner.ResolveSecret(reference)
+	if err != nil {
+		err = log.Log.ErrorAndCreateErrorf("Cannot resolve the secret %s of configuration %s key %s (%v)", reference, c.NameId, path, err)
+		return ``, err
+	}
+	if c.Owner != nil {
+		c.Owner.mutex.Lock()
+		defer c.Owner.mutex.Unlock()
+	}
+	if !utils.IfStringInSlice(path, c.SensitiveDataKey) {
+		c.SensitiveDataKey = append(c.SensitiveDataKey, path)
+	}
+	return value, nil
+}
@@ -0,0 +1,99 @@
+package configurations
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/utils"
+)
+
+// testSecretProvider is a vault of values, counting its resolves.
+type testSecretProvider struct {
+	mutex    sync.Mutex
+	values   map[string]string
+	resolves int
+}
+
+func (p *testSecretProvider) Resolve(ref string) (value string, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.resolves++
+	value, ok := p.values[ref]
+	if !ok {
+		return ``, errors.New(`secret not found`)
+	}
+	return value, nil
+}
+
+func (p *testSecretProvider) set(ref string, value string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.values[ref] = value
+}
+
+func TestSecretReferencesAreResolvedAtLoad(t *testing.T) {
+	cm := newTestManager()
+	p := &testSecretProvider{values: map[string]string{`db/password`: `s3cr3t`, `api/token`: `t0ken`}}
+	cm.RegisterSecretProvider(`vault`, p)
+	cm.NewConfiguration(`storage`, ``, `json`, false, false, utils.JSON{
+		`main`:   utils.JSON{`user_name`: `app`, `user_password`: `secret://vault/db/password`},
+		`tokens`: []any{`secret://vault/api/token`, `plain`},
+	}, nil)
+
+	require.NoError(t, cm.Load())
+	c, ok := cm.Get(`storage`)
+	require.True(t, ok)
+	assert.Equal(t, `s3cr3t`, (*c.Data)[`main`].(utils.JSON)[`user_password`])
+	assert.Equal(t, []any{`t0ken`, `plain`}, (*c.Data)[`tokens`])
+	assert.Contains(t, c.SensitiveDataKey, `main.user_password`)
+	assert.Contains(t, c.SensitiveDataKey, `tokens`)
+	assert.NotContains(t, cm.AsNonSensitiveString(), `s3cr3t`)
+	assert.NotContains(t, cm.AsNonSensitiveString(), `t0ken`)
+}
+
+func TestSecretIsCachedUntilTheTTL(t *testing.T) {
+	cm := newTestManager()
+	p := &testSecretProvider{values: map[string]string{`key`: `first`}}
+	cm.RegisterSecretProvider(`vault`, p)
+
+	for i := 0; i < 3; i++ {
+		value, err := cm.ResolveSecret(`secret://vault/key`)
+		require.NoError(t, err)
+		assert.Equal(t, `first`, value)
+	}
+	assert.Equal(t, 1, p.resolves)
+
+	cm.SecretCacheTTL = 10 * time.Millisecond
+	p.set(`key`, `rotated`)
+	time.Sleep(20 * time.Millisecond)
+	value, err := cm.ResolveSecret(`secret://vault/key`)
+	require.NoError(t, err)
+	assert.Equal(t, `rotated`, value)
+	assert.Equal(t, 2, p.resolves)
+}
+
+func TestSecretReferenceErrors(t *testing.T) {
+	cm := newTestManager()
+	cm.RegisterSecretProvider(`vault`, &testSecretProvider{values: map[string]string{}})
+	t.Setenv(`DXLIB_TEST_SECRET`, `from env`)
+
+	value, err := cm.ResolveSecret(`secret://env/DXLIB_TEST_SECRET`)
+	require.NoError(t, err)
+	assert.Equal(t, `from env`, value)
+	_, err = cm.ResolveSecret(`secret://env/DXLIB_TEST_SECRET_MISSING`)
+	assert.ErrorContains(t, err, `SecretEnvNotFound:DXLIB_TEST_SECRET_MISSING`)
+	_, err = cm.ResolveSecret(`secret://aws/key`)
+	assert.ErrorContains(t, err, `SecretProviderNotFound:aws`)
+	_, err = cm.ResolveSecret(`secret://vault`)
+	assert.ErrorContains(t, err, `SecretReferenceInvalid`)
+	_, err = cm.ResolveSecret(`secret://vault/missing`)
+	assert.ErrorContains(t, err, `secret not found`)
+
+	cm.NewConfiguration(`storage`, ``, `json`, false, false, utils.JSON{`password`: `secret://vault/missing`}, nil)
+	assert.ErrorContains(t, cm.Load(), `secret://vault/missing`)
+}
@@ -0,0 +1,227 @@
+package configurations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+)
+
+const (
+	DXConfigurationFetchDefaultTimeout        = 10 * time.Second
+	DXConfigurationFetchDefaultMaxAttempts    = 3
+	DXConfigurationFetchDefaultInitialBackoff = 500 * time.Millisecond
+	DXConfigurationFetchDefaultMaxBackoff     = 5 * time.Second
+)
+
+// DXConfigurationSource gives the content of a configuration and its format, json or yaml, like a file or a remote
+// store. Fetch must return once ctx is done.
+type DXConfigurationSource interface {
+	Fetch(ctx context.Context) (content []byte, format string, err error)
+}
+
+// DXConfigurationFetchPolicy bounds the fetches of a source, every attempt has Timeout and the backoff between them
+// doubles from InitialBackoff up to MaxBackoff. A value not above 0 takes the default.
+type DXConfigurationFetchPolicy struct {
+	Timeout        time.Duration
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DXConfigurationSourceFile reads Filename, it is what LoadFromFile does.
+type DXConfigurationSourceFile struct {
+	Filename string
+	Format   string
+}
+
+func (s DXConfigurationSourceFile) Fetch(_ context.Context) (content []byte, format string, err error) {
+	content, err = os.ReadFile(s.Filename)
+	return content, s.Format, err
+}
+
+// DXConfigurationSourceHTTP gets URL, like the key value endpoint of Consul or etcd or a configuration service. Without
+// Format the format is json, or yaml when the Content-Type says so. Client defaults to http.DefaultClient.
+type DXConfigurationSourceHTTP struct {
+	URL    string
+	Format string
+	Header http.Header
+	Client *http.Client
+}
+
+func (s DXConfigurationSourceHTTP) Fetch(ctx context.Context) (content []byte, format string, err error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, ``, err
+	}
+	for k, v := range s.Header {
+		request.Header[k] = v
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, ``, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	if response.StatusCode != http.StatusOK {
+		return nil, ``, fmt.Errorf("ConfigurationSourceHTTPStatus:%s:%d", s.URL, response.StatusCode)
+	}
+	content, err = io.ReadAll(response.Body)
+	if err != nil {
+		return nil, ``, err
+	}
+	format = s.Format
+	if format == `` {
+		format = `json`
+		if strings.Contains(response.Header.Get(`Content-Type`), `yaml`) {
+			format = `yaml`
+		}
+	}
+	return content, format, nil
+}
+
+func (c *DXConfiguration) parse(content []byte, format string) (r utils.JSON, err error) {
+	switch format {
+	case "json":
+		r, err = c.ByteArrayJSONToJSON(content)
+	case "yaml":
+		r, err = c.ByteArrayYAMLToJSON(content)
+	default:
+		return nil, fmt.Errorf("ConfigurationUnknownFormat:%s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		r = utils.JSON{}
+	}
+	return r, nil
+}
+
+// fetch tries Source up to MaxAttempts times, giving the parsed content of the first fetch that succeeds.
+func (c *DXConfiguration) fetch(ctx context.Context) (r utils.JSON, err error) {
+	p := c.SourceFetchPolicy
+	if p.Timeout <= 0 {
+		p.Timeout = DXConfigurationFetchDefaultTimeout
+	}
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DXConfigurationFetchDefaultMaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DXConfigurationFetchDefaultInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DXConfigurationFetchDefaultMaxBackoff
+	}
+	backoff := p.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, p.Timeout)
+		content, format, err := c.Source.Fetch(attemptCtx)
+		cancel()
+		if err == nil {
+			r, err = c.parse(content, format)
+			if err == nil {
+				return r, nil
+			}
+		}
+		if attempt >= p.MaxAttempts {
+			return nil, err
+		}
+		log.Log.Warnf("Can not fetch configuration %s, attempt %d of %d, retrying in %v (%v)", c.NameId, attempt, p.MaxAttempts, backoff, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, p.MaxBackoff)
+	}
+}
+
+// swap merges v over the defaults of the configuration, it is kept only when Validate accepts the result.
+func (c *DXConfiguration) swap(v utils.JSON) (err error) {
+	data := c.mergeOverDefaults(copyData(v))
+	if c.Validate != nil {
+		err = c.Validate(data)
+		if err != nil {
+			return fmt.Errorf("ConfigurationInvalid:%s:%w", c.NameId, err)
+		}
+	}
+	c.setData(data)
+	return nil
+}
+
+func (c *DXConfiguration) writeCache(v utils.JSON) (err error) {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(c.CacheFilename), filepath.Base(c.CacheFilename)+`.*`)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	errClose := f.Close()
+	if err == nil {
+		err = errClose
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), c.CacheFilename)
+}
+
+// LoadFromSource fetches the configuration from Source, retried by SourceFetchPolicy, and merges it over the data once
+// Validate accepts it. The content fetched is kept in CacheFilename, when set, it is loaded instead while Source cannot
+// be fetched, or else Filename. It can be called again to reload the configuration.
+func (c *DXConfiguration) LoadFromSource(ctx context.Context) (err error) {
+	log.Log.Infof(`Fetching configuration %s... start`, c.NameId)
+	v, err := c.fetch(ctx)
+	if err == nil {
+		err = c.swap(v)
+		if err != nil {
+			log.Log.Errorf("Fetched configuration %s is not valid, it is not used (%v)", c.NameId, err)
+			return err
+		}
+		if c.CacheFilename != `` {
+			errCache := c.writeCache(v)
+			if errCache != nil {
+				log.Log.Warnf("Can not write the cache %s of configuration %s (%v)", c.CacheFilename, c.NameId, errCache)
+			}
+		}
+		log.Log.Infof(`Fetching configuration %s... done`, c.NameId)
+		return nil
+	}
+	log.Log.Warnf("Can not fetch configuration %s, using its local copy (%v)", c.NameId, err)
+	for _, local := range []DXConfigurationSourceFile{{Filename: c.CacheFilename, Format: `json`}, {Filename: c.Filename, Format: c.FileFormat}} {
+		if local.Filename == `` {
+			continue
+		}
+		content, format, errLocal := local.Fetch(ctx)
+		if errLocal == nil {
+			v, errLocal = c.parse(content, format)
+		}
+		if errLocal == nil {
+			errLocal = c.swap(v)
+		}
+		if errLocal == nil {
+			log.Log.Infof(`Loaded configuration %s from %s`, c.NameId, local.Filename)
+			return nil
+		}
+		log.Log.Warnf("Can not load configuration %s from %s (%v)", c.NameId, local.Filename, errLocal)
+	}
+	return fmt.Errorf("ConfigurationSourceUnreachable:%s:%w", c.NameId, err)
+}
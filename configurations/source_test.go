@@ -0,0 +1,128 @@
+package configurations
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/utils"
+)
+
+// testSource gives content, or err, as json.
+type testSource struct {
+	mutex   sync.Mutex
+	content string
+	err     error
+	fetches int
+}
+
+func (s *testSource) Fetch(_ context.Context) (content []byte, format string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.fetches++
+	if s.err != nil {
+		return nil, ``, s.err
+	}
+	return []byte(s.content), `json`, nil
+}
+
+func (s *testSource) set(content string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.content = content
+	s.err = err
+}
+
+func newTestManager() *DXConfigurationManager {
+	return &DXConfigurationManager{
+		configurations:  map[string]*DXConfiguration{},
+		SecretProviders: map[string]DXSecretProvider{`env`: DXSecretProviderEnv{}},
+		secretCache:     map[string]dxSecretCacheEntry{},
+	}
+}
+
+// newTestSourceConfiguration is the configuration test of cm with the defaults {"a":1,"nested":{"x":1}} fetched from s
+// once, without a backoff.
+func newTestSourceConfiguration(cm *DXConfigurationManager, s DXConfigurationSource) *DXConfiguration {
+	c := cm.NewConfiguration(`test`, ``, `json`, false, false, utils.JSON{`a`: 1, `nested`: utils.JSON{`x`: 1}}, nil)
+	c.Source = s
+	c.SourceFetchPolicy = DXConfigurationFetchPolicy{MaxAttempts: 1}
+	return c
+}
+
+func TestLoadFromSourceMergesOverTheDefaults(t *testing.T) {
+	s := &testSource{content: `{"b":2,"nested":{"y":2}}`}
+	c := newTestSourceConfiguration(newTestManager(), s)
+	require.NoError(t, c.LoadFromSource(context.Background()))
+	assert.Equal(t, utils.JSON{`a`: 1, `b`: float64(2), `nested`: utils.JSON{`x`: 1, `y`: float64(2)}}, *c.data())
+
+	// a reload drops what the previous content had and the new one has not
+	s.set(`{"a":3,"c":4}`, nil)
+	require.NoError(t, c.LoadFromSource(context.Background()))
+	assert.Equal(t, utils.JSON{`a`: float64(3), `c`: float64(4), `nested`: utils.JSON{`x`: 1}}, *c.data())
+
+	s.set(`{}`, nil)
+	require.NoError(t, c.LoadFromSource(context.Background()))
+	assert.Equal(t, utils.JSON{`a`: 1, `nested`: utils.JSON{`x`: 1}}, *c.data())
+}
+
+func TestLoadFromSourceKeepsTheDataValidateRejects(t *testing.T) {
+	s := &testSource{content: `{"b":2}`}
+	c := newTestSourceConfiguration(newTestManager(), s)
+	c.Validate = func(data utils.JSON) (err error) {
+		if _, ok := data[`b`]; !ok {
+			return errors.New(`NoB`)
+		}
+		return nil
+	}
+	require.NoError(t, c.LoadFromSource(context.Background()))
+
+	s.set(`{"c":3}`, nil)
+	err := c.LoadFromSource(context.Background())
+	assert.ErrorContains(t, err, `ConfigurationInvalid:test`)
+	assert.Equal(t, utils.JSON{`a`: 1, `b`: float64(2), `nested`: utils.JSON{`x`: 1}}, *c.data())
+}
+
+func TestLoadFromSourceRetriesAndFallsBackToTheCache(t *testing.T) {
+	s := &testSource{content: `{"b":2}`}
+	c := newTestSourceConfiguration(newTestManager(), s)
+	c.SourceFetchPolicy = DXConfigurationFetchPolicy{MaxAttempts: 3, InitialBackoff: 1, MaxBackoff: 1}
+	c.CacheFilename = filepath.Join(t.TempDir(), `test.json`)
+	require.NoError(t, c.LoadFromSource(context.Background()))
+	assert.Equal(t, 1, s.fetches)
+
+	s.set(``, errors.New(`Unreachable`))
+	require.NoError(t, c.LoadFromSource(context.Background()))
+	assert.Equal(t, 4, s.fetches)
+	assert.Equal(t, utils.JSON{`a`: 1, `b`: float64(2), `nested`: utils.JSON{`x`: 1}}, *c.data())
+
+	require.NoError(t, os.Remove(c.CacheFilename))
+	err := c.LoadFromSource(context.Background())
+	assert.ErrorContains(t, err, `ConfigurationSourceUnreachable:test`)
+}
+
+func TestSourceHTTPFetchesYAML(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(`X-Token`) != `t` {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set(`Content-Type`, `application/yaml`)
+		_, _ = w.Write([]byte("b: 2\nnested:\n  y: 2\n"))
+	}))
+	defer server.Close()
+	c := newTestSourceConfiguration(newTestManager(), DXConfigurationSourceHTTP{URL: server.URL, Header: http.Header{`X-Token`: {`t`}}})
+	require.NoError(t, c.LoadFromSource(context.Background()))
+	assert.Equal(t, utils.JSON{`a`: 1, `b`: 2, `nested`: utils.JSON{`x`: 1, `y`: 2}}, *c.data())
+
+	c = newTestSourceConfiguration(newTestManager(), DXConfigurationSourceHTTP{URL: server.URL})
+	assert.ErrorContains(t, c.LoadFromSource(context.Background()), `ConfigurationSourceUnreachable:test`)
+}
@@ -1,3 +1,22 @@
 package v3
 
+import "time"
+
 var AppNameId = ""
+
+// AppTitle, AppVersion and AppDescription are copied from the app when it starts.
+var (
+	AppTitle       = ""
+	AppVersion     = ""
+	AppDescription = ""
+)
+
+// BuildCommit and BuildDate are meant to be set at build time, like
+//
+//	go build -ldflags "-X dxlib/v3.BuildCommit=$(git rev-parse HEAD) -X dxlib/v3.BuildDate=$(date -u +%FT%TZ)"
+var (
+	BuildCommit = ""
+	BuildDate   = ""
+)
+
+var StartTime = time.Now()
@@ -0,0 +1,33 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DXPanicPolicy is what the request, task and job scopes do with a panic once it is logged with its stack: "recover"
+// fails only that request or execution and keeps serving, "crash" panics again so the process ends. The panics outside
+// of these scopes, like at init, always end the process.
+type DXPanicPolicy string
+
+const (
+	PanicPolicyRecover DXPanicPolicy = "recover"
+	PanicPolicyCrash   DXPanicPolicy = "crash"
+)
+
+// PanicPolicy is set from DXApp.PanicPolicy at start.
+var PanicPolicy = PanicPolicyRecover
+
+func ParsePanicPolicy(s string) (p DXPanicPolicy, err error) {
+	switch p = DXPanicPolicy(strings.ToLower(s)); p {
+	case PanicPolicyRecover, PanicPolicyCrash:
+		return p, nil
+	default:
+		return PanicPolicyRecover, fmt.Errorf("InvalidPanicPolicy:%s", s)
+	}
+}
+
+// IsPanicCrash tells a recovering scope to panic again with the recovered value.
+func IsPanicCrash() bool {
+	return PanicPolicy == PanicPolicyCrash
+}
@@ -0,0 +1,120 @@
+package databases
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"dxlib/v3/databases/protected/db"
+	"dxlib/v3/log"
+)
+
+// DXDatabaseAcrossTxCallback gets the transaction of every database of BeginAcross by its name id.
+type DXDatabaseAcrossTxCallback func(log *log.DXLog, dtxs map[string]*DXDatabaseTx) (err error)
+
+// DXDatabaseAcrossCommitError is given when a commit of BeginAcross failed after the commits of Committed succeeded,
+// those can not be undone anymore. RolledBack are the databases rolled back after the failure.
+type DXDatabaseAcrossCommitError struct {
+	Committed  []string
+	Failed     string
+	RolledBack []string
+	Err        error
+}
+
+func (e *DXDatabaseAcrossCommitError) Error() string {
+	return fmt.Sprintf("AcrossCommitFailed:%s:committed=%s:rolled_back=%s:%v", e.Failed, strings.Join(e.Committed, `,`),
+		strings.Join(e.RolledBack, `,`), e.Err)
+}
+
+func (e *DXDatabaseAcrossCommitError) Unwrap() error {
+	return e.Err
+}
+
+// BeginAcross begins a transaction on each of the databases nameIds and runs callback with them, then commits them in
+// the order of nameIds, or rolls them all back when callback fails.
+//
+// This is best effort, not a two phase commit: when a commit fails the databases committed before it stay committed,
+// the rest is rolled back and a *DXDatabaseAcrossCommitError tells which ones. Put the database most likely to refuse
+// the commit first.
+func (dm *DXDatabaseManager) BeginAcross(log *log.DXLog, isolationLevel sql.IsolationLevel, callback DXDatabaseAcrossTxCallback, nameIds ...string) (err error) {
+	dtxs := map[string]*DXDatabaseTx{}
+	started := []string{}
+	rollbackFrom := func(nameIds []string) (rolledBack []string) {
+		for _, nameId := range nameIds {
+			errTx := dtxs[nameId].Tx.Rollback()
+			if errTx != nil {
+				log.Errorf(`ErrorInAcrossRollback %s: (%v)`, nameId, errTx.Error())
+				continue
+			}
+			rolledBack = append(rolledBack, nameId)
+		}
+		return rolledBack
+	}
+	untracks := []func(){}
+	defer func() {
+		for _, untrack := range untracks {
+			untrack()
+		}
+	}()
+	for _, nameId := range nameIds {
+		if _, ok := dtxs[nameId]; ok {
+			rollbackFrom(started)
+			return fmt.Errorf("AcrossDuplicateDatabase:%s", nameId)
+		}
+		d, ok := dm.Databases[nameId]
+		if !ok {
+			rollbackFrom(started)
+			err = log.ErrorAndCreateErrorf("Database %s not found to begin across", nameId)
+			return err
+		}
+		err = d.CheckConnectionAndReconnect()
+		if err == nil {
+			var tx *DXDatabaseTx
+			tx, err = d.beginTx(log, isolationLevel)
+			if err == nil {
+				dtxs[nameId] = tx
+				untracks = append(untracks, db.TrackTx(tx.Tx, d.Connection))
+			}
+		}
+		if err != nil {
+			log.Errorf(`ErrorInAcrossBegin %s: (%v)`, nameId, err.Error())
+			rollbackFrom(started)
+			return err
+		}
+		started = append(started, nameId)
+	}
+
+	err = callback(log, dtxs)
+	if err != nil {
+		log.Errorf(`ErrorInAcrossCallback: (%v)`, err.Error())
+		rollbackFrom(started)
+		return err
+	}
+	for i, nameId := range started {
+		err = dtxs[nameId].Tx.Commit()
+		if err == nil {
+			continue
+		}
+		commitErr := &DXDatabaseAcrossCommitError{
+			Committed:  append([]string{}, started[:i]...),
+			Failed:     nameId,
+			RolledBack: rollbackFrom(started[i+1:]),
+			Err:        err,
+		}
+		if i == 0 {
+			log.Errorf(`ErrorInAcrossCommit: nothing committed (%v)`, commitErr)
+		} else {
+			log.Errorf(`PARTIAL COMMIT ACROSS DATABASES, %s stay committed, manual reconciliation may be needed (%v)`,
+				strings.Join(commitErr.Committed, `,`), commitErr)
+		}
+		return commitErr
+	}
+	return nil
+}
+
+// IsAcrossPartialCommit is true when err is a commit failure of BeginAcross that left some databases committed.
+func IsAcrossPartialCommit(err error) bool {
+	var commitErr *DXDatabaseAcrossCommitError
+	return errors.As(err, &commitErr) && len(commitErr.Committed) > 0
+}
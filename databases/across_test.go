@@ -0,0 +1,90 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/log"
+)
+
+// newTestDeferredForeignKeyDatabase gives a database nameId of dm whose table child refers to parent by a foreign key
+// checked at commit, a child without parent fails the commit only.
+func newTestDeferredForeignKeyDatabase(t *testing.T, dm *DXDatabaseManager, nameId string) *DXDatabase {
+	t.Helper()
+	connection, err := sqlx.Open(`sqlite`, `file:`+filepath.Join(t.TempDir(), nameId+`.db`)+`?_pragma=foreign_keys(1)`)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = connection.Close()
+	})
+	_, err = connection.Exec(`CREATE TABLE parent (id INTEGER PRIMARY KEY);
+		CREATE TABLE child (parent_id INTEGER NOT NULL REFERENCES parent (id) DEFERRABLE INITIALLY DEFERRED)`)
+	require.NoError(t, err)
+	d := dm.NewDatabase(nameId, false, false)
+	d.Connection = connection
+	d.Connected = true
+	return d
+}
+
+func countTestNames(t *testing.T, d *DXDatabase) (n int) {
+	t.Helper()
+	require.NoError(t, d.Connection.Get(&n, `SELECT count(*) FROM t`))
+	return n
+}
+
+func TestBeginAcrossReportsTheCommittedDatabasesWhenACommitFails(t *testing.T) {
+	dm := newTestDatabaseManager()
+	first := newTestDatabase(t, dm, `first`)
+	newTestDeferredForeignKeyDatabase(t, dm, `second`)
+	third := newTestDatabase(t, dm, `third`)
+	l := log.NewLog(nil, context.Background(), `test`)
+
+	err := dm.BeginAcross(&l, sql.LevelDefault, func(l *log.DXLog, dtxs map[string]*DXDatabaseTx) (err error) {
+		_, err = dtxs[`first`].Exec(`INSERT INTO t (name) VALUES ('a')`)
+		require.NoError(t, err)
+		_, err = dtxs[`second`].Exec(`INSERT INTO child (parent_id) VALUES (1)`)
+		require.NoError(t, err)
+		_, err = dtxs[`third`].Exec(`INSERT INTO t (name) VALUES ('c')`)
+		require.NoError(t, err)
+		return nil
+	}, `first`, `second`, `third`)
+
+	var commitErr *DXDatabaseAcrossCommitError
+	require.ErrorAs(t, err, &commitErr)
+	assert.Equal(t, []string{`first`}, commitErr.Committed)
+	assert.Equal(t, `second`, commitErr.Failed)
+	assert.Equal(t, []string{`third`}, commitErr.RolledBack)
+	assert.ErrorContains(t, err, `FOREIGN KEY`)
+	assert.True(t, IsAcrossPartialCommit(err))
+	assert.Equal(t, 1, countTestNames(t, first))
+	assert.Equal(t, 0, countTestNames(t, third))
+}
+
+func TestBeginAcrossRollsEveryDatabaseBackWhenTheCallbackFails(t *testing.T) {
+	dm := newTestDatabaseManager()
+	first := newTestDatabase(t, dm, `first`)
+	second := newTestDatabase(t, dm, `second`)
+	l := log.NewLog(nil, context.Background(), `test`)
+	errCallback := errors.New(`callback failed`)
+
+	err := dm.BeginAcross(&l, sql.LevelDefault, func(l *log.DXLog, dtxs map[string]*DXDatabaseTx) (err error) {
+		for _, dtx := range dtxs {
+			_, err = dtx.Exec(`INSERT INTO t (name) VALUES ('a')`)
+			require.NoError(t, err)
+		}
+		return errCallback
+	}, `first`, `second`)
+	assert.ErrorIs(t, err, errCallback)
+	assert.False(t, IsAcrossPartialCommit(err))
+	assert.Equal(t, 0, countTestNames(t, first))
+	assert.Equal(t, 0, countTestNames(t, second))
+
+	err = dm.BeginAcross(&l, sql.LevelDefault, nil, `first`, `first`)
+	assert.ErrorContains(t, err, `AcrossDuplicateDatabase:first`)
+}
@@ -0,0 +1,69 @@
+package databases
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+)
+
+// DXDatabaseAdvisoryUnlockTimeout bounds the pg_advisory_unlock of an unlock, which runs after the context of the lock
+// may be done.
+const DXDatabaseAdvisoryUnlockTimeout = 5 * time.Second
+
+// AdvisoryLock waits for the Postgres session advisory lock key on the connection of s, until ctx is done. unlock
+// releases it, it can be deferred and called more than once, and is called when ctx is done. The lock is also released
+// when the connection is closed, not when s is given back to the pool by Close, so unlock must be called before.
+func AdvisoryLock(ctx context.Context, s *DXDatabaseSession, key int64) (unlock func(), acquired bool, err error) {
+	return advisoryLock(ctx, s, key, false)
+}
+
+// TryAdvisoryLock is AdvisoryLock without waiting, acquired is false when another session holds key.
+func TryAdvisoryLock(ctx context.Context, s *DXDatabaseSession, key int64) (unlock func(), acquired bool, err error) {
+	return advisoryLock(ctx, s, key, true)
+}
+
+func advisoryLock(ctx context.Context, s *DXDatabaseSession, key int64, isTry bool) (unlock func(), acquired bool, err error) {
+	if s.Conn.DriverName() != "postgres" {
+		err = fmt.Errorf("AdvisoryLockNotSupported:%s", s.Conn.DriverName())
+		return func() {}, false, err
+	}
+	function := `pg_advisory_lock`
+	if isTry {
+		function = `pg_try_advisory_lock`
+	}
+	row, err := s.QueryRow(ctx, `select `+function+`(:key)::text as acquired`, utils.JSON{`key`: key})
+	if err != nil {
+		log.Log.Errorf("Cannot take advisory lock %d of database %s (%v)", key, s.Database.NameId, err)
+		return func() {}, false, err
+	}
+	// pg_advisory_lock returns void, pg_try_advisory_lock a boolean
+	if isTry && fmt.Sprint(row[`acquired`]) != `true` {
+		return func() {}, false, nil
+	}
+
+	released := make(chan struct{})
+	var once sync.Once
+	unlock = func() {
+		once.Do(func() {
+			close(released)
+			unlockCtx, cancel := context.WithTimeout(context.Background(), DXDatabaseAdvisoryUnlockTimeout)
+			defer cancel()
+			_, err := s.Execute(unlockCtx, `select pg_advisory_unlock(:key)`, utils.JSON{`key`: key})
+			if err != nil {
+				log.Log.Errorf("Cannot release advisory lock %d of database %s (%v)", key, s.Database.NameId, err)
+			}
+		})
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			unlock()
+		case <-released:
+		}
+	}()
+	return unlock, true, nil
+}
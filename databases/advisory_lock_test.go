@@ -0,0 +1,88 @@
+package databases
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestPostgresSessions gives n sessions of the database of DXLIB_TEST_POSTGRES_DSN, or skips.
+func newTestPostgresSessions(t *testing.T, n int) (sessions []*DXDatabaseSession) {
+	t.Helper()
+	d := newTestPostgresDatabase(t, newTestDatabaseManager(), `advisory_lock`)
+	for i := 0; i < n; i++ {
+		s, err := d.Session(context.Background())
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = s.Close()
+		})
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+func TestTryAdvisoryLockContention(t *testing.T) {
+	sessions := newTestPostgresSessions(t, 2)
+	ctx := context.Background()
+
+	unlock, acquired, err := TryAdvisoryLock(ctx, sessions[0], 350001)
+	require.NoError(t, err)
+	require.True(t, acquired)
+	_, acquired, err = TryAdvisoryLock(ctx, sessions[1], 350001)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+
+	unlock()
+	unlock()
+	unlockOther, acquired, err := TryAdvisoryLock(ctx, sessions[1], 350001)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+	unlockOther()
+}
+
+func TestAdvisoryLockWaitsUntilItsContextIsDone(t *testing.T) {
+	sessions := newTestPostgresSessions(t, 2)
+	unlock, acquired, err := AdvisoryLock(context.Background(), sessions[0], 350002)
+	require.NoError(t, err)
+	require.True(t, acquired)
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, acquired, err = AdvisoryLock(ctx, sessions[1], 350002)
+	assert.Error(t, err)
+	assert.False(t, acquired)
+}
+
+func TestAdvisoryLockIsReleasedWithItsContext(t *testing.T) {
+	sessions := newTestPostgresSessions(t, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	unlock, acquired, err := AdvisoryLock(ctx, sessions[0], 350003)
+	require.NoError(t, err)
+	require.True(t, acquired)
+	defer unlock()
+
+	cancel()
+	require.Eventually(t, func() bool {
+		unlockOther, acquired, err := TryAdvisoryLock(context.Background(), sessions[1], 350003)
+		unlockOther()
+		return err == nil && acquired
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestAdvisoryLockNeedsPostgres(t *testing.T) {
+	d := newTestDatabase(t, newTestDatabaseManager(), `advisory_lock`)
+	s, err := d.Session(context.Background())
+	require.NoError(t, err)
+	defer func() {
+		_ = s.Close()
+	}()
+
+	unlock, acquired, err := TryAdvisoryLock(context.Background(), s, 1)
+	assert.EqualError(t, err, `AdvisoryLockNotSupported:sqlite`)
+	assert.False(t, acquired)
+	unlock()
+}
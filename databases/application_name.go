@@ -0,0 +1,74 @@
+package databases
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	v3 "dxlib/v3"
+	"dxlib/v3/databases/database_type"
+)
+
+const (
+	// PostgreSQLApplicationNameMaxLength is the bytes of application_name kept by postgres, NAMEDATALEN - 1
+	PostgreSQLApplicationNameMaxLength = 63
+	// OracleModuleNameMaxLength is the bytes of the module of DBMS_APPLICATION_INFO.SET_MODULE
+	OracleModuleNameMaxLength = 48
+)
+
+type routeContextKey struct{}
+
+// ContextWithRoute makes the sessions opened with ctx append route to their application name, when the database has
+// IsApplicationNameWithRoute.
+func ContextWithRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, routeContextKey{}, route)
+}
+
+func RouteFromContext(ctx context.Context) (route string, ok bool) {
+	if ctx == nil {
+		return ``, false
+	}
+	route, ok = ctx.Value(routeContextKey{}).(string)
+	return route, ok && route != ``
+}
+
+// ApplicationNameOf gives ApplicationName, or else the name id of the app.
+func (d *DXDatabase) ApplicationNameOf() string {
+	if d.ApplicationName != `` {
+		return d.ApplicationName
+	}
+	return v3.AppNameId
+}
+
+// ApplicationNameStatement gives the statement tagging the connection with name, truncated to the limit of the
+// driver, seen in pg_stat_activity on postgres and as the module in v$session on oracle. It is empty for an empty name
+// and for the other drivers, which only take it at login. Postgres takes the name of the pool at login too, the
+// statement is only for the route of a Session.
+func (d *DXDatabase) ApplicationNameStatement(name string) string {
+	if name == `` {
+		return ``
+	}
+	switch d.DatabaseType {
+	case database_type.PostgreSQL:
+		return `SET application_name = ` + quoteString(truncateBytes(name, PostgreSQLApplicationNameMaxLength))
+	case database_type.Oracle:
+		return `BEGIN DBMS_APPLICATION_INFO.SET_MODULE(` + quoteString(truncateBytes(name, OracleModuleNameMaxLength)) + `, NULL); END;`
+	default:
+		return ``
+	}
+}
+
+func quoteString(s string) string {
+	return `'` + strings.ReplaceAll(s, `'`, `''`) + `'`
+}
+
+// truncateBytes cuts s to at most n bytes, without splitting a character.
+func truncateBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,50 @@
+package databases
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/databases/database_type"
+)
+
+func TestApplicationNameIsInThePostgresDSN(t *testing.T) {
+	d := &DXDatabase{NameId: `test`, DatabaseType: database_type.PostgreSQL, Address: `db:5432`, DatabaseName: `app`,
+		UserName: `u`, UserPassword: `p`, ApplicationName: `billing worker`}
+	dsn, err := d.GetConnectionString()
+	require.NoError(t, err)
+	u, err := url.Parse(dsn)
+	require.NoError(t, err)
+	assert.Equal(t, `billing worker`, u.Query().Get(`application_name`))
+
+	d.ApplicationName = strings.Repeat(`a`, 62) + `é`
+	dsn, err = d.GetConnectionString()
+	require.NoError(t, err)
+	u, err = url.Parse(dsn)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat(`a`, 62), u.Query().Get(`application_name`))
+
+	d.ConnectionOptions = `application_name=custom`
+	dsn, err = d.GetConnectionString()
+	require.NoError(t, err)
+	u, err = url.Parse(dsn)
+	require.NoError(t, err)
+	assert.Equal(t, `custom`, u.Query().Get(`application_name`))
+}
+
+func TestSessionInitStatementsTagOnlyOracle(t *testing.T) {
+	d := &DXDatabase{NameId: `test`, DatabaseType: database_type.PostgreSQL, SearchPath: []string{`app`}, ApplicationName: `api`}
+	statements, err := d.SessionInitStatements()
+	require.NoError(t, err)
+	assert.Equal(t, []string{`SET search_path TO "app"`}, statements)
+	// the route of a session is still set by a statement
+	assert.Equal(t, `SET application_name = 'api /users'`, d.ApplicationNameStatement(`api /users`))
+
+	d = &DXDatabase{NameId: `test`, DatabaseType: database_type.Oracle, ApplicationName: `it's`}
+	statements, err = d.SessionInitStatements()
+	require.NoError(t, err)
+	assert.Equal(t, []string{`BEGIN DBMS_APPLICATION_INFO.SET_MODULE('it''s', NULL); END;`}, statements)
+}
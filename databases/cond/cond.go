@@ -0,0 +1,367 @@
+package cond
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"dxlib/v3/databases/protected/db"
+	"dxlib/v3/utils"
+)
+
+// DXConditionArgPrefix starts the names of the args of a built condition, cond_0, cond_1 ...
+const DXConditionArgPrefix = `cond_`
+
+var ErrInvalidIdentifier = errors.New("InvalidIdentifier")
+
+// ErrNilCondition is the error of building Not(nil), which has no meaning, unlike an And or Or leaving out a nil one.
+var ErrNilCondition = errors.New("ConditionNil")
+
+// identifierRegexp is a column, or a table and a column, that needs no escaping once quoted.
+var identifierRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*(\.[A-Za-z_][A-Za-z0-9_$]*)?$`)
+
+// DXCondition is a where condition on columns, the values are never written in the SQL, they are bound as args.
+type DXCondition interface {
+	write(b *builder) (err error)
+}
+
+type builder struct {
+	driverName     string
+	identifierCase db.DXIdentifierCase
+	s              strings.Builder
+	args           utils.JSON
+}
+
+func (b *builder) column(column string) (err error) {
+	if !identifierRegexp.MatchString(column) {
+		return fmt.Errorf("%w:%s", ErrInvalidIdentifier, column)
+	}
+	for i, v := range strings.Split(column, `.`) {
+		if i > 0 {
+			b.s.WriteString(`.`)
+		}
+		b.s.WriteString(db.FormatIdentifier(b.driverName, b.identifierCase, v))
+	}
+	return nil
+}
+
+func (b *builder) arg(v any) {
+	name := DXConditionArgPrefix + strconv.Itoa(len(b.args))
+	b.args[name] = v
+	b.s.WriteString(`:` + name)
+}
+
+type comparison struct {
+	column   string
+	operator string
+	value    any
+}
+
+func (c comparison) write(b *builder) (err error) {
+	err = b.column(c.column)
+	if err != nil {
+		return err
+	}
+	if c.value == nil {
+		switch c.operator {
+		case `=`:
+			b.s.WriteString(` is null`)
+			return nil
+		case `<>`:
+			b.s.WriteString(` is not null`)
+			return nil
+		default:
+			return fmt.Errorf("ConditionNilValue:%s %s", c.column, c.operator)
+		}
+	}
+	b.s.WriteString(` ` + c.operator + ` `)
+	b.arg(c.value)
+	return nil
+}
+
+// Eq is column = value, a nil value is "is null".
+func Eq(column string, value any) DXCondition {
+	return comparison{column: column, operator: `=`, value: value}
+}
+
+// NotEq is column <> value, a nil value is "is not null".
+func NotEq(column string, value any) DXCondition {
+	return comparison{column: column, operator: `<>`, value: value}
+}
+
+func Lt(column string, value any) DXCondition {
+	return comparison{column: column, operator: `<`, value: value}
+}
+
+func Lte(column string, value any) DXCondition {
+	return comparison{column: column, operator: `<=`, value: value}
+}
+
+func Gt(column string, value any) DXCondition {
+	return comparison{column: column, operator: `>`, value: value}
+}
+
+func Gte(column string, value any) DXCondition {
+	return comparison{column: column, operator: `>=`, value: value}
+}
+
+// Like is column like pattern, the % and _ of pattern are wildcards.
+func Like(column string, pattern string) DXCondition {
+	return comparison{column: column, operator: `like`, value: pattern}
+}
+
+func NotLike(column string, pattern string) DXCondition {
+	return comparison{column: column, operator: `not like`, value: pattern}
+}
+
+type null struct {
+	column string
+	isNot  bool
+}
+
+func (c null) write(b *builder) (err error) {
+	err = b.column(c.column)
+	if err != nil {
+		return err
+	}
+	if c.isNot {
+		b.s.WriteString(` is not null`)
+	} else {
+		b.s.WriteString(` is null`)
+	}
+	return nil
+}
+
+func IsNull(column string) DXCondition {
+	return null{column: column}
+}
+
+func IsNotNull(column string) DXCondition {
+	return null{column: column, isNot: true}
+}
+
+type in struct {
+	column string
+	values any
+	isNot  bool
+}
+
+func (c in) write(b *builder) (err error) {
+	rv := reflect.ValueOf(c.values)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return fmt.Errorf("ConditionInValuesNotSlice:%s", c.column)
+	}
+	if rv.Len() == 0 {
+		if c.isNot {
+			b.s.WriteString(`1=1`)
+		} else {
+			b.s.WriteString(`1=0`)
+		}
+		return nil
+	}
+	err = b.column(c.column)
+	if err != nil {
+		return err
+	}
+	if db.DriverCapabilities(b.driverName).SupportsArrayParams {
+		if c.isNot {
+			b.s.WriteString(` <> ALL(`)
+		} else {
+			b.s.WriteString(` = ANY(`)
+		}
+		b.arg(pq.Array(c.values))
+		b.s.WriteString(`)`)
+		return nil
+	}
+	if c.isNot {
+		b.s.WriteString(` not in (`)
+	} else {
+		b.s.WriteString(` in (`)
+	}
+	for i := 0; i < rv.Len(); i++ {
+		if i > 0 {
+			b.s.WriteString(`, `)
+		}
+		b.arg(rv.Index(i).Interface())
+	}
+	b.s.WriteString(`)`)
+	return nil
+}
+
+// In is column in values, values is a slice, one arg each or, on postgres, a single array arg. No values is always false.
+func In(column string, values any) DXCondition {
+	return in{column: column, values: values}
+}
+
+// NotIn is column not in values, no values is always true.
+func NotIn(column string, values any) DXCondition {
+	return in{column: column, values: values, isNot: true}
+}
+
+type between struct {
+	column string
+	low    any
+	high   any
+}
+
+func (c between) write(b *builder) (err error) {
+	err = b.column(c.column)
+	if err != nil {
+		return err
+	}
+	b.s.WriteString(` between `)
+	b.arg(c.low)
+	b.s.WriteString(` and `)
+	b.arg(c.high)
+	return nil
+}
+
+// Between is low <= column <= high.
+func Between(column string, low any, high any) DXCondition {
+	return between{column: column, low: low, high: high}
+}
+
+type group struct {
+	operator   string
+	conditions []DXCondition
+}
+
+func (c group) write(b *builder) (err error) {
+	conditions := []DXCondition{}
+	for _, v := range c.conditions {
+		if v != nil {
+			conditions = append(conditions, v)
+		}
+	}
+	if len(conditions) == 0 {
+		if c.operator == `and` {
+			b.s.WriteString(`1=1`)
+		} else {
+			b.s.WriteString(`1=0`)
+		}
+		return nil
+	}
+	if len(conditions) == 1 {
+		return conditions[0].write(b)
+	}
+	for i, v := range conditions {
+		if i > 0 {
+			b.s.WriteString(` ` + c.operator + ` `)
+		}
+		b.s.WriteString(`(`)
+		err = v.write(b)
+		if err != nil {
+			return err
+		}
+		b.s.WriteString(`)`)
+	}
+	return nil
+}
+
+// And is true when all the conditions are, the nil ones are left out and none is always true.
+func And(conditions ...DXCondition) DXCondition {
+	return group{operator: `and`, conditions: conditions}
+}
+
+// Or is true when any of the conditions is, the nil ones are left out and none is always false.
+func Or(conditions ...DXCondition) DXCondition {
+	return group{operator: `or`, conditions: conditions}
+}
+
+type not struct {
+	condition DXCondition
+}
+
+func (c not) write(b *builder) (err error) {
+	if c.condition == nil {
+		return fmt.Errorf("%w:not", ErrNilCondition)
+	}
+	b.s.WriteString(`not (`)
+	err = c.condition.write(b)
+	if err != nil {
+		return err
+	}
+	b.s.WriteString(`)`)
+	return nil
+}
+
+// Not is true when condition is false, a nil condition fails the build with ErrNilCondition.
+func Not(condition DXCondition) DXCondition {
+	return not{condition: condition}
+}
+
+// Build gives the where fragment of c, without the where keyword, with its :cond_<n> named args, for
+// db.PositionalQuery or a named query.
+func Build(driverName string, identifierCase db.DXIdentifierCase, c DXCondition) (s string, args utils.JSON, err error) {
+	b := &builder{driverName: driverName, identifierCase: identifierCase, args: utils.JSON{}}
+	if c == nil {
+		c = And()
+	}
+	err = c.write(b)
+	if err != nil {
+		return ``, nil, err
+	}
+	return b.s.String(), b.args, nil
+}
+
+type DXOrder struct {
+	Column       string
+	IsDescending bool
+}
+
+func Asc(column string) DXOrder {
+	return DXOrder{Column: column}
+}
+
+func Desc(column string) DXOrder {
+	return DXOrder{Column: column, IsDescending: true}
+}
+
+// DXClauses are the where, order by and paging of a select, a zero Limit gives no paging.
+type DXClauses struct {
+	Where   DXCondition
+	OrderBy []DXOrder
+	Limit   int64
+	Offset  int64
+}
+
+// Build gives the clauses to append to a select, starting with a space, and the named args of Where. SQL Server and
+// Oracle need an OrderBy for the paging.
+func (c DXClauses) Build(driverName string, identifierCase db.DXIdentifierCase) (s string, args utils.JSON, err error) {
+	b := &builder{driverName: driverName, identifierCase: identifierCase, args: utils.JSON{}}
+	if c.Where != nil {
+		b.s.WriteString(` where `)
+		err = c.Where.write(b)
+		if err != nil {
+			return ``, nil, err
+		}
+	}
+	for i, v := range c.OrderBy {
+		if i == 0 {
+			b.s.WriteString(` order by `)
+		} else {
+			b.s.WriteString(`, `)
+		}
+		err = b.column(v.Column)
+		if err != nil {
+			return ``, nil, err
+		}
+		if v.IsDescending {
+			b.s.WriteString(` desc`)
+		} else {
+			b.s.WriteString(` asc`)
+		}
+	}
+	if c.Limit > 0 {
+		if len(c.OrderBy) == 0 && db.DriverCapabilities(driverName).IsPagingOrderByRequired {
+			return ``, nil, fmt.Errorf("PagingWithoutOrderBy:%s", driverName)
+		}
+		b.s.WriteString(db.SQLPartLimitOffset(driverName, c.Limit, c.Offset))
+	}
+	return b.s.String(), b.args, nil
+}
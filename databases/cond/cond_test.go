@@ -0,0 +1,73 @@
+package cond
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/databases/protected/db"
+	"dxlib/v3/utils"
+)
+
+func TestBuild(t *testing.T) {
+	s, args, err := Build(`mysql`, db.IdentifierCasePreserve, And(
+		Eq(`status`, `active`),
+		nil,
+		Or(Gt(`age`, 18), IsNull(`age`)),
+		Not(In(`role`, []string{`admin`, `root`})),
+		Between(`u.created_at`, 1, 2),
+	))
+	require.NoError(t, err)
+	assert.Equal(t, "(`status` = :cond_0) and ((`age` > :cond_1) or (`age` is null)) and "+
+		"(not (`role` in (:cond_2, :cond_3))) and (`u`.`created_at` between :cond_4 and :cond_5)", s)
+	assert.Equal(t, utils.JSON{`cond_0`: `active`, `cond_1`: 18, `cond_2`: `admin`, `cond_3`: `root`, `cond_4`: 1, `cond_5`: 2}, args)
+}
+
+func TestBuildNilValuesAndEmptyGroups(t *testing.T) {
+	s, args, err := Build(`mysql`, db.IdentifierCasePreserve, And(Eq(`a`, nil), NotEq(`b`, nil), In(`c`, []int{}), NotIn(`d`, []int{})))
+	require.NoError(t, err)
+	assert.Equal(t, "(`a` is null) and (`b` is not null) and (1=0) and (1=1)", s)
+	assert.Empty(t, args)
+
+	s, _, err = Build(`mysql`, db.IdentifierCasePreserve, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `1=1`, s)
+	s, _, err = Build(`mysql`, db.IdentifierCasePreserve, Or())
+	require.NoError(t, err)
+	assert.Equal(t, `1=0`, s)
+
+	_, _, err = Build(`mysql`, db.IdentifierCasePreserve, Lt(`a`, nil))
+	assert.ErrorContains(t, err, `ConditionNilValue`)
+}
+
+func TestBuildNotNilFails(t *testing.T) {
+	assert.NotPanics(t, func() {
+		_, _, err := Build(`postgres`, db.IdentifierCasePreserve, Not(nil))
+		assert.ErrorIs(t, err, ErrNilCondition)
+	})
+	_, _, err := Build(`postgres`, db.IdentifierCasePreserve, And(Eq(`a`, 1), Not(nil)))
+	assert.ErrorIs(t, err, ErrNilCondition)
+}
+
+func TestBuildRejectsInvalidIdentifiers(t *testing.T) {
+	_, _, err := Build(`postgres`, db.IdentifierCasePreserve, Eq(`a; drop table t`, 1))
+	assert.ErrorIs(t, err, ErrInvalidIdentifier)
+	_, _, err = DXClauses{OrderBy: []DXOrder{Asc(`a desc, b`)}}.Build(`postgres`, db.IdentifierCasePreserve)
+	assert.ErrorIs(t, err, ErrInvalidIdentifier)
+}
+
+func TestClausesBuild(t *testing.T) {
+	s, args, err := DXClauses{
+		Where:   Like(`name`, `a%`),
+		OrderBy: []DXOrder{Desc(`created_at`), Asc(`id`)},
+		Limit:   10,
+		Offset:  20,
+	}.Build(`mysql`, db.IdentifierCasePreserve)
+	require.NoError(t, err)
+	assert.Equal(t, " where `name` like :cond_0 order by `created_at` desc, `id` asc"+db.SQLPartLimitOffset(`mysql`, 10, 20), s)
+	assert.Equal(t, utils.JSON{`cond_0`: `a%`}, args)
+
+	_, _, err = DXClauses{Limit: 10}.Build(`sqlserver`, db.IdentifierCasePreserve)
+	assert.ErrorContains(t, err, `PagingWithoutOrderBy`)
+}
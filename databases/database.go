@@ -3,10 +3,14 @@ package databases
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -17,15 +21,25 @@ import (
 
 	"dxlib/v3/databases/sqlfile"
 
+	"dxlib/v3/breaker"
 	"dxlib/v3/configurations"
 	"dxlib/v3/databases/database_type"
 	"dxlib/v3/databases/protected/db"
 	"dxlib/v3/databases/protected/dbtx"
 	"dxlib/v3/log"
 	"dxlib/v3/utils"
+	"dxlib/v3/utils/json"
 	utilsSql "dxlib/v3/utils/security"
 )
 
+const (
+	DXDatabaseRolePrimary = "primary"
+	DXDatabaseRoleReplica = "replica"
+)
+
+// ErrPreparedStatementsDisabled is the error of PreparedStatement on a database with prepared_statements off.
+var ErrPreparedStatementsDisabled = errors.New("PreparedStatementsDisabled")
+
 type DXDatabaseEventFunc func(dm *DXDatabase, err error)
 
 type DXDatabaseTxCallback func(log *log.DXLog, dtx *DXDatabaseTx) (err error)
@@ -48,14 +62,38 @@ type DXDatabaseTx struct {
 }
 
 type DXDatabase struct {
-	NameId                       string
-	IsConfigured                 bool
-	DatabaseType                 database_type.DXDatabaseType
-	Address                      string
-	UserName                     string
-	UserPassword                 string
-	DatabaseName                 string
-	ConnectionOptions            string
+	NameId string
+	// Role is primary or replica, it only labels the metrics of the connection pool
+	Role              string
+	IsConfigured      bool
+	DatabaseType      database_type.DXDatabaseType
+	Address           string
+	UserName          string
+	UserPassword      string
+	DatabaseName      string
+	ConnectionOptions string
+	// IsPreparedStatements false, for poolers like PgBouncer in transaction mode, makes lib/pq bind the args of every
+	// query of the connection without a separate prepare, by binary_parameters, and Execute pass them positionally, see
+	// db.PositionalQuery. The statements prepared on purpose, StatementCache and PreparedStatement, are refused instead.
+	IsPreparedStatements bool
+	SlowQueryThreshold   time.Duration
+	IdentifierCase       db.DXIdentifierCase
+	// SearchPath are the schemas the unqualified names resolve against, set on every new connection, see
+	// SessionInitStatements
+	SearchPath []string
+	// ApplicationName tags the connections, see ApplicationNameStatement, it is the name id of the app when empty.
+	// IsApplicationNameWithRoute appends the route of the request to it for the sessions, see ContextWithRoute
+	ApplicationName            string
+	IsApplicationNameWithRoute bool
+	// StatementCacheSize is the number of prepared statements kept by StatementCache, 0 disables it
+	StatementCacheSize int
+	StatementCache     *DXDatabaseStatementCache
+	MaxIdleConnections int
+	// IsWarmUp opens and pings WarmUpConnections connections at connect, up to MaxIdleConnections, 0 is all of them
+	IsWarmUp          bool
+	WarmUpConnections int
+	// CircuitBreaker, set by a circuit_breaker block, stops RetryOnTransient calling the database while it is unreachable
+	CircuitBreaker               *breaker.DXCircuitBreaker
 	IsConnectAtStart             bool
 	MustConnected                bool
 	Connected                    bool
@@ -64,20 +102,62 @@ type DXDatabase struct {
 	NonSensitiveConnectionString string
 	OnCannotConnect              DXDatabaseEventFunc
 	CreateScriptFiles            []string
+	// connectMutex makes the concurrent connects, like the first uses of a tenant, open the pool once
+	connectMutex sync.Mutex
+}
+
+// dxDatabaseRedactedError hides the connection string and the password of the database in the message of err.
+type dxDatabaseRedactedError struct {
+	err     error
+	message string
+}
+
+func (e *dxDatabaseRedactedError) Error() string {
+	return e.message
+}
+
+func (e *dxDatabaseRedactedError) Unwrap() error {
+	return e.err
+}
+
+// RedactDSN masks the password of s with configurations.RedactDSN, and also the password of the database as it is and
+// URL encoded, for the driver messages that quote it out of a connection string.
+func (d *DXDatabase) RedactDSN(s string) string {
+	s = configurations.RedactDSN(s)
+	if d.UserPassword == `` {
+		return s
+	}
+	for _, v := range []string{d.UserPassword, url.QueryEscape(d.UserPassword), url.PathEscape(d.UserPassword)} {
+		s = strings.ReplaceAll(s, v, `***`)
+	}
+	return s
+}
+
+func (d *DXDatabase) redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &dxDatabaseRedactedError{err: err, message: d.RedactDSN(err.Error())}
 }
 
 func (d *DXDatabase) CheckConnection() (err error) {
 	dbConn, err := d.Connection.Conn(context.Background())
 	if err != nil {
+		err = d.redactError(err)
 		log.Log.Warnf("Database %v CheckConnection() failed: %v", d.NameId, err)
 		d.Connected = false
 		return err
 	}
+	// the connection taken for the ping goes back to the pool, or the pool is drained one check at a time
+	defer func() {
+		_ = dbConn.Close()
+	}()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 
 	if err := dbConn.PingContext(ctx); err != nil {
+		err = d.redactError(err)
 		d.Connected = false
 		log.Log.Warnf("Database %v ping failed: %v", d.NameId, err)
 		return err
@@ -123,26 +203,64 @@ func (d *DXDatabase) GetNonSensitiveConnectionString() string {
 	return fmt.Sprintf("%s://%s/%s", d.DatabaseType.String(), d.Address, d.DatabaseName)
 }
 
-func (d *DXDatabase) GetConnectionString() (s string, err error) {
+func (d *DXDatabase) GetConnectionConfig() (c DXDatabaseConnectionConfig, err error) {
+	c = DXDatabaseConnectionConfig{
+		Host:         d.Address,
+		UserName:     d.UserName,
+		UserPassword: d.UserPassword,
+		DatabaseName: d.DatabaseName,
+		Options:      map[string]string{},
+	}
+	host, port, err := net.SplitHostPort(d.Address)
+	if err == nil {
+		c.Host = host
+		c.Port = port
+	}
+	options, err := url.ParseQuery(d.ConnectionOptions)
+	if err != nil {
+		err = log.Log.ErrorAndCreateErrorf("configuration is unusable, connection_options of database %s is invalid (%v)", d.NameId, err)
+		return c, err
+	}
+	for k := range options {
+		c.Options[k] = options.Get(k)
+	}
 	switch d.DatabaseType {
 	case database_type.PostgreSQL:
-		s = fmt.Sprintf("%s://%s:%s@%s/%s?%s", d.DatabaseType.String(), d.UserName, d.UserPassword, d.Address, d.DatabaseName, d.ConnectionOptions)
+		if !d.IsPreparedStatements {
+			// binary_parameters makes lib/pq send the parameterized queries in a single round trip, without a separate prepare
+			c.Options[`binary_parameters`] = `yes`
+		}
+		// lib/pq sends it in the startup message, so every connection is tagged from its login, see ApplicationNameOf
+		_, ok := c.Options[`application_name`]
+		if !ok && d.ApplicationNameOf() != `` {
+			c.Options[`application_name`] = truncateBytes(d.ApplicationNameOf(), PostgreSQLApplicationNameMaxLength)
+		}
 	case database_type.SQLServer:
-		host, port, err := net.SplitHostPort(d.Address)
-		if err != nil {
-			return "", err
+		_, ok := c.Options[`encrypt`]
+		if !ok {
+			c.Options[`encrypt`] = `disable`
 		}
-		s = fmt.Sprintf("server=%s;port=%s;user id=%s;password=%s;database=%s;encrypt=disable", host, port, d.UserName, d.UserPassword, d.DatabaseName)
-	default:
-		err = log.Log.ErrorAndCreateErrorf("configuration is unusable, value of database_type field of database %s configuration is not supported (%s)", d.NameId, s)
 	}
-	return s, err
+	return c, nil
+}
+
+func (d *DXDatabase) GetConnectionString() (s string, err error) {
+	c, err := d.GetConnectionConfig()
+	if err != nil {
+		return "", err
+	}
+	s, err = BuildDSN(d.DatabaseType.String(), c)
+	if err != nil {
+		err = log.Log.ErrorAndCreateErrorf("configuration is unusable, value of database_type field of database %s configuration is not supported (%v)", d.NameId, err)
+		return "", err
+	}
+	return s, nil
 }
 
 func (d *DXDatabase) ApplyFromConfiguration(configurationNameId string) (err error) {
 	if !d.IsConfigured {
 		log.Log.Infof("Configuring to Database %s... start", d.NameId)
-		configurationData, ok := configurations.Manager.Configurations[configurationNameId]
+		configurationData, ok := configurations.Manager.Get(configurationNameId)
 		if !ok {
 			err = log.Log.PanicAndCreateErrorf("DXDatabase/ApplyFromConfiguration/1", "Storage configuration not found")
 			return err
@@ -231,7 +349,77 @@ func (d *DXDatabase) ApplyFromConfiguration(configurationNameId string) (err err
 			}
 		}
 		d.CreateScriptFiles, _ = databaseConfiguration[`create_script_files`].([]string)
-		d.ConnectionOptions, _ = databaseConfiguration[`connection_options`].(string)
+		switch o := databaseConfiguration[`connection_options`].(type) {
+		case string:
+			d.ConnectionOptions = o
+		case utils.JSON:
+			m, err := utils.JSONToMapStringString(o)
+			if err != nil {
+				err = log.Log.ErrorAndCreateErrorf("configuration is unusable, connection_options of database %s must be a string or a map of string (%v)", d.NameId, err)
+				return err
+			}
+			v := url.Values{}
+			for k, x := range m {
+				v.Set(k, x)
+			}
+			d.ConnectionOptions = v.Encode()
+		}
+		b, ok = databaseConfiguration[`prepared_statements`].(bool)
+		if ok {
+			d.IsPreparedStatements = b
+		}
+		d.SlowQueryThreshold = time.Duration(json.GetNumberWithDefault(databaseConfiguration, `slow_query_threshold_ms`, db.DefaultSlowQueryThreshold.Milliseconds())) * time.Millisecond
+		d.StatementCacheSize = json.GetNumberWithDefault(databaseConfiguration, `statement_cache_size`, DXDatabaseDefaultStatementCacheSize)
+		d.MaxIdleConnections = json.GetNumberWithDefault(databaseConfiguration, `max_idle_connections`, DXDatabaseDefaultMaxIdleConnections)
+		d.IsWarmUp, _ = databaseConfiguration[`warm_up`].(bool)
+		d.WarmUpConnections = json.GetNumberWithDefault(databaseConfiguration, `warm_up_connections`, 0)
+		circuitBreakerConfiguration, ok := databaseConfiguration[`circuit_breaker`].(utils.JSON)
+		if ok {
+			d.CircuitBreaker = breaker.Manager.NewCircuitBreakerFromConfiguration(`database/`+d.NameId, circuitBreakerConfiguration)
+			driverName := d.DatabaseType.String()
+			d.CircuitBreaker.IsFailure = func(err error) bool {
+				return IsUnavailableError(err, driverName)
+			}
+		}
+		d.Role, _ = databaseConfiguration[`role`].(string)
+		switch d.Role {
+		case ``:
+			d.Role = DXDatabaseRolePrimary
+		case DXDatabaseRolePrimary, DXDatabaseRoleReplica:
+		default:
+			err = log.Log.ErrorAndCreateErrorf("configuration is unusable, role of database %s must be primary or replica (%s)", d.NameId, d.Role)
+			return err
+		}
+		identifierCase, _ := databaseConfiguration[`identifier_case`].(string)
+		d.IdentifierCase, err = db.ParseIdentifierCase(identifierCase)
+		if err != nil {
+			err = log.Log.ErrorAndCreateErrorf("configuration is unusable, identifier_case of database %s must be preserve, lower or upper (%v)", d.NameId, err)
+			return err
+		}
+		if schema, ok := databaseConfiguration[`schema`].(string); ok {
+			d.SearchPath = []string{schema}
+		}
+		switch v := databaseConfiguration[`search_path`].(type) {
+		case string:
+			d.SearchPath = nil
+			for _, schema := range strings.Split(v, `,`) {
+				if schema = strings.TrimSpace(schema); schema != `` {
+					d.SearchPath = append(d.SearchPath, schema)
+				}
+			}
+		case []any:
+			d.SearchPath, err = json.GetStrings(databaseConfiguration, `search_path`)
+			if err != nil {
+				err = log.Log.ErrorAndCreateErrorf("configuration is unusable, search_path of database %s must be a string or a list of string (%v)", d.NameId, err)
+				return err
+			}
+		}
+		d.ApplicationName, _ = databaseConfiguration[`application_name`].(string)
+		d.IsApplicationNameWithRoute, _ = databaseConfiguration[`application_name_with_route`].(bool)
+		_, err = d.SessionInitStatements()
+		if err != nil {
+			return err
+		}
 
 		d.NonSensitiveConnectionString = d.GetNonSensitiveConnectionString()
 		d.ConnectionString, err = d.GetConnectionString()
@@ -261,11 +449,40 @@ func (d *DXDatabase) CheckIsErrorBecauseDbNotExist(err error) bool {
 	return false
 }
 
+// CheckReachable pings the database with a throwaway connection, it never ends the process like Connect does when MustConnected.
+func (d *DXDatabase) CheckReachable(ctx context.Context) (err error) {
+	connection, err := sqlx.Open(d.DatabaseType.String(), d.ConnectionString)
+	if err != nil {
+		return d.redactError(err)
+	}
+	defer func() {
+		_ = connection.Close()
+	}()
+	return d.redactError(connection.PingContext(ctx))
+}
+
+// HealthCheck pings the database through its pool, for health.Register.
+func (d *DXDatabase) HealthCheck(ctx context.Context) (err error) {
+	if !d.Connected || d.Connection == nil {
+		return fmt.Errorf("DatabaseNotConnected:%s", d.NameId)
+	}
+	return d.redactError(d.Connection.PingContext(ctx))
+}
+
 func (d *DXDatabase) Connect() (err error) {
+	return d.ConnectContext(context.Background())
+}
+
+// ConnectContext is Connect aborted once ctx is done, with the error of ctx and without OnCannotConnect, even when
+// MustConnected.
+func (d *DXDatabase) ConnectContext(ctx context.Context) (err error) {
+	d.connectMutex.Lock()
+	defer d.connectMutex.Unlock()
 	if !d.Connected {
 		log.Log.Infof("Connecting to database %s/%s... start", d.NameId, d.NonSensitiveConnectionString)
-		connection, err := sqlx.Open(d.DatabaseType.String(), d.ConnectionString)
+		connection, err := d.open()
 		if err != nil {
+			err = d.redactError(err)
 			if d.MustConnected {
 				log.Log.Fatalf("Invalid parameters to open database %s/%s (%s)", d.NameId, d.NonSensitiveConnectionString, err)
 				return nil
@@ -275,8 +492,19 @@ func (d *DXDatabase) Connect() (err error) {
 			}
 		}
 		d.Connection = connection
-		err = connection.Ping()
+		if d.MaxIdleConnections > 0 {
+			connection.SetMaxIdleConns(d.MaxIdleConnections)
+		}
+		db.SetSlowQueryThreshold(connection, d.SlowQueryThreshold)
+		db.SetIdentifierCase(connection, d.IdentifierCase)
+		err = untilDone(ctx, func() error {
+			return connection.PingContext(ctx)
+		})
+		if err != nil && ctx.Err() != nil {
+			return d.abortConnect(ctx)
+		}
 		if err != nil {
+			err = d.redactError(err)
 			if d.OnCannotConnect != nil {
 				d.OnCannotConnect(d, err)
 			}
@@ -288,20 +516,80 @@ func (d *DXDatabase) Connect() (err error) {
 				return err
 			}
 		}
+		if d.IsWarmUp {
+			err = untilDone(ctx, func() error {
+				return d.warmUp(ctx)
+			})
+			if err != nil && ctx.Err() != nil {
+				return d.abortConnect(ctx)
+			}
+			if err != nil {
+				err = d.redactError(err)
+				if d.OnCannotConnect != nil {
+					d.OnCannotConnect(d, err)
+				}
+				if d.MustConnected {
+					log.Log.Fatalf("Cannot warm up the connections to database %s/%s (%s)", d.NameId, d.NonSensitiveConnectionString, err)
+					return nil
+				} else {
+					log.Log.Errorf("Cannot warm up the connections to database %s/%s (%s)", d.NameId, d.NonSensitiveConnectionString, err)
+					return err
+				}
+			}
+		}
+		if d.StatementCacheSize > 0 {
+			if d.IsPreparedStatements {
+				d.StatementCache = NewStatementCache(d.StatementCacheSize)
+			} else {
+				log.Log.Warnf("Statement cache of database %s is disabled, prepared_statements is off", d.NameId)
+			}
+		}
 		d.Connected = true
 		log.Log.Infof("Connecting to database %s/%s... done CONNECTED", d.NameId, d.NonSensitiveConnectionString)
 	}
 	return nil
 }
 
+// untilDone waits for fn only until ctx is done, some drivers, like lib/pq, do not abort their handshake with ctx. fn is
+// then left to end by itself.
+func untilDone(ctx context.Context, fn func() error) (err error) {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// abortConnect closes the connection being connected once ctx is done, giving the error of ctx.
+func (d *DXDatabase) abortConnect(ctx context.Context) (err error) {
+	log.Log.Warnf("Connecting to database %s/%s... aborted (%v)", d.NameId, d.NonSensitiveConnectionString, ctx.Err())
+	_ = d.Connection.Close()
+	db.RemoveSlowQueryThreshold(d.Connection)
+	db.RemoveIdentifierCase(d.Connection)
+	d.Connection = nil
+	return ctx.Err()
+}
+
 func (d *DXDatabase) Disconnect() (err error) {
 	if d.Connected {
 		log.Log.Infof("Disconnecting to database %s/%s... start", d.NameId, d.NonSensitiveConnectionString)
+		if d.StatementCache != nil {
+			d.StatementCache.Clear()
+			d.StatementCache = nil
+		}
 		err := (*d.Connection).Close()
 		if err != nil {
+			err = d.redactError(err)
 			log.Log.Errorf("Disconnecting to database %s/%s error (%s)", d.NameId, d.NonSensitiveConnectionString, err)
 			return err
 		}
+		db.RemoveSlowQueryThreshold(d.Connection)
+		db.RemoveIdentifierCase(d.Connection)
 		d.Connection = nil
 		d.Connected = false
 		log.Log.Infof("Disconnecting to database %s/%s... done DISCONNECTED", d.NameId, d.NonSensitiveConnectionString)
@@ -310,17 +598,46 @@ func (d *DXDatabase) Disconnect() (err error) {
 }
 
 func (d *DXDatabase) Execute(statement string, parameters utils.JSON) (r any, err error) {
+	return d.ExecuteContext(context.Background(), statement, parameters)
+}
+
+// ExecuteContext is Execute aborted once ctx is done, like the other Context methods, pass the context of the request
+// to have its queries cancelled when the client goes away.
+func (d *DXDatabase) ExecuteContext(ctx context.Context, statement string, parameters utils.JSON) (r any, err error) {
 	err = d.CheckConnectionAndReconnect()
 	if err != nil {
 		return nil, err
 	}
 	isDDL := utilsSql.IsDDL(statement)
 	if !isDDL {
+		parameters = db.PrepareDriverArgs(d.Connection.DriverName(), parameters)
+		if !d.IsPreparedStatements {
+			s, p, err := db.PositionalQuery(d.Connection.DriverName(), statement, parameters)
+			if err != nil {
+				return nil, err
+			}
+			ctx, done := db.StartPositionalQueryWithArgs(ctx, d.Connection, d.Connection.DriverName(), s, p, parameters)
+			r, err = d.Connection.ExecContext(ctx, s, p...)
+			err = done(err)
+			return r, err
+		}
 		query := pq.NewNamedParameterQuery(statement)
 		query.SetValuesFromMap(parameters)
 		s := query.GetParsedQuery()
 		p := query.GetParsedParameters()
-		r, err = d.Connection.Exec(s, p...)
+		ctx, done := db.StartPositionalQueryWithArgs(ctx, d.Connection, d.Connection.DriverName(), s, p, parameters)
+		if d.StatementCache != nil {
+			stmt, release, err := d.StatementCache.Statement(ctx, d.Connection, s)
+			if err != nil {
+				return nil, done(err)
+			}
+			defer release()
+			r, err = stmt.ExecContext(ctx, p...)
+			err = done(err)
+			return r, err
+		}
+		r, err = d.Connection.ExecContext(ctx, s, p...)
+		err = done(err)
 		return r, err
 	}
 	s := statement
@@ -337,10 +654,35 @@ func (d *DXDatabase) Execute(statement string, parameters utils.JSON) (r any, er
 		}
 		s = strings.Replace(s, `:`+k, vs, -1)
 	}
-	r, err = d.Connection.Exec(s)
+	ctx, done := db.StartQuery(ctx, d.Connection, d.Connection.DriverName(), s)
+	r, err = d.Connection.ExecContext(ctx, s)
+	done(err)
 	return r, err
 }
 
+// PreparedStatement gives the prepared statement of query from StatementCache, or a new one when the cache is disabled.
+// release must be called once the statement is not used anymore. It is an ErrPreparedStatementsDisabled when
+// IsPreparedStatements is off.
+func (d *DXDatabase) PreparedStatement(ctx context.Context, query string) (stmt *sqlx.Stmt, release func(), err error) {
+	if !d.IsPreparedStatements {
+		return nil, nil, fmt.Errorf("%w:%s", ErrPreparedStatementsDisabled, d.NameId)
+	}
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return nil, nil, err
+	}
+	if d.StatementCache != nil {
+		return d.StatementCache.Statement(ctx, d.Connection, query)
+	}
+	stmt, err = d.Connection.PreparexContext(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	return stmt, func() {
+		_ = stmt.Close()
+	}, nil
+}
+
 func (d *DXDatabase) PropertyValue(key string) (value string, err error) {
 	err = d.CheckConnectionAndReconnect()
 	if err != nil {
@@ -357,46 +699,215 @@ func (d *DXDatabase) PropertyValue(key string) (value string, err error) {
 }
 
 func (d *DXDatabase) Insert(tableName string, keyValues utils.JSON) (id int64, err error) {
+	return d.InsertContext(context.Background(), tableName, keyValues)
+}
+
+func (d *DXDatabase) InsertContext(ctx context.Context, tableName string, keyValues utils.JSON) (id int64, err error) {
 	err = d.CheckConnectionAndReconnect()
 	if err != nil {
 		return 0, err
 	}
-	return db.Insert(d.Connection, tableName, keyValues)
+	return db.InsertExt(ctx, d.Connection, tableName, keyValues)
+}
+
+// InsertReturningId gives back the generated idFieldName and the rows affected, it fails for drivers that can not return the id.
+func (d *DXDatabase) InsertReturningId(tableName string, keyValues utils.JSON, idFieldName string) (id int64, rowsAffected int64, err error) {
+	return d.InsertReturningIdContext(context.Background(), tableName, keyValues, idFieldName)
+}
+
+func (d *DXDatabase) InsertReturningIdContext(ctx context.Context, tableName string, keyValues utils.JSON, idFieldName string) (id int64, rowsAffected int64, err error) {
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return 0, 0, err
+	}
+	return db.InsertReturningIdExt(ctx, d.Connection, tableName, keyValues, idFieldName)
+}
+
+func (d *DXDatabase) InsertRowsAffected(tableName string, keyValues utils.JSON) (rowsAffected int64, err error) {
+	return d.InsertRowsAffectedContext(context.Background(), tableName, keyValues)
+}
+
+func (d *DXDatabase) InsertRowsAffectedContext(ctx context.Context, tableName string, keyValues utils.JSON) (rowsAffected int64, err error) {
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return 0, err
+	}
+	return db.InsertRowsAffectedExt(ctx, d.Connection, tableName, keyValues)
 }
 
 func (d *DXDatabase) Update(tableName string, setKeyValues utils.JSON, whereKeyValues utils.JSON) (result sql.Result, err error) {
+	return d.UpdateContext(context.Background(), tableName, setKeyValues, whereKeyValues)
+}
+
+func (d *DXDatabase) UpdateContext(ctx context.Context, tableName string, setKeyValues utils.JSON, whereKeyValues utils.JSON) (result sql.Result, err error) {
 	err = d.CheckConnectionAndReconnect()
 	if err != nil {
 		return nil, err
 	}
-	return db.UpdateWhereKeyValues(d.Connection, tableName, setKeyValues, whereKeyValues)
+	return db.UpdateWhereKeyValuesExt(ctx, d.Connection, tableName, setKeyValues, whereKeyValues)
+}
+
+func (d *DXDatabase) DeleteContext(ctx context.Context, tableName string, whereAndFieldNameValues utils.JSON) (result sql.Result, err error) {
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return nil, err
+	}
+	return db.DeleteWhereKeyValuesExt(ctx, d.Connection, tableName, whereAndFieldNameValues)
 }
 
 func (d *DXDatabase) SelectOneMustExist(tableName string, whereAndFieldNameValues utils.JSON, orderbyFieldNameDirections map[string]string) (resultData utils.JSON, err error) {
+	return d.SelectOneMustExistContext(context.Background(), tableName, whereAndFieldNameValues, orderbyFieldNameDirections)
+}
+
+func (d *DXDatabase) SelectOneMustExistContext(ctx context.Context, tableName string, whereAndFieldNameValues utils.JSON, orderbyFieldNameDirections map[string]string) (resultData utils.JSON, err error) {
 	err = d.CheckConnectionAndReconnect()
 	if err != nil {
 		return nil, err
 	}
-	resultData, err = db.SelectOneMustExist(d.Connection, tableName, nil, whereAndFieldNameValues, nil, orderbyFieldNameDirections)
+	resultData, err = db.SelectOneMustExistExt(ctx, d.Connection, tableName, nil, whereAndFieldNameValues, nil, orderbyFieldNameDirections)
 	return resultData, err
 }
 
 func (d *DXDatabase) Select(tableName string, showFieldNames []string, whereAndFieldNameValues utils.JSON, orderbyFieldNameDirections map[string]string,
 	limit any) (resultData []utils.JSON, err error) {
+	return d.SelectContext(context.Background(), tableName, showFieldNames, whereAndFieldNameValues, orderbyFieldNameDirections, limit)
+}
+
+func (d *DXDatabase) SelectContext(ctx context.Context, tableName string, showFieldNames []string, whereAndFieldNameValues utils.JSON,
+	orderbyFieldNameDirections map[string]string, limit any) (resultData []utils.JSON, err error) {
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return nil, err
+	}
+	return db.SelectExt(ctx, d.Connection, tableName, showFieldNames, whereAndFieldNameValues, nil, orderbyFieldNameDirections, limit)
+}
+
+// SelectStructs is db.SelectStructs on the connection of d, generic functions can not be methods.
+func SelectStructs[T any](d *DXDatabase, query string, args utils.JSON) (r []T, err error) {
+	return SelectStructsContext[T](context.Background(), d, query, args)
+}
+
+func SelectStructsContext[T any](ctx context.Context, d *DXDatabase, query string, args utils.JSON) (r []T, err error) {
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return nil, err
+	}
+	return db.SelectStructsExt[T](ctx, d.Connection, query, args, d.Connection.DriverName())
+}
+
+func (d *DXDatabase) QueryStream(ctx context.Context, query string, args utils.JSON, onRow db.QueryStreamRowFunc) (err error) {
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return err
+	}
+	return db.QueryStream(ctx, d.Connection, d.Connection.DriverName(), query, args, onRow)
+}
+
+func (dtx *DXDatabaseTx) QueryStream(ctx context.Context, query string, args utils.JSON, onRow db.QueryStreamRowFunc) (err error) {
+	return db.QueryStream(ctx, dtx.Tx, dtx.Tx.DriverName(), query, args, onRow)
+}
+
+// ExportCSV streams the rows of the query to w as CSV, see db.ExportCSV.
+func (d *DXDatabase) ExportCSV(ctx context.Context, w io.Writer, query string, args utils.JSON, o db.CSVOptions) (rowCount int64, err error) {
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return 0, err
+	}
+	return db.ExportCSV(ctx, d.Connection, d.Connection.DriverName(), d.IdentifierCase, query, args, w, o)
+}
+
+func (dtx *DXDatabaseTx) ExportCSV(ctx context.Context, w io.Writer, query string, args utils.JSON, o db.CSVOptions) (rowCount int64, err error) {
+	return db.ExportCSV(ctx, dtx.Tx, dtx.Tx.DriverName(), db.IdentifierCaseOf(dtx.Tx), query, args, w, o)
+}
+
+func (d *DXDatabase) DescribeTable(tableName string) (r []db.DXColumnInfo, err error) {
 	err = d.CheckConnectionAndReconnect()
 	if err != nil {
 		return nil, err
 	}
-	return db.Select(d.Connection, tableName, showFieldNames, whereAndFieldNameValues, nil, orderbyFieldNameDirections, limit)
+	return db.DescribeTable(d.Connection, tableName, d.Connection.DriverName())
+}
+
+func (d *DXDatabase) PrimaryKeyColumns(tableName string) (r []string, err error) {
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return nil, err
+	}
+	return db.PrimaryKeyColumns(d.Connection, tableName, d.Connection.DriverName())
+}
+
+// BulkUpsert upserts rows in batches of db.DefaultBulkUpsertBatchSize, all in one transaction, on conflictFieldNames or,
+// when nil, on the primary key of tableName. See db.BulkUpsertExt.
+func (d *DXDatabase) BulkUpsert(l *log.DXLog, tableName string, rows []utils.JSON, conflictFieldNames []string) (rowsAffected int64, err error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	if len(conflictFieldNames) == 0 {
+		conflictFieldNames, err = d.PrimaryKeyColumns(tableName)
+		if err != nil {
+			return 0, err
+		}
+	}
+	err = d.Tx(l, LevelDefault, func(l *log.DXLog, dtx *DXDatabaseTx) (err error) {
+		rowsAffected, err = dtx.BulkUpsert(l.Context, tableName, rows, conflictFieldNames)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return rowsAffected, nil
+}
+
+func (dtx *DXDatabaseTx) BulkUpsert(ctx context.Context, tableName string, rows []utils.JSON, conflictFieldNames []string) (rowsAffected int64, err error) {
+	return db.BulkUpsertExt(ctx, dtx.Tx, tableName, rows, conflictFieldNames, db.DefaultBulkUpsertBatchSize)
+}
+
+// CopyFrom loads the rows received from rows into tableName in one transaction, by the COPY of pgx on postgres, see
+// db.CopyFromPostgres, or else in batches, see db.CopyFromExt. It gives how many rows were loaded.
+func (d *DXDatabase) CopyFrom(ctx context.Context, tableName string, columns []string, rows <-chan []any) (rowCount int64, err error) {
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return 0, err
+	}
+	if db.DriverCapabilities(d.Connection.DriverName()).SupportsCopy {
+		dsn, err := d.GetConnectionString()
+		if err != nil {
+			return 0, err
+		}
+		return db.CopyFromPostgres(ctx, dsn, tableName, columns, rows)
+	}
+	return db.CopyFromExt(ctx, d.Connection, tableName, columns, rows)
+}
+
+// CopyFrom loads the rows in the transaction in batches, COPY needs a connection of its own, see DXDatabase.CopyFrom.
+func (dtx *DXDatabaseTx) CopyFrom(ctx context.Context, tableName string, columns []string, rows <-chan []any) (rowCount int64, err error) {
+	return db.CopyFromExt(ctx, dtx.Tx, tableName, columns, rows)
+}
+
+func (d *DXDatabase) Paginate(query string, args utils.JSON, page int64, pageSize int64) (r *DXDatabasePaginateResult, err error) {
+	return d.PaginateContext(context.Background(), query, args, page, pageSize)
+}
+
+func (d *DXDatabase) PaginateContext(ctx context.Context, query string, args utils.JSON, page int64, pageSize int64) (r *DXDatabasePaginateResult, err error) {
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return nil, err
+	}
+	return db.PaginateExt(ctx, d.Connection, query, args, page, pageSize)
 }
 
 func (d *DXDatabase) SelectOne(tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
+	orderbyFieldNameDirections map[string]string) (r utils.JSON, err error) {
+	return d.SelectOneContext(context.Background(), tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections)
+}
+
+func (d *DXDatabase) SelectOneContext(ctx context.Context, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
 	orderbyFieldNameDirections map[string]string) (r utils.JSON, err error) {
 	err = d.CheckConnectionAndReconnect()
 	if err != nil {
 		return nil, err
 	}
-	return db.SelectOne(d.Connection, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections)
+	return db.SelectOneExt(ctx, d.Connection, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections)
 }
 
 func (d *DXDatabase) ExecuteFile(filename string) (r sql.Result, err error) {
@@ -437,20 +948,34 @@ func (d *DXDatabase) ExecuteCreateScripts() (rs []sql.Result, err error) {
 	return rs, nil
 }
 
+func (d *DXDatabase) beginTx(log *log.DXLog, isolationLevel sql.IsolationLevel) (dtx *DXDatabaseTx, err error) {
+	tx, err := d.Connection.BeginTxx(log.Context, &sql.TxOptions{
+		Isolation: isolationLevel,
+		ReadOnly:  false,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &DXDatabaseTx{Tx: tx}, nil
+}
+
 func (d *DXDatabase) Tx(log *log.DXLog, isolationLevel sql.IsolationLevel, callback DXDatabaseTxCallback) (err error) {
 	err = d.CheckConnectionAndReconnect()
 	if err != nil {
 		return err
 	}
-	tx, err := d.Connection.BeginTxx(log.Context, &sql.TxOptions{
-		Isolation: isolationLevel,
-		ReadOnly:  false,
-	})
+	dtx, err := d.beginTx(log, isolationLevel)
 	if err != nil {
 		log.Error(err.Error())
 		return err
 	}
-	dtx := &DXDatabaseTx{Tx: tx}
+	return d.runTx(log, dtx, callback)
+}
+
+// runTx commits dtx when callback succeeds, otherwise rolls it back.
+func (d *DXDatabase) runTx(log *log.DXLog, dtx *DXDatabaseTx, callback DXDatabaseTxCallback) (err error) {
+	tx := dtx.Tx
+	defer db.TrackTx(tx, d.Connection)()
 	err = callback(log, dtx)
 	if err != nil {
 		log.Errorf(`ErrorInCallback: (%v)`, err.Error())
@@ -473,6 +998,22 @@ func (d *DXDatabase) Tx(log *log.DXLog, isolationLevel sql.IsolationLevel, callb
 	return nil
 }
 
+type txContextKey struct{}
+
+// ContextWithTx makes dtx the transaction of the work done with ctx, like the one of a request opened by the
+// api.Transaction middleware.
+func ContextWithTx(ctx context.Context, dtx *DXDatabaseTx) context.Context {
+	return context.WithValue(ctx, txContextKey{}, dtx)
+}
+
+func TxFromContext(ctx context.Context) (dtx *DXDatabaseTx, ok bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	dtx, ok = ctx.Value(txContextKey{}).(*DXDatabaseTx)
+	return dtx, ok && dtx != nil
+}
+
 func (dtx *DXDatabaseTx) SelectOne(log *log.DXLog, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
 	orderbyFieldNameDirections map[string]string, forUpdatePart any) (r utils.JSON, err error) {
 	return dbtx.TxSelectOne(log, false, dtx.Tx, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, forUpdatePart)
@@ -486,6 +1027,27 @@ func (dtx *DXDatabaseTx) Insert(log *log.DXLog, tableName string, keyValues util
 	return dbtx.TxInsert(log, false, dtx.Tx, tableName, keyValues)
 }
 
+func (dtx *DXDatabaseTx) InsertReturningId(log *log.DXLog, tableName string, keyValues utils.JSON, idFieldName string) (id int64, rowsAffected int64, err error) {
+	return dbtx.TxInsertReturningId(log, false, dtx.Tx, tableName, keyValues, idFieldName)
+}
+
+func (dtx *DXDatabaseTx) InsertRowsAffected(log *log.DXLog, tableName string, keyValues utils.JSON) (rowsAffected int64, err error) {
+	return dbtx.TxInsertRowsAffected(log, false, dtx.Tx, tableName, keyValues)
+}
+
+func (dtx *DXDatabaseTx) Select(log *log.DXLog, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
+	orderbyFieldNameDirections map[string]string, forUpdatePart any) (r []utils.JSON, err error) {
+	return dbtx.TxSelectWhereKeyValuesRows(log, false, dtx.Tx, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, forUpdatePart)
+}
+
+func (dtx *DXDatabaseTx) Update(log *log.DXLog, tableName string, setKeyValues utils.JSON, whereKeyValues utils.JSON) (result sql.Result, err error) {
+	return dbtx.TxUpdateWhereKeyValues(log, false, dtx.Tx, tableName, setKeyValues, whereKeyValues)
+}
+
+func (dtx *DXDatabaseTx) Delete(log *log.DXLog, tableName string, whereAndFieldNameValues utils.JSON) (result sql.Result, err error) {
+	return dbtx.TxDeleteWhereKeyValues(log, false, dtx.Tx, tableName, whereAndFieldNameValues)
+}
+
 func (dtx *DXDatabaseTx) UpdateOne(log *log.DXLog, tableName string, setKeyValues utils.JSON, whereKeyValues utils.JSON) (result utils.JSON, err error) {
 	return dbtx.TxUpdateOne(log, false, dtx.Tx, tableName, setKeyValues, whereKeyValues)
 }
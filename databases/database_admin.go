@@ -0,0 +1,147 @@
+package databases
+
+import (
+	"regexp"
+
+	"dxlib/v3/databases/database_type"
+	"dxlib/v3/databases/protected/db"
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+)
+
+var databaseNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// DXDatabaseDropPlan is what DropDatabase would do, Statements are executed in order exactly as listed.
+type DXDatabaseDropPlan struct {
+	DatabaseName          string
+	Statements            []string
+	TerminatedConnections []utils.JSON
+}
+
+func (d *DXDatabase) checkDatabaseName(dbName string) (err error) {
+	if !databaseNamePattern.MatchString(dbName) {
+		err = log.Log.ErrorAndCreateErrorf("Invalid database name '%s', only letters, digits and underscore are allowed", dbName)
+		return err
+	}
+	return nil
+}
+
+func (d *DXDatabase) PlanCreateDatabase(dbName string) (statements []string, err error) {
+	err = d.checkDatabaseName(dbName)
+	if err != nil {
+		return nil, err
+	}
+	switch d.DatabaseType {
+	case database_type.PostgreSQL:
+		statements = []string{`CREATE DATABASE "` + dbName + `"`}
+	case database_type.SQLServer:
+		statements = []string{`CREATE DATABASE [` + dbName + `]`}
+	case database_type.MySQL:
+		statements = []string{"CREATE DATABASE `" + dbName + "`"}
+	default:
+		err = log.Log.ErrorAndCreateErrorf("CreateDatabase is not supported for database type %s of database %s", d.DatabaseType.String(), d.NameId)
+		return nil, err
+	}
+	return statements, nil
+}
+
+// CreateDatabase creates dbName using this database as the management connection, with dryRun it only returns the statements.
+func (d *DXDatabase) CreateDatabase(dbName string, dryRun bool) (statements []string, err error) {
+	statements, err = d.PlanCreateDatabase(dbName)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		log.Log.Infof("Dry run create database %s on %s: %v", dbName, d.NonSensitiveConnectionString, statements)
+		return statements, nil
+	}
+	err = d.executeStatements(statements)
+	if err != nil {
+		return statements, err
+	}
+	return statements, nil
+}
+
+// PlanDropDatabase returns the statements and the connections that DropDatabase would terminate, nothing is executed.
+func (d *DXDatabase) PlanDropDatabase(dbName string) (plan *DXDatabaseDropPlan, err error) {
+	err = d.checkDatabaseName(dbName)
+	if err != nil {
+		return nil, err
+	}
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return nil, err
+	}
+	plan = &DXDatabaseDropPlan{
+		DatabaseName: dbName,
+	}
+	switch d.DatabaseType {
+	case database_type.PostgreSQL:
+		plan.TerminatedConnections, err = db.NamedQueryRows(d.Connection, `SELECT pid, usename, application_name, client_addr, state FROM pg_stat_activity WHERE datname = :datname AND pid <> pg_backend_pid()`, utils.JSON{
+			`datname`: dbName,
+		})
+		if err != nil {
+			return nil, err
+		}
+		plan.Statements = []string{
+			`SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = '` + dbName + `' AND pid <> pg_backend_pid()`,
+			`DROP DATABASE "` + dbName + `"`,
+		}
+	case database_type.SQLServer:
+		plan.TerminatedConnections, err = db.NamedQueryRows(d.Connection, `SELECT session_id, login_name, program_name, host_name, status FROM sys.dm_exec_sessions WHERE database_id = DB_ID(:datname) AND session_id <> @@SPID`, utils.JSON{
+			`datname`: dbName,
+		})
+		if err != nil {
+			return nil, err
+		}
+		plan.Statements = []string{
+			`ALTER DATABASE [` + dbName + `] SET SINGLE_USER WITH ROLLBACK IMMEDIATE`,
+			`DROP DATABASE [` + dbName + `]`,
+		}
+	case database_type.MySQL:
+		plan.TerminatedConnections = []utils.JSON{}
+		plan.Statements = []string{"DROP DATABASE `" + dbName + "`"}
+	default:
+		err = log.Log.ErrorAndCreateErrorf("DropDatabase is not supported for database type %s of database %s", d.DatabaseType.String(), d.NameId)
+		return nil, err
+	}
+	return plan, nil
+}
+
+// DropDatabase drops dbName, confirmDbName must repeat dbName as a guard against a wrong name. With dryRun only the plan is returned.
+func (d *DXDatabase) DropDatabase(dbName string, confirmDbName string, dryRun bool) (plan *DXDatabaseDropPlan, err error) {
+	plan, err = d.PlanDropDatabase(dbName)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		log.Log.Infof("Dry run drop database %s on %s: %v, %d connection(s) would be terminated", dbName, d.NonSensitiveConnectionString, plan.Statements, len(plan.TerminatedConnections))
+		return plan, nil
+	}
+	if confirmDbName != dbName {
+		err = log.Log.ErrorAndCreateErrorf("Drop database %s is refused, the confirmation name '%s' does not match", dbName, confirmDbName)
+		return plan, err
+	}
+	log.Log.Warnf("!!! DROPPING DATABASE %s on %s, terminating %d connection(s) !!!", dbName, d.NonSensitiveConnectionString, len(plan.TerminatedConnections))
+	err = d.executeStatements(plan.Statements)
+	if err != nil {
+		return plan, err
+	}
+	log.Log.Warnf("!!! DATABASE %s on %s DROPPED !!!", dbName, d.NonSensitiveConnectionString)
+	return plan, nil
+}
+
+func (d *DXDatabase) executeStatements(statements []string) (err error) {
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return err
+	}
+	for _, s := range statements {
+		_, err = d.Connection.Exec(s)
+		if err != nil {
+			log.Log.Errorf("Error executing %s on database %s (%v)", s, d.NameId, err)
+			return err
+		}
+	}
+	return nil
+}
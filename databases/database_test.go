@@ -0,0 +1,135 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/databases/database_type"
+	"dxlib/v3/databases/protected/db"
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+)
+
+func TestPreparedStatementsOffBindsWithoutPrepare(t *testing.T) {
+	d := &DXDatabase{NameId: `test`, DatabaseType: database_type.PostgreSQL, Address: `db:5432`, DatabaseName: `app`,
+		UserName: `u`, UserPassword: `p`}
+	dsn, err := d.GetConnectionString()
+	require.NoError(t, err)
+	u, err := url.Parse(dsn)
+	require.NoError(t, err)
+	assert.Equal(t, `yes`, u.Query().Get(`binary_parameters`))
+
+	d.IsPreparedStatements = true
+	dsn, err = d.GetConnectionString()
+	require.NoError(t, err)
+	u, err = url.Parse(dsn)
+	require.NoError(t, err)
+	assert.False(t, u.Query().Has(`binary_parameters`))
+}
+
+func TestExecuteWithPreparedStatementsOff(t *testing.T) {
+	d := newTestDatabase(t, newTestDatabaseManager(), `test`)
+	d.IsPreparedStatements = false
+
+	_, err := d.Execute(`INSERT INTO t (name) VALUES (:name), (:name), (:other)`, utils.JSON{`name`: `a`, `other`: `b`})
+	require.NoError(t, err)
+	var names []string
+	require.NoError(t, d.Connection.Select(&names, `SELECT name FROM t ORDER BY rowid`))
+	assert.Equal(t, []string{`a`, `a`, `b`}, names)
+
+	_, _, err = d.PreparedStatement(context.Background(), `SELECT name FROM t`)
+	assert.ErrorIs(t, err, ErrPreparedStatementsDisabled)
+}
+
+func TestConnectionErrorsHideThePassword(t *testing.T) {
+	d := &DXDatabase{NameId: `test`, DatabaseType: database_type.PostgreSQL, Address: `db:5432`, DatabaseName: `app`,
+		UserName: `app`, UserPassword: `p@ss:w/rd`}
+	dsn, err := d.GetConnectionString()
+	require.NoError(t, err)
+	errRefused := errors.New(`connection refused`)
+
+	for _, message := range []string{
+		`dial ` + dsn,
+		`password authentication failed for "p@ss:w/rd"`,
+		`parse "postgres://app:` + url.QueryEscape(`p@ss:w/rd`) + `@db": invalid`,
+	} {
+		err = d.redactError(fmt.Errorf(`%s: %w`, message, errRefused))
+		assert.NotContains(t, err.Error(), `p@ss`)
+		assert.NotContains(t, err.Error(), url.QueryEscape(`p@ss:w/rd`))
+		assert.Contains(t, err.Error(), `***`)
+		assert.ErrorIs(t, err, errRefused)
+	}
+	assert.NoError(t, d.redactError(nil))
+}
+
+// newTestUpsertRows gives the rows of the ids 1 to n, named name and their id.
+func newTestUpsertRows(n int, name string) (rows []utils.JSON) {
+	for i := 1; i <= n; i++ {
+		rows = append(rows, utils.JSON{`id`: i, `name`: fmt.Sprintf(`%s %d`, name, i), `is_active`: i%2 == 0})
+	}
+	return rows
+}
+
+func TestBulkUpsertRollsTheBatchesBackTogether(t *testing.T) {
+	d := newTestDatabase(t, newTestDatabaseManager(), `upsert`)
+	// sqlite speaks the ON CONFLICT of postgres
+	d.Connection = sqlx.NewDb(d.Connection.DB, `postgres`)
+	_, err := d.Connection.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL, is_active BOOLEAN NOT NULL)`)
+	require.NoError(t, err)
+	l := log.NewLog(nil, context.Background(), `test`)
+
+	rowsAffected, err := d.BulkUpsert(&l, `users`, newTestUpsertRows(3, `first`), []string{`id`})
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, rowsAffected)
+
+	// the last row fails in the second batch, the first batch is rolled back with it
+	rows := newTestUpsertRows(db.DefaultBulkUpsertBatchSize+10, `second`)
+	rows[len(rows)-1][`name`] = nil
+	_, err = d.BulkUpsert(&l, `users`, rows, []string{`id`})
+	assert.ErrorContains(t, err, `NOT NULL`)
+	var names []string
+	require.NoError(t, d.Connection.Select(&names, `SELECT name FROM users ORDER BY id`))
+	assert.Equal(t, []string{`first 1`, `first 2`, `first 3`}, names)
+
+	rowsAffected, err = d.BulkUpsert(&l, `users`, nil, nil)
+	require.NoError(t, err)
+	assert.Zero(t, rowsAffected)
+}
+
+func TestBulkUpsertOnThePrimaryKeyOfPostgres(t *testing.T) {
+	d := newTestPostgresDatabase(t, newTestDatabaseManager(), `upsert`)
+	for _, s := range []string{`DROP TABLE IF EXISTS bulk_upsert_users`,
+		`CREATE TABLE bulk_upsert_users (id BIGINT PRIMARY KEY, name TEXT NOT NULL, is_active BOOLEAN NOT NULL)`} {
+		_, err := d.Connection.Exec(s)
+		require.NoError(t, err)
+	}
+	t.Cleanup(func() {
+		_, _ = d.Connection.Exec(`DROP TABLE IF EXISTS bulk_upsert_users`)
+	})
+	l := log.NewLog(nil, context.Background(), `test`)
+
+	// without conflicts
+	rowsAffected, err := d.BulkUpsert(&l, `bulk_upsert_users`, newTestUpsertRows(3, `first`), nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, rowsAffected)
+	// the row 3 conflicts on the inferred primary key, the row 4 is new
+	rows := newTestUpsertRows(4, `second`)[2:]
+	rowsAffected, err = d.BulkUpsert(&l, `bulk_upsert_users`, rows, nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, rowsAffected)
+
+	var names []string
+	require.NoError(t, d.Connection.Select(&names, `SELECT name FROM bulk_upsert_users ORDER BY id`))
+	assert.Equal(t, []string{`first 1`, `first 2`, `second 3`, `second 4`}, names)
+	var isActive bool
+	require.NoError(t, d.Connection.Get(&isActive, `SELECT is_active FROM bulk_upsert_users WHERE id = 4`))
+	assert.True(t, isActive)
+}
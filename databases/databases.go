@@ -1,6 +1,10 @@
 package databases
 
 import (
+	"context"
+	"database/sql"
+	"time"
+
 	"dxlib/v3/configurations"
 	"dxlib/v3/databases/protected/db"
 	"dxlib/v3/log"
@@ -9,18 +13,31 @@ import (
 
 type DXDatabaseSQLExpression = db.SQLExpression
 
+type DXDatabasePaginateResult = db.PaginateResult
+
+// ErrStopQueryStream ends a QueryStream early without an error when returned by the row callback.
+var ErrStopQueryStream = db.ErrStopQueryStream
+
 type DXDatabaseManager struct {
 	Databases map[string]*DXDatabase
 	Scripts   map[string]*DXDatabaseScript
+	// TenantResolver gives the databases of the tenants not registered by RegisterTenant, see WriteDBForTenant
+	TenantResolver DXDatabaseTenantResolver
+	TenantCacheTTL time.Duration
+	tenants        dxDatabaseTenants
 }
 
 func (dm *DXDatabaseManager) NewDatabase(nameId string, isConnectAtStart, mustBeConnected bool) *DXDatabase {
 	d := DXDatabase{
 		NameId:           nameId,
+		Role:             DXDatabaseRolePrimary,
 		IsConfigured:     false,
 		IsConnectAtStart: isConnectAtStart,
 		MustConnected:    mustBeConnected,
 		Connected:        false,
+		// prepared statements stay the default, it is only turned off for poolers like PgBouncer in transaction mode
+		IsPreparedStatements: true,
+		SlowQueryThreshold:   db.DefaultSlowQueryThreshold,
 		// CreateDatabaseScript: createDatabaseScript,
 	}
 	dm.Databases[nameId] = &d
@@ -28,10 +45,16 @@ func (dm *DXDatabaseManager) NewDatabase(nameId string, isConnectAtStart, mustBe
 }
 
 func (dm *DXDatabaseManager) LoadFromConfiguration(configurationNameId string) (err error) {
-	configuration := configurations.Manager.Configurations[configurationNameId]
+	configuration, err := configurations.Manager.Lookup(configurationNameId)
+	if err != nil {
+		return err
+	}
 	isConnectAtStart := false
 	mustConnected := false
 	for k, v := range *configuration.Data {
+		if k == `enabled` {
+			continue
+		}
 		d, ok := v.(utils.JSON)
 		if !ok {
 			err := log.Log.ErrorAndCreateErrorf("Cannot read %s as JSON", k)
@@ -54,17 +77,23 @@ func (dm *DXDatabaseManager) LoadFromConfiguration(configurationNameId string) (
 	return nil
 }
 
-func (dm *DXDatabaseManager) ConnectAllAtStart(configurationNameId string) (err error) {
+// ConnectAllAtStart connects the databases IsConnectAtStart, it gives up with the error of ctx once ctx is done, also
+// between the connections, so a shutdown during the start does not wait for all of them.
+func (dm *DXDatabaseManager) ConnectAllAtStart(ctx context.Context, configurationNameId string) (err error) {
 	if len(dm.Databases) > 0 {
 		log.Log.Info("Connecting to Database Manager... start")
 		for _, v := range dm.Databases {
+			if ctx.Err() != nil {
+				log.Log.Warnf("Connecting to Database Manager... aborted (%v)", ctx.Err())
+				return ctx.Err()
+			}
 			err := v.ApplyFromConfiguration(configurationNameId)
 			if err != nil {
 				err = log.Log.ErrorAndCreateErrorf("Cannot configure to database %s to connect", v.NameId)
 				return err
 			}
 			if v.IsConnectAtStart {
-				err = v.Connect()
+				err = v.ConnectContext(ctx)
 				if err != nil {
 					return err
 				}
@@ -100,11 +129,29 @@ func (dm *DXDatabaseManager) DisconnectAll() (err error) {
 	return err
 }
 
+// Stats gives the connection pool statistics of every connected database by name id.
+func (dm *DXDatabaseManager) Stats() (r map[string]sql.DBStats) {
+	r = map[string]sql.DBStats{}
+	for k, v := range dm.Databases {
+		if v.Connection == nil {
+			continue
+		}
+		r[k] = v.Connection.Stats()
+	}
+	return r
+}
+
+// AllStats is Stats, keyed by the connection name of each database for the dashboards telling the pools apart.
+func (dm *DXDatabaseManager) AllStats() (r map[string]sql.DBStats) {
+	return dm.Stats()
+}
+
 var Manager DXDatabaseManager
 
 func init() {
 	Manager = DXDatabaseManager{
-		Databases: map[string]*DXDatabase{},
-		Scripts:   map[string]*DXDatabaseScript{},
+		Databases:      map[string]*DXDatabase{},
+		Scripts:        map[string]*DXDatabaseScript{},
+		TenantCacheTTL: DXDatabaseTenantDefaultCacheTTL,
 	}
 }
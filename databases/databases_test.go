@@ -0,0 +1,105 @@
+package databases
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/databases/database_type"
+	"dxlib/v3/metrics"
+)
+
+func TestAllStatsReportsEachConnection(t *testing.T) {
+	dm := newTestDatabaseManager()
+	primary := newTestDatabase(t, dm, `storage`)
+	replica := newTestDatabase(t, dm, `storage_replica`)
+	replica.Role = DXDatabaseRoleReplica
+	dm.NewDatabase(`not_connected`, false, false)
+	conn, err := primary.Connection.Conn(context.Background())
+	require.NoError(t, err)
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	stats := dm.AllStats()
+	assert.Len(t, stats, 2)
+	assert.Equal(t, 1, stats[`storage`].InUse)
+	assert.Equal(t, 0, stats[`storage_replica`].InUse)
+
+	mm := metrics.DXMetricsManager{Registry: prometheus.NewRegistry()}
+	require.NoError(t, mm.RegisterDBStats(func() map[string]metrics.DXMetricsDBStats {
+		r := map[string]metrics.DXMetricsDBStats{}
+		for k, v := range dm.AllStats() {
+			r[k] = metrics.DXMetricsDBStats{Role: dm.Databases[k].Role, Stats: v}
+		}
+		return r
+	}))
+	families, err := mm.Registry.Gather()
+	require.NoError(t, err)
+	inUse := map[string]float64{}
+	for _, f := range families {
+		if f.GetName() != `dxlib_db_in_use_connections` {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			inUse[labels[`database`]+`/`+labels[`role`]] = m.GetGauge().GetValue()
+		}
+	}
+	assert.Equal(t, map[string]float64{`storage/primary`: 1, `storage_replica/replica`: 0}, inUse)
+}
+
+// silentTestServer gives the address of a server accepting the connections and never answering, closed at the end of
+// the test.
+func silentTestServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen(`tcp`, `127.0.0.1:0`)
+	require.NoError(t, err)
+	conns := make(chan net.Conn, 16)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- c
+		}
+	}()
+	t.Cleanup(func() {
+		_ = ln.Close()
+		close(conns)
+		for c := range conns {
+			_ = c.Close()
+		}
+	})
+	return ln.Addr().String()
+}
+
+func TestConnectAllAtStartReturnsPromptlyOnCancel(t *testing.T) {
+	dm := newTestDatabaseManager()
+	d := dm.NewDatabase(`slow`, true, false)
+	d.IsConfigured = true
+	d.DatabaseType = database_type.PostgreSQL
+	d.ConnectionString = `postgres://app:p@` + silentTestServer(t) + `/app?sslmode=disable&connect_timeout=60`
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	startTime := time.Now()
+	err := dm.ConnectAllAtStart(ctx, `storage`)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(startTime), 5*time.Second)
+	assert.False(t, d.Connected)
+	assert.Nil(t, d.Connection)
+
+	// a context done before is not connected at all
+	err = dm.ConnectAllAtStart(ctx, `storage`)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,96 @@
+package databases
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+
+	"dxlib/v3/log"
+)
+
+type DXDatabaseConnectionConfig struct {
+	Host         string
+	Port         string
+	UserName     string
+	UserPassword string
+	DatabaseName string
+	// Options are the driver specific parameters, e.g. sslmode for postgres or serviceName for oracle
+	Options map[string]string
+}
+
+func (c DXDatabaseConnectionConfig) address() string {
+	if c.Port == `` {
+		return c.Host
+	}
+	return net.JoinHostPort(c.Host, c.Port)
+}
+
+func (c DXDatabaseConnectionConfig) query(excludedKeys ...string) string {
+	v := url.Values{}
+	for k, o := range c.Options {
+		v.Set(k, o)
+	}
+	for _, k := range excludedKeys {
+		v.Del(k)
+	}
+	return v.Encode()
+}
+
+// BuildDSN assembles the DSN of driverName from cfg, the credentials are escaped so special characters in them are kept as is.
+func BuildDSN(driverName string, cfg DXDatabaseConnectionConfig) (s string, err error) {
+	switch driverName {
+	case "postgres", "postgresql":
+		u := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(cfg.UserName, cfg.UserPassword),
+			Host:     cfg.address(),
+			Path:     "/" + cfg.DatabaseName,
+			RawQuery: cfg.query(),
+		}
+		return u.String(), nil
+	case "sqlserver":
+		u := url.URL{
+			Scheme: "sqlserver",
+			User:   url.UserPassword(cfg.UserName, cfg.UserPassword),
+			Host:   cfg.address(),
+		}
+		v, _ := url.ParseQuery(cfg.query())
+		v.Set("database", cfg.DatabaseName)
+		u.RawQuery = v.Encode()
+		return u.String(), nil
+	case "mysql", "mariadb":
+		if strings.Contains(cfg.UserName, `:`) {
+			// the DSN has no escaping, the user name ends at its first colon
+			err = log.Log.ErrorAndCreateErrorf("BuildDSN: user name of driver %s can not contain a colon", driverName)
+			return ``, err
+		}
+		c := mysql.NewConfig()
+		c.User = cfg.UserName
+		c.Passwd = cfg.UserPassword
+		c.Net = "tcp"
+		c.Addr = cfg.address()
+		c.DBName = cfg.DatabaseName
+		if len(cfg.Options) > 0 {
+			c.Params = cfg.Options
+		}
+		return c.FormatDSN(), nil
+	case "oracle":
+		serviceName := cfg.Options["serviceName"]
+		if serviceName == `` {
+			serviceName = cfg.DatabaseName
+		}
+		u := url.URL{
+			Scheme:   "oracle",
+			User:     url.UserPassword(cfg.UserName, cfg.UserPassword),
+			Host:     cfg.address(),
+			Path:     "/" + serviceName,
+			RawQuery: cfg.query("serviceName"),
+		}
+		return u.String(), nil
+	default:
+		err = log.Log.ErrorAndCreateErrorf("BuildDSN: unknown database driver %s", driverName)
+		return ``, err
+	}
+}
@@ -0,0 +1,90 @@
+package databases
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/microsoft/go-mssqldb/msdsn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDSNPassword has the characters separating the parts of a DSN
+const testDSNPassword = `p@ss:w/rd?#%`
+
+func testConnectionConfig(options map[string]string) DXDatabaseConnectionConfig {
+	return DXDatabaseConnectionConfig{Host: `db.local`, Port: `5000`, UserName: `us:er`, UserPassword: testDSNPassword,
+		DatabaseName: `app`, Options: options}
+}
+
+func TestBuildDSNPostgres(t *testing.T) {
+	dsn, err := BuildDSN(`postgres`, testConnectionConfig(map[string]string{`sslmode`: `disable`}))
+	require.NoError(t, err)
+	c, err := pgconn.ParseConfig(dsn)
+	require.NoError(t, err)
+	assert.Equal(t, `db.local`, c.Host)
+	assert.Equal(t, uint16(5000), c.Port)
+	assert.Equal(t, `us:er`, c.User)
+	assert.Equal(t, testDSNPassword, c.Password)
+	assert.Equal(t, `app`, c.Database)
+	assert.Nil(t, c.TLSConfig)
+}
+
+func TestBuildDSNMySQL(t *testing.T) {
+	cfg := testConnectionConfig(map[string]string{`charset`: `utf8mb4`})
+	_, err := BuildDSN(`mysql`, cfg)
+	assert.ErrorContains(t, err, `can not contain a colon`)
+
+	cfg.UserName = `us@er`
+	dsn, err := BuildDSN(`mysql`, cfg)
+	require.NoError(t, err)
+	c, err := mysql.ParseDSN(dsn)
+	require.NoError(t, err)
+	assert.Equal(t, `tcp`, c.Net)
+	assert.Equal(t, `db.local:5000`, c.Addr)
+	assert.Equal(t, `us@er`, c.User)
+	assert.Equal(t, testDSNPassword, c.Passwd)
+	assert.Equal(t, `app`, c.DBName)
+	assert.Equal(t, `utf8mb4`, c.Params[`charset`])
+}
+
+func TestBuildDSNSQLServer(t *testing.T) {
+	dsn, err := BuildDSN(`sqlserver`, testConnectionConfig(map[string]string{`encrypt`: `disable`}))
+	require.NoError(t, err)
+	c, err := msdsn.Parse(dsn)
+	require.NoError(t, err)
+	assert.Equal(t, `db.local`, c.Host)
+	assert.Equal(t, uint64(5000), c.Port)
+	assert.Equal(t, `us:er`, c.User)
+	assert.Equal(t, testDSNPassword, c.Password)
+	assert.Equal(t, `app`, c.Database)
+	assert.Equal(t, msdsn.Encryption(msdsn.EncryptionDisabled), c.Encryption)
+}
+
+func TestBuildDSNOracle(t *testing.T) {
+	// no oracle driver is a dependency, its URL form is checked as a URL
+	dsn, err := BuildDSN(`oracle`, testConnectionConfig(map[string]string{`serviceName`: `ORCLPDB1`, `SSL`: `enable`}))
+	require.NoError(t, err)
+	u, err := url.Parse(dsn)
+	require.NoError(t, err)
+	assert.Equal(t, `oracle`, u.Scheme)
+	assert.Equal(t, `db.local:5000`, u.Host)
+	assert.Equal(t, `us:er`, u.User.Username())
+	password, _ := u.User.Password()
+	assert.Equal(t, testDSNPassword, password)
+	assert.Equal(t, `/ORCLPDB1`, u.Path)
+	assert.Equal(t, url.Values{`SSL`: {`enable`}}, u.Query())
+
+	dsn, err = BuildDSN(`oracle`, testConnectionConfig(nil))
+	require.NoError(t, err)
+	u, err = url.Parse(dsn)
+	require.NoError(t, err)
+	assert.Equal(t, `/app`, u.Path)
+}
+
+func TestBuildDSNUnknownDriver(t *testing.T) {
+	_, err := BuildDSN(`sqlite`, testConnectionConfig(nil))
+	assert.ErrorContains(t, err, `unknown database driver sqlite`)
+}
@@ -0,0 +1,418 @@
+package databases
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dxlib/v3/databases/database_type"
+	"dxlib/v3/databases/protected/db"
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+)
+
+const (
+	// DXDatabaseMigrationsTableName records the applied migrations, each with the script reverting it
+	DXDatabaseMigrationsTableName = `schema_migrations`
+	// DXDatabaseMigrationsAdvisoryLockKey is the advisory lock postgres applies and reverts the migrations under
+	DXDatabaseMigrationsAdvisoryLockKey int64 = 0x736368656d61
+)
+
+var (
+	ErrMigrationIrreversible = errors.New("MigrationIrreversible")
+	// ErrMigrationStatementNotSplittable is the error of a migration of mysql with a routine having a BEGIN body,
+	// which needs the DELIMITER of the mysql client to be split
+	ErrMigrationStatementNotSplittable = errors.New("MigrationStatementNotSplittable")
+)
+
+var (
+	migrationRoutineRegexp = regexp.MustCompile(`(?is)^CREATE\s+(OR\s+REPLACE\s+)?(DEFINER\s*=\s*\S+\s+)?((NON)?EDITIONABLE\s+)?(PROCEDURE|FUNCTION|TRIGGER|EVENT|PACKAGE|TYPE\s+BODY)\b`)
+	migrationBlockRegexp   = regexp.MustCompile(`(?is)^(BEGIN|DECLARE)\b`)
+	migrationBeginRegexp   = regexp.MustCompile(`(?i)\bBEGIN\b`)
+)
+
+// DXDatabaseMigration is the version of the schema made by Up and reverted by Down, empty when it cannot be.
+type DXDatabaseMigration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// DXDatabaseAppliedMigration is a row of DXDatabaseMigrationsTableName.
+type DXDatabaseAppliedMigration struct {
+	Version int64
+	Name    string
+	Down    string
+}
+
+// LoadMigrationFiles reads the migrations of dir, in the files <version>_<name>.up.sql and the optional
+// <version>_<name>.down.sql, in the order of their versions.
+func LoadMigrationFiles(dir string) (migrations []DXDatabaseMigration, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*DXDatabaseMigration{}
+	for _, entry := range entries {
+		filename := entry.Name()
+		isUp := strings.HasSuffix(filename, `.up.sql`)
+		if entry.IsDir() || (!isUp && !strings.HasSuffix(filename, `.down.sql`)) {
+			continue
+		}
+		base := strings.TrimSuffix(strings.TrimSuffix(filename, `.up.sql`), `.down.sql`)
+		versionPart, name, _ := strings.Cut(base, `_`)
+		version, err := strconv.ParseInt(versionPart, 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("MigrationFileInvalidVersion:%s", filename)
+		}
+		content, err := os.ReadFile(filepath.Join(dir, filename))
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &DXDatabaseMigration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("MigrationFileDuplicateVersion:%d:%s:%s", version, m.Name, name)
+		}
+		if isUp {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == `` {
+			return nil, fmt.Errorf("MigrationFileUpNotFound:%d_%s", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Migrate applies the migrations of dir not applied yet, see LoadMigrationFiles and MigrateUp.
+func (d *DXDatabase) Migrate(l *log.DXLog, dir string) (applied int, err error) {
+	migrations, err := LoadMigrationFiles(dir)
+	if err != nil {
+		return 0, err
+	}
+	return d.MigrateUp(l, migrations)
+}
+
+// MigrateUp applies the migrations not in DXDatabaseMigrationsTableName in the order of their versions, each in its
+// own transaction together with its row holding its Down, stopping at the first failing. The statements of a migration
+// are executed as splitMigrationScript gives them. The DDL of mysql is not transactional, a migration failing there
+// halfway has to be repaired by hand. On postgres the migrations are applied under DXDatabaseMigrationsAdvisoryLockKey,
+// so two deploys migrating at once apply each migration once, on the others the second insert of a version fails.
+func (d *DXDatabase) MigrateUp(l *log.DXLog, migrations []DXDatabaseMigration) (applied int, err error) {
+	for _, m := range migrations {
+		_, err = splitMigrationScript(d.DatabaseType, m.Up)
+		if err != nil {
+			return 0, fmt.Errorf("MigrationUpInvalid:%d_%s:%w", m.Version, m.Name, err)
+		}
+	}
+	unlock, err := d.lockMigrations(l)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	err = d.ensureMigrationsTable(l)
+	if err != nil {
+		return 0, err
+	}
+	appliedMigrations, err := d.AppliedMigrations(l)
+	if err != nil {
+		return 0, err
+	}
+	isApplied := map[int64]bool{}
+	for _, v := range appliedMigrations {
+		isApplied[v.Version] = true
+	}
+	for _, m := range migrations {
+		if isApplied[m.Version] {
+			continue
+		}
+		err = d.Tx(l, LevelDefault, func(l *log.DXLog, dtx *DXDatabaseTx) (err error) {
+			err = d.execMigrationScript(l, dtx, m.Up)
+			if err != nil {
+				return fmt.Errorf("MigrationUpFailed:%d_%s:%w", m.Version, m.Name, err)
+			}
+			_, err = db.InsertRowsAffectedExt(l.Context, dtx.Tx, DXDatabaseMigrationsTableName, utils.JSON{
+				`version`:     m.Version,
+				`name`:        m.Name,
+				`down_script`: m.Down,
+				`applied_at`:  time.Now().UTC(),
+			})
+			return err
+		})
+		if err != nil {
+			return applied, err
+		}
+		l.Infof("Migrated database %s up to %d_%s", d.NameId, m.Version, m.Name)
+		applied++
+	}
+	return applied, nil
+}
+
+// Rollback reverts the last steps applied migrations, the latest first, each by its recorded down script in its own
+// transaction together with the delete of its row. It fails with ErrMigrationIrreversible before reverting anything
+// when one of them has no down script.
+func (d *DXDatabase) Rollback(l *log.DXLog, steps int) (rolledBack int, err error) {
+	if steps <= 0 {
+		return 0, fmt.Errorf("MigrationRollbackStepsInvalid:%d", steps)
+	}
+	unlock, err := d.lockMigrations(l)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	err = d.ensureMigrationsTable(l)
+	if err != nil {
+		return 0, err
+	}
+	appliedMigrations, err := d.AppliedMigrations(l)
+	if err != nil {
+		return 0, err
+	}
+	if steps > len(appliedMigrations) {
+		return 0, fmt.Errorf("MigrationRollbackStepsBeyondApplied:%d:%d", steps, len(appliedMigrations))
+	}
+	appliedMigrations = appliedMigrations[len(appliedMigrations)-steps:]
+	for _, m := range appliedMigrations {
+		if strings.TrimSpace(m.Down) == `` {
+			l.Errorf("Migration %d_%s of database %s has no down script", m.Version, m.Name, d.NameId)
+			return 0, fmt.Errorf("%w:%d_%s", ErrMigrationIrreversible, m.Version, m.Name)
+		}
+		_, err = splitMigrationScript(d.DatabaseType, m.Down)
+		if err != nil {
+			return 0, fmt.Errorf("MigrationDownInvalid:%d_%s:%w", m.Version, m.Name, err)
+		}
+	}
+	for i := len(appliedMigrations) - 1; i >= 0; i-- {
+		m := appliedMigrations[i]
+		err = d.Tx(l, LevelDefault, func(l *log.DXLog, dtx *DXDatabaseTx) (err error) {
+			err = d.execMigrationScript(l, dtx, m.Down)
+			if err != nil {
+				return fmt.Errorf("MigrationDownFailed:%d_%s:%w", m.Version, m.Name, err)
+			}
+			_, err = db.DeleteWhereKeyValuesExt(l.Context, dtx.Tx, DXDatabaseMigrationsTableName, utils.JSON{`version`: m.Version})
+			return err
+		})
+		if err != nil {
+			return rolledBack, err
+		}
+		l.Infof("Migrated database %s down from %d_%s", d.NameId, m.Version, m.Name)
+		rolledBack++
+	}
+	return rolledBack, nil
+}
+
+// lockMigrations takes DXDatabaseMigrationsAdvisoryLockKey on a session of postgres, held until unlock, the other
+// databases are not locked.
+func (d *DXDatabase) lockMigrations(l *log.DXLog) (unlock func(), err error) {
+	if d.DatabaseType != database_type.PostgreSQL {
+		return func() {}, nil
+	}
+	s, err := d.Session(l.Context)
+	if err != nil {
+		return nil, err
+	}
+	unlockSession, _, err := AdvisoryLock(l.Context, s, DXDatabaseMigrationsAdvisoryLockKey)
+	if err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	return func() {
+		unlockSession()
+		_ = s.Close()
+	}, nil
+}
+
+// execMigrationScript executes the statements of script in dtx, one by one as splitMigrationScript gives them.
+func (d *DXDatabase) execMigrationScript(l *log.DXLog, dtx *DXDatabaseTx, script string) (err error) {
+	statements, err := splitMigrationScript(d.DatabaseType, script)
+	if err != nil {
+		return err
+	}
+	for _, statement := range statements {
+		ctx, done := db.StartQuery(l.Context, dtx.Tx, dtx.DriverName(), statement)
+		_, err = dtx.Tx.ExecContext(ctx, statement)
+		err = done(err)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitMigrationScript gives the statements of script to execute one by one. postgres, sqlserver and sqlite execute a
+// script of many statements at once, so it is kept whole. mysql, without the multiStatements this repo never sets, and
+// oracle execute one statement at once, so script is split at the semicolons outside of the quotes and the comments,
+// the comments are dropped except the hints of oracle. A PL/SQL block of oracle, a BEGIN, a DECLARE or the CREATE of a
+// PROCEDURE, FUNCTION, TRIGGER, PACKAGE or TYPE BODY, ends at a line of a single slash instead, like in SQL*Plus. A
+// routine of mysql with a BEGIN body cannot be split without the DELIMITER of the mysql client and fails with
+// ErrMigrationStatementNotSplittable, it has to be created by hand.
+func splitMigrationScript(databaseType database_type.DXDatabaseType, script string) (statements []string, err error) {
+	isMySQL := databaseType == database_type.MySQL
+	isOracle := databaseType == database_type.Oracle
+	if !isMySQL && !isOracle {
+		if strings.TrimSpace(script) == `` {
+			return nil, nil
+		}
+		return []string{script}, nil
+	}
+	var b strings.Builder
+	end := func() (err error) {
+		s := strings.TrimSpace(b.String())
+		b.Reset()
+		if s == `` {
+			return nil
+		}
+		if isMySQL && migrationRoutineRegexp.MatchString(s) && migrationBeginRegexp.MatchString(s) {
+			head, _, _ := strings.Cut(s, "\n")
+			return fmt.Errorf("%w:%s", ErrMigrationStatementNotSplittable, head)
+		}
+		statements = append(statements, s)
+		return nil
+	}
+	isBlock := func() bool {
+		s := strings.TrimSpace(b.String())
+		return isOracle && (migrationRoutineRegexp.MatchString(s) || migrationBlockRegexp.MatchString(s))
+	}
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case c == '\'' || c == '"' || (c == '`' && isMySQL):
+			j := i + 1
+			for ; j < len(script); j++ {
+				if isMySQL && script[j] == '\\' {
+					j++
+				} else if script[j] == c {
+					if j+1 < len(script) && script[j+1] == c {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			j = min(j, len(script)-1)
+			b.WriteString(script[i : j+1])
+			i = j
+		case strings.HasPrefix(script[i:], `--`) || (c == '#' && isMySQL):
+			j := strings.IndexByte(script[i:], '\n')
+			if j < 0 {
+				i = len(script)
+			} else {
+				i += j - 1
+			}
+		case strings.HasPrefix(script[i:], `/*`):
+			j := strings.Index(script[i+2:], `*/`)
+			if j < 0 {
+				j = len(script)
+			} else {
+				j = i + 2 + j + 2
+			}
+			if isOracle && strings.HasPrefix(script[i:], `/*+`) {
+				b.WriteString(script[i:j])
+			} else {
+				b.WriteByte(' ')
+			}
+			i = j - 1
+		case c == '/' && isOracle && isSlashLine(script, i):
+			err = end()
+			if err != nil {
+				return nil, err
+			}
+		case c == ';' && !isBlock():
+			err = end()
+			if err != nil {
+				return nil, err
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	err = end()
+	if err != nil {
+		return nil, err
+	}
+	return statements, nil
+}
+
+// isSlashLine tells the slash at i of script alone on its line.
+func isSlashLine(script string, i int) bool {
+	start := strings.LastIndexByte(script[:i], '\n') + 1
+	end := strings.IndexByte(script[i:], '\n')
+	if end < 0 {
+		end = len(script)
+	} else {
+		end += i
+	}
+	return strings.TrimSpace(script[start:i]) == `` && strings.TrimSpace(script[i+1:end]) == ``
+}
+
+// AppliedMigrations gives the rows of DXDatabaseMigrationsTableName in the order of their versions.
+func (d *DXDatabase) AppliedMigrations(l *log.DXLog) (r []DXDatabaseAppliedMigration, err error) {
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return nil, err
+	}
+	s := `SELECT version, name, down_script FROM ` + DXDatabaseMigrationsTableName + ` ORDER BY version`
+	rows, err := d.Connection.QueryContext(l.Context, s)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m DXDatabaseAppliedMigration
+		var down sql.NullString
+		err = rows.Scan(&m.Version, &m.Name, &down)
+		if err != nil {
+			return nil, err
+		}
+		m.Down = down.String
+		r = append(r, m)
+	}
+	return r, rows.Err()
+}
+
+// ensureMigrationsTable creates DXDatabaseMigrationsTableName when it cannot be read.
+func (d *DXDatabase) ensureMigrationsTable(l *log.DXLog) (err error) {
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return err
+	}
+	rows, err := d.Connection.QueryContext(l.Context, `SELECT version FROM `+DXDatabaseMigrationsTableName+` WHERE 1 = 0`)
+	if err == nil {
+		return rows.Close()
+	}
+	bigint, text, timestamp := `BIGINT`, `TEXT`, `TIMESTAMP`
+	switch d.DatabaseType {
+	case database_type.MySQL:
+		timestamp = `DATETIME`
+	case database_type.SQLServer:
+		text, timestamp = `NVARCHAR(MAX)`, `DATETIME2`
+	case database_type.Oracle:
+		bigint, text = `NUMBER(19)`, `CLOB`
+	}
+	s := `CREATE TABLE ` + DXDatabaseMigrationsTableName + ` (version ` + bigint + ` NOT NULL PRIMARY KEY, ` +
+		`name VARCHAR(255) NOT NULL, down_script ` + text + `, applied_at ` + timestamp + ` NOT NULL)`
+	_, err = d.Connection.ExecContext(l.Context, s)
+	if err != nil {
+		l.Errorf("Error creating table %s of database %s (%v)", DXDatabaseMigrationsTableName, d.NameId, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package databases
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/databases/database_type"
+	"dxlib/v3/log"
+)
+
+// writeTestMigrations writes the files of name to content in a new directory.
+func writeTestMigrations(t *testing.T, files map[string]string) (dir string) {
+	t.Helper()
+	dir = t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+	return dir
+}
+
+// testColumns gives the columns of the table t of d.
+func testColumns(t *testing.T, d *DXDatabase) (columns []string) {
+	t.Helper()
+	rows, err := d.Connection.Query(`SELECT name FROM pragma_table_info('t') ORDER BY cid`)
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		require.NoError(t, rows.Scan(&name))
+		columns = append(columns, name)
+	}
+	require.NoError(t, rows.Err())
+	return columns
+}
+
+func TestMigrateThenRollback(t *testing.T) {
+	d := newTestDatabase(t, newTestDatabaseManager(), `test`)
+	l := log.NewLog(nil, context.Background(), `test`)
+	dir := writeTestMigrations(t, map[string]string{
+		`1_add_email.up.sql`:   "ALTER TABLE t ADD COLUMN email TEXT;\nCREATE INDEX t_email ON t (email);",
+		`1_add_email.down.sql`: "DROP INDEX t_email;\nALTER TABLE t DROP COLUMN email;",
+		`2_add_age.up.sql`:     `ALTER TABLE t ADD COLUMN age INTEGER`,
+		`2_add_age.down.sql`:   `ALTER TABLE t DROP COLUMN age`,
+	})
+
+	applied, err := d.Migrate(&l, dir)
+	require.NoError(t, err)
+	assert.Equal(t, 2, applied)
+	assert.Equal(t, []string{`name`, `email`, `age`}, testColumns(t, d))
+	applied, err = d.Migrate(&l, dir)
+	require.NoError(t, err)
+	assert.Equal(t, 0, applied)
+
+	rolledBack, err := d.Rollback(&l, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, rolledBack)
+	assert.Equal(t, []string{`name`, `email`}, testColumns(t, d))
+	appliedMigrations, err := d.AppliedMigrations(&l)
+	require.NoError(t, err)
+	require.Len(t, appliedMigrations, 1)
+	assert.Equal(t, int64(1), appliedMigrations[0].Version)
+
+	_, err = d.Rollback(&l, 2)
+	assert.ErrorContains(t, err, `MigrationRollbackStepsBeyondApplied:2:1`)
+	rolledBack, err = d.Rollback(&l, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, rolledBack)
+	assert.Equal(t, []string{`name`}, testColumns(t, d))
+}
+
+func TestMigrateFailingRollsBackItsTransaction(t *testing.T) {
+	d := newTestDatabase(t, newTestDatabaseManager(), `test`)
+	l := log.NewLog(nil, context.Background(), `test`)
+
+	applied, err := d.MigrateUp(&l, []DXDatabaseMigration{
+		{Version: 1, Name: `add_email`, Up: `ALTER TABLE t ADD COLUMN email TEXT`},
+		{Version: 2, Name: `broken`, Up: "ALTER TABLE t ADD COLUMN age INTEGER;\nALTER TABLE missing ADD COLUMN x TEXT;"},
+	})
+	assert.ErrorContains(t, err, `MigrationUpFailed:2_broken`)
+	assert.Equal(t, 1, applied)
+	assert.Equal(t, []string{`name`, `email`}, testColumns(t, d))
+
+	_, err = d.Rollback(&l, 1)
+	assert.ErrorIs(t, err, ErrMigrationIrreversible)
+	assert.Equal(t, []string{`name`, `email`}, testColumns(t, d))
+}
+
+func TestMigrateRefusesUnsplittableMigrationsBeforeApplying(t *testing.T) {
+	d := newTestDatabase(t, newTestDatabaseManager(), `test`)
+	d.DatabaseType = database_type.MySQL
+	l := log.NewLog(nil, context.Background(), `test`)
+
+	applied, err := d.MigrateUp(&l, []DXDatabaseMigration{
+		{Version: 1, Name: `add_email`, Up: `ALTER TABLE t ADD COLUMN email TEXT`},
+		{Version: 2, Name: `routine`, Up: "CREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\nEND;"},
+	})
+	assert.ErrorIs(t, err, ErrMigrationStatementNotSplittable)
+	assert.ErrorContains(t, err, `MigrationUpInvalid:2_routine`)
+	assert.Equal(t, 0, applied)
+	assert.Equal(t, []string{`name`}, testColumns(t, d))
+}
+
+func TestSplitMigrationScript(t *testing.T) {
+	script := "CREATE TABLE a (id INT); -- a comment; not a statement\nINSERT INTO a VALUES (1);\n"
+	statements, err := splitMigrationScript(database_type.PostgreSQL, script)
+	require.NoError(t, err)
+	assert.Equal(t, []string{script}, statements)
+	statements, err = splitMigrationScript(database_type.SQLServer, " \n")
+	require.NoError(t, err)
+	assert.Empty(t, statements)
+
+	statements, err = splitMigrationScript(database_type.MySQL, "CREATE TABLE a (id INT, s TEXT DEFAULT 'x;y'); # comment;\n"+
+		"/* block; comment */ INSERT INTO a VALUES (1, 'it''s; \\' fine');\nUPDATE `a;b` SET s = \"q;\"")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		`CREATE TABLE a (id INT, s TEXT DEFAULT 'x;y')`,
+		`INSERT INTO a VALUES (1, 'it''s; \' fine')`,
+		"UPDATE `a;b` SET s = \"q;\"",
+	}, statements)
+	statements, err = splitMigrationScript(database_type.MySQL, "CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW SET NEW.id = 1;")
+	require.NoError(t, err)
+	assert.Equal(t, []string{`CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW SET NEW.id = 1`}, statements)
+	_, err = splitMigrationScript(database_type.MySQL, "CREATE DEFINER = root PROCEDURE p()\nBEGIN\n  SELECT 1;\nEND;")
+	assert.ErrorIs(t, err, ErrMigrationStatementNotSplittable)
+
+	statements, err = splitMigrationScript(database_type.Oracle, "CREATE TABLE a (id NUMBER(19));\n"+
+		"CREATE OR REPLACE PROCEDURE p AS\nBEGIN\n  INSERT INTO a VALUES (1);\nEND;\n/\n"+
+		"BEGIN\n  DELETE FROM a WHERE id = 10 / 2;\nEND;\n  /  \n"+
+		"SELECT /*+ FULL(a) */ id FROM a;")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		`CREATE TABLE a (id NUMBER(19))`,
+		"CREATE OR REPLACE PROCEDURE p AS\nBEGIN\n  INSERT INTO a VALUES (1);\nEND;",
+		"BEGIN\n  DELETE FROM a WHERE id = 10 / 2;\nEND;",
+		`SELECT /*+ FULL(a) */ id FROM a`,
+	}, statements)
+}
@@ -0,0 +1,110 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+
+	"dxlib/v3/databases/protected/db"
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+)
+
+// DXDatabaseLockKeyLess is the canonical order of the keys of LockInOrder, every caller locking the same table must use
+// the same one.
+type DXDatabaseLockKeyLess func(a any, b any) bool
+
+type DXDatabaseLockInOrderCallback func(log *log.DXLog, dtx *DXDatabaseTx, lockedKeys []any) (err error)
+
+// DefaultLockKeyLess orders the integer keys by value and any other key by its text.
+func DefaultLockKeyLess(a any, b any) bool {
+	ai, errA := utils.ConvertToInterfaceInt64FromAny(a)
+	bi, errB := utils.ConvertToInterfaceInt64FromAny(b)
+	if errA == nil && errB == nil {
+		return ai.(int64) < bi.(int64)
+	}
+	return fmt.Sprint(a) < fmt.Sprint(b)
+}
+
+// sortedLockKeys gives keys in the order of less, without the repeated ones.
+func sortedLockKeys(keys []any, less DXDatabaseLockKeyLess) (r []any) {
+	if less == nil {
+		less = DefaultLockKeyLess
+	}
+	r = append([]any{}, keys...)
+	sort.SliceStable(r, func(i, j int) bool {
+		return less(r[i], r[j])
+	})
+	n := 0
+	for i, v := range r {
+		if i > 0 && !less(r[n-1], v) && !less(v, r[n-1]) {
+			continue
+		}
+		r[n] = v
+		n++
+	}
+	return r[:n]
+}
+
+func lockRowQuery(driverName string, tableName string, keyFieldName string) (s string, err error) {
+	switch {
+	case db.DriverCapabilities(driverName).SupportsSelectForUpdate:
+		return `select ` + keyFieldName + ` from ` + tableName + ` where ` + keyFieldName + ` = :key for update`, nil
+	case driverName == "sqlserver":
+		return `select ` + keyFieldName + ` from ` + tableName + ` with (updlock, rowlock) where ` + keyFieldName + ` = :key`, nil
+	default:
+		return ``, fmt.Errorf("LockInOrderNotSupportedForDriver:%s", driverName)
+	}
+}
+
+// LockInOrder locks the rows of tableName whose keyFieldName is one of keys, one row at a time in the order of less, so
+// two transactions locking overlapping keys wait for each other instead of deadlocking. lockedKeys are the keys found,
+// in that order.
+func (dtx *DXDatabaseTx) LockInOrder(ctx context.Context, tableName string, keyFieldName string, keys []any,
+	less DXDatabaseLockKeyLess) (lockedKeys []any, err error) {
+	driverName := dtx.Tx.DriverName()
+	query, err := lockRowQuery(driverName, tableName, keyFieldName)
+	if err != nil {
+		return nil, err
+	}
+	lockedKeys = []any{}
+	for _, key := range sortedLockKeys(keys, less) {
+		s, args, err := db.PositionalQuery(driverName, query, utils.JSON{`key`: key})
+		if err != nil {
+			return nil, err
+		}
+		var lockedKey any
+		queryCtx, done := db.StartQuery(ctx, dtx.Tx, driverName, s)
+		err = dtx.Tx.QueryRowxContext(queryCtx, s, args...).Scan(&lockedKey)
+		done(err)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		lockedKeys = append(lockedKeys, key)
+	}
+	return lockedKeys, nil
+}
+
+// TxLockInOrder runs callback in a transaction once LockInOrder has locked keys, the whole transaction is run again on a
+// transient error, a deadlock left by the statements of callback included.
+func (d *DXDatabase) TxLockInOrder(l *log.DXLog, isolationLevel sql.IsolationLevel, tableName string, keyFieldName string,
+	keys []any, less DXDatabaseLockKeyLess, callback DXDatabaseLockInOrderCallback) (err error) {
+	ctx := l.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return d.RetryOnTransient(ctx, func() error {
+		return d.Tx(l, isolationLevel, func(l *log.DXLog, dtx *DXDatabaseTx) (err error) {
+			lockedKeys, err := dtx.LockInOrder(ctx, tableName, keyFieldName, keys, less)
+			if err != nil {
+				return err
+			}
+			return callback(l, dtx, lockedKeys)
+		})
+	})
+}
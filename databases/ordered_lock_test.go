@@ -0,0 +1,86 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/log"
+)
+
+func TestSortedLockKeys(t *testing.T) {
+	assert.Equal(t, []any{int64(1), 2, `3`, 10}, sortedLockKeys([]any{10, `3`, 2, int64(1), 2, 10}, nil))
+	assert.Equal(t, []any{`a`, `b`, `c`}, sortedLockKeys([]any{`c`, `a`, `b`, `a`}, nil))
+	// the order of the caller, descending
+	assert.Equal(t, []any{3, 2, 1}, sortedLockKeys([]any{1, 3, 2}, func(a any, b any) bool {
+		return DefaultLockKeyLess(b, a)
+	}))
+	assert.Empty(t, sortedLockKeys(nil, nil))
+}
+
+func TestLockRowQueryOfTheDrivers(t *testing.T) {
+	for driverName, query := range map[string]string{
+		`postgres`:  `select id from users where id = :key for update`,
+		`mysql`:     `select id from users where id = :key for update`,
+		`oracle`:    `select id from users where id = :key for update`,
+		`sqlserver`: `select id from users with (updlock, rowlock) where id = :key`,
+	} {
+		s, err := lockRowQuery(driverName, `users`, `id`)
+		require.NoError(t, err)
+		assert.Equal(t, query, s, driverName)
+	}
+	_, err := lockRowQuery(`sqlite`, `users`, `id`)
+	assert.EqualError(t, err, `LockInOrderNotSupportedForDriver:sqlite`)
+}
+
+func TestLockInOrderOfOverlappingKeysDoesNotDeadlock(t *testing.T) {
+	d := newTestPostgresDatabase(t, newTestDatabaseManager(), `ordered_lock`)
+	for _, s := range []string{`DROP TABLE IF EXISTS ordered_lock_accounts`,
+		`CREATE TABLE ordered_lock_accounts (id BIGINT PRIMARY KEY, balance BIGINT NOT NULL)`,
+		`INSERT INTO ordered_lock_accounts (id, balance) SELECT i, 0 FROM generate_series(1, 5) AS i`} {
+		_, err := d.Connection.Exec(s)
+		require.NoError(t, err)
+	}
+	t.Cleanup(func() {
+		_, _ = d.Connection.Exec(`DROP TABLE IF EXISTS ordered_lock_accounts`)
+	})
+
+	// the two callers give overlapping keys in opposite orders, locked in one order they wait instead of deadlocking
+	keySets := [][]any{{1, 2, 3, 4}, {4, 3, 2, 5}}
+	errs := make([]error, len(keySets))
+	lockedKeys := make([][]any, len(keySets))
+	wg := sync.WaitGroup{}
+	for i, keys := range keySets {
+		wg.Add(1)
+		go func(i int, keys []any) {
+			defer wg.Done()
+			l := log.NewLog(nil, context.Background(), `test`)
+			errs[i] = d.TxLockInOrder(&l, sql.LevelReadCommitted, `ordered_lock_accounts`, `id`, keys, nil,
+				func(l *log.DXLog, dtx *DXDatabaseTx, keys []any) (err error) {
+					lockedKeys[i] = keys
+					time.Sleep(100 * time.Millisecond)
+					for _, key := range keys {
+						_, err = dtx.Tx.Exec(`UPDATE ordered_lock_accounts SET balance = balance + 1 WHERE id = $1`, key)
+						if err != nil {
+							return err
+						}
+					}
+					return nil
+				})
+		}(i, keys)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []any{1, 2, 3, 4}, lockedKeys[0])
+	assert.Equal(t, []any{2, 3, 4, 5}, lockedKeys[1])
+	var balances []int64
+	require.NoError(t, d.Connection.Select(&balances, `SELECT balance FROM ordered_lock_accounts ORDER BY id`))
+	assert.Equal(t, []int64{1, 2, 2, 2, 1}, balances)
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"dxlib/v3/utils"
+)
+
+var (
+	ErrColumnNotAllowed     = errors.New("ColumnNotAllowed")
+	ErrSortDirectionInvalid = errors.New("SortDirectionInvalid")
+)
+
+// DXColumnAllowList maps the field names a client may give to the columns of a table, only these can be put in a
+// dynamic order by or filter. The columns are developer given, the field names are never written in the SQL.
+type DXColumnAllowList map[string]string
+
+// NewColumnAllowList allows columns under their own name, add the entries of other field names to the map.
+func NewColumnAllowList(columns ...string) DXColumnAllowList {
+	l := DXColumnAllowList{}
+	for _, c := range columns {
+		l[c] = c
+	}
+	return l
+}
+
+// Column gives the formatted column of fieldName, or ErrColumnNotAllowed.
+func (l DXColumnAllowList) Column(driverName string, identifierCase DXIdentifierCase, fieldName string) (s string, err error) {
+	column, ok := l[fieldName]
+	if !ok {
+		return ``, fmt.Errorf("%w:%s", ErrColumnNotAllowed, fieldName)
+	}
+	return FormatIdentifier(driverName, identifierCase, column), nil
+}
+
+func sortDirection(direction string) (s string, err error) {
+	switch strings.ToLower(direction) {
+	case ``, `asc`:
+		return `asc`, nil
+	case `desc`:
+		return `desc`, nil
+	default:
+		return ``, fmt.Errorf("%w:%s", ErrSortDirectionInvalid, direction)
+	}
+}
+
+// OrderBy validates a client order by like "name, created_at desc" and gives it with the formatted columns.
+func (l DXColumnAllowList) OrderBy(driverName string, identifierCase DXIdentifierCase, orderBy string) (s string, err error) {
+	parts := []string{}
+	for _, item := range strings.Split(orderBy, `,`) {
+		fields := strings.Fields(item)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 {
+			return ``, fmt.Errorf("%w:%s", ErrColumnNotAllowed, strings.TrimSpace(item))
+		}
+		column, err := l.Column(driverName, identifierCase, fields[0])
+		if err != nil {
+			return ``, err
+		}
+		direction := ``
+		if len(fields) == 2 {
+			direction = fields[1]
+		}
+		direction, err = sortDirection(direction)
+		if err != nil {
+			return ``, err
+		}
+		parts = append(parts, column+` `+direction)
+	}
+	return strings.Join(parts, `, `), nil
+}
+
+// OrderByFieldNameDirections is OrderBy for the map of the Select functions.
+func (l DXColumnAllowList) OrderByFieldNameDirections(driverName string, identifierCase DXIdentifierCase, orderBy map[string]string) (r map[string]string, err error) {
+	r = map[string]string{}
+	for fieldName, direction := range orderBy {
+		column, err := l.Column(driverName, identifierCase, fieldName)
+		if err != nil {
+			return nil, err
+		}
+		r[column], err = sortDirection(direction)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Where validates the field names of client equality filters and gives the where part on the formatted columns, the
+// values are bound as filter_0, filter_1 ... in args, a nil value is "is null".
+func (l DXColumnAllowList) Where(driverName string, identifierCase DXIdentifierCase, filterKeyValues utils.JSON) (s string, args utils.JSON, err error) {
+	parts := []string{}
+	args = utils.JSON{}
+	for i, fieldName := range SortedKeys(filterKeyValues) {
+		column, err := l.Column(driverName, identifierCase, fieldName)
+		if err != nil {
+			return ``, nil, err
+		}
+		v := filterKeyValues[fieldName]
+		if v == nil {
+			parts = append(parts, column+` is null`)
+			continue
+		}
+		argName := `filter_` + strconv.Itoa(i)
+		parts = append(parts, column+`=:`+argName)
+		args[argName] = v
+	}
+	return strings.Join(parts, ` and `), args, nil
+}
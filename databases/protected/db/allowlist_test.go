@@ -0,0 +1,67 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/utils"
+)
+
+func newTestAllowList() DXColumnAllowList {
+	l := NewColumnAllowList(`id`, `name`)
+	l[`createdAt`] = `created_at`
+	return l
+}
+
+func TestAllowListRejectsInjectedOrderBy(t *testing.T) {
+	l := newTestAllowList()
+	for _, orderBy := range []string{
+		`id; DROP TABLE users`,
+		`id;DROP TABLE users`,
+		`id desc; DROP TABLE users`,
+		`(select 1)`,
+		`name, password`,
+		`created_at`,
+	} {
+		t.Run(orderBy, func(t *testing.T) {
+			_, err := l.OrderBy(`postgres`, IdentifierCaseDefault, orderBy)
+			assert.ErrorIs(t, err, ErrColumnNotAllowed)
+		})
+	}
+	_, err := l.OrderBy(`postgres`, IdentifierCaseDefault, `id drop`)
+	assert.ErrorIs(t, err, ErrSortDirectionInvalid)
+	_, err = l.OrderByFieldNameDirections(`postgres`, IdentifierCaseDefault, map[string]string{`id; DROP TABLE users`: `asc`})
+	assert.ErrorIs(t, err, ErrColumnNotAllowed)
+	_, err = l.OrderByFieldNameDirections(`postgres`, IdentifierCaseDefault, map[string]string{`id`: `asc; DROP TABLE users`})
+	assert.ErrorIs(t, err, ErrSortDirectionInvalid)
+}
+
+func TestAllowListRejectsInjectedFilters(t *testing.T) {
+	l := newTestAllowList()
+	_, _, err := l.Where(`postgres`, IdentifierCaseDefault, utils.JSON{`id; DROP TABLE users`: 1})
+	assert.ErrorIs(t, err, ErrColumnNotAllowed)
+	assert.ErrorContains(t, err, `ColumnNotAllowed:id; DROP TABLE users`)
+	_, err = l.Column(`postgres`, IdentifierCaseDefault, `1=1 or id`)
+	assert.ErrorIs(t, err, ErrColumnNotAllowed)
+}
+
+func TestAllowListFormatsTheAllowedColumns(t *testing.T) {
+	l := newTestAllowList()
+	s, err := l.OrderBy(`postgres`, IdentifierCaseDefault, `createdAt DESC, name`)
+	require.NoError(t, err)
+	assert.Equal(t, `"created_at" desc, "name" asc`, s)
+	s, err = l.OrderBy(`mysql`, IdentifierCaseDefault, `id`)
+	require.NoError(t, err)
+	assert.Equal(t, "`id` asc", s)
+
+	r, err := l.OrderByFieldNameDirections(`sqlserver`, IdentifierCaseDefault, map[string]string{`createdAt`: `DESC`})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{`[created_at]`: `desc`}, r)
+
+	s, args, err := l.Where(`postgres`, IdentifierCaseDefault, utils.JSON{`name`: `a'; --`, `createdAt`: nil})
+	require.NoError(t, err)
+	assert.Equal(t, `"created_at" is null and "name"=:filter_1`, s)
+	assert.Equal(t, utils.JSON{`filter_1`: `a'; --`}, args)
+}
@@ -0,0 +1,43 @@
+package db
+
+import (
+	"fmt"
+
+	"dxlib/v3/utils"
+)
+
+// BuildInsert gives the insert of keyValues into tableName as a positional query of driverName and its args, ready for
+// ExecContext, the SQLExpression values written in the statement as they are. Like InsertExt, it fails when two keys
+// name the same field under identifierCase, see CheckFieldNameCollisions.
+func BuildInsert(tableName string, keyValues utils.JSON, driverName string, identifierCase DXIdentifierCase) (query string, args []any, err error) {
+	if len(keyValues) == 0 {
+		return ``, nil, fmt.Errorf("BuildInsertWithoutValues:%s", tableName)
+	}
+	err = CheckFieldNameCollisions(identifierCase, keyValues)
+	if err != nil {
+		return ``, nil, err
+	}
+	fn, fv := SQLPartInsertFieldNamesFieldValues(keyValues)
+	s := `INSERT INTO ` + tableName + ` (` + fn + `) VALUES (` + fv + `)`
+	return PositionalQuery(driverName, s, ExcludeSQLExpression(keyValues))
+}
+
+// BuildUpdate gives the update of setValues of the rows of tableName matching whereValues, the same statement as
+// UpdateWhereKeyValuesExt, as a positional query of driverName and its args. It fails without whereValues rather than
+// updating every row, or when two keys of the set or of the where name the same field under identifierCase.
+func BuildUpdate(tableName string, setValues utils.JSON, whereValues utils.JSON, driverName string, identifierCase DXIdentifierCase) (query string, args []any, err error) {
+	if len(setValues) == 0 {
+		return ``, nil, fmt.Errorf("BuildUpdateWithoutValues:%s", tableName)
+	}
+	if len(whereValues) == 0 {
+		return ``, nil, fmt.Errorf("BuildUpdateWithoutWhere:%s", tableName)
+	}
+	err = CheckUpdateFieldNameCollisions(identifierCase, setValues, whereValues)
+	if err != nil {
+		return ``, nil, err
+	}
+	setValues, u := SQLPartSetFieldNameValues(setValues)
+	w := SQLPartWhereAndFieldNameValues(whereValues)
+	s := `update ` + tableName + ` set ` + u + ` where ` + w
+	return PositionalQuery(driverName, s, MergeMapExcludeSQLExpression(setValues, whereValues))
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/utils"
+)
+
+func TestBuildInsert(t *testing.T) {
+	keyValues := utils.JSON{`name`: `alice`, `age`: 30, `created_at`: SQLExpression{Expression: `now()`}}
+	for _, tt := range []struct {
+		driverName string
+		query      string
+	}{
+		{`postgres`, `INSERT INTO users (age,created_at,name) VALUES ($1,now(),$2)`},
+		{`mysql`, `INSERT INTO users (age,created_at,name) VALUES (?,now(),?)`},
+	} {
+		t.Run(tt.driverName, func(t *testing.T) {
+			query, args, err := BuildInsert(`users`, keyValues, tt.driverName, IdentifierCaseDefault)
+			require.NoError(t, err)
+			assert.Equal(t, tt.query, query)
+			assert.Equal(t, []any{30, `alice`}, args)
+		})
+	}
+}
+
+func TestBuildUpdate(t *testing.T) {
+	setValues := utils.JSON{`name`: `bob`, `version`: SQLExpression{Expression: `version=version+1`}}
+	whereValues := utils.JSON{`id`: int64(7), `deleted_at`: nil}
+	for _, tt := range []struct {
+		driverName string
+		query      string
+	}{
+		{`postgres`, `update users set name=$1,version=version+1 where deleted_at is null  and id=$2`},
+		{`mysql`, `update users set name=?,version=version+1 where deleted_at is null  and id=?`},
+	} {
+		t.Run(tt.driverName, func(t *testing.T) {
+			query, args, err := BuildUpdate(`users`, setValues, whereValues, tt.driverName, IdentifierCaseDefault)
+			require.NoError(t, err)
+			assert.Equal(t, tt.query, query)
+			assert.Equal(t, []any{`bob`, int64(7)}, args)
+		})
+	}
+}
+
+func TestBuildRefusesUnsafeStatements(t *testing.T) {
+	_, _, err := BuildInsert(`users`, utils.JSON{}, `postgres`, IdentifierCaseDefault)
+	assert.EqualError(t, err, `BuildInsertWithoutValues:users`)
+	_, _, err = BuildUpdate(`users`, utils.JSON{}, utils.JSON{`id`: 1}, `postgres`, IdentifierCaseDefault)
+	assert.EqualError(t, err, `BuildUpdateWithoutValues:users`)
+	_, _, err = BuildUpdate(`users`, utils.JSON{`name`: `bob`}, utils.JSON{}, `postgres`, IdentifierCaseDefault)
+	assert.EqualError(t, err, `BuildUpdateWithoutWhere:users`)
+
+	// like InsertExt and UpdateWhereKeyValuesExt, two keys of the same field are refused
+	_, _, err = BuildInsert(`users`, utils.JSON{`Name`: `a`, `name`: `b`}, `postgres`, IdentifierCaseDefault)
+	assert.EqualError(t, err, `FieldNameCollision:Name,name`)
+	_, _, err = BuildUpdate(`users`, utils.JSON{`name`: `bob`}, utils.JSON{`Id`: 1, `id`: 1}, `postgres`, IdentifierCaseDefault)
+	assert.EqualError(t, err, `FieldNameCollision:Id,id`)
+	_, _, err = BuildInsert(`users`, utils.JSON{`Name`: `a`, `name`: `b`}, `postgres`, IdentifierCasePreserve)
+	assert.NoError(t, err)
+}
+
+func TestBuildInsertAndUpdateExecute(t *testing.T) {
+	connection := newTestSQLite(t, `CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, version INTEGER NOT NULL DEFAULT 1)`)
+	ctx := context.Background()
+
+	query, args, err := BuildInsert(`users`, utils.JSON{`id`: 7, `name`: `alice`}, `sqlite`, IdentifierCaseDefault)
+	require.NoError(t, err)
+	_, err = connection.ExecContext(ctx, query, args...)
+	require.NoError(t, err)
+	query, args, err = BuildUpdate(`users`, utils.JSON{`name`: `bob`, `version`: SQLExpression{Expression: `version=version+1`}},
+		utils.JSON{`id`: 7}, `sqlite`, IdentifierCaseDefault)
+	require.NoError(t, err)
+	_, err = connection.ExecContext(ctx, query, args...)
+	require.NoError(t, err)
+
+	var r struct {
+		Name    string `db:"name"`
+		Version int    `db:"version"`
+	}
+	require.NoError(t, connection.Get(&r, `SELECT name, version FROM users WHERE id = 7`))
+	assert.Equal(t, `bob`, r.Name)
+	assert.Equal(t, 2, r.Version)
+}
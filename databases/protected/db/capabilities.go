@@ -0,0 +1,124 @@
+package db
+
+import (
+	"sync"
+)
+
+// DXNullsOrdering is where the NULLs of an ascending ORDER BY go when the query does not say.
+type DXNullsOrdering string
+
+const (
+	// NullsOrderingLast sorts the NULLs as larger than any value, last ascending and first descending
+	NullsOrderingLast DXNullsOrdering = "last"
+	// NullsOrderingFirst sorts the NULLs as smaller than any value, first ascending and last descending
+	NullsOrderingFirst DXNullsOrdering = "first"
+)
+
+// DXDriverCapabilities is what the dialect of a driver supports, consulted by the helpers building statements instead
+// of each checking the driver name. The syntax of a feature, like RETURNING or OUTPUT, stays with its builder.
+type DXDriverCapabilities struct {
+	DriverName string
+	// SupportsReturning gives the inserted id back as a row, by RETURNING on postgres or OUTPUT on sqlserver
+	SupportsReturning bool
+	// SupportsLastInsertId gives the inserted id by sql.Result.LastInsertId
+	SupportsLastInsertId bool
+	SupportsSavepoints   bool
+	// SupportsReleaseSavepoint has a statement releasing a savepoint, without it savepoints last until the transaction ends
+	SupportsReleaseSavepoint bool
+	// SupportsCopy streams the rows of DXDatabase.CopyFrom by COPY, see CopyFromPostgres
+	SupportsCopy bool
+	// SupportsArrayParams binds a slice as one array parameter, like = ANY(:ids), instead of one parameter an element
+	SupportsArrayParams bool
+	// SupportsMultiRowInsert inserts several rows by one INSERT ... VALUES (...), (...)
+	SupportsMultiRowInsert bool
+	// SupportsSelectForUpdate locks the selected rows by a trailing FOR UPDATE
+	SupportsSelectForUpdate bool
+	// SupportsNullsFirstLast takes NULLS FIRST or NULLS LAST in an ORDER BY
+	SupportsNullsFirstLast bool
+	// IsLimitByTop limits the rows of a select by TOP n after SELECT instead of a trailing LIMIT n
+	IsLimitByTop bool
+	// IsPagingByOffsetFetch pages by OFFSET ... ROWS FETCH NEXT ... ROWS ONLY instead of LIMIT ... OFFSET ...
+	IsPagingByOffsetFetch bool
+	// IsPagingOrderByRequired needs an ORDER BY in a paged query
+	IsPagingOrderByRequired bool
+	// IdentifierQuoteOpen and IdentifierQuoteClose surround a quoted identifier
+	IdentifierQuoteOpen  string
+	IdentifierQuoteClose string
+	NullsOrdering        DXNullsOrdering
+}
+
+var (
+	driverCapabilities = map[string]DXDriverCapabilities{
+		"postgres": {
+			SupportsReturning:        true,
+			SupportsSavepoints:       true,
+			SupportsReleaseSavepoint: true,
+			SupportsCopy:             true,
+			SupportsArrayParams:      true,
+			SupportsMultiRowInsert:   true,
+			SupportsSelectForUpdate:  true,
+			SupportsNullsFirstLast:   true,
+			IdentifierQuoteOpen:      `"`,
+			IdentifierQuoteClose:     `"`,
+			NullsOrdering:            NullsOrderingLast,
+		},
+		"mysql": {
+			SupportsLastInsertId:     true,
+			SupportsSavepoints:       true,
+			SupportsReleaseSavepoint: true,
+			SupportsMultiRowInsert:   true,
+			SupportsSelectForUpdate:  true,
+			IdentifierQuoteOpen:      "`",
+			IdentifierQuoteClose:     "`",
+			NullsOrdering:            NullsOrderingFirst,
+		},
+		"oracle": {
+			SupportsSavepoints:      true,
+			SupportsSelectForUpdate: true,
+			SupportsNullsFirstLast:  true,
+			IsPagingByOffsetFetch:   true,
+			IdentifierQuoteOpen:     `"`,
+			IdentifierQuoteClose:    `"`,
+			NullsOrdering:           NullsOrderingLast,
+		},
+		"sqlserver": {
+			SupportsReturning:       true,
+			SupportsSavepoints:      true,
+			SupportsMultiRowInsert:  true,
+			IsLimitByTop:            true,
+			IsPagingByOffsetFetch:   true,
+			IsPagingOrderByRequired: true,
+			IdentifierQuoteOpen:     `[`,
+			IdentifierQuoteClose:    `]`,
+			NullsOrdering:           NullsOrderingFirst,
+		},
+	}
+	// driverCapabilitiesMutex guards driverCapabilities
+	driverCapabilitiesMutex sync.RWMutex
+)
+
+// DriverCapabilities gives the capabilities of driverName. An unknown driver gets those the helpers assume without a
+// registration, standard SQL: double quoted identifiers, LIMIT/OFFSET paging and multi-row inserts, nothing else.
+func DriverCapabilities(driverName string) (c DXDriverCapabilities) {
+	driverCapabilitiesMutex.RLock()
+	c, ok := driverCapabilities[driverName]
+	driverCapabilitiesMutex.RUnlock()
+	if !ok {
+		c = DXDriverCapabilities{
+			SupportsMultiRowInsert: true,
+			IdentifierQuoteOpen:    `"`,
+			IdentifierQuoteClose:   `"`,
+			NullsOrdering:          NullsOrderingLast,
+		}
+	}
+	c.DriverName = driverName
+	return c
+}
+
+// RegisterDriverCapabilities adds, or replaces, the capabilities of the driver c.DriverName, the one change a new
+// driver needs besides the syntax of the features it has.
+func RegisterDriverCapabilities(c DXDriverCapabilities) {
+	driverCapabilitiesMutex.Lock()
+	defer driverCapabilitiesMutex.Unlock()
+	driverCapabilities[c.DriverName] = c
+}
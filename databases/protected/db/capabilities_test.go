@@ -0,0 +1,83 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDriverCapabilities(t *testing.T) {
+	for _, tt := range []struct {
+		driverName   string
+		capabilities DXDriverCapabilities
+	}{
+		{`postgres`, DXDriverCapabilities{DriverName: `postgres`, SupportsReturning: true, SupportsSavepoints: true,
+			SupportsReleaseSavepoint: true, SupportsCopy: true, SupportsArrayParams: true, SupportsMultiRowInsert: true,
+			SupportsSelectForUpdate: true, SupportsNullsFirstLast: true, IdentifierQuoteOpen: `"`, IdentifierQuoteClose: `"`,
+			NullsOrdering: NullsOrderingLast}},
+		{`mysql`, DXDriverCapabilities{DriverName: `mysql`, SupportsLastInsertId: true, SupportsSavepoints: true,
+			SupportsReleaseSavepoint: true, SupportsMultiRowInsert: true, SupportsSelectForUpdate: true,
+			IdentifierQuoteOpen: "`", IdentifierQuoteClose: "`", NullsOrdering: NullsOrderingFirst}},
+		{`oracle`, DXDriverCapabilities{DriverName: `oracle`, SupportsSavepoints: true, SupportsSelectForUpdate: true,
+			SupportsNullsFirstLast: true, IsPagingByOffsetFetch: true, IdentifierQuoteOpen: `"`, IdentifierQuoteClose: `"`,
+			NullsOrdering: NullsOrderingLast}},
+		{`sqlserver`, DXDriverCapabilities{DriverName: `sqlserver`, SupportsReturning: true, SupportsSavepoints: true,
+			SupportsMultiRowInsert: true, IsLimitByTop: true, IsPagingByOffsetFetch: true, IsPagingOrderByRequired: true,
+			IdentifierQuoteOpen: `[`, IdentifierQuoteClose: `]`, NullsOrdering: NullsOrderingFirst}},
+		{`unknown`, DXDriverCapabilities{DriverName: `unknown`, SupportsMultiRowInsert: true, IdentifierQuoteOpen: `"`,
+			IdentifierQuoteClose: `"`, NullsOrdering: NullsOrderingLast}},
+	} {
+		t.Run(tt.driverName, func(t *testing.T) {
+			assert.Equal(t, tt.capabilities, DriverCapabilities(tt.driverName))
+		})
+	}
+}
+
+func TestHelpersFollowTheDriverCapabilities(t *testing.T) {
+	for _, tt := range []struct {
+		driverName          string
+		identifier          string
+		limitOffset         string
+		in                  string
+		isBulkInsertRefused bool
+	}{
+		{`postgres`, `"Users"`, ` LIMIT 10 OFFSET 20`, `id = ANY(:ids)`, false},
+		{`mysql`, "`Users`", ` LIMIT 10 OFFSET 20`, `id IN (:ids_0, :ids_1)`, false},
+		{`oracle`, `"Users"`, ` OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY`, `id IN (:ids_0, :ids_1)`, true},
+		{`sqlserver`, `[Users]`, ` OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY`, `id IN (:ids_0, :ids_1)`, false},
+		{`unknown`, `"Users"`, ` LIMIT 10 OFFSET 20`, `id IN (:ids_0, :ids_1)`, false},
+	} {
+		t.Run(tt.driverName, func(t *testing.T) {
+			assert.Equal(t, tt.identifier, FormatIdentifier(tt.driverName, IdentifierCasePreserve, `Users`))
+			assert.Equal(t, tt.limitOffset, SQLPartLimitOffset(tt.driverName, 10, 20))
+			q, _, err := ExpandIn(`id IN (:ids)`, map[string]any{`ids`: []int64{1, 2}}, tt.driverName)
+			require.NoError(t, err)
+			assert.Equal(t, tt.in, q)
+			_, err = SQLBulkInsert(tt.driverName, `users`, []string{`name`}, 2)
+			if tt.isBulkInsertRefused {
+				assert.ErrorContains(t, err, `BulkInsertNotSupportedForDriver:`+tt.driverName)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRegisterDriverCapabilities(t *testing.T) {
+	RegisterDriverCapabilities(DXDriverCapabilities{DriverName: `test`, SupportsArrayParams: true,
+		IsPagingByOffsetFetch: true, IdentifierQuoteOpen: `<`, IdentifierQuoteClose: `>`})
+	t.Cleanup(func() {
+		driverCapabilitiesMutex.Lock()
+		delete(driverCapabilities, `test`)
+		driverCapabilitiesMutex.Unlock()
+	})
+
+	c := DriverCapabilities(`test`)
+	assert.True(t, c.SupportsArrayParams)
+	assert.False(t, c.SupportsMultiRowInsert)
+	assert.Equal(t, `<users>`, FormatIdentifier(`test`, IdentifierCasePreserve, `users`))
+	assert.Equal(t, ` OFFSET 0 ROWS FETCH NEXT 5 ROWS ONLY`, SQLPartLimitOffset(`test`, 5, 0))
+	_, err := SQLBulkInsert(`test`, `users`, []string{`name`}, 2)
+	assert.ErrorContains(t, err, `BulkInsertNotSupportedForDriver:test`)
+}
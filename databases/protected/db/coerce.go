@@ -0,0 +1,134 @@
+package db
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"dxlib/v3/utils"
+)
+
+// DXArgCoercer gives the value passed to the driver for v, like the string of an enum for a Postgres enum column.
+type DXArgCoercer func(v any) any
+
+// DXArgValuer is a type giving its own driver value, without a registered coercer, like a Money rendered as a numeric
+// text for one driver and as cents for another.
+type DXArgValuer interface {
+	ArgValue(driverName string) any
+}
+
+var (
+	argCoercerMutex sync.RWMutex
+	argCoercers     = map[reflect.Type]map[string]DXArgCoercer{}
+	argValuerType   = reflect.TypeOf((*DXArgValuer)(nil)).Elem()
+)
+
+// RegisterArgCoercer makes coercer give the driver value of the values of type t for driverName, or for every driver
+// when driverName is empty, the coercer of the driver taking precedence. It replaces the coercer registered before.
+func RegisterArgCoercer(t reflect.Type, driverName string, coercer DXArgCoercer) {
+	argCoercerMutex.Lock()
+	defer argCoercerMutex.Unlock()
+	m, ok := argCoercers[t]
+	if !ok {
+		m = map[string]DXArgCoercer{}
+		argCoercers[t] = m
+	}
+	m[driverName] = coercer
+}
+
+// RegisterArgCoercerOf is RegisterArgCoercer of the type T, like RegisterArgCoercerOf("postgres", func(v Status) any {
+// return v.String() }).
+func RegisterArgCoercerOf[T any](driverName string, coercer func(v T) any) {
+	RegisterArgCoercer(reflect.TypeOf((*T)(nil)).Elem(), driverName, func(v any) any {
+		return coercer(v.(T))
+	})
+}
+
+// argCoercerOf gives the coercer of t for driverName. Without driverName only a coercer of every driver is given, and
+// isDeferred is true when t has a coercer of some driver or is a DXArgValuer, its value is then left for the driver.
+func argCoercerOf(t reflect.Type, driverName string) (coercer DXArgCoercer, isDeferred bool) {
+	argCoercerMutex.RLock()
+	m := argCoercers[t]
+	if driverName != `` {
+		coercer = m[driverName]
+	} else {
+		isDeferred = len(m) > 1 || (len(m) == 1 && m[``] == nil)
+	}
+	if coercer == nil && !isDeferred {
+		coercer = m[``]
+	}
+	argCoercerMutex.RUnlock()
+	if coercer != nil || isDeferred || !t.Implements(argValuerType) {
+		return coercer, isDeferred
+	}
+	if driverName == `` {
+		return nil, true
+	}
+	return func(v any) any {
+		return v.(DXArgValuer).ArgValue(driverName)
+	}, false
+}
+
+// CoerceArgValue gives the driver value of v for driverName by its coercer, or by its ArgValue, ok is false when v has
+// none. A non nil pointer is coerced as the value it points to.
+func CoerceArgValue(driverName string, v any) (r any, ok bool) {
+	r, ok, _ = coerceArgValue(driverName, v)
+	return r, ok
+}
+
+func coerceArgValue(driverName string, v any) (r any, ok bool, isDeferred bool) {
+	if v == nil {
+		return nil, false, false
+	}
+	t := reflect.TypeOf(v)
+	coercer, isDeferred := argCoercerOf(t, driverName)
+	if coercer == nil && !isDeferred && t.Kind() == reflect.Pointer {
+		rv := reflect.ValueOf(v)
+		if !rv.IsNil() {
+			coercer, isDeferred = argCoercerOf(t.Elem(), driverName)
+			if coercer != nil {
+				return coercer(rv.Elem().Interface()), true, false
+			}
+		}
+	}
+	if coercer == nil {
+		return v, false, isDeferred
+	}
+	return coercer(v), true, false
+}
+
+// CoerceArgs gives the values of a utils.JSON arg coerced for driverName, for the named queries taking the values as
+// they are, another arg is given as it is.
+func CoerceArgs(driverName string, arg any) any {
+	kv, ok := arg.(utils.JSON)
+	if !ok {
+		return arg
+	}
+	return coerceJSONArgs(driverName, kv)
+}
+
+func coerceJSONArgs(driverName string, kv utils.JSON) (r utils.JSON) {
+	r = make(utils.JSON, len(kv))
+	for k, v := range kv {
+		c, ok := CoerceArgValue(driverName, v)
+		if ok {
+			v = c
+		}
+		r[k] = v
+	}
+	return r
+}
+
+func init() {
+	RegisterArgCoercerOf(``, func(v time.Time) any {
+		return v
+	})
+	RegisterArgCoercerOf(``, func(v []byte) any {
+		return v
+	})
+	RegisterArgCoercerOf(``, func(v uuid.UUID) any {
+		return v.String()
+	})
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/utils"
+)
+
+type testStatus int
+
+const (
+	testStatusActive testStatus = iota + 1
+	testStatusSuspended
+)
+
+func (s testStatus) String() string {
+	switch s {
+	case testStatusActive:
+		return `active`
+	case testStatusSuspended:
+		return `suspended`
+	default:
+		return `unknown`
+	}
+}
+
+// testMoney gives its own driver value, cents for mysql and a numeric text for the others.
+type testMoney struct {
+	Cents int64
+}
+
+func (m testMoney) ArgValue(driverName string) any {
+	if driverName == `mysql` {
+		return m.Cents
+	}
+	return strconv.FormatInt(m.Cents/100, 10) + `.` + strconv.FormatInt(m.Cents%100, 10)
+}
+
+// registerTestStatusCoercers renders testStatus as its name for every driver and as its number for mysql, removed at
+// the end of the test.
+func registerTestStatusCoercers(t *testing.T) {
+	t.Helper()
+	RegisterArgCoercerOf(``, func(v testStatus) any {
+		return v.String()
+	})
+	RegisterArgCoercerOf(`mysql`, func(v testStatus) any {
+		return int64(v)
+	})
+	t.Cleanup(func() {
+		argCoercerMutex.Lock()
+		delete(argCoercers, reflect.TypeOf(testStatus(0)))
+		argCoercerMutex.Unlock()
+	})
+}
+
+func TestCoerceArgValueOfARegisteredCoercer(t *testing.T) {
+	registerTestStatusCoercers(t)
+	suspended := testStatusSuspended
+	var missing *testStatus
+	for _, tt := range []struct {
+		name       string
+		driverName string
+		v          any
+		r          any
+		ok         bool
+	}{
+		{`every driver`, `postgres`, testStatusActive, `active`, true},
+		{`the driver first`, `mysql`, testStatusActive, int64(1), true},
+		{`a pointer`, `postgres`, &suspended, `suspended`, true},
+		{`a nil pointer`, `postgres`, missing, missing, false},
+		{`without coercer`, `postgres`, 7, 7, false},
+		{`a valuer`, `postgres`, testMoney{Cents: 1250}, `12.50`, true},
+		{`a valuer of the driver`, `mysql`, testMoney{Cents: 1250}, int64(1250), true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r, ok := CoerceArgValue(tt.driverName, tt.v)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.r, r)
+		})
+	}
+}
+
+func TestCoerceArgValueOfTheBuiltIns(t *testing.T) {
+	id := uuid.MustParse(`0b9f5b2e-2d4c-4f0c-9d7b-7f4f1a3c2e10`)
+	r, ok := CoerceArgValue(`postgres`, id)
+	assert.True(t, ok)
+	assert.Equal(t, `0b9f5b2e-2d4c-4f0c-9d7b-7f4f1a3c2e10`, r)
+
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	r, ok = CoerceArgValue(`postgres`, at)
+	assert.True(t, ok)
+	assert.Equal(t, at, r)
+	r, ok = CoerceArgValue(`postgres`, []byte(`raw`))
+	assert.True(t, ok)
+	assert.Equal(t, []byte(`raw`), r)
+}
+
+func TestPrepareArgValueDefersTheCoercersOfADriver(t *testing.T) {
+	registerTestStatusCoercers(t)
+
+	// without a driver, a type with a coercer of some driver is left as it is for the driver to coerce
+	assert.Equal(t, testStatusActive, PrepareArgValue(testStatusActive))
+	assert.Equal(t, `active`, PrepareDriverArgValue(`postgres`, testStatusActive))
+	assert.Equal(t, int64(1), PrepareDriverArgValue(`mysql`, testStatusActive))
+	assert.Equal(t, testMoney{Cents: 1250}, PrepareArgValue(testMoney{Cents: 1250}))
+
+	// with the coercer of every driver only, it is coerced without a driver
+	RegisterArgCoercerOf(``, func(v testMoney) any {
+		return v.Cents
+	})
+	t.Cleanup(func() {
+		argCoercerMutex.Lock()
+		delete(argCoercers, reflect.TypeOf(testMoney{}))
+		argCoercerMutex.Unlock()
+	})
+	assert.Equal(t, int64(1250), PrepareArgValue(testMoney{Cents: 1250}))
+}
+
+func TestCoerceArgsOfANamedQuery(t *testing.T) {
+	registerTestStatusCoercers(t)
+	assert.Equal(t, utils.JSON{`status`: `active`, `limit`: 10},
+		CoerceArgs(`postgres`, utils.JSON{`status`: testStatusActive, `limit`: 10}))
+	assert.Equal(t, []any{testStatusActive}, CoerceArgs(`postgres`, []any{testStatusActive}))
+
+	connection := newTestSQLite(t, `CREATE TABLE users (name TEXT, status TEXT)`,
+		`INSERT INTO users (name, status) VALUES ('alice', 'active'), ('bob', 'suspended')`)
+	rows, err := NamedQueryRowsExt(context.Background(), connection, `SELECT name FROM users WHERE status = :status`,
+		utils.JSON{`status`: testStatusSuspended})
+	require.NoError(t, err)
+	assert.Equal(t, []utils.JSON{{`name`: `bob`}}, rows)
+}
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DXConn is one connection taken from the pool of a *sqlx.DB, usable by the helpers taking a sqlx.ExtContext. Its
+// statements share the state of the session, like SET, the temporary tables and the advisory locks.
+type DXConn struct {
+	*sqlx.Conn
+	driverName string
+	untrack    func()
+}
+
+// NewConn takes a connection from the pool of connection, it is given back by Close. The queries on it use the slow
+// query threshold and the identifier case of connection.
+func NewConn(ctx context.Context, connection *sqlx.DB) (c *DXConn, err error) {
+	conn, err := connection.Connx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c = &DXConn{Conn: conn, driverName: connection.DriverName()}
+	c.untrack = track(c, connection)
+	return c, nil
+}
+
+func (c *DXConn) DriverName() string {
+	return c.driverName
+}
+
+func (c *DXConn) BindNamed(query string, arg any) (s string, args []any, err error) {
+	return sqlx.BindNamed(sqlx.BindType(c.driverName), query, arg)
+}
+
+func (c *DXConn) Close() (err error) {
+	c.untrack()
+	return c.Conn.Close()
+}
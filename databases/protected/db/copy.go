@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jmoiron/sqlx"
+
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+)
+
+// CopyFromExt loads the rows received from rows, the values of columns in their order, into tableName until rows is
+// closed, giving how many were loaded, all in the transaction e is or else in its own one. They are inserted by
+// BulkInsertExt, DefaultBulkUpsertBatchSize rows a statement, COPY needs a connection of its own, see CopyFromPostgres.
+// The values are prepared like PrepareArgs does. It stops once ctx is done, the sender of rows must then stop by ctx too.
+func CopyFromExt(ctx context.Context, e sqlx.ExtContext, tableName string, columns []string, rows <-chan []any) (rowCount int64, err error) {
+	if len(columns) == 0 {
+		return 0, fmt.Errorf("CopyFromWithoutColumns:%s", tableName)
+	}
+	beginner, ok := e.(interface {
+		BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error)
+	})
+	if ok {
+		tx, err := beginner.BeginTxx(ctx, nil)
+		if err != nil {
+			return 0, err
+		}
+		connection, ok := e.(*sqlx.DB)
+		if ok {
+			defer TrackTx(tx, connection)()
+		}
+		rowCount, err = CopyFromExt(ctx, tx, tableName, columns, rows)
+		if err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return 0, err
+		}
+		return rowCount, nil
+	}
+	log.Log.Infof("The rows of %s are inserted in batches on %s", tableName, e.DriverName())
+	return copyByBulkInsert(ctx, e, tableName, columns, rows)
+}
+
+// CopyFromPostgres loads the rows like CopyFromExt by the binary COPY of pgx, on a connection of its own opened by dsn,
+// the URL of a postgres database. The COPY is one statement, the rows are loaded all or none. The parameters of dsn only
+// lib/pq knows, like binary_parameters, are left out.
+func CopyFromPostgres(ctx context.Context, dsn string, tableName string, columns []string, rows <-chan []any) (rowCount int64, err error) {
+	if len(columns) == 0 {
+		return 0, fmt.Errorf("CopyFromWithoutColumns:%s", tableName)
+	}
+	config, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return 0, err
+	}
+	for _, k := range libPQOnlyParameters {
+		delete(config.RuntimeParams, k)
+	}
+	identifier := pgx.Identifier{tableName}
+	if schemaName, name, ok := strings.Cut(tableName, `.`); ok {
+		identifier = pgx.Identifier{schemaName, name}
+	}
+	s := `COPY ` + identifier.Sanitize() + ` (` + strings.Join(columns, `, `) + `) FROM STDIN BINARY`
+	queryCtx, done := StartQuery(ctx, nil, `postgres`, s)
+	defer func() {
+		err = done(err)
+	}()
+	connection, err := pgx.ConnectConfig(queryCtx, config)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = connection.Close(context.Background())
+	}()
+	sent := int64(0)
+	source := pgx.CopyFromFunc(func() (row []any, err error) {
+		row, isOpen, err := receiveRow(queryCtx, rows)
+		if err != nil || !isOpen {
+			return nil, err
+		}
+		if len(row) != len(columns) {
+			return nil, fmt.Errorf("CopyFromRowColumnsMismatch:%d", sent)
+		}
+		args := make([]any, len(row))
+		for i, v := range row {
+			args[i] = PrepareDriverArgValue(`postgres`, v)
+		}
+		sent++
+		return args, nil
+	})
+	return connection.CopyFrom(queryCtx, identifier, columns, source)
+}
+
+// libPQOnlyParameters are the parameters of a DSN pgx would send to the server as settings it does not have.
+var libPQOnlyParameters = []string{`binary_parameters`, `disable_prepared_binary_result`}
+
+// receiveRow waits for the next row of rows, isOpen is false once rows is closed.
+func receiveRow(ctx context.Context, rows <-chan []any) (row []any, isOpen bool, err error) {
+	select {
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	case row, isOpen = <-rows:
+		return row, isOpen, nil
+	}
+}
+
+func copyByBulkInsert(ctx context.Context, e sqlx.ExtContext, tableName string, columns []string, rows <-chan []any) (rowCount int64, err error) {
+	batch := make([]utils.JSON, 0, DefaultBulkUpsertBatchSize)
+	flush := func() (err error) {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err = BulkInsertExt(ctx, e, tableName, batch, DefaultBulkUpsertBatchSize)
+		if err != nil {
+			return err
+		}
+		rowCount += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+	for {
+		row, isOpen, err := receiveRow(ctx, rows)
+		if err != nil {
+			return rowCount, err
+		}
+		if !isOpen {
+			break
+		}
+		if len(row) != len(columns) {
+			return rowCount, fmt.Errorf("CopyFromRowColumnsMismatch:%d", rowCount+int64(len(batch)))
+		}
+		v := make(utils.JSON, len(columns))
+		for i, k := range columns {
+			v[k] = row[i]
+		}
+		batch = append(batch, v)
+		if len(batch) == DefaultBulkUpsertBatchSize {
+			err = flush()
+			if err != nil {
+				return rowCount, err
+			}
+		}
+	}
+	err = flush()
+	return rowCount, err
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// testPostgresDSN is the postgres the COPY tests and benchmarks run against, they are skipped without it.
+const testPostgresDSN = `DXLIB_TEST_POSTGRES_DSN`
+
+// sendTestRows sends n rows of the columns id, name and created_at, then closes the channel.
+func sendTestRows(n int) <-chan []any {
+	rows := make(chan []any, 100)
+	go func() {
+		defer close(rows)
+		createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		for i := 1; i <= n; i++ {
+			var name any = `name` + strconv.Itoa(i)
+			if i%10 == 0 {
+				name = nil
+			}
+			rows <- []any{int64(i), name, createdAt}
+		}
+	}()
+	return rows
+}
+
+var testCopyColumns = []string{`id`, `name`, `created_at`}
+
+func TestCopyFromExtInsertsInBatches(t *testing.T) {
+	connection, err := sqlx.Open(`sqlite`, filepath.Join(t.TempDir(), `copy.db`))
+	require.NoError(t, err)
+	defer func() {
+		_ = connection.Close()
+	}()
+	_, err = connection.Exec(`CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NULL, created_at DATETIME NOT NULL)`)
+	require.NoError(t, err)
+
+	rowCount, err := CopyFromExt(context.Background(), connection, `items`, testCopyColumns, sendTestRows(1234))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1234), rowCount)
+	var count, nullCount int64
+	require.NoError(t, connection.Get(&count, `SELECT count(*) FROM items`))
+	require.NoError(t, connection.Get(&nullCount, `SELECT count(*) FROM items WHERE name IS NULL`))
+	assert.Equal(t, int64(1234), count)
+	assert.Equal(t, int64(123), nullCount)
+
+	// a short row rolls the whole load back
+	rows := make(chan []any, 2)
+	rows <- []any{int64(2000), `a`, time.Now()}
+	rows <- []any{int64(2001)}
+	close(rows)
+	_, err = CopyFromExt(context.Background(), connection, `items`, testCopyColumns, rows)
+	assert.ErrorContains(t, err, `CopyFromRowColumnsMismatch`)
+	require.NoError(t, connection.Get(&count, `SELECT count(*) FROM items`))
+	assert.Equal(t, int64(1234), count)
+}
+
+// newTestPostgresTable gives the DSN of DXLIB_TEST_POSTGRES_DSN, with the table copy_items created empty on it, or
+// skips.
+func newTestPostgresTable(tb testing.TB) (dsn string, connection *sqlx.DB) {
+	tb.Helper()
+	dsn = os.Getenv(testPostgresDSN)
+	if dsn == `` {
+		tb.Skip(testPostgresDSN + ` is not set`)
+	}
+	connection, err := sqlx.Open(`postgres`, dsn)
+	require.NoError(tb, err)
+	tb.Cleanup(func() {
+		_, _ = connection.Exec(`DROP TABLE IF EXISTS copy_items`)
+		_ = connection.Close()
+	})
+	_, err = connection.Exec(`DROP TABLE IF EXISTS copy_items`)
+	require.NoError(tb, err)
+	_, err = connection.Exec(`CREATE TABLE copy_items (id BIGINT PRIMARY KEY, name TEXT NULL, created_at TIMESTAMPTZ NOT NULL)`)
+	require.NoError(tb, err)
+	return dsn, connection
+}
+
+func TestCopyFromPostgres(t *testing.T) {
+	dsn, connection := newTestPostgresTable(t)
+	separator := `?`
+	if strings.Contains(dsn, `?`) {
+		separator = `&`
+	}
+	// a parameter of lib/pq, as DXDatabase.CopyFrom gives it, is left out
+	rowCount, err := CopyFromPostgres(context.Background(), dsn+separator+`binary_parameters=yes`, `public.copy_items`, testCopyColumns, sendTestRows(1234))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1234), rowCount)
+	var count, nullCount int64
+	require.NoError(t, connection.Get(&count, `SELECT count(*) FROM copy_items`))
+	require.NoError(t, connection.Get(&nullCount, `SELECT count(*) FROM copy_items WHERE name IS NULL`))
+	assert.Equal(t, int64(1234), count)
+	assert.Equal(t, int64(123), nullCount)
+
+	rows := make(chan []any, 2)
+	rows <- []any{int64(2000), `a`, time.Now()}
+	rows <- []any{int64(2001)}
+	close(rows)
+	_, err = CopyFromPostgres(context.Background(), dsn, `copy_items`, testCopyColumns, rows)
+	assert.ErrorContains(t, err, `CopyFromRowColumnsMismatch`)
+	require.NoError(t, connection.Get(&count, `SELECT count(*) FROM copy_items`))
+	assert.Equal(t, int64(1234), count)
+}
+
+func benchmarkCopy(b *testing.B, load func(ctx context.Context, dsn string, connection *sqlx.DB, rows <-chan []any) (int64, error)) {
+	dsn, connection := newTestPostgresTable(b)
+	const rowCount = 10000
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		_, err := connection.Exec(`TRUNCATE copy_items`)
+		require.NoError(b, err)
+		rows := sendTestRows(rowCount)
+		b.StartTimer()
+		n, err := load(context.Background(), dsn, connection, rows)
+		require.NoError(b, err)
+		require.Equal(b, int64(rowCount), n)
+	}
+}
+
+func BenchmarkCopyFromPostgres(b *testing.B) {
+	benchmarkCopy(b, func(ctx context.Context, dsn string, _ *sqlx.DB, rows <-chan []any) (int64, error) {
+		return CopyFromPostgres(ctx, dsn, `copy_items`, testCopyColumns, rows)
+	})
+}
+
+func BenchmarkCopyFromExtOnPostgres(b *testing.B) {
+	benchmarkCopy(b, func(ctx context.Context, _ string, connection *sqlx.DB, rows <-chan []any) (int64, error) {
+		return CopyFromExt(ctx, connection, `copy_items`, testCopyColumns, rows)
+	})
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const DefaultCSVFlushEveryRows = 1000
+
+// CSVOptions are how ExportCSV writes, Delimiter is ',' when 0, '\t' gives a TSV. IsBOM starts the output with the UTF-8
+// byte order mark Excel needs to read it as UTF-8.
+type CSVOptions struct {
+	Delimiter      rune
+	IsBOM          bool
+	FlushEveryRows int
+}
+
+type bufferFlusher interface {
+	Flush() error
+}
+
+// flushCSV sends what is written so far to the client, w is flushed when it is a *bufio.Writer or an
+// http.ResponseWriter.
+func flushCSV(cw *csv.Writer, w io.Writer) (err error) {
+	cw.Flush()
+	err = cw.Error()
+	if err != nil {
+		return err
+	}
+	switch f := w.(type) {
+	case bufferFlusher:
+		return f.Flush()
+	case http.Flusher:
+		f.Flush()
+	}
+	return nil
+}
+
+func csvValue(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ``
+	case []byte:
+		return string(x)
+	case string:
+		return x
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	case bool:
+		return strconv.FormatBool(x)
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+// ExportCSV writes the rows of the named query to w as CSV as they are read, after a header of the columns deformatted
+// as c says, flushing every FlushEveryRows rows. It stops when ctx is done, the rows written are kept.
+func ExportCSV(ctx context.Context, e sqlx.QueryerContext, driverName string, c DXIdentifierCase, query string, arg any, w io.Writer,
+	o CSVOptions) (rowCount int64, err error) {
+	s, args, err := PositionalQuery(driverName, query, arg)
+	if err != nil {
+		return 0, err
+	}
+	ctx, done := StartPositionalQueryWithArgs(ctx, e, driverName, s, args, arg)
+	defer func() {
+		err = done(err)
+	}()
+	rows, err := e.QueryxContext(ctx, s, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if o.IsBOM {
+		_, err = io.WriteString(w, "\uFEFF")
+		if err != nil {
+			return 0, err
+		}
+	}
+	cw := csv.NewWriter(w)
+	if o.Delimiter != 0 {
+		cw.Comma = o.Delimiter
+	}
+	flushEveryRows := o.FlushEveryRows
+	if flushEveryRows <= 0 {
+		flushEveryRows = DefaultCSVFlushEveryRows
+	}
+	record := make([]string, len(columns))
+	for i, v := range columns {
+		record[i] = DeformatIdentifier(c, v)
+	}
+	err = cw.Write(record)
+	if err != nil {
+		return 0, err
+	}
+	var values []any
+	for rows.Next() {
+		err = ctx.Err()
+		if err != nil {
+			return rowCount, err
+		}
+		values, err = rows.SliceScan()
+		if err != nil {
+			return rowCount, err
+		}
+		for i, v := range values {
+			record[i] = csvValue(v)
+		}
+		err = cw.Write(record)
+		if err != nil {
+			return rowCount, err
+		}
+		rowCount++
+		if rowCount%int64(flushEveryRows) == 0 {
+			err = flushCSV(cw, w)
+			if err != nil {
+				return rowCount, err
+			}
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return rowCount, err
+	}
+	return rowCount, flushCSV(cw, w)
+}
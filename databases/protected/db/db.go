@@ -1,11 +1,16 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 
 	"dxlib/v3/utils"
 )
@@ -17,7 +22,7 @@ func MergeMapExcludeSQLExpression(m1 utils.JSON, m2 utils.JSON) (r utils.JSON) {
 		case SQLExpression:
 			break
 		default:
-			r[k] = v
+			r[k] = PrepareArgValue(v)
 		}
 	}
 	for k, v := range m2 {
@@ -25,7 +30,7 @@ func MergeMapExcludeSQLExpression(m1 utils.JSON, m2 utils.JSON) (r utils.JSON) {
 		case SQLExpression:
 			break
 		default:
-			r[k] = v
+			r[k] = PrepareArgValue(v)
 		}
 	}
 	return r
@@ -38,7 +43,7 @@ func ExcludeSQLExpression(kv utils.JSON) (r utils.JSON) {
 		case SQLExpression:
 			break
 		default:
-			r[k] = v
+			r[k] = PrepareArgValue(v)
 		}
 	}
 	return r
@@ -59,6 +64,44 @@ func (se SQLExpression) String() (s string) {
 	return s
 }
 
+// SortedKeys gives the keys of kv in order, so the generated SQL is the same for the same keyValues.
+func SortedKeys[V any](kv map[string]V) (keys []string) {
+	keys = make([]string, 0, len(kv))
+	for k := range kv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CheckFieldNameCollisions fails when two keys of keyValues name the same field once deformatted, like "Name" and
+// "name" that postgres folds to the same column, instead of letting one of them silently win. The keys of the
+// SQLExpression values are only labels and are not checked. With IdentifierCasePreserve they are distinct fields.
+func CheckFieldNameCollisions(identifierCase DXIdentifierCase, keyValues utils.JSON) (err error) {
+	fieldNames := map[string]string{}
+	for _, k := range SortedKeys(keyValues) {
+		if _, ok := keyValues[k].(SQLExpression); ok {
+			continue
+		}
+		fieldName := DeformatIdentifier(identifierCase, k)
+		other, ok := fieldNames[fieldName]
+		if ok {
+			return fmt.Errorf("FieldNameCollision:%s,%s", other, k)
+		}
+		fieldNames[fieldName] = k
+	}
+	return nil
+}
+
+// CheckUpdateFieldNameCollisions checks the set and the where apart, the same field is expected in both.
+func CheckUpdateFieldNameCollisions(identifierCase DXIdentifierCase, setKeyValues utils.JSON, whereKeyValues utils.JSON) (err error) {
+	err = CheckFieldNameCollisions(identifierCase, setKeyValues)
+	if err != nil {
+		return err
+	}
+	return CheckFieldNameCollisions(identifierCase, whereKeyValues)
+}
+
 func SQLPartFieldNames(fieldNames []string) (s string) {
 	showFieldNames := ``
 	if fieldNames == nil {
@@ -75,7 +118,8 @@ func SQLPartFieldNames(fieldNames []string) (s string) {
 
 func SQLPartWhereAndFieldNameValues(whereKeyValues utils.JSON) (s string) {
 	andFieldNameValues := ``
-	for k, v := range whereKeyValues {
+	for _, k := range SortedKeys(whereKeyValues) {
+		v := whereKeyValues[k]
 		if andFieldNameValues != `` {
 			andFieldNameValues = andFieldNameValues + ` and `
 		}
@@ -95,7 +139,8 @@ func SQLPartWhereAndFieldNameValues(whereKeyValues utils.JSON) (s string) {
 
 func SQLPartOrderByFieldNameDirections(orderbyKeyValues map[string]string) (s string) {
 	orderbyFieldNameDirections := ``
-	for k, v := range orderbyKeyValues {
+	for _, k := range SortedKeys(orderbyKeyValues) {
+		v := orderbyKeyValues[k]
 		if orderbyFieldNameDirections != `` {
 			orderbyFieldNameDirections = orderbyFieldNameDirections + `, `
 		}
@@ -107,7 +152,8 @@ func SQLPartOrderByFieldNameDirections(orderbyKeyValues map[string]string) (s st
 func SQLPartSetFieldNameValues(setKeyValues utils.JSON) (newSetKeyValues utils.JSON, s string) {
 	setFieldNameValues := ``
 	newSetKeyValues = utils.JSON{}
-	for k, v := range setKeyValues {
+	for _, k := range SortedKeys(setKeyValues) {
+		v := setKeyValues[k]
 		if setFieldNameValues != `` {
 			setFieldNameValues = setFieldNameValues + `,`
 		}
@@ -124,7 +170,8 @@ func SQLPartSetFieldNameValues(setKeyValues utils.JSON) (newSetKeyValues utils.J
 }
 
 func SQLPartInsertFieldNamesFieldValues(insertKeyValues utils.JSON) (fieldNames string, fieldValues string) {
-	for k, v := range insertKeyValues {
+	for _, k := range SortedKeys(insertKeyValues) {
+		v := insertKeyValues[k]
 		if fieldNames != `` {
 			fieldNames = fieldNames + `,`
 		}
@@ -142,8 +189,12 @@ func SQLPartInsertFieldNamesFieldValues(insertKeyValues utils.JSON) (fieldNames
 	return fieldNames, fieldValues
 }
 
-func SQLPartConstructSelect(driverName string, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
+func SQLPartConstructSelect(driverName string, identifierCase DXIdentifierCase, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
 	orderbyFieldNameDirections map[string]string, limit any, forUpdatePart any) (s string, err error) {
+	err = CheckFieldNameCollisions(identifierCase, whereAndFieldNameValues)
+	if err != nil {
+		return ``, err
+	}
 	switch driverName {
 	case "sqlserver":
 		f := SQLPartFieldNames(fieldNames)
@@ -243,8 +294,34 @@ func SQLPartConstructSelect(driverName string, tableName string, fieldNames []st
 	}
 }
 
+// PositionalQuery renders the :name parameters of query as the positional bind vars of the driver ($1, $2 ... for postgres)
+// and returns the plain args in the same order, so no named or prepared statement is needed.
+func PositionalQuery(driverName string, query string, arg any) (s string, args []any, err error) {
+	switch v := arg.(type) {
+	case nil:
+		arg = utils.JSON{}
+	case utils.JSON:
+		arg = PrepareDriverArgs(driverName, v)
+	}
+	s, args, err = sqlx.Named(query, arg)
+	if err != nil {
+		return ``, nil, err
+	}
+	s = sqlx.Rebind(sqlx.BindType(driverName), s)
+	return s, args, nil
+}
+
 func NamedQueryRow(db *sqlx.DB, query string, arg any) (r utils.JSON, err error) {
-	rows, err := db.NamedQuery(query, arg)
+	return NamedQueryRowExt(context.Background(), db, query, arg)
+}
+
+// NamedQueryRowExt, like the other Ext functions, works on both *sqlx.DB and *sqlx.Tx and aborts its query once ctx is
+// done, the driver cancelling it on the server.
+func NamedQueryRowExt(ctx context.Context, e sqlx.ExtContext, query string, arg any) (r utils.JSON, err error) {
+	arg = CoerceArgs(e.DriverName(), arg)
+	ctx, done := StartQueryWithArgs(ctx, e, e.DriverName(), query, arg)
+	rows, err := sqlx.NamedQueryContext(ctx, e, query, arg)
+	err = done(err)
 	if err != nil {
 		return nil, err
 	}
@@ -259,11 +336,16 @@ func NamedQueryRow(db *sqlx.DB, query string, arg any) (r utils.JSON, err error)
 		}
 		return rowJSON, nil
 	}
-	return nil, nil
+	// a query aborted by ctx ends the rows early, only rows.Err tells it from no row
+	return nil, rows.Err()
 }
 
 func NamedQueryRowMustExist(db *sqlx.DB, query string, args any) (r utils.JSON, err error) {
-	r, err = NamedQueryRow(db, query, args)
+	return NamedQueryRowMustExistExt(context.Background(), db, query, args)
+}
+
+func NamedQueryRowMustExistExt(ctx context.Context, e sqlx.ExtContext, query string, args any) (r utils.JSON, err error) {
+	r, err = NamedQueryRowExt(ctx, e, query, args)
 	if err != nil {
 		return nil, err
 	}
@@ -275,7 +357,14 @@ func NamedQueryRowMustExist(db *sqlx.DB, query string, args any) (r utils.JSON,
 }
 
 func NamedQueryIdMustExist(dbAppInstance *sqlx.DB, query string, arg any) (int64, error) {
-	rows, err := dbAppInstance.NamedQuery(query, arg)
+	return NamedQueryIdMustExistExt(context.Background(), dbAppInstance, query, arg)
+}
+
+func NamedQueryIdMustExistExt(ctx context.Context, e sqlx.ExtContext, query string, arg any) (int64, error) {
+	arg = CoerceArgs(e.DriverName(), arg)
+	ctx, done := StartQueryWithArgs(ctx, e, e.DriverName(), query, arg)
+	rows, err := sqlx.NamedQueryContext(ctx, e, query, arg)
+	err = done(err)
 	if err != nil {
 		return 0, err
 	}
@@ -290,19 +379,29 @@ func NamedQueryIdMustExist(dbAppInstance *sqlx.DB, query string, arg any) (int64
 			return 0, err
 		}
 	} else {
-		err := errors.New(`QueryReturnEmpty`)
+		err := rows.Err()
+		if err == nil {
+			err = errors.New(`QueryReturnEmpty`)
+		}
 		return 0, err
 	}
 	return returningId, nil
 }
 
 func NamedQueryRows(dbAppInstance *sqlx.DB, query string, arg any) (r []utils.JSON, err error) {
+	return NamedQueryRowsExt(context.Background(), dbAppInstance, query, arg)
+}
+
+func NamedQueryRowsExt(ctx context.Context, e sqlx.ExtContext, query string, arg any) (r []utils.JSON, err error) {
 	r = []utils.JSON{}
 	if arg == nil {
 		arg = utils.JSON{}
 	}
 
-	rows, err := dbAppInstance.NamedQuery(query, arg)
+	arg = CoerceArgs(e.DriverName(), arg)
+	ctx, done := StartQueryWithArgs(ctx, e, e.DriverName(), query, arg)
+	rows, err := sqlx.NamedQueryContext(ctx, e, query, arg)
+	err = done(err)
 	if err != nil {
 		return nil, err
 	}
@@ -317,12 +416,22 @@ func NamedQueryRows(dbAppInstance *sqlx.DB, query string, arg any) (r []utils.JS
 		}
 		r = append(r, rowJSON)
 	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
 	return r, nil
 }
 
 func QueryRows(dbAppInstance *sqlx.DB, query string, arg any) (r []utils.JSON, err error) {
+	return QueryRowsExt(context.Background(), dbAppInstance, query, arg)
+}
+
+func QueryRowsExt(ctx context.Context, e sqlx.ExtContext, query string, arg any) (r []utils.JSON, err error) {
 	r = []utils.JSON{}
-	rows, err := dbAppInstance.Queryx(query, arg)
+	ctx, done := StartQuery(ctx, e, e.DriverName(), query)
+	rows, err := e.QueryxContext(ctx, query, arg)
+	done(err)
 	if err != nil {
 		return nil, err
 	}
@@ -337,10 +446,63 @@ func QueryRows(dbAppInstance *sqlx.DB, query string, arg any) (r []utils.JSON, e
 		}
 		r = append(r, rowJSON)
 	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
 	return r, nil
 }
 
+// ErrStopQueryStream ends QueryStream early without an error when returned by the row callback.
+var ErrStopQueryStream = errors.New("StopQueryStream")
+
+type QueryStreamRowFunc func(row utils.JSON) (err error)
+
+// QueryStream calls onRow for every row of the named query as it is read, so the result is never held in memory. The
+// rows are closed, and the connection given back to the pool, when the callback fails, stops or ctx is done.
+func QueryStream(ctx context.Context, e sqlx.QueryerContext, driverName string, query string, arg any, onRow QueryStreamRowFunc) (err error) {
+	s, args, err := PositionalQuery(driverName, query, arg)
+	if err != nil {
+		return err
+	}
+	ctx, done := StartPositionalQueryWithArgs(ctx, e, driverName, s, args, arg)
+	defer func() {
+		err = done(err)
+	}()
+	rows, err := e.QueryxContext(ctx, s, args...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for rows.Next() {
+		err = ctx.Err()
+		if err != nil {
+			return err
+		}
+		rowJSON := make(utils.JSON)
+		err = rows.MapScan(rowJSON)
+		if err != nil {
+			return err
+		}
+		err = onRow(rowJSON)
+		if errors.Is(err, ErrStopQueryStream) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
 func NamedQueryPaging(dbAppInstance *sqlx.DB, summaryCalcFieldsPart string, rowsPerPage int64, pageIndex int64, returnFieldsQueryPart string, fromQueryPart string, whereQueryPart string, joinQueryPart string, orderByQueryPart string,
+	arg any) (rows []utils.JSON, totalRows int64, totalPage int64, summaryRows utils.JSON, err error) {
+	return NamedQueryPagingExt(context.Background(), dbAppInstance, summaryCalcFieldsPart, rowsPerPage, pageIndex, returnFieldsQueryPart, fromQueryPart, whereQueryPart, joinQueryPart, orderByQueryPart, arg)
+}
+
+func NamedQueryPagingExt(ctx context.Context, e sqlx.ExtContext, summaryCalcFieldsPart string, rowsPerPage int64, pageIndex int64, returnFieldsQueryPart string, fromQueryPart string, whereQueryPart string, joinQueryPart string, orderByQueryPart string,
 	arg any) (rows []utils.JSON, totalRows int64, totalPage int64, summaryRows utils.JSON, err error) {
 	if returnFieldsQueryPart == `` {
 		returnFieldsQueryPart = `*`
@@ -360,7 +522,7 @@ func NamedQueryPaging(dbAppInstance *sqlx.DB, summaryCalcFieldsPart string, rows
 		summaryCalcFields = summaryCalcFields + `,` + summaryCalcFieldsPart
 	}
 	countSQL := `select ` + summaryCalcFields + ` from ` + fromQueryPart + effectiveWhereQueryPart + effectiveJoinQueryPart
-	summaryRows, err = NamedQueryRowMustExist(dbAppInstance, countSQL, arg)
+	summaryRows, err = NamedQueryRowMustExistExt(ctx, e, countSQL, arg)
 	if err != nil {
 		return nil, 0, 0, nil, err
 	}
@@ -368,7 +530,7 @@ func NamedQueryPaging(dbAppInstance *sqlx.DB, summaryCalcFieldsPart string, rows
 	totalRows = summaryRows[`_total_rows`].(int64)
 
 	query := ``
-	switch dbAppInstance.DriverName() {
+	switch e.DriverName() {
 	case "sqlserver":
 		effectiveLimitQueryPart := ``
 		if rowsPerPage == 0 {
@@ -405,7 +567,7 @@ func NamedQueryPaging(dbAppInstance *sqlx.DB, summaryCalcFieldsPart string, rows
 		query = `select ` + returnFieldsQueryPart + ` from ` + fromQueryPart + effectiveWhereQueryPart + effectiveOrderByQueryPart + effectiveLimitQueryPart
 	}
 
-	rows, err = NamedQueryRows(dbAppInstance, query, arg)
+	rows, err = NamedQueryRowsExt(ctx, e, query, arg)
 	if err != nil {
 		return nil, 0, 0, summaryRows, err
 	}
@@ -413,6 +575,11 @@ func NamedQueryPaging(dbAppInstance *sqlx.DB, summaryCalcFieldsPart string, rows
 }
 
 func QueryPaging(dbAppInstance *sqlx.DB, rowsPerPage int64, pageIndex int64, returnFieldsQueryPart string, fromQueryPart string, whereQueryPart string, joinQueryPart string, orderByQueryPart string,
+	arg any) (rows []utils.JSON, totalRows int64, totalPage int64, err error) {
+	return QueryPagingExt(context.Background(), dbAppInstance, rowsPerPage, pageIndex, returnFieldsQueryPart, fromQueryPart, whereQueryPart, joinQueryPart, orderByQueryPart, arg)
+}
+
+func QueryPagingExt(ctx context.Context, e sqlx.ExtContext, rowsPerPage int64, pageIndex int64, returnFieldsQueryPart string, fromQueryPart string, whereQueryPart string, joinQueryPart string, orderByQueryPart string,
 	arg any) (rows []utils.JSON, totalRows int64, totalPage int64, err error) {
 	if returnFieldsQueryPart == `` {
 		returnFieldsQueryPart = `*`
@@ -428,7 +595,7 @@ func QueryPaging(dbAppInstance *sqlx.DB, rowsPerPage int64, pageIndex int64, ret
 	}
 
 	countSQL := `SELECT COUNT(*) FROM ` + fromQueryPart + effectiveWhereQueryPart + effectiveJoinQueryPart
-	totalRows, err = NamedQueryIdMustExist(dbAppInstance, countSQL, arg)
+	totalRows, err = NamedQueryIdMustExistExt(ctx, e, countSQL, arg)
 	if err != nil {
 		return nil, 0, 0, err
 	}
@@ -447,7 +614,7 @@ func QueryPaging(dbAppInstance *sqlx.DB, rowsPerPage int64, pageIndex int64, ret
 	}
 
 	query := `select ` + returnFieldsQueryPart + ` from ` + fromQueryPart + effectiveWhereQueryPart + effectiveOrderByQueryPart + effectiveLimitQueryPart
-	rows, err = QueryRows(dbAppInstance, query, arg)
+	rows, err = QueryRowsExt(ctx, e, query, arg)
 	if err != nil {
 		return nil, 0, 0, err
 	}
@@ -455,7 +622,11 @@ func QueryPaging(dbAppInstance *sqlx.DB, rowsPerPage int64, pageIndex int64, ret
 }
 
 func SelectWhereIdMustExist(db *sqlx.DB, tableName string, idValue int64) (r utils.JSON, err error) {
-	r, err = NamedQueryRowMustExist(db, `SELECT * FROM `+tableName+` where id=:id`, utils.JSON{
+	return SelectWhereIdMustExistExt(context.Background(), db, tableName, idValue)
+}
+
+func SelectWhereIdMustExistExt(ctx context.Context, e sqlx.ExtContext, tableName string, idValue int64) (r utils.JSON, err error) {
+	r, err = NamedQueryRowMustExistExt(ctx, e, `SELECT * FROM `+tableName+` where id=:id`, utils.JSON{
 		`id`: idValue,
 	})
 	return r, err
@@ -463,18 +634,28 @@ func SelectWhereIdMustExist(db *sqlx.DB, tableName string, idValue int64) (r uti
 
 func SelectOne(db *sqlx.DB, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
 	orderbyFieldNameDirections map[string]string) (r utils.JSON, err error) {
-	s, err := SQLPartConstructSelect(db.DriverName(), tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, 1, nil)
+	return SelectOneExt(context.Background(), db, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections)
+}
+
+func SelectOneExt(ctx context.Context, e sqlx.ExtContext, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
+	orderbyFieldNameDirections map[string]string) (r utils.JSON, err error) {
+	s, err := SQLPartConstructSelect(e.DriverName(), IdentifierCaseOf(e), tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, 1, nil)
 	if err != nil {
 		return nil, err
 	}
 	wKV := ExcludeSQLExpression(whereAndFieldNameValues)
-	r, err = NamedQueryRow(db, s, wKV)
+	r, err = NamedQueryRowExt(ctx, e, s, wKV)
 	return r, err
 }
 
 func SelectOneMustExist(db *sqlx.DB, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
 	orderbyFieldNameDirections map[string]string) (r utils.JSON, err error) {
-	r, err = SelectOne(db, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections)
+	return SelectOneMustExistExt(context.Background(), db, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections)
+}
+
+func SelectOneMustExistExt(ctx context.Context, e sqlx.ExtContext, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
+	orderbyFieldNameDirections map[string]string) (r utils.JSON, err error) {
+	r, err = SelectOneExt(ctx, e, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections)
 	if err != nil {
 		return nil, err
 	}
@@ -487,36 +668,71 @@ func SelectOneMustExist(db *sqlx.DB, tableName string, fieldNames []string, wher
 
 func Select(db *sqlx.DB, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any, orderbyFieldNameDirections map[string]string,
 	limit any) (r []utils.JSON, err error) {
-	s, err := SQLPartConstructSelect(db.DriverName(), tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, limit, nil)
+	return SelectExt(context.Background(), db, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, limit)
+}
+
+func SelectExt(ctx context.Context, e sqlx.ExtContext, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any, orderbyFieldNameDirections map[string]string,
+	limit any) (r []utils.JSON, err error) {
+	s, err := SQLPartConstructSelect(e.DriverName(), IdentifierCaseOf(e), tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, limit, nil)
 	if err != nil {
 		return nil, err
 	}
 	wKV := ExcludeSQLExpression(whereAndFieldNameValues)
-	r, err = NamedQueryRows(db, s, wKV)
+	r, err = NamedQueryRowsExt(ctx, e, s, wKV)
 	return r, err
 }
 
 func DeleteWhereKeyValues(db *sqlx.DB, tableName string, whereAndFieldNameValues utils.JSON) (r sql.Result, err error) {
+	return DeleteWhereKeyValuesExt(context.Background(), db, tableName, whereAndFieldNameValues)
+}
+
+func DeleteWhereKeyValuesExt(ctx context.Context, e sqlx.ExtContext, tableName string, whereAndFieldNameValues utils.JSON) (r sql.Result, err error) {
+	err = CheckFieldNameCollisions(IdentifierCaseOf(e), whereAndFieldNameValues)
+	if err != nil {
+		return nil, err
+	}
 	w := SQLPartWhereAndFieldNameValues(whereAndFieldNameValues)
 	s := `DELETE FROM ` + tableName + ` where ` + w
 	wKV := ExcludeSQLExpression(whereAndFieldNameValues)
-	r, err = db.NamedExec(s, wKV)
+	wKV = coerceJSONArgs(e.DriverName(), wKV)
+	ctx, done := StartQueryWithArgs(ctx, e, e.DriverName(), s, wKV)
+	r, err = sqlx.NamedExecContext(ctx, e, s, wKV)
+	err = done(err)
 	return r, err
 }
 
 func UpdateWhereKeyValues(db *sqlx.DB, tableName string, setKeyValues utils.JSON, whereKeyValues utils.JSON) (result sql.Result, err error) {
+	return UpdateWhereKeyValuesExt(context.Background(), db, tableName, setKeyValues, whereKeyValues)
+}
+
+func UpdateWhereKeyValuesExt(ctx context.Context, e sqlx.ExtContext, tableName string, setKeyValues utils.JSON, whereKeyValues utils.JSON) (result sql.Result, err error) {
+	err = CheckUpdateFieldNameCollisions(IdentifierCaseOf(e), setKeyValues, whereKeyValues)
+	if err != nil {
+		return nil, err
+	}
 	setKeyValues, u := SQLPartSetFieldNameValues(setKeyValues)
 	w := SQLPartWhereAndFieldNameValues(whereKeyValues)
 	joinedKeyValues := MergeMapExcludeSQLExpression(setKeyValues, whereKeyValues)
 	s := `update ` + tableName + ` set ` + u + ` where ` + w
-	result, err = db.NamedExec(s, joinedKeyValues)
+	joinedKeyValues = coerceJSONArgs(e.DriverName(), joinedKeyValues)
+	ctx, done := StartQueryWithArgs(ctx, e, e.DriverName(), s, joinedKeyValues)
+	result, err = sqlx.NamedExecContext(ctx, e, s, joinedKeyValues)
+	err = done(err)
 	return result, err
 }
 
 func Insert(db *sqlx.DB, tableName string, keyValues utils.JSON) (id int64, err error) {
+	return InsertExt(context.Background(), db, tableName, keyValues)
+}
+
+func InsertExt(ctx context.Context, e sqlx.ExtContext, tableName string, keyValues utils.JSON) (id int64, err error) {
+	err = CheckFieldNameCollisions(IdentifierCaseOf(e), keyValues)
+	if err != nil {
+		return 0, err
+	}
 	fn, fv := SQLPartInsertFieldNamesFieldValues(keyValues)
 	s := ``
-	switch db.DriverName() {
+	switch e.DriverName() {
 	case "postgres":
 		s = `INSERT INTO ` + tableName + ` (` + fn + `) VALUES (` + fv + `) RETURNING id`
 	case "sqlserver":
@@ -526,6 +742,268 @@ func Insert(db *sqlx.DB, tableName string, keyValues utils.JSON) (id int64, err
 		s = `INSERT INTO ` + tableName + ` (` + fn + `) values (` + fv + `) returning id`
 	}
 	kv := ExcludeSQLExpression(keyValues)
-	id, err = NamedQueryIdMustExist(db, s, kv)
+	id, err = NamedQueryIdMustExistExt(ctx, e, s, kv)
 	return id, err
 }
+
+// SQLInsertReturning builds the insert of keyValues that gives back idFieldName, isReturning is true when the id comes back
+// as a row (postgres RETURNING, sqlserver OUTPUT) and false when it comes from LastInsertId (mysql).
+func SQLInsertReturning(driverName string, identifierCase DXIdentifierCase, tableName string, keyValues utils.JSON, idFieldName string) (s string, isReturning bool, err error) {
+	err = CheckFieldNameCollisions(identifierCase, keyValues)
+	if err != nil {
+		return ``, false, err
+	}
+	fn, fv := SQLPartInsertFieldNamesFieldValues(keyValues)
+	switch driverName {
+	case "postgres":
+		s = `INSERT INTO ` + tableName + ` (` + fn + `) VALUES (` + fv + `) RETURNING ` + idFieldName
+		return s, true, nil
+	case "sqlserver":
+		s = `INSERT INTO ` + tableName + ` (` + fn + `) OUTPUT INSERTED.` + idFieldName + ` VALUES (` + fv + `)`
+		return s, true, nil
+	case "mysql":
+		s = `INSERT INTO ` + tableName + ` (` + fn + `) VALUES (` + fv + `)`
+		return s, false, nil
+	default:
+		err = fmt.Errorf("InsertIdNotSupportedForDriver:%s", driverName)
+		return ``, false, err
+	}
+}
+
+// InsertReturningIdExt works on both *sqlx.DB and *sqlx.Tx.
+func InsertReturningIdExt(ctx context.Context, e sqlx.ExtContext, tableName string, keyValues utils.JSON, idFieldName string) (id int64, rowsAffected int64, err error) {
+	s, isReturning, err := SQLInsertReturning(e.DriverName(), IdentifierCaseOf(e), tableName, keyValues, idFieldName)
+	if err != nil {
+		return 0, 0, err
+	}
+	kv := ExcludeSQLExpression(keyValues)
+	kv = coerceJSONArgs(e.DriverName(), kv)
+	ctx, done := StartQueryWithArgs(ctx, e, e.DriverName(), s, kv)
+	defer func() {
+		err = done(err)
+	}()
+	if !isReturning {
+		r, err := sqlx.NamedExecContext(ctx, e, s, kv)
+		if err != nil {
+			return 0, 0, err
+		}
+		rowsAffected, err = r.RowsAffected()
+		if err != nil {
+			return 0, 0, err
+		}
+		id, err = r.LastInsertId()
+		if err != nil {
+			return 0, rowsAffected, err
+		}
+		return id, rowsAffected, nil
+	}
+	rows, err := sqlx.NamedQueryContext(ctx, e, s, kv)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for rows.Next() {
+		if rowsAffected == 0 {
+			err = rows.Scan(&id)
+			if err != nil {
+				return 0, 0, err
+			}
+		}
+		rowsAffected++
+	}
+	err = rows.Err()
+	if err != nil {
+		return 0, 0, err
+	}
+	if rowsAffected == 0 {
+		err = errors.New(`QueryReturnEmpty`)
+		return 0, 0, err
+	}
+	return id, rowsAffected, nil
+}
+
+// InsertRowsAffectedExt works on both *sqlx.DB and *sqlx.Tx, for every driver.
+func InsertRowsAffectedExt(ctx context.Context, e sqlx.ExtContext, tableName string, keyValues utils.JSON) (rowsAffected int64, err error) {
+	err = CheckFieldNameCollisions(IdentifierCaseOf(e), keyValues)
+	if err != nil {
+		return 0, err
+	}
+	fn, fv := SQLPartInsertFieldNamesFieldValues(keyValues)
+	s := `INSERT INTO ` + tableName + ` (` + fn + `) VALUES (` + fv + `)`
+	kv := ExcludeSQLExpression(keyValues)
+	kv = coerceJSONArgs(e.DriverName(), kv)
+	ctx, done := StartQueryWithArgs(ctx, e, e.DriverName(), s, kv)
+	r, err := sqlx.NamedExecContext(ctx, e, s, kv)
+	err = done(err)
+	if err != nil {
+		return 0, err
+	}
+	return r.RowsAffected()
+}
+
+func InsertReturningId(db *sqlx.DB, tableName string, keyValues utils.JSON, idFieldName string) (id int64, rowsAffected int64, err error) {
+	return InsertReturningIdExt(context.Background(), db, tableName, keyValues, idFieldName)
+}
+
+func InsertRowsAffected(db *sqlx.DB, tableName string, keyValues utils.JSON) (rowsAffected int64, err error) {
+	return InsertRowsAffectedExt(context.Background(), db, tableName, keyValues)
+}
+
+var structMapper = reflectx.NewMapperTagFunc("db", strings.ToLower, strings.ToLower)
+
+// SelectStructs runs the named query and scans every row into T, matching the deformatted column names with the db tags
+// (or the lower cased field names) of T. No match gives an empty slice, not nil.
+func SelectStructs[T any](db *sqlx.DB, query string, args utils.JSON, driverName string) (r []T, err error) {
+	return SelectStructsExt[T](context.Background(), db, query, args, driverName)
+}
+
+func SelectStructsExt[T any](ctx context.Context, e sqlx.ExtContext, query string, args utils.JSON, driverName string) (r []T, err error) {
+	r = []T{}
+	if driverName == `` {
+		driverName = e.DriverName()
+	}
+	s, a, err := PositionalQuery(driverName, query, args)
+	if err != nil {
+		return nil, err
+	}
+	ctx, done := StartPositionalQueryWithArgs(ctx, e, driverName, s, a, args)
+	defer func() {
+		err = done(err)
+	}()
+	rows, err := e.QueryxContext(ctx, s, a...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	for i := range columns {
+		// the struct fields are matched case insensitively, whatever the identifier case of the connection
+		columns[i] = DeformatIdentifier(IdentifierCaseLower, columns[i])
+	}
+	var t T
+	tType := reflect.TypeOf(t)
+	if tType == nil || tType.Kind() != reflect.Struct {
+		err = fmt.Errorf("SelectStructsNeedStructType:%v", tType)
+		return nil, err
+	}
+	traversals := structMapper.TraversalsByName(tType, columns)
+	for i, traversal := range traversals {
+		if len(traversal) == 0 {
+			err = fmt.Errorf("SelectStructsMissingDestination:%s", columns[i])
+			return nil, err
+		}
+	}
+	for rows.Next() {
+		var v T
+		vv := reflect.ValueOf(&v).Elem()
+		values := make([]any, len(columns))
+		for i, traversal := range traversals {
+			values[i] = reflectx.FieldByIndexes(vv, traversal).Addr().Interface()
+		}
+		err = rows.Scan(values...)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, v)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+type PaginateResult struct {
+	Rows       []utils.JSON
+	Total      int64
+	Page       int64
+	PageSize   int64
+	TotalPages int64
+}
+
+// SQLPartLimitOffset gives the paging clause of driverName, SQL Server and Oracle use OFFSET/FETCH, SQL Server only with
+// an ORDER BY in the query.
+func SQLPartLimitOffset(driverName string, limit int64, offset int64) (s string) {
+	if DriverCapabilities(driverName).IsPagingByOffsetFetch {
+		return ` OFFSET ` + strconv.FormatInt(offset, 10) + ` ROWS FETCH NEXT ` + strconv.FormatInt(limit, 10) + ` ROWS ONLY`
+	}
+	return ` LIMIT ` + strconv.FormatInt(limit, 10) + ` OFFSET ` + strconv.FormatInt(offset, 10)
+}
+
+// topLevelOrderByIndex is the position of the last ORDER BY that is not inside parentheses, or -1.
+func topLevelOrderByIndex(query string) int {
+	q := strings.ToLower(query)
+	i := strings.LastIndex(q, `order by`)
+	if i < 0 {
+		return -1
+	}
+	if strings.Count(q[i:], `(`) < strings.Count(q[i:], `)`) {
+		return -1
+	}
+	return i
+}
+
+// paginateQueries gives the COUNT(*) query of all the rows of query and the query of its page, of pageSize rows, on
+// driverName. A SQL Server query without an ORDER BY is ordered by (SELECT NULL), any order, another driver needing one
+// is an error.
+func paginateQueries(driverName string, query string, page int64, pageSize int64) (countQuery string, pagedQuery string, err error) {
+	countQuery = query
+	orderByIndex := topLevelOrderByIndex(query)
+	if orderByIndex >= 0 {
+		countQuery = query[:orderByIndex]
+	}
+	countQuery = `SELECT COUNT(*) FROM (` + countQuery + `) paginate_count`
+	pagedQuery = query
+	if orderByIndex < 0 && DriverCapabilities(driverName).IsPagingOrderByRequired {
+		if driverName != `sqlserver` {
+			err = fmt.Errorf("PaginateOrderByRequired:%s", driverName)
+			return ``, ``, err
+		}
+		pagedQuery = pagedQuery + ` ORDER BY (SELECT NULL)`
+	}
+	pagedQuery = pagedQuery + SQLPartLimitOffset(driverName, pageSize, (page-1)*pageSize)
+	return countQuery, pagedQuery, nil
+}
+
+// Paginate runs query for page (starting at 1) of pageSize rows and counts all the rows of query with a wrapped COUNT(*).
+func Paginate(db *sqlx.DB, query string, args utils.JSON, page int64, pageSize int64) (r *PaginateResult, err error) {
+	return PaginateExt(context.Background(), db, query, args, page, pageSize)
+}
+
+func PaginateExt(ctx context.Context, e sqlx.ExtContext, query string, args utils.JSON, page int64, pageSize int64) (r *PaginateResult, err error) {
+	if pageSize <= 0 {
+		err = fmt.Errorf("PaginateInvalidPageSize:%d", pageSize)
+		return nil, err
+	}
+	if page < 1 {
+		err = fmt.Errorf("PaginateInvalidPage:%d", page)
+		return nil, err
+	}
+	countQuery, pagedQuery, err := paginateQueries(e.DriverName(), query, page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	total, err := NamedQueryIdMustExistExt(ctx, e, countQuery, args)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := NamedQueryRowsExt(ctx, e, pagedQuery, args)
+	if err != nil {
+		return nil, err
+	}
+	r = &PaginateResult{
+		Rows:       rows,
+		Total:      total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: (total + pageSize - 1) / pageSize,
+	}
+	return r, nil
+}
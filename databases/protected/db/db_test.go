@@ -0,0 +1,305 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/utils"
+)
+
+// newTestSQLite gives a sqlite database on which statements were run, closed at the end of the test.
+func newTestSQLite(t *testing.T, statements ...string) *sqlx.DB {
+	t.Helper()
+	connection, err := sqlx.Open(`sqlite`, filepath.Join(t.TempDir(), `test.db`))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = connection.Close()
+	})
+	for _, v := range statements {
+		_, err = connection.Exec(v)
+		require.NoError(t, err)
+	}
+	return connection
+}
+
+func TestPositionalQuery(t *testing.T) {
+	query := `SELECT * FROM users WHERE name = :name AND (org_id = :org_id OR parent_org_id = :org_id) AND age > :age`
+	arg := utils.JSON{`age`: 18, `name`: `alice`, `org_id`: int64(7)}
+	for _, tt := range []struct {
+		driverName string
+		s          string
+	}{
+		{`postgres`, `SELECT * FROM users WHERE name = $1 AND (org_id = $2 OR parent_org_id = $3) AND age > $4`},
+		{`mysql`, `SELECT * FROM users WHERE name = ? AND (org_id = ? OR parent_org_id = ?) AND age > ?`},
+		{`sqlserver`, `SELECT * FROM users WHERE name = @p1 AND (org_id = @p2 OR parent_org_id = @p3) AND age > @p4`},
+	} {
+		t.Run(tt.driverName, func(t *testing.T) {
+			s, args, err := PositionalQuery(tt.driverName, query, arg)
+			require.NoError(t, err)
+			assert.Equal(t, tt.s, s)
+			// in the order of the placeholders, a repeated name given once per use, none as a sql.NamedArg
+			assert.Equal(t, []any{`alice`, int64(7), int64(7), 18}, args)
+		})
+	}
+}
+
+func TestPositionalQueryPreparesTheArgs(t *testing.T) {
+	var name *string
+	s, args, err := PositionalQuery(`postgres`, `UPDATE users SET name = :name, tags = :tags`, utils.JSON{
+		`name`: name,
+		`tags`: map[string]any{`a`: 1},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `UPDATE users SET name = $1, tags = $2`, s)
+	require.Len(t, args, 2)
+	assert.Nil(t, args[0])
+	assert.Equal(t, JSONColumn[any]{V: map[string]any{`a`: 1}}, args[1])
+
+	_, _, err = PositionalQuery(`postgres`, `SELECT :missing`, utils.JSON{})
+	assert.Error(t, err)
+	s, args, err = PositionalQuery(`postgres`, `SELECT 1`, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT 1`, s)
+	assert.Empty(t, args)
+}
+
+type testUser struct {
+	Id       int64  `db:"id"`
+	UserName string `db:"user_name"`
+	Note     *string
+}
+
+func TestSelectStructs(t *testing.T) {
+	connection := newTestSQLite(t,
+		`CREATE TABLE users (id INTEGER, user_name TEXT, note TEXT)`,
+		`INSERT INTO users VALUES (1, 'alice', NULL), (2, 'bob', 'b'), (3, 'carol', NULL)`)
+
+	// the columns are matched whatever their case, like the upper case of oracle
+	r, err := SelectStructs[testUser](connection, `SELECT id AS ID, user_name AS "USER_NAME", note AS Note FROM users WHERE id >= :id ORDER BY id`,
+		utils.JSON{`id`: 2}, ``)
+	require.NoError(t, err)
+	note := `b`
+	assert.Equal(t, []testUser{{Id: 2, UserName: `bob`, Note: &note}, {Id: 3, UserName: `carol`}}, r)
+
+	r, err = SelectStructs[testUser](connection, `SELECT id, user_name FROM users WHERE id > :id`, utils.JSON{`id`: 3}, `sqlite`)
+	require.NoError(t, err)
+	assert.NotNil(t, r)
+	assert.Empty(t, r)
+
+	_, err = SelectStructs[testUser](connection, `SELECT id, 1 AS unknown FROM users`, nil, ``)
+	assert.ErrorContains(t, err, `SelectStructsMissingDestination:unknown`)
+	_, err = SelectStructs[int64](connection, `SELECT id FROM users`, nil, ``)
+	assert.ErrorContains(t, err, `SelectStructsNeedStructType:int64`)
+}
+
+func TestPaginateQueries(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		driverName string
+		query      string
+		count      string
+		paged      string
+	}{
+		{`postgres`, `postgres`, `SELECT id FROM users WHERE org_id = :org_id ORDER BY id`,
+			`SELECT COUNT(*) FROM (SELECT id FROM users WHERE org_id = $1 ) paginate_count`,
+			`SELECT id FROM users WHERE org_id = $1 ORDER BY id LIMIT 10 OFFSET 20`},
+		{`postgres without order`, `postgres`, `SELECT id FROM users WHERE org_id = :org_id`,
+			`SELECT COUNT(*) FROM (SELECT id FROM users WHERE org_id = $1) paginate_count`,
+			`SELECT id FROM users WHERE org_id = $1 LIMIT 10 OFFSET 20`},
+		{`sqlserver`, `sqlserver`, `SELECT id FROM users WHERE org_id = :org_id ORDER BY id`,
+			`SELECT COUNT(*) FROM (SELECT id FROM users WHERE org_id = @p1 ) paginate_count`,
+			`SELECT id FROM users WHERE org_id = @p1 ORDER BY id OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY`},
+		{`sqlserver without order`, `sqlserver`, `SELECT id FROM users WHERE org_id = :org_id`,
+			`SELECT COUNT(*) FROM (SELECT id FROM users WHERE org_id = @p1) paginate_count`,
+			`SELECT id FROM users WHERE org_id = @p1 ORDER BY (SELECT NULL) OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY`},
+		// the ORDER BY of a subquery is not the one of the query
+		{`sqlserver with order in a subquery`, `sqlserver`, `SELECT id FROM (SELECT TOP 5 id FROM users WHERE org_id = :org_id ORDER BY id) u`,
+			`SELECT COUNT(*) FROM (SELECT id FROM (SELECT TOP 5 id FROM users WHERE org_id = @p1 ORDER BY id) u) paginate_count`,
+			`SELECT id FROM (SELECT TOP 5 id FROM users WHERE org_id = @p1 ORDER BY id) u ORDER BY (SELECT NULL) OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			countQuery, pagedQuery, err := paginateQueries(tt.driverName, tt.query, 3, 10)
+			require.NoError(t, err)
+			s, args, err := PositionalQuery(tt.driverName, countQuery, utils.JSON{`org_id`: 7})
+			require.NoError(t, err)
+			assert.Equal(t, tt.count, s)
+			s, _, err = PositionalQuery(tt.driverName, pagedQuery, utils.JSON{`org_id`: 7})
+			require.NoError(t, err)
+			assert.Equal(t, tt.paged, s)
+			assert.Equal(t, []any{7}, args)
+		})
+	}
+}
+
+func TestPaginateQueriesNeedingAnOrderBy(t *testing.T) {
+	RegisterDriverCapabilities(DXDriverCapabilities{DriverName: `test`, IsPagingByOffsetFetch: true, IsPagingOrderByRequired: true})
+	t.Cleanup(func() {
+		driverCapabilitiesMutex.Lock()
+		delete(driverCapabilities, `test`)
+		driverCapabilitiesMutex.Unlock()
+	})
+
+	// (SELECT NULL) is of SQL Server only
+	_, _, err := paginateQueries(`test`, `SELECT id FROM users`, 1, 10)
+	assert.ErrorContains(t, err, `PaginateOrderByRequired:test`)
+	_, pagedQuery, err := paginateQueries(`test`, `SELECT id FROM users ORDER BY id`, 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT id FROM users ORDER BY id OFFSET 0 ROWS FETCH NEXT 10 ROWS ONLY`, pagedQuery)
+}
+
+func TestPaginate(t *testing.T) {
+	connection := newTestSQLite(t, `CREATE TABLE users (id INTEGER, org_id INTEGER)`,
+		`INSERT INTO users VALUES (1, 1), (2, 1), (3, 1), (4, 1), (5, 1), (6, 2)`)
+
+	r, err := Paginate(connection, `SELECT id FROM users WHERE org_id = :org_id ORDER BY id DESC`, utils.JSON{`org_id`: 1}, 2, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), r.Total)
+	assert.Equal(t, int64(3), r.TotalPages)
+	assert.Equal(t, int64(2), r.Page)
+	require.Len(t, r.Rows, 2)
+	assert.Equal(t, int64(3), r.Rows[0][`id`])
+	assert.Equal(t, int64(2), r.Rows[1][`id`])
+
+	r, err = Paginate(connection, `SELECT id FROM users WHERE org_id = :org_id`, utils.JSON{`org_id`: 1}, 4, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), r.Total)
+	assert.Empty(t, r.Rows)
+
+	_, err = Paginate(connection, `SELECT id FROM users`, nil, 1, 0)
+	assert.ErrorContains(t, err, `PaginateInvalidPageSize:0`)
+	_, err = Paginate(connection, `SELECT id FROM users`, nil, 0, 10)
+	assert.ErrorContains(t, err, `PaginateInvalidPage:0`)
+}
+
+func TestPaginateQueriesOracle(t *testing.T) {
+	// OFFSET/FETCH of oracle pages a query without an ORDER BY
+	_, pagedQuery, err := paginateQueries(`oracle`, `SELECT id FROM users`, 2, 10)
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT id FROM users OFFSET 10 ROWS FETCH NEXT 10 ROWS ONLY`, pagedQuery)
+}
+
+// newTestThousandRows gives a SQLite database whose table numbers holds the n of 1 to 1000.
+func newTestThousandRows(t *testing.T) *sqlx.DB {
+	t.Helper()
+	return newTestSQLite(t, `CREATE TABLE numbers (n INTEGER)`,
+		`WITH RECURSIVE s(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM s WHERE n < 1000) INSERT INTO numbers SELECT n FROM s`)
+}
+
+func TestQueryStreamOverAThousandRows(t *testing.T) {
+	connection := newTestThousandRows(t)
+
+	count, sum := 0, int64(0)
+	err := QueryStream(context.Background(), connection, `sqlite`, `SELECT n FROM numbers WHERE n >= :from ORDER BY n`,
+		utils.JSON{`from`: 1}, func(row utils.JSON) (err error) {
+			count++
+			assert.Equal(t, int64(count), row[`n`])
+			sum += row[`n`].(int64)
+			return nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, 1000, count)
+	assert.Equal(t, int64(500500), sum)
+	assert.Equal(t, 0, connection.Stats().InUse)
+}
+
+func TestQueryStreamClosesTheRowsWhenStoppedEarly(t *testing.T) {
+	connection := newTestThousandRows(t)
+	errFailed := errors.New(`failed`)
+
+	for _, tt := range []struct {
+		name     string
+		stop     error
+		expected error
+	}{
+		{`stopped`, ErrStopQueryStream, nil},
+		{`failed`, errFailed, errFailed},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			count := 0
+			err := QueryStream(context.Background(), connection, `sqlite`, `SELECT n FROM numbers ORDER BY n`, nil, func(row utils.JSON) (err error) {
+				count++
+				if count == 10 {
+					return tt.stop
+				}
+				return nil
+			})
+			if tt.expected == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.expected)
+			}
+			assert.Equal(t, 10, count)
+			assert.Equal(t, 0, connection.Stats().InUse)
+		})
+	}
+}
+
+func TestQueryStreamStopsWhenTheContextIsDone(t *testing.T) {
+	connection := newTestThousandRows(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	count := 0
+	err := QueryStream(ctx, connection, `sqlite`, `SELECT n FROM numbers ORDER BY n`, nil, func(row utils.JSON) (err error) {
+		count++
+		if count == 10 {
+			cancel()
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, count, 1000)
+	require.Eventually(t, func() bool {
+		return connection.Stats().InUse == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestNameAndNameCollideUnderPostgresQuoting(t *testing.T) {
+	keyValues := utils.JSON{`Name`: `a`, `name`: `b`, `id`: 1}
+	for _, c := range []DXIdentifierCase{IdentifierCaseDefault, IdentifierCaseLower, IdentifierCaseUpper} {
+		assert.EqualError(t, CheckFieldNameCollisions(c, keyValues), `FieldNameCollision:Name,name`, c)
+	}
+	assert.NoError(t, CheckFieldNameCollisions(IdentifierCasePreserve, keyValues))
+	assert.NotEqual(t, FormatIdentifier(`postgres`, IdentifierCasePreserve, `Name`), FormatIdentifier(`postgres`, IdentifierCasePreserve, `name`))
+
+	_, err := SQLPartConstructSelect(`postgres`, IdentifierCaseDefault, `users`, nil, keyValues, nil, nil, nil, nil)
+	assert.EqualError(t, err, `FieldNameCollision:Name,name`)
+	err = CheckUpdateFieldNameCollisions(IdentifierCaseDefault, utils.JSON{`name`: `a`}, keyValues)
+	assert.EqualError(t, err, `FieldNameCollision:Name,name`)
+	// the same field in the set and the where is expected
+	assert.NoError(t, CheckUpdateFieldNameCollisions(IdentifierCaseDefault, utils.JSON{`Name`: `a`}, utils.JSON{`name`: `b`}))
+	// the keys of the SQL expressions are labels
+	assert.NoError(t, CheckFieldNameCollisions(IdentifierCaseDefault, utils.JSON{`name`: `a`, `Name`: SQLExpression{Expression: `name=name`}}))
+
+	connection := newTestSQLite(t, `CREATE TABLE users (id INTEGER, name TEXT)`)
+	_, err = InsertRowsAffected(connection, `users`, keyValues)
+	assert.EqualError(t, err, `FieldNameCollision:Name,name`)
+	n := 0
+	require.NoError(t, connection.Get(&n, `SELECT COUNT(*) FROM users`))
+	assert.Equal(t, 0, n)
+}
+
+func TestGeneratedSQLIsSorted(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		s, err := SQLPartConstructSelect(`postgres`, IdentifierCaseDefault, `users`, []string{`id`, `name`},
+			utils.JSON{`org_id`: 1, `name`: `a`, `deleted_at`: nil, `age`: SQLExpression{Expression: `age>18`}}, nil,
+			map[string]string{`name`: `asc`, `id`: `desc`}, 10, nil)
+		require.NoError(t, err)
+		assert.Equal(t, `select id, name from users where age>18 and deleted_at is null  and name=:name and org_id=:org_id order by id desc, name asc limit 10`, s)
+
+		kv, set := SQLPartSetFieldNameValues(utils.JSON{`b`: 1, `a`: 2, `c`: SQLExpression{Expression: `c=c+1`}})
+		assert.Equal(t, `a=:NEW_a,b=:NEW_b,c=c+1`, set)
+		assert.Equal(t, utils.JSON{`NEW_a`: 2, `NEW_b`: 1, `c`: SQLExpression{Expression: `c=c+1`}}, kv)
+
+		fieldNames, fieldValues := SQLPartInsertFieldNamesFieldValues(utils.JSON{`b`: 1, `a`: 2, `c`: SQLExpression{Expression: `now()`}})
+		assert.Equal(t, `a,b,c`, fieldNames)
+		assert.Equal(t, `:a,:b,now()`, fieldValues)
+	}
+}
@@ -0,0 +1,386 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"dxlib/v3/utils"
+)
+
+// DXColumnInfo is a column of a table as the catalog of the database gives it, Name deformatted with the identifier
+// case of the connection and DataType lower cased.
+type DXColumnInfo struct {
+	Name       string
+	DataType   string
+	IsNullable bool
+	// Default is the default expression of the column, nil when it has none
+	Default *string
+}
+
+func describeTableQuery(driverName string, schemaName string) (s string, err error) {
+	switch driverName {
+	case "postgres", "mysql", "sqlserver":
+		schemaPart := `:schema_name`
+		if schemaName == `` {
+			schemaPart = map[string]string{"postgres": `current_schema()`, "mysql": `database()`, "sqlserver": `schema_name()`}[driverName]
+		}
+		return `select column_name, data_type, is_nullable, column_default from information_schema.columns where table_schema = ` +
+			schemaPart + ` and table_name = :table_name order by ordinal_position`, nil
+	case "oracle":
+		schemaPart := `:schema_name`
+		if schemaName == `` {
+			schemaPart = `user`
+		}
+		return `select column_name, data_type, nullable, data_default from all_tab_columns where owner = ` + schemaPart +
+			` and table_name = :table_name order by column_id`, nil
+	default:
+		return ``, fmt.Errorf("DescribeTableNotSupported:%s", driverName)
+	}
+}
+
+// catalogTableArgs splits "schema.table" and cases both as FormatIdentifier writes them, for the queries of the catalog.
+func catalogTableArgs(identifierCase DXIdentifierCase, tableName string) (schemaName string, args utils.JSON) {
+	name := tableName
+	if i := strings.LastIndex(tableName, `.`); i >= 0 {
+		schemaName, name = tableName[:i], tableName[i+1:]
+	}
+	switch identifierCase {
+	case IdentifierCaseLower:
+		schemaName, name = strings.ToLower(schemaName), strings.ToLower(name)
+	case IdentifierCaseUpper:
+		schemaName, name = strings.ToUpper(schemaName), strings.ToUpper(name)
+	}
+	args = utils.JSON{`table_name`: name}
+	if schemaName != `` {
+		args[`schema_name`] = schemaName
+	}
+	return schemaName, args
+}
+
+// DescribeTable gives the columns of tableName, "schema.table" or a table of the current schema, in their order. The
+// names are matched as FormatIdentifier writes them, so a table no query of this package can reach is not found.
+func DescribeTable(db *sqlx.DB, tableName string, driverName string) (r []DXColumnInfo, err error) {
+	if driverName == `` {
+		driverName = db.DriverName()
+	}
+	identifierCase := IdentifierCaseOf(db)
+	schemaName, args := catalogTableArgs(identifierCase, tableName)
+	query, err := describeTableQuery(driverName, schemaName)
+	if err != nil {
+		return nil, err
+	}
+	s, a, err := PositionalQuery(driverName, query, args)
+	if err != nil {
+		return nil, err
+	}
+	ctx, done := StartQuery(context.Background(), db, driverName, s)
+	defer func() {
+		done(err)
+	}()
+	rows, err := db.QueryContext(ctx, s, a...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	r = []DXColumnInfo{}
+	for rows.Next() {
+		var columnName, dataType, isNullable string
+		var columnDefault sql.NullString
+		err = rows.Scan(&columnName, &dataType, &isNullable, &columnDefault)
+		if err != nil {
+			return nil, err
+		}
+		c := DXColumnInfo{
+			Name:       DeformatIdentifier(identifierCase, columnName),
+			DataType:   strings.ToLower(dataType),
+			IsNullable: strings.EqualFold(isNullable, `YES`) || strings.EqualFold(isNullable, `Y`),
+		}
+		if columnDefault.Valid {
+			c.Default = &columnDefault.String
+		}
+		r = append(r, c)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	if len(r) == 0 {
+		err = fmt.Errorf("TableNotFound:%s", tableName)
+		return nil, err
+	}
+	return r, nil
+}
+
+func primaryKeyQuery(driverName string, schemaName string) (s string, err error) {
+	switch driverName {
+	case "postgres", "mysql", "sqlserver":
+		schemaPart := `:schema_name`
+		if schemaName == `` {
+			schemaPart = map[string]string{"postgres": `current_schema()`, "mysql": `database()`, "sqlserver": `schema_name()`}[driverName]
+		}
+		return `select kcu.column_name from information_schema.table_constraints tc join information_schema.key_column_usage kcu` +
+			` on kcu.constraint_name = tc.constraint_name and kcu.table_schema = tc.table_schema and kcu.table_name = tc.table_name` +
+			` where tc.constraint_type = 'PRIMARY KEY' and tc.table_schema = ` + schemaPart + ` and tc.table_name = :table_name` +
+			` order by kcu.ordinal_position`, nil
+	case "oracle":
+		schemaPart := `:schema_name`
+		if schemaName == `` {
+			schemaPart = `user`
+		}
+		return `select cols.column_name from all_constraints cons join all_cons_columns cols on cols.owner = cons.owner and` +
+			` cols.constraint_name = cons.constraint_name where cons.constraint_type = 'P' and cons.owner = ` + schemaPart +
+			` and cons.table_name = :table_name order by cols.position`, nil
+	default:
+		return ``, fmt.Errorf("PrimaryKeyNotSupported:%s", driverName)
+	}
+}
+
+// PrimaryKeyColumns gives the columns of the primary key of tableName in their order, deformatted like DescribeTable.
+func PrimaryKeyColumns(db *sqlx.DB, tableName string, driverName string) (r []string, err error) {
+	if driverName == `` {
+		driverName = db.DriverName()
+	}
+	identifierCase := IdentifierCaseOf(db)
+	schemaName, args := catalogTableArgs(identifierCase, tableName)
+	query, err := primaryKeyQuery(driverName, schemaName)
+	if err != nil {
+		return nil, err
+	}
+	s, a, err := PositionalQuery(driverName, query, args)
+	if err != nil {
+		return nil, err
+	}
+	ctx, done := StartQuery(context.Background(), db, driverName, s)
+	defer func() {
+		done(err)
+	}()
+	rows, err := db.QueryContext(ctx, s, a...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for rows.Next() {
+		var columnName string
+		err = rows.Scan(&columnName)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, DeformatIdentifier(identifierCase, columnName))
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	if len(r) == 0 {
+		err = fmt.Errorf("PrimaryKeyNotFound:%s", tableName)
+		return nil, err
+	}
+	return r, nil
+}
+
+func referencedTablesQuery(driverName string, schemaName string) (s string, err error) {
+	switch driverName {
+	case "postgres", "mysql":
+		schemaPart := `:schema_name`
+		if schemaName == `` {
+			schemaPart = map[string]string{"postgres": `current_schema()`, "mysql": `database()`}[driverName]
+		}
+		if driverName == "mysql" {
+			return `select distinct referenced_table_name from information_schema.key_column_usage where table_schema = ` +
+				schemaPart + ` and table_name = :table_name and referenced_table_name is not null`, nil
+		}
+		return `select distinct ccu.table_name from information_schema.table_constraints tc join` +
+			` information_schema.constraint_column_usage ccu on ccu.constraint_name = tc.constraint_name and` +
+			` ccu.constraint_schema = tc.constraint_schema where tc.constraint_type = 'FOREIGN KEY' and tc.table_schema = ` +
+			schemaPart + ` and tc.table_name = :table_name`, nil
+	case "sqlserver":
+		objectPart := `:table_name`
+		if schemaName != `` {
+			objectPart = `:schema_name + '.' + :table_name`
+		}
+		return `select distinct object_name(referenced_object_id) from sys.foreign_keys where parent_object_id = object_id(` +
+			objectPart + `)`, nil
+	case "oracle":
+		schemaPart := `:schema_name`
+		if schemaName == `` {
+			schemaPart = `user`
+		}
+		return `select distinct r.table_name from all_constraints c join all_constraints r on r.owner = c.r_owner and` +
+			` r.constraint_name = c.r_constraint_name where c.constraint_type = 'R' and c.owner = ` + schemaPart +
+			` and c.table_name = :table_name`, nil
+	case "sqlite3", "sqlite":
+		return `select distinct "table" from pragma_foreign_key_list(:table_name)`, nil
+	default:
+		return ``, fmt.Errorf("ReferencedTablesNotSupported:%s", driverName)
+	}
+}
+
+// ReferencedTables gives the tables the foreign keys of tableName reference, deformatted like DescribeTable, a table
+// referencing itself included.
+func ReferencedTables(ctx context.Context, e sqlx.ExtContext, tableName string) (r []string, err error) {
+	driverName := e.DriverName()
+	identifierCase := IdentifierCaseOf(e)
+	schemaName, args := catalogTableArgs(identifierCase, tableName)
+	query, err := referencedTablesQuery(driverName, schemaName)
+	if err != nil {
+		return nil, err
+	}
+	s, a, err := PositionalQuery(driverName, query, args)
+	if err != nil {
+		return nil, err
+	}
+	ctx, done := StartQuery(ctx, e, driverName, s)
+	defer func() {
+		done(err)
+	}()
+	rows, err := e.QueryContext(ctx, s, a...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	r = []string{}
+	for rows.Next() {
+		var referencedTableName string
+		err = rows.Scan(&referencedTableName)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, DeformatIdentifier(identifierCase, referencedTableName))
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+type dxColumnKind int
+
+const (
+	columnKindAny dxColumnKind = iota
+	columnKindString
+	columnKindInteger
+	columnKindFloat
+	columnKindBool
+	columnKindTime
+	columnKindBytes
+)
+
+// columnKindOfDataType gives the kind of a catalog data type, the unknown ones are columnKindAny and match every field.
+func columnKindOfDataType(dataType string) dxColumnKind {
+	switch {
+	case dataType == `bit` || strings.HasPrefix(dataType, `bool`):
+		return columnKindBool
+	case strings.Contains(dataType, `int`) || strings.Contains(dataType, `serial`):
+		return columnKindInteger
+	case strings.HasPrefix(dataType, `num`) || strings.HasPrefix(dataType, `dec`) || strings.HasPrefix(dataType, `float`) ||
+		strings.HasPrefix(dataType, `double`) || dataType == `real` || strings.Contains(dataType, `money`):
+		return columnKindFloat
+	case strings.HasPrefix(dataType, `date`) || strings.HasPrefix(dataType, `time`):
+		return columnKindTime
+	case dataType == `bytea` || strings.Contains(dataType, `blob`) || strings.Contains(dataType, `binary`) || dataType == `raw`:
+		return columnKindBytes
+	case strings.Contains(dataType, `char`) || strings.Contains(dataType, `text`) || strings.Contains(dataType, `clob`) ||
+		strings.HasPrefix(dataType, `json`) || dataType == `uuid` || dataType == `uniqueidentifier` || dataType == `enum` ||
+		dataType == `xml`:
+		return columnKindString
+	default:
+		return columnKindAny
+	}
+}
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+// isFieldCompatible is true when a column of kind can be scanned into a field of type t. A string takes every column,
+// the Null types of database/sql are their value, the other sql.Scanner are trusted.
+func isFieldCompatible(t reflect.Type, kind dxColumnKind) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType, reflect.TypeOf(sql.NullTime{}):
+		return kind == columnKindTime || kind == columnKindAny
+	case reflect.TypeOf(sql.NullString{}):
+		return true
+	case reflect.TypeOf(sql.NullBool{}):
+		t = reflect.TypeOf(false)
+	case reflect.TypeOf(sql.NullFloat64{}):
+		t = reflect.TypeOf(float64(0))
+	case reflect.TypeOf(sql.NullInt64{}), reflect.TypeOf(sql.NullInt32{}), reflect.TypeOf(sql.NullInt16{}), reflect.TypeOf(sql.NullByte{}):
+		t = reflect.TypeOf(int64(0))
+	default:
+		if reflect.PointerTo(t).Implements(scannerType) {
+			return true
+		}
+	}
+	if kind == columnKindAny {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64:
+		return kind == columnKindInteger || kind == columnKindBool
+	case reflect.Float32, reflect.Float64:
+		return kind == columnKindFloat || kind == columnKindInteger
+	case reflect.Bool:
+		return kind == columnKindBool || kind == columnKindInteger
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8 && (kind == columnKindBytes || kind == columnKindString)
+	case reflect.Interface:
+		return true
+	default:
+		return false
+	}
+}
+
+// VerifyModel checks that every field of the struct model, named by its db tag or its lower cased name like
+// SelectStructs, is a column of columns whose type can be scanned into the field. It gives every mismatch, joined.
+func VerifyModel(tableName string, columns []DXColumnInfo, model any) (err error) {
+	t := reflect.TypeOf(model)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return fmt.Errorf("VerifyModelNeedStructType:%s:%v", tableName, t)
+	}
+	columnsByName := map[string]DXColumnInfo{}
+	for _, c := range columns {
+		// the struct fields are matched case insensitively, whatever the identifier case of the connection
+		columnsByName[DeformatIdentifier(IdentifierCaseLower, c.Name)] = c
+	}
+	var errs []error
+	for _, fi := range structMapper.TypeMap(t).Index {
+		// an embedded struct gives its fields, a struct field that is not a leaf only gives "field.child" names
+		if fi.Field.Anonymous || strings.Contains(fi.Path, `.`) || (fi.Field.Type.Kind() == reflect.Struct && !isLeafStruct(fi.Field.Type)) {
+			continue
+		}
+		c, ok := columnsByName[fi.Path]
+		if !ok {
+			errs = append(errs, fmt.Errorf("TableModelColumnMissing:%s:%s", tableName, fi.Path))
+			continue
+		}
+		if !isFieldCompatible(fi.Field.Type, columnKindOfDataType(c.DataType)) {
+			errs = append(errs, fmt.Errorf("TableModelColumnTypeMismatch:%s:%s:%v:%s", tableName, fi.Path, fi.Field.Type, c.DataType))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isLeafStruct is true for the struct types scanned as one column rather than flattened into their fields.
+func isLeafStruct(t reflect.Type) bool {
+	return t == timeType || reflect.PointerTo(t).Implements(scannerType)
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testDescribeModel struct {
+	Id        int64
+	Name      string
+	Email     sql.NullString `db:"email"`
+	CreatedAt time.Time      `db:"created_at"`
+	Score     float64
+}
+
+func newTestDescribeColumns() []DXColumnInfo {
+	return []DXColumnInfo{
+		{Name: `id`, DataType: `bigint`},
+		{Name: `name`, DataType: `character varying`},
+		{Name: `email`, DataType: `text`, IsNullable: true},
+		{Name: `created_at`, DataType: `timestamp with time zone`},
+		{Name: `score`, DataType: `numeric`},
+	}
+}
+
+func TestVerifyModelMatchesTheColumns(t *testing.T) {
+	assert.NoError(t, VerifyModel(`users`, newTestDescribeColumns(), testDescribeModel{}))
+	assert.NoError(t, VerifyModel(`users`, newTestDescribeColumns(), &testDescribeModel{}))
+}
+
+func TestVerifyModelGivesEveryMismatch(t *testing.T) {
+	columns := newTestDescribeColumns()
+	columns[0].DataType = `text`
+	err := VerifyModel(`users`, columns[:4], testDescribeModel{})
+	assert.ErrorContains(t, err, `TableModelColumnTypeMismatch:users:id:int64:text`)
+	assert.ErrorContains(t, err, `TableModelColumnMissing:users:score`)
+
+	assert.ErrorContains(t, VerifyModel(`users`, columns, 1), `VerifyModelNeedStructType:users`)
+}
+
+func TestDescribeTableNotSupported(t *testing.T) {
+	_, err := DescribeTable(newTestSQLite(t, `CREATE TABLE users (id INTEGER)`), `users`, ``)
+	assert.ErrorContains(t, err, `DescribeTableNotSupported:sqlite`)
+}
+
+// newTestPostgres gives a connection to DXLIB_TEST_POSTGRES_DSN after running statements, or skips.
+func newTestPostgres(t *testing.T, statements ...string) *sqlx.DB {
+	t.Helper()
+	dsn := os.Getenv(testPostgresDSN)
+	if dsn == `` {
+		t.Skip(testPostgresDSN + ` is not set`)
+	}
+	connection, err := sqlx.Open(`postgres`, dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = connection.Close()
+	})
+	for _, v := range statements {
+		_, err = connection.Exec(v)
+		require.NoError(t, err)
+	}
+	return connection
+}
+
+func TestDescribeTableOfPostgres(t *testing.T) {
+	connection := newTestPostgres(t, `DROP TABLE IF EXISTS describe_users`,
+		`CREATE TABLE describe_users (id BIGINT PRIMARY KEY, name VARCHAR(64) NOT NULL, email TEXT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(), score NUMERIC(10, 2) NOT NULL DEFAULT 0)`)
+	t.Cleanup(func() {
+		_, _ = connection.Exec(`DROP TABLE IF EXISTS describe_users`)
+	})
+
+	columns, err := DescribeTable(connection, `describe_users`, ``)
+	require.NoError(t, err)
+	require.Len(t, columns, 5)
+	assert.Equal(t, DXColumnInfo{Name: `id`, DataType: `bigint`}, columns[0])
+	assert.Equal(t, `character varying`, columns[1].DataType)
+	assert.True(t, columns[2].IsNullable)
+	require.NotNil(t, columns[3].Default)
+	assert.Equal(t, `now()`, *columns[3].Default)
+	assert.NoError(t, VerifyModel(`describe_users`, columns, testDescribeModel{}))
+
+	columns, err = DescribeTable(connection, `public.describe_users`, ``)
+	require.NoError(t, err)
+	assert.Len(t, columns, 5)
+	primaryKey, err := PrimaryKeyColumns(connection, `describe_users`, ``)
+	require.NoError(t, err)
+	assert.Equal(t, []string{`id`}, primaryKey)
+	_, err = DescribeTable(connection, `describe_missing`, ``)
+	assert.ErrorContains(t, err, `TableNotFound:describe_missing`)
+}
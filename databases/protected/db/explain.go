@@ -0,0 +1,190 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SlowQueryCaptureCapacity is how many of the last slow queries are kept for Explain.
+const SlowQueryCaptureCapacity = 100
+
+// IsDebug allows Explain with analyze, which executes the statement, the app sets it from its own IsDebug.
+var IsDebug bool
+
+var ErrExplainAnalyzeNotAllowed = errors.New("ExplainAnalyzeNotAllowed")
+
+// DXSlowQuery is a slow query as its log line shows it, Id is the #id of that line. Args has the values of the sensitive
+// columns masked, the values themselves are only kept for Explain.
+type DXSlowQuery struct {
+	Id         int64         `json:"id"`
+	DriverName string        `json:"driver_name"`
+	Statement  string        `json:"statement"`
+	Args       any           `json:"args,omitempty"`
+	Duration   time.Duration `json:"duration"`
+	At         time.Time     `json:"at"`
+	explainArg any
+}
+
+var slowQueries struct {
+	mutex  sync.Mutex
+	lastId int64
+	list   []DXSlowQuery
+}
+
+func captureSlowQuery(driverName string, statement string, arg any, explainArg any, duration time.Duration) (id int64) {
+	slowQueries.mutex.Lock()
+	defer slowQueries.mutex.Unlock()
+	slowQueries.lastId++
+	q := DXSlowQuery{
+		Id:         slowQueries.lastId,
+		DriverName: driverName,
+		Statement:  statement,
+		Args:       MaskArgs(arg),
+		Duration:   duration,
+		At:         time.Now(),
+		explainArg: explainArg,
+	}
+	if len(slowQueries.list) >= SlowQueryCaptureCapacity {
+		slowQueries.list = slowQueries.list[1:]
+	}
+	slowQueries.list = append(slowQueries.list, q)
+	return q.Id
+}
+
+// SlowQueries gives the captured slow queries, the last one first.
+func SlowQueries() (r []DXSlowQuery) {
+	slowQueries.mutex.Lock()
+	defer slowQueries.mutex.Unlock()
+	r = make([]DXSlowQuery, len(slowQueries.list))
+	for i, v := range slowQueries.list {
+		r[len(r)-1-i] = v
+	}
+	return r
+}
+
+// SlowQuery gives the captured slow query id, ok is false once it is not kept anymore.
+func SlowQuery(id int64) (q DXSlowQuery, ok bool) {
+	slowQueries.mutex.Lock()
+	defer slowQueries.mutex.Unlock()
+	for _, v := range slowQueries.list {
+		if v.Id == id {
+			return v, true
+		}
+	}
+	return DXSlowQuery{}, false
+}
+
+// ExplainPrefix is what makes a statement of the driver give its plan, analyze runs it to also give the actual rows
+// and timings. SQL Server and Oracle give their plans by other statements, they are not supported.
+func ExplainPrefix(driverName string, analyze bool) (prefix string, err error) {
+	switch driverName {
+	case "postgres":
+		if analyze {
+			return `EXPLAIN (ANALYZE, BUFFERS) `, nil
+		}
+		return `EXPLAIN `, nil
+	case "mysql":
+		if analyze {
+			return `EXPLAIN ANALYZE `, nil
+		}
+		return `EXPLAIN FORMAT=TREE `, nil
+	case "sqlite3", "sqlite":
+		if analyze {
+			return ``, fmt.Errorf("ExplainAnalyzeNotSupported:%s", driverName)
+		}
+		return `EXPLAIN QUERY PLAN `, nil
+	default:
+		return ``, fmt.Errorf("ExplainNotSupported:%s", driverName)
+	}
+}
+
+// Explain gives the plan of query as text, query has :name parameters bound from args, or positional ones when args is
+// a []any. analyze needs IsDebug since the statement is executed, on a *sqlx.DB it runs in a transaction rolled back
+// after, so a statement changing rows changes nothing.
+func Explain(ctx context.Context, e sqlx.ExtContext, query string, args any, analyze bool) (plan string, err error) {
+	if analyze && !IsDebug {
+		return ``, ErrExplainAnalyzeNotAllowed
+	}
+	driverName := e.DriverName()
+	prefix, err := ExplainPrefix(driverName, analyze)
+	if err != nil {
+		return ``, err
+	}
+	s := query
+	a, ok := args.([]any)
+	if !ok {
+		s, a, err = PositionalQuery(driverName, query, args)
+		if err != nil {
+			return ``, err
+		}
+	}
+	if analyze {
+		connection, ok := e.(*sqlx.DB)
+		if ok {
+			tx, err := connection.BeginTxx(ctx, nil)
+			if err != nil {
+				return ``, err
+			}
+			defer func() {
+				_ = tx.Rollback()
+			}()
+			e = tx
+		}
+	}
+	rows, err := e.QueryxContext(ctx, prefix+s, a...)
+	if err != nil {
+		return ``, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	columns, err := rows.Columns()
+	if err != nil {
+		return ``, err
+	}
+	lines := []string{}
+	if len(columns) > 1 {
+		lines = append(lines, strings.Join(columns, "\t"))
+	}
+	for rows.Next() {
+		values, err := rows.SliceScan()
+		if err != nil {
+			return ``, err
+		}
+		fields := make([]string, len(values))
+		for i, v := range values {
+			switch x := v.(type) {
+			case nil:
+				fields[i] = `NULL`
+			case []byte:
+				fields[i] = string(x)
+			default:
+				fields[i] = fmt.Sprint(x)
+			}
+		}
+		lines = append(lines, strings.Join(fields, "\t"))
+	}
+	err = rows.Err()
+	if err != nil {
+		return ``, err
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// ExplainSlowQuery is Explain of the captured slow query id with its own args, on e of the database it ran on.
+func ExplainSlowQuery(ctx context.Context, e sqlx.ExtContext, id int64, analyze bool) (plan string, err error) {
+	q, ok := SlowQuery(id)
+	if !ok {
+		return ``, fmt.Errorf("SlowQueryNotFound:%d", id)
+	}
+	if q.DriverName != e.DriverName() {
+		return ``, fmt.Errorf("SlowQueryOfOtherDriver:%d:%s", id, q.DriverName)
+	}
+	return Explain(ctx, e, q.Statement, q.explainArg, analyze)
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/utils"
+)
+
+// setTestIsDebug sets IsDebug to isDebug, restored at the end of the test.
+func setTestIsDebug(t *testing.T, isDebug bool) {
+	t.Helper()
+	old := IsDebug
+	IsDebug = isDebug
+	t.Cleanup(func() {
+		IsDebug = old
+	})
+}
+
+func TestExplainPrefix(t *testing.T) {
+	for _, tt := range []struct {
+		driverName string
+		analyze    bool
+		prefix     string
+		err        string
+	}{
+		{`postgres`, false, `EXPLAIN `, ``},
+		{`postgres`, true, `EXPLAIN (ANALYZE, BUFFERS) `, ``},
+		{`mysql`, false, `EXPLAIN FORMAT=TREE `, ``},
+		{`mysql`, true, `EXPLAIN ANALYZE `, ``},
+		{`sqlite`, false, `EXPLAIN QUERY PLAN `, ``},
+		{`sqlite`, true, ``, `ExplainAnalyzeNotSupported:sqlite`},
+		{`sqlserver`, false, ``, `ExplainNotSupported:sqlserver`},
+		{`oracle`, false, ``, `ExplainNotSupported:oracle`},
+	} {
+		t.Run(tt.driverName, func(t *testing.T) {
+			prefix, err := ExplainPrefix(tt.driverName, tt.analyze)
+			if tt.err != `` {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.prefix, prefix)
+		})
+	}
+}
+
+func TestExplainGivesThePlanOfSQLite(t *testing.T) {
+	setTestIsDebug(t, false)
+	connection := newTestSQLite(t, `CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)`,
+		`CREATE INDEX users_name ON users (name)`)
+
+	plan, err := Explain(context.Background(), connection, `SELECT id FROM users WHERE name = :name`,
+		utils.JSON{`name`: `alice`}, false)
+	require.NoError(t, err)
+	assert.Contains(t, plan, `users_name`)
+
+	plan, err = Explain(context.Background(), connection, `SELECT id FROM users WHERE id = ?`, []any{1}, false)
+	require.NoError(t, err)
+	assert.Contains(t, plan, `PRIMARY KEY`)
+
+	_, err = Explain(context.Background(), connection, `SELECT id FROM users`, nil, true)
+	assert.ErrorIs(t, err, ErrExplainAnalyzeNotAllowed)
+}
+
+func TestExplainSlowQuery(t *testing.T) {
+	connection := newTestSQLite(t, `CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)`)
+	id := captureSlowQuery(`sqlite`, `SELECT id FROM users WHERE name = :name`, utils.JSON{`name`: `alice`},
+		utils.JSON{`name`: `alice`}, time.Second)
+	otherId := captureSlowQuery(`postgres`, `SELECT 1`, nil, nil, time.Second)
+
+	q, ok := SlowQuery(id)
+	require.True(t, ok)
+	assert.Equal(t, `sqlite`, q.DriverName)
+	assert.Equal(t, otherId, SlowQueries()[0].Id)
+
+	plan, err := ExplainSlowQuery(context.Background(), connection, id, false)
+	require.NoError(t, err)
+	assert.Contains(t, plan, `users`)
+	_, err = ExplainSlowQuery(context.Background(), connection, otherId, false)
+	assert.ErrorContains(t, err, `SlowQueryOfOtherDriver`)
+	_, err = ExplainSlowQuery(context.Background(), connection, otherId+1, false)
+	assert.ErrorContains(t, err, `SlowQueryNotFound`)
+}
+
+func TestExplainAnalyzeOfPostgresChangesNothing(t *testing.T) {
+	connection := newTestPostgres(t, `DROP TABLE IF EXISTS explain_users`, `CREATE TABLE explain_users (name TEXT)`)
+	t.Cleanup(func() {
+		_, _ = connection.Exec(`DROP TABLE IF EXISTS explain_users`)
+	})
+	setTestIsDebug(t, true)
+
+	plan, err := Explain(context.Background(), connection, `INSERT INTO explain_users (name) VALUES (:name)`,
+		utils.JSON{`name`: `alice`}, true)
+	require.NoError(t, err)
+	assert.Contains(t, plan, `actual time`)
+	var n int
+	require.NoError(t, connection.Get(&n, `SELECT count(*) FROM explain_users`))
+	assert.Equal(t, 0, n)
+}
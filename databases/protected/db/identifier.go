@@ -0,0 +1,91 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+
+	"dxlib/v3/utils"
+)
+
+// DXIdentifierCase is how the identifiers of a connection are cased. The default formats them as given and folds them
+// to lower case when comparing, "preserve" never changes them, "lower" and "upper" fold both ways.
+type DXIdentifierCase string
+
+const (
+	IdentifierCaseDefault  DXIdentifierCase = ""
+	IdentifierCasePreserve DXIdentifierCase = "preserve"
+	IdentifierCaseLower    DXIdentifierCase = "lower"
+	IdentifierCaseUpper    DXIdentifierCase = "upper"
+)
+
+func ParseIdentifierCase(s string) (c DXIdentifierCase, err error) {
+	switch c = DXIdentifierCase(strings.ToLower(s)); c {
+	case IdentifierCaseDefault, IdentifierCasePreserve, IdentifierCaseLower, IdentifierCaseUpper:
+		return c, nil
+	default:
+		return IdentifierCaseDefault, fmt.Errorf("InvalidIdentifierCase:%s", s)
+	}
+}
+
+// identifierCases holds the identifier case of a *sqlx.DB, and of the *sqlx.Tx and *DXConn taken from it while tracked.
+var identifierCases sync.Map
+
+func SetIdentifierCase(connection *sqlx.DB, c DXIdentifierCase) {
+	identifierCases.Store(connection, c)
+}
+
+func RemoveIdentifierCase(connection *sqlx.DB) {
+	identifierCases.Delete(connection)
+}
+
+// IdentifierCaseOf gives the identifier case of e, a *sqlx.DB or a *sqlx.Tx.
+func IdentifierCaseOf(e any) DXIdentifierCase {
+	c, ok := identifierCases.Load(e)
+	if !ok {
+		return IdentifierCaseDefault
+	}
+	return c.(DXIdentifierCase)
+}
+
+// FormatIdentifier quotes a table or field name the way driverName expects it, after changing its case as c says.
+func FormatIdentifier(driverName string, c DXIdentifierCase, identifier string) string {
+	switch c {
+	case IdentifierCaseLower:
+		identifier = strings.ToLower(identifier)
+	case IdentifierCaseUpper:
+		identifier = strings.ToUpper(identifier)
+	}
+	capabilities := DriverCapabilities(driverName)
+	return capabilities.IdentifierQuoteOpen + identifier + capabilities.IdentifierQuoteClose
+}
+
+// DeformatIdentifier removes the quoting of an identifier and folds its case as c says, so columns compare equal whatever
+// the driver returns.
+func DeformatIdentifier(c DXIdentifierCase, identifier string) string {
+	identifier = strings.Trim(identifier, "\"`[]")
+	switch c {
+	case IdentifierCasePreserve:
+		return identifier
+	case IdentifierCaseUpper:
+		return strings.ToUpper(identifier)
+	default:
+		return strings.ToLower(identifier)
+	}
+}
+
+// DeformatKeys gives the keys of a row as the field names of n. With a naming strategy the case is the one of the
+// strategy instead of folded as c says.
+func DeformatKeys(c DXIdentifierCase, n DXNamingStrategy, kv utils.JSON) (r utils.JSON) {
+	r = utils.JSON{}
+	for k, v := range kv {
+		if n == NamingStrategyPassthrough {
+			r[DeformatIdentifier(c, k)] = v
+			continue
+		}
+		r[n.FromColumn(strings.Trim(k, "\"`[]"))] = v
+	}
+	return r
+}
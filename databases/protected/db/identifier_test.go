@@ -0,0 +1,47 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentifierCasePolicies(t *testing.T) {
+	for _, tt := range []struct {
+		c          DXIdentifierCase
+		formatted  string
+		deformated string
+	}{
+		{IdentifierCaseDefault, `"UserName"`, `username`},
+		{IdentifierCasePreserve, `"UserName"`, `UserName`},
+		{IdentifierCaseLower, `"username"`, `username`},
+		{IdentifierCaseUpper, `"USERNAME"`, `USERNAME`},
+	} {
+		t.Run(string(tt.c), func(t *testing.T) {
+			assert.Equal(t, tt.formatted, FormatIdentifier(`postgres`, tt.c, `UserName`))
+			assert.Equal(t, tt.deformated, DeformatIdentifier(tt.c, `"UserName"`))
+			c, err := ParseIdentifierCase(string(tt.c))
+			require.NoError(t, err)
+			assert.Equal(t, tt.c, c)
+		})
+	}
+	assert.Equal(t, "`USERNAME`", FormatIdentifier(`mysql`, IdentifierCaseUpper, `UserName`))
+	assert.Equal(t, `[UserName]`, FormatIdentifier(`sqlserver`, IdentifierCasePreserve, `UserName`))
+
+	c, err := ParseIdentifierCase(`UPPER`)
+	require.NoError(t, err)
+	assert.Equal(t, IdentifierCaseUpper, c)
+	_, err = ParseIdentifierCase(`title`)
+	assert.ErrorContains(t, err, `InvalidIdentifierCase:title`)
+}
+
+func TestIdentifierCaseOfAConnection(t *testing.T) {
+	connection := &sqlx.DB{}
+	assert.Equal(t, IdentifierCaseDefault, IdentifierCaseOf(connection))
+	SetIdentifierCase(connection, IdentifierCaseUpper)
+	assert.Equal(t, IdentifierCaseUpper, IdentifierCaseOf(connection))
+	RemoveIdentifierCase(connection)
+	assert.Equal(t, IdentifierCaseDefault, IdentifierCaseOf(connection))
+}
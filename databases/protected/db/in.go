@@ -0,0 +1,94 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+func isInArgValue(v any) bool {
+	if v == nil {
+		return false
+	}
+	t := reflect.TypeOf(v)
+	if t.Implements(driverValuerType) {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Slice:
+		return t.Elem().Kind() != reflect.Uint8
+	case reflect.Array:
+		return true
+	default:
+		return false
+	}
+}
+
+func inPredicateRegexp(name string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)([^\s(]+)\s+(not\s+)?in\s*\(\s*:` + regexp.QuoteMeta(name) + `\s*\)`)
+}
+
+// ExpandIn rewrites the `field IN (:name)` predicates of query whose arg is a slice. On the drivers with
+// SupportsArrayParams, postgres, it becomes `field = ANY(:name)` with the arg as a pq.Array, on the others :name is
+// expanded to :name_0, :name_1 ... one per value. An empty slice gives an always false predicate (always true for NOT
+// IN). The other args are kept as they are.
+func ExpandIn(query string, args map[string]any, driverName string) (r string, newArgs map[string]any, err error) {
+	isArrayParam := DriverCapabilities(driverName).SupportsArrayParams
+	newArgs = map[string]any{}
+	for k, v := range args {
+		newArgs[k] = v
+	}
+	for _, name := range SortedKeys(args) {
+		v := args[name]
+		if !isInArgValue(v) {
+			continue
+		}
+		re := inPredicateRegexp(name)
+		if !re.MatchString(query) {
+			continue
+		}
+		rv := reflect.ValueOf(v)
+		n := rv.Len()
+		elementNames := make([]string, n)
+		for i := 0; i < n; i++ {
+			elementNames[i] = name + `_` + strconv.Itoa(i)
+			if _, ok := args[elementNames[i]]; ok {
+				return ``, nil, fmt.Errorf("ExpandInArgNameCollision:%s", elementNames[i])
+			}
+		}
+		query = re.ReplaceAllStringFunc(query, func(predicate string) string {
+			m := re.FindStringSubmatch(predicate)
+			field, isNot := m[1], m[2] != ``
+			switch {
+			case n == 0 && isNot:
+				return `1=1`
+			case n == 0:
+				return `1=0`
+			case isArrayParam && isNot:
+				return field + ` <> ALL(:` + name + `)`
+			case isArrayParam:
+				return field + ` = ANY(:` + name + `)`
+			case isNot:
+				return field + ` NOT IN (:` + strings.Join(elementNames, `, :`) + `)`
+			default:
+				return field + ` IN (:` + strings.Join(elementNames, `, :`) + `)`
+			}
+		})
+		delete(newArgs, name)
+		if n == 0 {
+			continue
+		}
+		if isArrayParam {
+			newArgs[name] = pq.Array(v)
+			continue
+		}
+		for i := 0; i < n; i++ {
+			newArgs[elementNames[i]] = rv.Index(i).Interface()
+		}
+	}
+	return query, newArgs, nil
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandInPostgresAny(t *testing.T) {
+	ids := []int64{1, 2, 3}
+	q, args, err := ExpandIn(`SELECT * FROM users WHERE org_id = :org_id AND id IN (:ids) AND role NOT IN (:roles)`,
+		map[string]any{`org_id`: 7, `ids`: ids, `roles`: []string{`admin`}}, `postgres`)
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM users WHERE org_id = :org_id AND id = ANY(:ids) AND role <> ALL(:roles)`, q)
+	assert.Equal(t, map[string]any{`org_id`: 7, `ids`: pq.Array(ids), `roles`: pq.Array([]string{`admin`})}, args)
+}
+
+func TestExpandInMySQLThreeElements(t *testing.T) {
+	q, args, err := ExpandIn(`SELECT * FROM users WHERE org_id = :org_id AND id in ( :ids ) AND role NOT IN (:roles)`,
+		map[string]any{`org_id`: 7, `ids`: []int64{1, 2, 3}, `roles`: []string{`admin`}}, `mysql`)
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM users WHERE org_id = :org_id AND id IN (:ids_0, :ids_1, :ids_2) AND role NOT IN (:roles_0)`, q)
+	assert.Equal(t, map[string]any{`org_id`: 7, `ids_0`: int64(1), `ids_1`: int64(2), `ids_2`: int64(3), `roles_0`: `admin`}, args)
+
+	// the expanded query runs, sqlite binds the named args as mysql does
+	connection := newTestSQLite(t, `CREATE TABLE users (id INTEGER, org_id INTEGER, role TEXT)`,
+		`INSERT INTO users VALUES (1, 7, 'user'), (2, 7, 'admin'), (3, 7, 'user'), (4, 7, 'user'), (5, 8, 'user')`)
+	rows, err := NamedQueryRows(connection, `SELECT id FROM users WHERE org_id = :org_id AND id IN (:ids_0, :ids_1, :ids_2) AND role NOT IN (:roles_0) ORDER BY id`, args)
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, int64(1), rows[0][`id`])
+	assert.Equal(t, int64(3), rows[1][`id`])
+}
+
+func TestExpandInEmptySlice(t *testing.T) {
+	for _, driverName := range []string{`postgres`, `mysql`} {
+		t.Run(driverName, func(t *testing.T) {
+			q, args, err := ExpandIn(`SELECT * FROM users WHERE id IN (:ids) OR role NOT IN (:roles)`,
+				map[string]any{`ids`: []int64{}, `roles`: []string{}}, driverName)
+			require.NoError(t, err)
+			assert.Equal(t, `SELECT * FROM users WHERE 1=0 OR 1=1`, q)
+			assert.Empty(t, args)
+		})
+	}
+
+	connection := newTestSQLite(t, `CREATE TABLE users (id INTEGER)`, `INSERT INTO users VALUES (1), (2)`)
+	q, args, err := ExpandIn(`SELECT id FROM users WHERE id IN (:ids)`, map[string]any{`ids`: []int64{}}, `mysql`)
+	require.NoError(t, err)
+	rows, err := NamedQueryRows(connection, q, args)
+	require.NoError(t, err)
+	assert.Empty(t, rows)
+	q, args, err = ExpandIn(`SELECT id FROM users WHERE id NOT IN (:ids)`, map[string]any{`ids`: []int64{}}, `mysql`)
+	require.NoError(t, err)
+	rows, err = NamedQueryRows(connection, q, args)
+	require.NoError(t, err)
+	assert.Len(t, rows, 2)
+}
+
+func TestExpandInKeepsTheOtherArgs(t *testing.T) {
+	// a []byte is a value and a slice outside an IN is left alone
+	q, args, err := ExpandIn(`UPDATE files SET data = :data, tags = :tags WHERE id IN (:ids)`,
+		map[string]any{`data`: []byte(`x`), `tags`: []string{`a`}, `ids`: []int64{1}}, `mysql`)
+	require.NoError(t, err)
+	assert.Equal(t, `UPDATE files SET data = :data, tags = :tags WHERE id IN (:ids_0)`, q)
+	assert.Equal(t, map[string]any{`data`: []byte(`x`), `tags`: []string{`a`}, `ids_0`: int64(1)}, args)
+
+	_, _, err = ExpandIn(`SELECT * FROM users WHERE id IN (:ids)`, map[string]any{`ids`: []int64{1}, `ids_0`: 2}, `mysql`)
+	assert.EqualError(t, err, `ExpandInArgNameCollision:ids_0`)
+}
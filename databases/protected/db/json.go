@@ -0,0 +1,150 @@
+package db
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"dxlib/v3/utils"
+)
+
+// JSONColumn is a JSON/JSONB column value, on write V is marshalled and on scan the column is unmarshalled into V, so it
+// can be a field of the structs of SelectStructs.
+type JSONColumn[T any] struct {
+	V T
+}
+
+// AsJSON marks v to be written as JSON, for the values not detected by PrepareArgValue like a string holding a JSON text.
+func AsJSON(v any) JSONColumn[any] {
+	return JSONColumn[any]{V: v}
+}
+
+// Value is a string and not []byte, lib/pq would send a []byte as bytea.
+func (j JSONColumn[T]) Value() (driver.Value, error) {
+	b, err := json.Marshal(j.V)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (j *JSONColumn[T]) Scan(src any) (err error) {
+	switch v := src.(type) {
+	case nil:
+		var zero T
+		j.V = zero
+		return nil
+	case []byte:
+		return json.Unmarshal(v, &j.V)
+	case string:
+		return json.Unmarshal([]byte(v), &j.V)
+	default:
+		return fmt.Errorf("JSONColumnCanNotScan:%T", src)
+	}
+}
+
+var (
+	timeType         = reflect.TypeOf(time.Time{})
+	driverValuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
+// PrepareArgValue wraps a map, a slice, an array or a struct value as JSONColumn so it is written as JSON, []byte,
+// time.Time, SQLExpression and the driver.Valuer values, like pq.Array, are left as they are. A nil pointer is given as
+// nil, NULL, and another pointer as the value it points to. A value with a coercer of every driver is coerced, see
+// PrepareDriverArgValue for the coercers of a driver.
+func PrepareArgValue(v any) any {
+	return PrepareDriverArgValue(``, v)
+}
+
+// PrepareDriverArgValue is PrepareArgValue coercing v by its coercer of driverName first, see RegisterArgCoercer.
+func PrepareDriverArgValue(driverName string, v any) any {
+	if v == nil {
+		return nil
+	}
+	c, ok, isDeferred := coerceArgValue(driverName, v)
+	if ok {
+		return c
+	}
+	if isDeferred {
+		return v
+	}
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Pointer && reflect.ValueOf(v).IsNil() {
+		// a typed nil is not NULL for every driver, an untyped one is
+		return nil
+	}
+	if t.Implements(driverValuerType) {
+		return v
+	}
+	if t.Kind() == reflect.Pointer {
+		if t.Elem().Implements(driverValuerType) {
+			return v
+		}
+		return PrepareDriverArgValue(driverName, reflect.ValueOf(v).Elem().Interface())
+	}
+	switch t.Kind() {
+	case reflect.Map, reflect.Array:
+		return AsJSON(v)
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return v
+		}
+		return AsJSON(v)
+	case reflect.Struct:
+		if t == timeType || t == reflect.TypeOf(SQLExpression{}) {
+			return v
+		}
+		return AsJSON(v)
+	default:
+		return v
+	}
+}
+
+// EmptyStringsAsNull gives kv with its empty strings, and the pointers to one, as nil, for the calls writing a missing
+// text as NULL, like db.InsertExt(ctx, e, tableName, db.EmptyStringsAsNull(kv)).
+func EmptyStringsAsNull(kv utils.JSON) (r utils.JSON) {
+	r = make(utils.JSON, len(kv))
+	for k, v := range kv {
+		switch s := v.(type) {
+		case string:
+			if s == `` {
+				v = nil
+			}
+		case *string:
+			if s != nil && *s == `` {
+				v = nil
+			}
+		}
+		r[k] = v
+	}
+	return r
+}
+
+func PrepareArgs(kv utils.JSON) (r utils.JSON) {
+	return PrepareDriverArgs(``, kv)
+}
+
+func PrepareDriverArgs(driverName string, kv utils.JSON) (r utils.JSON) {
+	r = utils.JSON{}
+	for k, v := range kv {
+		r[k] = PrepareDriverArgValue(driverName, v)
+	}
+	return r
+}
+
+// UnmarshalJSONColumn decodes fieldName of a row read by the MapScan based functions, like NamedQueryRows, into a T.
+func UnmarshalJSONColumn[T any](row utils.JSON, fieldName string) (r T, err error) {
+	v, ok := row[fieldName]
+	if !ok {
+		err = fmt.Errorf("FieldNotFound:%s", fieldName)
+		return r, err
+	}
+	j := JSONColumn[T]{}
+	err = j.Scan(v)
+	if err != nil {
+		return r, err
+	}
+	return j.V, nil
+}
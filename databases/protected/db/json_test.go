@@ -0,0 +1,145 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/utils"
+)
+
+type testDocument struct {
+	Name    string            `json:"name"`
+	Tags    []string          `json:"tags"`
+	Address testAddress       `json:"address"`
+	Extra   map[string]any    `json:"extra"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+type testAddress struct {
+	City  string   `json:"city"`
+	Lines []string `json:"lines"`
+}
+
+func TestNestedJSONDocumentRoundTrip(t *testing.T) {
+	connection := newTestSQLite(t, `CREATE TABLE docs (id INTEGER, doc TEXT, raw TEXT, tags TEXT)`)
+	document := testDocument{
+		Name:    `alice`,
+		Tags:    []string{`a`, `b`},
+		Address: testAddress{City: `Jakarta`, Lines: []string{`Jl. Sudirman 1`, `Lt. 2`}},
+		Extra:   map[string]any{`level`: float64(3), `nested`: map[string]any{`ok`: true}},
+	}
+	_, err := InsertRowsAffected(connection, `docs`, utils.JSON{
+		`id`: 1,
+		// a struct, a value marked by AsJSON and a slice are all written as JSON
+		`doc`:  document,
+		`raw`:  AsJSON(map[string]any{`a`: []any{float64(1), `x`}}),
+		`tags`: []string{`x`, `y`},
+	})
+	require.NoError(t, err)
+
+	row, err := NamedQueryRow(connection, `SELECT doc, raw, tags FROM docs WHERE id = :id`, utils.JSON{`id`: 1})
+	require.NoError(t, err)
+	read, err := UnmarshalJSONColumn[testDocument](row, `doc`)
+	require.NoError(t, err)
+	assert.Equal(t, document, read)
+	raw, err := UnmarshalJSONColumn[map[string]any](row, `raw`)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{`a`: []any{float64(1), `x`}}, raw)
+	tags, err := UnmarshalJSONColumn[[]string](row, `tags`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{`x`, `y`}, tags)
+	_, err = UnmarshalJSONColumn[testDocument](row, `missing`)
+	assert.ErrorContains(t, err, `FieldNotFound:missing`)
+
+	type testDocumentRow struct {
+		Doc JSONColumn[testDocument] `db:"doc"`
+	}
+	rows, err := SelectStructs[testDocumentRow](connection, `SELECT doc FROM docs`, nil, ``)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, document, rows[0].Doc.V)
+}
+
+func TestJSONColumnScansNullAsTheZeroValue(t *testing.T) {
+	j := JSONColumn[testDocument]{V: testDocument{Name: `old`}}
+	require.NoError(t, j.Scan(nil))
+	assert.Equal(t, testDocument{}, j.V)
+	assert.ErrorContains(t, j.Scan(int64(1)), `JSONColumnCanNotScan:int64`)
+}
+
+func TestPrepareDriverArgValueOfNullsAndPointers(t *testing.T) {
+	text, empty, n := `text`, ``, 7
+	var missing *string
+	var missingValuer *sql.NullString
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, tt := range []struct {
+		name string
+		v    any
+		r    any
+	}{
+		{`nil`, nil, nil},
+		{`a nil pointer`, missing, nil},
+		{`a nil pointer of a valuer`, missingValuer, nil},
+		{`a pointer`, &text, `text`},
+		{`a pointer to an empty string`, &empty, ``},
+		{`a pointer to an int`, &n, 7},
+		{`a valuer`, sql.NullString{String: `x`, Valid: true}, sql.NullString{String: `x`, Valid: true}},
+		{`a time`, at, at},
+		{`a pointer to a time`, &at, at},
+		{`bytes`, []byte(`raw`), []byte(`raw`)},
+		{`a map`, map[string]any{`a`: 1}, AsJSON(map[string]any{`a`: 1})},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.r, PrepareDriverArgValue(`postgres`, tt.v))
+		})
+	}
+}
+
+func TestEmptyStringsAsNull(t *testing.T) {
+	text, empty := `text`, ``
+	var missing *string
+	r := EmptyStringsAsNull(utils.JSON{`empty`: ``, `empty_pointer`: &empty, `missing`: missing, `text`: `text`,
+		`text_pointer`: &text, `n`: 0})
+	assert.Nil(t, r[`empty`])
+	assert.Nil(t, r[`empty_pointer`])
+	assert.Equal(t, missing, r[`missing`])
+	assert.Equal(t, `text`, r[`text`])
+	assert.Equal(t, &text, r[`text_pointer`])
+	assert.Equal(t, 0, r[`n`])
+}
+
+func TestInsertOfNilAndNonNilPointers(t *testing.T) {
+	connection := newTestSQLite(t, `CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, nickname TEXT)`)
+	ctx := context.Background()
+	name, empty := `alice`, ``
+	var missing *string
+	for _, keyValues := range []utils.JSON{
+		{`id`: 1, `name`: &name, `nickname`: missing},
+		EmptyStringsAsNull(utils.JSON{`id`: 2, `name`: &empty, `nickname`: ``}),
+		{`id`: 3, `name`: &empty, `nickname`: ``},
+	} {
+		query, args, err := BuildInsert(`users`, keyValues, `sqlite`, IdentifierCaseDefault)
+		require.NoError(t, err)
+		_, err = connection.ExecContext(ctx, query, args...)
+		require.NoError(t, err)
+	}
+
+	var rows []struct {
+		Name     sql.NullString `db:"name"`
+		Nickname sql.NullString `db:"nickname"`
+	}
+	require.NoError(t, connection.Select(&rows, `SELECT name, nickname FROM users ORDER BY id`))
+	require.Len(t, rows, 3)
+	assert.Equal(t, sql.NullString{String: `alice`, Valid: true}, rows[0].Name)
+	assert.False(t, rows[0].Nickname.Valid)
+	assert.False(t, rows[1].Name.Valid)
+	assert.False(t, rows[1].Nickname.Valid)
+	// without EmptyStringsAsNull, an empty string is kept
+	assert.Equal(t, sql.NullString{Valid: true}, rows[2].Name)
+	assert.Equal(t, sql.NullString{Valid: true}, rows[2].Nickname)
+}
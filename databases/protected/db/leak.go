@@ -0,0 +1,92 @@
+package db
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"dxlib/v3/log"
+)
+
+const DefaultHeldConnectionThreshold = 30 * time.Second
+
+// HeldConnectionThreshold is how long a connection may be held before HeldConnections gives it by default.
+var HeldConnectionThreshold = DefaultHeldConnectionThreshold
+
+// DXHeldConnection is a connection or a transaction taken from a pool and not given back yet, Stack is where it was
+// taken. They are only recorded while IsDebug.
+type DXHeldConnection struct {
+	Id         int64         `json:"id"`
+	Kind       string        `json:"kind"`
+	DriverName string        `json:"driver_name"`
+	At         time.Time     `json:"at"`
+	HeldFor    time.Duration `json:"held_for"`
+	Stack      string        `json:"stack"`
+}
+
+var (
+	heldConnections      sync.Map
+	heldConnectionLastId atomic.Int64
+)
+
+// holdConnection records e as held when IsDebug, release forgets it.
+func holdConnection(e any, connection *sqlx.DB) (release func()) {
+	if !IsDebug {
+		return func() {}
+	}
+	kind := `conn`
+	if _, ok := e.(*sqlx.Tx); ok {
+		kind = `tx`
+	}
+	heldConnections.Store(e, DXHeldConnection{
+		Id:         heldConnectionLastId.Add(1),
+		Kind:       kind,
+		DriverName: connection.DriverName(),
+		At:         time.Now(),
+		Stack:      string(debug.Stack()),
+	})
+	return func() {
+		heldConnections.Delete(e)
+	}
+}
+
+// HeldConnections gives the connections and transactions held for longer than olderThan, the oldest first.
+func HeldConnections(olderThan time.Duration) (r []DXHeldConnection) {
+	r = []DXHeldConnection{}
+	heldConnections.Range(func(_, v any) bool {
+		h := v.(DXHeldConnection)
+		h.HeldFor = time.Since(h.At)
+		if h.HeldFor > olderThan {
+			r = append(r, h)
+		}
+		return true
+	})
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].Id < r[j].Id
+	})
+	return r
+}
+
+// WatchLeak warns when obj is garbage collected while still open, with the stack where e, the connection or the
+// transaction of obj, was taken. closeLeaked is called then, it closes obj and gives whether it was still open. It
+// does nothing unless IsDebug.
+func WatchLeak[T any](obj *T, e any, kind string, closeLeaked func(obj *T) (isOpen bool)) {
+	if !IsDebug {
+		return
+	}
+	stack := ``
+	v, ok := heldConnections.Load(e)
+	if ok {
+		stack = v.(DXHeldConnection).Stack
+	}
+	runtime.SetFinalizer(obj, func(obj *T) {
+		if closeLeaked(obj) {
+			log.Log.Warnf("Leaked %s, garbage collected without being closed, it was taken at:\n%s", kind, stack)
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"dxlib/v3/utils"
+)
+
+// DXNamingStrategy is how the field names of the application map to the columns. "snake" keeps the columns in
+// snake_case for the camelCase fields, like firstName and first_name, "camel" keeps them in camelCase for the snake_case
+// fields, and the default, "passthrough", uses the field names as the columns.
+type DXNamingStrategy string
+
+const (
+	NamingStrategyPassthrough DXNamingStrategy = ""
+	NamingStrategySnake       DXNamingStrategy = "snake"
+	NamingStrategyCamel       DXNamingStrategy = "camel"
+)
+
+func ParseNamingStrategy(s string) (n DXNamingStrategy, err error) {
+	switch n = DXNamingStrategy(strings.ToLower(s)); n {
+	case NamingStrategyPassthrough, NamingStrategySnake, NamingStrategyCamel:
+		return n, nil
+	case "passthrough":
+		return NamingStrategyPassthrough, nil
+	default:
+		return NamingStrategyPassthrough, fmt.Errorf("InvalidNamingStrategy:%s", s)
+	}
+}
+
+// plainIdentifierRegex matches the names the strategies convert, a field optionally qualified by its table, so the
+// expressions like "count(*) as n" are kept as given.
+var plainIdentifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// SnakeCase converts a camelCase identifier, an acronym is kept as one word: userID and HTTPServer are user_id and
+// http_server.
+func SnakeCase(identifier string) string {
+	if !plainIdentifierRegex.MatchString(identifier) {
+		return identifier
+	}
+	r := []rune(identifier)
+	var b strings.Builder
+	for i, c := range r {
+		if unicode.IsUpper(c) && i > 0 && r[i-1] != '_' && r[i-1] != '.' {
+			isAfterLower := unicode.IsLower(r[i-1]) || unicode.IsDigit(r[i-1])
+			isAcronymEnd := unicode.IsUpper(r[i-1]) && i+1 < len(r) && unicode.IsLower(r[i+1])
+			if isAfterLower || isAcronymEnd {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(c))
+	}
+	return b.String()
+}
+
+// CamelCase converts a snake_case identifier, first_name is firstName, the case of the other letters is kept.
+func CamelCase(identifier string) string {
+	if !plainIdentifierRegex.MatchString(identifier) {
+		return identifier
+	}
+	var b strings.Builder
+	isUpperNext := false
+	for i, c := range identifier {
+		switch {
+		case c == '_' && i > 0 && identifier[i-1] != '.':
+			isUpperNext = true
+		case isUpperNext:
+			b.WriteRune(unicode.ToUpper(c))
+			isUpperNext = false
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// ToColumn gives the column of a field name.
+func (n DXNamingStrategy) ToColumn(fieldName string) string {
+	switch n {
+	case NamingStrategySnake:
+		return SnakeCase(fieldName)
+	case NamingStrategyCamel:
+		return CamelCase(fieldName)
+	default:
+		return fieldName
+	}
+}
+
+// FromColumn gives the field name of a column, the inverse of ToColumn.
+func (n DXNamingStrategy) FromColumn(column string) string {
+	switch n {
+	case NamingStrategySnake:
+		if strings.ToUpper(column) == column {
+			column = strings.ToLower(column)
+		}
+		return CamelCase(column)
+	case NamingStrategyCamel:
+		return SnakeCase(column)
+	default:
+		return column
+	}
+}
+
+// ToColumns gives kv keyed by the columns, the keys of the SQLExpression values are only labels and are kept. Two keys
+// of the same column, like firstName and first_name, are a FieldNameCollision.
+func (n DXNamingStrategy) ToColumns(kv utils.JSON) (r utils.JSON, err error) {
+	if kv == nil || n == NamingStrategyPassthrough {
+		return kv, nil
+	}
+	r = utils.JSON{}
+	fieldNames := map[string]string{}
+	for _, k := range SortedKeys(kv) {
+		v := kv[k]
+		column := k
+		if _, ok := v.(SQLExpression); !ok {
+			column = n.ToColumn(k)
+		}
+		other, ok := fieldNames[column]
+		if ok {
+			return nil, fmt.Errorf("FieldNameCollision:%s,%s", other, k)
+		}
+		fieldNames[column] = k
+		r[column] = v
+	}
+	return r, nil
+}
+
+func (n DXNamingStrategy) ToColumnNames(fieldNames []string) (r []string) {
+	if fieldNames == nil || n == NamingStrategyPassthrough {
+		return fieldNames
+	}
+	r = make([]string, len(fieldNames))
+	for i, v := range fieldNames {
+		r[i] = n.ToColumn(v)
+	}
+	return r
+}
+
+func (n DXNamingStrategy) ToColumnDirections(orderbyFieldNameDirections map[string]string) (r map[string]string) {
+	if orderbyFieldNameDirections == nil || n == NamingStrategyPassthrough {
+		return orderbyFieldNameDirections
+	}
+	r = map[string]string{}
+	for k, v := range orderbyFieldNameDirections {
+		r[n.ToColumn(k)] = v
+	}
+	return r
+}
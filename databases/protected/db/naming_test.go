@@ -0,0 +1,56 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/utils"
+)
+
+func TestNamingStrategiesRoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		fieldName string
+		column    string
+	}{
+		{`firstName`, `first_name`},
+		{`id`, `id`},
+		{`createdByUserId`, `created_by_user_id`},
+		{`address2Line`, `address2_line`},
+		{`users.firstName`, `users.first_name`},
+	} {
+		t.Run(tt.fieldName, func(t *testing.T) {
+			assert.Equal(t, tt.column, NamingStrategySnake.ToColumn(tt.fieldName))
+			assert.Equal(t, tt.fieldName, NamingStrategySnake.FromColumn(tt.column))
+			assert.Equal(t, tt.fieldName, NamingStrategyCamel.ToColumn(tt.column))
+			assert.Equal(t, tt.column, NamingStrategyCamel.FromColumn(tt.fieldName))
+			assert.Equal(t, tt.fieldName, NamingStrategyPassthrough.ToColumn(tt.fieldName))
+		})
+	}
+	// an acronym is one word, its case is not given back
+	assert.Equal(t, `user_id`, SnakeCase(`userID`))
+	assert.Equal(t, `http_server`, SnakeCase(`HTTPServer`))
+	// the expressions are kept as given
+	assert.Equal(t, `count(*) as nRows`, SnakeCase(`count(*) as nRows`))
+	assert.Equal(t, `firstName`, NamingStrategySnake.FromColumn(`FIRST_NAME`))
+}
+
+func TestDeformatKeysAppliesTheNamingStrategy(t *testing.T) {
+	row := utils.JSON{`first_name`: `alice`, `"last_name"`: `smith`, `ID`: 1}
+	assert.Equal(t, utils.JSON{`firstName`: `alice`, `lastName`: `smith`, `id`: 1}, DeformatKeys(IdentifierCaseDefault, NamingStrategySnake, row))
+	assert.Equal(t, utils.JSON{`first_name`: `alice`, `last_name`: `smith`, `id`: 1}, DeformatKeys(IdentifierCaseDefault, NamingStrategyPassthrough, row))
+}
+
+func TestToColumnsRefusesTwoFieldsOfOneColumn(t *testing.T) {
+	r, err := NamingStrategySnake.ToColumns(utils.JSON{`firstName`: `a`, `n`: SQLExpression{Expression: `n+1`}})
+	require.NoError(t, err)
+	assert.Equal(t, utils.JSON{`first_name`: `a`, `n`: SQLExpression{Expression: `n+1`}}, r)
+	_, err = NamingStrategySnake.ToColumns(utils.JSON{`firstName`: `a`, `first_name`: `b`})
+	assert.EqualError(t, err, `FieldNameCollision:firstName,first_name`)
+	n, err := ParseNamingStrategy(`Passthrough`)
+	require.NoError(t, err)
+	assert.Equal(t, NamingStrategyPassthrough, n)
+	_, err = ParseNamingStrategy(`kebab`)
+	assert.EqualError(t, err, `InvalidNamingStrategy:kebab`)
+}
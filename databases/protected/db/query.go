@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"dxlib/v3/log"
+	"dxlib/v3/tracing"
+)
+
+const DefaultSlowQueryThreshold = 500 * time.Millisecond
+
+// slowQueryThresholds holds the threshold of a *sqlx.DB, and of the *sqlx.Tx and *DXConn taken from it while tracked.
+var slowQueryThresholds sync.Map
+
+// SetSlowQueryThreshold sets how long a query on connection may take before it is logged as slow, 0 disables the log.
+func SetSlowQueryThreshold(connection *sqlx.DB, threshold time.Duration) {
+	slowQueryThresholds.Store(connection, threshold)
+}
+
+func RemoveSlowQueryThreshold(connection *sqlx.DB) {
+	slowQueryThresholds.Delete(connection)
+}
+
+// TrackTx makes the queries of tx use the slow query threshold and the identifier case of connection, until untrack is
+// called. While IsDebug, tx is listed by HeldConnections and warned about when it is left without Commit or Rollback.
+func TrackTx(tx *sqlx.Tx, connection *sqlx.DB) (untrack func()) {
+	untrack = track(tx, connection)
+	WatchLeak(tx, tx, `transaction`, func(tx *sqlx.Tx) bool {
+		return tx.Rollback() == nil
+	})
+	return untrack
+}
+
+// track makes e, a *sqlx.Tx or a *DXConn, use the slow query threshold and the identifier case of connection, and holds
+// it for HeldConnections.
+func track(e any, connection *sqlx.DB) (untrack func()) {
+	release := holdConnection(e, connection)
+	threshold, ok := slowQueryThresholds.Load(connection)
+	if ok {
+		slowQueryThresholds.Store(e, threshold)
+	}
+	identifierCase, ok := identifierCases.Load(connection)
+	if ok {
+		identifierCases.Store(e, identifierCase)
+	}
+	return func() {
+		slowQueryThresholds.Delete(e)
+		identifierCases.Delete(e)
+		release()
+	}
+}
+
+func slowQueryThreshold(e any) time.Duration {
+	threshold, ok := slowQueryThresholds.Load(e)
+	if !ok {
+		return DefaultSlowQueryThreshold
+	}
+	return threshold.(time.Duration)
+}
+
+// StartQuery starts the span of statement on e, a *sqlx.DB or a *sqlx.Tx, done ends it and logs the statement when it
+// took longer than the slow query threshold of e or failed. The log lines carry the correlation ids of ctx.
+func StartQuery(ctx context.Context, e any, driverName string, statement string) (queryContext context.Context, done func(err error) error) {
+	return StartQueryWithArgs(ctx, e, driverName, statement, nil)
+}
+
+// StartQueryWithArgs is StartQuery also logging arg, the named args of statement, as LoggedArgs gives them. done gives
+// err with the values of the sensitive columns masked, to be returned instead of err.
+func StartQueryWithArgs(ctx context.Context, e any, driverName string, statement string, arg any) (queryContext context.Context,
+	done func(err error) error) {
+	return startQuery(ctx, e, driverName, statement, arg, arg)
+}
+
+// StartPositionalQueryWithArgs is StartQueryWithArgs for a statement already positional, args are its values and arg,
+// the named args it was rendered from, is what is logged.
+func StartPositionalQueryWithArgs(ctx context.Context, e any, driverName string, statement string, args []any, arg any) (
+	queryContext context.Context, done func(err error) error) {
+	if args == nil {
+		args = []any{}
+	}
+	return startQuery(ctx, e, driverName, statement, arg, args)
+}
+
+// startQuery logs arg, explainArg is what a slow statement is explained with, see Explain.
+func startQuery(ctx context.Context, e any, driverName string, statement string, arg any, explainArg any) (queryContext context.Context,
+	done func(err error) error) {
+	startTime := time.Now()
+	queryContext, span := tracing.StartDBSpan(ctx, driverName, statement)
+	return queryContext, func(err error) error {
+		err = MaskError(err, arg)
+		tracing.EndSpan(span, err)
+		duration := time.Since(startTime)
+		l := log.NewLog(nil, ctx, log.Log.Prefix)
+		argsPart := ``
+		if loggedArgs := LoggedArgs(arg); loggedArgs != nil {
+			argsPart = fmt.Sprintf(" %v", loggedArgs)
+		}
+		if err != nil && !errors.Is(err, sql.ErrNoRows) && !errors.Is(err, context.Canceled) {
+			l.Warnf("Query failed (%v): %s%s", err, statement, argsPart)
+		}
+		threshold := slowQueryThreshold(e)
+		if threshold > 0 && duration > threshold {
+			id := captureSlowQuery(driverName, statement, arg, explainArg, duration)
+			l.Warnf("Slow query #%d (%v > %v): %s%s", id, duration, threshold, statement, argsPart)
+		}
+		return err
+	}
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/log"
+)
+
+func TestQueryLogLinesCarryTheCorrelationIds(t *testing.T) {
+	b := &bytes.Buffer{}
+	log.SetSinks(log.NewSink(`test`, log.DXLogFormatJSON, log.DXLogLevelWarn, b))
+	t.Cleanup(func() {
+		log.SetSinks()
+	})
+	connection := newTestSQLite(t, `CREATE TABLE users (name TEXT)`)
+	SetSlowQueryThreshold(connection, time.Nanosecond)
+	t.Cleanup(func() {
+		RemoveSlowQueryThreshold(connection)
+	})
+	ctx := log.ContextWithCorrelation(context.Background(), `request-1`, `trace-1`)
+
+	_, err := QueryRowsExt(ctx, connection, `SELECT name FROM users`, nil)
+	require.NoError(t, err)
+	assert.Contains(t, b.String(), `Slow query`)
+	assert.Contains(t, b.String(), `"request_id":"request-1"`)
+	assert.Contains(t, b.String(), `"trace_id":"trace-1"`)
+
+	b.Reset()
+	_, err = QueryRowsExt(ctx, connection, `SELECT name FROM missing`, nil)
+	require.Error(t, err)
+	assert.Contains(t, b.String(), `Query failed`)
+	assert.Contains(t, b.String(), `"request_id":"request-1"`)
+
+	b.Reset()
+	_, err = QueryRowsExt(context.Background(), connection, `SELECT name FROM users`, nil)
+	require.NoError(t, err)
+	assert.Contains(t, b.String(), `Slow query`)
+	assert.NotContains(t, b.String(), `request_id`)
+}
@@ -0,0 +1,129 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const SensitiveValueMask = `***`
+
+// IsMaskingSensitiveValues masks the values of the sensitive columns in the query errors and keeps every value out of
+// the query logs, they only have the arg names. It is turned off to debug in development only.
+var IsMaskingSensitiveValues = true
+
+var sensitiveColumns sync.Map
+
+// SetSensitiveColumns marks the columns, of any table, whose values are personal data, like email or ssn.
+func SetSensitiveColumns(columns ...string) {
+	for _, v := range columns {
+		sensitiveColumns.Store(strings.ToLower(strings.Trim(v, "\"`[]")), true)
+	}
+}
+
+// IsSensitiveArgName is true for the arg of a sensitive column, also when named with a prefix like the NEW_email of an
+// update or the r0_email of a bulk upsert.
+func IsSensitiveArgName(name string) bool {
+	name = strings.ToLower(name)
+	if _, ok := sensitiveColumns.Load(name); ok {
+		return true
+	}
+	isSensitive := false
+	sensitiveColumns.Range(func(k, _ any) bool {
+		isSensitive = strings.HasSuffix(name, `_`+k.(string))
+		return !isSensitive
+	})
+	return isSensitive
+}
+
+// sensitiveArgValues are the texts of the values of the sensitive args of arg, a utils.JSON or a map, longest first.
+func sensitiveArgValues(arg any) (r []string) {
+	kv, ok := arg.(map[string]any)
+	if !ok {
+		return nil
+	}
+	for k, v := range kv {
+		if v == nil || !IsSensitiveArgName(k) {
+			continue
+		}
+		s := fmt.Sprint(v)
+		if b, ok := v.([]byte); ok {
+			s = string(b)
+		}
+		if s != `` {
+			r = append(r, s)
+		}
+	}
+	sort.Slice(r, func(i, j int) bool {
+		return len(r[i]) > len(r[j])
+	})
+	return r
+}
+
+// MaskArgs gives the named args as logged, the values of the sensitive columns replaced by SensitiveValueMask.
+func MaskArgs(arg any) any {
+	kv, ok := arg.(map[string]any)
+	if !ok || !IsMaskingSensitiveValues {
+		return arg
+	}
+	r := make(map[string]any, len(kv))
+	for k, v := range kv {
+		if v != nil && IsSensitiveArgName(k) {
+			r[k] = SensitiveValueMask
+			continue
+		}
+		r[k] = v
+	}
+	return r
+}
+
+// LoggedArgs gives the named args as the query logs have them: only their names sorted, as a column not marked
+// sensitive may still hold personal data, or all of them with their values when IsMaskingSensitiveValues is off.
+func LoggedArgs(arg any) any {
+	kv, ok := arg.(map[string]any)
+	if !IsMaskingSensitiveValues {
+		return arg
+	}
+	if !ok {
+		return nil
+	}
+	names := make([]string, 0, len(kv))
+	for k := range kv {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dxSensitiveMaskedError hides the values of the sensitive args in the message of err, like the "Duplicate entry" of
+// mysql quoting the value.
+type dxSensitiveMaskedError struct {
+	err     error
+	message string
+}
+
+func (e *dxSensitiveMaskedError) Error() string {
+	return e.message
+}
+
+func (e *dxSensitiveMaskedError) Unwrap() error {
+	return e.err
+}
+
+// MaskError gives err with the values of the sensitive args of arg masked in its message, errors.Is and errors.As still
+// see err.
+func MaskError(err error, arg any) error {
+	if err == nil || !IsMaskingSensitiveValues {
+		return err
+	}
+	message := err.Error()
+	masked := message
+	for _, v := range sensitiveArgValues(arg) {
+		masked = strings.ReplaceAll(masked, v, SensitiveValueMask)
+	}
+	if masked == message {
+		return err
+	}
+	return &dxSensitiveMaskedError{err: err, message: masked}
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+)
+
+// logSlowTestQuery logs the statement with arg as slow and gives the log lines.
+func logSlowTestQuery(t *testing.T, arg utils.JSON) string {
+	t.Helper()
+	b := &bytes.Buffer{}
+	log.SetSinks(log.NewSink(`test`, log.DXLogFormatText, log.DXLogLevelWarn, b))
+	t.Cleanup(func() {
+		log.SetSinks()
+	})
+	e := &struct{}{}
+	slowQueryThresholds.Store(e, time.Nanosecond)
+	t.Cleanup(func() {
+		slowQueryThresholds.Delete(e)
+	})
+	_, done := StartQueryWithArgs(context.Background(), e, `postgres`, `update users set ssn = :ssn where name = :name`, arg)
+	time.Sleep(time.Millisecond)
+	_ = done(nil)
+	return b.String()
+}
+
+func TestSlowQueryLogHasOnlyTheArgNames(t *testing.T) {
+	SetSensitiveColumns(`ssn`)
+	lines := logSlowTestQuery(t, utils.JSON{`ssn`: `123-45-6789`, `name`: `alice`})
+	assert.Contains(t, lines, `Slow query`)
+	assert.Contains(t, lines, `[name ssn]`)
+	assert.NotContains(t, lines, `123-45-6789`)
+	assert.NotContains(t, lines, `alice`)
+}
+
+func TestSlowQueryLogHasTheValuesWhenUnmasked(t *testing.T) {
+	IsMaskingSensitiveValues = false
+	t.Cleanup(func() {
+		IsMaskingSensitiveValues = true
+	})
+	lines := logSlowTestQuery(t, utils.JSON{`ssn`: `123-45-6789`, `name`: `alice`})
+	assert.Contains(t, lines, `123-45-6789`)
+	assert.Contains(t, lines, `alice`)
+}
+
+func TestMaskArgsAndMaskError(t *testing.T) {
+	SetSensitiveColumns(`ssn`)
+	arg := utils.JSON{`NEW_ssn`: `123-45-6789`, `name`: `alice`}
+	assert.Equal(t, utils.JSON{`NEW_ssn`: SensitiveValueMask, `name`: `alice`}, MaskArgs(arg))
+
+	errDuplicate := errors.New(`Duplicate entry '123-45-6789' for key 'ssn'`)
+	err := MaskError(errDuplicate, arg)
+	assert.Equal(t, `Duplicate entry '***' for key 'ssn'`, err.Error())
+	assert.ErrorIs(t, err, errDuplicate)
+}
@@ -0,0 +1,190 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"dxlib/v3/utils"
+)
+
+const (
+	DefaultBulkUpsertBatchSize = 500
+	// maxBulkUpsertParameters is the limit of the bind parameters of a statement of postgres and mysql
+	maxBulkUpsertParameters = 65535
+)
+
+// SQLBulkInsert builds the insert of rowCount rows of fieldNames, the values of row i named r<i>_<field name>. Oracle
+// has no insert of several rows.
+func SQLBulkInsert(driverName string, tableName string, fieldNames []string, rowCount int) (s string, err error) {
+	if len(fieldNames) == 0 || rowCount == 0 {
+		return ``, fmt.Errorf("BulkInsertWithoutRows:%s", tableName)
+	}
+	if !DriverCapabilities(driverName).SupportsMultiRowInsert {
+		return ``, fmt.Errorf("BulkInsertNotSupportedForDriver:%s", driverName)
+	}
+	return sqlBulkInsert(tableName, fieldNames, rowCount), nil
+}
+
+func sqlBulkInsert(tableName string, fieldNames []string, rowCount int) (s string) {
+	b := strings.Builder{}
+	b.WriteString(`INSERT INTO ` + tableName + ` (` + strings.Join(fieldNames, `,`) + `) VALUES `)
+	for i := 0; i < rowCount; i++ {
+		if i > 0 {
+			b.WriteString(`,`)
+		}
+		b.WriteString(`(`)
+		for j, v := range fieldNames {
+			if j > 0 {
+				b.WriteString(`,`)
+			}
+			b.WriteString(`:r` + strconv.Itoa(i) + `_` + v)
+		}
+		b.WriteString(`)`)
+	}
+	return b.String()
+}
+
+// SQLBulkUpsert builds the insert of rowCount rows of fieldNames, the values of row i named r<i>_<field name>, updating
+// the other fields of the rows conflicting on conflictFieldNames. Without other fields the conflicting rows are kept.
+func SQLBulkUpsert(driverName string, tableName string, fieldNames []string, rowCount int, conflictFieldNames []string) (s string, err error) {
+	if len(fieldNames) == 0 || rowCount == 0 {
+		return ``, fmt.Errorf("BulkUpsertWithoutRows:%s", tableName)
+	}
+	if len(conflictFieldNames) == 0 {
+		return ``, fmt.Errorf("BulkUpsertWithoutConflictFields:%s", tableName)
+	}
+	isConflictField := map[string]bool{}
+	for _, v := range conflictFieldNames {
+		isConflictField[v] = true
+	}
+	updateFieldNames := []string{}
+	for _, v := range fieldNames {
+		if !isConflictField[v] {
+			updateFieldNames = append(updateFieldNames, v)
+		}
+	}
+	b := strings.Builder{}
+	b.WriteString(sqlBulkInsert(tableName, fieldNames, rowCount))
+	switch driverName {
+	case "postgres":
+		b.WriteString(` ON CONFLICT (` + strings.Join(conflictFieldNames, `,`) + `) DO `)
+		if len(updateFieldNames) == 0 {
+			b.WriteString(`NOTHING`)
+			break
+		}
+		b.WriteString(`UPDATE SET `)
+		for i, v := range updateFieldNames {
+			if i > 0 {
+				b.WriteString(`,`)
+			}
+			b.WriteString(v + `=EXCLUDED.` + v)
+		}
+	case "mysql":
+		b.WriteString(` ON DUPLICATE KEY UPDATE `)
+		if len(updateFieldNames) == 0 {
+			b.WriteString(conflictFieldNames[0] + `=` + conflictFieldNames[0])
+			break
+		}
+		for i, v := range updateFieldNames {
+			if i > 0 {
+				b.WriteString(`,`)
+			}
+			b.WriteString(v + `=VALUES(` + v + `)`)
+		}
+	default:
+		return ``, fmt.Errorf("BulkUpsertNotSupportedForDriver:%s", driverName)
+	}
+	return b.String(), nil
+}
+
+// BulkUpsertExt upserts rows, all with the same fields, batchSize rows a statement, their values prepared like PrepareArgs
+// does. It works on both *sqlx.DB and *sqlx.Tx. As the drivers count them, mysql gives 2 affected rows for an updated row
+// and 0 for an unchanged one.
+func BulkUpsertExt(ctx context.Context, e sqlx.ExtContext, tableName string, rows []utils.JSON, conflictFieldNames []string,
+	batchSize int) (rowsAffected int64, err error) {
+	return bulkExecExt(ctx, e, tableName, rows, batchSize, func(fieldNames []string, rowCount int) (string, error) {
+		return SQLBulkUpsert(e.DriverName(), tableName, fieldNames, rowCount, conflictFieldNames)
+	})
+}
+
+// BulkInsertExt is BulkUpsertExt inserting the rows without any conflict handling, for every driver but oracle.
+func BulkInsertExt(ctx context.Context, e sqlx.ExtContext, tableName string, rows []utils.JSON, batchSize int) (rowsAffected int64, err error) {
+	return bulkExecExt(ctx, e, tableName, rows, batchSize, func(fieldNames []string, rowCount int) (string, error) {
+		return SQLBulkInsert(e.DriverName(), tableName, fieldNames, rowCount)
+	})
+}
+
+// maxBulkParameters is the limit of the bind parameters of a statement of the driver.
+func maxBulkParameters(driverName string) int {
+	switch driverName {
+	case "sqlserver":
+		return 2100 - 1
+	case "sqlite3", "sqlite":
+		return 999
+	default:
+		return maxBulkUpsertParameters
+	}
+}
+
+func bulkExecExt(ctx context.Context, e sqlx.ExtContext, tableName string, rows []utils.JSON, batchSize int,
+	statement func(fieldNames []string, rowCount int) (string, error)) (rowsAffected int64, err error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	fieldNames := SortedKeys(rows[0])
+	for i, row := range rows {
+		if len(row) != len(fieldNames) {
+			return 0, fmt.Errorf("BulkUpsertRowFieldsMismatch:%d", i)
+		}
+		for _, k := range fieldNames {
+			v, ok := row[k]
+			if !ok {
+				return 0, fmt.Errorf("BulkUpsertRowFieldsMismatch:%d,%s", i, k)
+			}
+			if _, ok := v.(SQLExpression); ok {
+				return 0, fmt.Errorf("BulkUpsertSQLExpressionNotSupported:%d,%s", i, k)
+			}
+		}
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultBulkUpsertBatchSize
+	}
+	driverName := e.DriverName()
+	maxParameters := maxBulkParameters(driverName)
+	if batchSize*len(fieldNames) > maxParameters {
+		batchSize = max(maxParameters/len(fieldNames), 1)
+	}
+	for start := 0; start < len(rows); start += batchSize {
+		batch := rows[start:min(start+batchSize, len(rows))]
+		s, err := statement(fieldNames, len(batch))
+		if err != nil {
+			return rowsAffected, err
+		}
+		args := make(utils.JSON, len(batch)*len(fieldNames))
+		for i, row := range batch {
+			for _, k := range fieldNames {
+				args[`r`+strconv.Itoa(i)+`_`+k] = PrepareDriverArgValue(driverName, row[k])
+			}
+		}
+		q, a, err := PositionalQuery(driverName, s, args)
+		if err != nil {
+			return rowsAffected, err
+		}
+		queryCtx, done := StartPositionalQueryWithArgs(ctx, e, driverName, q, a, args)
+		r, err := e.ExecContext(queryCtx, q, a...)
+		err = done(err)
+		if err != nil {
+			return rowsAffected, err
+		}
+		n, err := r.RowsAffected()
+		if err != nil {
+			return rowsAffected, err
+		}
+		rowsAffected += n
+	}
+	return rowsAffected, nil
+}
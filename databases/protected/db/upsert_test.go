@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/utils"
+)
+
+func TestSQLBulkUpsert(t *testing.T) {
+	for _, tt := range []struct {
+		driverName         string
+		conflictFieldNames []string
+		s                  string
+	}{
+		{`postgres`, []string{`id`}, `INSERT INTO users (id,name) VALUES (:r0_id,:r0_name),(:r1_id,:r1_name) ON CONFLICT (id) DO UPDATE SET name=EXCLUDED.name`},
+		{`postgres`, []string{`id`, `name`}, `INSERT INTO users (id,name) VALUES (:r0_id,:r0_name),(:r1_id,:r1_name) ON CONFLICT (id,name) DO NOTHING`},
+		{`mysql`, []string{`id`}, `INSERT INTO users (id,name) VALUES (:r0_id,:r0_name),(:r1_id,:r1_name) ON DUPLICATE KEY UPDATE name=VALUES(name)`},
+		{`mysql`, []string{`id`, `name`}, `INSERT INTO users (id,name) VALUES (:r0_id,:r0_name),(:r1_id,:r1_name) ON DUPLICATE KEY UPDATE id=id`},
+	} {
+		t.Run(tt.driverName, func(t *testing.T) {
+			s, err := SQLBulkUpsert(tt.driverName, `users`, []string{`id`, `name`}, 2, tt.conflictFieldNames)
+			require.NoError(t, err)
+			assert.Equal(t, tt.s, s)
+		})
+	}
+	_, err := SQLBulkUpsert(`oracle`, `users`, []string{`id`}, 1, []string{`id`})
+	assert.EqualError(t, err, `BulkUpsertNotSupportedForDriver:oracle`)
+	_, err = SQLBulkUpsert(`postgres`, `users`, []string{`id`}, 1, nil)
+	assert.EqualError(t, err, `BulkUpsertWithoutConflictFields:users`)
+	_, err = SQLBulkUpsert(`postgres`, `users`, nil, 1, []string{`id`})
+	assert.EqualError(t, err, `BulkUpsertWithoutRows:users`)
+}
+
+func TestBulkUpsertExtOfAConflictingBatch(t *testing.T) {
+	// sqlite speaks the ON CONFLICT of postgres
+	connection := sqlx.NewDb(newTestSQLite(t, `CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL, is_active BOOLEAN NOT NULL)`,
+		`INSERT INTO users (id, name, is_active) VALUES (1, 'alice', false)`).DB, `postgres`)
+	ctx := context.Background()
+
+	rowsAffected, err := BulkUpsertExt(ctx, connection, `users`, []utils.JSON{
+		{`id`: 1, `name`: `alice smith`, `is_active`: true},
+		{`id`: 2, `name`: `bob`, `is_active`: true},
+		{`id`: 3, `name`: `carol`, `is_active`: false},
+	}, []string{`id`}, 2)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, rowsAffected)
+	var rows []struct {
+		Id       int64  `db:"id"`
+		Name     string `db:"name"`
+		IsActive bool   `db:"is_active"`
+	}
+	require.NoError(t, connection.Select(&rows, `SELECT id, name, is_active FROM users ORDER BY id`))
+	require.Len(t, rows, 3)
+	assert.Equal(t, `alice smith`, rows[0].Name)
+	assert.True(t, rows[0].IsActive)
+	assert.Equal(t, `bob`, rows[1].Name)
+	assert.False(t, rows[2].IsActive)
+
+	_, err = BulkUpsertExt(ctx, connection, `users`, []utils.JSON{{`id`: 4, `name`: `dan`, `is_active`: true}, {`id`: 5, `name`: `erin`}},
+		[]string{`id`}, 2)
+	assert.EqualError(t, err, `BulkUpsertRowFieldsMismatch:1`)
+	_, err = BulkUpsertExt(ctx, connection, `users`, []utils.JSON{{`id`: 4, `name`: SQLExpression{Expression: `'dan'`}, `is_active`: true}},
+		[]string{`id`}, 2)
+	assert.EqualError(t, err, `BulkUpsertSQLExpressionNotSupported:0,name`)
+}
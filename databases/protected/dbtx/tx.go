@@ -14,8 +14,8 @@ import (
 
 type TxCallback func(tx *sqlx.Tx, log *log.DXLog) (err error)
 
-func Tx(log *log.DXLog, db *sqlx.DB, isolationLevel sql.IsolationLevel, callback TxCallback) (err error) {
-	tx, err := db.BeginTxx(log.Context, &sql.TxOptions{
+func Tx(log *log.DXLog, dbInstance *sqlx.DB, isolationLevel sql.IsolationLevel, callback TxCallback) (err error) {
+	tx, err := dbInstance.BeginTxx(log.Context, &sql.TxOptions{
 		Isolation: isolationLevel,
 		ReadOnly:  false,
 	})
@@ -23,6 +23,7 @@ func Tx(log *log.DXLog, db *sqlx.DB, isolationLevel sql.IsolationLevel, callback
 		log.Error(err.Error())
 		return err
 	}
+	defer db.TrackTx(tx, dbInstance)()
 	err = callback(tx, log)
 	if err != nil {
 		log.Errorf(`ErrorInCallback: (%v)`, err.Error())
@@ -46,7 +47,10 @@ func Tx(log *log.DXLog, db *sqlx.DB, isolationLevel sql.IsolationLevel, callback
 }
 
 func TxNamedQuery(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, query string, args any) (rows *sqlx.Rows, err error) {
-	rows, err = tx.NamedQuery(query, args)
+	args = db.CoerceArgs(tx.DriverName(), args)
+	ctx, done := db.StartQueryWithArgs(log.Context, tx, tx.DriverName(), query, args)
+	rows, err = sqlx.NamedQueryContext(ctx, tx, query, args)
+	err = done(err)
 	if err != nil {
 		if autoRollback {
 			errTx := tx.Rollback()
@@ -60,7 +64,10 @@ func TxNamedQuery(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, query string,
 }
 
 func TxNamedExec(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, query string, args any) (r sql.Result, err error) {
-	r, err = tx.NamedExec(query, args)
+	args = db.CoerceArgs(tx.DriverName(), args)
+	ctx, done := db.StartQueryWithArgs(log.Context, tx, tx.DriverName(), query, args)
+	r, err = tx.NamedExecContext(ctx, query, args)
+	err = done(err)
 	if err != nil {
 		if autoRollback {
 			errTx := tx.Rollback()
@@ -92,7 +99,10 @@ func TxNamedQueryIdBigMustExist(log *log.DXLog, autoRollback bool, tx *sqlx.Tx,
 			return 0, err
 		}
 	} else {
-		err := errors.New(`QueryReturnEmpty`)
+		err := rows.Err()
+		if err == nil {
+			err = errors.New(`QueryReturnEmpty`)
+		}
 		errTx := tx.Rollback()
 		if errTx != nil {
 			log.Errorf(`ErrorInRollback: (%v)`, errTx.Error())
@@ -103,7 +113,10 @@ func TxNamedQueryIdBigMustExist(log *log.DXLog, autoRollback bool, tx *sqlx.Tx,
 }
 
 func TxNamedQueryRows(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, query string, arg any) (r []utils.JSON, err error) {
-	rows, err := tx.NamedQuery(query, arg)
+	arg = db.CoerceArgs(tx.DriverName(), arg)
+	ctx, done := db.StartQueryWithArgs(log.Context, tx, tx.DriverName(), query, arg)
+	rows, err := sqlx.NamedQueryContext(ctx, tx, query, arg)
+	err = done(err)
 	if err != nil {
 		if autoRollback {
 			errTx := tx.Rollback()
@@ -128,6 +141,10 @@ func TxNamedQueryRows(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, query stri
 		}
 		r = append(r, rowJSON)
 	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
 	return r, nil
 }
 
@@ -151,7 +168,7 @@ func TxNamedQueryRow(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, query strin
 		}
 		return rowJSON, nil
 	}
-	return nil, nil
+	return nil, rows.Err()
 }
 
 func TxNamedQueryRowMustExist(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, query string, arg any) (r utils.JSON, err error) {
@@ -172,7 +189,7 @@ func TxNamedQueryRowMustExist(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, qu
 
 func TxSelectWhereKeyValuesRows(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
 	orderbyFieldNameDirections map[string]string, forUpdatePart any) (r []utils.JSON, err error) {
-	s, err := db.SQLPartConstructSelect(tx.DriverName(), tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, nil, forUpdatePart)
+	s, err := db.SQLPartConstructSelect(tx.DriverName(), db.IdentifierCaseOf(tx), tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, nil, forUpdatePart)
 	if err != nil {
 		return nil, err
 	}
@@ -183,7 +200,7 @@ func TxSelectWhereKeyValuesRows(log *log.DXLog, autoRollback bool, tx *sqlx.Tx,
 
 func TxSelectOneMustExist(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any, orderbyFieldNameDirections map[string]string, forUpdatePart any) (r utils.JSON,
 	err error) {
-	s, err := db.SQLPartConstructSelect(tx.DriverName(), tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, 1, forUpdatePart)
+	s, err := db.SQLPartConstructSelect(tx.DriverName(), db.IdentifierCaseOf(tx), tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, 1, forUpdatePart)
 	if err != nil {
 		err := fmt.Errorf(`%s:%s`, err, tableName)
 		return nil, err
@@ -199,7 +216,7 @@ func TxSelectOneMustExist(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, tableN
 
 func TxSelectOne(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
 	orderbyFieldNameDirections map[string]string, forUpdatePart any) (r utils.JSON, err error) {
-	s, err := db.SQLPartConstructSelect(tx.DriverName(), tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, 1, forUpdatePart)
+	s, err := db.SQLPartConstructSelect(tx.DriverName(), db.IdentifierCaseOf(tx), tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, 1, forUpdatePart)
 	if err != nil {
 		return nil, err
 	}
@@ -209,6 +226,10 @@ func TxSelectOne(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, tableName strin
 }
 
 func TxInsert(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, tableName string, keyValues utils.JSON) (id int64, err error) {
+	err = db.CheckFieldNameCollisions(db.IdentifierCaseOf(tx), keyValues)
+	if err != nil {
+		return 0, err
+	}
 	fn, fv := db.SQLPartInsertFieldNamesFieldValues(keyValues)
 	s := ``
 	switch tx.DriverName() {
@@ -226,7 +247,39 @@ func TxInsert(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, tableName string,
 	return id, err
 }
 
+func TxInsertReturningId(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, tableName string, keyValues utils.JSON, idFieldName string) (id int64, rowsAffected int64, err error) {
+	id, rowsAffected, err = db.InsertReturningIdExt(log.Context, tx, tableName, keyValues, idFieldName)
+	if err != nil {
+		if autoRollback {
+			errTx := tx.Rollback()
+			if errTx != nil {
+				log.Errorf(`ErrorInRollback: (%v)`, errTx.Error())
+			}
+		}
+		return 0, rowsAffected, err
+	}
+	return id, rowsAffected, nil
+}
+
+func TxInsertRowsAffected(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, tableName string, keyValues utils.JSON) (rowsAffected int64, err error) {
+	rowsAffected, err = db.InsertRowsAffectedExt(log.Context, tx, tableName, keyValues)
+	if err != nil {
+		if autoRollback {
+			errTx := tx.Rollback()
+			if errTx != nil {
+				log.Errorf(`ErrorInRollback: (%v)`, errTx.Error())
+			}
+		}
+		return 0, err
+	}
+	return rowsAffected, nil
+}
+
 func TxUpdateWhereKeyValues(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, tableName string, setKeyValues utils.JSON, whereKeyValues utils.JSON) (result sql.Result, err error) {
+	err = db.CheckUpdateFieldNameCollisions(db.IdentifierCaseOf(tx), setKeyValues, whereKeyValues)
+	if err != nil {
+		return nil, err
+	}
 	setKeyValues, u := db.SQLPartSetFieldNameValues(setKeyValues)
 	w := db.SQLPartWhereAndFieldNameValues(whereKeyValues)
 	joinedKeyValues := db.MergeMapExcludeSQLExpression(setKeyValues, whereKeyValues)
@@ -237,6 +290,10 @@ func TxUpdateWhereKeyValues(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, tabl
 }
 
 func TxUpdateOne(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, tableName string, setKeyValues utils.JSON, whereKeyValues utils.JSON) (result utils.JSON, err error) {
+	err = db.CheckUpdateFieldNameCollisions(db.IdentifierCaseOf(tx), setKeyValues, whereKeyValues)
+	if err != nil {
+		return nil, err
+	}
 	setKeyValues, u := db.SQLPartSetFieldNameValues(setKeyValues)
 	w := db.SQLPartWhereAndFieldNameValues(whereKeyValues)
 	joinedKeyValues := db.MergeMapExcludeSQLExpression(setKeyValues, whereKeyValues)
@@ -247,6 +304,10 @@ func TxUpdateOne(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, tableName strin
 }
 
 func TxDeleteWhereKeyValues(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, tableName string, whereAndFieldNameValues utils.JSON) (r sql.Result, err error) {
+	err = db.CheckFieldNameCollisions(db.IdentifierCaseOf(tx), whereAndFieldNameValues)
+	if err != nil {
+		return nil, err
+	}
 	w := db.SQLPartWhereAndFieldNameValues(whereAndFieldNameValues)
 	s := `delete from ` + tableName + ` where ` + w
 	wKV := db.ExcludeSQLExpression(whereAndFieldNameValues)
@@ -0,0 +1,160 @@
+package databases
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"syscall"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	mssql "github.com/microsoft/go-mssqldb"
+
+	"dxlib/v3/breaker"
+	"dxlib/v3/log"
+)
+
+const (
+	DXDatabaseRetryDefaultMaxAttempts    = 3
+	DXDatabaseRetryDefaultInitialBackoff = 50 * time.Millisecond
+	DXDatabaseRetryDefaultMaxBackoff     = 2 * time.Second
+)
+
+// DXDatabaseRetryPolicy bounds RetryOnTransient, the backoff doubles from InitialBackoff up to MaxBackoff. An empty
+// DriverName recognizes the transient errors of every driver. Every attempt runs through CircuitBreaker when set.
+type DXDatabaseRetryPolicy struct {
+	DriverName     string
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	CircuitBreaker *breaker.DXCircuitBreaker
+}
+
+func DefaultRetryPolicy(driverName string) DXDatabaseRetryPolicy {
+	return DXDatabaseRetryPolicy{
+		DriverName:     driverName,
+		MaxAttempts:    DXDatabaseRetryDefaultMaxAttempts,
+		InitialBackoff: DXDatabaseRetryDefaultInitialBackoff,
+		MaxBackoff:     DXDatabaseRetryDefaultMaxBackoff,
+	}
+}
+
+func isTransientConnectionError(err error) bool {
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+func isTransientPostgresError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	switch pqErr.Code {
+	// serialization_failure, deadlock_detected, admin_shutdown, cannot_connect_now
+	case "40001", "40P01", "57P01", "57P03":
+		return true
+	}
+	// connection_exception
+	return pqErr.Code.Class() == "08"
+}
+
+func isTransientMySQLError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return errors.Is(err, mysql.ErrInvalidConn)
+	}
+	// ER_LOCK_DEADLOCK, ER_LOCK_WAIT_TIMEOUT
+	return mysqlErr.Number == 1213 || mysqlErr.Number == 1205
+}
+
+func isTransientSQLServerError(err error) bool {
+	var mssqlErr mssql.Error
+	if !errors.As(err, &mssqlErr) {
+		return false
+	}
+	// deadlock victim, lock request time out, snapshot update conflict
+	return mssqlErr.Number == 1205 || mssqlErr.Number == 1222 || mssqlErr.Number == 3960
+}
+
+// IsTransientError is true for the errors worth running the same work again for, a deadlock, a serialization failure or
+// a lost connection. driverName is the sqlx driver name of the database, empty checks the errors of every driver.
+func IsTransientError(err error, driverName string) bool {
+	if err == nil {
+		return false
+	}
+	if isTransientConnectionError(err) {
+		return true
+	}
+	switch driverName {
+	case "postgres":
+		return isTransientPostgresError(err)
+	case "mysql":
+		return isTransientMySQLError(err)
+	case "sqlserver":
+		return isTransientSQLServerError(err)
+	case "":
+		return isTransientPostgresError(err) || isTransientMySQLError(err) || isTransientSQLServerError(err)
+	default:
+		return false
+	}
+}
+
+// IsUnavailableError is true for the transient errors of a database that cannot be reached, a deadlock or a
+// serialization failure is not one, they are what a CircuitBreaker of the database counts.
+func IsUnavailableError(err error, driverName string) bool {
+	if err == nil {
+		return false
+	}
+	if isTransientConnectionError(err) || errors.Is(err, mysql.ErrInvalidConn) {
+		return true
+	}
+	var pqErr *pq.Error
+	if (driverName == "postgres" || driverName == "") && errors.As(err, &pqErr) {
+		return pqErr.Code == "57P01" || pqErr.Code == "57P03" || pqErr.Code.Class() == "08"
+	}
+	return false
+}
+
+// RetryOnTransient calls fn again while it fails with a transient error, up to policy.MaxAttempts calls, any other error
+// is returned at once. fn must redo the whole work, a transaction included, since the failed one is rolled back.
+func RetryOnTransient(ctx context.Context, fn func() error, policy DXDatabaseRetryPolicy) (err error) {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = DXDatabaseRetryDefaultMaxAttempts
+	}
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = DXDatabaseRetryDefaultInitialBackoff
+	}
+	if policy.MaxBackoff < policy.InitialBackoff {
+		policy.MaxBackoff = policy.InitialBackoff
+	}
+	backoff := policy.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		if policy.CircuitBreaker != nil {
+			err = policy.CircuitBreaker.Call(fn)
+		} else {
+			err = fn()
+		}
+		if err == nil || attempt >= policy.MaxAttempts || !IsTransientError(err, policy.DriverName) {
+			return err
+		}
+		log.Log.Warnf("Transient database error, retrying in %v (attempt %d of %d) (%v)", backoff, attempt, policy.MaxAttempts, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = backoff * 2
+		if backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
+
+// RetryOnTransient is RetryOnTransient with the default policy for the driver of the database, through its
+// CircuitBreaker.
+func (d *DXDatabase) RetryOnTransient(ctx context.Context, fn func() error) (err error) {
+	policy := DefaultRetryPolicy(d.DatabaseType.String())
+	policy.CircuitBreaker = d.CircuitBreaker
+	return RetryOnTransient(ctx, fn, policy)
+}
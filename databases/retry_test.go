@@ -0,0 +1,95 @@
+package databases
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	mssql "github.com/microsoft/go-mssqldb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTransientError(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		err         error
+		driverName  string
+		isTransient bool
+	}{
+		{`postgres serialization failure`, &pq.Error{Code: `40001`}, `postgres`, true},
+		{`postgres deadlock`, fmt.Errorf(`update: %w`, &pq.Error{Code: `40P01`}), `postgres`, true},
+		{`postgres connection exception`, &pq.Error{Code: `08006`}, `postgres`, true},
+		{`postgres unique violation`, &pq.Error{Code: `23505`}, `postgres`, false},
+		{`postgres error of mysql`, &pq.Error{Code: `40001`}, `mysql`, false},
+		{`mysql deadlock`, &mysql.MySQLError{Number: 1213}, `mysql`, true},
+		{`mysql lock wait timeout`, &mysql.MySQLError{Number: 1205}, `mysql`, true},
+		{`mysql duplicate entry`, &mysql.MySQLError{Number: 1062}, `mysql`, false},
+		{`sqlserver deadlock victim`, mssql.Error{Number: 1205}, `sqlserver`, true},
+		{`connection refused`, fmt.Errorf(`dial: %w`, syscall.ECONNREFUSED), `postgres`, true},
+		{`bad connection`, driver.ErrBadConn, `oracle`, true},
+		{`any driver`, &mysql.MySQLError{Number: 1213}, ``, true},
+		{`other error`, errors.New(`syntax error`), ``, false},
+		{`nil`, nil, `postgres`, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.isTransient, IsTransientError(tt.err, tt.driverName))
+		})
+	}
+}
+
+// newTestRetryPolicy retries quickly, for the tests not to wait for the default backoff.
+func newTestRetryPolicy(driverName string) DXDatabaseRetryPolicy {
+	return DXDatabaseRetryPolicy{DriverName: driverName, MaxAttempts: 3, InitialBackoff: time.Millisecond,
+		MaxBackoff: 2 * time.Millisecond}
+}
+
+func TestRetryOnTransientSucceedsAfterTwoFailures(t *testing.T) {
+	calls := 0
+	err := RetryOnTransient(context.Background(), func() error {
+		calls++
+		if calls <= 2 {
+			return &pq.Error{Code: `40P01`}
+		}
+		return nil
+	}, newTestRetryPolicy(`postgres`))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestRetryOnTransientGivesUp(t *testing.T) {
+	calls := 0
+	err := RetryOnTransient(context.Background(), func() error {
+		calls++
+		return &mysql.MySQLError{Number: 1213}
+	}, newTestRetryPolicy(`mysql`))
+	var mysqlErr *mysql.MySQLError
+	assert.ErrorAs(t, err, &mysqlErr)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	errSyntax := errors.New(`syntax error`)
+	err = RetryOnTransient(context.Background(), func() error {
+		calls++
+		return errSyntax
+	}, newTestRetryPolicy(`postgres`))
+	assert.ErrorIs(t, err, errSyntax)
+	assert.Equal(t, 1, calls)
+
+	calls = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	policy := newTestRetryPolicy(`postgres`)
+	policy.InitialBackoff = time.Hour
+	err = RetryOnTransient(ctx, func() error {
+		calls++
+		return &pq.Error{Code: `40001`}
+	}, policy)
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,89 @@
+package databases
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"dxlib/v3/databases/protected/db"
+	"dxlib/v3/log"
+)
+
+var savepointNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,62}$`)
+
+// savepointSQL gives the statement of action ("savepoint", "rollback" or "release") for the driver of the transaction,
+// empty when the driver has nothing to do for it, like the release of Oracle and SQL Server.
+func (dtx *DXDatabaseTx) savepointSQL(action string, name string) (query string, err error) {
+	if !savepointNameRegex.MatchString(name) {
+		return ``, fmt.Errorf("InvalidSavepointName:%s", name)
+	}
+	driverName := dtx.Tx.DriverName()
+	capabilities := db.DriverCapabilities(driverName)
+	if !capabilities.SupportsSavepoints {
+		return ``, fmt.Errorf("SavepointNotSupportedByDriver:%s", driverName)
+	}
+	switch {
+	case action == `release` && !capabilities.SupportsReleaseSavepoint:
+		return ``, nil
+	case action == `release`:
+		return `RELEASE SAVEPOINT ` + name, nil
+	case driverName == "sqlserver" && action == `savepoint`:
+		return `SAVE TRANSACTION ` + name, nil
+	case driverName == "sqlserver":
+		return `ROLLBACK TRANSACTION ` + name, nil
+	case action == `savepoint`:
+		return `SAVEPOINT ` + name, nil
+	default:
+		return `ROLLBACK TO SAVEPOINT ` + name, nil
+	}
+}
+
+func (dtx *DXDatabaseTx) execSavepoint(log *log.DXLog, action string, name string) (err error) {
+	query, err := dtx.savepointSQL(action, name)
+	if err != nil {
+		return err
+	}
+	if query == `` {
+		return nil
+	}
+	_, err = dtx.Tx.ExecContext(log.Context, query)
+	if err != nil {
+		log.Errorf(`ErrorInSavepoint %s %s: (%v)`, action, name, err.Error())
+		return err
+	}
+	return nil
+}
+
+// Savepoint marks the transaction at name, RollbackTo undoes what came after it without ending the transaction.
+func (dtx *DXDatabaseTx) Savepoint(log *log.DXLog, name string) (err error) {
+	return dtx.execSavepoint(log, `savepoint`, name)
+}
+
+func (dtx *DXDatabaseTx) RollbackTo(log *log.DXLog, name string) (err error) {
+	return dtx.execSavepoint(log, `rollback`, name)
+}
+
+func (dtx *DXDatabaseTx) ReleaseSavepoint(log *log.DXLog, name string) (err error) {
+	return dtx.execSavepoint(log, `release`, name)
+}
+
+// WithSavepoint runs callback inside the savepoint name, nested in the transaction of dtx. It is released when callback
+// succeeds, on error the transaction is rolled back to it and stays usable, the error of callback is returned.
+func (dtx *DXDatabaseTx) WithSavepoint(log *log.DXLog, name string, callback DXDatabaseTxCallback) (err error) {
+	err = dtx.Savepoint(log, name)
+	if err != nil {
+		return err
+	}
+	err = callback(log, dtx)
+	if err != nil {
+		log.Errorf(`ErrorInSavepointCallback %s: (%v)`, name, err.Error())
+		errRollback := dtx.RollbackTo(log, name)
+		if errRollback != nil {
+			return errors.Join(err, errRollback)
+		}
+		// the rollback keeps the savepoint of most drivers, it is not needed anymore
+		_ = dtx.ReleaseSavepoint(log, name)
+		return err
+	}
+	return dtx.ReleaseSavepoint(log, name)
+}
@@ -0,0 +1,80 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/log"
+)
+
+// newTestSavepointDatabase gives a database on a sqlite file under the postgres driver name, sqlite takes the
+// savepoint statements of postgres.
+func newTestSavepointDatabase(t *testing.T) *DXDatabase {
+	t.Helper()
+	sqlDB, err := sql.Open(`sqlite`, filepath.Join(t.TempDir(), `savepoint.db`))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = sqlDB.Close()
+	})
+	connection := sqlx.NewDb(sqlDB, `postgres`)
+	_, err = connection.Exec(`CREATE TABLE t (name TEXT NOT NULL)`)
+	require.NoError(t, err)
+	d := newTestDatabaseManager().NewDatabase(`savepoint`, false, false)
+	d.Connection = connection
+	d.Connected = true
+	return d
+}
+
+func TestFailedSavepointKeepsTheOuterTransaction(t *testing.T) {
+	d := newTestSavepointDatabase(t)
+	l := log.NewLog(nil, context.Background(), `test`)
+	errBadRecord := errors.New(`bad record`)
+
+	err := d.Tx(&l, sql.LevelDefault, func(l *log.DXLog, dtx *DXDatabaseTx) (err error) {
+		_, err = dtx.Exec(`INSERT INTO t (name) VALUES ('first')`)
+		require.NoError(t, err)
+		err = dtx.WithSavepoint(l, `record_2`, func(l *log.DXLog, dtx *DXDatabaseTx) (err error) {
+			_, err = dtx.Exec(`INSERT INTO t (name) VALUES ('bad')`)
+			require.NoError(t, err)
+			return errBadRecord
+		})
+		assert.ErrorIs(t, err, errBadRecord)
+		err = dtx.WithSavepoint(l, `record_3`, func(l *log.DXLog, dtx *DXDatabaseTx) (err error) {
+			_, err = dtx.Exec(`INSERT INTO t (name) VALUES ('third')`)
+			return err
+		})
+		require.NoError(t, err)
+		return nil
+	})
+	require.NoError(t, err)
+
+	var names []string
+	require.NoError(t, d.Connection.Select(&names, `SELECT name FROM t ORDER BY rowid`))
+	assert.Equal(t, []string{`first`, `third`}, names)
+}
+
+func TestSavepointRefusedByDriverOrName(t *testing.T) {
+	d := newTestSavepointDatabase(t)
+	l := log.NewLog(nil, context.Background(), `test`)
+	err := d.Tx(&l, sql.LevelDefault, func(l *log.DXLog, dtx *DXDatabaseTx) (err error) {
+		return dtx.Savepoint(l, `a; DROP TABLE t`)
+	})
+	assert.ErrorContains(t, err, `InvalidSavepointName`)
+
+	dm := newTestDatabaseManager()
+	sqlite := newTestDatabase(t, dm, `sqlite`)
+	err = sqlite.Tx(&l, sql.LevelDefault, func(l *log.DXLog, dtx *DXDatabaseTx) (err error) {
+		return dtx.WithSavepoint(l, `a`, func(l *log.DXLog, dtx *DXDatabaseTx) (err error) {
+			t.Error(`ran without a savepoint`)
+			return nil
+		})
+	})
+	assert.ErrorContains(t, err, `SavepointNotSupportedByDriver:sqlite`)
+}
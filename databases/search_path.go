@@ -0,0 +1,153 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"dxlib/v3/databases/database_type"
+	"dxlib/v3/databases/protected/db"
+	"dxlib/v3/log"
+)
+
+// SessionInitStatements are the statements run on every new connection of the pool: the ones of the SearchPath and,
+// on oracle, the one tagging the connection with the ApplicationNameOf the database, see ApplicationNameStatement.
+// Postgres takes the name at login, by the application_name of the DSN, see GetConnectionConfig.
+func (d *DXDatabase) SessionInitStatements() (statements []string, err error) {
+	statements, err = d.searchPathStatements()
+	if err != nil {
+		return nil, err
+	}
+	if d.DatabaseType == database_type.PostgreSQL {
+		return statements, nil
+	}
+	s := d.ApplicationNameStatement(d.ApplicationNameOf())
+	if s != `` {
+		statements = append(statements, s)
+	}
+	return statements, nil
+}
+
+// searchPathStatements make the unqualified names resolve against SearchPath: SET search_path for postgres, ALTER
+// SESSION SET CURRENT_SCHEMA for oracle and USE for mysql, the last two take a single schema. Sqlserver has no session
+// default schema, it is the one of the user.
+func (d *DXDatabase) searchPathStatements() (statements []string, err error) {
+	if len(d.SearchPath) == 0 {
+		return nil, nil
+	}
+	driverName := d.DatabaseType.String()
+	schemas := make([]string, len(d.SearchPath))
+	for i, schema := range d.SearchPath {
+		if !databaseNamePattern.MatchString(schema) {
+			err = log.Log.ErrorAndCreateErrorf("configuration is unusable, schema '%s' of the search_path of database %s must have only letters, digits and underscore", schema, d.NameId)
+			return nil, err
+		}
+		schemas[i] = db.FormatIdentifier(driverName, d.IdentifierCase, schema)
+	}
+	switch d.DatabaseType {
+	case database_type.PostgreSQL:
+		return []string{`SET search_path TO ` + strings.Join(schemas, `, `)}, nil
+	case database_type.Oracle, database_type.MySQL:
+		if len(schemas) > 1 {
+			err = log.Log.ErrorAndCreateErrorf("configuration is unusable, search_path of database %s can only have one schema for %s", d.NameId, driverName)
+			return nil, err
+		}
+		if d.DatabaseType == database_type.MySQL {
+			return []string{`USE ` + schemas[0]}, nil
+		}
+		return []string{`ALTER SESSION SET CURRENT_SCHEMA = ` + schemas[0]}, nil
+	default:
+		err = log.Log.ErrorAndCreateErrorf("configuration is unusable, search_path of database %s is not supported for %s, set the default schema of its user", d.NameId, driverName)
+		return nil, err
+	}
+}
+
+// open opens the pool of the database, with the SessionInitStatements run by every new connection.
+func (d *DXDatabase) open() (connection *sqlx.DB, err error) {
+	driverName := d.DatabaseType.String()
+	statements, err := d.SessionInitStatements()
+	if err != nil {
+		return nil, err
+	}
+	if len(statements) == 0 {
+		return sqlx.Open(driverName, d.ConnectionString)
+	}
+	connector, err := openConnector(driverName, d.ConnectionString)
+	if err != nil {
+		return nil, err
+	}
+	return sqlx.NewDb(sql.OpenDB(&dxInitConnector{Connector: connector, statements: statements}), driverName), nil
+}
+
+func openConnector(driverName string, dsn string) (connector driver.Connector, err error) {
+	sqlDB, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	d := sqlDB.Driver()
+	_ = sqlDB.Close()
+	if dc, ok := d.(driver.DriverContext); ok {
+		return dc.OpenConnector(dsn)
+	}
+	return &dxDSNConnector{driver: d, dsn: dsn}, nil
+}
+
+// dxDSNConnector is the connector of the drivers without one.
+type dxDSNConnector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+func (c *dxDSNConnector) Connect(_ context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *dxDSNConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// dxInitConnector runs statements on every connection it makes, a connection failing them is closed.
+type dxInitConnector struct {
+	driver.Connector
+	statements []string
+}
+
+func (c *dxInitConnector) Connect(ctx context.Context) (conn driver.Conn, err error) {
+	conn, err = c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range c.statements {
+		err = execOnConn(ctx, conn, s)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func execOnConn(ctx context.Context, conn driver.Conn, statement string) (err error) {
+	if execer, ok := conn.(driver.ExecerContext); ok {
+		_, err = execer.ExecContext(ctx, statement, nil)
+		if err != driver.ErrSkip {
+			return err
+		}
+	}
+	stmt, err := conn.Prepare(statement)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = stmt.Close()
+	}()
+	if stmtExecer, ok := stmt.(driver.StmtExecContext); ok {
+		_, err = stmtExecer.ExecContext(ctx, nil)
+		return err
+	}
+	_, err = stmt.Exec(nil)
+	return err
+}
@@ -0,0 +1,117 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/databases/database_type"
+)
+
+func TestSearchPathStatements(t *testing.T) {
+	for _, tt := range []struct {
+		databaseType database_type.DXDatabaseType
+		searchPath   []string
+		statements   []string
+		err          string
+	}{
+		{database_type.PostgreSQL, []string{`app`, `public`}, []string{`SET search_path TO "app", "public"`}, ``},
+		{database_type.MySQL, []string{`app`}, []string{"USE `app`"}, ``},
+		{database_type.Oracle, []string{`app`}, []string{`ALTER SESSION SET CURRENT_SCHEMA = "app"`}, ``},
+		{database_type.MySQL, []string{`app`, `public`}, nil, `can only have one schema`},
+		{database_type.SQLServer, []string{`app`}, nil, `is not supported for sqlserver`},
+		{database_type.PostgreSQL, []string{`app; DROP TABLE t`}, nil, `must have only letters, digits and underscore`},
+		{database_type.PostgreSQL, nil, nil, ``},
+	} {
+		t.Run(fmt.Sprintf(`%s %v`, tt.databaseType, tt.searchPath), func(t *testing.T) {
+			d := &DXDatabase{NameId: `test`, DatabaseType: tt.databaseType, SearchPath: tt.searchPath}
+			statements, err := d.searchPathStatements()
+			if tt.err != `` {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.statements, statements)
+		})
+	}
+}
+
+func TestInitStatementsRunOnEveryPooledConnection(t *testing.T) {
+	dir := t.TempDir()
+	app, err := sqlx.Open(`sqlite`, filepath.Join(dir, `app.db`))
+	require.NoError(t, err)
+	_, err = app.Exec(`CREATE TABLE users (name TEXT)`)
+	require.NoError(t, err)
+	_, err = app.Exec(`INSERT INTO users (name) VALUES ('in app')`)
+	require.NoError(t, err)
+	require.NoError(t, app.Close())
+
+	// sqlite resolves an unqualified name against its attached databases, like a search_path
+	connector, err := openConnector(`sqlite`, filepath.Join(dir, `main.db`))
+	require.NoError(t, err)
+	connection := sqlx.NewDb(sql.OpenDB(&dxInitConnector{Connector: connector,
+		statements: []string{fmt.Sprintf(`ATTACH DATABASE '%s' AS app`, filepath.Join(dir, `app.db`))}}), `sqlite`)
+	t.Cleanup(func() {
+		_ = connection.Close()
+	})
+	ctx := context.Background()
+	var conns []*sqlx.Conn
+	for i := 0; i < 3; i++ {
+		conn, err := connection.Connx(ctx)
+		require.NoError(t, err)
+		conns = append(conns, conn)
+		var name string
+		require.NoError(t, conn.GetContext(ctx, &name, `SELECT name FROM users`))
+		assert.Equal(t, `in app`, name)
+	}
+	assert.Equal(t, 3, connection.Stats().OpenConnections)
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+
+	// a connection failing its statements is not given
+	connector, err = openConnector(`sqlite`, filepath.Join(dir, `failing.db`))
+	require.NoError(t, err)
+	failing := sql.OpenDB(&dxInitConnector{Connector: connector, statements: []string{`SET search_path TO app`}})
+	t.Cleanup(func() {
+		_ = failing.Close()
+	})
+	assert.Error(t, failing.Ping())
+}
+
+func TestUnqualifiedNameResolvesAgainstTheSearchPathOfPostgres(t *testing.T) {
+	dsn := os.Getenv(testPostgresDSN)
+	if dsn == `` {
+		t.Skip(testPostgresDSN + ` is not set`)
+	}
+	setup, err := sqlx.Open(`postgres`, dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = setup.Exec(`DROP SCHEMA IF EXISTS search_path_test CASCADE`)
+		_ = setup.Close()
+	})
+	for _, s := range []string{`DROP SCHEMA IF EXISTS search_path_test CASCADE`, `CREATE SCHEMA search_path_test`,
+		`CREATE TABLE search_path_test.search_path_users (name TEXT)`,
+		`INSERT INTO search_path_test.search_path_users (name) VALUES ('in schema')`} {
+		_, err = setup.Exec(s)
+		require.NoError(t, err)
+	}
+
+	d := &DXDatabase{NameId: `search_path`, DatabaseType: database_type.PostgreSQL, ConnectionString: dsn,
+		SearchPath: []string{`search_path_test`, `public`}}
+	connection, err := d.open()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = connection.Close()
+	})
+	var name string
+	require.NoError(t, connection.Get(&name, `SELECT name FROM search_path_users`))
+	assert.Equal(t, `in schema`, name)
+}
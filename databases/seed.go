@@ -0,0 +1,186 @@
+package databases
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/yaml.v3"
+
+	"dxlib/v3/databases/protected/db"
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+)
+
+const (
+	DXDatabaseSeedEnvironmentVariable = `APP_ENV`
+	DXDatabaseSeedEnvironment         = `development`
+	// DXDatabaseSeedOrderFilename lists the table names of the fixtures of a directory in the order they are inserted
+	DXDatabaseSeedOrderFilename = `_order.json`
+)
+
+var ErrSeedNotAllowed = errors.New("SeedNotAllowed")
+
+// DXDatabaseSeedOptions are the options of SeedTables.
+type DXDatabaseSeedOptions struct {
+	// Order are the tables inserted first, in this order, the others follow by their foreign keys
+	Order []string
+	// IsTruncated deletes the rows of the seeded tables first, in the reverse order of the inserts
+	IsTruncated bool
+}
+
+// LoadSeedFiles reads the fixtures of dir, one file a table named after it, like users.json or users.yaml, holding the
+// array of its rows.
+func LoadSeedFiles(dir string) (tables map[string][]utils.JSON, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	tables = map[string][]utils.JSON{}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || entry.Name() == DXDatabaseSeedOrderFilename || (ext != `.json` && ext != `.yaml` && ext != `.yml`) {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		rows := []utils.JSON{}
+		if ext == `.json` {
+			d := json.NewDecoder(bytes.NewReader(content))
+			d.UseNumber()
+			err = d.Decode(&rows)
+		} else {
+			err = yaml.Unmarshal(content, &rows)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("SeedFileInvalid:%s:%w", entry.Name(), err)
+		}
+		tables[strings.TrimSuffix(entry.Name(), ext)] = rows
+	}
+	return tables, nil
+}
+
+// Seed inserts the fixtures of dir, see LoadSeedFiles and SeedTables. The order of DXDatabaseSeedOrderFilename, when dir
+// has one, is used unless o has its own.
+func (d *DXDatabase) Seed(l *log.DXLog, dir string, o DXDatabaseSeedOptions) (rowsAffected int64, err error) {
+	tables, err := LoadSeedFiles(dir)
+	if err != nil {
+		return 0, err
+	}
+	if o.Order == nil {
+		content, err := os.ReadFile(filepath.Join(dir, DXDatabaseSeedOrderFilename))
+		if err == nil {
+			err = json.Unmarshal(content, &o.Order)
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return 0, fmt.Errorf("SeedFileInvalid:%s:%w", DXDatabaseSeedOrderFilename, err)
+		}
+	}
+	return d.SeedTables(l, tables, o)
+}
+
+// SeedTables inserts the rows of tables by db.BulkInsertExt, all in one transaction, the tables of o.Order first and
+// then the others after the tables their foreign keys reference. It fails with ErrSeedNotAllowed unless the environment
+// variable APP_ENV is development, so it never runs in production.
+func (d *DXDatabase) SeedTables(l *log.DXLog, tables map[string][]utils.JSON, o DXDatabaseSeedOptions) (rowsAffected int64, err error) {
+	if os.Getenv(DXDatabaseSeedEnvironmentVariable) != DXDatabaseSeedEnvironment {
+		l.Errorf("Seeding database %s needs %s=%s", d.NameId, DXDatabaseSeedEnvironmentVariable, DXDatabaseSeedEnvironment)
+		return 0, ErrSeedNotAllowed
+	}
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return 0, err
+	}
+	err = d.Tx(l, LevelDefault, func(l *log.DXLog, dtx *DXDatabaseTx) (err error) {
+		order, err := seedOrder(l.Context, dtx.Tx, tables, o.Order)
+		if err != nil {
+			return err
+		}
+		if o.IsTruncated {
+			for i := len(order) - 1; i >= 0; i-- {
+				s := `DELETE FROM ` + order[i]
+				ctx, done := db.StartQuery(l.Context, dtx.Tx, dtx.DriverName(), s)
+				_, err = dtx.Tx.ExecContext(ctx, s)
+				err = done(err)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		for _, tableName := range order {
+			n, err := db.BulkInsertExt(l.Context, dtx.Tx, tableName, tables[tableName], db.DefaultBulkUpsertBatchSize)
+			if err != nil {
+				return fmt.Errorf("SeedTableFailed:%s:%w", tableName, err)
+			}
+			l.Infof("Seeded %d rows into %s", n, tableName)
+			rowsAffected += n
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return rowsAffected, nil
+}
+
+// seedOrder gives the table names of tables, those of order first, then each of the others once the tables its foreign
+// keys reference, among tables, are given.
+func seedOrder(ctx context.Context, e *sqlx.Tx, tables map[string][]utils.JSON, order []string) (r []string, err error) {
+	isGiven := map[string]bool{}
+	for _, tableName := range order {
+		_, ok := tables[tableName]
+		if !ok {
+			return nil, fmt.Errorf("SeedOrderTableNotFound:%s", tableName)
+		}
+		if !isGiven[tableName] {
+			isGiven[tableName] = true
+			r = append(r, tableName)
+		}
+	}
+	references := map[string][]string{}
+	remaining := []string{}
+	for tableName := range tables {
+		if isGiven[tableName] {
+			continue
+		}
+		references[tableName], err = db.ReferencedTables(ctx, e, tableName)
+		if err != nil {
+			return nil, err
+		}
+		remaining = append(remaining, tableName)
+	}
+	sort.Strings(remaining)
+	for len(remaining) > 0 {
+		next := []string{}
+		for _, tableName := range remaining {
+			isReady := true
+			for _, v := range references[tableName] {
+				_, isSeeded := tables[v]
+				if v != tableName && isSeeded && !isGiven[v] {
+					isReady = false
+					break
+				}
+			}
+			if isReady {
+				isGiven[tableName] = true
+				r = append(r, tableName)
+			} else {
+				next = append(next, tableName)
+			}
+		}
+		if len(next) == len(remaining) {
+			return nil, fmt.Errorf("SeedForeignKeyCycle:%s", strings.Join(next, `,`))
+		}
+		remaining = next
+	}
+	return r, nil
+}
@@ -0,0 +1,133 @@
+package databases
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/log"
+)
+
+// newTestSeedDatabase gives a sqlite database enforcing its foreign keys with the tables orgs and users, users
+// referencing orgs.
+func newTestSeedDatabase(t *testing.T) *DXDatabase {
+	t.Helper()
+	connection, err := sqlx.Open(`sqlite`, filepath.Join(t.TempDir(), `seed.db`)+`?_pragma=foreign_keys(1)`)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = connection.Close()
+	})
+	for _, s := range []string{
+		`CREATE TABLE orgs (id INTEGER PRIMARY KEY, name TEXT NOT NULL)`,
+		`CREATE TABLE users (id INTEGER PRIMARY KEY, org_id INTEGER NOT NULL REFERENCES orgs (id), name TEXT NOT NULL)`,
+	} {
+		_, err = connection.Exec(s)
+		require.NoError(t, err)
+	}
+	d := newTestDatabaseManager().NewDatabase(`seed`, false, false)
+	d.Connection = connection
+	d.Connected = true
+	return d
+}
+
+// writeTestSeedFiles writes the fixtures of orgs, as JSON, and of users, as YAML, in a directory it gives.
+func writeTestSeedFiles(t *testing.T, order string) string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, `orgs.json`), []byte(`[{"id": 1, "name": "acme"}, {"id": 2, "name": "globex"}]`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, `users.yaml`), []byte("- id: 1\n  org_id: 1\n  name: alice\n- id: 2\n  org_id: 2\n  name: bob\n- id: 3\n  org_id: 2\n  name: carol\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, `README.md`), []byte(`not a fixture`), 0o600))
+	if order != `` {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, DXDatabaseSeedOrderFilename), []byte(order), 0o600))
+	}
+	return dir
+}
+
+func testSeedLog() *log.DXLog {
+	l := log.NewLog(&log.Log, context.Background(), `seed`)
+	return &l
+}
+
+func TestLoadSeedFiles(t *testing.T) {
+	tables, err := LoadSeedFiles(writeTestSeedFiles(t, `["orgs", "users"]`))
+	require.NoError(t, err)
+	assert.Len(t, tables, 2)
+	assert.Len(t, tables[`orgs`], 2)
+	assert.Equal(t, `alice`, tables[`users`][0][`name`])
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, `orgs.json`), []byte(`{"id": 1}`), 0o600))
+	_, err = LoadSeedFiles(dir)
+	assert.ErrorContains(t, err, `SeedFileInvalid:orgs.json`)
+}
+
+func TestSeedLoadsTwoDependentTables(t *testing.T) {
+	t.Setenv(DXDatabaseSeedEnvironmentVariable, DXDatabaseSeedEnvironment)
+	d := newTestSeedDatabase(t)
+	dir := writeTestSeedFiles(t, `["orgs", "users"]`)
+
+	rowsAffected, err := d.Seed(testSeedLog(), dir, DXDatabaseSeedOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), rowsAffected)
+	var names []string
+	require.NoError(t, d.Connection.Select(&names, `SELECT o.name || '/' || u.name FROM users u JOIN orgs o ON o.id = u.org_id ORDER BY u.id`))
+	assert.Equal(t, []string{`acme/alice`, `globex/bob`, `globex/carol`}, names)
+
+	// seeded again, the rows are deleted first, users before orgs
+	rowsAffected, err = d.Seed(testSeedLog(), dir, DXDatabaseSeedOptions{IsTruncated: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), rowsAffected)
+	var n int
+	require.NoError(t, d.Connection.Get(&n, `SELECT count(*) FROM users`))
+	assert.Equal(t, 3, n)
+}
+
+func TestSeedInTheWrongOrderInsertsNothing(t *testing.T) {
+	t.Setenv(DXDatabaseSeedEnvironmentVariable, DXDatabaseSeedEnvironment)
+	d := newTestSeedDatabase(t)
+
+	// the order of the options is used instead of the one of the directory
+	_, err := d.Seed(testSeedLog(), writeTestSeedFiles(t, `["orgs", "users"]`), DXDatabaseSeedOptions{Order: []string{`users`, `orgs`}})
+	assert.ErrorContains(t, err, `SeedTableFailed:users`)
+	var n int
+	require.NoError(t, d.Connection.Get(&n, `SELECT count(*) FROM orgs`))
+	assert.Equal(t, 0, n)
+
+	_, err = d.Seed(testSeedLog(), writeTestSeedFiles(t, `["orgs", "teams"]`), DXDatabaseSeedOptions{})
+	assert.ErrorContains(t, err, `SeedOrderTableNotFound:teams`)
+}
+
+func TestSeedOutsideDevelopmentIsRefused(t *testing.T) {
+	t.Setenv(DXDatabaseSeedEnvironmentVariable, `production`)
+	d := newTestSeedDatabase(t)
+
+	_, err := d.Seed(testSeedLog(), writeTestSeedFiles(t, `["orgs", "users"]`), DXDatabaseSeedOptions{})
+	assert.ErrorIs(t, err, ErrSeedNotAllowed)
+	var n int
+	require.NoError(t, d.Connection.Get(&n, `SELECT count(*) FROM orgs`))
+	assert.Equal(t, 0, n)
+}
+
+func TestSeedOrdersByTheForeignKeysOfPostgres(t *testing.T) {
+	t.Setenv(DXDatabaseSeedEnvironmentVariable, DXDatabaseSeedEnvironment)
+	d := newTestPostgresDatabase(t, newTestDatabaseManager(), `seed`)
+	for _, s := range []string{`DROP TABLE IF EXISTS users, orgs`,
+		`CREATE TABLE orgs (id BIGINT PRIMARY KEY, name TEXT NOT NULL)`,
+		`CREATE TABLE users (id BIGINT PRIMARY KEY, org_id BIGINT NOT NULL REFERENCES orgs (id), name TEXT NOT NULL)`} {
+		_, err := d.Connection.Exec(s)
+		require.NoError(t, err)
+	}
+	t.Cleanup(func() {
+		_, _ = d.Connection.Exec(`DROP TABLE IF EXISTS users, orgs`)
+	})
+
+	// without an order, users is inserted after orgs, which it references
+	rowsAffected, err := d.Seed(testSeedLog(), writeTestSeedFiles(t, ``), DXDatabaseSeedOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), rowsAffected)
+}
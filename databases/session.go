@@ -0,0 +1,139 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"sync/atomic"
+
+	"dxlib/v3/databases/protected/db"
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+)
+
+// DXDatabaseSession runs all its statements on one connection of the pool, so the state of the session, like SET,
+// SET LOCAL in its Tx, the temporary tables and the advisory locks, is seen by the next statements. The connection is
+// held until Close, which must always be called, usually deferred.
+type DXDatabaseSession struct {
+	Database *DXDatabase
+	Conn     *db.DXConn
+	isClosed atomic.Bool
+	// isTagged is true while the application name of the connection has the route, Close sets it back
+	isTagged bool
+}
+
+func (d *DXDatabase) Session(ctx context.Context) (s *DXDatabaseSession, err error) {
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.NewConn(ctx, d.Connection)
+	if err != nil {
+		log.Log.Errorf("Cannot take a connection of database %s for a session (%v)", d.NameId, err)
+		return nil, err
+	}
+	s = &DXDatabaseSession{Database: d, Conn: conn}
+	db.WatchLeak(s, conn, `session`, func(s *DXDatabaseSession) bool {
+		if !s.isClosed.CompareAndSwap(false, true) {
+			return false
+		}
+		_ = s.Conn.Close()
+		return true
+	})
+	route, ok := RouteFromContext(ctx)
+	if d.IsApplicationNameWithRoute && ok {
+		statement := d.ApplicationNameStatement(d.ApplicationNameOf() + ` ` + route)
+		if statement != `` {
+			_, err = s.Conn.ExecContext(ctx, statement)
+			if err != nil {
+				_ = s.Close()
+				log.Log.Errorf("Cannot set the application name of a session of database %s (%v)", d.NameId, err)
+				return nil, err
+			}
+			s.isTagged = true
+		}
+	}
+	return s, nil
+}
+
+// Session gives a session on the database nameId, see DXDatabaseSession.
+func (dm *DXDatabaseManager) Session(ctx context.Context, nameId string) (s *DXDatabaseSession, err error) {
+	d, ok := dm.Databases[nameId]
+	if !ok {
+		err = log.Log.ErrorAndCreateErrorf("Database %s not found", nameId)
+		return nil, err
+	}
+	return d.Session(ctx)
+}
+
+// Close gives the connection back to the pool, the session state stays on it, except what ends with the session, so
+// the advisory locks it holds must be released before.
+func (s *DXDatabaseSession) Close() (err error) {
+	if !s.isClosed.CompareAndSwap(false, true) {
+		return s.Conn.Close()
+	}
+	if s.isTagged {
+		_, err = s.Conn.ExecContext(context.Background(), s.Database.ApplicationNameStatement(s.Database.ApplicationNameOf()))
+		if err != nil {
+			log.Log.Warnf("Cannot set back the application name of a session of database %s (%v)", s.Database.NameId, err)
+		}
+	}
+	return s.Conn.Close()
+}
+
+func (s *DXDatabaseSession) Execute(ctx context.Context, statement string, parameters utils.JSON) (r sql.Result, err error) {
+	q, args, err := db.PositionalQuery(s.Conn.DriverName(), statement, parameters)
+	if err != nil {
+		return nil, err
+	}
+	ctx, done := db.StartPositionalQueryWithArgs(ctx, s.Conn, s.Conn.DriverName(), q, args, parameters)
+	r, err = s.Conn.ExecContext(ctx, q, args...)
+	err = done(err)
+	return r, err
+}
+
+func (s *DXDatabaseSession) QueryStream(ctx context.Context, query string, args utils.JSON, onRow db.QueryStreamRowFunc) (err error) {
+	return db.QueryStream(ctx, s.Conn, s.Conn.DriverName(), query, args, onRow)
+}
+
+func (s *DXDatabaseSession) ExportCSV(ctx context.Context, w io.Writer, query string, args utils.JSON, o db.CSVOptions) (rowCount int64, err error) {
+	return db.ExportCSV(ctx, s.Conn, s.Conn.DriverName(), s.Database.IdentifierCase, query, args, w, o)
+}
+
+func (s *DXDatabaseSession) QueryRows(ctx context.Context, query string, args utils.JSON) (r []utils.JSON, err error) {
+	r = []utils.JSON{}
+	err = s.QueryStream(ctx, query, args, func(row utils.JSON) error {
+		r = append(r, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// QueryRow gives the first row of the query, nil when there is none.
+func (s *DXDatabaseSession) QueryRow(ctx context.Context, query string, args utils.JSON) (r utils.JSON, err error) {
+	err = s.QueryStream(ctx, query, args, func(row utils.JSON) error {
+		r = row
+		return ErrStopQueryStream
+	})
+	return r, err
+}
+
+func (s *DXDatabaseSession) InsertReturningId(ctx context.Context, tableName string, keyValues utils.JSON, idFieldName string) (id int64, rowsAffected int64, err error) {
+	return db.InsertReturningIdExt(ctx, s.Conn, tableName, keyValues, idFieldName)
+}
+
+// Tx runs callback in a transaction of the connection of the session, like DXDatabase.Tx.
+func (s *DXDatabaseSession) Tx(log *log.DXLog, isolationLevel sql.IsolationLevel, callback DXDatabaseTxCallback) (err error) {
+	tx, err := s.Conn.BeginTxx(log.Context, &sql.TxOptions{
+		Isolation: isolationLevel,
+		ReadOnly:  false,
+	})
+	if err != nil {
+		log.Error(err.Error())
+		return err
+	}
+	return s.Database.runTx(log, &DXDatabaseTx{Tx: tx}, callback)
+}
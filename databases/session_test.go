@@ -0,0 +1,170 @@
+package databases
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/databases/database_type"
+	"dxlib/v3/databases/protected/db"
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+)
+
+// testPostgresDSN names the environment variable of the PostgreSQL the tests needing one run on, they are skipped
+// without it.
+const testPostgresDSN = `DXLIB_TEST_POSTGRES_DSN`
+
+// newTestPostgresDatabase gives the database nameId of DXLIB_TEST_POSTGRES_DSN, or skips.
+func newTestPostgresDatabase(t *testing.T, dm *DXDatabaseManager, nameId string) *DXDatabase {
+	t.Helper()
+	dsn := os.Getenv(testPostgresDSN)
+	if dsn == `` {
+		t.Skip(testPostgresDSN + ` is not set`)
+	}
+	connection, err := sqlx.Open(`postgres`, dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = connection.Close()
+	})
+	require.NoError(t, connection.Ping())
+	d := dm.NewDatabase(nameId, false, false)
+	d.DatabaseType = database_type.PostgreSQL
+	d.Connection = connection
+	d.Connected = true
+	return d
+}
+
+func TestSessionKeepsItsConnectionAcrossCalls(t *testing.T) {
+	dm := newTestDatabaseManager()
+	d := newTestDatabase(t, dm, `session`)
+	ctx := context.Background()
+
+	s, err := dm.Session(ctx, `session`)
+	require.NoError(t, err)
+	// a temporary table is of the connection making it
+	_, err = s.Execute(ctx, `CREATE TEMP TABLE session_state (name TEXT)`, nil)
+	require.NoError(t, err)
+	_, err = s.Execute(ctx, `INSERT INTO session_state (name) VALUES (:name)`, utils.JSON{`name`: `pinned`})
+	require.NoError(t, err)
+	r, err := s.QueryRow(ctx, `SELECT name FROM session_state`, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `pinned`, r[`name`])
+
+	// the pool gives another connection, without the table
+	_, err = d.Connection.Exec(`SELECT name FROM session_state`)
+	assert.ErrorContains(t, err, `no such table`)
+	require.NoError(t, s.Close())
+
+	_, err = dm.Session(ctx, `absent`)
+	assert.ErrorContains(t, err, `Database absent not found`)
+}
+
+func TestSessionHoldsAnAdvisoryLockAcrossCalls(t *testing.T) {
+	dm := newTestDatabaseManager()
+	newTestPostgresDatabase(t, dm, `session`)
+	ctx := context.Background()
+	s, err := dm.Session(ctx, `session`)
+	require.NoError(t, err)
+	defer func() {
+		_ = s.Close()
+	}()
+	other, err := dm.Session(ctx, `session`)
+	require.NoError(t, err)
+	defer func() {
+		_ = other.Close()
+	}()
+
+	_, err = s.Execute(ctx, `select pg_advisory_lock(:key)`, utils.JSON{`key`: int64(349001)})
+	require.NoError(t, err)
+	r, err := other.QueryRow(ctx, `select pg_try_advisory_lock(:key) as acquired`, utils.JSON{`key`: int64(349001)})
+	require.NoError(t, err)
+	assert.Equal(t, false, r[`acquired`])
+	// the unlock is on the connection holding the lock, pg_advisory_unlock is false on any other
+	r, err = s.QueryRow(ctx, `select pg_advisory_unlock(:key) as released`, utils.JSON{`key`: int64(349001)})
+	require.NoError(t, err)
+	assert.Equal(t, true, r[`released`])
+
+	_, err = s.Execute(ctx, `SET application_name = 'pinned'`, nil)
+	require.NoError(t, err)
+	r, err = s.QueryRow(ctx, `SHOW application_name`, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `pinned`, r[`application_name`])
+}
+
+// testSyncBuffer is a log writer for the lines logged by the finalizers.
+type testSyncBuffer struct {
+	mutex sync.Mutex
+	b     bytes.Buffer
+}
+
+func (b *testSyncBuffer) Write(p []byte) (n int, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *testSyncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.b.String()
+}
+
+// abandonTestSession takes a session of nameId and leaves it without Close.
+func abandonTestSession(t *testing.T, dm *DXDatabaseManager, nameId string) {
+	t.Helper()
+	_, err := dm.Session(context.Background(), nameId)
+	require.NoError(t, err)
+}
+
+func TestAbandonedSessionIsReportedAsLeaked(t *testing.T) {
+	isDebug := db.IsDebug
+	db.IsDebug = true
+	t.Cleanup(func() {
+		db.IsDebug = isDebug
+	})
+	b := &testSyncBuffer{}
+	log.SetSinks(log.NewSink(`test`, log.DXLogFormatText, log.DXLogLevelWarn, b))
+	t.Cleanup(func() {
+		log.SetSinks()
+	})
+	dm := newTestDatabaseManager()
+	d := newTestDatabase(t, dm, `leak`)
+
+	abandonTestSession(t, dm, `leak`)
+	held := db.HeldConnections(0)
+	require.Len(t, held, 1)
+	assert.Equal(t, `conn`, held[0].Kind)
+	assert.Contains(t, held[0].Stack, `abandonTestSession`)
+	assert.Empty(t, db.HeldConnections(time.Hour))
+	assert.Equal(t, 1, d.Connection.Stats().InUse)
+
+	require.Eventually(t, func() bool {
+		runtime.GC()
+		return strings.Contains(b.String(), `Leaked session`)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Contains(t, b.String(), `abandonTestSession`)
+	// the leaked session was closed, its connection is back in the pool
+	assert.Empty(t, db.HeldConnections(0))
+	assert.Equal(t, 0, d.Connection.Stats().InUse)
+
+	// a closed session is not reported
+	s, err := dm.Session(context.Background(), `leak`)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+	assert.Empty(t, db.HeldConnections(0))
+	for i := 0; i < 3; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 1, strings.Count(b.String(), `Leaked session`))
+}
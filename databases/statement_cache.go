@@ -0,0 +1,113 @@
+package databases
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const DXDatabaseDefaultStatementCacheSize = 0
+
+type dxStatementCacheEntry struct {
+	query     string
+	stmt      *sqlx.Stmt
+	refs      int
+	isEvicted bool
+	element   *list.Element
+}
+
+// DXDatabaseStatementCache keeps up to Size prepared statements by query, the least recently used one is closed when a
+// new one does not fit. An evicted statement still in use is closed by its last release.
+type DXDatabaseStatementCache struct {
+	Size    int
+	mutex   sync.Mutex
+	entries map[string]*dxStatementCacheEntry
+	order   *list.List
+}
+
+func NewStatementCache(size int) *DXDatabaseStatementCache {
+	return &DXDatabaseStatementCache{
+		Size:    size,
+		entries: map[string]*dxStatementCacheEntry{},
+		order:   list.New(),
+	}
+}
+
+func (c *DXDatabaseStatementCache) acquire(query string) (e *dxStatementCacheEntry) {
+	e, ok := c.entries[query]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(e.element)
+	e.refs++
+	return e
+}
+
+func (c *DXDatabaseStatementCache) releaseFunc(e *dxStatementCacheEntry) func() {
+	return func() {
+		c.mutex.Lock()
+		e.refs--
+		isClose := e.isEvicted && e.refs == 0
+		c.mutex.Unlock()
+		if isClose {
+			_ = e.stmt.Close()
+		}
+	}
+}
+
+// Statement gives the prepared statement of query, preparing it on connection when not cached. release must be called
+// once the statement is not used anymore.
+func (c *DXDatabaseStatementCache) Statement(ctx context.Context, connection *sqlx.DB, query string) (stmt *sqlx.Stmt, release func(), err error) {
+	c.mutex.Lock()
+	e := c.acquire(query)
+	c.mutex.Unlock()
+	if e != nil {
+		return e.stmt, c.releaseFunc(e), nil
+	}
+	stmt, err = connection.PreparexContext(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	// another goroutine may have prepared the same query meanwhile
+	e = c.acquire(query)
+	if e != nil {
+		_ = stmt.Close()
+		return e.stmt, c.releaseFunc(e), nil
+	}
+	e = &dxStatementCacheEntry{query: query, stmt: stmt, refs: 1}
+	e.element = c.order.PushFront(e)
+	c.entries[query] = e
+	for c.order.Len() > c.Size {
+		c.evict(c.order.Back().Value.(*dxStatementCacheEntry))
+	}
+	return stmt, c.releaseFunc(e), nil
+}
+
+func (c *DXDatabaseStatementCache) evict(e *dxStatementCacheEntry) {
+	c.order.Remove(e.element)
+	delete(c.entries, e.query)
+	e.isEvicted = true
+	if e.refs == 0 {
+		_ = e.stmt.Close()
+	}
+}
+
+func (c *DXDatabaseStatementCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.order.Len()
+}
+
+// Clear evicts every statement, like at the disconnection of the database.
+func (c *DXDatabaseStatementCache) Clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for c.order.Len() > 0 {
+		c.evict(c.order.Back().Value.(*dxStatementCacheEntry))
+	}
+}
@@ -0,0 +1,130 @@
+package databases
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatementCacheEvictsTheLeastRecentlyUsed(t *testing.T) {
+	d := newTestDatabase(t, newTestDatabaseManager(), `test`)
+	c := NewStatementCache(2)
+	ctx := context.Background()
+
+	statement := func(query string) (stmt func() error, release func()) {
+		s, release, err := c.Statement(ctx, d.Connection, query)
+		require.NoError(t, err)
+		return func() error {
+			var n int
+			return s.Get(&n)
+		}, release
+	}
+	a, release := statement(`SELECT 1`)
+	release()
+	b, release := statement(`SELECT 2`)
+	release()
+	// SELECT 1 is used again, SELECT 2 is now the least recently used
+	_, release = statement(`SELECT 1`)
+	release()
+	_, release = statement(`SELECT 3`)
+	release()
+	assert.Equal(t, 2, c.Len())
+	assert.NoError(t, a())
+	assert.Error(t, b(), `the evicted statement was not closed`)
+
+	// an evicted statement still in use is closed by its release
+	inUse, releaseInUse := statement(`SELECT 4`)
+	_, release = statement(`SELECT 5`)
+	release()
+	_, release = statement(`SELECT 6`)
+	release()
+	assert.NoError(t, inUse())
+	releaseInUse()
+	assert.Error(t, inUse())
+
+	c.Clear()
+	assert.Equal(t, 0, c.Len())
+	assert.Error(t, a())
+}
+
+func TestStatementCacheIsSharedByConcurrentCallers(t *testing.T) {
+	d := newTestDatabase(t, newTestDatabaseManager(), `test`)
+	c := NewStatementCache(4)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			stmt, release, err := c.Statement(context.Background(), d.Connection, fmt.Sprintf(`SELECT %d`, i%8))
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer release()
+			var n int
+			assert.NoError(t, stmt.Get(&n))
+			assert.Equal(t, i%8, n)
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 4, c.Len())
+}
+
+func TestPreparedStatementUsesTheCache(t *testing.T) {
+	d := newTestDatabase(t, newTestDatabaseManager(), `test`)
+	d.IsPreparedStatements = true
+	d.StatementCache = NewStatementCache(2)
+
+	first, release, err := d.PreparedStatement(context.Background(), `SELECT name FROM t`)
+	require.NoError(t, err)
+	release()
+	second, release, err := d.PreparedStatement(context.Background(), `SELECT name FROM t`)
+	require.NoError(t, err)
+	release()
+	assert.Same(t, first, second)
+}
+
+// benchmarkStatement queries a row b.N times through a statement from statement, each released after its query.
+func benchmarkStatement(b *testing.B, statement func(d *DXDatabase, query string) (stmt *sqlx.Stmt, release func(), err error)) {
+	d := newTestDatabase(b, newTestDatabaseManager(), `bench`)
+	_, err := d.Connection.Exec(`INSERT INTO t (name) VALUES ('a')`)
+	require.NoError(b, err)
+	query := `SELECT name FROM t WHERE name = ? AND length(name) > 0 ORDER BY name LIMIT 1`
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		stmt, release, err := statement(d, query)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var name string
+		err = stmt.Get(&name, `a`)
+		release()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkStatementPreparedEachQuery(b *testing.B) {
+	benchmarkStatement(b, func(d *DXDatabase, query string) (stmt *sqlx.Stmt, release func(), err error) {
+		stmt, err = d.Connection.PreparexContext(context.Background(), query)
+		if err != nil {
+			return nil, nil, err
+		}
+		return stmt, func() {
+			_ = stmt.Close()
+		}, nil
+	})
+}
+
+func BenchmarkStatementFromTheCache(b *testing.B) {
+	c := NewStatementCache(16)
+	b.Cleanup(c.Clear)
+	benchmarkStatement(b, func(d *DXDatabase, query string) (stmt *sqlx.Stmt, release func(), err error) {
+		return c.Statement(context.Background(), d.Connection, query)
+	})
+}
@@ -0,0 +1,222 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"dxlib/v3/databases/database_type"
+	"dxlib/v3/databases/protected/db"
+	"dxlib/v3/log"
+)
+
+const DXDatabaseTenantDefaultCacheTTL = 5 * time.Minute
+
+type tenantIdContextKey struct{}
+
+// DXDatabaseTenant is where the data of a tenant is, its own databases or, with Schema, a schema of shared ones.
+type DXDatabaseTenant struct {
+	DatabaseNameId string
+	// ReadDatabaseNameId is the replica read by ReadDBForTenant, empty is DatabaseNameId
+	ReadDatabaseNameId string
+	// Schema is searched before the search path of the databases by the transactions of TxForTenant, sharing the pool
+	// of the databases with the other tenants
+	Schema string
+}
+
+// DXDatabaseTenantResolver gives the databases of a tenant id, it is called again for a tenant once its result is
+// older than TenantCacheTTL, so the tenants onboarded or moved are found without a restart.
+type DXDatabaseTenantResolver func(ctx context.Context, tenantId string) (t DXDatabaseTenant, err error)
+
+type dxDatabaseTenantEntry struct {
+	tenant    DXDatabaseTenant
+	expiresAt time.Time
+}
+
+type dxDatabaseTenants struct {
+	mutex   sync.Mutex
+	entries map[string]dxDatabaseTenantEntry
+	// resolveGroup calls TenantResolver once for the concurrent requests of a tenant, connectGroup connects a database
+	// once for the concurrent first uses
+	resolveGroup singleflight.Group
+	connectGroup singleflight.Group
+}
+
+// ErrTenantSchemaNeedsTx is the error of WriteDBForTenant and ReadDBForTenant for a schema tenant.
+var ErrTenantSchemaNeedsTx = errors.New("TenantSchemaNeedsTx")
+
+func ContextWithTenantId(ctx context.Context, tenantId string) context.Context {
+	return context.WithValue(ctx, tenantIdContextKey{}, tenantId)
+}
+
+func TenantIdFromContext(ctx context.Context) (tenantId string, ok bool) {
+	if ctx == nil {
+		return ``, false
+	}
+	tenantId, ok = ctx.Value(tenantIdContextKey{}).(string)
+	return tenantId, ok && tenantId != ``
+}
+
+// RegisterTenant sets the databases of a tenant until ForgetTenant, without calling TenantResolver.
+func (dm *DXDatabaseManager) RegisterTenant(tenantId string, t DXDatabaseTenant) {
+	dm.tenants.mutex.Lock()
+	defer dm.tenants.mutex.Unlock()
+	if dm.tenants.entries == nil {
+		dm.tenants.entries = map[string]dxDatabaseTenantEntry{}
+	}
+	dm.tenants.entries[tenantId] = dxDatabaseTenantEntry{tenant: t}
+}
+
+// ForgetTenant drops what is known of a tenant, its next request resolves it again.
+func (dm *DXDatabaseManager) ForgetTenant(tenantId string) {
+	dm.tenants.mutex.Lock()
+	defer dm.tenants.mutex.Unlock()
+	delete(dm.tenants.entries, tenantId)
+}
+
+func (dm *DXDatabaseManager) resolveTenant(ctx context.Context) (tenantId string, t DXDatabaseTenant, err error) {
+	tenantId, ok := TenantIdFromContext(ctx)
+	if !ok {
+		return ``, t, fmt.Errorf("TenantIdNotInContext")
+	}
+	dm.tenants.mutex.Lock()
+	e, ok := dm.tenants.entries[tenantId]
+	dm.tenants.mutex.Unlock()
+	if ok && (e.expiresAt.IsZero() || time.Now().Before(e.expiresAt)) {
+		return tenantId, e.tenant, nil
+	}
+	if dm.TenantResolver == nil {
+		return tenantId, t, fmt.Errorf("TenantNotFound:%s", tenantId)
+	}
+	r, err, _ := dm.tenants.resolveGroup.Do(tenantId, func() (any, error) {
+		t, err := dm.TenantResolver(ctx, tenantId)
+		if err != nil {
+			return t, err
+		}
+		ttl := dm.TenantCacheTTL
+		if ttl <= 0 {
+			ttl = DXDatabaseTenantDefaultCacheTTL
+		}
+		dm.tenants.mutex.Lock()
+		defer dm.tenants.mutex.Unlock()
+		if dm.tenants.entries == nil {
+			dm.tenants.entries = map[string]dxDatabaseTenantEntry{}
+		}
+		dm.tenants.entries[tenantId] = dxDatabaseTenantEntry{tenant: t, expiresAt: time.Now().Add(ttl)}
+		return t, nil
+	})
+	if err != nil {
+		return tenantId, t, err
+	}
+	return tenantId, r.(DXDatabaseTenant), nil
+}
+
+// tenantDatabase gives the database nameId of a tenant, connected on the first use. The concurrent first uses connect
+// it once, outside of the lock of the tenants.
+func (dm *DXDatabaseManager) tenantDatabase(tenantId string, nameId string) (d *DXDatabase, err error) {
+	d, ok := dm.Databases[nameId]
+	if !ok {
+		return nil, fmt.Errorf("TenantDatabaseNotFound:%s,%s", tenantId, nameId)
+	}
+	_, err, _ = dm.tenants.connectGroup.Do(nameId, func() (any, error) {
+		return nil, d.Connect()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// tenantSearchPathStatement makes the unqualified names of a transaction resolve against schema first, then the
+// SearchPath of d. It is SET LOCAL of postgres, the other databases have no search path ending with the transaction.
+func (d *DXDatabase) tenantSearchPathStatement(tenantId string, schema string) (statement string, err error) {
+	if !databaseNamePattern.MatchString(schema) {
+		return ``, fmt.Errorf("InvalidTenantSchema:%s,%s", tenantId, schema)
+	}
+	if d.DatabaseType != database_type.PostgreSQL {
+		return ``, fmt.Errorf("TenantSchemaNotSupported:%s,%s", tenantId, d.DatabaseType.String())
+	}
+	driverName := d.DatabaseType.String()
+	schemas := []string{db.FormatIdentifier(driverName, d.IdentifierCase, schema)}
+	for _, v := range d.SearchPath {
+		schemas = append(schemas, db.FormatIdentifier(driverName, d.IdentifierCase, v))
+	}
+	return `SET LOCAL search_path TO ` + strings.Join(schemas, `, `), nil
+}
+
+// txForTenant runs callback in a transaction of the database of the tenant id of ctx, searching the schema of a schema
+// tenant first.
+func (dm *DXDatabaseManager) txForTenant(ctx context.Context, l *log.DXLog, isolationLevel sql.IsolationLevel, isRead bool, callback DXDatabaseTxCallback) (err error) {
+	tenantId, t, err := dm.resolveTenant(ctx)
+	if err != nil {
+		return err
+	}
+	nameId := t.DatabaseNameId
+	if isRead && t.ReadDatabaseNameId != `` {
+		nameId = t.ReadDatabaseNameId
+	}
+	d, err := dm.tenantDatabase(tenantId, nameId)
+	if err != nil {
+		return err
+	}
+	if t.Schema == `` {
+		return d.Tx(l, isolationLevel, callback)
+	}
+	statement, err := d.tenantSearchPathStatement(tenantId, t.Schema)
+	if err != nil {
+		return err
+	}
+	return d.Tx(l, isolationLevel, func(l *log.DXLog, dtx *DXDatabaseTx) (err error) {
+		_, err = dtx.ExecContext(l.Context, statement)
+		if err != nil {
+			return err
+		}
+		return callback(l, dtx)
+	})
+}
+
+// TxForTenant runs callback in a transaction of the database of the tenant id of ctx, set by ContextWithTenantId. The
+// schema tenants share the pool of their database, their schema is only searched in these transactions.
+func (dm *DXDatabaseManager) TxForTenant(ctx context.Context, l *log.DXLog, isolationLevel sql.IsolationLevel, callback DXDatabaseTxCallback) (err error) {
+	return dm.txForTenant(ctx, l, isolationLevel, false, callback)
+}
+
+// ReadTxForTenant is TxForTenant on the replica of the tenant, or its database when it has none.
+func (dm *DXDatabaseManager) ReadTxForTenant(ctx context.Context, l *log.DXLog, isolationLevel sql.IsolationLevel, callback DXDatabaseTxCallback) (err error) {
+	return dm.txForTenant(ctx, l, isolationLevel, true, callback)
+}
+
+// WriteDBForTenant gives the database of the tenant id of ctx, set by ContextWithTenantId. A schema tenant shares the
+// pool of its database, it is ErrTenantSchemaNeedsTx, its queries run in TxForTenant.
+func (dm *DXDatabaseManager) WriteDBForTenant(ctx context.Context) (d *DXDatabase, err error) {
+	tenantId, t, err := dm.resolveTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if t.Schema != `` {
+		return nil, fmt.Errorf("%w:%s", ErrTenantSchemaNeedsTx, tenantId)
+	}
+	return dm.tenantDatabase(tenantId, t.DatabaseNameId)
+}
+
+// ReadDBForTenant gives the replica of the tenant id of ctx, or its database when it has none, see WriteDBForTenant.
+func (dm *DXDatabaseManager) ReadDBForTenant(ctx context.Context) (d *DXDatabase, err error) {
+	tenantId, t, err := dm.resolveTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if t.Schema != `` {
+		return nil, fmt.Errorf("%w:%s", ErrTenantSchemaNeedsTx, tenantId)
+	}
+	nameId := t.ReadDatabaseNameId
+	if nameId == `` {
+		nameId = t.DatabaseNameId
+	}
+	return dm.tenantDatabase(tenantId, nameId)
+}
@@ -0,0 +1,146 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+
+	"dxlib/v3/databases/database_type"
+	"dxlib/v3/log"
+)
+
+// newTestDatabase gives a database nameId of dm on a sqlite file, closed at the end of the test.
+func newTestDatabase(t testing.TB, dm *DXDatabaseManager, nameId string) *DXDatabase {
+	t.Helper()
+	connection, err := sqlx.Open(`sqlite`, filepath.Join(t.TempDir(), nameId+`.db`))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = connection.Close()
+	})
+	_, err = connection.Exec(`CREATE TABLE t (name TEXT NOT NULL)`)
+	require.NoError(t, err)
+	d := dm.NewDatabase(nameId, false, false)
+	d.Connection = connection
+	d.Connected = true
+	return d
+}
+
+func newTestDatabaseManager() *DXDatabaseManager {
+	return &DXDatabaseManager{Databases: map[string]*DXDatabase{}, TenantCacheTTL: DXDatabaseTenantDefaultCacheTTL}
+}
+
+func TestDBForTenantRoutesTheDatabaseTenants(t *testing.T) {
+	dm := newTestDatabaseManager()
+	a := newTestDatabase(t, dm, `a`)
+	b := newTestDatabase(t, dm, `b`)
+	bReplica := newTestDatabase(t, dm, `b-replica`)
+	dm.RegisterTenant(`1`, DXDatabaseTenant{DatabaseNameId: `a`})
+	dm.RegisterTenant(`2`, DXDatabaseTenant{DatabaseNameId: `b`, ReadDatabaseNameId: `b-replica`})
+
+	d, err := dm.WriteDBForTenant(ContextWithTenantId(context.Background(), `1`))
+	require.NoError(t, err)
+	assert.Same(t, a, d)
+	d, err = dm.ReadDBForTenant(ContextWithTenantId(context.Background(), `1`))
+	require.NoError(t, err)
+	assert.Same(t, a, d)
+	d, err = dm.WriteDBForTenant(ContextWithTenantId(context.Background(), `2`))
+	require.NoError(t, err)
+	assert.Same(t, b, d)
+	d, err = dm.ReadDBForTenant(ContextWithTenantId(context.Background(), `2`))
+	require.NoError(t, err)
+	assert.Same(t, bReplica, d)
+
+	_, err = dm.WriteDBForTenant(context.Background())
+	assert.Error(t, err)
+	_, err = dm.WriteDBForTenant(ContextWithTenantId(context.Background(), `3`))
+	assert.ErrorContains(t, err, `TenantNotFound:3`)
+}
+
+func TestTxForTenantWritesTheDatabaseOfTheTenant(t *testing.T) {
+	dm := newTestDatabaseManager()
+	a := newTestDatabase(t, dm, `a`)
+	b := newTestDatabase(t, dm, `b`)
+	dm.RegisterTenant(`1`, DXDatabaseTenant{DatabaseNameId: `b`})
+
+	l := log.NewLog(nil, context.Background(), `test`)
+	err := dm.TxForTenant(ContextWithTenantId(context.Background(), `1`), &l, sql.LevelDefault, func(l *log.DXLog, dtx *DXDatabaseTx) (err error) {
+		_, err = dtx.Exec(`INSERT INTO t (name) VALUES ('x')`)
+		return err
+	})
+	require.NoError(t, err)
+	var n int
+	require.NoError(t, a.Connection.Get(&n, `SELECT count(*) FROM t`))
+	assert.Equal(t, 0, n)
+	require.NoError(t, b.Connection.Get(&n, `SELECT count(*) FROM t`))
+	assert.Equal(t, 1, n)
+}
+
+func TestResolveTenantCallsTheResolverOnceForConcurrentRequests(t *testing.T) {
+	dm := newTestDatabaseManager()
+	newTestDatabase(t, dm, `a`)
+	calls := atomic.Int32{}
+	dm.TenantResolver = func(ctx context.Context, tenantId string) (t DXDatabaseTenant, err error) {
+		calls.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		return DXDatabaseTenant{DatabaseNameId: `a`}, nil
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := dm.WriteDBForTenant(ContextWithTenantId(context.Background(), `1`))
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load())
+
+	// an expired resolution is resolved again, like a tenant moved to another database
+	dm.TenantCacheTTL = time.Nanosecond
+	dm.ForgetTenant(`1`)
+	_, err := dm.WriteDBForTenant(ContextWithTenantId(context.Background(), `1`))
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond)
+	_, err = dm.WriteDBForTenant(ContextWithTenantId(context.Background(), `1`))
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestSchemaTenantSharesThePoolOfItsDatabase(t *testing.T) {
+	dm := newTestDatabaseManager()
+	newTestDatabase(t, dm, `a`)
+	dm.RegisterTenant(`1`, DXDatabaseTenant{DatabaseNameId: `a`, Schema: `tenant_1`})
+	ctx := ContextWithTenantId(context.Background(), `1`)
+
+	_, err := dm.WriteDBForTenant(ctx)
+	assert.ErrorIs(t, err, ErrTenantSchemaNeedsTx)
+	_, err = dm.ReadDBForTenant(ctx)
+	assert.ErrorIs(t, err, ErrTenantSchemaNeedsTx)
+
+	// sqlite has no search path
+	l := log.NewLog(nil, context.Background(), `test`)
+	err = dm.TxForTenant(ctx, &l, sql.LevelDefault, func(l *log.DXLog, dtx *DXDatabaseTx) (err error) {
+		return nil
+	})
+	assert.ErrorContains(t, err, `TenantSchemaNotSupported`)
+}
+
+func TestTenantSearchPathStatement(t *testing.T) {
+	d := DXDatabase{NameId: `a`, DatabaseType: database_type.PostgreSQL, SearchPath: []string{`public`}}
+	s, err := d.tenantSearchPathStatement(`1`, `tenant_1`)
+	require.NoError(t, err)
+	assert.Equal(t, `SET LOCAL search_path TO "tenant_1", "public"`, s)
+
+	_, err = d.tenantSearchPathStatement(`1`, `tenant_1; DROP TABLE t`)
+	assert.ErrorContains(t, err, `InvalidTenantSchema`)
+}
@@ -0,0 +1,46 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const (
+	// DXDatabaseDefaultMaxIdleConnections is the default of database/sql
+	DXDatabaseDefaultMaxIdleConnections = 2
+	DXDatabaseWarmUpTimeout             = 30 * time.Second
+)
+
+// warmUp opens WarmUpConnections connections at once and pings each of them, they are then left idle in the pool. A
+// wrong password or an unreachable server fails here instead of at the first query.
+func (d *DXDatabase) warmUp(ctx context.Context) (err error) {
+	maxIdleConnections := d.MaxIdleConnections
+	if maxIdleConnections <= 0 {
+		maxIdleConnections = DXDatabaseDefaultMaxIdleConnections
+	}
+	n := d.WarmUpConnections
+	if n <= 0 || n > maxIdleConnections {
+		n = maxIdleConnections
+	}
+	ctx, cancel := context.WithTimeout(ctx, DXDatabaseWarmUpTimeout)
+	defer cancel()
+	connections := make([]*sql.Conn, 0, n)
+	defer func() {
+		for _, c := range connections {
+			_ = c.Close()
+		}
+	}()
+	for i := 0; i < n; i++ {
+		c, err := d.Connection.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		connections = append(connections, c)
+		err = c.PingContext(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/databases/database_type"
+)
+
+func TestWarmUpLeavesTheConnectionsIdle(t *testing.T) {
+	for _, tt := range []struct {
+		maxIdleConnections int
+		warmUpConnections  int
+		idle               int
+	}{
+		{0, 0, DXDatabaseDefaultMaxIdleConnections},
+		{4, 0, 4},
+		{4, 3, 3},
+		{2, 5, 2},
+	} {
+		t.Run(strconv.Itoa(tt.maxIdleConnections)+`/`+strconv.Itoa(tt.warmUpConnections), func(t *testing.T) {
+			d := newTestDatabase(t, newTestDatabaseManager(), `warm_up`)
+			d.MaxIdleConnections = tt.maxIdleConnections
+			d.WarmUpConnections = tt.warmUpConnections
+			if d.MaxIdleConnections > 0 {
+				d.Connection.SetMaxIdleConns(d.MaxIdleConnections)
+			}
+
+			require.NoError(t, d.warmUp(context.Background()))
+			stats := d.Connection.Stats()
+			assert.Equal(t, tt.idle, stats.Idle)
+			assert.Equal(t, tt.idle, stats.OpenConnections)
+		})
+	}
+}
+
+func TestWarmUpFailsWhenAConnectionCannotStart(t *testing.T) {
+	connector, err := openConnector(`sqlite`, filepath.Join(t.TempDir(), `failing.db`))
+	require.NoError(t, err)
+	connection := sqlx.NewDb(sql.OpenDB(&dxInitConnector{Connector: connector, statements: []string{`SET search_path TO app`}}), `sqlite`)
+	t.Cleanup(func() {
+		_ = connection.Close()
+	})
+	d := &DXDatabase{NameId: `failing`, Connection: connection}
+
+	assert.Error(t, d.warmUp(context.Background()))
+	assert.Equal(t, 0, connection.Stats().OpenConnections)
+}
+
+func TestConnectWarmsUpThePoolOfPostgres(t *testing.T) {
+	dsn := os.Getenv(testPostgresDSN)
+	if dsn == `` {
+		t.Skip(testPostgresDSN + ` is not set`)
+	}
+	d := &DXDatabase{NameId: `warm_up`, DatabaseType: database_type.PostgreSQL, ConnectionString: dsn,
+		MaxIdleConnections: 3, IsWarmUp: true}
+	require.NoError(t, d.Connect())
+	t.Cleanup(func() {
+		_ = d.Disconnect()
+	})
+
+	stats := d.Connection.Stats()
+	assert.Equal(t, 3, stats.Idle)
+	assert.Equal(t, 3, stats.OpenConnections)
+}
@@ -0,0 +1,317 @@
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"dxlib/v3/configurations"
+	"dxlib/v3/log"
+	"dxlib/v3/redis"
+	"dxlib/v3/subsystems"
+	"dxlib/v3/utils"
+	json2 "dxlib/v3/utils/json"
+)
+
+const (
+	DXFlagDefaultRedisKey           = "dxfeatures"
+	DXFlagDefaultRefreshIntervalSec = 30
+	DXFlagDefaultRolloutAttribute   = "user_id"
+)
+
+// DXFlag is the definition of a feature flag. Without RolloutPercentage every evaluation gives Value, with it only the
+// targets whose RolloutAttribute falls in the first RolloutPercentage buckets get Value, the others get the default.
+type DXFlag struct {
+	NameId            string
+	Value             any
+	RolloutPercentage float64
+	RolloutAttribute  string
+	IsRollout         bool
+}
+
+// DXFlagManager evaluates the flags of the "features" configuration, overlaid by the fields of the Redis hash RedisKey
+// when RedisNameId is set. A Redis field holds the JSON of a value or of a flag definition, like the configuration.
+type DXFlagManager struct {
+	Flags              map[string]*DXFlag
+	Overrides          map[string]*DXFlag
+	RedisNameId        string
+	RedisKey           string
+	RefreshIntervalSec int
+	IsRefreshFatal     bool
+	mutex              sync.RWMutex
+}
+
+// NewFlag reads a definition, either a bare value or a JSON with value, rollout_percentage and rollout_attribute.
+func NewFlag(nameId string, v any) (f *DXFlag, err error) {
+	f = &DXFlag{NameId: nameId, Value: v, RolloutAttribute: DXFlagDefaultRolloutAttribute}
+	d, ok := v.(utils.JSON)
+	if !ok {
+		return f, nil
+	}
+	value, ok := d[`value`]
+	if !ok {
+		return nil, fmt.Errorf("FlagValueIsMissing:%s", nameId)
+	}
+	f.Value = value
+	if p, ok := d[`rollout_percentage`]; ok {
+		percentage, err := toFloat64(p)
+		if err != nil {
+			return nil, fmt.Errorf("FlagRolloutPercentageIsInvalid:%s:%v", nameId, p)
+		}
+		f.RolloutPercentage = percentage
+		f.IsRollout = true
+	}
+	if a, ok := d[`rollout_attribute`].(string); ok && a != `` {
+		f.RolloutAttribute = a
+	}
+	return f, nil
+}
+
+// toFloat64 also takes the int of the YAML configurations.
+func toFloat64(v any) (r float64, err error) {
+	if i, ok := v.(int); ok {
+		return float64(i), nil
+	}
+	x, err := utils.ConvertToInterfaceFloat64FromAny(v)
+	if err != nil {
+		return 0, err
+	}
+	if x == nil {
+		return 0, fmt.Errorf("FlagValueIsNull")
+	}
+	return x.(float64), nil
+}
+
+// Bucket places key in one of the 100 buckets of the flag nameId, the same key always gets the same bucket of a flag
+// while the buckets of different flags are independent.
+func Bucket(nameId string, key string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(nameId + "/" + key))
+	return int(h.Sum32() % 100)
+}
+
+// evaluate gives the value of f for target, ok is false when the default must be used.
+func (f *DXFlag) evaluate(target utils.JSON) (v any, ok bool) {
+	if !f.IsRollout {
+		return f.Value, true
+	}
+	a, isExist := target[f.RolloutAttribute]
+	if !isExist || a == nil {
+		return nil, false
+	}
+	if float64(Bucket(f.NameId, fmt.Sprint(a))) >= f.RolloutPercentage {
+		return nil, false
+	}
+	return f.Value, true
+}
+
+func (fm *DXFlagManager) LoadFromConfiguration(configurationNameId string) (err error) {
+	configuration, err := configurations.Manager.Lookup(configurationNameId)
+	if err != nil {
+		return err
+	}
+	c := *configuration.Data
+	fm.RedisNameId, _ = c[`redis`].(string)
+	fm.RedisKey, _ = c[`redis_key`].(string)
+	if fm.RedisKey == `` {
+		fm.RedisKey = DXFlagDefaultRedisKey
+	}
+	fm.RefreshIntervalSec = json2.GetNumberWithDefault(c, `refresh_interval_sec`, DXFlagDefaultRefreshIntervalSec)
+	fm.IsRefreshFatal, _ = c[`is_refresh_fatal`].(bool)
+	flags := map[string]*DXFlag{}
+	if c[`flags`] != nil {
+		d, ok := c[`flags`].(utils.JSON)
+		if !ok {
+			err = log.Log.ErrorAndCreateErrorf("Cannot read flags of configuration %s as JSON", configurationNameId)
+			return err
+		}
+		for k, v := range d {
+			f, err := NewFlag(k, v)
+			if err != nil {
+				log.Log.Errorf("Cannot read flag %s of configuration %s (%v)", k, configurationNameId, err)
+				return err
+			}
+			flags[k] = f
+		}
+	}
+	fm.mutex.Lock()
+	fm.Flags = flags
+	fm.mutex.Unlock()
+	return nil
+}
+
+// Refresh reads the overrides of the Redis hash again, a field that is not valid JSON is taken as a string value.
+func (fm *DXFlagManager) Refresh(ctx context.Context) (err error) {
+	if fm.RedisNameId == `` {
+		return nil
+	}
+	r, ok := redis.Manager.Redises[fm.RedisNameId]
+	if !ok || !r.IsAvailable() {
+		err = log.Log.ErrorAndCreateErrorf("Redis %s of the flags not found or not connected", fm.RedisNameId)
+		return err
+	}
+	fields, err := r.Connection.HGetAll(ctx, fm.RedisKey).Result()
+	if err != nil {
+		return err
+	}
+	overrides := map[string]*DXFlag{}
+	for k, s := range fields {
+		var v any
+		err = json.Unmarshal([]byte(s), &v)
+		if err != nil {
+			v = s
+		}
+		f, err := NewFlag(k, v)
+		if err != nil {
+			log.Log.Warnf("Ignoring override of flag %s in Redis %s key %s (%v)", k, fm.RedisNameId, fm.RedisKey, err)
+			continue
+		}
+		overrides[k] = f
+	}
+	fm.mutex.Lock()
+	fm.Overrides = overrides
+	fm.mutex.Unlock()
+	return nil
+}
+
+// StartAll refreshes the overrides once, then every RefreshIntervalSec until errorGroupContext is done. A failed refresh
+// keeps the previous overrides.
+func (fm *DXFlagManager) StartAll(errorGroup *errgroup.Group, errorGroupContext context.Context) (err error) {
+	if fm.RedisNameId == `` {
+		return nil
+	}
+	err = fm.Refresh(errorGroupContext)
+	if err != nil {
+		log.Log.Errorf("Cannot read the flag overrides of Redis %s key %s (%v)", fm.RedisNameId, fm.RedisKey, err)
+		if fm.IsRefreshFatal {
+			return err
+		}
+	}
+	interval := time.Duration(fm.RefreshIntervalSec) * time.Second
+	if interval <= 0 {
+		interval = DXFlagDefaultRefreshIntervalSec * time.Second
+	}
+	subsystems.Go(errorGroup, errorGroupContext, `flags`, fm.IsRefreshFatal, func() error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-errorGroupContext.Done():
+				return nil
+			case <-ticker.C:
+			}
+			err := fm.Refresh(errorGroupContext)
+			if err != nil {
+				if fm.IsRefreshFatal {
+					return err
+				}
+				log.Log.Warnf("Cannot refresh the flag overrides of Redis %s key %s (%v)", fm.RedisNameId, fm.RedisKey, err)
+			}
+		}
+	})
+	return nil
+}
+
+// Lookup gives the definition of nameId, the Redis override first.
+func (fm *DXFlagManager) Lookup(nameId string) (f *DXFlag, ok bool) {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+	f, ok = fm.Overrides[nameId]
+	if ok {
+		return f, true
+	}
+	f, ok = fm.Flags[nameId]
+	return f, ok
+}
+
+func (fm *DXFlagManager) value(nameId string, target utils.JSON) (v any, ok bool) {
+	f, ok := fm.Lookup(nameId)
+	if !ok {
+		return nil, false
+	}
+	return f.evaluate(target)
+}
+
+func (fm *DXFlagManager) Bool(nameId string, defaultValue bool) bool {
+	return fm.BoolFor(nameId, defaultValue, nil)
+}
+
+// BoolFor is Bool evaluated for target, whose attribute named by the rollout_attribute of the flag decides the rollout.
+// A value that is not a bool gives defaultValue.
+func (fm *DXFlagManager) BoolFor(nameId string, defaultValue bool, target utils.JSON) bool {
+	v, ok := fm.value(nameId, target)
+	if !ok {
+		return defaultValue
+	}
+	r, err := utils.ConvertToInterfaceBoolFromAny(v)
+	if err != nil || r == nil {
+		log.Log.Warnf("Flag %s is not a bool (%v), using the default", nameId, v)
+		return defaultValue
+	}
+	return r.(bool)
+}
+
+func (fm *DXFlagManager) String(nameId string, defaultValue string) string {
+	return fm.StringFor(nameId, defaultValue, nil)
+}
+
+func (fm *DXFlagManager) StringFor(nameId string, defaultValue string, target utils.JSON) string {
+	v, ok := fm.value(nameId, target)
+	if !ok {
+		return defaultValue
+	}
+	s, ok := v.(string)
+	if !ok {
+		log.Log.Warnf("Flag %s is not a string (%v), using the default", nameId, v)
+		return defaultValue
+	}
+	return s
+}
+
+func (fm *DXFlagManager) Float64(nameId string, defaultValue float64) float64 {
+	return fm.Float64For(nameId, defaultValue, nil)
+}
+
+func (fm *DXFlagManager) Float64For(nameId string, defaultValue float64, target utils.JSON) float64 {
+	v, ok := fm.value(nameId, target)
+	if !ok {
+		return defaultValue
+	}
+	r, err := toFloat64(v)
+	if err != nil {
+		log.Log.Warnf("Flag %s is not a number (%v), using the default", nameId, v)
+		return defaultValue
+	}
+	return r
+}
+
+func (fm *DXFlagManager) Int64(nameId string, defaultValue int64) int64 {
+	return fm.Int64For(nameId, defaultValue, nil)
+}
+
+func (fm *DXFlagManager) Int64For(nameId string, defaultValue int64, target utils.JSON) int64 {
+	v, ok := fm.value(nameId, target)
+	if !ok {
+		return defaultValue
+	}
+	r, err := utils.ConvertToInterfaceInt64FromAny(v)
+	if err != nil || r == nil {
+		log.Log.Warnf("Flag %s is not an integer (%v), using the default", nameId, v)
+		return defaultValue
+	}
+	return r.(int64)
+}
+
+var Manager DXFlagManager
+
+func init() {
+	Manager = DXFlagManager{
+		Flags:     map[string]*DXFlag{},
+		Overrides: map[string]*DXFlag{},
+	}
+}
@@ -0,0 +1,105 @@
+package flags
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/configurations"
+	"dxlib/v3/redis"
+	"dxlib/v3/utils"
+)
+
+// newTestFlags gives a manager of the flags of the features configuration data, disabled at the end of the test.
+func newTestFlags(t *testing.T, data utils.JSON) *DXFlagManager {
+	t.Helper()
+	configurations.Manager.NewConfiguration(`test_features`, ``, `json`, false, false, data, nil)
+	t.Cleanup(func() {
+		configurations.Manager.NewConfiguration(`test_features`, ``, `json`, false, false, utils.JSON{`enabled`: false}, nil)
+	})
+	fm := &DXFlagManager{}
+	require.NoError(t, fm.LoadFromConfiguration(`test_features`))
+	return fm
+}
+
+func TestFlagsFallBackToTheDefault(t *testing.T) {
+	fm := newTestFlags(t, utils.JSON{`flags`: utils.JSON{
+		`new_checkout`: true,
+		`theme`:        `dark`,
+		`limit`:        float64(25),
+		`not_a_bool`:   `maybe`,
+		`beta`:         utils.JSON{`value`: true, `rollout_percentage`: float64(50)},
+	}})
+
+	assert.True(t, fm.Bool(`new_checkout`, false))
+	assert.Equal(t, `dark`, fm.String(`theme`, `light`))
+	assert.Equal(t, int64(25), fm.Int64(`limit`, 10))
+	assert.Equal(t, float64(25), fm.Float64(`limit`, 10))
+
+	assert.True(t, fm.Bool(`missing`, true))
+	assert.Equal(t, `light`, fm.String(`missing`, `light`))
+	assert.False(t, fm.Bool(`not_a_bool`, false))
+	assert.Equal(t, `light`, fm.String(`limit`, `light`))
+	assert.Equal(t, int64(10), fm.Int64(`theme`, 10))
+	// a rollout without the attribute to place the target in a bucket
+	assert.False(t, fm.Bool(`beta`, false))
+	assert.False(t, fm.BoolFor(`beta`, false, utils.JSON{`org_id`: 1}))
+}
+
+func TestRolloutBucketsAreDeterministic(t *testing.T) {
+	assert.Equal(t, Bucket(`beta`, `42`), Bucket(`beta`, `42`))
+	for _, key := range []string{`1`, `2`, `user@example.com`} {
+		b := Bucket(`beta`, key)
+		assert.GreaterOrEqual(t, b, 0)
+		assert.Less(t, b, 100)
+	}
+
+	fm := newTestFlags(t, utils.JSON{`flags`: utils.JSON{
+		`beta`: utils.JSON{`value`: true, `rollout_percentage`: float64(30)},
+		`none`: utils.JSON{`value`: true, `rollout_percentage`: float64(0)},
+		`all`:  utils.JSON{`value`: true, `rollout_percentage`: float64(100)},
+		`org`:  utils.JSON{`value`: true, `rollout_percentage`: float64(50), `rollout_attribute`: `org_id`},
+	}})
+	enabled := 0
+	for i := 0; i < 10000; i++ {
+		target := utils.JSON{`user_id`: i}
+		isEnabled := fm.BoolFor(`beta`, false, target)
+		assert.Equal(t, Bucket(`beta`, fmt.Sprint(i)) < 30, isEnabled)
+		assert.Equal(t, isEnabled, fm.BoolFor(`beta`, false, target), `evaluated differently for the same user`)
+		if isEnabled {
+			enabled++
+		}
+		assert.False(t, fm.BoolFor(`none`, false, target))
+		assert.True(t, fm.BoolFor(`all`, false, target))
+	}
+	assert.InDelta(t, 3000, enabled, 300)
+	assert.Equal(t, Bucket(`org`, `7`) < 50, fm.BoolFor(`org`, false, utils.JSON{`org_id`: 7, `user_id`: 1}))
+}
+
+func TestRedisOverridesTheConfiguration(t *testing.T) {
+	m := miniredis.RunT(t)
+	r := redis.Manager.NewRedis(`test_flags`, false, false)
+	r.Address = m.Addr()
+	r.IsConfigured = true
+	require.NoError(t, r.Connect())
+	t.Cleanup(func() {
+		_ = r.Disconnect()
+		delete(redis.Manager.Redises, `test_flags`)
+	})
+	fm := newTestFlags(t, utils.JSON{`redis`: `test_flags`, `flags`: utils.JSON{`new_checkout`: false, `theme`: `dark`}})
+
+	m.HSet(DXFlagDefaultRedisKey, `new_checkout`, `true`, `theme`, `light`, `beta`, `{"rollout_percentage": 10}`)
+	require.NoError(t, fm.Refresh(context.Background()))
+	assert.True(t, fm.Bool(`new_checkout`, false))
+	assert.Equal(t, `light`, fm.String(`theme`, ``))
+	_, ok := fm.Lookup(`beta`)
+	assert.False(t, ok, `the override without value was not ignored`)
+
+	m.HDel(DXFlagDefaultRedisKey, `new_checkout`)
+	require.NoError(t, fm.Refresh(context.Background()))
+	assert.False(t, fm.Bool(`new_checkout`, true))
+}
@@ -0,0 +1,258 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	goGRPC "google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+
+	"dxlib/v3/configurations"
+	"dxlib/v3/core"
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+	"dxlib/v3/utils/json"
+)
+
+const (
+	DXGRPCDefaultShutdownTimeout        = 30 * time.Second
+	DXGRPCDefaultKeepaliveTimeSec       = 2 * 60 * 60
+	DXGRPCDefaultKeepaliveTimeoutSec    = 20
+	DXGRPCDefaultMaxConnectionIdleSec   = 0
+	DXGRPCDefaultKeepaliveMinTimeSec    = 5 * 60
+	DXGRPCDefaultMaxReceiveMessageBytes = 4 * 1024 * 1024
+)
+
+// DXGRPCRegisterFunc registers a generated service implementation, like pb.RegisterGreeterServer(s, &greeter{}).
+type DXGRPCRegisterFunc func(s *goGRPC.Server)
+
+type DXGRPCServer struct {
+	NameId                 string
+	Address                string
+	TLSCertFile            string
+	TLSKeyFile             string
+	KeepaliveTimeSec       int
+	KeepaliveTimeoutSec    int
+	KeepaliveMinTimeSec    int
+	MaxConnectionIdleSec   int
+	MaxReceiveMessageBytes int
+	// UnaryInterceptors and StreamInterceptors run after the request id, tracing, logging and recovery ones, the recovery
+	// is the last so a panic is traced and logged as an Internal error
+	UnaryInterceptors  []goGRPC.UnaryServerInterceptor
+	StreamInterceptors []goGRPC.StreamServerInterceptor
+	// ServerOptions are added to the options made from the configuration
+	ServerOptions   []goGRPC.ServerOption
+	registerFuncs   []DXGRPCRegisterFunc
+	RuntimeIsActive bool
+	Server          *goGRPC.Server
+	Log             log.DXLog
+	Context         context.Context
+	Cancel          context.CancelFunc
+	// Listener is the socket the server is served on at Address
+	Listener net.Listener
+}
+
+type DXGRPCManager struct {
+	Context           context.Context
+	Cancel            context.CancelFunc
+	Servers           map[string]*DXGRPCServer
+	ErrorGroup        *errgroup.Group
+	ErrorGroupContext context.Context
+	// ShutdownTimeout is how long GracefulStop waits for the in-flight calls before the server is stopped
+	ShutdownTimeout time.Duration
+}
+
+func (gm *DXGRPCManager) NewServer(nameId string) *DXGRPCServer {
+	ctx, cancel := context.WithCancel(gm.Context)
+	s := DXGRPCServer{
+		NameId:  nameId,
+		Context: ctx,
+		Cancel:  cancel,
+		Log:     log.NewLog(&log.Log, ctx, nameId),
+	}
+	gm.Servers[nameId] = &s
+	return &s
+}
+
+// RegisterService adds a service to the server, it must be called before StartAll.
+func (s *DXGRPCServer) RegisterService(fn DXGRPCRegisterFunc) {
+	s.registerFuncs = append(s.registerFuncs, fn)
+}
+
+func (s *DXGRPCServer) ApplyConfigurations() (err error) {
+	configuration, ok := configurations.Manager.Get("grpc")
+	if !ok {
+		err = log.Log.FatalAndCreateErrorf("Can not find configuration 'grpc' needed to configure the gRPC server")
+		return err
+	}
+	c1, ok := (*configuration.Data)[s.NameId].(utils.JSON)
+	if !ok {
+		err = log.Log.FatalAndCreateErrorf("Can not find configuration 'grpc.%s' needed to configure the gRPC server", s.NameId)
+		return err
+	}
+	s.Address, ok = c1[`address`].(string)
+	if !ok {
+		err = log.Log.FatalAndCreateErrorf("Can not find configuration 'grpc.%s/address' needed to configure the gRPC server", s.NameId)
+		return err
+	}
+	s.MaxReceiveMessageBytes = json.GetNumberWithDefault(c1, `max-receive-message-bytes`, DXGRPCDefaultMaxReceiveMessageBytes)
+	if t, ok := c1[`tls`].(utils.JSON); ok {
+		s.TLSCertFile, _ = t[`cert-file`].(string)
+		s.TLSKeyFile, _ = t[`key-file`].(string)
+		if s.TLSCertFile == `` || s.TLSKeyFile == `` {
+			err = log.Log.FatalAndCreateErrorf("Configuration 'grpc.%s/tls' needs cert-file and key-file", s.NameId)
+			return err
+		}
+	}
+	k, _ := c1[`keepalive`].(utils.JSON)
+	if k == nil {
+		k = utils.JSON{}
+	}
+	s.KeepaliveTimeSec = json.GetNumberWithDefault(k, `time-sec`, DXGRPCDefaultKeepaliveTimeSec)
+	s.KeepaliveTimeoutSec = json.GetNumberWithDefault(k, `timeout-sec`, DXGRPCDefaultKeepaliveTimeoutSec)
+	s.KeepaliveMinTimeSec = json.GetNumberWithDefault(k, `min-time-sec`, DXGRPCDefaultKeepaliveMinTimeSec)
+	s.MaxConnectionIdleSec = json.GetNumberWithDefault(k, `max-connection-idle-sec`, DXGRPCDefaultMaxConnectionIdleSec)
+	return nil
+}
+
+func (s *DXGRPCServer) serverOptions() (options []goGRPC.ServerOption, err error) {
+	options = []goGRPC.ServerOption{
+		goGRPC.MaxRecvMsgSize(s.MaxReceiveMessageBytes),
+		goGRPC.KeepaliveParams(keepalive.ServerParameters{
+			Time:              time.Duration(s.KeepaliveTimeSec) * time.Second,
+			Timeout:           time.Duration(s.KeepaliveTimeoutSec) * time.Second,
+			MaxConnectionIdle: time.Duration(s.MaxConnectionIdleSec) * time.Second,
+		}),
+		goGRPC.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             time.Duration(s.KeepaliveMinTimeSec) * time.Second,
+			PermitWithoutStream: true,
+		}),
+		goGRPC.ChainUnaryInterceptor(append([]goGRPC.UnaryServerInterceptor{
+			RequestIdUnaryInterceptor(), TracingUnaryInterceptor(s.NameId), LoggingUnaryInterceptor(&s.Log), RecoveryUnaryInterceptor(),
+		}, s.UnaryInterceptors...)...),
+		goGRPC.ChainStreamInterceptor(append([]goGRPC.StreamServerInterceptor{
+			RequestIdStreamInterceptor(), TracingStreamInterceptor(s.NameId), LoggingStreamInterceptor(&s.Log), RecoveryStreamInterceptor(),
+		}, s.StreamInterceptors...)...),
+	}
+	if s.TLSCertFile != `` {
+		certificate, err := tls.LoadX509KeyPair(s.TLSCertFile, s.TLSKeyFile)
+		if err != nil {
+			log.Log.Errorf("Cannot load the TLS key pair of gRPC server %s (%v)", s.NameId, err)
+			return nil, err
+		}
+		options = append(options, goGRPC.Creds(credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{certificate},
+			MinVersion:   tls.VersionTLS12,
+		})))
+	}
+	return append(options, s.ServerOptions...), nil
+}
+
+func (s *DXGRPCServer) StartAndWait(errorGroup *errgroup.Group) (err error) {
+	if !s.RuntimeIsActive {
+		err = s.ApplyConfigurations()
+		if err != nil {
+			return err
+		}
+		options, err := s.serverOptions()
+		if err != nil {
+			return err
+		}
+		s.Server = goGRPC.NewServer(options...)
+		for _, fn := range s.registerFuncs {
+			fn(s.Server)
+		}
+	}
+	listener, err := net.Listen(`tcp`, s.Address)
+	if err != nil {
+		log.Log.Errorf("Cannot listen at %s for gRPC server %s (%v)", s.Address, s.NameId, err)
+		return err
+	}
+	s.Listener = listener
+	errorGroup.Go(func() error {
+		s.RuntimeIsActive = true
+		log.Log.Infof("gRPC listening at %s... start", listener.Addr())
+		err := s.Server.Serve(listener)
+		s.RuntimeIsActive = false
+		log.Log.Infof("gRPC listening at %s... stopped (%v)", listener.Addr(), err)
+		if errors.Is(err, goGRPC.ErrServerStopped) {
+			return nil
+		}
+		return err
+	})
+	return nil
+}
+
+// StartShutdown stops accepting calls and waits for the in-flight ones up to Manager.ShutdownTimeout, then closes the
+// connections still open.
+func (s *DXGRPCServer) StartShutdown() {
+	if s.Server == nil {
+		return
+	}
+	log.Log.Infof("Shutdown gRPC server %s start...", s.NameId)
+	shutdownTimeout := Manager.ShutdownTimeout
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = DXGRPCDefaultShutdownTimeout
+	}
+	done := make(chan struct{})
+	go func() {
+		s.Server.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Log.Infof("Shutdown gRPC server %s done", s.NameId)
+	case <-time.After(shutdownTimeout):
+		log.Log.Warnf("Shutdown gRPC server %s deadline %v elapsed, stopping the calls in flight", s.NameId, shutdownTimeout)
+		s.Server.Stop()
+	}
+	s.Cancel()
+}
+
+func (gm *DXGRPCManager) StartAll(errorGroup *errgroup.Group, errorGroupContext context.Context) error {
+	gm.ErrorGroup = errorGroup
+	gm.ErrorGroupContext = errorGroupContext
+
+	gm.ErrorGroup.Go(func() error {
+		<-gm.ErrorGroupContext.Done()
+		log.Log.Info(`gRPC Manager shutting down... start`)
+		for _, v := range gm.Servers {
+			v.StartShutdown()
+		}
+		log.Log.Info(`gRPC Manager shutting down... done`)
+		return nil
+	})
+
+	for _, v := range gm.Servers {
+		err := v.StartAndWait(gm.ErrorGroup)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StopAll shuts the servers down, when the error group context did not already.
+func (gm *DXGRPCManager) StopAll() (err error) {
+	for _, v := range gm.Servers {
+		v.StartShutdown()
+	}
+	return nil
+}
+
+var Manager DXGRPCManager
+
+func init() {
+	ctx, cancel := context.WithCancel(core.RootContext)
+	Manager = DXGRPCManager{
+		Context:         ctx,
+		Cancel:          cancel,
+		Servers:         map[string]*DXGRPCServer{},
+		ShutdownTimeout: DXGRPCDefaultShutdownTimeout,
+	}
+}
@@ -0,0 +1,95 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+	goGRPC "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"dxlib/v3/configurations"
+	"dxlib/v3/utils"
+)
+
+// testHealthServer answers every service as serving, it panics for the service "panic".
+type testHealthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+}
+
+func (testHealthServer) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	if req.Service == `panic` {
+		panic(`test panic`)
+	}
+	return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+}
+
+// startTestServer starts the gRPC server nameId serving testHealthServer, stopped at the end of the test, and gives a
+// client connected to it.
+func startTestServer(t *testing.T, nameId string) (s *DXGRPCServer, client grpc_health_v1.HealthClient) {
+	t.Helper()
+	configurations.Manager.NewConfiguration(`grpc`, ``, `json`, false, false, utils.JSON{
+		nameId: utils.JSON{`address`: `127.0.0.1:0`},
+	}, nil)
+	s = Manager.NewServer(nameId)
+	s.RegisterService(func(s *goGRPC.Server) {
+		grpc_health_v1.RegisterHealthServer(s, testHealthServer{})
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	errorGroup, errorGroupContext := errgroup.WithContext(ctx)
+	t.Cleanup(func() {
+		cancel()
+		assert.NoError(t, errorGroup.Wait())
+		delete(Manager.Servers, nameId)
+	})
+	require.NoError(t, Manager.StartAll(errorGroup, errorGroupContext))
+
+	conn, err := goGRPC.NewClient(s.Listener.Addr().String(), goGRPC.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return s, grpc_health_v1.NewHealthClient(conn)
+}
+
+func TestServerAnswersAUnaryCall(t *testing.T) {
+	_, client := startTestServer(t, `test`)
+
+	var header metadata.MD
+	ctx := metadata.AppendToOutgoingContext(context.Background(), DXGRPCRequestIdMetadataKey, `request-1`)
+	resp, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{}, goGRPC.Header(&header))
+	require.NoError(t, err)
+	assert.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, resp.Status)
+	assert.Equal(t, []string{`request-1`}, header.Get(DXGRPCRequestIdMetadataKey))
+
+	// without one a request id is made
+	_, err = client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{}, goGRPC.Header(&header))
+	require.NoError(t, err)
+	require.Len(t, header.Get(DXGRPCRequestIdMetadataKey), 1)
+	assert.Len(t, header.Get(DXGRPCRequestIdMetadataKey)[0], 16)
+}
+
+func TestServerRecoversAPanicOfTheHandler(t *testing.T) {
+	_, client := startTestServer(t, `test`)
+
+	_, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: `panic`})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	// the server is still serving
+	_, err = client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	assert.NoError(t, err)
+}
+
+func TestServerIsGracefullyStopped(t *testing.T) {
+	s, client := startTestServer(t, `test`)
+
+	require.NoError(t, Manager.StopAll())
+	_, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.ErrorIs(t, s.Context.Err(), context.Canceled)
+}
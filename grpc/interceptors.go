@@ -0,0 +1,182 @@
+package grpc
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
+	goGRPC "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"dxlib/v3/core"
+	"dxlib/v3/log"
+	"dxlib/v3/metrics"
+	"dxlib/v3/tracing"
+	"dxlib/v3/utils"
+)
+
+// DXGRPCRequestIdMetadataKey gives the id of a call, taken from the client when given, sent back in the header and
+// logged with the queries of the call like the X-Request-Id of the API.
+const DXGRPCRequestIdMetadataKey = `x-request-id`
+
+// dxGRPCServerStream gives the handler of a stream the context made by the interceptors.
+type dxGRPCServerStream struct {
+	goGRPC.ServerStream
+	ctx context.Context
+}
+
+func (ss *dxGRPCServerStream) Context() context.Context {
+	return ss.ctx
+}
+
+func recoverToError(fullMethod string, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	log.Log.Errorf("Panic in gRPC %s (%v)\n%s", fullMethod, r, debug.Stack())
+	metrics.Manager.ObservePanic(`grpc`)
+	if core.IsPanicCrash() {
+		panic(r)
+	}
+	*err = status.Error(codes.Internal, `Internal error`)
+}
+
+// RecoveryUnaryInterceptor turns a panic of the handler into an Internal error and logs the stack trace, with
+// core.PanicPolicyCrash it panics again once logged.
+func RecoveryUnaryInterceptor() goGRPC.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *goGRPC.UnaryServerInfo, handler goGRPC.UnaryHandler) (resp any, err error) {
+		defer recoverToError(info.FullMethod, &err)
+		return handler(ctx, req)
+	}
+}
+
+func RecoveryStreamInterceptor() goGRPC.StreamServerInterceptor {
+	return func(srv any, ss goGRPC.ServerStream, info *goGRPC.StreamServerInfo, handler goGRPC.StreamHandler) (err error) {
+		defer recoverToError(info.FullMethod, &err)
+		return handler(srv, ss)
+	}
+}
+
+// requestIdContext keeps the request id of the metadata, or a new one, in the correlation of the context and sends it
+// back in the header.
+func requestIdContext(ctx context.Context) context.Context {
+	requestId := ``
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(DXGRPCRequestIdMetadataKey); len(v) > 0 {
+			requestId = v[0]
+		}
+	}
+	if requestId == `` {
+		requestId = hex.EncodeToString(utils.RandomData(8))
+	}
+	_ = goGRPC.SetHeader(ctx, metadata.Pairs(DXGRPCRequestIdMetadataKey, requestId))
+	correlation, _ := log.CorrelationFromContext(ctx)
+	return log.ContextWithCorrelation(ctx, requestId, correlation.TraceId)
+}
+
+func RequestIdUnaryInterceptor() goGRPC.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *goGRPC.UnaryServerInfo, handler goGRPC.UnaryHandler) (resp any, err error) {
+		return handler(requestIdContext(ctx), req)
+	}
+}
+
+func RequestIdStreamInterceptor() goGRPC.StreamServerInterceptor {
+	return func(srv any, ss goGRPC.ServerStream, info *goGRPC.StreamServerInfo, handler goGRPC.StreamHandler) (err error) {
+		return handler(srv, &dxGRPCServerStream{ServerStream: ss, ctx: requestIdContext(ss.Context())})
+	}
+}
+
+// metadataCarrier reads the W3C trace context from the incoming metadata.
+type metadataCarrier struct {
+	md metadata.MD
+}
+
+func (mc metadataCarrier) Get(key string) string {
+	v := mc.md.Get(key)
+	if len(v) == 0 {
+		return ``
+	}
+	return v[0]
+}
+
+func (mc metadataCarrier) Set(key string, value string) {
+	mc.md.Set(key, value)
+}
+
+func (mc metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(mc.md))
+	for k := range mc.md {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// startSpan starts the server span of a call and adds its trace id to the correlation of the context.
+func startSpan(ctx context.Context, tracerName string, fullMethod string) (context.Context, trace.Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = tracing.Extract(ctx, metadataCarrier{md: md.Copy()})
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "RPC|"+fullMethod,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(semconv.RPCSystemGRPC, semconv.RPCMethod(fullMethod)))
+	if spanContext := span.SpanContext(); spanContext.HasTraceID() {
+		correlation, _ := log.CorrelationFromContext(ctx)
+		ctx = log.ContextWithCorrelation(ctx, correlation.RequestId, spanContext.TraceID().String())
+	}
+	return ctx, span
+}
+
+func TracingUnaryInterceptor(tracerName string) goGRPC.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *goGRPC.UnaryServerInfo, handler goGRPC.UnaryHandler) (resp any, err error) {
+		ctx, span := startSpan(ctx, tracerName, info.FullMethod)
+		resp, err = handler(ctx, req)
+		span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(status.Code(err))))
+		tracing.EndSpan(span, err)
+		return resp, err
+	}
+}
+
+func TracingStreamInterceptor(tracerName string) goGRPC.StreamServerInterceptor {
+	return func(srv any, ss goGRPC.ServerStream, info *goGRPC.StreamServerInfo, handler goGRPC.StreamHandler) (err error) {
+		ctx, span := startSpan(ss.Context(), tracerName, info.FullMethod)
+		err = handler(srv, &dxGRPCServerStream{ServerStream: ss, ctx: ctx})
+		span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(status.Code(err))))
+		tracing.EndSpan(span, err)
+		return err
+	}
+}
+
+func logCall(l *log.DXLog, ctx context.Context, fullMethod string, startTime time.Time, err error) {
+	callLog := log.NewLog(nil, ctx, l.Prefix)
+	text := fmt.Sprintf("%s %s %v", status.Code(err), fullMethod, time.Since(startTime))
+	if err != nil {
+		text = text + ` ` + err.Error()
+	}
+	callLog.Info(text)
+}
+
+// LoggingUnaryInterceptor logs the code, the method and the duration of every call, with the ids of its correlation.
+func LoggingUnaryInterceptor(l *log.DXLog) goGRPC.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *goGRPC.UnaryServerInfo, handler goGRPC.UnaryHandler) (resp any, err error) {
+		startTime := time.Now()
+		resp, err = handler(ctx, req)
+		logCall(l, ctx, info.FullMethod, startTime, err)
+		return resp, err
+	}
+}
+
+func LoggingStreamInterceptor(l *log.DXLog) goGRPC.StreamServerInterceptor {
+	return func(srv any, ss goGRPC.ServerStream, info *goGRPC.StreamServerInfo, handler goGRPC.StreamHandler) (err error) {
+		startTime := time.Now()
+		err = handler(srv, ss)
+		logCall(l, ss.Context(), info.FullMethod, startTime, err)
+		return err
+	}
+}
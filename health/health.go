@@ -0,0 +1,152 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const DXHealthDefaultCheckTimeout = 2 * time.Second
+
+const (
+	DXHealthStatusOk   = `ok`
+	DXHealthStatusFail = `fail`
+)
+
+// DXHealthCheckFunc gives nil when the dependency it checks is ready, ctx is done at the timeout of the check.
+type DXHealthCheckFunc func(ctx context.Context) error
+
+type dxHealthCheck struct {
+	check   DXHealthCheckFunc
+	timeout time.Duration
+}
+
+type DXHealthCheckResult struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// DXHealthManager holds the checks of the readiness, registered by the subsystems and the application.
+type DXHealthManager struct {
+	// CheckTimeout bounds the checks registered without a timeout of their own
+	CheckTimeout time.Duration
+	checks       map[string]dxHealthCheck
+	mutex        sync.RWMutex
+}
+
+// Register adds, or replaces, the check name with the timeout CheckTimeout.
+func (hm *DXHealthManager) Register(name string, check DXHealthCheckFunc) {
+	hm.RegisterWithTimeout(name, 0, check)
+}
+
+func (hm *DXHealthManager) RegisterWithTimeout(name string, timeout time.Duration, check DXHealthCheckFunc) {
+	hm.mutex.Lock()
+	defer hm.mutex.Unlock()
+	if hm.checks == nil {
+		hm.checks = map[string]dxHealthCheck{}
+	}
+	hm.checks[name] = dxHealthCheck{check: check, timeout: timeout}
+}
+
+func (hm *DXHealthManager) Unregister(name string) {
+	hm.mutex.Lock()
+	defer hm.mutex.Unlock()
+	delete(hm.checks, name)
+}
+
+func (hm *DXHealthManager) Names() (r []string) {
+	hm.mutex.RLock()
+	defer hm.mutex.RUnlock()
+	for k := range hm.checks {
+		r = append(r, k)
+	}
+	sort.Strings(r)
+	return r
+}
+
+// runCheck waits for c up to its timeout, a check not returning when its ctx is done is left running and failed.
+func (hm *DXHealthManager) runCheck(ctx context.Context, c dxHealthCheck) (r DXHealthCheckResult) {
+	timeout := c.timeout
+	if timeout <= 0 {
+		timeout = hm.CheckTimeout
+	}
+	if timeout <= 0 {
+		timeout = DXHealthDefaultCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	startTime := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- fmt.Errorf("HealthCheckPanic:%v", p)
+			}
+		}()
+		done <- c.check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	r.DurationMs = time.Since(startTime).Milliseconds()
+	if err != nil {
+		r.Status = DXHealthStatusFail
+		r.Error = err.Error()
+		return r
+	}
+	r.Status = DXHealthStatusOk
+	return r
+}
+
+// Check runs every check at once, isReady is true when all of them pass.
+func (hm *DXHealthManager) Check(ctx context.Context) (isReady bool, results map[string]DXHealthCheckResult) {
+	hm.mutex.RLock()
+	checks := make(map[string]dxHealthCheck, len(hm.checks))
+	for k, v := range hm.checks {
+		checks[k] = v
+	}
+	hm.mutex.RUnlock()
+
+	results = make(map[string]DXHealthCheckResult, len(checks))
+	resultsMutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for k, v := range checks {
+		name, c := k, v
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := hm.runCheck(ctx, c)
+			resultsMutex.Lock()
+			results[name] = r
+			resultsMutex.Unlock()
+		}()
+	}
+	wg.Wait()
+	isReady = true
+	for _, v := range results {
+		if v.Status != DXHealthStatusOk {
+			isReady = false
+		}
+	}
+	return isReady, results
+}
+
+var Manager DXHealthManager
+
+// Register adds a check to Manager.
+func Register(name string, check DXHealthCheckFunc) {
+	Manager.Register(name, check)
+}
+
+func init() {
+	Manager = DXHealthManager{
+		CheckTimeout: DXHealthDefaultCheckTimeout,
+		checks:       map[string]dxHealthCheck{},
+	}
+}
@@ -0,0 +1,269 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+
+	"dxlib/v3/configurations"
+	"dxlib/v3/log"
+	"dxlib/v3/tracing"
+	"dxlib/v3/utils"
+	"dxlib/v3/utils/json"
+)
+
+const (
+	DXHTTPClientDefaultNameId              = `default`
+	DXHTTPClientDefaultTimeout             = 30 * time.Second
+	DXHTTPClientDefaultMaxRetries          = 2
+	DXHTTPClientDefaultRetryInitialBackoff = 100 * time.Millisecond
+	DXHTTPClientDefaultRetryMaxBackoff     = 2 * time.Second
+)
+
+// DXHTTPClientOptions are how a DXHTTPClient calls. Timeout bounds each attempt, up to reading its response body, and
+// the idempotent requests failing to connect or answered with a 5xx are tried again up to MaxRetries times, waiting a
+// backoff doubling from RetryInitialBackoff up to RetryMaxBackoff.
+type DXHTTPClientOptions struct {
+	Timeout             time.Duration
+	MaxRetries          int
+	RetryInitialBackoff time.Duration
+	RetryMaxBackoff     time.Duration
+}
+
+func DefaultOptions() DXHTTPClientOptions {
+	return DXHTTPClientOptions{
+		Timeout:             DXHTTPClientDefaultTimeout,
+		MaxRetries:          DXHTTPClientDefaultMaxRetries,
+		RetryInitialBackoff: DXHTTPClientDefaultRetryInitialBackoff,
+		RetryMaxBackoff:     DXHTTPClientDefaultRetryMaxBackoff,
+	}
+}
+
+// OptionsFromJSON reads timeout_sec, max_retries, retry_initial_backoff_ms and retry_max_backoff_ms of c, the missing
+// ones are those of base.
+func OptionsFromJSON(c utils.JSON, base DXHTTPClientOptions) (o DXHTTPClientOptions) {
+	return DXHTTPClientOptions{
+		Timeout:             time.Duration(json.GetNumberWithDefault(c, `timeout_sec`, base.Timeout.Seconds()) * float64(time.Second)),
+		MaxRetries:          json.GetNumberWithDefault(c, `max_retries`, base.MaxRetries),
+		RetryInitialBackoff: time.Duration(json.GetNumberWithDefault(c, `retry_initial_backoff_ms`, base.RetryInitialBackoff.Milliseconds())) * time.Millisecond,
+		RetryMaxBackoff:     time.Duration(json.GetNumberWithDefault(c, `retry_max_backoff_ms`, base.RetryMaxBackoff.Milliseconds())) * time.Millisecond,
+	}
+}
+
+type optionsContextKey struct{}
+
+// ContextWithOptions makes the requests made with ctx use o instead of the options of their client, like
+//
+//	o := c.Options
+//	o.MaxRetries = 0
+//	req = req.WithContext(httpclient.ContextWithOptions(req.Context(), o))
+func ContextWithOptions(ctx context.Context, o DXHTTPClientOptions) context.Context {
+	return context.WithValue(ctx, optionsContextKey{}, o)
+}
+
+// DXHTTPClient is an *http.Client for the calls to the other services: it logs them, propagates the trace of the
+// request context and retries by its Options.
+type DXHTTPClient struct {
+	NameId  string
+	Options DXHTTPClientOptions
+	Client  *http.Client
+}
+
+type DXHTTPClientManager struct {
+	Clients map[string]*DXHTTPClient
+	mutex   sync.RWMutex
+}
+
+// NewHTTPClient adds the client nameId calling by o through base, http.DefaultTransport when nil.
+func (hm *DXHTTPClientManager) NewHTTPClient(nameId string, o DXHTTPClientOptions, base http.RoundTripper) *DXHTTPClient {
+	c := newHTTPClient(nameId, o, base)
+	hm.mutex.Lock()
+	defer hm.mutex.Unlock()
+	hm.Clients[nameId] = c
+	return c
+}
+
+func newHTTPClient(nameId string, o DXHTTPClientOptions, base http.RoundTripper) *DXHTTPClient {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	c := &DXHTTPClient{NameId: nameId, Options: o}
+	c.Client = &http.Client{Transport: &dxRetryTransport{client: c, base: base}}
+	return c
+}
+
+// LoadFromConfiguration adds a client for each block of the configuration, like
+//
+//	{"default": {"timeout_sec": 10}, "payments": {"timeout_sec": 5, "max_retries": 0}}
+//
+// the options missing from a block are those of the default one.
+func (hm *DXHTTPClientManager) LoadFromConfiguration(configurationNameId string) (err error) {
+	configuration, err := configurations.Manager.Lookup(configurationNameId)
+	if err != nil {
+		return err
+	}
+	base := DefaultOptions()
+	if c, ok := (*configuration.Data)[DXHTTPClientDefaultNameId].(utils.JSON); ok {
+		base = OptionsFromJSON(c, base)
+	}
+	hm.NewHTTPClient(DXHTTPClientDefaultNameId, base, nil)
+	for k, v := range *configuration.Data {
+		if k == `enabled` || k == DXHTTPClientDefaultNameId {
+			continue
+		}
+		c, ok := v.(utils.JSON)
+		if !ok {
+			err = log.Log.ErrorAndCreateErrorf("Cannot read %s as JSON", k)
+			return err
+		}
+		hm.NewHTTPClient(k, OptionsFromJSON(c, base), nil)
+		log.Log.Infof("Configuring http client %s... done", k)
+	}
+	return nil
+}
+
+// Get gives the client nameId, or else the default one, which has DefaultOptions when not configured.
+func (hm *DXHTTPClientManager) Get(nameId string) *DXHTTPClient {
+	hm.mutex.RLock()
+	c, ok := hm.Clients[nameId]
+	if !ok {
+		c, ok = hm.Clients[DXHTTPClientDefaultNameId]
+	}
+	hm.mutex.RUnlock()
+	if ok {
+		return c
+	}
+	return hm.NewHTTPClient(DXHTTPClientDefaultNameId, DefaultOptions(), nil)
+}
+
+func (hm *DXHTTPClientManager) Names() (r []string) {
+	hm.mutex.RLock()
+	defer hm.mutex.RUnlock()
+	for k := range hm.Clients {
+		r = append(r, k)
+	}
+	sort.Strings(r)
+	return r
+}
+
+func (c *DXHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	return c.Client.Do(req)
+}
+
+// IsIdempotent tells the methods a request can be sent again with, the others could do their work twice.
+func IsIdempotent(method string) bool {
+	switch method {
+	case ``, http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// isRetryable tells an attempt worth trying again: a 5xx or an error of the connection, its timeout too, not a
+// cancelled context.
+func isRetryable(resp *http.Response, err error) bool {
+	if err == nil {
+		return resp.StatusCode >= http.StatusInternalServerError
+	}
+	return !errors.Is(err, context.Canceled)
+}
+
+type dxRetryTransport struct {
+	client *DXHTTPClient
+	base   http.RoundTripper
+}
+
+func (t *dxRetryTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	o, ok := req.Context().Value(optionsContextKey{}).(DXHTTPClientOptions)
+	if !ok {
+		o = t.client.Options
+	}
+	ctx, span := tracing.StartSpan(req.Context(), `httpclient`, `HTTP `+req.Method,
+		attribute.String(`http.request.method`, req.Method), attribute.String(`server.address`, req.URL.Host))
+	defer span.End()
+	u := *req.URL
+	u.RawQuery = ``
+	isRetried := IsIdempotent(req.Method) && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil)
+	backoff := o.RetryInitialBackoff
+	for attempt := 0; ; attempt++ {
+		attemptReq := req.Clone(ctx)
+		if attempt > 0 && req.GetBody != nil {
+			attemptReq.Body, err = req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+		}
+		tracing.Inject(ctx, propagation.HeaderCarrier(attemptReq.Header))
+		cancel := context.CancelFunc(func() {})
+		if o.Timeout > 0 {
+			var attemptCtx context.Context
+			attemptCtx, cancel = context.WithTimeout(ctx, o.Timeout)
+			attemptReq = attemptReq.WithContext(attemptCtx)
+		}
+		startTime := time.Now()
+		resp, err = t.base.RoundTrip(attemptReq)
+		if err != nil {
+			cancel()
+			log.Log.Debugf("HTTP client %s %s %s failed in %v (%v)", t.client.NameId, req.Method, u.String(), time.Since(startTime), err)
+		} else {
+			resp.Body = &cancelOnCloseBody{ReadCloser: resp.Body, cancel: cancel}
+			log.Log.Debugf("HTTP client %s %s %s %d in %v", t.client.NameId, req.Method, u.String(), resp.StatusCode, time.Since(startTime))
+		}
+		if !isRetried || attempt >= o.MaxRetries || ctx.Err() != nil || !isRetryable(resp, err) {
+			break
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			_ = resp.Body.Close()
+		}
+		log.Log.Warnf("HTTP client %s %s %s retried in %v, attempt %d of %d", t.client.NameId, req.Method, u.String(), backoff, attempt+2, o.MaxRetries+1)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = backoff * 2
+		if backoff > o.RetryMaxBackoff {
+			backoff = o.RetryMaxBackoff
+		}
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int(`http.response.status_code`, resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	return resp, nil
+}
+
+// cancelOnCloseBody ends the timeout of an attempt once its body is read, not when RoundTrip returns.
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+var Manager DXHTTPClientManager
+
+func init() {
+	Manager = DXHTTPClientManager{
+		Clients: map[string]*DXHTTPClient{},
+	}
+}
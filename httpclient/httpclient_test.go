@@ -0,0 +1,151 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testOptions retries twice without waiting long, for the tests not to be slow.
+func testOptions() DXHTTPClientOptions {
+	return DXHTTPClientOptions{
+		Timeout:             5 * time.Second,
+		MaxRetries:          2,
+		RetryInitialBackoff: time.Millisecond,
+		RetryMaxBackoff:     5 * time.Millisecond,
+	}
+}
+
+// newFlakyServer answers 503 to the first failures requests and 200 with the body it was sent afterward, it counts the
+// requests in calls and keeps their bodies in bodies.
+func newFlakyServer(t *testing.T, failures int32) (s *httptest.Server, calls *atomic.Int32, bodies *[]string) {
+	t.Helper()
+	calls = &atomic.Int32{}
+	bodies = &[]string{}
+	mutex := sync.Mutex{}
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		*bodies = append(*bodies, string(body))
+		mutex.Unlock()
+		if calls.Add(1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write(body)
+	}))
+	t.Cleanup(s.Close)
+	return s, calls, bodies
+}
+
+func TestRetryGetUntilAnswered(t *testing.T) {
+	s, calls, _ := newFlakyServer(t, 2)
+	c := newHTTPClient(`test`, testOptions(), nil)
+
+	resp, err := c.Client.Get(s.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestRetryGivesTheLastResponseOnceExhausted(t *testing.T) {
+	s, calls, _ := newFlakyServer(t, 5)
+	c := newHTTPClient(`test`, testOptions(), nil)
+
+	resp, err := c.Client.Get(s.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestRetryPutReplaysItsBody(t *testing.T) {
+	s, calls, bodies := newFlakyServer(t, 2)
+	c := newHTTPClient(`test`, testOptions(), nil)
+
+	req, err := http.NewRequest(http.MethodPut, s.URL, strings.NewReader(`payload`))
+	require.NoError(t, err)
+	resp, err := c.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `payload`, string(body))
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Equal(t, []string{`payload`, `payload`, `payload`}, *bodies)
+}
+
+func TestRetryNotForPost(t *testing.T) {
+	s, calls, _ := newFlakyServer(t, 2)
+	c := newHTTPClient(`test`, testOptions(), nil)
+
+	resp, err := c.Client.Post(s.URL, `text/plain`, strings.NewReader(`payload`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestRetryOptionsOfTheRequest(t *testing.T) {
+	s, calls, _ := newFlakyServer(t, 2)
+	c := newHTTPClient(`test`, testOptions(), nil)
+
+	o := c.Options
+	o.MaxRetries = 0
+	req, err := http.NewRequestWithContext(ContextWithOptions(context.Background(), o), http.MethodGet, s.URL, nil)
+	require.NoError(t, err)
+	resp, err := c.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestRetryRefusedConnection(t *testing.T) {
+	ln, err := net.Listen(`tcp`, `127.0.0.1:0`)
+	require.NoError(t, err)
+	address := ln.Addr().String()
+	require.NoError(t, ln.Close())
+
+	attempts := atomic.Int32{}
+	dialer := &net.Dialer{}
+	transport := &http.Transport{DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		attempts.Add(1)
+		return dialer.DialContext(ctx, network, addr)
+	}}
+	c := newHTTPClient(`test`, testOptions(), transport)
+
+	_, err = c.Client.Get(`http://` + address)
+	require.Error(t, err)
+	assert.Equal(t, int32(3), attempts.Load())
+}
+
+func TestIsIdempotent(t *testing.T) {
+	for _, v := range []string{``, http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete} {
+		assert.True(t, IsIdempotent(v), v)
+	}
+	for _, v := range []string{http.MethodPost, http.MethodPatch, http.MethodConnect} {
+		assert.False(t, IsIdempotent(v), v)
+	}
+}
+
+func TestOptionsFromJSON(t *testing.T) {
+	o := OptionsFromJSON(map[string]any{`timeout_sec`: float64(10), `max_retries`: float64(0)}, DefaultOptions())
+	assert.Equal(t, 10*time.Second, o.Timeout)
+	assert.Equal(t, 0, o.MaxRetries)
+	assert.Equal(t, DXHTTPClientDefaultRetryInitialBackoff, o.RetryInitialBackoff)
+	assert.Equal(t, DXHTTPClientDefaultRetryMaxBackoff, o.RetryMaxBackoff)
+}
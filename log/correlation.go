@@ -0,0 +1,24 @@
+package log
+
+import "context"
+
+type correlationContextKey struct{}
+
+// DXLogCorrelation are the ids putting a log line in the request it was written for, the ones found in the Context of
+// a DXLog are logged as the request_id and trace_id fields.
+type DXLogCorrelation struct {
+	RequestId string
+	TraceId   string
+}
+
+func ContextWithCorrelation(ctx context.Context, requestId string, traceId string) context.Context {
+	return context.WithValue(ctx, correlationContextKey{}, DXLogCorrelation{RequestId: requestId, TraceId: traceId})
+}
+
+func CorrelationFromContext(ctx context.Context) (c DXLogCorrelation, ok bool) {
+	if ctx == nil {
+		return c, false
+	}
+	c, ok = ctx.Value(correlationContextKey{}).(DXLogCorrelation)
+	return c, ok
+}
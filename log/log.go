@@ -40,6 +40,8 @@ const (
 type DXLog struct {
 	Context context.Context
 	Prefix  string
+	// IsNotSampled lines are written even when the Sampler suppresses their repeats, see WithoutSampling
+	IsNotSampled bool
 }
 
 var Format DXLogFormat
@@ -62,8 +64,19 @@ func (l *DXLog) LogText(severity DXLogLevel, location string, text string) {
 	/*	switch Format {
 		case DXLogFormatJSON:
 	*/
+	if s := currentSampler(); s != nil && !l.IsNotSampled && !s.allow(l, severity, location, text) {
+		return
+	}
 	stack := ``
 	a := log.WithFields(log.Fields{"prefix": l.Prefix, "location": location})
+	if c, ok := CorrelationFromContext(l.Context); ok {
+		if c.RequestId != `` {
+			a = a.WithField(`request_id`, c.RequestId)
+		}
+		if c.TraceId != `` {
+			a = a.WithField(`trace_id`, c.TraceId)
+		}
+	}
 	switch severity {
 	case DXLogLevelTrace:
 		a.Tracef("%s", text)
@@ -203,6 +216,11 @@ func SetFormatText() {
 	Format = DXLogFormatText
 }
 
+// SetLevel makes the lines less severe than level dropped.
+func SetLevel(level DXLogLevel) {
+	log.SetLevel(logrusLevels[level])
+}
+
 func init() {
 	//log.SetFlags(log.Ldate | log.Lmicroseconds | log.LUTC)
 	//	log.SetReportCaller(true)
@@ -0,0 +1,127 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const dxLogRotatedTimeFormat = "2006-01-02T15-04-05.000"
+
+// DXLogRotatingFile is an io.Writer appending to Filename, which is renamed with its rotation time, as
+// name-2006-01-02T15-04-05.000.ext, once a write would make it larger than MaxSizeBytes or once it is older than MaxAge.
+// Only the MaxBackups newest rotated files are kept, 0 keeps them all.
+type DXLogRotatingFile struct {
+	Filename     string
+	MaxSizeBytes int64
+	MaxAge       time.Duration
+	MaxBackups   int
+	mutex        sync.Mutex
+	file         *os.File
+	size         int64
+	openedAt     time.Time
+}
+
+func (f *DXLogRotatingFile) open() (err error) {
+	err = os.MkdirAll(filepath.Dir(f.Filename), 0o755)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	f.file, f.size, f.openedAt = file, info.Size(), info.ModTime()
+	if f.size == 0 {
+		f.openedAt = time.Now()
+	}
+	return nil
+}
+
+func (f *DXLogRotatingFile) rotatedFilename(t time.Time) string {
+	ext := filepath.Ext(f.Filename)
+	return strings.TrimSuffix(f.Filename, ext) + `-` + t.Format(dxLogRotatedTimeFormat) + ext
+}
+
+func (f *DXLogRotatingFile) rotate() (err error) {
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+		if err != nil {
+			return err
+		}
+	}
+	// a rotation of the same millisecond takes the next free one, keeping the names in the rotation order
+	t := time.Now()
+	for {
+		_, err = os.Stat(f.rotatedFilename(t))
+		if err != nil {
+			break
+		}
+		t = t.Add(time.Millisecond)
+	}
+	err = os.Rename(f.Filename, f.rotatedFilename(t))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f.removeOldBackups()
+	return f.open()
+}
+
+func (f *DXLogRotatingFile) removeOldBackups() {
+	if f.MaxBackups <= 0 {
+		return
+	}
+	ext := filepath.Ext(f.Filename)
+	backups, err := filepath.Glob(strings.TrimSuffix(f.Filename, ext) + `-*` + ext)
+	if err != nil || len(backups) <= f.MaxBackups {
+		return
+	}
+	// the rotation time in the name sorts them oldest first
+	sort.Strings(backups)
+	for _, backup := range backups[:len(backups)-f.MaxBackups] {
+		_ = os.Remove(backup)
+	}
+}
+
+func (f *DXLogRotatingFile) Write(p []byte) (n int, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.file == nil {
+		err = f.open()
+		if err != nil {
+			return 0, err
+		}
+	}
+	isFull := f.MaxSizeBytes > 0 && f.size > 0 && f.size+int64(len(p)) > f.MaxSizeBytes
+	isOld := f.MaxAge > 0 && time.Since(f.openedAt) > f.MaxAge
+	if isFull || isOld {
+		err = f.rotate()
+		if err != nil {
+			return 0, fmt.Errorf("LogFileCannotRotate:%s:%w", f.Filename, err)
+		}
+	}
+	n, err = f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *DXLogRotatingFile) Close() (err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err = f.file.Close()
+	f.file = nil
+	return err
+}
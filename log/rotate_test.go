@@ -0,0 +1,127 @@
+package log
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/utils"
+)
+
+// rotatedTestFiles gives the files f was rotated to.
+func rotatedTestFiles(t *testing.T, f *DXLogRotatingFile) []string {
+	t.Helper()
+	backups, err := filepath.Glob(strings.TrimSuffix(f.Filename, `.log`) + `-*.log`)
+	require.NoError(t, err)
+	return backups
+}
+
+func TestRotatingFileRotatesAfterTheMaxSize(t *testing.T) {
+	f := &DXLogRotatingFile{Filename: filepath.Join(t.TempDir(), `app.log`), MaxSizeBytes: 100}
+	t.Cleanup(func() {
+		_ = f.Close()
+	})
+	line := []byte(strings.Repeat(`x`, 39) + "\n")
+
+	for i := 0; i < 2; i++ {
+		_, err := f.Write(line)
+		require.NoError(t, err)
+	}
+	assert.Empty(t, rotatedTestFiles(t, f))
+
+	// a third line would make the file 120 bytes
+	_, err := f.Write(line)
+	require.NoError(t, err)
+	backups := rotatedTestFiles(t, f)
+	require.Len(t, backups, 1)
+	rotated, err := os.ReadFile(backups[0])
+	require.NoError(t, err)
+	assert.Equal(t, bytes.Repeat(line, 2), rotated)
+	current, err := os.ReadFile(f.Filename)
+	require.NoError(t, err)
+	assert.Equal(t, line, current)
+}
+
+func TestRotatingFileKeepsTheMaxBackups(t *testing.T) {
+	f := &DXLogRotatingFile{Filename: filepath.Join(t.TempDir(), `app.log`), MaxSizeBytes: 10, MaxBackups: 2}
+	t.Cleanup(func() {
+		_ = f.Close()
+	})
+
+	for i := 0; i < 5; i++ {
+		_, err := f.Write([]byte("0123456789"))
+		require.NoError(t, err)
+		// the rotated names are of the millisecond
+		time.Sleep(2 * time.Millisecond)
+	}
+	assert.Len(t, rotatedTestFiles(t, f), 2)
+}
+
+func TestRotatingFileWithTheConcurrentWriters(t *testing.T) {
+	f := &DXLogRotatingFile{Filename: filepath.Join(t.TempDir(), `app.log`), MaxSizeBytes: 1000}
+	t.Cleanup(func() {
+		_ = f.Close()
+	})
+	line := []byte(strings.Repeat(`x`, 9) + "\n")
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				_, err := f.Write(line)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	total := 0
+	for _, name := range append(rotatedTestFiles(t, f), f.Filename) {
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(data), 1000)
+		assert.Zero(t, len(data)%len(line), name)
+		total += len(data)
+	}
+	assert.Equal(t, 10*50*len(line), total)
+}
+
+func TestApplyConfigurationWritesEverySink(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), `app.log`)
+	require.NoError(t, ApplyConfiguration(utils.JSON{`sinks`: []any{
+		utils.JSON{`type`: `file`, `format`: `json`, `level`: `warn`, `filename`: filename, `max_size_mb`: float64(1)},
+		utils.JSON{`type`: `stderr`, `format`: `text`},
+	}}))
+	t.Cleanup(func() {
+		SetSinks()
+	})
+	sinksMutex.RLock()
+	require.Len(t, sinks, 2)
+	assert.Equal(t, DXLogFormatText, sinks[1].Format)
+	sinksMutex.RUnlock()
+
+	Log.Warn(`to the file`)
+	Log.Info(`below the level of the file`)
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"msg":"to the file"`)
+	assert.NotContains(t, string(data), `below the level of the file`)
+
+	for _, c := range []utils.JSON{
+		{`type`: `file`},
+		{`type`: `syslog`},
+		{`type`: `stdout`, `format`: `xml`},
+		{`type`: `stdout`, `level`: `loud`},
+	} {
+		_, err = SinkFromJSON(c)
+		assert.Error(t, err, c)
+	}
+}
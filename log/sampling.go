@@ -0,0 +1,130 @@
+package log
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"dxlib/v3/utils"
+	json2 "dxlib/v3/utils/json"
+)
+
+const (
+	DXLogSamplingDefaultThreshold = 100
+	DXLogSamplingDefaultWindow    = 10 * time.Second
+)
+
+// DXLogSampler lets the first Threshold lines of a message through in a Window and suppresses the repeats, a summary
+// line with their count is written when the window ends. Fatal and panic lines are never sampled.
+type DXLogSampler struct {
+	Threshold int
+	Window    time.Duration
+	mutex     sync.Mutex
+	windows   map[string]*dxLogSamplingWindow
+}
+
+type dxLogSamplingWindow struct {
+	log          DXLog
+	severity     DXLogLevel
+	location     string
+	text         string
+	count        int
+	suppressions int
+}
+
+// Sampler is nil unless SetSampling is called, the lines are then all written.
+var (
+	Sampler      *DXLogSampler
+	samplerMutex sync.RWMutex
+)
+
+func SetSampling(threshold int, window time.Duration) {
+	samplerMutex.Lock()
+	defer samplerMutex.Unlock()
+	if threshold <= 0 {
+		Sampler = nil
+		return
+	}
+	if window <= 0 {
+		window = DXLogSamplingDefaultWindow
+	}
+	Sampler = &DXLogSampler{Threshold: threshold, Window: window, windows: map[string]*dxLogSamplingWindow{}}
+}
+
+func currentSampler() *DXLogSampler {
+	samplerMutex.RLock()
+	defer samplerMutex.RUnlock()
+	return Sampler
+}
+
+var samplingNumberRegexp = regexp.MustCompile(`0x[0-9a-fA-F]+|[0-9]+`)
+
+// samplingKey is the message with its numbers and addresses taken out, so the lines differing by an id are repeats.
+func samplingKey(severity DXLogLevel, location string, text string) string {
+	return strconv.Itoa(int(severity)) + `|` + location + `|` + samplingNumberRegexp.ReplaceAllString(text, `#`)
+}
+
+// allow is false for a line to suppress.
+func (s *DXLogSampler) allow(l *DXLog, severity DXLogLevel, location string, text string) bool {
+	if severity <= DXLogLevelFatal {
+		return true
+	}
+	key := samplingKey(severity, location, text)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	w, ok := s.windows[key]
+	if !ok {
+		w = &dxLogSamplingWindow{log: *l, severity: severity, location: location, text: text}
+		s.windows[key] = w
+		time.AfterFunc(s.Window, func() {
+			s.endWindow(key)
+		})
+	}
+	w.count++
+	if w.count <= s.Threshold {
+		return true
+	}
+	w.suppressions++
+	return false
+}
+
+func (s *DXLogSampler) endWindow(key string) {
+	s.mutex.Lock()
+	w := s.windows[key]
+	delete(s.windows, key)
+	s.mutex.Unlock()
+	if w == nil || w.suppressions == 0 {
+		return
+	}
+	w.log.IsNotSampled = true
+	w.log.LogText(w.severity, w.location, fmt.Sprintf("%s (repeated %s times in %v)", w.text, formatCount(w.suppressions), s.Window))
+}
+
+// formatCount writes n with thousands separators, 4213 as 4,213.
+func formatCount(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + `,` + s[i:]
+	}
+	return s
+}
+
+// WithoutSampling gives a copy of l whose lines are never suppressed, for a call that must always be written.
+func (l *DXLog) WithoutSampling() *DXLog {
+	l2 := *l
+	l2.IsNotSampled = true
+	return &l2
+}
+
+// applySamplingConfiguration reads the "sampling" block of the log configuration: threshold and window_sec.
+func applySamplingConfiguration(c utils.JSON) {
+	sc, ok := c[`sampling`].(utils.JSON)
+	if !ok {
+		return
+	}
+	threshold := json2.GetNumberWithDefault(sc, `threshold`, DXLogSamplingDefaultThreshold)
+	window := time.Duration(json2.GetNumberWithDefault(sc, `window_sec`, int(DXLogSamplingDefaultWindow/time.Second))) * time.Second
+	SetSampling(threshold, window)
+}
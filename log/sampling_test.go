@@ -0,0 +1,96 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testSyncBuffer is a buffer for the lines written from the timers of the sampler.
+type testSyncBuffer struct {
+	mutex sync.Mutex
+	b     bytes.Buffer
+}
+
+func (b *testSyncBuffer) Write(p []byte) (n int, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *testSyncBuffer) lines() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return strings.Split(strings.TrimSpace(b.b.String()), "\n")
+}
+
+// setTestSampling samples the lines of a JSON sink of the given buffer, both removed at the end of the test.
+func setTestSampling(t *testing.T, threshold int, window time.Duration) *testSyncBuffer {
+	t.Helper()
+	b := &testSyncBuffer{}
+	SetSinks(NewSink(`test`, DXLogFormatJSON, DXLogLevelWarn, b))
+	SetSampling(threshold, window)
+	t.Cleanup(func() {
+		SetSampling(0, 0)
+		SetSinks()
+	})
+	return b
+}
+
+func TestSamplingSuppressesABurstWithASummary(t *testing.T) {
+	b := setTestSampling(t, 5, 100*time.Millisecond)
+
+	for i := 0; i < 1000; i++ {
+		Log.Warnf(`connection %d refused`, i)
+	}
+	assert.Len(t, b.lines(), 5)
+
+	require.Eventually(t, func() bool {
+		return len(b.lines()) == 6
+	}, 5*time.Second, 10*time.Millisecond)
+	summary := b.lines()[5]
+	assert.Contains(t, summary, `connection 0 refused (repeated 995 times in 100ms)`)
+	assert.Contains(t, summary, `"level":"warning"`)
+
+	// the window ended, the next lines are let through again
+	Log.Warnf(`connection %d refused`, 1000)
+	assert.Len(t, b.lines(), 7)
+	time.Sleep(200 * time.Millisecond)
+	assert.Len(t, b.lines(), 7)
+}
+
+func TestSamplingOfTheDistinctMessagesAndOptOut(t *testing.T) {
+	b := setTestSampling(t, 1, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		Log.Warn(`first`)
+		Log.Error(`first`)
+		Log.Warn(`second`)
+		Log.WithoutSampling().Warn(`always`)
+	}
+	lines := b.lines()
+	require.Len(t, lines, 6)
+	count := map[string]int{}
+	for _, line := range lines {
+		for _, msg := range []string{`first`, `second`, `always`} {
+			if strings.Contains(line, `"msg":"`+msg+`"`) {
+				count[msg]++
+			}
+		}
+	}
+	// the severity is part of the key, the warning and the error of first are sampled apart
+	assert.Equal(t, map[string]int{`first`: 2, `second`: 1, `always`: 3}, count)
+}
+
+func TestSamplingKeyAndCount(t *testing.T) {
+	assert.Equal(t, samplingKey(DXLogLevelWarn, `db`, `row 12 at 0xc000123`), samplingKey(DXLogLevelWarn, `db`, `row 7 at 0xc000999`))
+	assert.NotEqual(t, samplingKey(DXLogLevelWarn, `db`, `row 12`), samplingKey(DXLogLevelWarn, `api`, `row 12`))
+	assert.Equal(t, `4,213`, formatCount(4213))
+	assert.Equal(t, `1,000,000`, formatCount(1000000))
+	assert.Equal(t, `999`, formatCount(999))
+}
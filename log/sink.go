@@ -0,0 +1,188 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"dxlib/v3/utils"
+	json2 "dxlib/v3/utils/json"
+)
+
+const (
+	DXLogSinkTypeStdout = "stdout"
+	DXLogSinkTypeStderr = "stderr"
+	DXLogSinkTypeFile   = "file"
+)
+
+// DXLogSink is a destination of the log lines of at least Level, written in its own Format.
+type DXLogSink struct {
+	Type      string
+	Format    DXLogFormat
+	Level     DXLogLevel
+	Writer    io.Writer
+	formatter log.Formatter
+	mutex     sync.Mutex
+}
+
+func NewSink(sinkType string, format DXLogFormat, level DXLogLevel, writer io.Writer) *DXLogSink {
+	s := &DXLogSink{Type: sinkType, Format: format, Level: level, Writer: writer}
+	switch format {
+	case DXLogFormatText:
+		s.formatter = &log.TextFormatter{DisableColors: true}
+	default:
+		s.formatter = &log.JSONFormatter{}
+	}
+	return s
+}
+
+func (s *DXLogSink) write(entry *log.Entry) (err error) {
+	if entry.Level > logrusLevels[s.Level] {
+		return nil
+	}
+	b, err := s.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	// the writes of concurrent callers are kept whole
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, err = s.Writer.Write(b)
+	return err
+}
+
+var logrusLevels = map[DXLogLevel]log.Level{
+	DXLogLevelPanic: log.PanicLevel,
+	DXLogLevelFatal: log.FatalLevel,
+	DXLogLevelError: log.ErrorLevel,
+	DXLogLevelWarn:  log.WarnLevel,
+	DXLogLevelInfo:  log.InfoLevel,
+	DXLogLevelDebug: log.DebugLevel,
+	DXLogLevelTrace: log.TraceLevel,
+}
+
+func ParseLevel(s string) (level DXLogLevel, err error) {
+	l, err := log.ParseLevel(s)
+	if err != nil {
+		return DXLogLevelTrace, err
+	}
+	for k, v := range logrusLevels {
+		if v == l {
+			return k, nil
+		}
+	}
+	return DXLogLevelTrace, fmt.Errorf("LogLevelInvalid:%s", s)
+}
+
+// dxLogSinksHook writes every entry to the current sinks, it is added to logrus once, by the first SetSinks.
+type dxLogSinksHook struct{}
+
+var (
+	sinks      []*DXLogSink
+	sinksMutex sync.RWMutex
+	sinksOnce  sync.Once
+)
+
+func (dxLogSinksHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (dxLogSinksHook) Fire(entry *log.Entry) (err error) {
+	sinksMutex.RLock()
+	defer sinksMutex.RUnlock()
+	for _, s := range sinks {
+		errWrite := s.write(entry)
+		if errWrite != nil {
+			err = errWrite
+		}
+	}
+	return err
+}
+
+// SetSinks makes the log lines go to sinks instead of the output of logrus, the file sinks of the previous call are
+// closed.
+func SetSinks(newSinks ...*DXLogSink) {
+	sinksOnce.Do(func() {
+		log.AddHook(dxLogSinksHook{})
+	})
+	sinksMutex.Lock()
+	oldSinks := sinks
+	sinks = newSinks
+	sinksMutex.Unlock()
+	log.SetOutput(io.Discard)
+	for _, s := range oldSinks {
+		if c, ok := s.Writer.(io.Closer); ok && s.Type == DXLogSinkTypeFile {
+			_ = c.Close()
+		}
+	}
+}
+
+// SinkFromJSON reads a sink of the "sinks" list of the log configuration: type (stdout, stderr or file), format (json
+// or text), level, and for a file filename, max_size_mb, max_age_hours and max_backups.
+func SinkFromJSON(c utils.JSON) (s *DXLogSink, err error) {
+	sinkType, _ := c[`type`].(string)
+	format := DXLogFormat(DXLogFormatJSON)
+	switch f, _ := c[`format`].(string); f {
+	case ``, `json`:
+	case `text`:
+		format = DXLogFormatText
+	default:
+		return nil, fmt.Errorf("LogSinkFormatInvalid:%s", f)
+	}
+	level := DXLogLevelTrace
+	if l, ok := c[`level`].(string); ok {
+		level, err = ParseLevel(l)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var writer io.Writer
+	switch sinkType {
+	case DXLogSinkTypeStdout:
+		writer = os.Stdout
+	case DXLogSinkTypeStderr:
+		writer = os.Stderr
+	case DXLogSinkTypeFile:
+		filename, _ := c[`filename`].(string)
+		if filename == `` {
+			return nil, fmt.Errorf("LogSinkFilenameIsMissing")
+		}
+		writer = &DXLogRotatingFile{
+			Filename:     filename,
+			MaxSizeBytes: int64(json2.GetNumberWithDefault(c, `max_size_mb`, 100)) * 1024 * 1024,
+			MaxAge:       time.Duration(json2.GetNumberWithDefault(c, `max_age_hours`, 0)) * time.Hour,
+			MaxBackups:   json2.GetNumberWithDefault(c, `max_backups`, 0),
+		}
+	default:
+		return nil, fmt.Errorf("LogSinkTypeInvalid:%s", sinkType)
+	}
+	return NewSink(sinkType, format, level, writer), nil
+}
+
+// ApplyConfiguration sets the sinks of the "sinks" list of the log configuration, without it the log stays on the
+// output of logrus, and the sampling of its "sampling" block.
+func ApplyConfiguration(c utils.JSON) (err error) {
+	applySamplingConfiguration(c)
+	l, ok := c[`sinks`].([]any)
+	if !ok {
+		return nil
+	}
+	newSinks := []*DXLogSink{}
+	for i, v := range l {
+		sc, ok := v.(utils.JSON)
+		if !ok {
+			return fmt.Errorf("LogSinkIsNotJSON:%d", i)
+		}
+		s, err := SinkFromJSON(sc)
+		if err != nil {
+			return fmt.Errorf("LogSinkInvalid:%d:%w", i, err)
+		}
+		newSinks = append(newSinks, s)
+	}
+	SetSinks(newSinks...)
+	return nil
+}
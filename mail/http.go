@@ -0,0 +1,82 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+	json2 "dxlib/v3/utils/json"
+)
+
+// DXMailTransportHTTP posts the message as JSON to URL, for the mail APIs and webhooks that relay the mail. The
+// attachment contents are base64 strings, any 2xx status is a success.
+type DXMailTransportHTTP struct {
+	URL        string
+	Headers    map[string]string
+	HTTPClient *http.Client
+}
+
+// NewHTTPTransportFromConfiguration reads the fields url, headers (like an Authorization header) and timeout_sec.
+func NewHTTPTransportFromConfiguration(nameId string, c utils.JSON) (transport *DXMailTransportHTTP, err error) {
+	u, ok := c[`url`].(string)
+	if !ok || u == `` {
+		err = log.Log.ErrorAndCreateErrorf("configuration is unusable, mandatory url field of mail %s not exist", nameId)
+		return nil, err
+	}
+	headers := map[string]string{}
+	if h, ok := c[`headers`].(utils.JSON); ok {
+		for k, v := range h {
+			s, ok := v.(string)
+			if !ok {
+				err = log.Log.ErrorAndCreateErrorf("configuration is unusable, header %s of mail %s is not a string", k, nameId)
+				return nil, err
+			}
+			headers[k] = s
+		}
+	}
+	timeoutSec := json2.GetNumberWithDefault[int](c, `timeout_sec`, DXMailDefaultTimeoutSec)
+	return &DXMailTransportHTTP{
+		URL:        u,
+		Headers:    headers,
+		HTTPClient: &http.Client{Timeout: time.Duration(timeoutSec) * time.Second},
+	}, nil
+}
+
+func (t *DXMailTransportHTTP) Send(ctx context.Context, m DXMailMessage) (err error) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	request.Header.Set(`Content-Type`, `application/json`)
+	for k, v := range t.Headers {
+		request.Header.Set(k, v)
+	}
+	response, err := t.HTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return fmt.Errorf("MailHTTPSendFailed:%d:%s", response.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (t *DXMailTransportHTTP) Close() (err error) {
+	t.HTTPClient.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,169 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"dxlib/v3/configurations"
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+)
+
+const (
+	DXMailTransportTypeSMTP = "smtp"
+	DXMailTransportTypeHTTP = "http"
+	DXMailTransportTypeNoop = "noop"
+
+	DXMailDefaultTimeoutSec = 30
+)
+
+var ErrMailNoRecipient = errors.New("MailNoRecipient")
+
+type DXMailAttachment struct {
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+	Content     []byte `json:"content"`
+}
+
+// DXMailMessage is sent as text, html or both (multipart/alternative), with the attachments around it. Bcc is given to
+// the transport but never written in the headers.
+type DXMailMessage struct {
+	From        string             `json:"from"`
+	To          []string           `json:"to"`
+	Cc          []string           `json:"cc,omitempty"`
+	Bcc         []string           `json:"bcc,omitempty"`
+	ReplyTo     string             `json:"reply_to,omitempty"`
+	Subject     string             `json:"subject"`
+	Text        string             `json:"text,omitempty"`
+	HTML        string             `json:"html,omitempty"`
+	Attachments []DXMailAttachment `json:"attachments,omitempty"`
+}
+
+func (m DXMailMessage) Recipients() (r []string) {
+	r = append(r, m.To...)
+	r = append(r, m.Cc...)
+	r = append(r, m.Bcc...)
+	return r
+}
+
+// DXMailTransport delivers a message, Send gives up once ctx is done.
+type DXMailTransport interface {
+	Send(ctx context.Context, m DXMailMessage) (err error)
+	Close() (err error)
+}
+
+type DXMailer struct {
+	Owner  *DXMailManager
+	NameId string
+	Type   string
+	// From is used for the messages without From
+	From      string
+	Transport DXMailTransport
+}
+
+func (ml *DXMailer) Send(ctx context.Context, m DXMailMessage) (err error) {
+	if m.From == `` {
+		m.From = ml.From
+	}
+	if m.From == `` {
+		return fmt.Errorf("MailNoSender:%s", ml.NameId)
+	}
+	if len(m.Recipients()) == 0 {
+		return ErrMailNoRecipient
+	}
+	err = ml.Transport.Send(ctx, m)
+	if err != nil {
+		log.Log.Errorf("Sending mail %q with %s error (%v)", m.Subject, ml.NameId, err)
+		return err
+	}
+	return nil
+}
+
+type DXMailManager struct {
+	Mailers map[string]*DXMailer
+}
+
+// NewTransport creates the transport of the type field of c, "smtp", "http" or "noop".
+func NewTransport(nameId string, c utils.JSON) (transport DXMailTransport, err error) {
+	transportType, _ := c[`type`].(string)
+	switch transportType {
+	case DXMailTransportTypeSMTP:
+		return NewSMTPTransportFromConfiguration(nameId, c)
+	case DXMailTransportTypeHTTP:
+		return NewHTTPTransportFromConfiguration(nameId, c)
+	case DXMailTransportTypeNoop:
+		return NewNoopTransport(), nil
+	default:
+		err = log.Log.ErrorAndCreateErrorf("configuration is unusable, type of mail %s is not supported (%s)", nameId, transportType)
+		return nil, err
+	}
+}
+
+func (mm *DXMailManager) LoadFromConfiguration(configurationNameId string) (err error) {
+	configuration, err := configurations.Manager.Lookup(configurationNameId)
+	if err != nil {
+		return err
+	}
+	for k, v := range *configuration.Data {
+		if k == `enabled` {
+			continue
+		}
+		c, ok := v.(utils.JSON)
+		if !ok {
+			err := log.Log.ErrorAndCreateErrorf("Cannot read %s as JSON", k)
+			return err
+		}
+		transport, err := NewTransport(k, c)
+		if err != nil {
+			return err
+		}
+		transportType, _ := c[`type`].(string)
+		from, _ := c[`from`].(string)
+		mm.Mailers[k] = &DXMailer{
+			Owner:     mm,
+			NameId:    k,
+			Type:      transportType,
+			From:      from,
+			Transport: transport,
+		}
+		log.Log.Infof("Configuring mail %s (%s)... done", k, transportType)
+	}
+	return nil
+}
+
+func (mm *DXMailManager) FindMailer(nameId string) (r *DXMailer, err error) {
+	r, ok := mm.Mailers[nameId]
+	if !ok {
+		err = log.Log.ErrorAndCreateErrorf("Mail %s not found", nameId)
+		return nil, err
+	}
+	return r, nil
+}
+
+func (mm *DXMailManager) Send(ctx context.Context, mailerNameId string, m DXMailMessage) (err error) {
+	ml, err := mm.FindMailer(mailerNameId)
+	if err != nil {
+		return err
+	}
+	return ml.Send(ctx, m)
+}
+
+func (mm *DXMailManager) CloseAll() (err error) {
+	for _, v := range mm.Mailers {
+		err = v.Transport.Close()
+		if err != nil {
+			log.Log.Errorf("Closing mail %s error (%v)", v.NameId, err)
+			return err
+		}
+	}
+	return nil
+}
+
+var Manager DXMailManager
+
+func init() {
+	Manager = DXMailManager{
+		Mailers: map[string]*DXMailer{},
+	}
+}
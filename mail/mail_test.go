@@ -0,0 +1,81 @@
+package mail
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/utils"
+)
+
+func TestSendWithTheNoopTransport(t *testing.T) {
+	noop := NewNoopTransport()
+	ml := &DXMailer{NameId: `test`, Type: DXMailTransportTypeNoop, From: `noreply@example.com`, Transport: noop}
+
+	require.NoError(t, ml.Send(context.Background(), DXMailMessage{To: []string{`a@example.com`}, Subject: `first`}))
+	require.NoError(t, ml.Send(context.Background(), DXMailMessage{From: `billing@example.com`, Bcc: []string{`b@example.com`}, Subject: `second`}))
+	messages := noop.Messages()
+	require.Len(t, messages, 2)
+	assert.Equal(t, `noreply@example.com`, messages[0].From)
+	assert.Equal(t, `first`, messages[0].Subject)
+	assert.Equal(t, `billing@example.com`, messages[1].From)
+	assert.Equal(t, []string{`b@example.com`}, messages[1].Recipients())
+
+	// Messages is a copy
+	messages[0].Subject = `changed`
+	assert.Equal(t, `first`, noop.Messages()[0].Subject)
+
+	assert.ErrorIs(t, ml.Send(context.Background(), DXMailMessage{Subject: `no recipient`}), ErrMailNoRecipient)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, ml.Send(ctx, DXMailMessage{To: []string{`a@example.com`}}), context.Canceled)
+	assert.Len(t, noop.Messages(), 2)
+
+	noop.Reset()
+	assert.Empty(t, noop.Messages())
+
+	ml.From = ``
+	assert.EqualError(t, ml.Send(context.Background(), DXMailMessage{To: []string{`a@example.com`}}), `MailNoSender:test`)
+}
+
+func TestSendWithTheHTTPTransport(t *testing.T) {
+	received := make(chan DXMailMessage, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(`Authorization`) != `Bearer token` {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`bad token`))
+			return
+		}
+		var m DXMailMessage
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&m))
+		received <- m
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	transport, err := NewTransport(`test`, utils.JSON{`type`: `http`, `url`: server.URL, `headers`: utils.JSON{`Authorization`: `Bearer token`}})
+	require.NoError(t, err)
+	m := DXMailMessage{From: `a@example.com`, To: []string{`b@example.com`}, Subject: `hello`,
+		Attachments: []DXMailAttachment{{FileName: `a.bin`, Content: []byte{0, 1, 2}}}}
+	require.NoError(t, transport.Send(context.Background(), m))
+	assert.Equal(t, m, <-received)
+
+	transport, err = NewTransport(`test`, utils.JSON{`type`: `http`, `url`: server.URL})
+	require.NoError(t, err)
+	assert.EqualError(t, transport.Send(context.Background(), m), `MailHTTPSendFailed:401:bad token`)
+}
+
+func TestNewTransportFollowsTheType(t *testing.T) {
+	transport, err := NewTransport(`test`, utils.JSON{`type`: `noop`})
+	require.NoError(t, err)
+	assert.IsType(t, &DXMailTransportNoop{}, transport)
+	_, err = NewTransport(`test`, utils.JSON{`type`: `pigeon`})
+	assert.Error(t, err)
+	_, err = NewTransport(`test`, utils.JSON{`type`: `http`})
+	assert.Error(t, err)
+}
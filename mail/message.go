@@ -0,0 +1,217 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+func randomId() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func encodeAddressList(addresses []string) (s string, err error) {
+	r := make([]string, 0, len(addresses))
+	for _, v := range addresses {
+		a, err := mail.ParseAddress(v)
+		if err != nil {
+			return ``, fmt.Errorf("InvalidMailAddress:%s", v)
+		}
+		r = append(r, a.String())
+	}
+	return strings.Join(r, `, `), nil
+}
+
+// addressOnly is the bare address of "Name <a@b.c>" for the SMTP envelope.
+func addressOnly(address string) (s string, err error) {
+	a, err := mail.ParseAddress(address)
+	if err != nil {
+		return ``, fmt.Errorf("InvalidMailAddress:%s", address)
+	}
+	return a.Address, nil
+}
+
+func writeQuotedPrintablePart(w *multipart.Writer, contentType string, content string) (err error) {
+	pw, err := w.CreatePart(textproto.MIMEHeader{
+		`Content-Type`:              {contentType + `; charset=UTF-8`},
+		`Content-Transfer-Encoding`: {`quoted-printable`},
+	})
+	if err != nil {
+		return err
+	}
+	qw := quotedprintable.NewWriter(pw)
+	_, err = qw.Write([]byte(content))
+	if err != nil {
+		return err
+	}
+	return qw.Close()
+}
+
+// base64LineWriter breaks the base64 content into the 76 character lines of RFC 2045.
+type base64LineWriter struct {
+	b      *bytes.Buffer
+	column int
+}
+
+func (l *base64LineWriter) Write(p []byte) (n int, err error) {
+	for _, c := range p {
+		if l.column == 76 {
+			l.b.WriteString("\r\n")
+			l.column = 0
+		}
+		l.b.WriteByte(c)
+		l.column++
+	}
+	return len(p), nil
+}
+
+// body gives the headers and the content of the text and html bodies, a single part when only one of them is set.
+func (m DXMailMessage) body() (header textproto.MIMEHeader, content []byte, err error) {
+	b := &bytes.Buffer{}
+	if m.Text == `` || m.HTML == `` {
+		contentType, s := `text/plain`, m.Text
+		if m.HTML != `` {
+			contentType, s = `text/html`, m.HTML
+		}
+		qw := quotedprintable.NewWriter(b)
+		_, err = qw.Write([]byte(s))
+		if err == nil {
+			err = qw.Close()
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		header = textproto.MIMEHeader{
+			`Content-Type`:              {contentType + `; charset=UTF-8`},
+			`Content-Transfer-Encoding`: {`quoted-printable`},
+		}
+		return header, b.Bytes(), nil
+	}
+	w := multipart.NewWriter(b)
+	err = writeQuotedPrintablePart(w, `text/plain`, m.Text)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = writeQuotedPrintablePart(w, `text/html`, m.HTML)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	header = textproto.MIMEHeader{
+		`Content-Type`: {`multipart/alternative; boundary=` + w.Boundary()},
+	}
+	return header, b.Bytes(), nil
+}
+
+// Build gives the RFC 5322 message, the text and html bodies are multipart/alternative and the attachments turn it into
+// multipart/mixed. The Bcc recipients are left out.
+func (m DXMailMessage) Build() (r []byte, err error) {
+	b := &bytes.Buffer{}
+	from, err := encodeAddressList([]string{m.From})
+	if err != nil {
+		return nil, err
+	}
+	headers := [][2]string{
+		{`From`, from},
+	}
+	for _, v := range []struct {
+		name      string
+		addresses []string
+	}{{`To`, m.To}, {`Cc`, m.Cc}} {
+		if len(v.addresses) == 0 {
+			continue
+		}
+		s, err := encodeAddressList(v.addresses)
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, [2]string{v.name, s})
+	}
+	if m.ReplyTo != `` {
+		s, err := encodeAddressList([]string{m.ReplyTo})
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, [2]string{`Reply-To`, s})
+	}
+	domain := `localhost`
+	fromAddress, _ := addressOnly(m.From)
+	if i := strings.LastIndex(fromAddress, `@`); i >= 0 {
+		domain = fromAddress[i+1:]
+	}
+	headers = append(headers,
+		[2]string{`Subject`, mime.QEncoding.Encode(`UTF-8`, m.Subject)},
+		[2]string{`Date`, time.Now().Format(time.RFC1123Z)},
+		[2]string{`Message-ID`, `<` + randomId() + `@` + domain + `>`},
+		[2]string{`MIME-Version`, `1.0`},
+	)
+	for _, v := range headers {
+		b.WriteString(v[0] + `: ` + v[1] + "\r\n")
+	}
+	bodyHeader, bodyContent, err := m.body()
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Attachments) == 0 {
+		for _, k := range []string{`Content-Type`, `Content-Transfer-Encoding`} {
+			if bodyHeader.Get(k) != `` {
+				b.WriteString(k + `: ` + bodyHeader.Get(k) + "\r\n")
+			}
+		}
+		b.WriteString("\r\n")
+		b.Write(bodyContent)
+		return b.Bytes(), nil
+	}
+
+	w := multipart.NewWriter(b)
+	b.WriteString(`Content-Type: multipart/mixed; boundary=` + w.Boundary() + "\r\n\r\n")
+	pw, err := w.CreatePart(bodyHeader)
+	if err != nil {
+		return nil, err
+	}
+	_, err = pw.Write(bodyContent)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range m.Attachments {
+		contentType := a.ContentType
+		if contentType == `` {
+			contentType = `application/octet-stream`
+		}
+		pw, err := w.CreatePart(textproto.MIMEHeader{
+			`Content-Type`:              {mime.FormatMediaType(contentType, map[string]string{`name`: a.FileName})},
+			`Content-Disposition`:       {mime.FormatMediaType(`attachment`, map[string]string{`filename`: a.FileName})},
+			`Content-Transfer-Encoding`: {`base64`},
+		})
+		if err != nil {
+			return nil, err
+		}
+		lines := &bytes.Buffer{}
+		enc := base64.NewEncoder(base64.StdEncoding, &base64LineWriter{b: lines})
+		_, _ = enc.Write(a.Content)
+		_ = enc.Close()
+		_, err = pw.Write(lines.Bytes())
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
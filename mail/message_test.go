@@ -0,0 +1,123 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readTestPart gives the media type and the decoded content of p, multipart.Part already decodes quoted-printable.
+func readTestPart(t *testing.T, p *multipart.Part) (mediaType string, content string) {
+	t.Helper()
+	mediaType, _, err := mime.ParseMediaType(p.Header.Get(`Content-Type`))
+	require.NoError(t, err)
+	var r io.Reader = p
+	if p.Header.Get(`Content-Transfer-Encoding`) == `base64` {
+		r = base64.NewDecoder(base64.StdEncoding, p)
+	}
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return mediaType, string(b)
+}
+
+func TestBuildTextAndHTMLWithAnAttachment(t *testing.T) {
+	attachment := bytes.Repeat([]byte{0, 1, 2, 0xff}, 100)
+	b, err := DXMailMessage{
+		From:        `Billing <billing@example.com>`,
+		To:          []string{`Alice <alice@example.com>`, `bob@example.com`},
+		Cc:          []string{`carol@example.com`},
+		Bcc:         []string{`audit@example.com`},
+		ReplyTo:     `support@example.com`,
+		Subject:     `Invoice — Oktober`,
+		Text:        `Your invoice is attached.`,
+		HTML:        `<p>Your invoice is attached.</p>`,
+		Attachments: []DXMailAttachment{{FileName: `invoice.pdf`, ContentType: `application/pdf`, Content: attachment}},
+	}.Build()
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), `audit@example.com`)
+	for _, line := range strings.Split(string(b), "\r\n") {
+		assert.LessOrEqual(t, len(line), 998)
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(b))
+	require.NoError(t, err)
+	assert.Equal(t, `"Billing" <billing@example.com>`, m.Header.Get(`From`))
+	assert.Equal(t, `"Alice" <alice@example.com>, <bob@example.com>`, m.Header.Get(`To`))
+	assert.Equal(t, `<carol@example.com>`, m.Header.Get(`Cc`))
+	assert.Equal(t, `<support@example.com>`, m.Header.Get(`Reply-To`))
+	assert.Empty(t, m.Header.Get(`Bcc`))
+	subject, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get(`Subject`))
+	require.NoError(t, err)
+	assert.Equal(t, `Invoice — Oktober`, subject)
+	assert.True(t, strings.HasSuffix(m.Header.Get(`Message-ID`), `@example.com>`))
+	_, err = m.Header.Date()
+	require.NoError(t, err)
+
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get(`Content-Type`))
+	require.NoError(t, err)
+	assert.Equal(t, `multipart/mixed`, mediaType)
+	mixed := multipart.NewReader(m.Body, params[`boundary`])
+	body, err := mixed.NextPart()
+	require.NoError(t, err)
+	mediaType, params, err = mime.ParseMediaType(body.Header.Get(`Content-Type`))
+	require.NoError(t, err)
+	assert.Equal(t, `multipart/alternative`, mediaType)
+	alternative := multipart.NewReader(body, params[`boundary`])
+	for _, expected := range [][2]string{{`text/plain`, `Your invoice is attached.`}, {`text/html`, `<p>Your invoice is attached.</p>`}} {
+		p, err := alternative.NextPart()
+		require.NoError(t, err)
+		mediaType, content := readTestPart(t, p)
+		assert.Equal(t, expected[0], mediaType)
+		assert.Equal(t, expected[1], content)
+	}
+
+	p, err := mixed.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, `invoice.pdf`, p.FileName())
+	mediaType, content := readTestPart(t, p)
+	assert.Equal(t, `application/pdf`, mediaType)
+	assert.Equal(t, attachment, []byte(content))
+	_, err = mixed.NextPart()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestBuildASingleBody(t *testing.T) {
+	for _, tt := range []struct {
+		message   DXMailMessage
+		mediaType string
+		content   string
+	}{
+		{DXMailMessage{From: `a@example.com`, To: []string{`b@example.com`}, Text: `hello=world`}, `text/plain`, `hello=world`},
+		{DXMailMessage{From: `a@example.com`, To: []string{`b@example.com`}, HTML: `<b>hello</b>`}, `text/html`, `<b>hello</b>`},
+	} {
+		t.Run(tt.mediaType, func(t *testing.T) {
+			b, err := tt.message.Build()
+			require.NoError(t, err)
+			m, err := mail.ReadMessage(bytes.NewReader(b))
+			require.NoError(t, err)
+			mediaType, _, err := mime.ParseMediaType(m.Header.Get(`Content-Type`))
+			require.NoError(t, err)
+			assert.Equal(t, tt.mediaType, mediaType)
+			assert.Equal(t, `quoted-printable`, m.Header.Get(`Content-Transfer-Encoding`))
+			content, err := io.ReadAll(quotedprintable.NewReader(m.Body))
+			require.NoError(t, err)
+			assert.Equal(t, tt.content, string(content))
+		})
+	}
+}
+
+func TestBuildRefusesAnInvalidAddress(t *testing.T) {
+	_, err := DXMailMessage{From: `a@example.com`, To: []string{`not an address`}, Text: `x`}.Build()
+	assert.EqualError(t, err, `InvalidMailAddress:not an address`)
+	_, err = DXMailMessage{From: ``, To: []string{`b@example.com`}, Text: `x`}.Build()
+	assert.ErrorContains(t, err, `InvalidMailAddress`)
+}
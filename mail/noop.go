@@ -0,0 +1,44 @@
+package mail
+
+import (
+	"context"
+	"sync"
+)
+
+// DXMailTransportNoop sends nothing, it keeps the messages for the tests to look at.
+type DXMailTransportNoop struct {
+	mutex    sync.Mutex
+	messages []DXMailMessage
+}
+
+func NewNoopTransport() *DXMailTransportNoop {
+	return &DXMailTransportNoop{}
+}
+
+func (t *DXMailTransportNoop) Send(ctx context.Context, m DXMailMessage) (err error) {
+	err = ctx.Err()
+	if err != nil {
+		return err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.messages = append(t.messages, m)
+	return nil
+}
+
+// Messages gives a copy of the messages sent so far.
+func (t *DXMailTransportNoop) Messages() []DXMailMessage {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]DXMailMessage{}, t.messages...)
+}
+
+func (t *DXMailTransportNoop) Reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.messages = nil
+}
+
+func (t *DXMailTransportNoop) Close() (err error) {
+	return nil
+}
@@ -0,0 +1,177 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+	"dxlib/v3/utils/json"
+)
+
+const (
+	DXMailSMTPSecurityStartTLS = "starttls"
+	DXMailSMTPSecurityTLS      = "tls"
+	DXMailSMTPSecurityNone     = "none"
+)
+
+// DXMailTransportSMTP opens a connection for every message. Security is "starttls" (the default, upgraded when the
+// server offers it), "tls" for the implicit TLS of port 465, or "none".
+type DXMailTransportSMTP struct {
+	Host     string
+	Port     int
+	UserName string
+	Password string
+	Security string
+	Timeout  time.Duration
+}
+
+// NewSMTPTransportFromConfiguration reads the fields host, port, user_name, password, security and timeout_sec.
+func NewSMTPTransportFromConfiguration(nameId string, c utils.JSON) (transport *DXMailTransportSMTP, err error) {
+	host, ok := c[`host`].(string)
+	if !ok || host == `` {
+		err = log.Log.ErrorAndCreateErrorf("configuration is unusable, mandatory host field of mail %s not exist", nameId)
+		return nil, err
+	}
+	security, _ := c[`security`].(string)
+	switch security {
+	case ``:
+		security = DXMailSMTPSecurityStartTLS
+	case DXMailSMTPSecurityStartTLS, DXMailSMTPSecurityTLS, DXMailSMTPSecurityNone:
+	default:
+		err = log.Log.ErrorAndCreateErrorf("configuration is unusable, security of mail %s is not supported (%s)", nameId, security)
+		return nil, err
+	}
+	defaultPort := 587
+	if security == DXMailSMTPSecurityTLS {
+		defaultPort = 465
+	}
+	port := json.GetNumberWithDefault[int](c, `port`, defaultPort)
+	timeoutSec := json.GetNumberWithDefault[int](c, `timeout_sec`, DXMailDefaultTimeoutSec)
+	userName, _ := c[`user_name`].(string)
+	password, _ := c[`password`].(string)
+	return &DXMailTransportSMTP{
+		Host:     host,
+		Port:     port,
+		UserName: userName,
+		Password: password,
+		Security: security,
+		Timeout:  time.Duration(timeoutSec) * time.Second,
+	}, nil
+}
+
+// Send gives up at the earlier of the deadline of ctx and Timeout, cancelling ctx closes the connection.
+func (t *DXMailTransportSMTP) Send(ctx context.Context, m DXMailMessage) (err error) {
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+	content, err := m.Build()
+	if err != nil {
+		return err
+	}
+	from, err := addressOnly(m.From)
+	if err != nil {
+		return err
+	}
+	recipients := []string{}
+	for _, v := range m.Recipients() {
+		a, err := addressOnly(v)
+		if err != nil {
+			return err
+		}
+		recipients = append(recipients, a)
+	}
+
+	address := net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+	tlsConfig := &tls.Config{ServerName: t.Host}
+	dialer := &net.Dialer{}
+	var conn net.Conn
+	if t.Security == DXMailSMTPSecurityTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, `tcp`, address)
+	} else {
+		conn, err = dialer.DialContext(ctx, `tcp`, address)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+	defer stop()
+
+	client, err := smtp.NewClient(conn, t.Host)
+	if err != nil {
+		_ = conn.Close()
+		return contextErrorOr(ctx, err)
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+	err = t.send(client, tlsConfig, from, recipients, content)
+	if err != nil {
+		return contextErrorOr(ctx, err)
+	}
+	return nil
+}
+
+func (t *DXMailTransportSMTP) send(client *smtp.Client, tlsConfig *tls.Config, from string, recipients []string, content []byte) (err error) {
+	if t.Security == DXMailSMTPSecurityStartTLS {
+		if ok, _ := client.Extension(`STARTTLS`); ok {
+			err = client.StartTLS(tlsConfig)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if t.UserName != `` {
+		// smtp.PlainAuth refuses to send the password over a connection without TLS, except to localhost
+		err = client.Auth(smtp.PlainAuth(``, t.UserName, t.Password, t.Host))
+		if err != nil {
+			return err
+		}
+	}
+	err = client.Mail(from)
+	if err != nil {
+		return err
+	}
+	for _, v := range recipients {
+		err = client.Rcpt(v)
+		if err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (t *DXMailTransportSMTP) Close() (err error) {
+	return nil
+}
+
+// contextErrorOr gives the error of ctx when it is done, a closed connection error is only its consequence.
+func contextErrorOr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
@@ -0,0 +1,376 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/sync/errgroup"
+
+	"dxlib/v3/configurations"
+	"dxlib/v3/log"
+	"dxlib/v3/subsystems"
+)
+
+const DXMetricsDefaultPath = "/metrics"
+
+// DXMetricsDBStats are the statistics of a connection pool and the role of its database, primary or replica.
+type DXMetricsDBStats struct {
+	Role  string
+	Stats sql.DBStats
+}
+
+type DXMetricsDBStatsFunc func() map[string]DXMetricsDBStats
+
+// DXMetricsRedisStats are the statistics of the connection pool of a Redis.
+type DXMetricsRedisStats struct {
+	Hits       uint32
+	Misses     uint32
+	Timeouts   uint32
+	TotalConns uint32
+	IdleConns  uint32
+	StaleConns uint32
+}
+
+type DXMetricsRedisStatsFunc func() map[string]DXMetricsRedisStats
+
+// DXMetricsCircuitBreakerStats are the state of a circuit breaker, 0 closed, 1 open and 2 half-open, and the total of
+// the calls it failed at once.
+type DXMetricsCircuitBreakerStats struct {
+	State      int
+	Rejections uint64
+}
+
+type DXMetricsCircuitBreakerStatsFunc func() map[string]DXMetricsCircuitBreakerStats
+
+type DXMetricsManager struct {
+	IsEnabled                    bool
+	IsFatal                      bool
+	Address                      string
+	Path                         string
+	Registry                     *prometheus.Registry
+	HTTPServer                   *http.Server
+	APIRequestDurationSeconds    *prometheus.HistogramVec
+	TaskExecutionTotal           *prometheus.CounterVec
+	TaskExecutionFailureTotal    *prometheus.CounterVec
+	TaskExecutionDurationSeconds *prometheus.HistogramVec
+	RedisCommandDurationSeconds  *prometheus.HistogramVec
+	PanicTotal                   *prometheus.CounterVec
+}
+
+type dbStatsCollector struct {
+	statsFunc          DXMetricsDBStatsFunc
+	maxOpenConnections *prometheus.Desc
+	openConnections    *prometheus.Desc
+	inUse              *prometheus.Desc
+	idle               *prometheus.Desc
+	waitCount          *prometheus.Desc
+	waitDuration       *prometheus.Desc
+	maxIdleClosed      *prometheus.Desc
+	maxIdleTimeClosed  *prometheus.Desc
+	maxLifetimeClosed  *prometheus.Desc
+}
+
+func newDBStatsCollector(statsFunc DXMetricsDBStatsFunc) *dbStatsCollector {
+	labels := []string{"database", "role"}
+	return &dbStatsCollector{
+		statsFunc:          statsFunc,
+		maxOpenConnections: prometheus.NewDesc("dxlib_db_max_open_connections", "Maximum number of open connections to the database.", labels, nil),
+		openConnections:    prometheus.NewDesc("dxlib_db_open_connections", "The number of established connections both in use and idle.", labels, nil),
+		inUse:              prometheus.NewDesc("dxlib_db_in_use_connections", "The number of connections currently in use.", labels, nil),
+		idle:               prometheus.NewDesc("dxlib_db_idle_connections", "The number of idle connections.", labels, nil),
+		waitCount:          prometheus.NewDesc("dxlib_db_wait_count_total", "The total number of connections waited for.", labels, nil),
+		waitDuration:       prometheus.NewDesc("dxlib_db_wait_duration_seconds_total", "The total time blocked waiting for a new connection.", labels, nil),
+		maxIdleClosed:      prometheus.NewDesc("dxlib_db_max_idle_closed_total", "The total number of connections closed due to SetMaxIdleConns.", labels, nil),
+		maxIdleTimeClosed:  prometheus.NewDesc("dxlib_db_max_idle_time_closed_total", "The total number of connections closed due to SetConnMaxIdleTime.", labels, nil),
+		maxLifetimeClosed:  prometheus.NewDesc("dxlib_db_max_lifetime_closed_total", "The total number of connections closed due to SetConnMaxLifetime.", labels, nil),
+	}
+}
+
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxOpenConnections
+	ch <- c.openConnections
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+	ch <- c.maxIdleClosed
+	ch <- c.maxIdleTimeClosed
+	ch <- c.maxLifetimeClosed
+}
+
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	for nameId, x := range c.statsFunc() {
+		s := x.Stats
+		ch <- prometheus.MustNewConstMetric(c.maxOpenConnections, prometheus.GaugeValue, float64(s.MaxOpenConnections), nameId, x.Role)
+		ch <- prometheus.MustNewConstMetric(c.openConnections, prometheus.GaugeValue, float64(s.OpenConnections), nameId, x.Role)
+		ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(s.InUse), nameId, x.Role)
+		ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(s.Idle), nameId, x.Role)
+		ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(s.WaitCount), nameId, x.Role)
+		ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, s.WaitDuration.Seconds(), nameId, x.Role)
+		ch <- prometheus.MustNewConstMetric(c.maxIdleClosed, prometheus.CounterValue, float64(s.MaxIdleClosed), nameId, x.Role)
+		ch <- prometheus.MustNewConstMetric(c.maxIdleTimeClosed, prometheus.CounterValue, float64(s.MaxIdleTimeClosed), nameId, x.Role)
+		ch <- prometheus.MustNewConstMetric(c.maxLifetimeClosed, prometheus.CounterValue, float64(s.MaxLifetimeClosed), nameId, x.Role)
+	}
+}
+
+func (mm *DXMetricsManager) RegisterDBStats(statsFunc DXMetricsDBStatsFunc) (err error) {
+	err = mm.Registry.Register(newDBStatsCollector(statsFunc))
+	if err != nil {
+		log.Log.Errorf("Cannot register database stats collector (%v)", err)
+		return err
+	}
+	return nil
+}
+
+type redisStatsCollector struct {
+	statsFunc         DXMetricsRedisStatsFunc
+	activeConnections *prometheus.Desc
+	idleConnections   *prometheus.Desc
+	staleConnections  *prometheus.Desc
+	hits              *prometheus.Desc
+	misses            *prometheus.Desc
+	timeouts          *prometheus.Desc
+}
+
+func newRedisStatsCollector(statsFunc DXMetricsRedisStatsFunc) *redisStatsCollector {
+	labels := []string{"redis"}
+	return &redisStatsCollector{
+		statsFunc:         statsFunc,
+		activeConnections: prometheus.NewDesc("dxlib_redis_active_connections", "The number of connections in use.", labels, nil),
+		idleConnections:   prometheus.NewDesc("dxlib_redis_idle_connections", "The number of idle connections.", labels, nil),
+		staleConnections:  prometheus.NewDesc("dxlib_redis_stale_connections_total", "The total number of stale connections removed from the pool.", labels, nil),
+		hits:              prometheus.NewDesc("dxlib_redis_pool_hits_total", "The total number of times a free connection was found in the pool.", labels, nil),
+		misses:            prometheus.NewDesc("dxlib_redis_pool_misses_total", "The total number of times a free connection was not found in the pool.", labels, nil),
+		timeouts:          prometheus.NewDesc("dxlib_redis_pool_timeouts_total", "The total number of times a wait for a connection timed out.", labels, nil),
+	}
+}
+
+func (c *redisStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.activeConnections
+	ch <- c.idleConnections
+	ch <- c.staleConnections
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.timeouts
+}
+
+func (c *redisStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	for nameId, s := range c.statsFunc() {
+		ch <- prometheus.MustNewConstMetric(c.activeConnections, prometheus.GaugeValue, float64(s.TotalConns-s.IdleConns), nameId)
+		ch <- prometheus.MustNewConstMetric(c.idleConnections, prometheus.GaugeValue, float64(s.IdleConns), nameId)
+		ch <- prometheus.MustNewConstMetric(c.staleConnections, prometheus.CounterValue, float64(s.StaleConns), nameId)
+		ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(s.Hits), nameId)
+		ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(s.Misses), nameId)
+		ch <- prometheus.MustNewConstMetric(c.timeouts, prometheus.CounterValue, float64(s.Timeouts), nameId)
+	}
+}
+
+func (mm *DXMetricsManager) RegisterRedisStats(statsFunc DXMetricsRedisStatsFunc) (err error) {
+	err = mm.Registry.Register(newRedisStatsCollector(statsFunc))
+	if err != nil {
+		log.Log.Errorf("Cannot register redis stats collector (%v)", err)
+		return err
+	}
+	return nil
+}
+
+type circuitBreakerStatsCollector struct {
+	statsFunc  DXMetricsCircuitBreakerStatsFunc
+	state      *prometheus.Desc
+	rejections *prometheus.Desc
+}
+
+func newCircuitBreakerStatsCollector(statsFunc DXMetricsCircuitBreakerStatsFunc) *circuitBreakerStatsCollector {
+	labels := []string{"breaker"}
+	return &circuitBreakerStatsCollector{
+		statsFunc:  statsFunc,
+		state:      prometheus.NewDesc("dxlib_circuit_breaker_state", "The state of the circuit breaker, 0 closed, 1 open and 2 half-open.", labels, nil),
+		rejections: prometheus.NewDesc("dxlib_circuit_breaker_rejections_total", "The total number of calls failed at once by the circuit breaker.", labels, nil),
+	}
+}
+
+func (c *circuitBreakerStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.state
+	ch <- c.rejections
+}
+
+func (c *circuitBreakerStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	for nameId, s := range c.statsFunc() {
+		ch <- prometheus.MustNewConstMetric(c.state, prometheus.GaugeValue, float64(s.State), nameId)
+		ch <- prometheus.MustNewConstMetric(c.rejections, prometheus.CounterValue, float64(s.Rejections), nameId)
+	}
+}
+
+func (mm *DXMetricsManager) RegisterCircuitBreakerStats(statsFunc DXMetricsCircuitBreakerStatsFunc) (err error) {
+	err = mm.Registry.Register(newCircuitBreakerStatsCollector(statsFunc))
+	if err != nil {
+		log.Log.Errorf("Cannot register circuit breaker stats collector (%v)", err)
+		return err
+	}
+	return nil
+}
+
+func (mm *DXMetricsManager) RegisterGaugeFunc(name string, help string, valueFunc func() float64) {
+	err := mm.Registry.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: name,
+		Help: help,
+	}, valueFunc))
+	if err != nil {
+		log.Log.Errorf("Cannot register gauge %s (%v)", name, err)
+	}
+}
+
+func (mm *DXMetricsManager) Handler() http.Handler {
+	return promhttp.HandlerFor(mm.Registry, promhttp.HandlerOpts{Registry: mm.Registry})
+}
+
+func (mm *DXMetricsManager) ApplyConfigurations() (err error) {
+	mm.Path = DXMetricsDefaultPath
+	configuration, ok := configurations.Manager.Get("metrics")
+	if !ok {
+		return nil
+	}
+	c := *configuration.Data
+	address, ok := c[`address`].(string)
+	if ok {
+		mm.Address = address
+	}
+	path, ok := c[`path`].(string)
+	if ok {
+		mm.Path = path
+	}
+	isFatal, ok := c[`is_fatal`].(bool)
+	if ok {
+		mm.IsFatal = isFatal
+	}
+	return nil
+}
+
+// StartAll only starts a dedicated listener when an address is configured, otherwise the metrics are served by the API servers.
+func (mm *DXMetricsManager) StartAll(errorGroup *errgroup.Group, errorGroupContext context.Context) (err error) {
+	if !mm.IsEnabled {
+		return nil
+	}
+	err = mm.ApplyConfigurations()
+	if err != nil {
+		return err
+	}
+	if mm.Address == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle(mm.Path, mm.Handler())
+	httpServer := &http.Server{
+		Addr:    mm.Address,
+		Handler: mux,
+	}
+	mm.HTTPServer = httpServer
+	subsystems.Go(errorGroup, errorGroupContext, `metrics`, mm.IsFatal, func() error {
+		log.Log.Infof("Metrics listening at %s%s... start", mm.Address, mm.Path)
+		err := httpServer.ListenAndServe()
+		log.Log.Infof("Metrics listening at %s%s... stopped (%v)", mm.Address, mm.Path, err)
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	})
+	errorGroup.Go(func() error {
+		<-errorGroupContext.Done()
+		return mm.StopAll()
+	})
+	return nil
+}
+
+func (mm *DXMetricsManager) StopAll() (err error) {
+	if mm.HTTPServer == nil {
+		return nil
+	}
+	log.Log.Info("Metrics shutting down...")
+	err = mm.HTTPServer.Close()
+	mm.HTTPServer = nil
+	return err
+}
+
+func (mm *DXMetricsManager) ObserveAPIRequest(apiNameId, method, uri string, statusCode int, durationSec float64) {
+	if !mm.IsEnabled {
+		return
+	}
+	mm.APIRequestDurationSeconds.WithLabelValues(apiNameId, method, uri, strconv.Itoa(statusCode)).Observe(durationSec)
+}
+
+func (mm *DXMetricsManager) ObserveTaskExecution(taskNameId string, durationSec float64, err error) {
+	if !mm.IsEnabled {
+		return
+	}
+	mm.TaskExecutionTotal.WithLabelValues(taskNameId).Inc()
+	mm.TaskExecutionDurationSeconds.WithLabelValues(taskNameId).Observe(durationSec)
+	if err != nil {
+		mm.TaskExecutionFailureTotal.WithLabelValues(taskNameId).Inc()
+	}
+}
+
+func (mm *DXMetricsManager) ObserveRedisCommand(redisNameId, command string, durationSec float64) {
+	if !mm.IsEnabled {
+		return
+	}
+	mm.RedisCommandDurationSeconds.WithLabelValues(redisNameId, command).Observe(durationSec)
+}
+
+// ObservePanic counts a panic of a request, task or job scope, scope is api, grpc, task or job.
+func (mm *DXMetricsManager) ObservePanic(scope string) {
+	if !mm.IsEnabled {
+		return
+	}
+	mm.PanicTotal.WithLabelValues(scope).Inc()
+}
+
+var Manager DXMetricsManager
+
+func init() {
+	Manager = DXMetricsManager{
+		IsEnabled: false,
+		IsFatal:   true,
+		Path:      DXMetricsDefaultPath,
+		Registry:  prometheus.NewRegistry(),
+		APIRequestDurationSeconds: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "dxlib_api_request_duration_seconds",
+			Help: "Duration of the API requests.",
+		}, []string{"api", "method", "uri", "status_code"}),
+		TaskExecutionTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "dxlib_task_execution_total",
+			Help: "Total number of task executions.",
+		}, []string{"task"}),
+		TaskExecutionFailureTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "dxlib_task_execution_failure_total",
+			Help: "Total number of failed task executions.",
+		}, []string{"task"}),
+		TaskExecutionDurationSeconds: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "dxlib_task_execution_duration_seconds",
+			Help: "Duration of the task executions.",
+		}, []string{"task"}),
+		RedisCommandDurationSeconds: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "dxlib_redis_command_duration_seconds",
+			Help: "Duration of the Redis commands.",
+		}, []string{"redis", "command"}),
+		PanicTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "dxlib_panic_total",
+			Help: "Total number of panics of the request, task and job scopes.",
+		}, []string{"scope"}),
+	}
+	Manager.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		Manager.APIRequestDurationSeconds,
+		Manager.TaskExecutionTotal,
+		Manager.TaskExecutionFailureTotal,
+		Manager.TaskExecutionDurationSeconds,
+		Manager.RedisCommandDurationSeconds,
+		Manager.PanicTotal,
+	)
+}
@@ -0,0 +1,187 @@
+package objectstorage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+)
+
+// DXObjectStorageLocal keeps the objects as files under Root. Its signed URLs are BaseURL/key?expires=..&signature=..,
+// served by the application with VerifySignedURL, they need a SigningKey.
+type DXObjectStorageLocal struct {
+	Root       string
+	BaseURL    string
+	SigningKey string
+}
+
+// NewLocalBackendFromConfiguration reads the fields path, base_url and signing_key.
+func NewLocalBackendFromConfiguration(nameId string, c utils.JSON) (backend *DXObjectStorageLocal, err error) {
+	root, ok := c[`path`].(string)
+	if !ok || root == `` {
+		err = log.Log.ErrorAndCreateErrorf("configuration is unusable, mandatory path field of object storage %s not exist", nameId)
+		return nil, err
+	}
+	baseURL, _ := c[`base_url`].(string)
+	signingKey, _ := c[`signing_key`].(string)
+	return NewLocalBackend(root, baseURL, signingKey)
+}
+
+func NewLocalBackend(root string, baseURL string, signingKey string) (backend *DXObjectStorageLocal, err error) {
+	err = os.MkdirAll(root, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &DXObjectStorageLocal{
+		Root:       root,
+		BaseURL:    strings.TrimSuffix(baseURL, `/`),
+		SigningKey: signingKey,
+	}, nil
+}
+
+// filename refuses the keys leaving Root, like "../a".
+func (l *DXObjectStorageLocal) filename(key string) (s string, err error) {
+	cleanKey := path.Clean(`/` + key)
+	if cleanKey == `/` || cleanKey != `/`+key {
+		return ``, fmt.Errorf("InvalidObjectKey:%s", key)
+	}
+	return filepath.Join(l.Root, filepath.FromSlash(cleanKey)), nil
+}
+
+// Put writes a temporary file next to the object and renames it, a reader never sees a partial object.
+func (l *DXObjectStorageLocal) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (err error) {
+	filename, err := l.filename(key)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(filename), 0o755)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(filename), `.put-*`)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+	_, err = io.Copy(f, contextReader{ctx: ctx, r: r})
+	errClose := f.Close()
+	if err != nil {
+		return err
+	}
+	if errClose != nil {
+		return errClose
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+func (l *DXObjectStorageLocal) Get(ctx context.Context, key string) (r io.ReadCloser, err error) {
+	filename, err := l.filename(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Delete of a missing key is not an error.
+func (l *DXObjectStorageLocal) Delete(ctx context.Context, key string) (err error) {
+	filename, err := l.filename(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (l *DXObjectStorageLocal) Exists(ctx context.Context, key string) (exists bool, err error) {
+	filename, err := l.filename(key)
+	if err != nil {
+		return false, err
+	}
+	info, err := os.Stat(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !info.IsDir(), nil
+}
+
+func (l *DXObjectStorageLocal) signature(key string, expires string) string {
+	mac := hmac.New(sha256.New, []byte(l.SigningKey))
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (l *DXObjectStorageLocal) SignedURL(ctx context.Context, key string, expiry time.Duration) (s string, err error) {
+	if l.BaseURL == `` || l.SigningKey == `` {
+		return ``, errors.New("LocalObjectStorageSignedURLNeedsBaseURLAndSigningKey")
+	}
+	_, err = l.filename(key)
+	if err != nil {
+		return ``, err
+	}
+	expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+	q := url.Values{}
+	q.Set(`expires`, expires)
+	q.Set(`signature`, l.signature(key, expires))
+	return l.BaseURL + `/` + (&url.URL{Path: key}).EscapedPath() + `?` + q.Encode(), nil
+}
+
+// VerifySignedURL checks the expires and signature query values of a URL given by SignedURL for key.
+func (l *DXObjectStorageLocal) VerifySignedURL(key string, expires string, signature string) bool {
+	if l.SigningKey == `` {
+		return false
+	}
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(l.signature(key, expires)))
+}
+
+func (l *DXObjectStorageLocal) Close() (err error) {
+	return nil
+}
+
+// contextReader stops a copy once ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (n int, err error) {
+	err = c.ctx.Err()
+	if err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
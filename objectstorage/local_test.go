@@ -0,0 +1,66 @@
+package objectstorage
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalRefusesTheKeysLeavingTheRoot(t *testing.T) {
+	root := filepath.Join(t.TempDir(), `root`)
+	l, err := NewLocalBackend(root, ``, ``)
+	require.NoError(t, err)
+
+	for _, key := range []string{`../a`, `a/../../b`, `/a`, `a//b`, ``} {
+		err = l.Put(context.Background(), key, strings.NewReader(`x`), 1, ``)
+		assert.ErrorContains(t, err, `InvalidObjectKey`, key)
+	}
+	_, err = os.Stat(filepath.Join(filepath.Dir(root), `a`))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestLocalSignedURL(t *testing.T) {
+	l, err := NewLocalBackend(t.TempDir(), `https://files.example.com/objects/`, `key`)
+	require.NoError(t, err)
+
+	signedURL, err := l.SignedURL(context.Background(), `a/b.pdf`, time.Hour)
+	require.NoError(t, err)
+	u, err := url.Parse(signedURL)
+	require.NoError(t, err)
+	assert.Equal(t, `/objects/a/b.pdf`, u.Path)
+	q := u.Query()
+	assert.True(t, l.VerifySignedURL(`a/b.pdf`, q.Get(`expires`), q.Get(`signature`)))
+	assert.False(t, l.VerifySignedURL(`a/c.pdf`, q.Get(`expires`), q.Get(`signature`)))
+
+	expired, err := l.SignedURL(context.Background(), `a/b.pdf`, -time.Minute)
+	require.NoError(t, err)
+	u, err = url.Parse(expired)
+	require.NoError(t, err)
+	assert.False(t, l.VerifySignedURL(`a/b.pdf`, u.Query().Get(`expires`), u.Query().Get(`signature`)))
+
+	unsigned, err := NewLocalBackend(t.TempDir(), ``, ``)
+	require.NoError(t, err)
+	_, err = unsigned.SignedURL(context.Background(), `a/b.pdf`, time.Hour)
+	assert.Error(t, err)
+}
+
+func TestLocalPutStopsWhenTheContextIsDone(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewLocalBackend(dir, ``, ``)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = l.Put(ctx, `a.txt`, strings.NewReader(`x`), 1, ``)
+	assert.ErrorIs(t, err, context.Canceled)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, `the temporary file is removed`)
+}
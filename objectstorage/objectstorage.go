@@ -0,0 +1,115 @@
+package objectstorage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"dxlib/v3/configurations"
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+)
+
+const (
+	DXObjectStorageTypeLocal = "local"
+	DXObjectStorageTypeS3    = "s3"
+)
+
+var ErrObjectNotFound = errors.New("ObjectNotFound")
+
+// DXObjectStorageBackend is implemented by every object storage type, key is a slash separated path like
+// "documents/2024/a.pdf". Get of a missing key gives ErrObjectNotFound.
+type DXObjectStorageBackend interface {
+	// Put stores r under key, size is -1 when unknown
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (err error)
+	Get(ctx context.Context, key string) (r io.ReadCloser, err error)
+	Delete(ctx context.Context, key string) (err error)
+	Exists(ctx context.Context, key string) (exists bool, err error)
+	// SignedURL gives a URL that reads key without credentials until expiry
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (url string, err error)
+	Close() (err error)
+}
+
+type DXObjectStorage struct {
+	Owner   *DXObjectStorageManager
+	NameId  string
+	Type    string
+	Backend DXObjectStorageBackend
+}
+
+type DXObjectStorageManager struct {
+	ObjectStorages map[string]*DXObjectStorage
+}
+
+// NewBackend creates the backend of the type field of c, "local" or "s3".
+func NewBackend(nameId string, c utils.JSON) (backend DXObjectStorageBackend, err error) {
+	backendType, _ := c[`type`].(string)
+	switch backendType {
+	case DXObjectStorageTypeLocal:
+		return NewLocalBackendFromConfiguration(nameId, c)
+	case DXObjectStorageTypeS3:
+		return NewS3BackendFromConfiguration(nameId, c)
+	default:
+		err = log.Log.ErrorAndCreateErrorf("configuration is unusable, type of object storage %s is not supported (%s)", nameId, backendType)
+		return nil, err
+	}
+}
+
+func (osm *DXObjectStorageManager) LoadFromConfiguration(configurationNameId string) (err error) {
+	configuration, err := configurations.Manager.Lookup(configurationNameId)
+	if err != nil {
+		return err
+	}
+	for k, v := range *configuration.Data {
+		if k == `enabled` {
+			continue
+		}
+		c, ok := v.(utils.JSON)
+		if !ok {
+			err := log.Log.ErrorAndCreateErrorf("Cannot read %s as JSON", k)
+			return err
+		}
+		backend, err := NewBackend(k, c)
+		if err != nil {
+			return err
+		}
+		backendType, _ := c[`type`].(string)
+		osm.ObjectStorages[k] = &DXObjectStorage{
+			Owner:   osm,
+			NameId:  k,
+			Type:    backendType,
+			Backend: backend,
+		}
+		log.Log.Infof("Configuring object storage %s (%s)... done", k, backendType)
+	}
+	return nil
+}
+
+func (osm *DXObjectStorageManager) FindObjectStorage(nameId string) (r *DXObjectStorage, err error) {
+	r, ok := osm.ObjectStorages[nameId]
+	if !ok {
+		err = log.Log.ErrorAndCreateErrorf("Object storage %s not found", nameId)
+		return nil, err
+	}
+	return r, nil
+}
+
+func (osm *DXObjectStorageManager) CloseAll() (err error) {
+	for _, v := range osm.ObjectStorages {
+		err = v.Backend.Close()
+		if err != nil {
+			log.Log.Errorf("Closing object storage %s error (%v)", v.NameId, err)
+			return err
+		}
+	}
+	return nil
+}
+
+var Manager DXObjectStorageManager
+
+func init() {
+	Manager = DXObjectStorageManager{
+		ObjectStorages: map[string]*DXObjectStorage{},
+	}
+}
@@ -0,0 +1,131 @@
+package objectstorage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/utils"
+)
+
+var (
+	_ DXObjectStorageBackend = (*DXObjectStorageLocal)(nil)
+	_ DXObjectStorageBackend = (*DXObjectStorageS3)(nil)
+)
+
+// testS3Server is an in-memory S3 of one bucket, path style, that does not check the signatures.
+type testS3Server struct {
+	mutex   sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *testS3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get(`Authorization`), s3Algorithm+` Credential=`) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, `/bucket/`)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		b, err := io.ReadAll(r.Body)
+		if err != nil || int64(len(b)) != r.ContentLength {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.objects[key] = b
+	case http.MethodGet, http.MethodHead:
+		b, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(b)
+		}
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// newTestBackends gives a local backend and an S3 backend of a test server, by type.
+func newTestBackends(t *testing.T) map[string]DXObjectStorageBackend {
+	t.Helper()
+	local, err := NewLocalBackend(t.TempDir(), `https://files.example.com/objects`, `key`)
+	require.NoError(t, err)
+	server := httptest.NewServer(&testS3Server{objects: map[string][]byte{}})
+	t.Cleanup(server.Close)
+	s3, err := NewS3Backend(server.URL, `bucket`, ``, `id`, `secret`, ``, true)
+	require.NoError(t, err)
+	return map[string]DXObjectStorageBackend{DXObjectStorageTypeLocal: local, DXObjectStorageTypeS3: s3}
+}
+
+func TestBackendsConform(t *testing.T) {
+	for backendType, backend := range newTestBackends(t) {
+		t.Run(backendType, func(t *testing.T) {
+			ctx := context.Background()
+			key := `documents/2024/a b.pdf`
+
+			exists, err := backend.Exists(ctx, key)
+			require.NoError(t, err)
+			assert.False(t, exists)
+			_, err = backend.Get(ctx, key)
+			assert.ErrorIs(t, err, ErrObjectNotFound)
+
+			require.NoError(t, backend.Put(ctx, key, strings.NewReader(`first`), 5, `application/pdf`))
+			// an unknown size
+			require.NoError(t, backend.Put(ctx, key, struct{ io.Reader }{bytes.NewReader([]byte(`second`))}, -1, `application/pdf`))
+			exists, err = backend.Exists(ctx, key)
+			require.NoError(t, err)
+			assert.True(t, exists)
+			r, err := backend.Get(ctx, key)
+			require.NoError(t, err)
+			b, err := io.ReadAll(r)
+			require.NoError(t, err)
+			require.NoError(t, r.Close())
+			assert.Equal(t, `second`, string(b))
+
+			signedURL, err := backend.SignedURL(ctx, key, time.Hour)
+			require.NoError(t, err)
+			assert.Contains(t, signedURL, `a%20b.pdf?`)
+
+			require.NoError(t, backend.Delete(ctx, key))
+			exists, err = backend.Exists(ctx, key)
+			require.NoError(t, err)
+			assert.False(t, exists)
+			// deleting a missing key is not an error
+			require.NoError(t, backend.Delete(ctx, key))
+			require.NoError(t, backend.Close())
+		})
+	}
+}
+
+func TestNewBackendFollowsTheType(t *testing.T) {
+	backend, err := NewBackend(`documents`, utils.JSON{`type`: `local`, `path`: t.TempDir()})
+	require.NoError(t, err)
+	assert.IsType(t, &DXObjectStorageLocal{}, backend)
+
+	backend, err = NewBackend(`documents`, utils.JSON{`type`: `s3`, `endpoint`: `http://minio:9000`, `bucket`: `documents`,
+		`access_key_id`: `id`, `secret_access_key`: `secret`, `use_path_style`: true})
+	require.NoError(t, err)
+	require.IsType(t, &DXObjectStorageS3{}, backend)
+	assert.Equal(t, DXObjectStorageS3DefaultRegion, backend.(*DXObjectStorageS3).Region)
+
+	_, err = NewBackend(`documents`, utils.JSON{`type`: `ftp`})
+	assert.Error(t, err)
+	_, err = NewBackend(`documents`, utils.JSON{`type`: `local`})
+	assert.Error(t, err)
+	_, err = NewBackend(`documents`, utils.JSON{`type`: `s3`, `bucket`: `documents`})
+	assert.Error(t, err)
+}
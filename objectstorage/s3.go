@@ -0,0 +1,318 @@
+package objectstorage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+)
+
+const (
+	DXObjectStorageS3DefaultRegion = "us-east-1"
+	s3UnsignedPayload              = "UNSIGNED-PAYLOAD"
+	s3Algorithm                    = "AWS4-HMAC-SHA256"
+	s3TimeFormat                   = "20060102T150405Z"
+)
+
+// DXObjectStorageS3 talks to an S3 compatible service (AWS, MinIO, ...) with Signature Version 4. The object URL is
+// Endpoint/Bucket/key when IsPathStyle, like MinIO needs, otherwise the bucket is a sub domain of the endpoint host.
+type DXObjectStorageS3 struct {
+	Endpoint        *url.URL
+	Bucket          string
+	Region          string
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+	IsPathStyle     bool
+	HTTPClient      *http.Client
+	// now is time.Now, replaced to check the signatures against known values
+	now func() time.Time
+}
+
+// NewS3BackendFromConfiguration reads the fields endpoint, bucket, region, access_key_id, secret_access_key,
+// session_token and use_path_style.
+func NewS3BackendFromConfiguration(nameId string, c utils.JSON) (backend *DXObjectStorageS3, err error) {
+	bucket, ok := c[`bucket`].(string)
+	if !ok || bucket == `` {
+		err = log.Log.ErrorAndCreateErrorf("configuration is unusable, mandatory bucket field of object storage %s not exist", nameId)
+		return nil, err
+	}
+	region, _ := c[`region`].(string)
+	if region == `` {
+		region = DXObjectStorageS3DefaultRegion
+	}
+	endpoint, _ := c[`endpoint`].(string)
+	if endpoint == `` {
+		endpoint = `https://s3.` + region + `.amazonaws.com`
+	}
+	accessKeyId, _ := c[`access_key_id`].(string)
+	secretAccessKey, _ := c[`secret_access_key`].(string)
+	if accessKeyId == `` || secretAccessKey == `` {
+		err = log.Log.ErrorAndCreateErrorf("configuration is unusable, mandatory access_key_id and secret_access_key fields of object storage %s not exist", nameId)
+		return nil, err
+	}
+	sessionToken, _ := c[`session_token`].(string)
+	isPathStyle, _ := c[`use_path_style`].(bool)
+	return NewS3Backend(endpoint, bucket, region, accessKeyId, secretAccessKey, sessionToken, isPathStyle)
+}
+
+func NewS3Backend(endpoint string, bucket string, region string, accessKeyId string, secretAccessKey string, sessionToken string, isPathStyle bool) (backend *DXObjectStorageS3, err error) {
+	u, err := url.Parse(strings.TrimSuffix(endpoint, `/`))
+	if err != nil || u.Scheme == `` || u.Host == `` {
+		return nil, fmt.Errorf("InvalidS3Endpoint:%s", endpoint)
+	}
+	return &DXObjectStorageS3{
+		Endpoint:        u,
+		Bucket:          bucket,
+		Region:          region,
+		AccessKeyId:     accessKeyId,
+		SecretAccessKey: secretAccessKey,
+		SessionToken:    sessionToken,
+		IsPathStyle:     isPathStyle,
+		HTTPClient:      &http.Client{},
+		now:             time.Now,
+	}, nil
+}
+
+func (s *DXObjectStorageS3) objectURL(key string) *url.URL {
+	u := *s.Endpoint
+	if s.IsPathStyle {
+		u.Path = u.Path + `/` + s.Bucket + `/` + key
+	} else {
+		u.Host = s.Bucket + `.` + u.Host
+		u.Path = u.Path + `/` + key
+	}
+	u.RawPath = s3URIEncode(u.Path, false)
+	return &u
+}
+
+// s3URIEncode is the URI encoding of Signature Version 4, everything but the unreserved characters is escaped.
+func s3URIEncode(s string, isEncodeSlash bool) string {
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !isEncodeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteString(fmt.Sprintf("%%%02X", c))
+	}
+	return b.String()
+}
+
+func s3CanonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := []string{}
+	for _, k := range keys {
+		values := append([]string{}, q[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, s3URIEncode(k, true)+`=`+s3URIEncode(v, true))
+		}
+	}
+	return strings.Join(parts, `&`)
+}
+
+func s3HMAC(key []byte, s string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(s))
+	return mac.Sum(nil)
+}
+
+func s3SHA256Hex(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+func (s *DXObjectStorageS3) scope(t time.Time) string {
+	return t.Format(`20060102`) + `/` + s.Region + `/s3/aws4_request`
+}
+
+// signature signs the canonical request of method on u, headers are the signed headers by lower case name.
+func (s *DXObjectStorageS3) signature(t time.Time, method string, u *url.URL, headers map[string]string, payloadHash string) (signature string, signedHeaders string) {
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	canonicalHeaders := ``
+	for _, k := range names {
+		canonicalHeaders = canonicalHeaders + k + `:` + strings.TrimSpace(headers[k]) + "\n"
+	}
+	signedHeaders = strings.Join(names, `;`)
+	canonicalRequest := strings.Join([]string{
+		method,
+		s3URIEncode(u.Path, false),
+		s3CanonicalQuery(u.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	stringToSign := strings.Join([]string{s3Algorithm, t.Format(s3TimeFormat), s.scope(t), s3SHA256Hex(canonicalRequest)}, "\n")
+	signingKey := s3HMAC([]byte(`AWS4`+s.SecretAccessKey), t.Format(`20060102`))
+	signingKey = s3HMAC(signingKey, s.Region)
+	signingKey = s3HMAC(signingKey, `s3`)
+	signingKey = s3HMAC(signingKey, `aws4_request`)
+	return hex.EncodeToString(s3HMAC(signingKey, stringToSign)), signedHeaders
+}
+
+func (s *DXObjectStorageS3) do(ctx context.Context, method string, key string, body io.Reader, size int64, contentType string) (response *http.Response, err error) {
+	u := s.objectURL(key)
+	request, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	t := s.now().UTC()
+	headers := map[string]string{
+		`host`:                 u.Host,
+		`x-amz-content-sha256`: s3UnsignedPayload,
+		`x-amz-date`:           t.Format(s3TimeFormat),
+	}
+	if s.SessionToken != `` {
+		headers[`x-amz-security-token`] = s.SessionToken
+	}
+	signature, signedHeaders := s.signature(t, method, u, headers, s3UnsignedPayload)
+	for k, v := range headers {
+		if k != `host` {
+			request.Header.Set(k, v)
+		}
+	}
+	request.Header.Set(`Authorization`, s3Algorithm+` Credential=`+s.AccessKeyId+`/`+s.scope(t)+`, SignedHeaders=`+signedHeaders+`, Signature=`+signature)
+	if contentType != `` {
+		request.Header.Set(`Content-Type`, contentType)
+	}
+	if body != nil {
+		request.ContentLength = size
+	}
+	return s.HTTPClient.Do(request)
+}
+
+func s3ResponseError(response *http.Response, operation string, key string) error {
+	b, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+	return fmt.Errorf("S3%sFailed:%s:%d:%s", operation, key, response.StatusCode, strings.TrimSpace(string(b)))
+}
+
+// Put needs the length of the object, an unknown size (-1) is first spooled into a temporary file.
+func (s *DXObjectStorageS3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (err error) {
+	if size < 0 {
+		f, err := os.CreateTemp(``, `s3-put-*`)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}()
+		size, err = io.Copy(f, r)
+		if err != nil {
+			return err
+		}
+		_, err = f.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		r = f
+	}
+	response, err := s.do(ctx, http.MethodPut, key, io.NopCloser(r), size, contentType)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	if response.StatusCode != http.StatusOK {
+		return s3ResponseError(response, `Put`, key)
+	}
+	return nil
+}
+
+func (s *DXObjectStorageS3) Get(ctx context.Context, key string) (r io.ReadCloser, err error) {
+	response, err := s.do(ctx, http.MethodGet, key, nil, 0, ``)
+	if err != nil {
+		return nil, err
+	}
+	switch response.StatusCode {
+	case http.StatusOK:
+		return response.Body, nil
+	case http.StatusNotFound:
+		_ = response.Body.Close()
+		return nil, ErrObjectNotFound
+	default:
+		defer func() {
+			_ = response.Body.Close()
+		}()
+		return nil, s3ResponseError(response, `Get`, key)
+	}
+}
+
+func (s *DXObjectStorageS3) Delete(ctx context.Context, key string) (err error) {
+	response, err := s.do(ctx, http.MethodDelete, key, nil, 0, ``)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusOK {
+		return s3ResponseError(response, `Delete`, key)
+	}
+	return nil
+}
+
+func (s *DXObjectStorageS3) Exists(ctx context.Context, key string) (exists bool, err error) {
+	response, err := s.do(ctx, http.MethodHead, key, nil, 0, ``)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	switch response.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, s3ResponseError(response, `Exists`, key)
+	}
+}
+
+// SignedURL is a presigned GET URL, S3 accepts an expiry up to 7 days.
+func (s *DXObjectStorageS3) SignedURL(ctx context.Context, key string, expiry time.Duration) (signedURL string, err error) {
+	u := s.objectURL(key)
+	t := s.now().UTC()
+	q := url.Values{}
+	q.Set(`X-Amz-Algorithm`, s3Algorithm)
+	q.Set(`X-Amz-Credential`, s.AccessKeyId+`/`+s.scope(t))
+	q.Set(`X-Amz-Date`, t.Format(s3TimeFormat))
+	q.Set(`X-Amz-Expires`, strconv.FormatInt(int64(expiry/time.Second), 10))
+	q.Set(`X-Amz-SignedHeaders`, `host`)
+	if s.SessionToken != `` {
+		q.Set(`X-Amz-Security-Token`, s.SessionToken)
+	}
+	u.RawQuery = s3CanonicalQuery(q)
+	signature, _ := s.signature(t, http.MethodGet, u, map[string]string{`host`: u.Host}, s3UnsignedPayload)
+	u.RawQuery = u.RawQuery + `&X-Amz-Signature=` + signature
+	return u.String(), nil
+}
+
+func (s *DXObjectStorageS3) Close() (err error) {
+	s.HTTPClient.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,301 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"dxlib/v3/configurations"
+	"dxlib/v3/databases"
+	"dxlib/v3/databases/protected/db"
+	"dxlib/v3/log"
+	"dxlib/v3/redis"
+	"dxlib/v3/subsystems"
+	"dxlib/v3/utils"
+	json2 "dxlib/v3/utils/json"
+)
+
+const (
+	DXOutboxDefaultTableName       = "outbox_events"
+	DXOutboxDefaultPollIntervalSec = 1
+	DXOutboxDefaultBatchSize       = 100
+	DXOutboxDefaultMaxBackoffSec   = 5 * 60
+
+	DXOutboxEventKindPublish = "publish"
+	DXOutboxEventKindEnqueue = "enqueue"
+)
+
+type DXOutboxEvent struct {
+	Id            int64     `db:"id" json:"id"`
+	AggregateId   string    `db:"aggregate_id" json:"aggregate_id"`
+	Kind          string    `db:"kind" json:"kind"`
+	Channel       string    `db:"channel" json:"channel"`
+	Payload       string    `db:"payload" json:"payload"`
+	Attempts      int64     `db:"attempts" json:"attempts"`
+	NextAttemptAt time.Time `db:"next_attempt_at" json:"next_attempt_at"`
+}
+
+// DXOutboxManager keeps the events to publish in TableName of the database DatabaseNameId, recorded in the transaction
+// of the change they announce, and relays them to the Redis RedisNameId. An event is sent at least once, the events of
+// an aggregate in the order they were recorded, a failed publish blocks the later events of its aggregate until it is
+// retried with a backoff.
+type DXOutboxManager struct {
+	DatabaseNameId  string
+	TableName       string
+	RedisNameId     string
+	PollIntervalSec int
+	BatchSize       int
+	MaxBackoffSec   int
+	IsRelayFatal    bool
+}
+
+func (om *DXOutboxManager) LoadFromConfiguration(configurationNameId string) (err error) {
+	configuration, err := configurations.Manager.Lookup(configurationNameId)
+	if err != nil {
+		return err
+	}
+	c := *configuration.Data
+	om.DatabaseNameId, _ = c[`database`].(string)
+	om.RedisNameId, _ = c[`redis`].(string)
+	if om.DatabaseNameId == `` || om.RedisNameId == `` {
+		err = log.Log.ErrorAndCreateErrorf("configuration is unusable, database and redis of %s are mandatory", configurationNameId)
+		return err
+	}
+	om.TableName, _ = c[`table`].(string)
+	if om.TableName == `` {
+		om.TableName = DXOutboxDefaultTableName
+	}
+	om.PollIntervalSec = json2.GetNumberWithDefault(c, `poll_interval_sec`, DXOutboxDefaultPollIntervalSec)
+	om.BatchSize = json2.GetNumberWithDefault(c, `batch_size`, DXOutboxDefaultBatchSize)
+	om.MaxBackoffSec = json2.GetNumberWithDefault(c, `max_backoff_sec`, DXOutboxDefaultMaxBackoffSec)
+	om.IsRelayFatal, _ = c[`is_relay_fatal`].(bool)
+	return nil
+}
+
+func (om *DXOutboxManager) database() (d *databases.DXDatabase, err error) {
+	d, ok := databases.Manager.Databases[om.DatabaseNameId]
+	if !ok {
+		err = log.Log.ErrorAndCreateErrorf("Database %s of the outbox not found", om.DatabaseNameId)
+		return nil, err
+	}
+	return d, nil
+}
+
+func (om *DXOutboxManager) CreateTableIfNotExist() (err error) {
+	d, err := om.database()
+	if err != nil {
+		return err
+	}
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return err
+	}
+	driverName := d.Connection.DriverName()
+	t := db.FormatIdentifier(driverName, d.IdentifierCase, om.TableName)
+	s := ``
+	switch driverName {
+	case "postgres":
+		s = `CREATE TABLE IF NOT EXISTS ` + t + ` (id BIGSERIAL PRIMARY KEY, aggregate_id VARCHAR(255) NOT NULL, ` +
+			`kind VARCHAR(16) NOT NULL, channel VARCHAR(255) NOT NULL, payload TEXT NOT NULL, created_at TIMESTAMPTZ NOT NULL, ` +
+			`attempts BIGINT NOT NULL, next_attempt_at TIMESTAMPTZ NOT NULL, sent_at TIMESTAMPTZ NULL, last_error TEXT NOT NULL)`
+	case "mysql":
+		s = `CREATE TABLE IF NOT EXISTS ` + t + ` (id BIGINT AUTO_INCREMENT PRIMARY KEY, aggregate_id VARCHAR(255) NOT NULL, ` +
+			`kind VARCHAR(16) NOT NULL, channel VARCHAR(255) NOT NULL, payload LONGTEXT NOT NULL, created_at DATETIME(6) NOT NULL, ` +
+			`attempts BIGINT NOT NULL, next_attempt_at DATETIME(6) NOT NULL, sent_at DATETIME(6) NULL, last_error TEXT NOT NULL)`
+	case "sqlserver":
+		s = `IF OBJECT_ID(N'` + om.TableName + `', N'U') IS NULL CREATE TABLE ` + t + ` (id BIGINT IDENTITY(1,1) PRIMARY KEY, ` +
+			`aggregate_id NVARCHAR(255) NOT NULL, kind NVARCHAR(16) NOT NULL, channel NVARCHAR(255) NOT NULL, ` +
+			`payload NVARCHAR(MAX) NOT NULL, created_at DATETIMEOFFSET NOT NULL, attempts BIGINT NOT NULL, ` +
+			`next_attempt_at DATETIMEOFFSET NOT NULL, sent_at DATETIMEOFFSET NULL, last_error NVARCHAR(MAX) NOT NULL)`
+	default:
+		err = log.Log.ErrorAndCreateErrorf("Outbox is not supported for database type %s of database %s", driverName, d.NameId)
+		return err
+	}
+	_, err = d.Connection.Exec(s)
+	if err != nil {
+		log.Log.Errorf("Cannot create outbox table %s in database %s (%v)", om.TableName, d.NameId, err)
+		return err
+	}
+	return nil
+}
+
+func (om *DXOutboxManager) record(l *log.DXLog, dtx *databases.DXDatabaseTx, aggregateId string, kind string, channel string, payload any) (id int64, err error) {
+	payloadAsBytes, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	d, err := om.database()
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	id, _, err = dtx.InsertReturningId(l, db.FormatIdentifier(dtx.DriverName(), d.IdentifierCase, om.TableName), utils.JSON{
+		`aggregate_id`:    aggregateId,
+		`kind`:            kind,
+		`channel`:         channel,
+		`payload`:         string(payloadAsBytes),
+		`created_at`:      now,
+		`attempts`:        0,
+		`next_attempt_at`: now,
+		`last_error`:      ``,
+	}, `id`)
+	return id, err
+}
+
+// Record adds an event published as the JSON of payload on the Redis channel, in dtx so it is only sent when the
+// change it announces is committed. aggregateId orders the events, those of the same aggregate are sent in order.
+func (om *DXOutboxManager) Record(l *log.DXLog, dtx *databases.DXDatabaseTx, aggregateId string, channel string, payload any) (id int64, err error) {
+	return om.record(l, dtx, aggregateId, DXOutboxEventKindPublish, channel, payload)
+}
+
+// RecordJob is Record for a job enqueued on the Redis queue, the job gets payload as it would from Enqueue.
+func (om *DXOutboxManager) RecordJob(l *log.DXLog, dtx *databases.DXDatabaseTx, aggregateId string, queue string, payload any) (id int64, err error) {
+	return om.record(l, dtx, aggregateId, DXOutboxEventKindEnqueue, queue, payload)
+}
+
+func (om *DXOutboxManager) send(ctx context.Context, r *redis.DXRedis, e DXOutboxEvent) (err error) {
+	switch e.Kind {
+	case DXOutboxEventKindPublish:
+		return r.Publish(ctx, e.Channel, e.Payload)
+	case DXOutboxEventKindEnqueue:
+		_, err = r.Enqueue(ctx, e.Channel, json.RawMessage(e.Payload), redis.DXRedisEnqueueOptions{})
+		return err
+	default:
+		return fmt.Errorf("OutboxEventKindInvalid:%s", e.Kind)
+	}
+}
+
+func (om *DXOutboxManager) backoff(attempts int64) time.Duration {
+	maxBackoff := time.Duration(om.MaxBackoffSec) * time.Second
+	backoff := time.Second
+	for i := int64(1); i < attempts && backoff < maxBackoff; i++ {
+		backoff = backoff * 2
+	}
+	if maxBackoff > 0 && backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+// RelayOnce sends the first BatchSize unsent events, an event failing blocks the later events of its aggregate. The
+// aggregates with an event waiting for its retry are left out of the batch, so they do not hold back the other ones.
+// n is the number of events sent.
+func (om *DXOutboxManager) RelayOnce(ctx context.Context) (n int, err error) {
+	d, err := om.database()
+	if err != nil {
+		return 0, err
+	}
+	r, ok := redis.Manager.Redises[om.RedisNameId]
+	if !ok || !r.IsAvailable() {
+		err = log.Log.ErrorAndCreateErrorf("Redis %s of the outbox not found or not connected", om.RedisNameId)
+		return 0, err
+	}
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return 0, err
+	}
+	driverName := d.Connection.DriverName()
+	t := db.FormatIdentifier(driverName, d.IdentifierCase, om.TableName)
+	fields := `o.id, o.aggregate_id, o.kind, o.channel, o.payload, o.attempts, o.next_attempt_at`
+	where := ` from ` + t + ` o where o.sent_at is null and not exists (select 1 from ` + t + ` w where ` +
+		`w.aggregate_id = o.aggregate_id and w.sent_at is null and w.next_attempt_at > :now) order by o.id`
+	s := `select ` + fields + where + ` limit ` + strconv.Itoa(om.BatchSize)
+	if db.DriverCapabilities(driverName).IsLimitByTop {
+		s = `select top ` + strconv.Itoa(om.BatchSize) + ` ` + fields + where
+	}
+	events, err := databases.SelectStructs[DXOutboxEvent](d, s, utils.JSON{`now`: time.Now()})
+	if err != nil {
+		return 0, err
+	}
+	blockedAggregateIds := map[string]bool{}
+	for _, e := range events {
+		if blockedAggregateIds[e.AggregateId] {
+			continue
+		}
+		now := time.Now()
+		errSend := om.send(ctx, r, e)
+		if errSend != nil {
+			blockedAggregateIds[e.AggregateId] = true
+			attempts := e.Attempts + 1
+			log.Log.Warnf("Cannot send outbox event %d of aggregate %s to %s, attempt %d (%v)", e.Id, e.AggregateId, e.Channel, attempts, errSend)
+			_, err = d.Update(t, utils.JSON{
+				`attempts`:        attempts,
+				`next_attempt_at`: now.Add(om.backoff(attempts)),
+				`last_error`:      errSend.Error(),
+			}, utils.JSON{`id`: e.Id})
+			if err != nil {
+				return n, err
+			}
+			continue
+		}
+		// a crash before this update sends the event again, at least once
+		_, err = d.Update(t, utils.JSON{`sent_at`: now}, utils.JSON{`id`: e.Id})
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// StartAll relays the events every PollIntervalSec until errorGroupContext is done, the instance relaying holds a Redis
+// lock so the instances do not send the same events at once.
+func (om *DXOutboxManager) StartAll(errorGroup *errgroup.Group, errorGroupContext context.Context) (err error) {
+	interval := time.Duration(om.PollIntervalSec) * time.Second
+	if interval <= 0 {
+		interval = DXOutboxDefaultPollIntervalSec * time.Second
+	}
+	lockKey := `dxoutbox:` + om.DatabaseNameId + `:` + om.TableName + `:relay`
+	subsystems.Go(errorGroup, errorGroupContext, `outbox`, om.IsRelayFatal, func() error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-errorGroupContext.Done():
+				return nil
+			case <-ticker.C:
+			}
+			err := om.relayLocked(errorGroupContext, lockKey, interval)
+			if err != nil {
+				if om.IsRelayFatal {
+					return err
+				}
+				log.Log.Warnf("Cannot relay the outbox %s of database %s (%v)", om.TableName, om.DatabaseNameId, err)
+			}
+		}
+	})
+	return nil
+}
+
+func (om *DXOutboxManager) relayLocked(ctx context.Context, lockKey string, interval time.Duration) (err error) {
+	r, ok := redis.Manager.Redises[om.RedisNameId]
+	if !ok || !r.IsAvailable() {
+		err = log.Log.ErrorAndCreateErrorf("Redis %s of the outbox not found or not connected", om.RedisNameId)
+		return err
+	}
+	lock, isAcquired, err := r.AcquireLock(ctx, lockKey, 10*interval)
+	if err != nil || !isAcquired {
+		return err
+	}
+	lock.AutoRenew(ctx)
+	defer func() {
+		_ = lock.Release()
+	}()
+	_, err = om.RelayOnce(ctx)
+	return err
+}
+
+var Manager DXOutboxManager
+
+func init() {
+	Manager = DXOutboxManager{
+		TableName:       DXOutboxDefaultTableName,
+		PollIntervalSec: DXOutboxDefaultPollIntervalSec,
+		BatchSize:       DXOutboxDefaultBatchSize,
+		MaxBackoffSec:   DXOutboxDefaultMaxBackoffSec,
+	}
+}
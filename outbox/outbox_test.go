@@ -0,0 +1,100 @@
+package outbox
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+
+	"dxlib/v3/databases"
+	"dxlib/v3/redis"
+	"dxlib/v3/utils"
+)
+
+// newTestOutbox gives an outbox on a sqlite database and a miniredis, removed from the managers at the end of the test.
+func newTestOutbox(t *testing.T) (om *DXOutboxManager, d *databases.DXDatabase, m *miniredis.Miniredis) {
+	t.Helper()
+	connection, err := sqlx.Open(`sqlite`, filepath.Join(t.TempDir(), `outbox.db`))
+	require.NoError(t, err)
+	d = databases.Manager.NewDatabase(`test-outbox`, false, false)
+	d.Connection = connection
+	d.Connected = true
+	_, err = connection.Exec(`CREATE TABLE outbox_events (id INTEGER PRIMARY KEY AUTOINCREMENT, aggregate_id TEXT NOT NULL, ` +
+		`kind TEXT NOT NULL, channel TEXT NOT NULL, payload TEXT NOT NULL, created_at DATETIME NOT NULL, ` +
+		`attempts INTEGER NOT NULL, next_attempt_at DATETIME NOT NULL, sent_at DATETIME NULL, last_error TEXT NOT NULL)`)
+	require.NoError(t, err)
+
+	m = miniredis.RunT(t)
+	r := redis.Manager.NewRedis(`test-outbox`, false, false)
+	r.Address = m.Addr()
+	r.IsConfigured = true
+	require.NoError(t, r.Connect())
+	t.Cleanup(func() {
+		_ = r.Disconnect()
+		_ = connection.Close()
+		delete(redis.Manager.Redises, r.NameId)
+		delete(databases.Manager.Databases, d.NameId)
+	})
+	om = &DXOutboxManager{
+		DatabaseNameId: d.NameId,
+		TableName:      DXOutboxDefaultTableName,
+		RedisNameId:    r.NameId,
+		BatchSize:      2,
+		MaxBackoffSec:  DXOutboxDefaultMaxBackoffSec,
+	}
+	return om, d, m
+}
+
+func insertTestEvent(t *testing.T, d *databases.DXDatabase, aggregateId string, nextAttemptAt time.Time) {
+	t.Helper()
+	_, err := d.Insert(DXOutboxDefaultTableName, utils.JSON{
+		`aggregate_id`:    aggregateId,
+		`kind`:            DXOutboxEventKindPublish,
+		`channel`:         `events`,
+		`payload`:         `{}`,
+		`created_at`:      time.Now(),
+		`attempts`:        0,
+		`next_attempt_at`: nextAttemptAt,
+		`last_error`:      ``,
+	})
+	require.NoError(t, err)
+}
+
+func TestRelayOnceSkipsOnlyTheAggregateWaitingForItsRetry(t *testing.T) {
+	om, d, _ := newTestOutbox(t)
+	// a whole batch of events held back by the retry of the first one
+	insertTestEvent(t, d, `a`, time.Now().Add(time.Hour))
+	insertTestEvent(t, d, `a`, time.Now())
+	insertTestEvent(t, d, `a`, time.Now())
+	insertTestEvent(t, d, `b`, time.Now())
+
+	n, err := om.RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	var unsent []string
+	require.NoError(t, d.Connection.Select(&unsent, `select aggregate_id from outbox_events where sent_at is null order by id`))
+	assert.Equal(t, []string{`a`, `a`, `a`}, unsent)
+}
+
+func TestRelayOnceSendsTheEventsOfAnAggregateInOrder(t *testing.T) {
+	om, d, m := newTestOutbox(t)
+	insertTestEvent(t, d, `a`, time.Now())
+	insertTestEvent(t, d, `a`, time.Now())
+	m.Close()
+
+	// the first event fails, the second one waits for it
+	n, err := om.RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	var attempts []int64
+	require.NoError(t, d.Connection.Select(&attempts, `select attempts from outbox_events order by id`))
+	assert.Equal(t, []int64{1, 0}, attempts)
+}
@@ -0,0 +1,152 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/sync/singleflight"
+
+	"dxlib/v3/log"
+)
+
+var cacheLoaderGroup singleflight.Group
+
+// ErrCacheTypeMismatch is the error of a GetOrSet sharing the load of a concurrent call of the same key for another type.
+var ErrCacheTypeMismatch = errors.New("RedisCacheTypeMismatch")
+
+// GetOrSet returns the value of key from r decoded by its CacheCodec, on a miss loader is called once for all the
+// concurrent callers of the same key and its result is stored with ttl. Generic functions can not be methods, so r is a
+// parameter. With a CacheBatchWindow the gets and the stores of the concurrent calls for distinct keys are sent together.
+func GetOrSet[T any](ctx context.Context, r *DXRedis, key string, ttl time.Duration, loader func() (T, error)) (value T, err error) {
+	return GetOrSetExt[T](ctx, r, r.cacheCodec(), key, ttl, loader)
+}
+
+// GetOrSetExt is GetOrSet with codec instead of the CacheCodec of r, key is prefixed by the KeyPrefix of codec.
+func GetOrSetExt[T any](ctx context.Context, r *DXRedis, codec DXRedisCacheCodec, key string, ttl time.Duration, loader func() (T, error)) (value T, err error) {
+	// a degraded Redis is a cache miss that is not stored
+	if !r.IsAvailable() {
+		return loader()
+	}
+	key = codec.KeyPrefix() + key
+	valueAsBytes, err := r.cacheGet(ctx, key)
+	if err == nil {
+		err = codec.Unmarshal(valueAsBytes, &value)
+		if err == nil {
+			return value, nil
+		}
+		log.Log.Warnf("Cannot decode cached value of Redis %s key %s, reloading (%v)", r.NameId, key, err)
+	} else if !errors.Is(err, redis.Nil) {
+		log.Log.Errorf("Cannot get cached value of Redis %s key %s (%v)", r.NameId, key, err)
+		return value, err
+	}
+	v, err, _ := cacheLoaderGroup.Do(r.NameId+"/"+key, func() (any, error) {
+		loaded, err := loader()
+		if err != nil {
+			return loaded, err
+		}
+		loadedAsBytes, err := codec.Marshal(loaded)
+		if err != nil {
+			return loaded, err
+		}
+		err = r.cacheSet(ctx, key, loadedAsBytes, ttl)
+		if err != nil {
+			log.Log.Errorf("Cannot set cached value of Redis %s key %s (%v)", r.NameId, key, err)
+			return loaded, err
+		}
+		return loaded, nil
+	})
+	if err != nil {
+		return value, err
+	}
+	// the concurrent callers of a key share the value of the first one, which is of another T when they disagree
+	if v == nil {
+		return value, nil
+	}
+	value, ok := v.(T)
+	if !ok {
+		err = fmt.Errorf("%w:%s:%T is not %T", ErrCacheTypeMismatch, key, v, value)
+		log.Log.Errorf("Cannot use cached value of Redis %s key %s (%v)", r.NameId, key, err)
+		return value, err
+	}
+	return value, nil
+}
+
+// MGetOrSet returns the values of keys from r decoded by its CacheCodec by one MGET, loader is called once with the keys
+// missing and the values it gives are stored with ttl by one pipeline. A key missing from the result of loader is
+// missing from values too, and not stored.
+func MGetOrSet[T any](ctx context.Context, r *DXRedis, keys []string, ttl time.Duration, loader func(missing []string) (map[string]T, error)) (values map[string]T, err error) {
+	return MGetOrSetExt[T](ctx, r, r.cacheCodec(), keys, ttl, loader)
+}
+
+// MGetOrSetExt is MGetOrSet with codec instead of the CacheCodec of r. The keys stored are prefixed by the KeyPrefix
+// of codec, those of values and of the loader calls are not.
+func MGetOrSetExt[T any](ctx context.Context, r *DXRedis, codec DXRedisCacheCodec, keys []string, ttl time.Duration, loader func(missing []string) (map[string]T, error)) (values map[string]T, err error) {
+	if len(keys) == 0 {
+		return map[string]T{}, nil
+	}
+	// a degraded Redis is a cache miss that is not stored
+	c := r.liveConnection()
+	if c == nil {
+		return loader(keys)
+	}
+	prefix := codec.KeyPrefix()
+	prefixedKeys := make([]string, len(keys))
+	for i, key := range keys {
+		prefixedKeys[i] = prefix + key
+	}
+	cached, err := c.MGet(ctx, prefixedKeys...).Result()
+	if err != nil {
+		log.Log.Errorf("Cannot get cached values of Redis %s keys %v (%v)", r.NameId, keys, err)
+		return nil, err
+	}
+	values = map[string]T{}
+	var missing []string
+	isMissing := map[string]bool{}
+	for i, key := range keys {
+		s, ok := cached[i].(string)
+		if ok {
+			var value T
+			err = codec.Unmarshal([]byte(s), &value)
+			if err == nil {
+				values[key] = value
+				continue
+			}
+			log.Log.Warnf("Cannot decode cached value of Redis %s key %s, reloading (%v)", r.NameId, key, err)
+		}
+		if !isMissing[key] {
+			isMissing[key] = true
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		return values, nil
+	}
+	loaded, err := loader(missing)
+	if err != nil {
+		return nil, err
+	}
+	if len(loaded) == 0 {
+		return values, nil
+	}
+	_, err = c.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for key, value := range loaded {
+			valueAsBytes, err := codec.Marshal(value)
+			if err != nil {
+				return err
+			}
+			p.Set(ctx, prefix+key, valueAsBytes, ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Log.Errorf("Cannot set cached values of Redis %s (%v)", r.NameId, err)
+		return nil, err
+	}
+	for key, value := range loaded {
+		values[key] = value
+	}
+	return values, nil
+}
@@ -0,0 +1,179 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const DXRedisCacheDefaultBatchMaxKeys = 100
+
+// dxRedisCacheCall is a get of key, or a set of it to value with ttl when isSet, waiting in a batch.
+type dxRedisCacheCall struct {
+	key   string
+	isSet bool
+	value []byte
+	ttl   time.Duration
+	done  chan dxRedisCacheResult
+}
+
+type dxRedisCacheResult struct {
+	value []byte
+	// err is redis.Nil for a get of a missing key
+	err error
+}
+
+// dxRedisCacheBatcher sends the cache calls made within window of the first one as one MGET for the gets and one
+// pipeline for the sets, at once when maxKeys calls wait.
+type dxRedisCacheBatcher struct {
+	r       *DXRedis
+	window  time.Duration
+	maxKeys int
+	mutex   sync.Mutex
+	pending []*dxRedisCacheCall
+	// ctx is the one of the first call of the pending batch, without its cancel, so the batch outlives a caller gone
+	ctx   context.Context
+	timer *time.Timer
+}
+
+// cacheBatcher is nil unless CacheBatchWindow is above 0, the calls are then sent one by one.
+func (r *DXRedis) cacheBatcher() *dxRedisCacheBatcher {
+	if r.CacheBatchWindow <= 0 {
+		return nil
+	}
+	r.cacheBatcherOnce.Do(func() {
+		maxKeys := r.CacheBatchMaxKeys
+		if maxKeys <= 0 {
+			maxKeys = DXRedisCacheDefaultBatchMaxKeys
+		}
+		r.batcher = &dxRedisCacheBatcher{r: r, window: r.CacheBatchWindow, maxKeys: maxKeys}
+	})
+	return r.batcher
+}
+
+// cacheGet gives the value of key, redis.Nil when missing, coalesced with the concurrent ones when batching.
+func (r *DXRedis) cacheGet(ctx context.Context, key string) (value []byte, err error) {
+	b := r.cacheBatcher()
+	if b == nil {
+		c := r.liveConnection()
+		if c == nil {
+			return nil, ErrRedisNotConnected
+		}
+		return c.Get(ctx, key).Bytes()
+	}
+	return b.do(ctx, &dxRedisCacheCall{key: key})
+}
+
+// cacheSet sets key to value with ttl, coalesced with the concurrent ones when batching.
+func (r *DXRedis) cacheSet(ctx context.Context, key string, value []byte, ttl time.Duration) (err error) {
+	b := r.cacheBatcher()
+	if b == nil {
+		c := r.liveConnection()
+		if c == nil {
+			return ErrRedisNotConnected
+		}
+		return c.Set(ctx, key, value, ttl).Err()
+	}
+	_, err = b.do(ctx, &dxRedisCacheCall{key: key, isSet: true, value: value, ttl: ttl})
+	return err
+}
+
+func (b *dxRedisCacheBatcher) do(ctx context.Context, call *dxRedisCacheCall) (value []byte, err error) {
+	call.done = make(chan dxRedisCacheResult, 1)
+	b.mutex.Lock()
+	if len(b.pending) == 0 {
+		b.ctx = context.WithoutCancel(ctx)
+		b.timer = time.AfterFunc(b.window, b.flush)
+	}
+	b.pending = append(b.pending, call)
+	isFull := len(b.pending) >= b.maxKeys
+	b.mutex.Unlock()
+	if isFull {
+		b.flush()
+	}
+	select {
+	case result := <-call.done:
+		return result.value, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// flush sends the pending calls, a timer firing after a full batch was sent finds none. The calls of a batch flushed
+// while the Redis is not available, like one pending at Disconnect, fail with ErrRedisNotConnected.
+func (b *dxRedisCacheBatcher) flush() {
+	b.mutex.Lock()
+	calls, ctx := b.pending, b.ctx
+	b.pending = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.mutex.Unlock()
+	if len(calls) == 0 {
+		return
+	}
+	c := b.r.liveConnection()
+	if c == nil {
+		for _, v := range calls {
+			v.done <- dxRedisCacheResult{err: ErrRedisNotConnected}
+		}
+		return
+	}
+	var gets, sets []*dxRedisCacheCall
+	for _, v := range calls {
+		if v.isSet {
+			sets = append(sets, v)
+		} else {
+			gets = append(gets, v)
+		}
+	}
+	if len(gets) > 0 {
+		b.mget(ctx, c, gets)
+	}
+	if len(sets) > 0 {
+		b.pipelineSet(ctx, c, sets)
+	}
+}
+
+// mget gets the keys of calls by one MGET, the ring of a DXRedis has a single shard so they are all on it.
+func (b *dxRedisCacheBatcher) mget(ctx context.Context, c *redis.Ring, calls []*dxRedisCacheCall) {
+	keys := make([]string, len(calls))
+	for i, v := range calls {
+		keys[i] = v.key
+	}
+	values, err := c.MGet(ctx, keys...).Result()
+	for i, v := range calls {
+		switch {
+		case err != nil:
+			v.done <- dxRedisCacheResult{err: err}
+		case values[i] == nil:
+			v.done <- dxRedisCacheResult{err: redis.Nil}
+		default:
+			s, _ := values[i].(string)
+			v.done <- dxRedisCacheResult{value: []byte(s)}
+		}
+	}
+}
+
+func (b *dxRedisCacheBatcher) pipelineSet(ctx context.Context, c *redis.Ring, calls []*dxRedisCacheCall) {
+	cmds, err := c.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for _, v := range calls {
+			p.Set(ctx, v.key, v.value, v.ttl)
+		}
+		return nil
+	})
+	for i, v := range calls {
+		if i < len(cmds) {
+			v.done <- dxRedisCacheResult{err: cmds[i].Err()}
+			continue
+		}
+		if err == nil {
+			err = errors.New("RedisPipelineResultMissing")
+		}
+		v.done <- dxRedisCacheResult{err: err}
+	}
+}
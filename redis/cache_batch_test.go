@@ -0,0 +1,194 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRoundTrips counts the commands and the pipelines sent to a Redis, each a round trip.
+type testRoundTrips struct {
+	roundTrips atomic.Int32
+	mutex      sync.Mutex
+	names      []string
+}
+
+func (h *testRoundTrips) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	h.roundTrips.Add(1)
+	h.mutex.Lock()
+	h.names = append(h.names, cmd.Name())
+	h.mutex.Unlock()
+	return ctx, nil
+}
+
+func (h *testRoundTrips) AfterProcess(context.Context, redis.Cmder) error {
+	return nil
+}
+
+func (h *testRoundTrips) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	h.roundTrips.Add(1)
+	h.mutex.Lock()
+	h.names = append(h.names, `pipeline`)
+	h.mutex.Unlock()
+	return ctx, nil
+}
+
+func (h *testRoundTrips) AfterProcessPipeline(context.Context, []redis.Cmder) error {
+	return nil
+}
+
+// newTestBatchingRedis gives a Redis batching the cache calls of window, at most maxKeys at once, counting its round
+// trips.
+func newTestBatchingRedis(t *testing.T, window time.Duration, maxKeys int) (r *DXRedis, h *testRoundTrips) {
+	t.Helper()
+	r, _ = newTestRedis(t)
+	r.CacheBatchWindow = window
+	r.CacheBatchMaxKeys = maxKeys
+	h = &testRoundTrips{}
+	r.Connection.AddHook(h)
+	return r, h
+}
+
+// getOrSetConcurrently runs GetOrSet of n distinct keys at once, each loading its index, and gives the errors.
+func getOrSetConcurrently(r *DXRedis, n int) (values []int, errs []error) {
+	values, errs = make([]int, n), make([]error, n)
+	wg := sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			values[i], errs[i] = GetOrSet[int](context.Background(), r, fmt.Sprintf(`key-%d`, i), time.Minute, func() (int, error) {
+				return i, nil
+			})
+		}(i)
+	}
+	wg.Wait()
+	return values, errs
+}
+
+func TestCacheBatchCoalescesConcurrentCalls(t *testing.T) {
+	r, h := newTestBatchingRedis(t, 100*time.Millisecond, 0)
+
+	values, errs := getOrSetConcurrently(r, 50)
+	for i := range values {
+		require.NoError(t, errs[i])
+		assert.Equal(t, i, values[i])
+	}
+	// one MGET for the misses and one pipeline storing their loads
+	assert.Equal(t, int32(2), h.roundTrips.Load())
+	assert.Equal(t, []string{`mget`, `pipeline`}, h.names)
+
+	h.roundTrips.Store(0)
+	values, errs = getOrSetConcurrently(r, 50)
+	for i := range values {
+		require.NoError(t, errs[i])
+		assert.Equal(t, i, values[i])
+	}
+	assert.Equal(t, int32(1), h.roundTrips.Load())
+}
+
+func TestCacheBatchSentOnceFull(t *testing.T) {
+	r, h := newTestBatchingRedis(t, time.Hour, 5)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		values, errs := getOrSetConcurrently(r, 5)
+		for i := range values {
+			assert.NoError(t, errs[i])
+			assert.Equal(t, i, values[i])
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal(`a full batch waited for its window`)
+	}
+	assert.Equal(t, int32(2), h.roundTrips.Load())
+}
+
+func TestCacheWithoutBatchSendsEachCall(t *testing.T) {
+	r, h := newTestBatchingRedis(t, 0, 0)
+
+	_, errs := getOrSetConcurrently(r, 10)
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(20), h.roundTrips.Load())
+}
+
+func TestCacheBatchPendingAtDisconnect(t *testing.T) {
+	r, _ := newTestBatchingRedis(t, 100*time.Millisecond, 0)
+
+	errs := make(chan error, 2)
+	go func() {
+		_, err := r.cacheGet(context.Background(), `pending-get`)
+		errs <- err
+	}()
+	go func() {
+		errs <- r.cacheSet(context.Background(), `pending-set`, []byte(`1`), time.Minute)
+	}()
+	require.Eventually(t, func() bool {
+		b := r.cacheBatcher()
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		return len(b.pending) == 2
+	}, time.Second, time.Millisecond)
+	require.NoError(t, r.Disconnect())
+
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			assert.ErrorIs(t, err, ErrRedisNotConnected)
+		case <-time.After(5 * time.Second):
+			t.Fatal(`a pending call was not failed`)
+		}
+	}
+}
+
+func TestCacheWithoutBatchNotConnected(t *testing.T) {
+	r, _ := newTestBatchingRedis(t, 0, 0)
+	require.NoError(t, r.Disconnect())
+
+	_, err := r.cacheGet(context.Background(), `key`)
+	assert.ErrorIs(t, err, ErrRedisNotConnected)
+	assert.ErrorIs(t, r.cacheSet(context.Background(), `key`, []byte(`1`), time.Minute), ErrRedisNotConnected)
+}
+
+func TestMGetOrSetLoadsTheMissingKeysOnce(t *testing.T) {
+	r, h := newTestBatchingRedis(t, 0, 0)
+	ctx := context.Background()
+	_, err := GetOrSet[int](ctx, r, `a`, time.Minute, func() (int, error) {
+		return 1, nil
+	})
+	require.NoError(t, err)
+	h.roundTrips.Store(0)
+
+	var missing []string
+	values, err := MGetOrSet[int](ctx, r, []string{`a`, `b`, `c`, `b`}, time.Minute, func(keys []string) (map[string]int, error) {
+		missing = keys
+		return map[string]int{`b`: 2, `c`: 3}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{`a`: 1, `b`: 2, `c`: 3}, values)
+	assert.ElementsMatch(t, []string{`b`, `c`}, missing)
+	assert.Equal(t, int32(2), h.roundTrips.Load())
+}
+
+func TestMGetOrSetNotConnectedLoadsEveryKey(t *testing.T) {
+	r, _ := newTestBatchingRedis(t, 0, 0)
+	require.NoError(t, r.Disconnect())
+
+	values, err := MGetOrSet[int](context.Background(), r, []string{`a`, `b`}, time.Minute, func(keys []string) (map[string]int, error) {
+		return map[string]int{`a`: 1, `b`: 2}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{`a`: 1, `b`: 2}, values)
+}
@@ -0,0 +1,110 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetOrSetLoadsOnceAndCaches(t *testing.T) {
+	r, m := newTestRedis(t)
+	ctx := context.Background()
+	loads := 0
+	loader := func() (int, error) {
+		loads++
+		return 42, nil
+	}
+	v, err := GetOrSet[int](ctx, r, `answer`, time.Minute, loader)
+	require.NoError(t, err)
+	assert.Equal(t, 42, v)
+	v, err = GetOrSet[int](ctx, r, `answer`, time.Minute, loader)
+	require.NoError(t, err)
+	assert.Equal(t, 42, v)
+	assert.Equal(t, 1, loads)
+	s, err := m.Get(`answer`)
+	require.NoError(t, err)
+	assert.Equal(t, `42`, s)
+}
+
+func TestGetOrSetTypeMismatchOfSharedLoad(t *testing.T) {
+	r, _ := newTestRedis(t)
+	ctx := context.Background()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var errString error
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, _ = GetOrSet[int](ctx, r, `shared`, time.Minute, func() (int, error) {
+			close(started)
+			<-release
+			return 1, nil
+		})
+	}()
+	<-started
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, errString = GetOrSet[string](ctx, r, `shared`, time.Minute, func() (string, error) {
+			return `not loaded, the load of the int caller is shared`, nil
+		})
+	}()
+	// the second caller has missed and joined the load of the first one by then
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.True(t, errors.Is(errString, ErrCacheTypeMismatch), "%v", errString)
+}
+
+func TestGetOrSetConcurrentMissesLoadOnce(t *testing.T) {
+	r, _ := newTestRedis(t)
+	ctx := context.Background()
+	var loads atomic.Int32
+	release := make(chan struct{})
+	values := make([]int, 20)
+	errs := make([]error, len(values))
+	wg := sync.WaitGroup{}
+	for i := range values {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			values[i], errs[i] = GetOrSet[int](ctx, r, `stampede`, time.Minute, func() (int, error) {
+				loads.Add(1)
+				<-release
+				return 42, nil
+			})
+		}(i)
+	}
+	// every caller has missed and joined the load of the first one by then
+	time.Sleep(200 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	for i := range values {
+		require.NoError(t, errs[i])
+		assert.Equal(t, 42, values[i])
+	}
+	assert.Equal(t, int32(1), loads.Load())
+}
+
+func TestGetOrSetDoesNotCacheALoaderError(t *testing.T) {
+	r, m := newTestRedis(t)
+	ctx := context.Background()
+	_, err := GetOrSet[int](ctx, r, `failing`, time.Minute, func() (int, error) {
+		return 0, errors.New(`unavailable`)
+	})
+	assert.EqualError(t, err, `unavailable`)
+	assert.False(t, m.Exists(`failing`))
+
+	v, err := GetOrSet[int](ctx, r, `failing`, time.Minute, func() (int, error) {
+		return 7, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 7, v)
+}
@@ -0,0 +1,125 @@
+package redis
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// DXRedisCacheCodec turns the values of GetOrSet and MGetOrSet into the bytes stored in Redis and back.
+type DXRedisCacheCodec interface {
+	Name() string
+	// KeyPrefix is put before the keys the codec stores, so a read by another codec misses instead of misdecoding, like
+	// a raw 123 read as a JSON number. JSON has none, so the keys cached before the codecs stay valid
+	KeyPrefix() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                       { return "json" }
+func (jsonCodec) KeyPrefix() string                  { return "" }
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string                       { return "msgpack" }
+func (msgpackCodec) KeyPrefix() string                  { return "msgpack:" }
+func (msgpackCodec) Marshal(v any) ([]byte, error)      { return msgpack.Marshal(v) }
+func (msgpackCodec) Unmarshal(data []byte, v any) error { return msgpack.Unmarshal(data, v) }
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string      { return "gob" }
+func (gobCodec) KeyPrefix() string { return "gob:" }
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var b bytes.Buffer
+	err := gob.NewEncoder(&b).Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// rawCodec stores a string or a []byte as it is, without the quotes of JSON, readable by any client under its prefix.
+type rawCodec struct{}
+
+func (rawCodec) Name() string      { return "raw" }
+func (rawCodec) KeyPrefix() string { return "raw:" }
+
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	switch t := v.(type) {
+	case string:
+		return []byte(t), nil
+	case []byte:
+		return t, nil
+	case *string:
+		return []byte(*t), nil
+	case *[]byte:
+		return *t, nil
+	}
+	return nil, fmt.Errorf("RedisRawCodecUnsupportedType:%T", v)
+}
+
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	switch t := v.(type) {
+	case *string:
+		*t = string(data)
+		return nil
+	case *[]byte:
+		*t = append([]byte(nil), data...)
+		return nil
+	}
+	return fmt.Errorf("RedisRawCodecUnsupportedType:%T", v)
+}
+
+var (
+	CacheCodecJSON    DXRedisCacheCodec = jsonCodec{}
+	CacheCodecMsgpack DXRedisCacheCodec = msgpackCodec{}
+	CacheCodecGob     DXRedisCacheCodec = gobCodec{}
+	// CacheCodecRaw is for the string and []byte values only
+	CacheCodecRaw DXRedisCacheCodec = rawCodec{}
+
+	cacheCodecs = map[string]DXRedisCacheCodec{
+		CacheCodecJSON.Name():    CacheCodecJSON,
+		CacheCodecMsgpack.Name(): CacheCodecMsgpack,
+		CacheCodecGob.Name():     CacheCodecGob,
+		CacheCodecRaw.Name():     CacheCodecRaw,
+	}
+	// cacheCodecsMutex guards cacheCodecs
+	cacheCodecsMutex sync.RWMutex
+)
+
+// CacheCodec gives the codec registered as name, the cache_codec of a Redis configuration.
+func CacheCodec(name string) (c DXRedisCacheCodec, ok bool) {
+	cacheCodecsMutex.RLock()
+	defer cacheCodecsMutex.RUnlock()
+	c, ok = cacheCodecs[name]
+	return c, ok
+}
+
+// RegisterCacheCodec adds, or replaces, the codec named c.Name().
+func RegisterCacheCodec(c DXRedisCacheCodec) {
+	cacheCodecsMutex.Lock()
+	defer cacheCodecsMutex.Unlock()
+	cacheCodecs[c.Name()] = c
+}
+
+// cacheCodec is the CacheCodec of r, JSON when not set.
+func (r *DXRedis) cacheCodec() DXRedisCacheCodec {
+	if r.CacheCodec == nil {
+		return CacheCodecJSON
+	}
+	return r.CacheCodec
+}
@@ -0,0 +1,141 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCodecValue struct {
+	Id    int64
+	Name  string
+	Tags  []string
+	Score float64
+}
+
+func TestCacheCodecsRoundTrip(t *testing.T) {
+	v := testCodecValue{Id: 1<<53 + 1, Name: `name`, Tags: []string{`a`, `b`}, Score: 1.5}
+	for _, codec := range []DXRedisCacheCodec{CacheCodecJSON, CacheCodecMsgpack, CacheCodecGob} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			data, err := codec.Marshal(v)
+			require.NoError(t, err)
+			var decoded testCodecValue
+			require.NoError(t, codec.Unmarshal(data, &decoded))
+			assert.Equal(t, v, decoded)
+		})
+	}
+}
+
+func TestCacheCodecRawRoundTrip(t *testing.T) {
+	data, err := CacheCodecRaw.Marshal(`plain text`)
+	require.NoError(t, err)
+	assert.Equal(t, []byte(`plain text`), data)
+	var s string
+	require.NoError(t, CacheCodecRaw.Unmarshal(data, &s))
+	assert.Equal(t, `plain text`, s)
+
+	data, err = CacheCodecRaw.Marshal([]byte{0, 1, 2})
+	require.NoError(t, err)
+	var b []byte
+	require.NoError(t, CacheCodecRaw.Unmarshal(data, &b))
+	assert.Equal(t, []byte{0, 1, 2}, b)
+
+	_, err = CacheCodecRaw.Marshal(testCodecValue{})
+	assert.ErrorContains(t, err, `RedisRawCodecUnsupportedType`)
+	var i int
+	assert.ErrorContains(t, CacheCodecRaw.Unmarshal([]byte(`123`), &i), `RedisRawCodecUnsupportedType`)
+}
+
+func TestGetOrSetRoundTripsEveryCodec(t *testing.T) {
+	r, m := newTestRedis(t)
+	ctx := context.Background()
+	v := testCodecValue{Id: 42, Name: `name`, Tags: []string{`a`}}
+	for _, tt := range []struct {
+		codec DXRedisCacheCodec
+		key   string
+	}{
+		{CacheCodecJSON, `value`},
+		{CacheCodecMsgpack, `msgpack:value`},
+		{CacheCodecGob, `gob:value`},
+	} {
+		t.Run(tt.codec.Name(), func(t *testing.T) {
+			loads := 0
+			loader := func() (testCodecValue, error) {
+				loads++
+				return v, nil
+			}
+			for i := 0; i < 2; i++ {
+				got, err := GetOrSetExt[testCodecValue](ctx, r, tt.codec, `value`, time.Minute, loader)
+				require.NoError(t, err)
+				assert.Equal(t, v, got)
+			}
+			assert.Equal(t, 1, loads)
+			assert.True(t, m.Exists(tt.key))
+		})
+	}
+
+	s, err := GetOrSetExt[string](ctx, r, CacheCodecRaw, `text`, time.Minute, func() (string, error) {
+		return `123`, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `123`, s)
+	stored, err := m.Get(`raw:text`)
+	require.NoError(t, err)
+	assert.Equal(t, `123`, stored)
+}
+
+func TestGetOrSetOfAnotherCodecMisses(t *testing.T) {
+	r, _ := newTestRedis(t)
+	ctx := context.Background()
+	_, err := GetOrSetExt[string](ctx, r, CacheCodecRaw, `key`, time.Minute, func() (string, error) {
+		return `123`, nil
+	})
+	require.NoError(t, err)
+
+	// the raw 123 is not decoded as the JSON number, JSON reads another key and loads
+	loads := 0
+	n, err := GetOrSetExt[int](ctx, r, CacheCodecJSON, `key`, time.Minute, func() (int, error) {
+		loads++
+		return 7, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 7, n)
+	assert.Equal(t, 1, loads)
+	s, err := GetOrSetExt[string](ctx, r, CacheCodecRaw, `key`, time.Minute, func() (string, error) {
+		return `not loaded`, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `123`, s)
+}
+
+func TestMGetOrSetUsesTheCodecOfTheRedis(t *testing.T) {
+	r, m := newTestRedis(t)
+	r.CacheCodec = CacheCodecMsgpack
+	values, err := MGetOrSet[testCodecValue](context.Background(), r, []string{`a`, `b`}, time.Minute, func(keys []string) (map[string]testCodecValue, error) {
+		return map[string]testCodecValue{`a`: {Id: 1}, `b`: {Id: 2}}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]testCodecValue{`a`: {Id: 1}, `b`: {Id: 2}}, values)
+	assert.True(t, m.Exists(`msgpack:a`))
+	assert.True(t, m.Exists(`msgpack:b`))
+
+	values, err = MGetOrSet[testCodecValue](context.Background(), r, []string{`a`, `b`}, time.Minute, func(keys []string) (map[string]testCodecValue, error) {
+		t.Errorf(`loaded %v, all were cached`, keys)
+		return nil, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]testCodecValue{`a`: {Id: 1}, `b`: {Id: 2}}, values)
+}
+
+func TestCacheCodecRegistry(t *testing.T) {
+	for _, name := range []string{`json`, `msgpack`, `gob`, `raw`} {
+		c, ok := CacheCodec(name)
+		require.True(t, ok, name)
+		assert.Equal(t, name, c.Name())
+	}
+	_, ok := CacheCodec(`unknown`)
+	assert.False(t, ok)
+}
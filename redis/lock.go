@@ -0,0 +1,123 @@
+package redis
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+)
+
+// ErrLockTTLTooShort is the error of AcquireLock for a ttl under a millisecond, which SET PX can not keep.
+var ErrLockTTLTooShort = errors.New("RedisLockTTLTooShort")
+
+var lockReleaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+var lockRenewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+type DXRedisLock struct {
+	Redis       *DXRedis
+	Key         string
+	Token       string
+	TTL         time.Duration
+	mutex       sync.Mutex
+	renewCancel context.CancelFunc
+	renewDone   chan struct{}
+}
+
+// AcquireLock sets key with SET NX PX and a random token, isAcquired is false when another owner already holds it. A
+// ttl under a millisecond is an ErrLockTTLTooShort, the key would never expire.
+func (r *DXRedis) AcquireLock(ctx context.Context, key string, ttl time.Duration) (lock *DXRedisLock, isAcquired bool, err error) {
+	if ttl < time.Millisecond {
+		err = fmt.Errorf("%w:%s,%v", ErrLockTTLTooShort, key, ttl)
+		return nil, false, err
+	}
+	token := hex.EncodeToString(utils.RandomData(16))
+	isAcquired, err = r.Connection.SetNX(ctx, key, token, ttl).Result()
+	if err != nil {
+		log.Log.Errorf("Cannot acquire lock %s on Redis %s (%v)", key, r.NameId, err)
+		return nil, false, err
+	}
+	if !isAcquired {
+		return nil, false, nil
+	}
+	lock = &DXRedisLock{
+		Redis: r,
+		Key:   key,
+		Token: token,
+		TTL:   ttl,
+	}
+	return lock, true, nil
+}
+
+// Renew extends the TTL of the lock, isRenewed is false when the lock is not owned anymore.
+func (l *DXRedisLock) Renew(ctx context.Context) (isRenewed bool, err error) {
+	n, err := lockRenewScript.Run(ctx, l.Redis.Connection, []string{l.Key}, l.Token, l.TTL.Milliseconds()).Int64()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// AutoRenew starts a watchdog that extends the TTL every third of it, until ctx is done, the lock is lost or Release is called.
+func (l *DXRedisLock) AutoRenew(ctx context.Context) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.renewCancel != nil {
+		return
+	}
+	ctx, l.renewCancel = context.WithCancel(ctx)
+	l.renewDone = make(chan struct{})
+	go func() {
+		defer close(l.renewDone)
+		ticker := time.NewTicker(l.TTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				isRenewed, err := l.Renew(ctx)
+				if err != nil {
+					log.Log.Warnf("Cannot renew lock %s on Redis %s (%v)", l.Key, l.Redis.NameId, err)
+					continue
+				}
+				if !isRenewed {
+					log.Log.Warnf("Lock %s on Redis %s is lost", l.Key, l.Redis.NameId)
+					return
+				}
+			}
+		}
+	}()
+}
+
+// Release stops the watchdog and deletes the key only when it still holds the token of this lock.
+func (l *DXRedisLock) Release() (err error) {
+	l.mutex.Lock()
+	if l.renewCancel != nil {
+		l.renewCancel()
+		<-l.renewDone
+		l.renewCancel = nil
+	}
+	l.mutex.Unlock()
+	_, err = lockReleaseScript.Run(l.Redis.Context, l.Redis.Connection, []string{l.Key}, l.Token).Result()
+	if err != nil {
+		log.Log.Errorf("Cannot release lock %s on Redis %s (%v)", l.Key, l.Redis.NameId, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquireLockContention(t *testing.T) {
+	r, m := newTestRedis(t)
+	ctx := context.Background()
+
+	first, isAcquired, err := r.AcquireLock(ctx, `job`, time.Minute)
+	require.NoError(t, err)
+	require.True(t, isAcquired)
+	assert.Equal(t, time.Minute, m.TTL(`job`))
+	second, isAcquired, err := r.AcquireLock(ctx, `job`, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, isAcquired)
+	assert.Nil(t, second)
+
+	require.NoError(t, first.Release())
+	assert.False(t, m.Exists(`job`))
+	second, isAcquired, err = r.AcquireLock(ctx, `job`, time.Minute)
+	require.NoError(t, err)
+	require.True(t, isAcquired)
+	assert.NotEqual(t, first.Token, second.Token)
+}
+
+func TestReleaseLockAfterTheTokenChanged(t *testing.T) {
+	r, m := newTestRedis(t)
+	ctx := context.Background()
+	first, isAcquired, err := r.AcquireLock(ctx, `job`, time.Second)
+	require.NoError(t, err)
+	require.True(t, isAcquired)
+
+	// the lock expired and another owner got it
+	m.FastForward(2 * time.Second)
+	second, isAcquired, err := r.AcquireLock(ctx, `job`, time.Minute)
+	require.NoError(t, err)
+	require.True(t, isAcquired)
+
+	require.NoError(t, first.Release())
+	stored, err := m.Get(`job`)
+	require.NoError(t, err)
+	assert.Equal(t, second.Token, stored)
+	isRenewed, err := first.Renew(ctx)
+	require.NoError(t, err)
+	assert.False(t, isRenewed)
+	assert.Equal(t, time.Minute, m.TTL(`job`))
+}
+
+func TestAutoRenewExtendsTheLock(t *testing.T) {
+	r, m := newTestRedis(t)
+	lock, isAcquired, err := r.AcquireLock(context.Background(), `job`, 300*time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, isAcquired)
+
+	lock.AutoRenew(context.Background())
+	m.FastForward(200 * time.Millisecond)
+	require.Eventually(t, func() bool {
+		return m.TTL(`job`) == 300*time.Millisecond
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, lock.Release())
+	assert.False(t, m.Exists(`job`))
+}
+
+func TestAcquireLockRejectsATTLUnderAMillisecond(t *testing.T) {
+	r, m := newTestRedis(t)
+	for _, ttl := range []time.Duration{0, -time.Second, time.Microsecond} {
+		lock, isAcquired, err := r.AcquireLock(context.Background(), `job`, ttl)
+		assert.ErrorIs(t, err, ErrLockTTLTooShort)
+		assert.False(t, isAcquired)
+		assert.Nil(t, lock)
+	}
+	assert.False(t, m.Exists(`job`))
+}
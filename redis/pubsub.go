@@ -0,0 +1,112 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"dxlib/v3/log"
+)
+
+const DXRedisSubscriptionReconnectDelay = 1 * time.Second
+
+type DXRedisSubscriptionHandler func(msg string) (err error)
+
+// SetErrorGroup makes the subscriptions run in errorGroup, they stop when errorGroupContext is done or at DisconnectAll.
+func (rs *DXRedisManager) SetErrorGroup(errorGroup *errgroup.Group, errorGroupContext context.Context) {
+	rs.ErrorGroup = errorGroup
+	rs.ErrorGroupContext, rs.subscriptionCancel = context.WithCancel(errorGroupContext)
+}
+
+func (rs *DXRedisManager) Subscribe(ctx context.Context, redisNameId string, channel string, handler DXRedisSubscriptionHandler) (err error) {
+	r, ok := rs.Redises[redisNameId]
+	if !ok {
+		err = log.Log.ErrorAndCreateErrorf("Redis %s not found to subscribe %s", redisNameId, channel)
+		return err
+	}
+	return r.Subscribe(ctx, channel, handler)
+}
+
+func (rs *DXRedisManager) Publish(ctx context.Context, redisNameId string, channel string, payload string) (err error) {
+	r, ok := rs.Redises[redisNameId]
+	if !ok {
+		err = log.Log.ErrorAndCreateErrorf("Redis %s not found to publish %s", redisNameId, channel)
+		return err
+	}
+	return r.Publish(ctx, channel, payload)
+}
+
+func (r *DXRedis) Publish(ctx context.Context, channel string, payload string) (err error) {
+	if !r.IsAvailable() {
+		return ErrRedisNotConnected
+	}
+	err = r.Connection.Publish(ctx, channel, payload).Err()
+	if err != nil {
+		log.Log.Errorf("Cannot publish to Redis %s channel %s (%v)", r.NameId, channel, err)
+		return err
+	}
+	return nil
+}
+
+// Subscribe runs the receive loop of channel in the error group of the manager and resubscribes when the connection drops.
+// A handler error is only logged, unless subscription_stop_on_handler_error is set in the Redis configuration.
+func (r *DXRedis) Subscribe(ctx context.Context, channel string, handler DXRedisSubscriptionHandler) (err error) {
+	if r.Owner.ErrorGroup == nil {
+		err = log.Log.ErrorAndCreateErrorf("Cannot subscribe Redis %s channel %s, the Redis manager is not started", r.NameId, channel)
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(r.Owner.ErrorGroupContext, cancel)
+	r.Owner.ErrorGroup.Go(func() (err error) {
+		defer stop()
+		defer cancel()
+		log.Log.Infof("Subscribing Redis %s channel %s... start", r.NameId, channel)
+		defer log.Log.Infof("Subscribing Redis %s channel %s... stopped", r.NameId, channel)
+		for {
+			isHandlerError, err := r.receive(ctx, channel, handler)
+			if ctx.Err() != nil {
+				return nil
+			}
+			if isHandlerError {
+				return err
+			}
+			log.Log.Warnf("Subscription of Redis %s channel %s dropped, resubscribing (%v)", r.NameId, channel, err)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(DXRedisSubscriptionReconnectDelay):
+			}
+		}
+	})
+	return nil
+}
+
+// receive returns isHandlerError only when the handler fails and IsSubscriptionStopOnHandlerError, otherwise the connection dropped.
+func (r *DXRedis) receive(ctx context.Context, channel string, handler DXRedisSubscriptionHandler) (isHandlerError bool, err error) {
+	if !r.IsAvailable() {
+		err = log.Log.WarnAndCreateErrorf("Redis %s is not connected", r.NameId)
+		return false, err
+	}
+	pubSub := r.Connection.Subscribe(ctx, channel)
+	defer func() {
+		_ = pubSub.Close()
+	}()
+	_, err = pubSub.Receive(ctx)
+	if err != nil {
+		return false, err
+	}
+	for {
+		msg, err := pubSub.ReceiveMessage(ctx)
+		if err != nil {
+			return false, err
+		}
+		err = handler(msg.Payload)
+		if err != nil {
+			log.Log.Errorf("Error at handler of Redis %s channel %s (%v)", r.NameId, channel, err)
+			if r.IsSubscriptionStopOnHandlerError {
+				return true, err
+			}
+		}
+	}
+}
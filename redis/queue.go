@@ -0,0 +1,391 @@
+package redis
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"dxlib/v3/core"
+	"dxlib/v3/log"
+	"dxlib/v3/metrics"
+	"dxlib/v3/utils"
+)
+
+const (
+	DXRedisQueueKeyPrefix          = "dxqueue:"
+	DXRedisQueueDefaultMaxAttempts = 5
+	DXRedisQueueDefaultRetryDelay  = 10 * time.Second
+	DXRedisQueuePollInterval       = 1 * time.Second
+	DXRedisQueueHeartbeatInterval  = 10 * time.Second
+	DXRedisQueueConsumerTTL        = 30 * time.Second
+	DXRedisQueueDrainTimeout       = 30 * time.Second
+	dxRedisQueuePromoteBatchSize   = 100
+)
+
+// DXRedisJob is the JSON kept in the lists of a queue, Attempt counts the failed executions.
+type DXRedisJob struct {
+	Id           string          `json:"id"`
+	Queue        string          `json:"queue"`
+	Payload      json.RawMessage `json:"payload"`
+	Attempt      int             `json:"attempt"`
+	MaxAttempts  int             `json:"max_attempts"`
+	RetryDelayMs int64           `json:"retry_delay_ms"`
+	EnqueuedAt   time.Time       `json:"enqueued_at"`
+	LastError    string          `json:"last_error,omitempty"`
+}
+
+// DXRedisEnqueueOptions are the options of a job, a failed job is retried after RetryDelay times its attempt, until
+// MaxAttempts, then it is moved to the dead list of the queue.
+type DXRedisEnqueueOptions struct {
+	Delay       time.Duration
+	MaxAttempts int
+	RetryDelay  time.Duration
+}
+
+type DXRedisJobHandler func(ctx context.Context, payload json.RawMessage) (err error)
+
+// DXRedisJobPanicError is the error of a handler that panicked, the job is retried like for any other error.
+type DXRedisJobPanicError struct {
+	Queue string
+	JobId string
+	Value any
+	Stack []byte
+}
+
+func (e *DXRedisJobPanicError) Error() string {
+	return fmt.Sprintf("job %s of queue %s panic: %v", e.JobId, e.Queue, e.Value)
+}
+
+type redisQueueKeys struct {
+	consumerId string
+	pending    string
+	delayed    string
+	dead       string
+	consumers  string
+	processing string
+	heartbeat  string
+}
+
+func queueKeys(queue string, consumerId string) redisQueueKeys {
+	k := DXRedisQueueKeyPrefix + queue
+	return redisQueueKeys{
+		consumerId: consumerId,
+		pending:    k,
+		delayed:    k + `:delayed`,
+		dead:       k + `:dead`,
+		consumers:  k + `:consumers`,
+		processing: k + `:processing:` + consumerId,
+		heartbeat:  k + `:consumer:` + consumerId,
+	}
+}
+
+var queuePromoteScript = redis.NewScript(`
+local jobs = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[2])
+for _, job in ipairs(jobs) do
+	redis.call("ZREM", KEYS[1], job)
+	redis.call("RPUSH", KEYS[2], job)
+end
+return #jobs`)
+
+// queueRequeueScript gives the jobs of the processing list of a consumer back to the queue, they are the next ones to be
+// taken, and forgets the consumer.
+var queueRequeueScript = redis.NewScript(`
+local job = redis.call("LPOP", KEYS[1])
+while job do
+	redis.call("RPUSH", KEYS[2], job)
+	job = redis.call("LPOP", KEYS[1])
+end
+redis.call("DEL", KEYS[1], KEYS[3])
+redis.call("SREM", KEYS[4], ARGV[1])
+return 1`)
+
+func (rs *DXRedisManager) Enqueue(ctx context.Context, redisNameId string, queue string, payload any, options DXRedisEnqueueOptions) (jobId string, err error) {
+	r, ok := rs.Redises[redisNameId]
+	if !ok {
+		err = log.Log.ErrorAndCreateErrorf("Redis %s not found to enqueue %s", redisNameId, queue)
+		return ``, err
+	}
+	return r.Enqueue(ctx, queue, payload, options)
+}
+
+func (rs *DXRedisManager) RegisterWorker(redisNameId string, queue string, concurrency int, handler DXRedisJobHandler) (err error) {
+	r, ok := rs.Redises[redisNameId]
+	if !ok {
+		err = log.Log.ErrorAndCreateErrorf("Redis %s not found to register worker of %s", redisNameId, queue)
+		return err
+	}
+	return r.RegisterWorker(queue, concurrency, handler)
+}
+
+// Enqueue pushes payload as JSON to queue, with a Delay it waits in the delayed sorted set of the queue first.
+func (r *DXRedis) Enqueue(ctx context.Context, queue string, payload any, options DXRedisEnqueueOptions) (jobId string, err error) {
+	if !r.IsAvailable() {
+		return ``, ErrRedisNotConnected
+	}
+	payloadAsBytes, err := json.Marshal(payload)
+	if err != nil {
+		return ``, err
+	}
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = DXRedisQueueDefaultMaxAttempts
+	}
+	if options.RetryDelay <= 0 {
+		options.RetryDelay = DXRedisQueueDefaultRetryDelay
+	}
+	job := DXRedisJob{
+		Id:           hex.EncodeToString(utils.RandomData(16)),
+		Queue:        queue,
+		Payload:      payloadAsBytes,
+		MaxAttempts:  options.MaxAttempts,
+		RetryDelayMs: options.RetryDelay.Milliseconds(),
+		EnqueuedAt:   time.Now().UTC(),
+	}
+	jobAsBytes, err := json.Marshal(job)
+	if err != nil {
+		return ``, err
+	}
+	keys := queueKeys(queue, ``)
+	if options.Delay > 0 {
+		err = r.Connection.ZAdd(ctx, keys.delayed, &redis.Z{
+			Score:  float64(time.Now().Add(options.Delay).UnixMilli()),
+			Member: jobAsBytes,
+		}).Err()
+	} else {
+		err = r.Connection.LPush(ctx, keys.pending, jobAsBytes).Err()
+	}
+	if err != nil {
+		log.Log.Errorf("Cannot enqueue job to Redis %s queue %s (%v)", r.NameId, queue, err)
+		return ``, err
+	}
+	return job.Id, nil
+}
+
+// RegisterWorker consumes queue with concurrency goroutines in the error group of the manager, a job is moved with
+// BRPOPLPUSH to the processing list of this worker and only removed once handler succeeds, so it is delivered at least
+// once. The processing list of a worker whose heartbeat expired, like after a crash, is given back to the queue by the
+// other workers. At DisconnectAll no new job is taken and the running ones get DXRedisQueueDrainTimeout to finish.
+func (r *DXRedis) RegisterWorker(queue string, concurrency int, handler DXRedisJobHandler) (err error) {
+	if r.Owner.ErrorGroup == nil {
+		err = log.Log.ErrorAndCreateErrorf("Cannot register worker of Redis %s queue %s, the Redis manager is not started", r.NameId, queue)
+		return err
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	ctx := r.Owner.ErrorGroupContext
+	// commandCtx outlives the shutdown for the acknowledgements of the jobs still running
+	commandCtx := context.WithoutCancel(ctx)
+	handlerCtx, handlerCancel := context.WithCancel(commandCtx)
+	stopDrainTimer := context.AfterFunc(ctx, func() {
+		time.AfterFunc(DXRedisQueueDrainTimeout, handlerCancel)
+	})
+	keys := queueKeys(queue, hex.EncodeToString(utils.RandomData(8)))
+
+	r.Owner.workers.Add(1)
+	r.Owner.ErrorGroup.Go(func() (err error) {
+		defer r.Owner.workers.Done()
+		defer handlerCancel()
+		defer stopDrainTimer()
+		log.Log.Infof("Worker of Redis %s queue %s... start", r.NameId, queue)
+		defer log.Log.Infof("Worker of Redis %s queue %s... stopped", r.NameId, queue)
+
+		r.heartbeat(commandCtx, keys)
+		consumers := sync.WaitGroup{}
+		for i := 0; i < concurrency; i++ {
+			consumers.Add(1)
+			go func() {
+				defer consumers.Done()
+				r.consume(ctx, commandCtx, handlerCtx, queue, keys, handler)
+			}()
+		}
+		consumersDone := make(chan struct{})
+		go func() {
+			consumers.Wait()
+			close(consumersDone)
+		}()
+
+		pollTicker := time.NewTicker(DXRedisQueuePollInterval)
+		defer pollTicker.Stop()
+		heartbeatTicker := time.NewTicker(DXRedisQueueHeartbeatInterval)
+		defer heartbeatTicker.Stop()
+		for {
+			select {
+			case <-consumersDone:
+				r.requeue(commandCtx, keys)
+				return nil
+			case <-heartbeatTicker.C:
+				// the heartbeat goes on while draining, the running jobs are not taken over
+				r.heartbeat(commandCtx, keys)
+				if ctx.Err() == nil {
+					r.recoverExpiredConsumers(ctx, queue, keys)
+				}
+			case <-pollTicker.C:
+				if ctx.Err() == nil {
+					r.promoteDelayed(ctx, queue, keys)
+				}
+			}
+		}
+	})
+	return nil
+}
+
+func (r *DXRedis) heartbeat(ctx context.Context, keys redisQueueKeys) {
+	if !r.IsAvailable() {
+		return
+	}
+	_, err := r.Connection.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.SAdd(ctx, keys.consumers, keys.consumerId)
+		p.Set(ctx, keys.heartbeat, time.Now().UTC().Format(time.RFC3339), DXRedisQueueConsumerTTL)
+		return nil
+	})
+	if err != nil {
+		log.Log.Warnf("Cannot refresh worker heartbeat on Redis %s (%v)", r.NameId, err)
+	}
+}
+
+func (r *DXRedis) requeue(ctx context.Context, keys redisQueueKeys) {
+	if !r.IsAvailable() {
+		return
+	}
+	err := queueRequeueScript.Run(ctx, r.Connection, []string{keys.processing, keys.pending, keys.heartbeat, keys.consumers}, keys.consumerId).Err()
+	if err != nil {
+		log.Log.Warnf("Cannot requeue the jobs of worker %s on Redis %s (%v)", keys.consumerId, r.NameId, err)
+	}
+}
+
+func (r *DXRedis) recoverExpiredConsumers(ctx context.Context, queue string, keys redisQueueKeys) {
+	if !r.IsAvailable() {
+		return
+	}
+	consumerIds, err := r.Connection.SMembers(ctx, keys.consumers).Result()
+	if err != nil {
+		log.Log.Warnf("Cannot read the workers of Redis %s queue %s (%v)", r.NameId, queue, err)
+		return
+	}
+	for _, consumerId := range consumerIds {
+		other := queueKeys(queue, consumerId)
+		n, err := r.Connection.Exists(ctx, other.heartbeat).Result()
+		if err != nil || n > 0 {
+			continue
+		}
+		log.Log.Warnf("Worker %s of Redis %s queue %s expired, requeueing its jobs", consumerId, r.NameId, queue)
+		r.requeue(ctx, other)
+	}
+}
+
+func (r *DXRedis) promoteDelayed(ctx context.Context, queue string, keys redisQueueKeys) {
+	if !r.IsAvailable() {
+		return
+	}
+	err := queuePromoteScript.Run(ctx, r.Connection, []string{keys.delayed, keys.pending}, time.Now().UnixMilli(), dxRedisQueuePromoteBatchSize).Err()
+	if err != nil {
+		log.Log.Warnf("Cannot promote the delayed jobs of Redis %s queue %s (%v)", r.NameId, queue, err)
+	}
+}
+
+// consume takes jobs until ctx is done, the redis commands of a taken job use commandCtx and its handler handlerCtx.
+func (r *DXRedis) consume(ctx context.Context, commandCtx context.Context, handlerCtx context.Context, queue string, keys redisQueueKeys, handler DXRedisJobHandler) {
+	for ctx.Err() == nil {
+		if !r.IsAvailable() {
+			sleepContext(ctx, DXRedisQueuePollInterval)
+			continue
+		}
+		raw, err := r.Connection.BRPopLPush(ctx, keys.pending, keys.processing, DXRedisQueuePollInterval).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Log.Warnf("Cannot take job from Redis %s queue %s (%v)", r.NameId, queue, err)
+			sleepContext(ctx, DXRedisQueuePollInterval)
+			continue
+		}
+		r.process(commandCtx, handlerCtx, queue, keys, raw, handler)
+	}
+}
+
+func callJobHandler(ctx context.Context, job DXRedisJob, handler DXRedisJobHandler) (err error) {
+	defer func() {
+		v := recover()
+		if v != nil {
+			panicErr := &DXRedisJobPanicError{
+				Queue: job.Queue,
+				JobId: job.Id,
+				Value: v,
+				Stack: debug.Stack(),
+			}
+			log.Log.Errorf("Job %s of queue %s panic recovered (%v)\n%s", job.Id, job.Queue, v, panicErr.Stack)
+			metrics.Manager.ObservePanic(`job`)
+			if core.IsPanicCrash() {
+				panic(v)
+			}
+			err = panicErr
+		}
+	}()
+	return handler(ctx, job.Payload)
+}
+
+func (r *DXRedis) process(commandCtx context.Context, handlerCtx context.Context, queue string, keys redisQueueKeys, raw string, handler DXRedisJobHandler) {
+	job := DXRedisJob{}
+	err := json.Unmarshal([]byte(raw), &job)
+	if err != nil {
+		log.Log.Errorf("Cannot unmarshal job of Redis %s queue %s, moved to the dead list (%v)", r.NameId, queue, err)
+		r.moveJob(commandCtx, queue, keys, raw, func(p redis.Pipeliner) {
+			p.LPush(commandCtx, keys.dead, raw)
+		})
+		return
+	}
+	err = callJobHandler(handlerCtx, job, handler)
+	if err == nil {
+		err = r.Connection.LRem(commandCtx, keys.processing, 1, raw).Err()
+		if err != nil {
+			log.Log.Warnf("Cannot acknowledge job %s of Redis %s queue %s, it will run again (%v)", job.Id, r.NameId, queue, err)
+		}
+		return
+	}
+	job.Attempt++
+	job.LastError = err.Error()
+	jobAsBytes, errMarshal := json.Marshal(job)
+	if errMarshal != nil {
+		jobAsBytes = []byte(raw)
+	}
+	if job.Attempt >= job.MaxAttempts {
+		log.Log.Errorf("Job %s of Redis %s queue %s failed %d times, moved to the dead list (%v)", job.Id, r.NameId, queue, job.Attempt, err)
+		r.moveJob(commandCtx, queue, keys, raw, func(p redis.Pipeliner) {
+			p.LPush(commandCtx, keys.dead, jobAsBytes)
+		})
+		return
+	}
+	retryAt := time.Now().Add(time.Duration(job.RetryDelayMs) * time.Millisecond * time.Duration(job.Attempt))
+	log.Log.Warnf("Job %s of Redis %s queue %s failed, retry %d at %s (%v)", job.Id, r.NameId, queue, job.Attempt, retryAt.Format(time.RFC3339), err)
+	r.moveJob(commandCtx, queue, keys, raw, func(p redis.Pipeliner) {
+		p.ZAdd(commandCtx, keys.delayed, &redis.Z{Score: float64(retryAt.UnixMilli()), Member: jobAsBytes})
+	})
+}
+
+// moveJob removes raw from the processing list and adds it elsewhere with add, both or none are done.
+func (r *DXRedis) moveJob(ctx context.Context, queue string, keys redisQueueKeys, raw string, add func(p redis.Pipeliner)) {
+	_, err := r.Connection.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.LRem(ctx, keys.processing, 1, raw)
+		add(p)
+		return nil
+	})
+	if err != nil {
+		log.Log.Warnf("Cannot move job of Redis %s queue %s (%v)", r.NameId, queue, err)
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
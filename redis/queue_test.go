@@ -0,0 +1,195 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+)
+
+// newTestQueueRedis gives a Redis whose manager runs the workers, stopped and drained at the end of the test unless
+// the test does it.
+func newTestQueueRedis(t *testing.T) (r *DXRedis, m *miniredis.Miniredis, stop func()) {
+	t.Helper()
+	r, m = newTestRedis(t)
+	rs := &DXRedisManager{Redises: map[string]*DXRedis{r.NameId: r}}
+	r.Owner = rs
+	ctx, cancel := context.WithCancel(context.Background())
+	errorGroup, errorGroupContext := errgroup.WithContext(ctx)
+	rs.SetErrorGroup(errorGroup, errorGroupContext)
+	once := sync.Once{}
+	stop = func() {
+		once.Do(func() {
+			cancel()
+			assert.NoError(t, rs.DisconnectAll())
+			assert.NoError(t, errorGroup.Wait())
+		})
+	}
+	t.Cleanup(stop)
+	return r, m, stop
+}
+
+// processingKeys are the processing lists of the workers of queue.
+func processingKeys(m *miniredis.Miniredis, queue string) (keys []string) {
+	for _, k := range m.Keys() {
+		if strings.HasPrefix(k, DXRedisQueueKeyPrefix+queue+`:processing:`) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func TestQueueEnqueueAndConsume(t *testing.T) {
+	r, m, _ := newTestQueueRedis(t)
+	mutex := sync.Mutex{}
+	received := map[int]int{}
+	require.NoError(t, r.RegisterWorker(`mail`, 2, func(ctx context.Context, payload json.RawMessage) (err error) {
+		var v struct{ N int }
+		require.NoError(t, json.Unmarshal(payload, &v))
+		mutex.Lock()
+		received[v.N]++
+		mutex.Unlock()
+		return nil
+	}))
+
+	for i := 0; i < 10; i++ {
+		_, err := r.Enqueue(context.Background(), `mail`, struct{ N int }{i}, DXRedisEnqueueOptions{})
+		require.NoError(t, err)
+	}
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(received) == 10
+	}, 5*time.Second, 10*time.Millisecond)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, 1, received[i], i)
+	}
+	// acknowledged
+	require.Eventually(t, func() bool {
+		return len(processingKeys(m, `mail`)) == 0 && !m.Exists(DXRedisQueueKeyPrefix+`mail`)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestQueueRetriesAFailedJob(t *testing.T) {
+	r, m, _ := newTestQueueRedis(t)
+	attempts := atomic.Int32{}
+	done := make(chan struct{})
+	require.NoError(t, r.RegisterWorker(`mail`, 1, func(ctx context.Context, payload json.RawMessage) (err error) {
+		if attempts.Add(1) == 1 {
+			return errors.New(`smtp unavailable`)
+		}
+		close(done)
+		return nil
+	}))
+
+	_, err := r.Enqueue(context.Background(), `mail`, `payload`, DXRedisEnqueueOptions{RetryDelay: time.Millisecond})
+	require.NoError(t, err)
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal(`the failed job was not retried`)
+	}
+	assert.Equal(t, int32(2), attempts.Load())
+	assert.False(t, m.Exists(DXRedisQueueKeyPrefix+`mail:dead`))
+}
+
+func TestQueueJobIsDeadAfterItsMaxAttempts(t *testing.T) {
+	r, m, _ := newTestQueueRedis(t)
+	require.NoError(t, r.RegisterWorker(`mail`, 1, func(ctx context.Context, payload json.RawMessage) (err error) {
+		panic(`bad template`)
+	}))
+
+	jobId, err := r.Enqueue(context.Background(), `mail`, `payload`, DXRedisEnqueueOptions{MaxAttempts: 1})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return m.Exists(DXRedisQueueKeyPrefix + `mail:dead`)
+	}, 5*time.Second, 10*time.Millisecond)
+	dead, err := m.List(DXRedisQueueKeyPrefix + `mail:dead`)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	job := DXRedisJob{}
+	require.NoError(t, json.Unmarshal([]byte(dead[0]), &job))
+	assert.Equal(t, jobId, job.Id)
+	assert.Equal(t, 1, job.Attempt)
+	assert.Contains(t, job.LastError, `panic: bad template`)
+	assert.Empty(t, processingKeys(m, `mail`))
+}
+
+func TestQueueDelayedJob(t *testing.T) {
+	r, m, _ := newTestQueueRedis(t)
+	consumedAt := make(chan time.Time, 1)
+	require.NoError(t, r.RegisterWorker(`mail`, 1, func(ctx context.Context, payload json.RawMessage) (err error) {
+		consumedAt <- time.Now()
+		return nil
+	}))
+
+	enqueuedAt := time.Now()
+	_, err := r.Enqueue(context.Background(), `mail`, `payload`, DXRedisEnqueueOptions{Delay: 500 * time.Millisecond})
+	require.NoError(t, err)
+	assert.True(t, m.Exists(DXRedisQueueKeyPrefix+`mail:delayed`))
+	select {
+	case at := <-consumedAt:
+		assert.GreaterOrEqual(t, at.Sub(enqueuedAt), 500*time.Millisecond)
+	case <-time.After(10 * time.Second):
+		t.Fatal(`the delayed job was not consumed`)
+	}
+}
+
+func TestQueueDrainsTheRunningJobAtShutdown(t *testing.T) {
+	r, m, stop := newTestQueueRedis(t)
+	started, release := make(chan struct{}), make(chan struct{})
+	require.NoError(t, r.RegisterWorker(`mail`, 1, func(ctx context.Context, payload json.RawMessage) (err error) {
+		close(started)
+		<-release
+		return nil
+	}))
+	_, err := r.Enqueue(context.Background(), `mail`, `payload`, DXRedisEnqueueOptions{})
+	require.NoError(t, err)
+	<-started
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		stop()
+	}()
+	select {
+	case <-stopped:
+		t.Fatal(`stopped before the running job finished`)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal(`not stopped once the running job finished`)
+	}
+	// acknowledged before the connection was closed
+	assert.Empty(t, processingKeys(m, `mail`))
+	assert.False(t, m.Exists(DXRedisQueueKeyPrefix+`mail`))
+}
+
+func TestQueueRequeuesTheJobsOfAnExpiredWorker(t *testing.T) {
+	r, m, _ := newTestQueueRedis(t)
+	expired := queueKeys(`mail`, `crashed`)
+	_, err := m.Lpush(expired.processing, `{"id":"1"}`)
+	require.NoError(t, err)
+	_, err = m.SAdd(expired.consumers, `crashed`)
+	require.NoError(t, err)
+
+	r.recoverExpiredConsumers(context.Background(), `mail`, queueKeys(`mail`, `alive`))
+	pending, err := m.List(expired.pending)
+	require.NoError(t, err)
+	assert.Equal(t, []string{`{"id":"1"}`}, pending)
+	assert.False(t, m.Exists(expired.processing))
+	// the set held only the expired worker
+	assert.False(t, m.Exists(expired.consumers))
+}
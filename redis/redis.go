@@ -3,64 +3,170 @@ package redis
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
 
+	"dxlib/v3/breaker"
 	"dxlib/v3/configurations"
 	"dxlib/v3/core"
 	"dxlib/v3/log"
+	"dxlib/v3/metrics"
+	"dxlib/v3/tracing"
 	"dxlib/v3/utils"
 	json2 "dxlib/v3/utils/json"
 )
 
 type DXRedis struct {
-	Owner            *DXRedisManager
-	NameId           string
-	IsConfigured     bool
-	Address          string
-	UserName         string
-	HasUserName      bool
-	Password         string
-	HasPassword      bool
-	DatabaseIndex    int
-	IsConnectAtStart bool
-	MustConnected    bool
-	Connection       *redis.Ring
-	Connected        bool
-	Context          context.Context
+	Owner  *DXRedisManager
+	NameId string
+	// ConfigurationNameId is the configuration block of the Redis, like redis or redis_cache
+	ConfigurationNameId string
+	IsConfigured        bool
+	Address             string
+	UserName            string
+	HasUserName         bool
+	Password            string
+	HasPassword         bool
+	DatabaseIndex       int
+	IsConnectAtStart    bool
+	MustConnected       bool
+	// IsRequired false lets the app start without this Redis, it is then degraded and reconnected in the background
+	IsRequired bool
+	Connection *redis.Ring
+	Connected  bool
+	Context    context.Context
+	// available is stored after Connection is set, it is safe to read while the reconnect runs
+	available atomic.Bool
+	// connectionMutex guards Connection for the readers that may run while it is reconnected, see liveConnection
+	connectionMutex sync.RWMutex
+
+	IsSubscriptionStopOnHandlerError bool
+	// CircuitBreaker, set by a circuit_breaker block, runs Set, Get and Delete, failing them at once while Redis is down
+	CircuitBreaker *breaker.DXCircuitBreaker
+	// CacheBatchWindow is how long a GetOrSet waits for the concurrent ones to send their gets, and their stores,
+	// together, at most CacheBatchMaxKeys keys at once. Not above 0 sends each one alone
+	CacheBatchWindow  time.Duration
+	CacheBatchMaxKeys int
+	batcher           *dxRedisCacheBatcher
+	// CacheCodec encodes the values of GetOrSet and MGetOrSet, set by cache_codec, nil is JSON
+	CacheCodec       DXRedisCacheCodec
+	cacheBatcherOnce sync.Once
+}
+
+const (
+	DXRedisReconnectInitialBackoff = time.Second
+	DXRedisReconnectMaxBackoff     = 30 * time.Second
+	DXRedisPingDefaultTimeout      = time.Second
+)
+
+// ErrRedisNotConnected is returned instead of using a Redis that is not connected, like a degraded one.
+var ErrRedisNotConnected = errors.New("RedisNotConnected")
+
+type metricsHookStartTimeKey struct{}
+
+type metricsHook struct {
+	redisNameId string
+}
+
+func (h *metricsHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, metricsHookStartTimeKey{}, time.Now()), nil
+}
+
+func (h *metricsHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	startTime, ok := ctx.Value(metricsHookStartTimeKey{}).(time.Time)
+	if ok {
+		metrics.Manager.ObserveRedisCommand(h.redisNameId, cmd.Name(), time.Since(startTime).Seconds())
+	}
+	return nil
+}
+
+func (h *metricsHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, metricsHookStartTimeKey{}, time.Now()), nil
+}
+
+func (h *metricsHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	startTime, ok := ctx.Value(metricsHookStartTimeKey{}).(time.Time)
+	if ok {
+		metrics.Manager.ObserveRedisCommand(h.redisNameId, "pipeline", time.Since(startTime).Seconds())
+	}
+	return nil
+}
+
+type tracingHook struct {
+	redisNameId string
+}
+
+func (h *tracingHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	ctx, _ = tracing.StartRedisSpan(ctx, h.redisNameId, cmd.Name())
+	return ctx, nil
+}
+
+func (h *tracingHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	err := cmd.Err()
+	if err == redis.Nil {
+		err = nil
+	}
+	tracing.EndSpan(trace.SpanFromContext(ctx), err)
+	return nil
+}
+
+func (h *tracingHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	ctx, _ = tracing.StartRedisSpan(ctx, h.redisNameId, "pipeline")
+	return ctx, nil
+}
+
+func (h *tracingHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	tracing.EndSpan(trace.SpanFromContext(ctx), nil)
+	return nil
 }
 
 type DXRedisManager struct {
-	Redises map[string]*DXRedis
+	Redises            map[string]*DXRedis
+	ErrorGroup         *errgroup.Group
+	ErrorGroupContext  context.Context
+	subscriptionCancel context.CancelFunc
+	workers            sync.WaitGroup
 }
 
 func (rs *DXRedisManager) NewRedis(nameId string, isConnectAtStart, mustConnected bool) *DXRedis {
 	r := DXRedis{
-		Owner:            rs,
-		NameId:           nameId,
-		IsConfigured:     false,
-		IsConnectAtStart: isConnectAtStart,
-		MustConnected:    mustConnected,
-		Connected:        false,
-		HasUserName:      false,
-		HasPassword:      false,
-		DatabaseIndex:    0,
-		Context:          core.RootContext,
+		Owner:               rs,
+		NameId:              nameId,
+		ConfigurationNameId: `redis`,
+		IsConfigured:        false,
+		IsConnectAtStart:    isConnectAtStart,
+		MustConnected:       mustConnected,
+		IsRequired:          true,
+		Connected:           false,
+		HasUserName:         false,
+		HasPassword:         false,
+		DatabaseIndex:       0,
+		Context:             core.RootContext,
 	}
 	rs.Redises[nameId] = &r
 	return &r
 }
 
 func (rs *DXRedisManager) LoadFromConfiguration(configurationNameId string) (err error) {
-	configuration, ok := configurations.Manager.Configurations[configurationNameId]
-	if !ok {
-		return fmt.Errorf("configuration '%s' not found", configurationNameId)
+	configuration, err := configurations.Manager.Lookup(configurationNameId)
+	if err != nil {
+		return err
 	}
 	isConnectAtStart := false
 	mustConnected := false
 	for k, v := range *configuration.Data {
+		if k == `enabled` {
+			continue
+		}
 		d, ok := v.(utils.JSON)
 		if !ok {
 			err := log.Log.ErrorAndCreateErrorf("Cannot read %s as JSON", k)
@@ -74,7 +180,20 @@ func (rs *DXRedisManager) LoadFromConfiguration(configurationNameId string) (err
 		if !ok {
 			mustConnected = false
 		}
+		isRequired, ok := d[`required`].(bool)
+		if !ok {
+			isRequired = true
+		}
+		if !isRequired {
+			mustConnected = false
+		}
+		if existing, ok := rs.Redises[k]; ok {
+			err := log.Log.ErrorAndCreateErrorf("RedisNameIdCollision:%s,%s,%s", k, existing.ConfigurationNameId, configurationNameId)
+			return err
+		}
 		redisObject := rs.NewRedis(k, isConnectAtStart, mustConnected)
+		redisObject.ConfigurationNameId = configurationNameId
+		redisObject.IsRequired = isRequired
 		err := redisObject.ApplyFromConfiguration()
 		if err != nil {
 			return err
@@ -83,15 +202,53 @@ func (rs *DXRedisManager) LoadFromConfiguration(configurationNameId string) (err
 	return nil
 }
 
-func (rs *DXRedisManager) ConnectAllAtStart() (err error) {
+// EnabledConfigurationNameIds are the enabled Redis configuration blocks, redis and then the redis_<purpose> ones,
+// like redis_cache and redis_queue, in name order.
+func EnabledConfigurationNameIds() (r []string) {
+	if configurations.Manager.IsEnabled(`redis`) {
+		r = append(r, `redis`)
+	}
+	others := []string{}
+	for _, k := range configurations.Manager.NameIds() {
+		if strings.HasPrefix(k, `redis_`) && configurations.Manager.IsEnabled(k) {
+			others = append(others, k)
+		}
+	}
+	sort.Strings(others)
+	return append(r, others...)
+}
+
+// Client gives the Redis nameId of any of the loaded configuration blocks.
+func (rs *DXRedisManager) Client(nameId string) (r *DXRedis, err error) {
+	r, ok := rs.Redises[nameId]
+	if !ok {
+		return nil, fmt.Errorf("RedisNotFound:%s", nameId)
+	}
+	return r, nil
+}
+
+// ConnectAllAtStart connects the Redises IsConnectAtStart, it gives up with the error of ctx once ctx is done, also
+// between the connections, so a shutdown during the start does not wait for all of them.
+func (rs *DXRedisManager) ConnectAllAtStart(ctx context.Context) (err error) {
 	if len(rs.Redises) > 0 {
 		log.Log.Info("Connecting to Redis Manager... start")
 		for _, v := range rs.Redises {
+			if ctx.Err() != nil {
+				log.Log.Warnf("Connecting to Redis Manager... aborted (%v)", ctx.Err())
+				return ctx.Err()
+			}
 			if v.IsConnectAtStart {
-				err = v.Connect()
-				if err != nil {
+				err = v.ConnectContext(ctx)
+				if err != nil && ctx.Err() != nil {
 					return err
 				}
+				if err != nil {
+					if v.IsRequired {
+						return err
+					}
+					log.Log.Warnf("Redis %s is not required, starting DEGRADED without it (%v)", v.NameId, err)
+					rs.reconnectInBackground(v)
+				}
 			}
 		}
 		log.Log.Info("Connecting to Redis Manager... done")
@@ -99,6 +256,89 @@ func (rs *DXRedisManager) ConnectAllAtStart() (err error) {
 	return nil
 }
 
+// reconnectInBackground connects r again with a backoff until it succeeds or the manager is disconnected.
+func (rs *DXRedisManager) reconnectInBackground(r *DXRedis) {
+	if rs.ErrorGroupContext == nil {
+		// DisconnectAll cancels it, like the context of SetErrorGroup
+		rs.ErrorGroupContext, rs.subscriptionCancel = context.WithCancel(r.Context)
+	}
+	ctx := rs.ErrorGroupContext
+	rs.workers.Add(1)
+	go func() {
+		defer rs.workers.Done()
+		backoff := DXRedisReconnectInitialBackoff
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			err := r.Connect()
+			if err == nil {
+				log.Log.Infof("Redis %s is reconnected, not degraded anymore", r.NameId)
+				return
+			}
+			backoff = backoff * 2
+			if backoff > DXRedisReconnectMaxBackoff {
+				backoff = DXRedisReconnectMaxBackoff
+			}
+		}
+	}()
+}
+
+// DegradedRedises are the name ids of the Redises that are not required and could not be connected.
+func (rs *DXRedisManager) DegradedRedises() (r []string) {
+	for k, v := range rs.Redises {
+		if v.IsConnectAtStart && !v.IsRequired && !v.IsAvailable() {
+			r = append(r, k)
+		}
+	}
+	return r
+}
+
+// Ping sends a PING to every Redis, bounded by DXRedisPingDefaultTimeout, and gives the error of the first one failing.
+func (rs *DXRedisManager) Ping(ctx context.Context) (err error) {
+	nameIds := make([]string, 0, len(rs.Redises))
+	for k := range rs.Redises {
+		nameIds = append(nameIds, k)
+	}
+	sort.Strings(nameIds)
+	for _, k := range nameIds {
+		err = rs.PingRedis(ctx, k)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rs *DXRedisManager) PingRedis(ctx context.Context, nameId string) (err error) {
+	r, ok := rs.Redises[nameId]
+	if !ok {
+		return fmt.Errorf("RedisNotFound:%s", nameId)
+	}
+	ctx, cancel := context.WithTimeout(ctx, DXRedisPingDefaultTimeout)
+	defer cancel()
+	err = r.HealthCheck(ctx)
+	if err != nil {
+		return fmt.Errorf("RedisPingFailed:%s: %w", nameId, err)
+	}
+	return nil
+}
+
+// PoolStats gives the connection pool statistics of every available Redis by name id.
+func (rs *DXRedisManager) PoolStats() (r map[string]*redis.PoolStats) {
+	r = map[string]*redis.PoolStats{}
+	for k, v := range rs.Redises {
+		c := v.liveConnection()
+		if c == nil {
+			continue
+		}
+		r[k] = c.PoolStats()
+	}
+	return r
+}
+
 func (rs *DXRedisManager) ConnectAll() (err error) {
 	for _, v := range rs.Redises {
 		err = v.Connect()
@@ -111,6 +351,11 @@ func (rs *DXRedisManager) ConnectAll() (err error) {
 }
 
 func (rs *DXRedisManager) DisconnectAll() (err error) {
+	if rs.subscriptionCancel != nil {
+		rs.subscriptionCancel()
+	}
+	// the queue workers finish their running jobs before the connections are closed
+	rs.workers.Wait()
 	for _, v := range rs.Redises {
 		err = v.Disconnect()
 		if err != nil {
@@ -123,7 +368,7 @@ func (rs *DXRedisManager) DisconnectAll() (err error) {
 func (r *DXRedis) ApplyFromConfiguration() (err error) {
 	if !r.IsConfigured {
 		log.Log.Infof("Configuring to Redis %s... start", r.NameId)
-		configurationData, ok := configurations.Manager.Configurations[`redis`]
+		configurationData, ok := configurations.Manager.Get(r.ConfigurationNameId)
 		if !ok {
 			err = log.Log.PanicAndCreateErrorf("DXRedis/ApplyFromConfiguration/1", "Redises configuration not found")
 			return err
@@ -161,34 +406,85 @@ func (r *DXRedis) ApplyFromConfiguration() (err error) {
 				return err
 			}
 		}
+		r.IsSubscriptionStopOnHandlerError, _ = redisConfiguration[`subscription_stop_on_handler_error`].(bool)
+		r.CacheBatchWindow = time.Duration(json2.GetNumberWithDefault(redisConfiguration, `cache_batch_window_ms`, 0)) * time.Millisecond
+		r.CacheBatchMaxKeys = json2.GetNumberWithDefault(redisConfiguration, `cache_batch_max_keys`, DXRedisCacheDefaultBatchMaxKeys)
+		cacheCodecName, ok := redisConfiguration[`cache_codec`].(string)
+		if ok {
+			r.CacheCodec, ok = CacheCodec(cacheCodecName)
+			if !ok {
+				err := log.Log.WarnAndCreateErrorf("configuration is unusable, unknown cache_codec %s in Redis %s configuration", cacheCodecName, r.NameId)
+				return err
+			}
+		}
+		circuitBreakerConfiguration, ok := redisConfiguration[`circuit_breaker`].(utils.JSON)
+		if ok {
+			r.CircuitBreaker = breaker.Manager.NewCircuitBreakerFromConfiguration(`redis/`+r.NameId, circuitBreakerConfiguration)
+			r.CircuitBreaker.IsFailure = func(err error) bool {
+				return breaker.IsFailureDefault(err) && !errors.Is(err, redis.Nil)
+			}
+		}
 		r.IsConfigured = true
 		log.Log.Infof("Configuring to Redis %s... done", r.NameId)
 	}
 	return nil
 }
 
+func (r *DXRedis) ringOptions() *redis.RingOptions {
+	redisRingOptions := &redis.RingOptions{
+		Addrs: map[string]string{
+			"shard1": r.Address,
+		},
+		DB: r.DatabaseIndex,
+	}
+	if r.HasUserName {
+		redisRingOptions.Username = r.UserName
+	}
+	if r.HasPassword {
+		redisRingOptions.Password = r.Password
+	}
+	return redisRingOptions
+}
+
+// CheckReachable pings the Redis with a throwaway connection, it never ends the process like Connect does when MustConnected.
+func (r *DXRedis) CheckReachable(ctx context.Context) (err error) {
+	err = r.ApplyFromConfiguration()
+	if err != nil {
+		return err
+	}
+	connection := redis.NewRing(r.ringOptions())
+	defer func() {
+		_ = connection.Close()
+	}()
+	return connection.Ping(ctx).Err()
+}
+
 func (r *DXRedis) Connect() (err error) {
+	return r.ConnectContext(r.Context)
+}
+
+// ConnectContext is Connect pinging with ctx, aborted once ctx is done with the error of ctx, even when MustConnected.
+func (r *DXRedis) ConnectContext(ctx context.Context) (err error) {
 	if !r.Connected {
 		err := r.ApplyFromConfiguration()
 		if err != nil {
-			log.Log.Errorf("Cannot configure to Redis %s to connect (s)", r.NameId, err)
+			log.Log.Errorf("Cannot configure to Redis %s to connect (%v)", r.NameId, err)
 			return err
 		}
 		log.Log.Infof("Connecting to Redis %s at %s/%d... start", r.NameId, r.Address, r.DatabaseIndex)
-		redisRingOptions := &redis.RingOptions{
-			Addrs: map[string]string{
-				"shard1": r.Address,
-			},
-			DB: r.DatabaseIndex,
+		connection := redis.NewRing(r.ringOptions())
+		if metrics.Manager.IsEnabled {
+			connection.AddHook(&metricsHook{redisNameId: r.NameId})
 		}
-		if r.HasUserName {
-			redisRingOptions.Username = r.UserName
+		if tracing.Manager.IsEnabled {
+			connection.AddHook(&tracingHook{redisNameId: r.NameId})
 		}
-		if r.HasPassword {
-			redisRingOptions.Password = r.Password
+		err = connection.Ping(ctx).Err()
+		if err != nil && ctx.Err() != nil {
+			log.Log.Warnf("Connecting to Redis %s at %s/%d... aborted (%v)", r.NameId, r.Address, r.DatabaseIndex, ctx.Err())
+			_ = connection.Close()
+			return ctx.Err()
 		}
-		connection := redis.NewRing(redisRingOptions)
-		err = connection.Ping(r.Context).Err()
 		if err != nil {
 			if r.MustConnected {
 				log.Log.Fatalf("Cannot connect to Redis %s at %s/%d (%s)", r.NameId, r.Address, r.DatabaseIndex, err)
@@ -198,15 +494,47 @@ func (r *DXRedis) Connect() (err error) {
 				return err
 			}
 		}
+		r.connectionMutex.Lock()
 		r.Connection = connection
 		r.Connected = true
+		r.available.Store(true)
+		r.connectionMutex.Unlock()
 		log.Log.Infof("Connecting to Redis %s at %s/%d... done CONNECTED", r.NameId, r.Address, r.DatabaseIndex)
 	}
 	return nil
 }
 
+// IsAvailable is true once connected, unlike Connected it can be read while a degraded Redis is reconnected.
+func (r *DXRedis) IsAvailable() bool {
+	return r.available.Load()
+}
+
+// liveConnection gives Connection while the Redis is available, otherwise nil. Unlike reading Connection, it is safe
+// while the Redis is reconnected in the background.
+func (r *DXRedis) liveConnection() *redis.Ring {
+	r.connectionMutex.RLock()
+	defer r.connectionMutex.RUnlock()
+	if !r.available.Load() {
+		return nil
+	}
+	return r.Connection
+}
+
+// HealthCheck is Ping bounded by ctx, for health.Register.
+func (r *DXRedis) HealthCheck(ctx context.Context) (err error) {
+	c := r.liveConnection()
+	if c == nil {
+		return ErrRedisNotConnected
+	}
+	return c.Ping(ctx).Err()
+}
+
 func (r *DXRedis) Ping() (err error) {
-	err = r.Connection.Ping(r.Context).Err()
+	c := r.liveConnection()
+	if c == nil {
+		return ErrRedisNotConnected
+	}
+	err = c.Ping(r.Context).Err()
 	if err != nil {
 		return err
 	}
@@ -214,6 +542,14 @@ func (r *DXRedis) Ping() (err error) {
 	return nil
 }
 
+// call runs fn through the CircuitBreaker of the Redis, when there is one.
+func (r *DXRedis) call(fn func() error) (err error) {
+	if r.CircuitBreaker == nil {
+		return fn()
+	}
+	return r.CircuitBreaker.Call(fn)
+}
+
 func (r *DXRedis) Set(key string, value utils.JSON, expirationDuration time.Duration) (err error) {
 	valueAsBytes, err := json.Marshal(value)
 	if err != nil {
@@ -221,7 +557,12 @@ func (r *DXRedis) Set(key string, value utils.JSON, expirationDuration time.Dura
 		return err
 	}
 
-	err = r.Connection.Set(r.Context, key, valueAsBytes, expirationDuration).Err()
+	if !r.IsAvailable() {
+		return ErrRedisNotConnected
+	}
+	err = r.call(func() error {
+		return r.Connection.Set(r.Context, key, valueAsBytes, expirationDuration).Err()
+	})
 	if err != nil {
 		log.Log.Errorf("Cannot save to Redis %s k/v (%v) %s/%v", r.NameId, err, key, value)
 		return err
@@ -230,43 +571,62 @@ func (r *DXRedis) Set(key string, value utils.JSON, expirationDuration time.Dura
 }
 
 func (r *DXRedis) Get(key string) (value utils.JSON, err error) {
-	valueAsBytes, err := r.Connection.Get(r.Context, key).Bytes()
+	if !r.IsAvailable() {
+		return nil, ErrRedisNotConnected
+	}
+	var valueAsBytes []byte
+	err = r.call(func() (err error) {
+		valueAsBytes, err = r.Connection.Get(r.Context, key).Bytes()
+		return err
+	})
 	if err != nil {
 		if err == redis.Nil {
 			return nil, nil
 		}
-		log.Log.Errorf("Cannot get to Redis %s k/v (%v) %s/%v (%s)", r.NameId, err, key)
+		log.Log.Errorf("Cannot get to Redis %s k/v (%v) %s", r.NameId, err, key)
 		return nil, err
 	}
 	err = json.Unmarshal(valueAsBytes, &value)
 	if err != nil {
-		log.Log.Errorf("Cannot unmarshall from bytes in Redis %s k/v (%v) %s/%v (%s)", r.NameId, err, key, valueAsBytes)
+		log.Log.Errorf("Cannot unmarshall from bytes in Redis %s k/v (%v) %s/%s", r.NameId, err, key, valueAsBytes)
 		return nil, err
 	}
 	return value, nil
 }
 
 func (r *DXRedis) GetMustExist(key string) (value utils.JSON, err error) {
-	valueAsBytes, err := r.Connection.Get(r.Context, key).Bytes()
+	if !r.IsAvailable() {
+		return nil, ErrRedisNotConnected
+	}
+	var valueAsBytes []byte
+	err = r.call(func() (err error) {
+		valueAsBytes, err = r.Connection.Get(r.Context, key).Bytes()
+		return err
+	})
 	if err != nil {
 		if err == redis.Nil {
-			log.Log.Errorf("Cannot find key %s in Redis %s (%v)", key, r.NameId, err, key)
+			log.Log.Errorf("Cannot find key %s in Redis %s (%v)", key, r.NameId, err)
 			return nil, err
 		} else {
-			log.Log.Errorf("Cannot get k/v to Redis%s k/v (%v) %s/%v (%s)", r.NameId, err, key)
+			log.Log.Errorf("Cannot get k/v to Redis %s k/v (%v) %s", r.NameId, err, key)
 			return nil, err
 		}
 	}
 	err = json.Unmarshal(valueAsBytes, &value)
 	if err != nil {
-		log.Log.Errorf("Cannot unmarshall from bytes in Redis %s k/v (%v) %s/%v (%s)", r.NameId, err, key, valueAsBytes)
+		log.Log.Errorf("Cannot unmarshall from bytes in Redis %s k/v (%v) %s/%s", r.NameId, err, key, valueAsBytes)
 		return nil, err
 	}
 	return value, nil
 }
 
 func (r *DXRedis) Delete(key string) (err error) {
-	_, err = r.Connection.Del(r.Context, key).Result()
+	if !r.IsAvailable() {
+		return ErrRedisNotConnected
+	}
+	err = r.call(func() error {
+		return r.Connection.Del(r.Context, key).Err()
+	})
 	if err != nil {
 		log.Log.Errorf("Error in deleting key Redis %s k/v (%v) %s", r.NameId, err, key)
 		return err
@@ -277,14 +637,17 @@ func (r *DXRedis) Delete(key string) (err error) {
 func (r *DXRedis) Disconnect() (err error) {
 	if r.Connected {
 		log.Log.Infof("Disconnecting to Redis %s at %s/%d... start", r.NameId, r.Address, r.DatabaseIndex)
+		r.connectionMutex.Lock()
+		r.available.Store(false)
 		c := r.Connection
+		r.Connection = nil
+		r.Connected = false
+		r.connectionMutex.Unlock()
 		err := c.Close()
 		if err != nil {
 			log.Log.Errorf("Disconnecting to Redis %s at %s/%d error (%s)", r.NameId, r.Address, r.DatabaseIndex, err)
 			return err
 		}
-		r.Connection = nil
-		r.Connected = false
 		log.Log.Infof("Disconnecting to Redis %s at %s/%d... done DISCONNECTED", r.NameId, r.Address, r.DatabaseIndex)
 	}
 	return nil
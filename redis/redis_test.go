@@ -0,0 +1,193 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/configurations"
+	"dxlib/v3/utils"
+)
+
+// newTestRedis gives a DXRedis connected to a miniredis, closed at the end of the test.
+func newTestRedis(t *testing.T) (r *DXRedis, m *miniredis.Miniredis) {
+	t.Helper()
+	m = miniredis.RunT(t)
+	r = &DXRedis{NameId: `test`, Address: m.Addr(), IsRequired: true, Context: context.Background()}
+	r.Connection = redis.NewRing(r.ringOptions())
+	r.Connected = true
+	r.available.Store(true)
+	t.Cleanup(func() {
+		_ = r.Disconnect()
+	})
+	require.NoError(t, r.Connection.Ping(context.Background()).Err())
+	return r, m
+}
+
+func TestHealthCheckAndPoolStatsWhileReconnecting(t *testing.T) {
+	m := miniredis.RunT(t)
+	r := &DXRedis{NameId: `test`, Address: m.Addr(), IsConfigured: true, IsRequired: true, Context: context.Background()}
+	rs := DXRedisManager{Redises: map[string]*DXRedis{r.NameId: r}}
+	t.Cleanup(func() {
+		_ = r.Disconnect()
+	})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			assert.NoError(t, r.Connect())
+			assert.NoError(t, r.Disconnect())
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		// the check fails while disconnected, it must not race the reconnect
+		_ = r.HealthCheck(context.Background())
+		_ = rs.PoolStats()
+	}
+}
+
+func TestEnabledConfigurationNameIds(t *testing.T) {
+	for nameId, data := range map[string]utils.JSON{
+		`redis`:       {`enabled`: true},
+		`redis_queue`: {`queue`: utils.JSON{}},
+		`redis_cache`: {`enabled`: false, `cache`: utils.JSON{}},
+		`redis_a`:     {},
+	} {
+		configurations.Manager.NewConfiguration(nameId, ``, `json`, false, false, data, nil)
+		t.Cleanup(func() {
+			configurations.Manager.NewConfiguration(nameId, ``, `json`, false, false, utils.JSON{`enabled`: false}, nil)
+		})
+	}
+	assert.Equal(t, []string{`redis`, `redis_a`, `redis_queue`}, EnabledConfigurationNameIds())
+}
+
+func TestLoadFromConfigurationSkipsTheEnabledField(t *testing.T) {
+	configurations.Manager.NewConfiguration(`redis_test`, ``, `json`, false, false, utils.JSON{
+		`enabled`: true,
+		`test_a`:  utils.JSON{`address`: `127.0.0.1:1`, `database_index`: float64(0), `required`: false},
+	}, nil)
+	t.Cleanup(func() {
+		configurations.Manager.NewConfiguration(`redis_test`, ``, `json`, false, false, utils.JSON{`enabled`: false}, nil)
+	})
+	rs := &DXRedisManager{Redises: map[string]*DXRedis{}}
+	require.NoError(t, rs.LoadFromConfiguration(`redis_test`))
+	assert.Len(t, rs.Redises, 1)
+	assert.False(t, rs.Redises[`test_a`].IsRequired)
+}
+
+// setTestRedisConfiguration sets the Redis configuration block nameId to data until the end of the test.
+func setTestRedisConfiguration(t *testing.T, nameId string, data utils.JSON) {
+	t.Helper()
+	configurations.Manager.NewConfiguration(nameId, ``, `json`, false, false, data, nil)
+	t.Cleanup(func() {
+		configurations.Manager.NewConfiguration(nameId, ``, `json`, false, false, utils.JSON{`enabled`: false}, nil)
+	})
+}
+
+func TestNamedRedisesAreIndependent(t *testing.T) {
+	cache, queue := miniredis.RunT(t), miniredis.RunT(t)
+	setTestRedisConfiguration(t, `redis_cache`, utils.JSON{
+		`cache`: utils.JSON{`address`: cache.Addr(), `database_index`: float64(0), `is_connect_at_start`: true},
+	})
+	setTestRedisConfiguration(t, `redis_queue`, utils.JSON{
+		`queue`: utils.JSON{`address`: queue.Addr(), `database_index`: float64(1), `is_connect_at_start`: true},
+	})
+	rs := &DXRedisManager{Redises: map[string]*DXRedis{}}
+	for _, nameId := range []string{`redis_cache`, `redis_queue`} {
+		require.NoError(t, rs.LoadFromConfiguration(nameId))
+	}
+	require.NoError(t, rs.ConnectAllAtStart(context.Background()))
+	t.Cleanup(func() {
+		_ = rs.DisconnectAll()
+	})
+
+	c, err := rs.Client(`cache`)
+	require.NoError(t, err)
+	assert.Equal(t, `redis_cache`, c.ConfigurationNameId)
+	q, err := rs.Client(`queue`)
+	require.NoError(t, err)
+	assert.Equal(t, 1, q.DatabaseIndex)
+	require.NoError(t, c.Set(`key`, utils.JSON{`from`: `cache`}, 0))
+	require.NoError(t, q.Set(`key`, utils.JSON{`from`: `queue`}, 0))
+
+	v, err := c.Get(`key`)
+	require.NoError(t, err)
+	assert.Equal(t, `cache`, v[`from`])
+	v, err = q.Get(`key`)
+	require.NoError(t, err)
+	assert.Equal(t, `queue`, v[`from`])
+	assert.Equal(t, []string{`key`}, cache.DB(0).Keys())
+	assert.Empty(t, queue.DB(0).Keys())
+	assert.Equal(t, []string{`key`}, queue.DB(1).Keys())
+
+	// one of them down, the other is still served
+	queue.Close()
+	_, err = q.Get(`key`)
+	assert.Error(t, err)
+	_, err = c.Get(`key`)
+	assert.NoError(t, err)
+
+	require.NoError(t, rs.DisconnectAll())
+	assert.False(t, c.Connected)
+	assert.False(t, q.Connected)
+	_, err = rs.Client(`absent`)
+	assert.EqualError(t, err, `RedisNotFound:absent`)
+}
+
+func TestNamedRedisCollision(t *testing.T) {
+	setTestRedisConfiguration(t, `redis`, utils.JSON{`shared`: utils.JSON{`address`: `127.0.0.1:1`, `database_index`: float64(0)}})
+	setTestRedisConfiguration(t, `redis_cache`, utils.JSON{`shared`: utils.JSON{`address`: `127.0.0.1:2`, `database_index`: float64(0)}})
+	rs := &DXRedisManager{Redises: map[string]*DXRedis{}}
+
+	require.NoError(t, rs.LoadFromConfiguration(`redis`))
+	assert.ErrorContains(t, rs.LoadFromConfiguration(`redis_cache`), `RedisNameIdCollision:shared,redis,redis_cache`)
+}
+
+func TestConnectAllAtStartReturnsPromptlyOnCancel(t *testing.T) {
+	ln, err := net.Listen(`tcp`, `127.0.0.1:0`)
+	require.NoError(t, err)
+	conns := make(chan net.Conn, 16)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- c
+		}
+	}()
+	t.Cleanup(func() {
+		_ = ln.Close()
+		close(conns)
+		for c := range conns {
+			_ = c.Close()
+		}
+	})
+	// the server accepts and never answers, the ping waits for its read timeout
+	setTestRedisConfiguration(t, `redis_slow`, utils.JSON{`slow`: utils.JSON{`address`: ln.Addr().String(),
+		`database_index`: float64(0), `is_connect_at_start`: true}})
+	rs := &DXRedisManager{Redises: map[string]*DXRedis{}}
+	require.NoError(t, rs.LoadFromConfiguration(`redis_slow`))
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	startTime := time.Now()
+	err = rs.ConnectAllAtStart(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(startTime), time.Second)
+	assert.False(t, rs.Redises[`slow`].Connected)
+
+	err = rs.ConnectAllAtStart(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,38 @@
+package subsystems
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"dxlib/v3/log"
+)
+
+const DXSubsystemDefaultRestartDelay = 5 * time.Second
+
+// RestartDelay is the wait before a non fatal subsystem is run again after an error.
+var RestartDelay = DXSubsystemDefaultRestartDelay
+
+// Go runs fn in errorGroup. The error of a fatal subsystem ends errorGroup and cancels its context, stopping every other
+// subsystem, the error of a non fatal one is only logged and fn is run again after RestartDelay, until ctx is done.
+func Go(errorGroup *errgroup.Group, ctx context.Context, nameId string, isFatal bool, fn func() error) {
+	if isFatal {
+		errorGroup.Go(fn)
+		return
+	}
+	errorGroup.Go(func() error {
+		for {
+			err := fn()
+			if err == nil || ctx.Err() != nil {
+				return nil
+			}
+			log.Log.Errorf("Non fatal subsystem %s failed, restarting in %v (%v)", nameId, RestartDelay, err)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(RestartDelay):
+			}
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package subsystems
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/errgroup"
+)
+
+// setTestRestartDelay sets RestartDelay to d until the end of the test.
+func setTestRestartDelay(t *testing.T, d time.Duration) {
+	t.Helper()
+	restartDelay := RestartDelay
+	RestartDelay = d
+	t.Cleanup(func() {
+		RestartDelay = restartDelay
+	})
+}
+
+func TestNonFatalErrorRestartsWithoutCancellingTheOthers(t *testing.T) {
+	setTestRestartDelay(t, 10*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errorGroup, errorGroupContext := errgroup.WithContext(ctx)
+
+	// the api stands for a fatal subsystem serving until its context is done
+	Go(errorGroup, errorGroupContext, `api`, true, func() error {
+		<-errorGroupContext.Done()
+		return nil
+	})
+	runs := atomic.Int32{}
+	Go(errorGroup, errorGroupContext, `task`, false, func() error {
+		runs.Add(1)
+		return errors.New(`flaky`)
+	})
+
+	assert.Eventually(t, func() bool {
+		return runs.Load() >= 3
+	}, 5*time.Second, time.Millisecond)
+	assert.NoError(t, errorGroupContext.Err())
+
+	cancel()
+	assert.NoError(t, errorGroup.Wait())
+	n := runs.Load()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, n, runs.Load(), `restarted after the context was done`)
+}
+
+func TestFatalErrorCancelsTheOthers(t *testing.T) {
+	errorGroup, errorGroupContext := errgroup.WithContext(context.Background())
+	errFatal := errors.New(`listener died`)
+
+	Go(errorGroup, errorGroupContext, `task`, false, func() error {
+		<-errorGroupContext.Done()
+		return nil
+	})
+	Go(errorGroup, errorGroupContext, `api`, true, func() error {
+		return errFatal
+	})
+
+	assert.ErrorIs(t, errorGroup.Wait(), errFatal)
+	assert.Error(t, errorGroupContext.Err())
+}
+
+func TestNonFatalReturningNilIsNotRestarted(t *testing.T) {
+	setTestRestartDelay(t, time.Millisecond)
+	errorGroup, _ := errgroup.WithContext(context.Background())
+	runs := atomic.Int32{}
+
+	Go(errorGroup, context.Background(), `task`, false, func() error {
+		runs.Add(1)
+		return nil
+	})
+
+	assert.NoError(t, errorGroup.Wait())
+	assert.Equal(t, int32(1), runs.Load())
+}
@@ -0,0 +1,247 @@
+package tables
+
+import (
+	"context"
+	"database/sql"
+
+	"dxlib/v3/api"
+	"dxlib/v3/databases"
+	"dxlib/v3/databases/protected/db"
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+)
+
+type DXTableAuditOperation string
+
+const (
+	DXTableAuditOperationInsert DXTableAuditOperation = "INSERT"
+	DXTableAuditOperationUpdate DXTableAuditOperation = "UPDATE"
+	DXTableAuditOperationDelete DXTableAuditOperation = "DELETE"
+)
+
+const DXTableAuditLogDefaultTableName = "audit_log"
+
+type DXTableAuditEvent struct {
+	TableNameId string
+	Operation   DXTableAuditOperation
+	Id          any
+	Before      utils.JSON
+	After       utils.JSON
+	ActorId     string
+}
+
+// DXTableAuditHook runs in the transaction of the change, an error rolls the change back.
+type DXTableAuditHook func(log *log.DXLog, dtx *databases.DXDatabaseTx, event DXTableAuditEvent) (err error)
+
+type auditActorIdContextKey struct{}
+
+func ContextWithAuditActorId(ctx context.Context, actorId string) context.Context {
+	return context.WithValue(ctx, auditActorIdContextKey{}, actorId)
+}
+
+// AuditActorIdFromContext is the actor set by ContextWithAuditActorId, otherwise the subject of the verified token of
+// the request.
+func AuditActorIdFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	actorId, ok := ctx.Value(auditActorIdContextKey{}).(string)
+	if ok {
+		return actorId
+	}
+	claims, ok := api.ClaimsFromContext(ctx)
+	if ok {
+		actorId, _ = claims["sub"].(string)
+	}
+	return actorId
+}
+
+// NewAuditLogHook writes every event as a row of auditTableName, with the fields table_name, operation, row_id,
+// before_values, after_values, actor_id and created_at.
+func NewAuditLogHook(auditTableName string) DXTableAuditHook {
+	if auditTableName == "" {
+		auditTableName = DXTableAuditLogDefaultTableName
+	}
+	return func(l *log.DXLog, dtx *databases.DXDatabaseTx, event DXTableAuditEvent) (err error) {
+		_, err = dtx.InsertRowsAffected(l, auditTableName, utils.JSON{
+			"table_name":    event.TableNameId,
+			"operation":     string(event.Operation),
+			"row_id":        event.Id,
+			"before_values": event.Before,
+			"after_values":  event.After,
+			"actor_id":      event.ActorId,
+			"created_at":    utils.NowAsString(),
+		})
+		return err
+	}
+}
+
+func auditLog(l *log.DXLog) *log.DXLog {
+	if l == nil {
+		return &log.Log
+	}
+	return l
+}
+
+// contextOf is the context of l, the request context of the log of a request, so its queries stop with the request.
+func contextOf(l *log.DXLog) context.Context {
+	if l == nil || l.Context == nil {
+		return context.Background()
+	}
+	return l.Context
+}
+
+// auditLogOfRequest carries the current user of aepr as the actor.
+func auditLogOfRequest(aepr *api.DXAPIEndPointRequest) *log.DXLog {
+	if aepr.CurrentUser.ID == "" {
+		return &aepr.Log
+	}
+	l := aepr.Log
+	l.Context = ContextWithAuditActorId(l.Context, aepr.CurrentUser.ID)
+	return &l
+}
+
+func (t *DXTable) audit(l *log.DXLog, dtx *databases.DXDatabaseTx, operation DXTableAuditOperation, id any, before utils.JSON, after utils.JSON) (err error) {
+	err = t.OnAudit(l, dtx, DXTableAuditEvent{
+		TableNameId: t.NameId,
+		Operation:   operation,
+		Id:          id,
+		Before:      before,
+		After:       after,
+		ActorId:     AuditActorIdFromContext(l.Context),
+	})
+	if err != nil {
+		l.Errorf("Error at audit of %s %s %v (%v)", operation, t.NameId, id, err)
+		return err
+	}
+	return nil
+}
+
+func (t *DXTable) inAuditTx(l *log.DXLog, callback databases.DXDatabaseTxCallback) (err error) {
+	return t.Database.Tx(auditLog(l), databases.LevelReadCommitted, callback)
+}
+
+func (t *DXTable) txAuditedInsert(l *log.DXLog, dtx *databases.DXDatabaseTx, newKeyValues utils.JSON) (newId int64, err error) {
+	newId, err = dtx.Insert(l, t.NameId, newKeyValues)
+	if err != nil {
+		return 0, err
+	}
+	after := utils.JSON{}
+	for k, v := range newKeyValues {
+		after[k] = v
+	}
+	after["id"] = newId
+	// the values of the SQL expressions, like the managed timestamps, are only known to the database
+	if len(db.ExcludeSQLExpression(newKeyValues)) != len(newKeyValues) {
+		after, err = dtx.SelectOne(l, t.NameId, nil, utils.JSON{"id": newId}, nil, nil, nil)
+		if err != nil {
+			return 0, err
+		}
+	}
+	err = t.audit(l, dtx, DXTableAuditOperationInsert, newId, nil, after)
+	return newId, err
+}
+
+// txAuditedUpdate locks the matching rows to read them before and after the update.
+func (t *DXTable) txAuditedUpdate(l *log.DXLog, dtx *databases.DXDatabaseTx, operation DXTableAuditOperation, setKeyValues utils.JSON, whereAndFieldNameValues utils.JSON) (result sql.Result, err error) {
+	befores, err := dtx.Select(l, t.NameId, nil, whereAndFieldNameValues, nil, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	result, err = dtx.Update(l, t.NameId, setKeyValues, whereAndFieldNameValues)
+	if err != nil {
+		return nil, err
+	}
+	for _, before := range befores {
+		id := before["id"]
+		after, err := dtx.SelectOne(l, t.NameId, nil, utils.JSON{"id": id}, nil, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		err = t.audit(l, dtx, operation, id, before, after)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (t *DXTable) txAuditedDelete(l *log.DXLog, dtx *databases.DXDatabaseTx, whereAndFieldNameValues utils.JSON) (result sql.Result, err error) {
+	befores, err := dtx.Select(l, t.NameId, nil, whereAndFieldNameValues, nil, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	result, err = dtx.Delete(l, t.NameId, whereAndFieldNameValues)
+	if err != nil {
+		return nil, err
+	}
+	for _, before := range befores {
+		err = t.audit(l, dtx, DXTableAuditOperationDelete, before["id"], before, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// insert, update and delete are the write path of the table, in a transaction with the audit when OnAudit is set, they
+// are given the field names and write the columns.
+func (t *DXTable) insert(l *log.DXLog, newKeyValues utils.JSON) (newId int64, err error) {
+	newKeyValues, err = t.toColumns(newKeyValues)
+	if err != nil {
+		return 0, err
+	}
+	if t.OnAudit == nil {
+		return t.Database.InsertContext(contextOf(l), t.NameId, newKeyValues)
+	}
+	err = t.inAuditTx(l, func(l *log.DXLog, dtx *databases.DXDatabaseTx) (err error) {
+		newId, err = t.txAuditedInsert(l, dtx, newKeyValues)
+		return err
+	})
+	return newId, err
+}
+
+func (t *DXTable) txInsert(l *log.DXLog, dtx *databases.DXDatabaseTx, newKeyValues utils.JSON) (newId int64, err error) {
+	newKeyValues, err = t.toColumns(newKeyValues)
+	if err != nil {
+		return 0, err
+	}
+	if t.OnAudit == nil {
+		return dtx.Insert(l, t.NameId, newKeyValues)
+	}
+	return t.txAuditedInsert(auditLog(l), dtx, newKeyValues)
+}
+
+func (t *DXTable) update(l *log.DXLog, operation DXTableAuditOperation, setKeyValues utils.JSON, whereAndFieldNameValues utils.JSON) (result sql.Result, err error) {
+	setKeyValues, err = t.toColumns(setKeyValues)
+	if err != nil {
+		return nil, err
+	}
+	whereAndFieldNameValues, err = t.toColumns(whereAndFieldNameValues)
+	if err != nil {
+		return nil, err
+	}
+	if t.OnAudit == nil {
+		return t.Database.UpdateContext(contextOf(l), t.NameId, setKeyValues, whereAndFieldNameValues)
+	}
+	err = t.inAuditTx(l, func(l *log.DXLog, dtx *databases.DXDatabaseTx) (err error) {
+		result, err = t.txAuditedUpdate(l, dtx, operation, setKeyValues, whereAndFieldNameValues)
+		return err
+	})
+	return result, err
+}
+
+func (t *DXTable) delete(l *log.DXLog, whereAndFieldNameValues utils.JSON) (result sql.Result, err error) {
+	whereAndFieldNameValues, err = t.toColumns(whereAndFieldNameValues)
+	if err != nil {
+		return nil, err
+	}
+	if t.OnAudit == nil {
+		return t.Database.DeleteContext(contextOf(l), t.NameId, whereAndFieldNameValues)
+	}
+	err = t.inAuditTx(l, func(l *log.DXLog, dtx *databases.DXDatabaseTx) (err error) {
+		result, err = t.txAuditedDelete(l, dtx, whereAndFieldNameValues)
+		return err
+	})
+	return result, err
+}
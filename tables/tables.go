@@ -7,13 +7,19 @@ import (
 	"dxlib/v3/databases/protected/db"
 	"dxlib/v3/log"
 	"dxlib/v3/utils"
+	"errors"
 	"fmt"
+	"net/http"
 	"strings"
+	"time"
 )
 
 type DXTableManager struct {
 	Tables                               map[string]*DXTable
 	StandardOperationResponsePossibility map[string]map[string]*api.DxAPIEndPointResponsePossibility
+	// NamingStrategy maps the field names given to and returned by the tables to their columns, like firstName to
+	// first_name with db.NamingStrategySnake, the filters of List are given as columns
+	NamingStrategy db.DXNamingStrategy
 }
 
 type DXTable struct {
@@ -24,8 +30,31 @@ type DXTable struct {
 	ListViewNameId        string
 	FieldNameForRowCode   string
 	FieldNameForRowNameId string
+	// FieldNameForDeletedAt is the timestamp field of the soft deletes, when empty they use the is_deleted field
+	FieldNameForDeletedAt string
+	// FieldNameForVersion is the integer field of the optimistic locking, see versionedUpdate
+	FieldNameForVersion string
+	// OnAudit, when set, is called for every insert, update and delete in the transaction of the change
+	OnAudit DXTableAuditHook
+	// AllowedColumns, when set, are the only columns List accepts in filter_order_by and filter_key_values, the
+	// latter become equality filters and filter_where is refused
+	AllowedColumns db.DXColumnAllowList
+	// Model, when set, is a struct whose fields VerifyModels checks against the columns of the table at start
+	Model any
+	// SensitiveFieldNames are the fields of personal data, their values are masked in the query logs and errors
+	SensitiveFieldNames []string
+	// FieldNameForCreatedAt and FieldNameForUpdatedAt, when either is set, are the timestamps the writes manage in place
+	// of created_at and last_modified_at, set to now unless the caller gives them
+	FieldNameForCreatedAt string
+	FieldNameForUpdatedAt string
+	// Now, when set, is the now of the managed timestamps instead of the now() of the database, like a fixed clock of a test
+	Now           func() time.Time
+	isWithTrashed bool
 }
 
+// ErrOptimisticLock is returned by a versioned update matching no row, the row was changed since it was read.
+var ErrOptimisticLock = errors.New("OptimisticLock")
+
 func (tm *DXTableManager) ConnectAll() (err error) {
 	for _, t := range tm.Tables {
 		d, ok := databases.Manager.Databases[t.DatabaseNameId]
@@ -34,6 +63,32 @@ func (tm *DXTableManager) ConnectAll() (err error) {
 			return err
 		}
 		t.Database = d
+		db.SetSensitiveColumns(tm.NamingStrategy.ToColumnNames(t.SensitiveFieldNames)...)
+	}
+	return nil
+}
+
+// VerifyModels describes the table of every DXTable with a Model and fails on the first table whose model has a field
+// missing from the table or of an incompatible type, the error lists all the fields of that table.
+func (tm *DXTableManager) VerifyModels() (err error) {
+	for _, t := range tm.Tables {
+		if t.Model == nil {
+			continue
+		}
+		if t.Database == nil {
+			err = log.Log.ErrorAndCreateErrorf("Table %s has no database to verify its model", t.NameId)
+			return err
+		}
+		columns, err := t.Database.DescribeTable(t.NameId)
+		if err != nil {
+			log.Log.Errorf("Cannot describe table %s of database %s (%v)", t.NameId, t.DatabaseNameId, err)
+			return err
+		}
+		err = db.VerifyModel(t.NameId, columns, t.Model)
+		if err != nil {
+			log.Log.Errorf("Model of table %s does not match the database %s:\n%v", t.NameId, t.DatabaseNameId, err)
+			return err
+		}
 	}
 	return nil
 }
@@ -57,10 +112,191 @@ func (tm *DXTableManager) NewTableWithCodeAndNameId(databaseNameId, tableNameId,
 	return &t
 }
 
+// WithTrashed returns a copy of the table whose reads include the soft deleted rows.
+func (t *DXTable) WithTrashed() *DXTable {
+	t2 := *t
+	t2.isWithTrashed = true
+	return &t2
+}
+
+// toColumns and fromColumns map the field names to the columns and back as Manager.NamingStrategy says.
+func (t *DXTable) toColumns(kv utils.JSON) (r utils.JSON, err error) {
+	return Manager.NamingStrategy.ToColumns(kv)
+}
+
+func (t *DXTable) fromColumns(row utils.JSON) utils.JSON {
+	if row == nil || Manager.NamingStrategy == db.NamingStrategyPassthrough {
+		return row
+	}
+	return db.DeformatKeys(t.Database.IdentifierCase, Manager.NamingStrategy, row)
+}
+
+func (t *DXTable) fromColumnsOfRows(rows []utils.JSON) []utils.JSON {
+	if Manager.NamingStrategy == db.NamingStrategyPassthrough {
+		return rows
+	}
+	for i, row := range rows {
+		rows[i] = t.fromColumns(row)
+	}
+	return rows
+}
+
+// whereNotDeleted gives a copy of where with the soft delete filter added, unless the table is
+// WithTrashed or the filter field is already given. The map of the caller is not changed.
+func (t *DXTable) whereNotDeleted(where utils.JSON) utils.JSON {
+	whereAndFieldNameValues := make(utils.JSON, len(where)+1)
+	for k, v := range where {
+		whereAndFieldNameValues[k] = v
+	}
+	if t.isWithTrashed {
+		return whereAndFieldNameValues
+	}
+	if t.FieldNameForDeletedAt != "" {
+		_, ok := whereAndFieldNameValues[t.FieldNameForDeletedAt]
+		if !ok {
+			whereAndFieldNameValues[t.FieldNameForDeletedAt] = nil
+		}
+		return whereAndFieldNameValues
+	}
+	_, ok := whereAndFieldNameValues["is_deleted"]
+	if !ok {
+		whereAndFieldNameValues["is_deleted"] = false
+		if (t.Database != nil) && (t.Database.DatabaseType.String() == "sqlserver") {
+			whereAndFieldNameValues["is_deleted"] = 0
+		}
+	}
+	return whereAndFieldNameValues
+}
+
+func (t *DXTable) setNotDeleted(newKeyValues utils.JSON) {
+	if t.FieldNameForDeletedAt == "" {
+		newKeyValues["is_deleted"] = false
+	}
+}
+
+func (t *DXTable) isTimestampManaged() bool {
+	return t.FieldNameForCreatedAt != "" || t.FieldNameForUpdatedAt != ""
+}
+
+// setInsertTimestamps sets the managed timestamps of an insert the caller does not give to now.
+func (t *DXTable) setInsertTimestamps(newKeyValues utils.JSON) {
+	for _, fieldName := range []string{t.FieldNameForCreatedAt, t.FieldNameForUpdatedAt} {
+		if fieldName == "" {
+			continue
+		}
+		_, ok := newKeyValues[fieldName]
+		if ok {
+			continue
+		}
+		if t.Now != nil {
+			newKeyValues[fieldName] = t.Now()
+		} else {
+			newKeyValues[fieldName] = db.SQLExpression{Expression: "CURRENT_TIMESTAMP"}
+		}
+	}
+}
+
+// formatColumn gives the column of fieldName as Manager.NamingStrategy maps it, quoted for the database of the table,
+// for the statements written by hand like an SQLExpression.
+func (t *DXTable) formatColumn(fieldName string) string {
+	column := Manager.NamingStrategy.ToColumn(fieldName)
+	if t.Database == nil {
+		return db.FormatIdentifier("", db.IdentifierCaseDefault, column)
+	}
+	return db.FormatIdentifier(t.Database.DatabaseType.String(), t.Database.IdentifierCase, column)
+}
+
+// updateTimestamps gives setKeyValues with FieldNameForUpdatedAt set to now, unless the caller gives it.
+func (t *DXTable) updateTimestamps(setKeyValues utils.JSON) utils.JSON {
+	if t.FieldNameForUpdatedAt == "" {
+		return setKeyValues
+	}
+	_, ok := setKeyValues[t.FieldNameForUpdatedAt]
+	if ok {
+		return setKeyValues
+	}
+	newSetKeyValues := utils.JSON{}
+	for k, v := range setKeyValues {
+		newSetKeyValues[k] = v
+	}
+	if t.Now != nil {
+		newSetKeyValues[t.FieldNameForUpdatedAt] = t.Now()
+	} else {
+		newSetKeyValues[t.FieldNameForUpdatedAt] = db.SQLExpression{Expression: t.formatColumn(t.FieldNameForUpdatedAt) + "=CURRENT_TIMESTAMP"}
+	}
+	return newSetKeyValues
+}
+
+func (t *DXTable) softDeleteSetKeyValues() utils.JSON {
+	if t.FieldNameForDeletedAt != "" {
+		return utils.JSON{
+			t.FieldNameForDeletedAt: utils.NowAsString(),
+		}
+	}
+	return utils.JSON{
+		"is_deleted": true,
+	}
+}
+
+// versionedUpdate is used when the table has FieldNameForVersion and setKeyValues carries the version that was
+// read, the update then only matches that version and increments it.
+func (t *DXTable) versionedUpdate(setKeyValues utils.JSON, whereAndFieldNameValues utils.JSON) (newSetKeyValues utils.JSON, newWhereAndFieldNameValues utils.JSON, isVersioned bool) {
+	if t.FieldNameForVersion == "" {
+		return setKeyValues, whereAndFieldNameValues, false
+	}
+	oldVersion, ok := setKeyValues[t.FieldNameForVersion]
+	if !ok {
+		return setKeyValues, whereAndFieldNameValues, false
+	}
+	newSetKeyValues = utils.JSON{}
+	for k, v := range setKeyValues {
+		newSetKeyValues[k] = v
+	}
+	column := t.formatColumn(t.FieldNameForVersion)
+	newSetKeyValues[t.FieldNameForVersion] = db.SQLExpression{Expression: column + "=" + column + "+1"}
+	newWhereAndFieldNameValues = utils.JSON{}
+	for k, v := range whereAndFieldNameValues {
+		newWhereAndFieldNameValues[k] = v
+	}
+	newWhereAndFieldNameValues[t.FieldNameForVersion] = oldVersion
+	return newSetKeyValues, newWhereAndFieldNameValues, true
+}
+
+func checkOptimisticLock(result sql.Result, err error, isVersioned bool) (sql.Result, error) {
+	if err != nil || !isVersioned {
+		return result, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return result, err
+	}
+	if rowsAffected == 0 {
+		return result, ErrOptimisticLock
+	}
+	return result, nil
+}
+
+// Delete soft deletes the row, ForceDelete removes it.
+func (t *DXTable) Delete(log *log.DXLog, id int64) (result sql.Result, err error) {
+	return t.update(log, DXTableAuditOperationDelete, t.updateTimestamps(t.softDeleteSetKeyValues()), t.whereNotDeleted(utils.JSON{
+		"id": id,
+	}))
+}
+
+func (t *DXTable) ForceDelete(log *log.DXLog, id int64) (result sql.Result, err error) {
+	return t.delete(log, utils.JSON{
+		"id": id,
+	})
+}
+
 func (t *DXTable) DoCreate(aepr *api.DXAPIEndPointRequest, newKeyValues utils.JSON) (newId int64, err error) {
 	n := utils.NowAsString()
-	newKeyValues["is_deleted"] = false
-	newKeyValues["created_at"] = n
+	t.setNotDeleted(newKeyValues)
+	if t.isTimestampManaged() {
+		t.setInsertTimestamps(newKeyValues)
+	} else {
+		newKeyValues["created_at"] = n
+	}
 	_, ok := newKeyValues["created_by_user_id"]
 	if !ok {
 		if aepr.CurrentUser.ID != "" {
@@ -70,7 +306,9 @@ func (t *DXTable) DoCreate(aepr *api.DXAPIEndPointRequest, newKeyValues utils.JS
 			newKeyValues["created_by_user_id"] = "0"
 			newKeyValues["created_by_user_nameid"] = "SYSTEM"
 		}
-		newKeyValues["last_modified_at"] = n
+		if !t.isTimestampManaged() {
+			newKeyValues["last_modified_at"] = n
+		}
 		if aepr.CurrentUser.ID != "" {
 			newKeyValues["last_modified_by_user_id"] = aepr.CurrentUser.ID
 			newKeyValues["last_modified_by_user_nameid"] = aepr.CurrentUser.Name
@@ -80,7 +318,7 @@ func (t *DXTable) DoCreate(aepr *api.DXAPIEndPointRequest, newKeyValues utils.JS
 		}
 	}
 
-	newId, err = t.Database.Insert(t.NameId, newKeyValues)
+	newId, err = t.insert(auditLogOfRequest(aepr), newKeyValues)
 	if err != nil {
 		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
 			aepr.ResponseStatusCode = 409
@@ -97,40 +335,52 @@ func (t *DXTable) DoCreate(aepr *api.DXAPIEndPointRequest, newKeyValues utils.JS
 
 func (t *DXTable) GetById(log *log.DXLog, id int64) (r utils.JSON, err error) {
 	r, err = t.SelectOneMustExist(log, utils.JSON{
-		"id":         id,
-		"is_deleted": false,
+		"id": id,
 	}, map[string]string{"id": "asc"})
 	return r, err
 }
 
 func (t *DXTable) TxGetById(log *log.DXLog, tx *databases.DXDatabaseTx, id int64) (r utils.JSON, err error) {
-	r, err = tx.SelectOneMustExist(log, t.ListViewNameId, []string{`*`}, utils.JSON{
-		"id":         id,
-		"is_deleted": false,
-	}, nil, nil, nil)
-	return r, err
+	where, err := t.toColumns(t.whereNotDeleted(utils.JSON{
+		"id": id,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	r, err = tx.SelectOneMustExist(log, t.ListViewNameId, []string{`*`}, where, nil, nil, nil)
+	return t.fromColumns(r), err
 }
 
 func (t *DXTable) TxGetByCode(log *log.DXLog, tx *databases.DXDatabaseTx, code string) (r utils.JSON, err error) {
-	r, err = tx.SelectOneMustExist(log, t.ListViewNameId, []string{`*`}, utils.JSON{
+	where, err := t.toColumns(t.whereNotDeleted(utils.JSON{
 		t.FieldNameForRowCode: code,
-		"is_deleted":          false,
-	}, nil, nil, nil)
-	return r, err
+	}))
+	if err != nil {
+		return nil, err
+	}
+	r, err = tx.SelectOneMustExist(log, t.ListViewNameId, []string{`*`}, where, nil, nil, nil)
+	return t.fromColumns(r), err
 }
 
 func (t *DXTable) TxGetByNameId(log *log.DXLog, tx *databases.DXDatabaseTx, nameId string) (r utils.JSON, err error) {
-	r, err = tx.SelectOneMustExist(log, t.ListViewNameId, []string{`*`}, utils.JSON{
+	where, err := t.toColumns(t.whereNotDeleted(utils.JSON{
 		t.FieldNameForRowNameId: nameId,
-		"is_deleted":            false,
-	}, nil, nil, nil)
-	return r, err
+	}))
+	if err != nil {
+		return nil, err
+	}
+	r, err = tx.SelectOneMustExist(log, t.ListViewNameId, []string{`*`}, where, nil, nil, nil)
+	return t.fromColumns(r), err
 }
 
 func (t *DXTable) TxInsert(log *log.DXLog, tx *databases.DXDatabaseTx, newKeyValues utils.JSON) (newId int64, err error) {
 	n := utils.NowAsString()
-	newKeyValues["is_deleted"] = false
-	newKeyValues["created_at"] = n
+	t.setNotDeleted(newKeyValues)
+	if t.isTimestampManaged() {
+		t.setInsertTimestamps(newKeyValues)
+	} else {
+		newKeyValues["created_at"] = n
+	}
 	_, ok := newKeyValues["created_by_user_id"]
 	if !ok {
 		newKeyValues["created_by_user_id"] = "0"
@@ -139,14 +389,18 @@ func (t *DXTable) TxInsert(log *log.DXLog, tx *databases.DXDatabaseTx, newKeyVal
 		newKeyValues["last_modified_by_user_nameid"] = "SYSTEM"
 	}
 
-	newId, err = tx.Insert(log, t.NameId, newKeyValues)
+	newId, err = t.txInsert(log, tx, newKeyValues)
 	return newId, err
 }
 
 func (t *DXTable) InRequestTxInsert(aepr *api.DXAPIEndPointRequest, tx *databases.DXDatabaseTx, newKeyValues utils.JSON) (newId int64, err error) {
 	n := utils.NowAsString()
-	newKeyValues["is_deleted"] = false
-	newKeyValues["created_at"] = n
+	t.setNotDeleted(newKeyValues)
+	if t.isTimestampManaged() {
+		t.setInsertTimestamps(newKeyValues)
+	} else {
+		newKeyValues["created_at"] = n
+	}
 	_, ok := newKeyValues["created_by_user_id"]
 	if !ok {
 		if aepr.CurrentUser.ID != "" {
@@ -156,7 +410,9 @@ func (t *DXTable) InRequestTxInsert(aepr *api.DXAPIEndPointRequest, tx *database
 			newKeyValues["created_by_user_id"] = "0"
 			newKeyValues["created_by_user_nameid"] = "SYSTEM"
 		}
-		newKeyValues["last_modified_at"] = n
+		if !t.isTimestampManaged() {
+			newKeyValues["last_modified_at"] = n
+		}
 		if aepr.CurrentUser.ID != "" {
 			newKeyValues["last_modified_by_user_id"] = aepr.CurrentUser.ID
 			newKeyValues["last_modified_by_user_nameid"] = aepr.CurrentUser.Name
@@ -166,7 +422,7 @@ func (t *DXTable) InRequestTxInsert(aepr *api.DXAPIEndPointRequest, tx *database
 		}
 	}
 
-	newId, err = tx.Insert(&aepr.Log, t.NameId, newKeyValues)
+	newId, err = t.txInsert(auditLogOfRequest(aepr), tx, newKeyValues)
 	return newId, err
 }
 
@@ -181,9 +437,13 @@ func (t *DXTable) Insert(log *log.DXLog, newKeyValues utils.JSON) (newId int64,
 		// Format the time.Time value back into a string without the timezone offset
 		n = t.Format("2006-01-02 15:04:05")
 	}*/
-	newKeyValues["is_deleted"] = false
-	newKeyValues["created_at"] = n
-	newKeyValues["last_modified_at"] = n
+	t.setNotDeleted(newKeyValues)
+	if t.isTimestampManaged() {
+		t.setInsertTimestamps(newKeyValues)
+	} else {
+		newKeyValues["created_at"] = n
+		newKeyValues["last_modified_at"] = n
+	}
 	_, ok := newKeyValues["created_by_user_id"]
 	if !ok {
 		newKeyValues["created_by_user_id"] = "0"
@@ -192,29 +452,34 @@ func (t *DXTable) Insert(log *log.DXLog, newKeyValues utils.JSON) (newId int64,
 		newKeyValues["last_modified_by_user_nameid"] = "SYSTEM"
 	}
 
-	newId, err = t.Database.Insert(t.NameId, newKeyValues)
+	newId, err = t.insert(log, newKeyValues)
 	return newId, err
 }
 
 func (t *DXTable) Update(log *log.DXLog, setKeyValues utils.JSON, whereAndFieldNameValues utils.JSON) (result sql.Result, err error) {
-	if whereAndFieldNameValues == nil {
-		whereAndFieldNameValues = utils.JSON{}
-	}
-	whereAndFieldNameValues["is_deleted"] = false
+	whereAndFieldNameValues = t.whereNotDeleted(whereAndFieldNameValues)
+	setKeyValues, whereAndFieldNameValues, isVersioned := t.versionedUpdate(t.updateTimestamps(setKeyValues), whereAndFieldNameValues)
 
-	return t.Database.Update(t.NameId, setKeyValues, whereAndFieldNameValues)
+	result, err = t.update(log, DXTableAuditOperationUpdate, setKeyValues, whereAndFieldNameValues)
+	return checkOptimisticLock(result, err, isVersioned)
 }
 
 func (t *DXTable) UpdateOne(log *log.DXLog, FieldValueForId int64, setKeyValues utils.JSON) (result sql.Result, err error) {
-	return t.Database.Update(t.NameId, setKeyValues, utils.JSON{
+	setKeyValues, whereAndFieldNameValues, isVersioned := t.versionedUpdate(t.updateTimestamps(setKeyValues), utils.JSON{
 		"id": FieldValueForId,
 	})
+	result, err = t.update(log, DXTableAuditOperationUpdate, setKeyValues, whereAndFieldNameValues)
+	return checkOptimisticLock(result, err, isVersioned)
 }
 
 func (t *DXTable) InRequestInsert(aepr *api.DXAPIEndPointRequest, newKeyValues utils.JSON) (newId int64, err error) {
 	n := utils.NowAsString()
-	newKeyValues["is_deleted"] = false
-	newKeyValues["created_at"] = n
+	t.setNotDeleted(newKeyValues)
+	if t.isTimestampManaged() {
+		t.setInsertTimestamps(newKeyValues)
+	} else {
+		newKeyValues["created_at"] = n
+	}
 	_, ok := newKeyValues["created_by_user_id"]
 	if !ok {
 		if aepr.CurrentUser.ID != "" {
@@ -224,7 +489,9 @@ func (t *DXTable) InRequestInsert(aepr *api.DXAPIEndPointRequest, newKeyValues u
 			newKeyValues["created_by_user_id"] = "0"
 			newKeyValues["created_by_user_nameid"] = "SYSTEM"
 		}
-		newKeyValues["last_modified_at"] = n
+		if !t.isTimestampManaged() {
+			newKeyValues["last_modified_at"] = n
+		}
 		if aepr.CurrentUser.ID != "" {
 			newKeyValues["last_modified_by_user_id"] = aepr.CurrentUser.ID
 			newKeyValues["last_modified_by_user_nameid"] = aepr.CurrentUser.Name
@@ -234,7 +501,7 @@ func (t *DXTable) InRequestInsert(aepr *api.DXAPIEndPointRequest, newKeyValues u
 		}
 	}
 
-	newId, err = t.Database.Insert(t.NameId, newKeyValues)
+	newId, err = t.insert(auditLogOfRequest(aepr), newKeyValues)
 	return newId, err
 }
 
@@ -244,22 +511,32 @@ func (t *DXTable) Read(aepr *api.DXAPIEndPointRequest) (err error) {
 		return err
 	}
 
-	d, err := t.Database.SelectOne(t.ListViewNameId, nil, utils.JSON{
-		"id":         id,
-		"is_deleted": false,
-	}, nil, nil)
+	where, err := t.toColumns(t.whereNotDeleted(utils.JSON{
+		"id": id,
+	}))
+	if err != nil {
+		return err
+	}
+	d, err := t.Database.SelectOneContext(aepr.Context, t.ListViewNameId, nil, where, nil, nil)
 	if err != nil {
 		return err
 	}
 
-	err = aepr.ResponseSetFromJSON(utils.JSON{t.ResultObjectName: d})
+	err = aepr.ResponseSetFromJSON(utils.JSON{t.ResultObjectName: t.fromColumns(d)})
 
 	return err
 }
 
 func (t *DXTable) DoEdit(aepr *api.DXAPIEndPointRequest, id int64, newKeyValues utils.JSON) (err error) {
-	n := utils.NowAsString()
-	newKeyValues["last_modified_at"] = n
+	return t.doEdit(aepr, DXTableAuditOperationUpdate, id, newKeyValues)
+}
+
+func (t *DXTable) doEdit(aepr *api.DXAPIEndPointRequest, operation DXTableAuditOperation, id int64, newKeyValues utils.JSON) (err error) {
+	if t.isTimestampManaged() {
+		newKeyValues = t.updateTimestamps(newKeyValues)
+	} else {
+		newKeyValues["last_modified_at"] = utils.NowAsString()
+	}
 	_, ok := newKeyValues["last_modified_by_user_id"]
 	if !ok {
 		if aepr.CurrentUser.ID != "" {
@@ -271,11 +548,15 @@ func (t *DXTable) DoEdit(aepr *api.DXAPIEndPointRequest, id int64, newKeyValues
 		}
 	}
 
-	_, err = db.UpdateWhereKeyValues(t.Database.Connection, t.NameId, newKeyValues, utils.JSON{
-		"id":         id,
-		"is_deleted": false,
-	})
+	newKeyValues, whereAndFieldNameValues, isVersioned := t.versionedUpdate(newKeyValues, t.whereNotDeleted(utils.JSON{
+		"id": id,
+	}))
+	result, err := t.update(auditLogOfRequest(aepr), operation, newKeyValues, whereAndFieldNameValues)
+	_, err = checkOptimisticLock(result, err, isVersioned)
 	if err != nil {
+		if errors.Is(err, ErrOptimisticLock) {
+			aepr.ResponseStatusCode = 409
+		}
 		aepr.Log.Errorf("Error at %s.DoEdit (%s) ", t.NameId, err)
 		return err
 	}
@@ -305,11 +586,9 @@ func (t *DXTable) SoftDelete(aepr *api.DXAPIEndPointRequest) (err error) {
 		return err
 	}
 
-	newFieldValues := utils.JSON{
-		"is_deleted": true,
-	}
+	newFieldValues := t.softDeleteSetKeyValues()
 
-	err = t.DoEdit(aepr, id, newFieldValues)
+	err = t.doEdit(aepr, DXTableAuditOperationDelete, id, newFieldValues)
 	if err != nil {
 		aepr.Log.Errorf("Error at %s.SoftDelete (%s) ", t.NameId, err)
 		return err
@@ -324,76 +603,96 @@ func (t *DXTable) Select(log *log.DXLog, fieldNames *[]string, whereAndFieldName
 		fieldNames = &[]string{"*"}
 	}
 
-	if whereAndFieldNameValues == nil {
-		whereAndFieldNameValues = utils.JSON{
-			"is_deleted": false,
-		}
-		if t.Database.DatabaseType.String() == "sqlserver" {
-			whereAndFieldNameValues["is_deleted"] = 0
-		}
+	whereAndFieldNameValues, err = t.toColumns(t.whereNotDeleted(whereAndFieldNameValues))
+	if err != nil {
+		return nil, err
 	}
 
-	r, err = t.Database.Select(t.ListViewNameId, *fieldNames,
-		whereAndFieldNameValues, orderbyFieldNameDirections, limit)
+	r, err = t.Database.SelectContext(contextOf(log), t.ListViewNameId, Manager.NamingStrategy.ToColumnNames(*fieldNames),
+		whereAndFieldNameValues, Manager.NamingStrategy.ToColumnDirections(orderbyFieldNameDirections), limit)
 	if err != nil {
 		return nil, err
 	}
 
-	return r, err
+	return t.fromColumnsOfRows(r), err
 }
 
 func (t *DXTable) SelectOneMustExist(log *log.DXLog, whereAndFieldNameValues utils.JSON,
 	orderbyFieldNameDirections map[string]string) (r utils.JSON, err error) {
 
-	if whereAndFieldNameValues == nil {
-		whereAndFieldNameValues = utils.JSON{}
+	whereAndFieldNameValues, err = t.toColumns(t.whereNotDeleted(whereAndFieldNameValues))
+	if err != nil {
+		return nil, err
 	}
-	whereAndFieldNameValues["is_deleted"] = false
 
-	return t.Database.SelectOneMustExist(t.ListViewNameId,
-		whereAndFieldNameValues, orderbyFieldNameDirections)
+	r, err = t.Database.SelectOneMustExistContext(contextOf(log), t.ListViewNameId,
+		whereAndFieldNameValues, Manager.NamingStrategy.ToColumnDirections(orderbyFieldNameDirections))
+	return t.fromColumns(r), err
 }
 
 func (t *DXTable) TxSelectOneMustExist(log *log.DXLog, tx *databases.DXDatabaseTx, whereAndFieldNameValues utils.JSON,
 	orderbyFieldNameDirections map[string]string) (r utils.JSON, err error) {
 
-	if whereAndFieldNameValues == nil {
-		whereAndFieldNameValues = utils.JSON{}
+	whereAndFieldNameValues, err = t.toColumns(t.whereNotDeleted(whereAndFieldNameValues))
+	if err != nil {
+		return nil, err
 	}
-	whereAndFieldNameValues["is_deleted"] = false
 
-	return tx.SelectOneMustExist(log, t.ListViewNameId, nil, whereAndFieldNameValues, nil, orderbyFieldNameDirections, nil)
+	r, err = tx.SelectOneMustExist(log, t.ListViewNameId, nil, whereAndFieldNameValues, nil, Manager.NamingStrategy.ToColumnDirections(orderbyFieldNameDirections), nil)
+	return t.fromColumns(r), err
 }
 
 func (t *DXTable) TxSelectOne(log *log.DXLog, tx *databases.DXDatabaseTx, whereAndFieldNameValues utils.JSON,
 	orderbyFieldNameDirections map[string]string) (r utils.JSON, err error) {
 
-	if whereAndFieldNameValues == nil {
-		whereAndFieldNameValues = utils.JSON{}
+	whereAndFieldNameValues, err = t.toColumns(t.whereNotDeleted(whereAndFieldNameValues))
+	if err != nil {
+		return nil, err
 	}
-	whereAndFieldNameValues["is_deleted"] = false
 
-	return tx.SelectOne(log, t.ListViewNameId, nil, whereAndFieldNameValues, nil, orderbyFieldNameDirections, false)
+	r, err = tx.SelectOne(log, t.ListViewNameId, nil, whereAndFieldNameValues, nil, Manager.NamingStrategy.ToColumnDirections(orderbyFieldNameDirections), false)
+	return t.fromColumns(r), err
 }
 
 func (t *DXTable) TxSelectOneForUpdate(log *log.DXLog, tx *databases.DXDatabaseTx, whereAndFieldNameValues utils.JSON,
 	orderbyFieldNameDirections map[string]string) (r utils.JSON, err error) {
 
-	if whereAndFieldNameValues == nil {
-		whereAndFieldNameValues = utils.JSON{}
+	whereAndFieldNameValues, err = t.toColumns(t.whereNotDeleted(whereAndFieldNameValues))
+	if err != nil {
+		return nil, err
 	}
-	whereAndFieldNameValues["is_deleted"] = false
 
-	return tx.SelectOne(log, t.ListViewNameId, nil, whereAndFieldNameValues, nil, orderbyFieldNameDirections, true)
+	r, err = tx.SelectOne(log, t.ListViewNameId, nil, whereAndFieldNameValues, nil, Manager.NamingStrategy.ToColumnDirections(orderbyFieldNameDirections), true)
+	return t.fromColumns(r), err
 }
 
 func (t *DXTable) TxUpdate(log *log.DXLog, tx *databases.DXDatabaseTx, setKeyValues utils.JSON, whereAndFieldNameValues utils.JSON) (result utils.JSON, err error) {
-	if whereAndFieldNameValues == nil {
-		whereAndFieldNameValues = utils.JSON{}
+	whereAndFieldNameValues = t.whereNotDeleted(whereAndFieldNameValues)
+	setKeyValues, whereAndFieldNameValues, isVersioned := t.versionedUpdate(t.updateTimestamps(setKeyValues), whereAndFieldNameValues)
+	setKeyValues, err = t.toColumns(setKeyValues)
+	if err != nil {
+		return nil, err
+	}
+	whereAndFieldNameValues, err = t.toColumns(whereAndFieldNameValues)
+	if err != nil {
+		return nil, err
 	}
-	whereAndFieldNameValues["is_deleted"] = false
 
-	return tx.UpdateOne(log, t.ListViewNameId, setKeyValues, whereAndFieldNameValues)
+	var before utils.JSON
+	if t.OnAudit != nil {
+		before, err = tx.SelectOne(log, t.NameId, nil, whereAndFieldNameValues, nil, nil, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	result, err = tx.UpdateOne(log, t.ListViewNameId, setKeyValues, whereAndFieldNameValues)
+	if err == nil && isVersioned && result == nil {
+		return nil, ErrOptimisticLock
+	}
+	if err == nil && t.OnAudit != nil && result != nil {
+		err = t.audit(auditLog(log), tx, DXTableAuditOperationUpdate, result["id"], before, result)
+	}
+	return t.fromColumns(result), err
 }
 
 func (t *DXTable) List(aepr *api.DXAPIEndPointRequest) (err error) {
@@ -421,6 +720,14 @@ func (t *DXTable) List(aepr *api.DXAPIEndPointRequest) (err error) {
 		filterKeyValues = nil
 	}
 
+	if t.AllowedColumns != nil {
+		filterWhere, filterOrderBy, filterKeyValues, err = t.allowedFilters(filterWhere, filterOrderBy, filterKeyValues)
+		if err != nil {
+			aepr.Log.Warnf("Refused filter at table %s list (%v)", t.NameId, err)
+			return aepr.WriteError(http.StatusUnprocessableEntity, api.DXAPIErrorCodeValidationFailed, err.Error(), nil)
+		}
+	}
+
 	_, rowPerPage, err := aepr.GetParameterValueAsInt64("row_per_page")
 	if err != nil {
 		return err
@@ -436,16 +743,16 @@ func (t *DXTable) List(aepr *api.DXAPIEndPointRequest) (err error) {
 		return err
 	}
 
-	if !isDeletedIncluded {
+	if !isDeletedIncluded && !t.isWithTrashed {
 		if filterWhere != "" {
 			filterWhere = fmt.Sprintf("(%s) and ", filterWhere)
 		}
 
-		switch t.Database.DatabaseType.String() {
-		case "sqlserver":
+		switch {
+		case t.FieldNameForDeletedAt != "":
+			filterWhere = filterWhere + "(" + t.FieldNameForDeletedAt + " is null)"
+		case t.Database.DatabaseType.String() == "sqlserver":
 			filterWhere = filterWhere + "(is_deleted=0)"
-		case "postgres":
-			filterWhere = filterWhere + "(is_deleted=false)"
 		default:
 			filterWhere = filterWhere + "(is_deleted=false)"
 		}
@@ -459,7 +766,7 @@ func (t *DXTable) List(aepr *api.DXAPIEndPointRequest) (err error) {
 		}
 	}
 
-	list, totalRows, totalPage, _, err := db.NamedQueryPaging(t.Database.Connection, "", rowPerPage, pageIndex, "*", t.ListViewNameId,
+	list, totalRows, totalPage, _, err := db.NamedQueryPagingExt(aepr.Context, t.Database.Connection, "", rowPerPage, pageIndex, "*", t.ListViewNameId,
 		filterWhere, "", filterOrderBy, filterKeyValues)
 	if err != nil {
 		aepr.Log.Errorf("Error at paging table %s (%s) ", t.NameId, err)
@@ -468,7 +775,7 @@ func (t *DXTable) List(aepr *api.DXAPIEndPointRequest) (err error) {
 
 	data := utils.JSON{
 		"list": utils.JSON{
-			"rows":       list,
+			"rows":       t.fromColumnsOfRows(list),
 			"total_rows": totalRows,
 			"total_page": totalPage,
 		},
@@ -478,14 +785,33 @@ func (t *DXTable) List(aepr *api.DXAPIEndPointRequest) (err error) {
 	return err
 }
 
+// allowedFilters checks the client filters of List against AllowedColumns and gives them rewritten on the formatted
+// columns.
+func (t *DXTable) allowedFilters(filterWhere string, filterOrderBy string, filterKeyValues utils.JSON) (where string, orderBy string, args utils.JSON, err error) {
+	if filterWhere != `` {
+		return ``, ``, nil, errors.New("FilterWhereNotAllowed")
+	}
+	driverName := t.Database.DatabaseType.String()
+	orderBy, err = t.AllowedColumns.OrderBy(driverName, t.Database.IdentifierCase, filterOrderBy)
+	if err != nil {
+		return ``, ``, nil, err
+	}
+	where, args, err = t.AllowedColumns.Where(driverName, t.Database.IdentifierCase, filterKeyValues)
+	if err != nil {
+		return ``, ``, nil, err
+	}
+	return where, orderBy, args, nil
+}
+
 func (t *DXTable) SelectOne(log *log.DXLog, whereAndFieldNameValues utils.JSON, orderbyFieldNameDirections map[string]string) (r utils.JSON, err error) {
 
-	if whereAndFieldNameValues == nil {
-		whereAndFieldNameValues = utils.JSON{}
+	whereAndFieldNameValues, err = t.toColumns(t.whereNotDeleted(whereAndFieldNameValues))
+	if err != nil {
+		return nil, err
 	}
-	whereAndFieldNameValues["is_deleted"] = false
 
-	return t.Database.SelectOne(t.ListViewNameId, nil, whereAndFieldNameValues, nil, orderbyFieldNameDirections)
+	r, err = t.Database.SelectOneContext(contextOf(log), t.ListViewNameId, nil, whereAndFieldNameValues, nil, Manager.NamingStrategy.ToColumnDirections(orderbyFieldNameDirections))
+	return t.fromColumns(r), err
 }
 
 var Manager DXTableManager
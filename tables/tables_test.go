@@ -0,0 +1,280 @@
+package tables
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+
+	"dxlib/v3/databases"
+	"dxlib/v3/databases/database_type"
+	"dxlib/v3/databases/protected/db"
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+)
+
+// newTestTable gives the table nameId of a SQLite database made by statements, the database passes for PostgreSQL
+// so the tables write the postgres dialect SQLite also speaks.
+func newTestTable(t *testing.T, nameId string, statements ...string) *DXTable {
+	t.Helper()
+	sqlDB, err := sql.Open(`sqlite`, filepath.Join(t.TempDir(), `test.db`))
+	require.NoError(t, err)
+	connection := sqlx.NewDb(sqlDB, `postgres`)
+	// one connection, so the transactions see the tables made below
+	connection.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		_ = connection.Close()
+	})
+	for _, s := range statements {
+		_, err = connection.Exec(s)
+		require.NoError(t, err)
+	}
+	return &DXTable{NameId: nameId, ListViewNameId: nameId, Database: &databases.DXDatabase{NameId: `test`,
+		DatabaseType: database_type.PostgreSQL, Connection: connection, Connected: true}}
+}
+
+func TestSoftDeletedRowsAreExcludedByDefault(t *testing.T) {
+	table := newTestTable(t, `users`, `CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, deleted_at TEXT)`)
+	table.FieldNameForDeletedAt = `deleted_at`
+	for _, name := range []string{`alice`, `bob`} {
+		_, err := table.Database.InsertRowsAffected(`users`, utils.JSON{`name`: name})
+		require.NoError(t, err)
+	}
+
+	_, err := table.Delete(nil, 1)
+	require.NoError(t, err)
+	deletedAt, err := table.Database.Connection.QueryRowx(`SELECT deleted_at FROM users WHERE id = 1`).SliceScan()
+	require.NoError(t, err)
+	assert.NotNil(t, deletedAt[0], `Delete sets deleted_at and keeps the row`)
+
+	rows, err := table.Select(nil, nil, nil, map[string]string{`id`: `asc`}, nil)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, `bob`, rows[0][`name`])
+	_, err = table.GetById(nil, 1)
+	assert.Error(t, err)
+
+	rows, err = table.WithTrashed().Select(nil, nil, nil, map[string]string{`id`: `asc`}, nil)
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, `alice`, rows[0][`name`])
+	r, err := table.WithTrashed().GetById(nil, 1)
+	require.NoError(t, err)
+	assert.Equal(t, `alice`, r[`name`])
+
+	_, err = table.ForceDelete(nil, 1)
+	require.NoError(t, err)
+	rows, err = table.WithTrashed().Select(nil, nil, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, rows, 1)
+}
+
+func TestWhereNotDeletedKeepsTheMapOfTheCaller(t *testing.T) {
+	where := utils.JSON{`id`: 1}
+	table := &DXTable{NameId: `t`}
+	r := table.whereNotDeleted(where)
+	assert.Equal(t, utils.JSON{`id`: 1, `is_deleted`: false}, r)
+	assert.Equal(t, utils.JSON{`id`: 1}, where)
+
+	table.FieldNameForDeletedAt = `deleted_at`
+	r = table.whereNotDeleted(where)
+	assert.Equal(t, utils.JSON{`id`: 1, `deleted_at`: nil}, r)
+	assert.Equal(t, utils.JSON{`id`: 1}, where)
+
+	assert.Equal(t, utils.JSON{`id`: 1}, table.WithTrashed().whereNotDeleted(where))
+}
+
+func TestUpdateTimestampsNamesTheColumnAsTheNamingStrategySays(t *testing.T) {
+	namingStrategy := Manager.NamingStrategy
+	defer func() {
+		Manager.NamingStrategy = namingStrategy
+	}()
+	Manager.NamingStrategy = db.NamingStrategySnake
+	table := &DXTable{NameId: `t`, FieldNameForUpdatedAt: `updatedAt`, Database: &databases.DXDatabase{
+		DatabaseType:   database_type.PostgreSQL,
+		IdentifierCase: db.IdentifierCasePreserve,
+	}}
+	set := utils.JSON{`name`: `a`}
+	r := table.updateTimestamps(set)
+	assert.Equal(t, utils.JSON{`name`: `a`, `updatedAt`: db.SQLExpression{Expression: `"updated_at"=CURRENT_TIMESTAMP`}}, r)
+	assert.Equal(t, utils.JSON{`name`: `a`}, set)
+
+	table.Database.DatabaseType = database_type.MySQL
+	r = table.updateTimestamps(set)
+	assert.Equal(t, db.SQLExpression{Expression: "`updated_at`=CURRENT_TIMESTAMP"}, r[`updatedAt`])
+
+	r = table.updateTimestamps(utils.JSON{`updatedAt`: `2020-01-01`})
+	assert.Equal(t, utils.JSON{`updatedAt`: `2020-01-01`}, r)
+}
+
+func TestStaleUpdateIsAnOptimisticLock(t *testing.T) {
+	table := newTestTable(t, `users`, `CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, version INTEGER NOT NULL, is_deleted BOOLEAN NOT NULL DEFAULT false)`)
+	table.FieldNameForVersion = `version`
+	_, err := table.Database.InsertRowsAffected(`users`, utils.JSON{`name`: `alice`, `version`: 1})
+	require.NoError(t, err)
+
+	// two editors read version 1, the first update wins and the second is stale
+	_, err = table.UpdateOne(nil, 1, utils.JSON{`name`: `bob`, `version`: int64(1)})
+	require.NoError(t, err)
+	_, err = table.UpdateOne(nil, 1, utils.JSON{`name`: `carol`, `version`: int64(1)})
+	assert.ErrorIs(t, err, ErrOptimisticLock)
+	_, err = table.Update(nil, utils.JSON{`name`: `carol`, `version`: int64(1)}, utils.JSON{`id`: 1})
+	assert.ErrorIs(t, err, ErrOptimisticLock)
+
+	r, err := table.GetById(nil, 1)
+	require.NoError(t, err)
+	assert.Equal(t, `bob`, r[`name`])
+	assert.EqualValues(t, 2, r[`version`])
+
+	// reloaded, the retry is at the current version
+	_, err = table.UpdateOne(nil, 1, utils.JSON{`name`: `carol`, `version`: r[`version`]})
+	require.NoError(t, err)
+	r, err = table.GetById(nil, 1)
+	require.NoError(t, err)
+	assert.Equal(t, `carol`, r[`name`])
+	assert.EqualValues(t, 3, r[`version`])
+}
+
+func TestStaleTxUpdateIsAnOptimisticLock(t *testing.T) {
+	table := newTestTable(t, `users`, `CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, version INTEGER NOT NULL, is_deleted BOOLEAN NOT NULL DEFAULT false)`)
+	table.FieldNameForVersion = `version`
+	_, err := table.Database.InsertRowsAffected(`users`, utils.JSON{`name`: `alice`, `version`: 2})
+	require.NoError(t, err)
+
+	err = table.Database.Tx(&log.Log, databases.LevelReadCommitted, func(l *log.DXLog, dtx *databases.DXDatabaseTx) (err error) {
+		_, err = table.TxUpdate(l, dtx, utils.JSON{`name`: `bob`, `version`: int64(1)}, utils.JSON{`id`: 1})
+		return err
+	})
+	assert.ErrorIs(t, err, ErrOptimisticLock)
+	r, err := table.GetById(nil, 1)
+	require.NoError(t, err)
+	assert.Equal(t, `alice`, r[`name`])
+}
+
+const testAuditLogTable = `CREATE TABLE audit_log (id INTEGER PRIMARY KEY, table_name TEXT, operation TEXT, row_id INTEGER,
+	before_values TEXT, after_values TEXT, actor_id TEXT, created_at TEXT)`
+
+// countTestRows gives the rows of tableName.
+func countTestRows(t *testing.T, table *DXTable, tableName string) (n int) {
+	t.Helper()
+	require.NoError(t, table.Database.Connection.Get(&n, `SELECT COUNT(*) FROM `+tableName))
+	return n
+}
+
+func TestAuditRowIsWrittenWithTheChange(t *testing.T) {
+	table := newTestTable(t, `users`, `CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, is_deleted BOOLEAN NOT NULL DEFAULT false)`,
+		testAuditLogTable)
+	table.OnAudit = NewAuditLogHook(``)
+	l := log.NewLog(&log.Log, ContextWithAuditActorId(context.Background(), `42`), `test`)
+
+	id, err := table.insert(&l, utils.JSON{`name`: `alice`})
+	require.NoError(t, err)
+
+	var audits []struct {
+		Operation    string  `db:"operation"`
+		RowId        int64   `db:"row_id"`
+		BeforeValues *string `db:"before_values"`
+		AfterValues  *string `db:"after_values"`
+		ActorId      string  `db:"actor_id"`
+	}
+	require.NoError(t, table.Database.Connection.Select(&audits, `SELECT operation, row_id, before_values, after_values, actor_id FROM audit_log ORDER BY id`))
+	require.Len(t, audits, 1)
+	assert.Equal(t, `INSERT`, audits[0].Operation)
+	assert.Equal(t, id, audits[0].RowId)
+	assert.Equal(t, `42`, audits[0].ActorId)
+	require.NotNil(t, audits[0].AfterValues)
+	assert.JSONEq(t, `{"id":1,"name":"alice"}`, *audits[0].AfterValues)
+	// an insert has no before, written as the JSON null
+	require.NotNil(t, audits[0].BeforeValues)
+	assert.JSONEq(t, `null`, *audits[0].BeforeValues)
+}
+
+func TestAuditRowRollsBackWithTheChange(t *testing.T) {
+	table := newTestTable(t, `users`, `CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, is_deleted BOOLEAN NOT NULL DEFAULT false)`,
+		testAuditLogTable)
+	table.OnAudit = NewAuditLogHook(``)
+
+	// the change fails after its audit row was written
+	errFailed := errors.New(`failed`)
+	err := table.Database.Tx(&log.Log, databases.LevelReadCommitted, func(l *log.DXLog, dtx *databases.DXDatabaseTx) (err error) {
+		_, err = table.txInsert(l, dtx, utils.JSON{`name`: `alice`})
+		require.NoError(t, err)
+		n := 0
+		require.NoError(t, dtx.Tx.Get(&n, `SELECT COUNT(*) FROM audit_log`))
+		assert.Equal(t, 1, n)
+		return errFailed
+	})
+	assert.ErrorIs(t, err, errFailed)
+	assert.Equal(t, 0, countTestRows(t, table, `users`))
+	assert.Equal(t, 0, countTestRows(t, table, `audit_log`))
+
+	// the audit fails after the change was written
+	table.OnAudit = func(l *log.DXLog, dtx *databases.DXDatabaseTx, event DXTableAuditEvent) (err error) {
+		err = NewAuditLogHook(``)(l, dtx, event)
+		require.NoError(t, err)
+		return errFailed
+	}
+	_, err = table.insert(nil, utils.JSON{`name`: `alice`})
+	assert.ErrorIs(t, err, errFailed)
+	assert.Equal(t, 0, countTestRows(t, table, `users`))
+	assert.Equal(t, 0, countTestRows(t, table, `audit_log`))
+}
+
+// setTestNamingStrategy sets Manager.NamingStrategy to n until the end of the test.
+func setTestNamingStrategy(t *testing.T, n db.DXNamingStrategy) {
+	t.Helper()
+	namingStrategy := Manager.NamingStrategy
+	Manager.NamingStrategy = n
+	t.Cleanup(func() {
+		Manager.NamingStrategy = namingStrategy
+	})
+}
+
+func TestVersionedUpdateNamesTheColumnAsTheNamingStrategySays(t *testing.T) {
+	setTestNamingStrategy(t, db.NamingStrategySnake)
+	table := &DXTable{NameId: `t`, FieldNameForVersion: `rowVersion`, Database: &databases.DXDatabase{
+		DatabaseType:   database_type.PostgreSQL,
+		IdentifierCase: db.IdentifierCasePreserve,
+	}}
+
+	set, where, isVersioned := table.versionedUpdate(utils.JSON{`firstName`: `bob`, `rowVersion`: int64(1)}, utils.JSON{`id`: 1})
+	assert.True(t, isVersioned)
+	assert.Equal(t, utils.JSON{`firstName`: `bob`, `rowVersion`: db.SQLExpression{Expression: `"row_version"="row_version"+1`}}, set)
+	assert.Equal(t, utils.JSON{`id`: 1, `rowVersion`: int64(1)}, where)
+}
+
+func TestFieldNamesRoundTripThroughTheSnakeCaseColumns(t *testing.T) {
+	setTestNamingStrategy(t, db.NamingStrategySnake)
+	table := newTestTable(t, `users`, `CREATE TABLE users (id INTEGER PRIMARY KEY, first_name TEXT, last_name TEXT,
+		row_version INTEGER NOT NULL, is_deleted BOOLEAN NOT NULL DEFAULT false)`)
+	table.FieldNameForVersion = `rowVersion`
+
+	id, err := table.insert(nil, utils.JSON{`firstName`: `alice`, `lastName`: `smith`, `rowVersion`: 1, `isDeleted`: false})
+	require.NoError(t, err)
+	var firstName string
+	require.NoError(t, table.Database.Connection.Get(&firstName, `SELECT first_name FROM users WHERE id = 1`))
+	assert.Equal(t, `alice`, firstName)
+
+	r, err := table.GetById(nil, id)
+	require.NoError(t, err)
+	assert.Equal(t, `alice`, r[`firstName`])
+	assert.Equal(t, `smith`, r[`lastName`])
+	assert.EqualValues(t, 1, r[`rowVersion`])
+	assert.NotContains(t, r, `first_name`)
+
+	_, err = table.UpdateOne(nil, id, utils.JSON{`firstName`: `bob`, `rowVersion`: r[`rowVersion`]})
+	require.NoError(t, err)
+	_, err = table.UpdateOne(nil, id, utils.JSON{`firstName`: `carol`, `rowVersion`: r[`rowVersion`]})
+	assert.ErrorIs(t, err, ErrOptimisticLock)
+	rows, err := table.Select(nil, nil, utils.JSON{`last_name`: `smith`}, map[string]string{`firstName`: `asc`}, nil)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, `bob`, rows[0][`firstName`])
+	assert.EqualValues(t, 2, rows[0][`rowVersion`])
+}
@@ -0,0 +1,192 @@
+package tasks
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"dxlib/v3/databases"
+	"dxlib/v3/databases/protected/db"
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+)
+
+const (
+	DXTaskHistoryDefaultTableName = "task_runs"
+
+	DXTaskRunStatusSuccess = "success"
+	DXTaskRunStatusFailed  = "failed"
+	DXTaskRunStatusPanic   = "panic"
+)
+
+type DXTaskRun struct {
+	Id           int64     `db:"id" json:"id"`
+	TaskName     string    `db:"task_name" json:"task_name"`
+	StartTime    time.Time `db:"start_time" json:"start_time"`
+	EndTime      time.Time `db:"end_time" json:"end_time"`
+	Status       string    `db:"status" json:"status"`
+	ErrorMessage string    `db:"error_message" json:"error_message"`
+	Attempt      int64     `db:"attempt" json:"attempt"`
+}
+
+// DXTaskHistory records every execution of the tasks into TableName of the database DatabaseNameId. Attempt is 1 for
+// the first execution and after a success, and counts up while the executions keep failing.
+type DXTaskHistory struct {
+	DatabaseNameId string
+	TableName      string
+}
+
+// applyHistoryConfiguration reads history_enabled, history_database and history_table of the tasks configuration, and
+// creates the table when it does not exist yet.
+func (am *DXTaskManager) applyHistoryConfiguration(c utils.JSON) (err error) {
+	isEnabled, _ := c[`history_enabled`].(bool)
+	if !isEnabled || am.History != nil {
+		return nil
+	}
+	databaseNameId, _ := c[`history_database`].(string)
+	if databaseNameId == `` {
+		err = log.Log.ErrorAndCreateErrorf("configuration is unusable, history_database of tasks is mandatory when history_enabled")
+		return err
+	}
+	tableName, _ := c[`history_table`].(string)
+	if tableName == `` {
+		tableName = DXTaskHistoryDefaultTableName
+	}
+	h := &DXTaskHistory{
+		DatabaseNameId: databaseNameId,
+		TableName:      tableName,
+	}
+	err = h.CreateTableIfNotExist()
+	if err != nil {
+		return err
+	}
+	am.History = h
+	return nil
+}
+
+func (h *DXTaskHistory) database() (d *databases.DXDatabase, err error) {
+	d, ok := databases.Manager.Databases[h.DatabaseNameId]
+	if !ok {
+		err = log.Log.ErrorAndCreateErrorf("Database %s of the task history not found", h.DatabaseNameId)
+		return nil, err
+	}
+	return d, nil
+}
+
+func (h *DXTaskHistory) CreateTableIfNotExist() (err error) {
+	d, err := h.database()
+	if err != nil {
+		return err
+	}
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return err
+	}
+	driverName := d.Connection.DriverName()
+	t := db.FormatIdentifier(driverName, d.IdentifierCase, h.TableName)
+	s := ``
+	switch driverName {
+	case "postgres":
+		s = `CREATE TABLE IF NOT EXISTS ` + t + ` (id BIGSERIAL PRIMARY KEY, task_name VARCHAR(255) NOT NULL, ` +
+			`start_time TIMESTAMPTZ NOT NULL, end_time TIMESTAMPTZ NOT NULL, status VARCHAR(16) NOT NULL, ` +
+			`error_message TEXT NOT NULL, attempt BIGINT NOT NULL)`
+	case "mysql":
+		s = `CREATE TABLE IF NOT EXISTS ` + t + ` (id BIGINT AUTO_INCREMENT PRIMARY KEY, task_name VARCHAR(255) NOT NULL, ` +
+			`start_time DATETIME(6) NOT NULL, end_time DATETIME(6) NOT NULL, status VARCHAR(16) NOT NULL, ` +
+			`error_message TEXT NOT NULL, attempt BIGINT NOT NULL)`
+	case "sqlserver":
+		s = `IF OBJECT_ID(N'` + h.TableName + `', N'U') IS NULL CREATE TABLE ` + t + ` (id BIGINT IDENTITY(1,1) PRIMARY KEY, ` +
+			`task_name NVARCHAR(255) NOT NULL, start_time DATETIMEOFFSET NOT NULL, end_time DATETIMEOFFSET NOT NULL, ` +
+			`status NVARCHAR(16) NOT NULL, error_message NVARCHAR(MAX) NOT NULL, attempt BIGINT NOT NULL)`
+	default:
+		err = log.Log.ErrorAndCreateErrorf("Task history is not supported for database type %s of database %s", driverName, d.NameId)
+		return err
+	}
+	_, err = d.Connection.Exec(s)
+	if err != nil {
+		log.Log.Errorf("Cannot create task history table %s in database %s (%v)", h.TableName, d.NameId, err)
+		return err
+	}
+	return nil
+}
+
+// Record inserts a run, the error of the execution gives its status.
+func (h *DXTaskHistory) Record(taskNameId string, startTime time.Time, endTime time.Time, attempt int64, errExecute error) (err error) {
+	d, err := h.database()
+	if err != nil {
+		return err
+	}
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return err
+	}
+	t := db.FormatIdentifier(d.Connection.DriverName(), d.IdentifierCase, h.TableName)
+	status := DXTaskRunStatusSuccess
+	errorMessage := ``
+	if errExecute != nil {
+		status = DXTaskRunStatusFailed
+		var panicErr *DXTaskPanicError
+		if errors.As(errExecute, &panicErr) {
+			status = DXTaskRunStatusPanic
+		}
+		errorMessage = errExecute.Error()
+	}
+	_, err = d.InsertRowsAffected(t, utils.JSON{
+		`task_name`:     taskNameId,
+		`start_time`:    startTime,
+		`end_time`:      endTime,
+		`status`:        status,
+		`error_message`: errorMessage,
+		`attempt`:       attempt,
+	})
+	return err
+}
+
+// LastRuns gives the last n runs of the task taskNameId, the latest first.
+func (h *DXTaskHistory) LastRuns(taskNameId string, n int) (r []DXTaskRun, err error) {
+	if n <= 0 {
+		return []DXTaskRun{}, nil
+	}
+	d, err := h.database()
+	if err != nil {
+		return nil, err
+	}
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return nil, err
+	}
+	driverName := d.Connection.DriverName()
+	t := db.FormatIdentifier(driverName, d.IdentifierCase, h.TableName)
+	fields := `id, task_name, start_time, end_time, status, error_message, attempt`
+	where := ` from ` + t + ` where task_name = :task_name order by start_time desc, id desc`
+	s := `select ` + fields + where + ` limit ` + strconv.Itoa(n)
+	if db.DriverCapabilities(driverName).IsLimitByTop {
+		s = `select top ` + strconv.Itoa(n) + ` ` + fields + where
+	}
+	return databases.SelectStructs[DXTaskRun](d, s, utils.JSON{`task_name`: taskNameId})
+}
+
+// LastRuns is DXTaskHistory.LastRuns, it fails when the history is not enabled.
+func (am *DXTaskManager) LastRuns(taskNameId string, n int) (r []DXTaskRun, err error) {
+	if am.History == nil {
+		err = log.Log.ErrorAndCreateErrorf("Task history is not enabled, set history_enabled in the tasks configuration")
+		return nil, err
+	}
+	return am.History.LastRuns(taskNameId, n)
+}
+
+func (am *DXTaskManager) recordRun(a *DXTask, startTime time.Time, errExecute error) {
+	if am.History == nil {
+		return
+	}
+	attempt := a.consecutiveFailures + 1
+	if errExecute != nil {
+		a.consecutiveFailures++
+	} else {
+		a.consecutiveFailures = 0
+	}
+	err := am.History.Record(a.NameId, startTime, time.Now(), attempt, errExecute)
+	if err != nil {
+		log.Log.Warnf("Cannot record the run of task %s in the history (%v)", a.NameId, err)
+	}
+}
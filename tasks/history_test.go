@@ -0,0 +1,94 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+
+	"dxlib/v3/databases"
+	"dxlib/v3/utils"
+)
+
+// newTestHistoryDatabase defines the database nameId of databases.Manager on a sqlite file under the postgres driver
+// name, with the task_runs table already created in the types of sqlite, removed at the end of the test.
+func newTestHistoryDatabase(t *testing.T, nameId string) {
+	t.Helper()
+	sqlDB, err := sql.Open(`sqlite`, filepath.Join(t.TempDir(), nameId+`.db`))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = sqlDB.Close()
+	})
+	connection := sqlx.NewDb(sqlDB, `postgres`)
+	_, err = connection.Exec(`CREATE TABLE "task_runs" (id INTEGER PRIMARY KEY AUTOINCREMENT, task_name TEXT NOT NULL,
+		start_time TIMESTAMP NOT NULL, end_time TIMESTAMP NOT NULL, status TEXT NOT NULL, error_message TEXT NOT NULL,
+		attempt INTEGER NOT NULL)`)
+	require.NoError(t, err)
+	d := databases.Manager.NewDatabase(nameId, false, false)
+	d.Connection = connection
+	d.Connected = true
+	t.Cleanup(func() {
+		delete(databases.Manager.Databases, nameId)
+	})
+}
+
+func TestTaskRunsAreRecorded(t *testing.T) {
+	captureTestLog(t)
+	newTestHistoryDatabase(t, `test_history`)
+	setTestTasksConfiguration(t, utils.JSON{`history_enabled`: true, `history_database`: `test_history`})
+	am := &DXTaskManager{Tasks: map[string]*DXTask{}, Context: context.Background()}
+	errReport := errors.New(`report failed`)
+	runs := 0
+	_, err := am.NewTask(`report`, `always`, 0, func(task *DXTask) error {
+		runs++
+		if runs == 1 {
+			return nil
+		}
+		return errReport
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, am.RunOnce(context.Background(), `report`))
+	assert.ErrorIs(t, am.RunOnce(context.Background(), `report`), errReport)
+	assert.ErrorIs(t, am.RunOnce(context.Background(), `report`), errReport)
+
+	r, err := am.LastRuns(`report`, 10)
+	require.NoError(t, err)
+	require.Len(t, r, 3)
+	assert.Equal(t, DXTaskRunStatusFailed, r[0].Status)
+	assert.Equal(t, `report failed`, r[0].ErrorMessage)
+	assert.Equal(t, int64(2), r[0].Attempt)
+	assert.Equal(t, DXTaskRunStatusFailed, r[1].Status)
+	assert.Equal(t, int64(1), r[1].Attempt)
+	assert.Equal(t, DXTaskRunStatusSuccess, r[2].Status)
+	assert.Empty(t, r[2].ErrorMessage)
+	assert.Equal(t, int64(1), r[2].Attempt)
+	for _, v := range r {
+		assert.Equal(t, `report`, v.TaskName)
+		assert.False(t, v.EndTime.Before(v.StartTime))
+	}
+
+	r, err = am.LastRuns(`report`, 1)
+	require.NoError(t, err)
+	assert.Len(t, r, 1)
+	r, err = am.LastRuns(`other`, 10)
+	require.NoError(t, err)
+	assert.Empty(t, r)
+}
+
+func TestLastRunsWithoutHistory(t *testing.T) {
+	captureTestLog(t)
+	am := &DXTaskManager{}
+	_, err := am.LastRuns(`report`, 10)
+	assert.ErrorContains(t, err, `history_enabled`)
+
+	err = am.applyHistoryConfiguration(utils.JSON{`history_enabled`: true})
+	assert.ErrorContains(t, err, `history_database`)
+	assert.Nil(t, am.History)
+}
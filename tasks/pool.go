@@ -0,0 +1,119 @@
+package tasks
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const DXTaskWorkerPoolDefaultAgingSec = 10
+
+type taskWorkerPoolWaiter struct {
+	priority int64
+	queuedAt time.Time
+	granted  chan struct{}
+}
+
+// DXTaskWorkerPool bounds the concurrent task executions. A free worker goes to the waiter with the highest priority,
+// where every AgingSec of waiting adds one to the priority so the low priority tasks are not starved.
+type DXTaskWorkerPool struct {
+	MaxConcurrency int
+	AgingSec       int64
+	mutex          sync.Mutex
+	activeWorkers  int
+	waiters        []*taskWorkerPoolWaiter
+}
+
+func NewTaskWorkerPool(maxConcurrency int, agingSec int64) *DXTaskWorkerPool {
+	if agingSec <= 0 {
+		agingSec = DXTaskWorkerPoolDefaultAgingSec
+	}
+	return &DXTaskWorkerPool{
+		MaxConcurrency: maxConcurrency,
+		AgingSec:       agingSec,
+		waiters:        []*taskWorkerPoolWaiter{},
+	}
+}
+
+func (p *DXTaskWorkerPool) effectivePriority(w *taskWorkerPoolWaiter, now time.Time) int64 {
+	return w.priority + int64(now.Sub(w.queuedAt).Seconds())/p.AgingSec
+}
+
+// Acquire blocks until a worker is free for priority or ctx is done, a granted worker must be given back with Release.
+func (p *DXTaskWorkerPool) Acquire(ctx context.Context, priority int64) (err error) {
+	p.mutex.Lock()
+	if p.activeWorkers < p.MaxConcurrency && len(p.waiters) == 0 {
+		p.activeWorkers++
+		p.mutex.Unlock()
+		return nil
+	}
+	w := &taskWorkerPoolWaiter{
+		priority: priority,
+		queuedAt: time.Now(),
+		granted:  make(chan struct{}),
+	}
+	p.waiters = append(p.waiters, w)
+	p.mutex.Unlock()
+
+	select {
+	case <-w.granted:
+		return nil
+	case <-ctx.Done():
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		select {
+		case <-w.granted:
+			// granted while being cancelled, pass the worker on
+			p.activeWorkers--
+			p.grant()
+		default:
+			p.removeWaiter(w)
+		}
+		return ctx.Err()
+	}
+}
+
+func (p *DXTaskWorkerPool) Release() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.activeWorkers--
+	p.grant()
+}
+
+// grant must be called with the mutex held.
+func (p *DXTaskWorkerPool) grant() {
+	for p.activeWorkers < p.MaxConcurrency && len(p.waiters) > 0 {
+		now := time.Now()
+		best := 0
+		for i, w := range p.waiters {
+			if p.effectivePriority(w, now) > p.effectivePriority(p.waiters[best], now) {
+				best = i
+			}
+		}
+		w := p.waiters[best]
+		p.removeWaiter(w)
+		p.activeWorkers++
+		close(w.granted)
+	}
+}
+
+func (p *DXTaskWorkerPool) removeWaiter(w *taskWorkerPoolWaiter) {
+	for i, v := range p.waiters {
+		if v == w {
+			p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+func (p *DXTaskWorkerPool) QueueDepth() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return len(p.waiters)
+}
+
+func (p *DXTaskWorkerPool) ActiveWorkers() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.activeWorkers
+}
@@ -0,0 +1,72 @@
+package tasks
+
+import (
+	"context"
+	"time"
+
+	"dxlib/v3/log"
+	"dxlib/v3/redis"
+	"dxlib/v3/utils"
+	"dxlib/v3/utils/json"
+)
+
+const (
+	DXTaskSingletonDefaultRedisNameId = "redis"
+	DXTaskSingletonDefaultTTLSec      = 60
+	DXTaskSingletonKeyPrefix          = "dxlib:task:singleton:"
+)
+
+// applySingletonConfiguration reads singleton_redis of the tasks configuration, the Redis holding the locks of the
+// singleton tasks.
+func (am *DXTaskManager) applySingletonConfiguration(c utils.JSON) {
+	am.SingletonRedisNameId, _ = c[`singleton_redis`].(string)
+	if am.SingletonRedisNameId == `` {
+		am.SingletonRedisNameId = DXTaskSingletonDefaultRedisNameId
+	}
+}
+
+// applySingletonConfiguration reads is_singleton and singleton_ttl_sec of the configuration of the task.
+func (a *DXTask) applySingletonConfiguration(c utils.JSON) {
+	isSingleton, ok := c[`is_singleton`].(bool)
+	if ok {
+		a.IsSingleton = isSingleton
+	}
+	ttlSec, err := json.GetNumber[int64](c, `singleton_ttl_sec`)
+	if err == nil && ttlSec > 0 {
+		a.SingletonTTL = time.Duration(ttlSec) * time.Second
+	}
+}
+
+// acquireSingleton takes the lock of the task for a run, renewed until it is released. isAcquired is false when
+// another instance holds it, or when Redis cannot be reached, then the run is skipped without an error. err is only
+// a Redis that is not configured.
+func (a *DXTask) acquireSingleton(ctx context.Context) (lock *redis.DXRedisLock, isAcquired bool, err error) {
+	redisNameId := a.manager().SingletonRedisNameId
+	if redisNameId == `` {
+		redisNameId = DXTaskSingletonDefaultRedisNameId
+	}
+	r, ok := redis.Manager.Redises[redisNameId]
+	if !ok {
+		err = log.Log.ErrorAndCreateErrorf("Redis %s of the singleton task %s not found", redisNameId, a.NameId)
+		return nil, false, err
+	}
+	if !r.IsAvailable() {
+		log.Log.Warnf("Task %s run skipped, the Redis %s of its singleton lock is not connected", a.NameId, redisNameId)
+		return nil, false, nil
+	}
+	ttl := a.SingletonTTL
+	if ttl <= 0 {
+		ttl = DXTaskSingletonDefaultTTLSec * time.Second
+	}
+	lock, isAcquired, err = r.AcquireLock(ctx, DXTaskSingletonKeyPrefix+a.NameId, ttl)
+	if err != nil {
+		log.Log.Warnf("Task %s run skipped, its singleton lock cannot be acquired (%v)", a.NameId, err)
+		return nil, false, nil
+	}
+	if !isAcquired {
+		log.Log.Infof("Task %s run skipped, its singleton lock is held elsewhere", a.NameId)
+		return nil, false, nil
+	}
+	lock.AutoRenew(ctx)
+	return lock, true, nil
+}
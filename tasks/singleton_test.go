@@ -0,0 +1,87 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dxlib/v3/redis"
+)
+
+// newTestSingletonTask gives the singleton task nameId of a new manager locking in the Redis redisNameId, counting its
+// runs in runs.
+func newTestSingletonTask(redisNameId string, nameId string, runs *int) *DXTask {
+	am := &DXTaskManager{SingletonRedisNameId: redisNameId}
+	return &DXTask{Owner: am, NameId: nameId, IsSingleton: true, OnExecute: func(task *DXTask) error {
+		*runs++
+		return nil
+	}}
+}
+
+// newTestSingletonRedis gives the Redis nameId connected to a miniredis.
+func newTestSingletonRedis(t *testing.T, nameId string) (r *redis.DXRedis, m *miniredis.Miniredis) {
+	t.Helper()
+	m = miniredis.RunT(t)
+	r = redis.Manager.NewRedis(nameId, false, false)
+	r.Address = m.Addr()
+	r.IsConfigured = true
+	require.NoError(t, r.Connect())
+	t.Cleanup(func() {
+		_ = r.Disconnect()
+		delete(redis.Manager.Redises, nameId)
+	})
+	return r, m
+}
+
+func TestSingletonRunsOnOneInstance(t *testing.T) {
+	r, _ := newTestSingletonRedis(t, `test-singleton`)
+	runs := 0
+	a1 := newTestSingletonTask(r.NameId, `singleton`, &runs)
+	a2 := newTestSingletonTask(r.NameId, `singleton`, &runs)
+
+	lock, isAcquired, err := a1.acquireSingleton(context.Background())
+	require.NoError(t, err)
+	require.True(t, isAcquired)
+	require.NoError(t, a2.execute(context.Background()))
+	assert.Equal(t, 0, runs)
+
+	require.NoError(t, lock.Release())
+	require.NoError(t, a2.execute(context.Background()))
+	assert.Equal(t, 1, runs)
+	require.NoError(t, a1.execute(context.Background()))
+	assert.Equal(t, 2, runs)
+}
+
+func TestSingletonSkipsTheRunWhileRedisFails(t *testing.T) {
+	r, m := newTestSingletonRedis(t, `test-singleton-down`)
+	runs := 0
+	a := newTestSingletonTask(r.NameId, `singleton`, &runs)
+
+	m.Close()
+	lock, isAcquired, err := a.acquireSingleton(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, isAcquired)
+	assert.Nil(t, lock)
+	assert.NoError(t, a.execute(context.Background()))
+
+	require.NoError(t, r.Disconnect())
+	lock, isAcquired, err = a.acquireSingleton(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, isAcquired)
+	assert.Nil(t, lock)
+	assert.NoError(t, a.execute(context.Background()))
+	assert.Equal(t, 0, runs)
+}
+
+func TestSingletonFailsWithoutItsRedis(t *testing.T) {
+	runs := 0
+	a := newTestSingletonTask(`test-singleton-absent`, `singleton`, &runs)
+	_, isAcquired, err := a.acquireSingleton(context.Background())
+	assert.Error(t, err)
+	assert.False(t, isAcquired)
+	assert.Error(t, a.execute(context.Background()))
+	assert.Equal(t, 0, runs)
+}
@@ -2,6 +2,9 @@ package tasks
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
 	"time"
 
 	"golang.org/x/sync/errgroup"
@@ -9,6 +12,9 @@ import (
 	"dxlib/v3/configurations"
 	"dxlib/v3/core"
 	"dxlib/v3/log"
+	"dxlib/v3/metrics"
+	"dxlib/v3/subsystems"
+	"dxlib/v3/tracing"
 	"dxlib/v3/utils"
 	"dxlib/v3/utils/json"
 )
@@ -18,14 +24,24 @@ const DXTaskDefaultAfterDelaySec = 1
 type DXTaskOnExecute func(task *DXTask) error
 
 type DXTask struct {
-	NameId          string
-	StartAt         string
-	AfterDelaySec   int64
-	OnExecute       DXTaskOnExecute
+	NameId        string
+	StartAt       string
+	AfterDelaySec int64
+	OnExecute     DXTaskOnExecute
+	Priority      int64
+	// IsFatal false makes an error of the task logged and the task restarted, instead of stopping the whole app
+	IsFatal bool
+	// IsSingleton makes every run take the Redis lock of the task first, the run is skipped while another instance
+	// holds it. SingletonTTL is about the duration of a run, the lock is renewed during a longer one.
+	IsSingleton     bool
+	SingletonTTL    time.Duration
+	Owner           *DXTaskManager
 	Log             log.DXLog
 	RuntimeIsActive bool
 	Context         context.Context
 	Cancel          context.CancelFunc
+
+	consecutiveFailures int64
 }
 
 type DXTaskManager struct {
@@ -34,15 +50,23 @@ type DXTaskManager struct {
 	Tasks             map[string]*DXTask
 	ErrorGroup        *errgroup.Group
 	ErrorGroupContext context.Context
+	// WorkerPool is only set when max_concurrency is configured, otherwise every task runs without limit
+	WorkerPool *DXTaskWorkerPool
+	// History is only set when history_enabled is configured
+	History *DXTaskHistory
+	// SingletonRedisNameId is the Redis holding the locks of the singleton tasks
+	SingletonRedisNameId string
 }
 
 func (am *DXTaskManager) NewTask(nameId string, startAt string, afterDelaySec int64, onExecute DXTaskOnExecute) (*DXTask, error) {
 	ctx, cancel := context.WithCancel(am.Context)
 	a := DXTask{
+		Owner:         am,
 		NameId:        nameId,
 		StartAt:       startAt,
 		AfterDelaySec: afterDelaySec,
 		OnExecute:     onExecute,
+		IsFatal:       true,
 		Context:       ctx,
 		Cancel:        cancel,
 		Log:           log.NewLog(&log.Log, ctx, nameId),
@@ -51,9 +75,41 @@ func (am *DXTaskManager) NewTask(nameId string, startAt string, afterDelaySec in
 	return &a, nil
 }
 
+func (am *DXTaskManager) ApplyConfigurations() (err error) {
+	configuration, ok := configurations.Manager.Get("tasks")
+	if !ok {
+		return nil
+	}
+	c := *configuration.Data
+	err = am.applyHistoryConfiguration(c)
+	if err != nil {
+		return err
+	}
+	am.applySingletonConfiguration(c)
+	maxConcurrency, err := json.GetNumber[int](c, `max_concurrency`)
+	if err != nil || maxConcurrency <= 0 {
+		return nil
+	}
+	agingSec := json.GetNumberWithDefault[int64](c, `priority_aging_sec`, DXTaskWorkerPoolDefaultAgingSec)
+	am.WorkerPool = NewTaskWorkerPool(maxConcurrency, agingSec)
+	if metrics.Manager.IsEnabled {
+		metrics.Manager.RegisterGaugeFunc("dxlib_task_worker_pool_queue_depth", "Number of task executions waiting for a worker.", func() float64 {
+			return float64(am.WorkerPool.QueueDepth())
+		})
+		metrics.Manager.RegisterGaugeFunc("dxlib_task_worker_pool_active_workers", "Number of task executions holding a worker.", func() float64 {
+			return float64(am.WorkerPool.ActiveWorkers())
+		})
+	}
+	return nil
+}
+
 func (am *DXTaskManager) StartAll(errorGroup *errgroup.Group, errorGroupContext context.Context) error {
 	am.ErrorGroup = errorGroup
 	am.ErrorGroupContext = errorGroupContext
+	err := am.ApplyConfigurations()
+	if err != nil {
+		return err
+	}
 
 	am.ErrorGroup.Go(func() (err error) {
 		<-am.ErrorGroupContext.Done()
@@ -77,6 +133,31 @@ func (am *DXTaskManager) StartAll(errorGroup *errgroup.Group, errorGroupContext
 	return nil
 }
 
+// RunOnce executes the callback of the task taskName a single time, without the scheduler of StartAll.
+func (am *DXTaskManager) RunOnce(ctx context.Context, taskName string) (err error) {
+	a, ok := am.Tasks[taskName]
+	if !ok {
+		err = log.Log.ErrorAndCreateErrorf("Task %s not found", taskName)
+		return err
+	}
+	configuration, ok := configurations.Manager.Get("tasks")
+	if ok {
+		err = am.applyHistoryConfiguration(*configuration.Data)
+		if err != nil {
+			return err
+		}
+		am.applySingletonConfiguration(*configuration.Data)
+		err = a.ApplyConfigurations()
+		if err != nil {
+			return err
+		}
+	}
+	log.Log.Infof("Run once task [%s]... start", a.NameId)
+	err = a.execute(ctx)
+	log.Log.Infof("Run once task [%s]... done (%v)", a.NameId, err)
+	return err
+}
+
 func (am *DXTaskManager) StopAll() (err error) {
 	am.ErrorGroupContext.Done()
 	err = am.ErrorGroup.Wait()
@@ -84,21 +165,34 @@ func (am *DXTaskManager) StopAll() (err error) {
 }
 
 func (a *DXTask) ApplyConfigurations() (err error) {
-	configuration, ok := configurations.Manager.Configurations["tasks"]
+	configuration, ok := configurations.Manager.Get("tasks")
 	if !ok {
 		err := log.Log.FatalAndCreateErrorf("Can not find configuration 'tasks' needed to configure the tasks")
 		return err
 	}
 	c := *configuration.Data
+	isFatal, ok := c[`is_fatal`].(bool)
+	if ok {
+		a.IsFatal = isFatal
+	}
 	c1, ok := c[a.NameId].(utils.JSON)
 	if !ok {
 		return nil
 	}
+	isFatal, ok = c1[`is_fatal`].(bool)
+	if ok {
+		a.IsFatal = isFatal
+	}
+	a.applySingletonConfiguration(c1)
 
 	tStartAt, ok := c1[`start_at`].(string)
 	if ok {
 		a.StartAt = tStartAt
 	}
+	tPriority, err := json.GetNumber[int64](c1, `priority`)
+	if err == nil {
+		a.Priority = tPriority
+	}
 	tAfterDelaySec, err := json.GetNumber[int64](c1, `after_delay_sec`)
 	if err == nil {
 		a.AfterDelaySec = tAfterDelaySec
@@ -106,20 +200,94 @@ func (a *DXTask) ApplyConfigurations() (err error) {
 	return err
 }
 
+// DXTaskPanicError is the error of an execution that panicked, it does not stop the task nor the error group, unless
+// the panic policy is core.PanicPolicyCrash.
+type DXTaskPanicError struct {
+	TaskNameId string
+	Value      any
+	Stack      []byte
+}
+
+func (e *DXTaskPanicError) Error() string {
+	return fmt.Sprintf("task %s panic: %v", e.TaskNameId, e.Value)
+}
+
+func (a *DXTask) callOnExecute() (err error) {
+	defer func() {
+		r := recover()
+		if r != nil {
+			panicErr := &DXTaskPanicError{
+				TaskNameId: a.NameId,
+				Value:      r,
+				Stack:      debug.Stack(),
+			}
+			log.Log.Errorf("Task %s panic recovered (%v)\n%s", a.NameId, r, panicErr.Stack)
+			metrics.Manager.ObservePanic(`task`)
+			if core.IsPanicCrash() {
+				panic(r)
+			}
+			err = panicErr
+		}
+	}()
+	return a.OnExecute(a)
+}
+
+// manager gives the manager of the task, Manager for a task not created by NewTask.
+func (a *DXTask) manager() *DXTaskManager {
+	if a.Owner != nil {
+		return a.Owner
+	}
+	return &Manager
+}
+
+func (a *DXTask) execute(ctx context.Context) (err error) {
+	am := a.manager()
+	if am.WorkerPool != nil {
+		err = am.WorkerPool.Acquire(ctx, a.Priority)
+		if err != nil {
+			return err
+		}
+		defer am.WorkerPool.Release()
+	}
+	if a.IsSingleton {
+		lock, isAcquired, err := a.acquireSingleton(ctx)
+		if err != nil || !isAcquired {
+			return err
+		}
+		defer func() {
+			_ = lock.Release()
+		}()
+	}
+	startTime := time.Now()
+	logContext := a.Log.Context
+	ctx, span := tracing.StartSpan(ctx, "dxlib/v3/tasks", "Task|"+a.NameId)
+	a.Log.Context = ctx
+	err = a.callOnExecute()
+	a.Log.Context = logContext
+	tracing.EndSpan(span, err)
+	metrics.Manager.ObserveTaskExecution(a.NameId, time.Since(startTime).Seconds(), err)
+	am.recordRun(a, startTime, err)
+	return err
+}
+
 func (a *DXTask) StartAndWait(errorGroup *errgroup.Group) error {
 	if !a.RuntimeIsActive {
 		err := a.ApplyConfigurations()
 		if err != nil {
 			return err
 		}
-		errorGroup.Go(func() (err error) {
+		subsystems.Go(errorGroup, a.Context, `task `+a.NameId, a.IsFatal, func() (err error) {
 			a.RuntimeIsActive = true
 			log.Log.Infof("Starting task [%s] at %s... start", a.NameId, a.StartAt)
 			switch a.StartAt {
 			case "once":
 				log.Log.Infof("Task %s at (%s): Starting task start", a.NameId, a.StartAt)
-				err = a.OnExecute(a)
+				err = a.execute(a.Context)
 				log.Log.Infof("Task %s at (%s): Task done: %v", a.NameId, a.StartAt, err)
+				var panicErr *DXTaskPanicError
+				if errors.As(err, &panicErr) {
+					err = nil
+				}
 				log.Log.Info("Start AfterDelay sleep...")
 				time.Sleep(time.Duration(a.AfterDelaySec) * time.Second)
 				log.Log.Info("Finish AfterDelay sleep...")
@@ -128,8 +296,13 @@ func (a *DXTask) StartAndWait(errorGroup *errgroup.Group) error {
 				var iterationIndex uint64 = 0
 				for inLoop {
 					log.Log.Infof("Task %s:%v at (%s): Execute task start", a.NameId, iterationIndex, a.StartAt)
-					err = a.OnExecute(a)
+					err = a.execute(a.Context)
 					log.Log.Infof("Task %s:%v at (%s): Execute task done with result err=%v", a.NameId, iterationIndex, a.StartAt, err)
+					var panicErr *DXTaskPanicError
+					if errors.As(err, &panicErr) {
+						// a panic only fails this iteration, the next one is a retry
+						err = nil
+					}
 					if err != nil {
 						inLoop = false
 					} else {
@@ -0,0 +1,144 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+
+	"dxlib/v3/configurations"
+	"dxlib/v3/core"
+	"dxlib/v3/log"
+	"dxlib/v3/metrics"
+	"dxlib/v3/utils"
+)
+
+// captureTestLog gives the warnings and errors logged until the end of the test.
+func captureTestLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	b := &bytes.Buffer{}
+	log.SetSinks(log.NewSink(`test`, log.DXLogFormatText, log.DXLogLevelWarn, b))
+	t.Cleanup(func() {
+		log.SetSinks()
+	})
+	return b
+}
+
+// setTestTasksConfiguration sets the tasks configuration to data until the end of the test.
+func setTestTasksConfiguration(t *testing.T, data utils.JSON) {
+	t.Helper()
+	configurations.Manager.NewConfiguration(`tasks`, ``, `json`, false, false, data, nil)
+	t.Cleanup(func() {
+		configurations.Manager.NewConfiguration(`tasks`, ``, `json`, false, false, utils.JSON{`enabled`: false}, nil)
+	})
+}
+
+func TestPanickingTaskIsRecovered(t *testing.T) {
+	b := captureTestLog(t)
+	a := &DXTask{Owner: &DXTaskManager{}, NameId: `panicking`, OnExecute: func(task *DXTask) error {
+		panic(`boom`)
+	}}
+
+	err := a.execute(context.Background())
+	var panicErr *DXTaskPanicError
+	require.True(t, errors.As(err, &panicErr), "%v", err)
+	assert.Equal(t, `panicking`, panicErr.TaskNameId)
+	assert.Equal(t, `boom`, panicErr.Value)
+	assert.Contains(t, string(panicErr.Stack), `tasks_test.go`)
+	assert.Contains(t, b.String(), `Task panicking panic recovered (boom)`)
+	assert.Contains(t, b.String(), `tasks_test.go`)
+}
+
+// setTestPanicPolicy sets core.PanicPolicy to p and enables the metrics until the end of the test.
+func setTestPanicPolicy(t *testing.T, p core.DXPanicPolicy) {
+	t.Helper()
+	panicPolicy, isEnabled := core.PanicPolicy, metrics.Manager.IsEnabled
+	core.PanicPolicy, metrics.Manager.IsEnabled = p, true
+	t.Cleanup(func() {
+		core.PanicPolicy, metrics.Manager.IsEnabled = panicPolicy, isEnabled
+	})
+}
+
+// testPanicTotal gives the dxlib_panic_total of scope.
+func testPanicTotal(t *testing.T, scope string) (total float64) {
+	t.Helper()
+	families, err := metrics.Manager.Registry.Gather()
+	require.NoError(t, err)
+	for _, f := range families {
+		if f.GetName() != `dxlib_panic_total` {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == `scope` && l.GetValue() == scope {
+					total += m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return total
+}
+
+func TestPanicPolicyOfTheTaskScope(t *testing.T) {
+	b := captureTestLog(t)
+	a := &DXTask{Owner: &DXTaskManager{}, NameId: `panicking`, OnExecute: func(task *DXTask) error {
+		panic(`boom`)
+	}}
+
+	setTestPanicPolicy(t, core.PanicPolicyRecover)
+	total := testPanicTotal(t, `task`)
+	var panicErr *DXTaskPanicError
+	assert.ErrorAs(t, a.callOnExecute(), &panicErr)
+	assert.Equal(t, total+1, testPanicTotal(t, `task`))
+
+	core.PanicPolicy = core.PanicPolicyCrash
+	assert.PanicsWithValue(t, `boom`, func() {
+		_ = a.callOnExecute()
+	})
+	assert.Equal(t, total+2, testPanicTotal(t, `task`))
+	// both are logged with their stack before
+	assert.Equal(t, 2, strings.Count(b.String(), `Task panicking panic recovered (boom)`))
+	assert.Equal(t, 2, strings.Count(b.String(), `[running]`))
+}
+
+func TestPanickingTaskDoesNotEndTheErrorGroup(t *testing.T) {
+	captureTestLog(t)
+	setTestTasksConfiguration(t, utils.JSON{})
+	am := &DXTaskManager{Tasks: map[string]*DXTask{}}
+	am.Context, am.Cancel = context.WithCancel(context.Background())
+	defer am.Cancel()
+	g, gCtx := errgroup.WithContext(context.Background())
+
+	var panickingRuns, otherRuns atomic.Int32
+	panicking, err := am.NewTask(`panicking`, `always`, 0, func(task *DXTask) error {
+		if panickingRuns.Add(1) <= 2 {
+			panic(`boom`)
+		}
+		<-task.Context.Done()
+		return nil
+	})
+	require.NoError(t, err)
+	other, err := am.NewTask(`other`, `always`, 0, func(task *DXTask) error {
+		otherRuns.Add(1)
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, panicking.StartAndWait(g))
+	require.NoError(t, other.StartAndWait(g))
+
+	// the panicking iterations are retried, the other task keeps running
+	require.Eventually(t, func() bool {
+		return panickingRuns.Load() >= 3 && otherRuns.Load() >= 3
+	}, 5*time.Second, time.Millisecond)
+	assert.NoError(t, gCtx.Err())
+	am.Cancel()
+	assert.NoError(t, g.Wait())
+}
@@ -0,0 +1,165 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
+
+	v3 "dxlib/v3"
+	"dxlib/v3/configurations"
+	"dxlib/v3/log"
+	"dxlib/v3/utils"
+)
+
+const DXTracingDefaultSampleRatio = 1.0
+
+type DXTracingManager struct {
+	IsEnabled      bool
+	ServiceName    string
+	Endpoint       string
+	URLPath        string
+	IsInsecure     bool
+	Headers        map[string]string
+	SampleRatio    float64
+	TracerProvider *sdktrace.TracerProvider
+}
+
+func (tm *DXTracingManager) ApplyConfigurations() (err error) {
+	configuration, ok := configurations.Manager.Get("tracing")
+	if !ok {
+		tm.IsEnabled = false
+		return nil
+	}
+	c := *configuration.Data
+	tm.IsEnabled, ok = c[`enabled`].(bool)
+	if !ok {
+		tm.IsEnabled = true
+	}
+	tm.Endpoint, ok = c[`endpoint`].(string)
+	if !ok {
+		tm.Endpoint = ""
+	}
+	tm.URLPath, ok = c[`url_path`].(string)
+	if !ok {
+		tm.URLPath = ""
+	}
+	tm.IsInsecure, ok = c[`insecure`].(bool)
+	if !ok {
+		tm.IsInsecure = false
+	}
+	tm.ServiceName, ok = c[`service_name`].(string)
+	if !ok {
+		tm.ServiceName = v3.AppNameId
+	}
+	tm.SampleRatio, ok = c[`sample_ratio`].(float64)
+	if !ok {
+		tm.SampleRatio = DXTracingDefaultSampleRatio
+	}
+	headers, ok := c[`headers`].(utils.JSON)
+	if ok {
+		tm.Headers, err = utils.JSONToMapStringString(headers)
+		if err != nil {
+			err = log.Log.ErrorAndCreateErrorf("Configuration 'tracing.headers' must be a map of string (%v)", err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (tm *DXTracingManager) Start(ctx context.Context) (err error) {
+	if !tm.IsEnabled {
+		return nil
+	}
+	log.Log.Infof("Starting tracing to %s... start", tm.Endpoint)
+	options := []otlptracehttp.Option{}
+	if tm.Endpoint != "" {
+		options = append(options, otlptracehttp.WithEndpoint(tm.Endpoint))
+	}
+	if tm.URLPath != "" {
+		options = append(options, otlptracehttp.WithURLPath(tm.URLPath))
+	}
+	if tm.IsInsecure {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	if len(tm.Headers) > 0 {
+		options = append(options, otlptracehttp.WithHeaders(tm.Headers))
+	}
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		log.Log.Errorf("Cannot create OTLP trace exporter (%v)", err)
+		return err
+	}
+	r, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(tm.ServiceName)))
+	if err != nil {
+		log.Log.Errorf("Cannot create tracing resource (%v)", err)
+		return err
+	}
+	tm.TracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(r),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(tm.SampleRatio))),
+	)
+	otel.SetTracerProvider(tm.TracerProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	log.Log.Infof("Starting tracing to %s... done", tm.Endpoint)
+	return nil
+}
+
+func (tm *DXTracingManager) Stop(ctx context.Context) (err error) {
+	if tm.TracerProvider == nil {
+		return nil
+	}
+	log.Log.Info("Stopping tracing...")
+	err = tm.TracerProvider.Shutdown(ctx)
+	tm.TracerProvider = nil
+	return err
+}
+
+// Extract reads the incoming trace context (W3C traceparent) from the carrier, a no-op when tracing is disabled.
+func Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
+
+func Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+}
+
+func StartSpan(ctx context.Context, tracerName string, spanName string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return otel.Tracer(tracerName).Start(ctx, spanName, trace.WithAttributes(attributes...))
+}
+
+func StartDBSpan(ctx context.Context, driverName string, statement string) (context.Context, trace.Span) {
+	return StartSpan(ctx, "dxlib/v3/databases", "DB|"+driverName, semconv.DBSystemKey.String(driverName), semconv.DBStatement(statement))
+}
+
+func StartRedisSpan(ctx context.Context, redisNameId string, command string) (context.Context, trace.Span) {
+	return StartSpan(ctx, "dxlib/v3/redis", "Redis|"+command, semconv.DBSystemRedis, attribute.String("db.redis.name", redisNameId), semconv.DBOperation(command))
+}
+
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+var Manager DXTracingManager
+
+func init() {
+	Manager = DXTracingManager{
+		IsEnabled:   false,
+		SampleRatio: DXTracingDefaultSampleRatio,
+	}
+}
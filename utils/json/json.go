@@ -110,6 +110,25 @@ func GetString(kv utils.JSON, k string) (v string, err error) {
 	return z, nil
 }
 
+func GetStrings(kv utils.JSON, k string) (v []string, err error) {
+	switch kv[k].(type) {
+	case []string:
+		return kv[k].([]string), nil
+	case []any:
+		v = []string{}
+		for _, x := range kv[k].([]any) {
+			s, ok := x.(string)
+			if !ok {
+				return nil, fmt.Errorf("can not get %s as %T from %v", k, v, kv)
+			}
+			v = append(v, s)
+		}
+		return v, nil
+	default:
+		return nil, fmt.Errorf("can not get %s as %T from %v", k, v, kv)
+	}
+}
+
 func GetNumber[A Number](kv utils.JSON, k string) (v A, err error) {
 	var z float64
 	switch kv[k].(type) {
@@ -0,0 +1,137 @@
+package os
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// BindEnv sets the fields of the struct v points to from the environment variables of their env tags, like
+// `env:"SHUTDOWN_TIMEOUT" default:"30s"`, a variable that is not set takes the default or else keeps the field as it
+// is. `env:"NAME,required"` must be set, an empty value counts as set. The strings, bools, ints, uints, floats,
+// time.Duration, the []string of a comma list, the map[string]string of a name=value comma list and the
+// encoding.TextUnmarshaler are converted, a struct field without env tag is bound in turn. Every variable that cannot
+// be bound is reported at once in the error.
+func BindEnv(v any) (err error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("EnvBindingNotStructPointer:%T", v)
+	}
+	errs := []error{}
+	bindEnvStruct(rv.Elem(), &errs)
+	return errors.Join(errs...)
+}
+
+func bindEnvStruct(v reflect.Value, errs *[]error) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag, ok := f.Tag.Lookup(`env`)
+		if !ok {
+			if f.Type.Kind() == reflect.Struct && f.Type != reflect.TypeOf(time.Time{}) {
+				bindEnvStruct(v.Field(i), errs)
+			}
+			continue
+		}
+		name, options, _ := strings.Cut(tag, `,`)
+		s, isSet := os.LookupEnv(name)
+		if !isSet {
+			if options == `required` {
+				*errs = append(*errs, fmt.Errorf("EnvRequiredNotSet:%s", name))
+				continue
+			}
+			s, isSet = f.Tag.Lookup(`default`)
+			if !isSet {
+				continue
+			}
+		}
+		err := setEnvValue(v.Field(i), s)
+		if err != nil {
+			*errs = append(*errs, fmt.Errorf("EnvInvalid:%s:%w", name, err))
+		}
+	}
+}
+
+func setEnvValue(v reflect.Value, s string) (err error) {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("EnvTypeNotSupported:%s", v.Type())
+		}
+		l := reflect.MakeSlice(v.Type(), 0, 0)
+		for _, x := range strings.Split(s, `,`) {
+			x = strings.TrimSpace(x)
+			if x != `` {
+				l = reflect.Append(l, reflect.ValueOf(x).Convert(v.Type().Elem()))
+			}
+		}
+		v.Set(l)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String || v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("EnvTypeNotSupported:%s", v.Type())
+		}
+		m := reflect.MakeMap(v.Type())
+		for _, x := range strings.Split(s, `,`) {
+			x = strings.TrimSpace(x)
+			if x == `` {
+				continue
+			}
+			k, value, ok := strings.Cut(x, `=`)
+			if !ok {
+				return fmt.Errorf("EnvMapItemWithoutValue:%s", x)
+			}
+			m.SetMapIndex(reflect.ValueOf(strings.TrimSpace(k)).Convert(v.Type().Key()), reflect.ValueOf(strings.TrimSpace(value)).Convert(v.Type().Elem()))
+		}
+		v.Set(m)
+	default:
+		return fmt.Errorf("EnvTypeNotSupported:%s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package os
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testEnvSettings struct {
+	Name     string            `env:"TEST_NAME,required"`
+	Timeout  time.Duration     `env:"TEST_TIMEOUT" default:"30s"`
+	Workers  int               `env:"TEST_WORKERS"`
+	IsDebug  bool              `env:"TEST_IS_DEBUG"`
+	Hosts    []string          `env:"TEST_HOSTS"`
+	Replicas map[string]string `env:"TEST_REPLICAS"`
+	Nested   struct {
+		Ratio float64 `env:"TEST_RATIO" default:"0.5"`
+	}
+	Untagged string
+}
+
+func TestBindEnv(t *testing.T) {
+	t.Setenv(`TEST_NAME`, `app`)
+	t.Setenv(`TEST_WORKERS`, `4`)
+	t.Setenv(`TEST_IS_DEBUG`, `true`)
+	t.Setenv(`TEST_HOSTS`, `a, b,`)
+	t.Setenv(`TEST_REPLICAS`, `main=db1, report = db2`)
+	s := testEnvSettings{Untagged: `kept`}
+
+	require.NoError(t, BindEnv(&s))
+	assert.Equal(t, `app`, s.Name)
+	assert.Equal(t, 30*time.Second, s.Timeout)
+	assert.Equal(t, 4, s.Workers)
+	assert.True(t, s.IsDebug)
+	assert.Equal(t, []string{`a`, `b`}, s.Hosts)
+	assert.Equal(t, map[string]string{`main`: `db1`, `report`: `db2`}, s.Replicas)
+	assert.Equal(t, 0.5, s.Nested.Ratio)
+	assert.Equal(t, `kept`, s.Untagged)
+}
+
+func TestBindEnvReportsEveryErrorAtOnce(t *testing.T) {
+	t.Setenv(`TEST_TIMEOUT`, `30 seconds`)
+	t.Setenv(`TEST_WORKERS`, `four`)
+	t.Setenv(`TEST_REPLICAS`, `main`)
+	s := testEnvSettings{}
+
+	err := BindEnv(&s)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, `EnvRequiredNotSet:TEST_NAME`)
+	assert.ErrorContains(t, err, `EnvInvalid:TEST_TIMEOUT:time: unknown unit`)
+	assert.ErrorContains(t, err, `EnvInvalid:TEST_WORKERS`)
+	assert.ErrorContains(t, err, `EnvInvalid:TEST_REPLICAS:EnvMapItemWithoutValue:main`)
+	assert.Equal(t, time.Duration(0), s.Timeout)
+
+	// an empty value counts as set
+	t.Setenv(`TEST_NAME`, ``)
+	err = BindEnv(&s)
+	assert.NotContains(t, err.Error(), `TEST_NAME`)
+}
+
+func TestBindEnvOfANonStructPointer(t *testing.T) {
+	s := testEnvSettings{}
+	assert.EqualError(t, BindEnv(s), `EnvBindingNotStructPointer:os.testEnvSettings`)
+}